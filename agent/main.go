@@ -0,0 +1,95 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/chinacoolhacker/heketi/pkg/agent"
+	"github.com/spf13/cobra"
+)
+
+var (
+	HEKETI_VERSION = "(dev)"
+	showVersion    bool
+	listen         string
+	tlsFiles       agent.TLSFiles
+	serverConfig   agent.ServerConfig
+)
+
+var RootCmd = &cobra.Command{
+	Use:     "heketi-agent",
+	Short:   "Heketi node agent",
+	Long:    "Heketi node agent, setting up the devices and bricks of a node for heketi",
+	Example: "heketi-agent --cert=/etc/heketi/agent.crt --key=/etc/heketi/agent.key --cacert=/etc/heketi/ca.crt",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("Heketi agent %v\n", HEKETI_VERSION)
+		if showVersion {
+			os.Exit(0)
+		}
+
+		tlsConfig, err := tlsFiles.ServerConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		server := &http.Server{
+			Addr:      listen,
+			Handler:   agent.NewServer(&serverConfig, nil).Handler(),
+			TLSConfig: tlsConfig,
+		}
+
+		// Shutdown on CTRL-C signal
+		signalch := make(chan os.Signal, 1)
+		signal.Notify(signalch, os.Interrupt, syscall.SIGTERM)
+
+		errch := make(chan error, 1)
+		go func() {
+			fmt.Printf("Listening on %v\n", listen)
+			errch <- server.ListenAndServeTLS("", "")
+		}()
+
+		select {
+		case err := <-errch:
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			os.Exit(1)
+		case <-signalch:
+			fmt.Printf("Shutting down...\n")
+		}
+	},
+}
+
+func init() {
+	RootCmd.Flags().StringVar(&listen, "listen", ":24011",
+		"Address to listen on")
+	RootCmd.Flags().StringVar(&tlsFiles.CertFile, "cert", "",
+		"Certificate file of the agent")
+	RootCmd.Flags().StringVar(&tlsFiles.KeyFile, "key", "",
+		"Private key file of the certificate of the agent")
+	RootCmd.Flags().StringVar(&tlsFiles.CACertFile, "cacert", "",
+		"Certificate file of the authority which signed the certificates of heketi")
+	RootCmd.Flags().StringVar(&serverConfig.Fstab, "fstab", "/etc/fstab",
+		"Fstab file the mounts of the bricks are added to")
+	RootCmd.Flags().StringVar(&serverConfig.MountRoot, "mount-root", "/var/lib/heketi/mounts",
+		"Directory the bricks are mounted in, the agent only creates, mounts and removes directories in it")
+	RootCmd.Flags().BoolVarP(&showVersion, "version", "v", false,
+		"Show version")
+	RootCmd.SilenceUsage = true
+}
+
+func main() {
+	if err := RootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
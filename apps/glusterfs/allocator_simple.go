@@ -12,7 +12,6 @@ package glusterfs
 import (
 	"sync"
 
-	"github.com/boltdb/bolt"
 	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 )
 
@@ -29,7 +28,7 @@ func NewSimpleAllocator() *SimpleAllocator {
 	return s
 }
 
-func (s *SimpleAllocator) loadRingFromDB(tx *bolt.Tx) error {
+func (s *SimpleAllocator) loadRingFromDB(tx wdb.Tx) error {
 	s.rings = map[string]*SimpleAllocatorRing{}
 
 	clusters, err := ClusterList(tx)
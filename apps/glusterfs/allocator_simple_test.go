@@ -13,7 +13,7 @@ import (
 	"os"
 	"testing"
 
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/heketi/tests"
@@ -105,7 +105,7 @@ func TestSimpleAllocatorInitFromDb(t *testing.T) {
 
 	// Get the cluster list
 	var clusterId string
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		clusters, err := ClusterList(tx)
 		if err != nil {
 			return err
@@ -155,7 +155,7 @@ func TestSimpleAllocatorInitFromDbWithOfflineDevices(t *testing.T) {
 
 	// Get the cluster list
 	var clusterId, nodeId string
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		clusters, err := ClusterList(tx)
 		if err != nil {
 			return err
@@ -15,13 +15,14 @@ import (
 	"net/http"
 	"os"
 	"strconv"
-	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
-	"github.com/chinacoolhacker/heketi/executors/kubeexec"
+	"github.com/chinacoolhacker/heketi/executors/faultexec"
 	"github.com/chinacoolhacker/heketi/executors/mockexec"
-	"github.com/chinacoolhacker/heketi/executors/sshexec"
+	"github.com/chinacoolhacker/heketi/executors/recordexec"
+	"github.com/chinacoolhacker/heketi/executors/retryexec"
+	"github.com/chinacoolhacker/heketi/executors/routeexec"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/gorilla/mux"
 	"github.com/heketi/rest"
@@ -45,12 +46,21 @@ var (
 )
 
 type App struct {
-	asyncManager *rest.AsyncHttpManager
-	db           *bolt.DB
+	asyncManager *AsyncOperationManager
+	scheduler    *OperationScheduler
+	db           wdb.Store
 	dbReadOnly   bool
 	executor     executors.Executor
 	_allocator   Allocator
 	conf         *GlusterFSConfig
+	recordFile   *os.File
+	// set in the builds that inject faults
+	faults *faultexec.FaultExecutor
+	// the executors pinning the host keys of the nodes, by the name
+	// of the executor, empty for the default one
+	hostKeys map[string]hostKeyPinner
+	// set when executors are selected per cluster or node
+	router *routeexec.RouteExecutor
 
 	// For testing only.  Keep access to the object
 	// not through the interface
@@ -70,27 +80,51 @@ func NewApp(configIo io.Reader) *App {
 	// Setup loglevel
 	app.setLogLevel(app.conf.Loglevel)
 
-	// Setup asynchronous manager
-	app.asyncManager = rest.NewAsyncHttpManager(ASYNC_ROUTE)
-
 	// Setup executor
 	var err error
-	switch {
-	case app.conf.Executor == "mock":
-		app.xo, err = mockexec.NewMockExecutor()
-		app.executor = app.xo
-	case app.conf.Executor == "kube" || app.conf.Executor == "kubernetes":
-		app.executor, err = kubeexec.NewKubeExecutor(&app.conf.KubeConfig)
-	case app.conf.Executor == "ssh" || app.conf.Executor == "":
-		app.executor, err = sshexec.NewSshExecutor(&app.conf.SshConfig)
-	default:
-		return nil
-	}
+	app.executor, err = newSelectedExecutor(&app.conf.ExecutorConfig)
 	if err != nil {
 		logger.Err(err)
 		return nil
 	}
+	app.xo, _ = app.executor.(*mockexec.MockExecutor)
+	app.hostKeys = map[string]hostKeyPinner{}
+	if pinner := hostKeyPinnerOf(app.executor); pinner != nil {
+		app.hostKeys[""] = pinner
+	}
 	logger.Info("Loaded %v executor", app.conf.Executor)
+	if len(app.conf.Executors) != 0 {
+		app.router, err = newRouteExecutor(app.executor, app.conf, app.hostKeys)
+		if err != nil {
+			logger.Err(err)
+			return nil
+		}
+		app.executor = app.router
+	}
+	if app.conf.RecordFile != "" {
+		app.recordFile, err = os.OpenFile(app.conf.RecordFile,
+			os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			logger.LogError("Unable to open executor record file: %v", err)
+			return nil
+		}
+		logger.Info("Recording executor calls to %v", app.conf.RecordFile)
+		app.executor = recordexec.NewRecordingExecutor(app.executor,
+			app.recordFile)
+	}
+	if retryConfig := app.retryConfig(); retryConfig.Attempts > 1 {
+		logger.Info("Retrying idempotent executor commands up to %v times",
+			retryConfig.Attempts)
+		app.executor = retryexec.NewRetryExecutor(app.executor, retryConfig)
+	}
+	app.faults, err = newFaultExecutor(app.executor, app.conf.FaultInjection)
+	if err != nil {
+		logger.LogError("Invalid fault injection rules: %v", err)
+		return nil
+	}
+	if app.faults != nil {
+		app.executor = app.faults
+	}
 
 	// Set db is set in the configuration file
 	if app.conf.DBfile != "" {
@@ -98,21 +132,19 @@ func NewApp(configIo io.Reader) *App {
 	}
 
 	// Setup BoltDB database
-	app.db, err = bolt.Open(dbfilename, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	app.db, err = wdb.Open(app.conf.DbBackend, dbfilename, false)
 	if err != nil {
 		logger.LogError("Unable to open database: %v. Retrying using read only mode", err)
 
 		// Try opening as read-only
-		app.db, err = bolt.Open(dbfilename, 0666, &bolt.Options{
-			ReadOnly: true,
-		})
+		app.db, err = wdb.Open(app.conf.DbBackend, dbfilename, true)
 		if err != nil {
 			logger.LogError("Unable to open database: %v", err)
 			return nil
 		}
 		app.dbReadOnly = true
 	} else {
-		err = app.db.Update(func(tx *bolt.Tx) error {
+		err = app.db.Update(func(tx wdb.Tx) error {
 			err := initializeBuckets(tx)
 			if err != nil {
 				logger.LogError("Unable to initialize buckets")
@@ -135,6 +167,16 @@ func NewApp(configIo io.Reader) *App {
 		}
 	}
 
+	for _, pinner := range app.hostKeys {
+		pinner.SetHostKeyStore(&nodeHostKeys{db: app.db})
+	}
+
+	if err := app.routeNodes(); err != nil {
+		logger.LogError("Unable to route the nodes to their executors: %v", err)
+		app.db.Close()
+		return nil
+	}
+
 	// Abort the application if there are pending operations in the db.
 	// In the immediate future we need to prevent incomplete operations
 	// from piling up in the db. If there are any pending ops in the db
@@ -163,6 +205,35 @@ func NewApp(configIo io.Reader) *App {
 	// Set block settings
 	app.setBlockSettings()
 
+	// Setup operation scheduler
+	app.scheduler = NewOperationScheduler(app.conf.MaxOperations,
+		app.conf.MaxClusterOperations, app.conf.MaxQueuedOperations)
+
+	// Setup asynchronous manager. The state of the operations is kept
+	// in the db so it is not lost when heketi restarts or another
+	// instance takes over.
+	app.asyncManager = NewAsyncOperationManager(ASYNC_ROUTE, app.db)
+	if !app.dbReadOnly {
+		if err := app.asyncManager.Recover(); err != nil {
+			logger.LogError("Unable to recover async operations: %v", err)
+			app.db.Close()
+			return nil
+		}
+	}
+
+	// Set up encryption of sensitive fields in the db
+	err = app.setDbEncryption()
+	if err != nil {
+		logger.LogError("Unable to set up db encryption: %v", err)
+		app.db.Close()
+		return nil
+	}
+
+	// Remove the expired async operations from time to time
+	if !app.dbReadOnly {
+		app.asyncManager.StartPruning(AsyncOperationPruneInterval)
+	}
+
 	// Show application has loaded
 	logger.Info("GlusterFS Application Loaded")
 
@@ -203,6 +274,11 @@ func (a *App) setFromEnvironmentalVariable() {
 			logger.LogError("Error: Atoi in Block Hosting Volume Size: %v", err)
 		}
 	}
+
+	env = os.Getenv("HEKETI_DB_ENCRYPTION_KEY")
+	if "" != env {
+		a.conf.DbEncryptionKey = env
+	}
 }
 
 func (a *App) setAdvSettings() {
@@ -226,6 +302,25 @@ func (a *App) setAdvSettings() {
 		// Convert to KB
 		BrickMinSize = uint64(a.conf.BrickMinSize) * 1024 * 1024
 	}
+	if a.conf.AsyncOperationTtl != 0 {
+		logger.Info("Adv: Async operation results kept for %v seconds",
+			a.conf.AsyncOperationTtl)
+
+		// From async_operation.go
+		AsyncOperationTtl = int64(a.conf.AsyncOperationTtl)
+	}
+	if a.conf.MaxOperations != 0 {
+		logger.Info("Adv: Max concurrent operations set to %v",
+			a.conf.MaxOperations)
+	}
+	if a.conf.MaxClusterOperations != 0 {
+		logger.Info("Adv: Max concurrent operations per cluster set to %v",
+			a.conf.MaxClusterOperations)
+	}
+	if a.conf.MaxQueuedOperations != 0 {
+		logger.Info("Adv: Max queued operations set to %v",
+			a.conf.MaxQueuedOperations)
+	}
 }
 
 func (a *App) setBlockSettings() {
@@ -243,6 +338,46 @@ func (a *App) setBlockSettings() {
 	}
 }
 
+// retryConfig returns the retries of the idempotent executor commands.
+// They are set by executor_retry, which takes precedence over the
+// deprecated retries setting of the executor.
+func (a *App) retryConfig() *retryexec.RetryConfig {
+	config := a.conf.RetryConfig
+	if config.Attempts == 0 {
+		if retries := a.planConfig().Retries; retries > 0 {
+			logger.Warning("The retries setting of the executor is deprecated, " +
+				"use executor_retry instead")
+			config.Attempts = retries + 1
+		}
+	}
+	return &config
+}
+
+func (a *App) setDbEncryption() error {
+	var box *utils.SecretBox
+	var err error
+	if a.dbReadOnly {
+		err = a.db.View(func(tx wdb.Tx) error {
+			box, err = loadDataKey(tx, a.conf.DbEncryptionKey)
+			return err
+		})
+	} else {
+		err = a.db.Update(func(tx wdb.Tx) error {
+			box, err = setupDbEncryption(tx, a.conf.DbEncryptionKey)
+			return err
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if box != nil {
+		logger.Info("DB: Sensitive fields are encrypted")
+	}
+	DbSecretBox = box
+	return nil
+}
+
 // Register Routes
 func (a *App) SetRoutes(router *mux.Router) error {
 
@@ -254,6 +389,16 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     ASYNC_ROUTE + "/{id:[A-Fa-f0-9]+}",
 			HandlerFunc: a.asyncManager.HandlerStatus},
+		rest.Route{
+			Name:        "AsyncCancel",
+			Method:      "DELETE",
+			Pattern:     ASYNC_ROUTE + "/{id:[A-Fa-f0-9]+}",
+			HandlerFunc: a.asyncManager.HandlerCancel},
+		rest.Route{
+			Name:        "AsyncIdempotencyKey",
+			Method:      "GET",
+			Pattern:     ASYNC_ROUTE,
+			HandlerFunc: a.asyncManager.HandlerIdempotencyKey},
 
 		// Cluster
 		rest.Route{
@@ -287,7 +432,7 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Name:        "NodeAdd",
 			Method:      "POST",
 			Pattern:     "/nodes",
-			HandlerFunc: a.NodeAdd},
+			HandlerFunc: a.Idempotent(a.NodeAdd)},
 		rest.Route{
 			Name:        "NodeInfo",
 			Method:      "GET",
@@ -303,13 +448,23 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "POST",
 			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/state",
 			HandlerFunc: a.NodeSetState},
+		rest.Route{
+			Name:        "NodeHostKey",
+			Method:      "GET",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/hostkey",
+			HandlerFunc: a.NodeHostKey},
+		rest.Route{
+			Name:        "NodeHostKeyPin",
+			Method:      "POST",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/hostkey",
+			HandlerFunc: a.NodeHostKeyPin},
 
 		// Devices
 		rest.Route{
 			Name:        "DeviceAdd",
 			Method:      "POST",
 			Pattern:     "/devices",
-			HandlerFunc: a.DeviceAdd},
+			HandlerFunc: a.Idempotent(a.DeviceAdd)},
 		rest.Route{
 			Name:        "DeviceInfo",
 			Method:      "GET",
@@ -336,7 +491,7 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Name:        "VolumeCreate",
 			Method:      "POST",
 			Pattern:     "/volumes",
-			HandlerFunc: a.VolumeCreate},
+			HandlerFunc: a.Idempotent(a.VolumeCreate)},
 		rest.Route{
 			Name:        "VolumeInfo",
 			Method:      "GET",
@@ -363,7 +518,7 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Name:        "BlockVolumeCreate",
 			Method:      "POST",
 			Pattern:     "/blockvolumes",
-			HandlerFunc: a.BlockVolumeCreate},
+			HandlerFunc: a.Idempotent(a.BlockVolumeCreate)},
 		rest.Route{
 			Name:        "BlockVolumeInfo",
 			Method:      "GET",
@@ -379,6 +534,18 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     "/blockvolumes",
 			HandlerFunc: a.BlockVolumeList},
+		rest.Route{
+			Name:        "BlockVolumeSetAuth",
+			Method:      "POST",
+			Pattern:     "/blockvolumes/{id:[A-Fa-f0-9]+}/auth",
+			HandlerFunc: a.BlockVolumeSetAuth},
+
+		// Operations
+		rest.Route{
+			Name:        "PendingOperationList",
+			Method:      "GET",
+			Pattern:     "/operations/pending",
+			HandlerFunc: a.PendingOperationList},
 
 		// Backup
 		rest.Route{
@@ -429,6 +596,8 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			HandlerFunc: a.MasterSlaveClusterPostHandler},
 	}
 
+	routes = append(routes, a.faultRoutes()...)
+
 	// Register all routes from the App
 	for _, route := range routes {
 
@@ -449,20 +618,26 @@ func (a *App) SetRoutes(router *mux.Router) error {
 
 func (a *App) Close() {
 
+	// Stop pruning the async operations
+	a.asyncManager.Stop()
+
 	// Close the DB
 	a.db.Close()
+	if a.recordFile != nil {
+		a.recordFile.Close()
+	}
 	logger.Info("Closed")
 }
 
 func (a *App) Backup(w http.ResponseWriter, r *http.Request) {
-	err := a.db.View(func(tx *bolt.Tx) error {
-		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Header().Set("Content-Disposition", `attachment; filename="heketi.db"`)
-		w.Header().Set("Content-Length", strconv.Itoa(int(tx.Size())))
-		_, err := tx.WriteTo(w)
-		return err
-	})
-	if err != nil {
+	if !credentialsRequested(r) {
+		if err := backupRedactedDb(a.db, w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := writeDbBackup(a.db, w); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
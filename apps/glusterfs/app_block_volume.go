@@ -14,7 +14,7 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/gorilla/mux"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
@@ -44,7 +44,7 @@ func (a *App) BlockVolumeCreate(w http.ResponseWriter, r *http.Request) {
 
 	// TODO: factor this into a function (it's also in VolumeCreate)
 	// Check that the clusters requested are available
-	err = a.db.View(func(tx *bolt.Tx) error {
+	err = a.db.View(func(tx wdb.Tx) error {
 
 		// :TODO: All we need to do is check for one instead of gathering all keys
 		clusters, err := ClusterList(tx)
@@ -78,9 +78,8 @@ func (a *App) BlockVolumeCreate(w http.ResponseWriter, r *http.Request) {
 
 	bvc := NewBlockVolumeCreateOperation(blockVolume, a.db)
 	if err := AsyncHttpOperation(a, w, r, bvc); err != nil {
-		http.Error(w,
-			fmt.Sprintf("Failed to allocate new block volume: %v", err),
-			http.StatusInternalServerError)
+		OperationHttpError(w,
+			fmt.Sprintf("Failed to allocate new block volume: %v", err), err)
 		return
 	}
 }
@@ -89,7 +88,7 @@ func (a *App) BlockVolumeList(w http.ResponseWriter, r *http.Request) {
 
 	var list api.BlockVolumeListResponse
 
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 		var err error
 
 		list.BlockVolumes, err = ListCompleteBlockVolumes(tx)
@@ -121,7 +120,7 @@ func (a *App) BlockVolumeInfo(w http.ResponseWriter, r *http.Request) {
 
 	// Get volume information
 	var info *api.BlockVolumeInfoResponse
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 		entry, err := NewBlockVolumeEntryFromId(tx, id)
 		if err == ErrNotFound || !entry.Visible() {
 			http.Error(w, "Id not found", http.StatusNotFound)
@@ -156,7 +155,7 @@ func (a *App) BlockVolumeDelete(w http.ResponseWriter, r *http.Request) {
 	id := vars["id"]
 
 	var blockVolume *BlockVolumeEntry
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 		var err error
 		blockVolume, err = NewBlockVolumeEntryFromId(tx, id)
 		if err == ErrNotFound {
@@ -175,9 +174,57 @@ func (a *App) BlockVolumeDelete(w http.ResponseWriter, r *http.Request) {
 
 	vdel := NewBlockVolumeDeleteOperation(blockVolume, a.db)
 	if err := AsyncHttpOperation(a, w, r, vdel); err != nil {
-		http.Error(w,
-			fmt.Sprintf("Failed to set up block volume delete: %v", err),
-			http.StatusInternalServerError)
+		OperationHttpError(w,
+			fmt.Sprintf("Failed to set up block volume delete: %v", err), err)
+		return
+	}
+}
+
+func (a *App) BlockVolumeSetAuth(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.BlockVolumeAuthRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		logger.LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var blockVolume *BlockVolumeEntry
+	err = a.db.View(func(tx wdb.Tx) error {
+		var err error
+		blockVolume, err = NewBlockVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		if !blockVolume.Visible() {
+			http.Error(w, ErrConflict.Error(), http.StatusConflict)
+			return ErrConflict
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	bva := NewBlockVolumeAuthOperation(blockVolume, a.db, msg.Auth)
+	if err := AsyncHttpOperation(a, w, r, bva); err != nil {
+		OperationHttpError(w,
+			fmt.Sprintf("Failed to set up block volume auth change: %v", err), err)
 		return
 	}
 }
@@ -11,6 +11,7 @@ package glusterfs
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -20,8 +21,9 @@ import (
 	"testing"
 	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
+	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/heketi/tests"
@@ -399,7 +401,7 @@ func TestBlockVolumeList(t *testing.T) {
 
 	// Create some volumes
 	numvolumes := 1000
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 
 		for i := 0; i < numvolumes; i++ {
 			v := createSampleBlockVolumeEntry(100)
@@ -427,7 +429,7 @@ func TestBlockVolumeList(t *testing.T) {
 	tests.Assert(t, len(msg.BlockVolumes) == numvolumes)
 
 	// Check that all the volumes are in the database
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		for _, id := range msg.BlockVolumes {
 			_, err := NewBlockVolumeEntryFromId(tx, id)
 			if err != nil {
@@ -450,7 +452,7 @@ func TestBlockVolumeListReadOnlyDb(t *testing.T) {
 
 	// Create some volumes
 	numvolumes := 1000
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 
 		for i := 0; i < numvolumes; i++ {
 			v := createSampleBlockVolumeEntry(100)
@@ -467,9 +469,7 @@ func TestBlockVolumeListReadOnlyDb(t *testing.T) {
 	app.Close()
 
 	// Open Db here to force read only mode
-	db, err := bolt.Open(tmpfile, 0666, &bolt.Options{
-		ReadOnly: true,
-	})
+	db, err := wdb.Open("", tmpfile, true)
 	tests.Assert(t, err == nil, err)
 	tests.Assert(t, db != nil)
 
@@ -496,7 +496,7 @@ func TestBlockVolumeListReadOnlyDb(t *testing.T) {
 	tests.Assert(t, len(msg.BlockVolumes) == numvolumes)
 
 	// Check that all the volumes are in the database
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		for _, id := range msg.BlockVolumes {
 			_, err := NewBlockVolumeEntryFromId(tx, id)
 			if err != nil {
@@ -591,3 +591,339 @@ func TestBlockVolumeDelete(t *testing.T) {
 	tests.Assert(t, r.StatusCode == http.StatusNotFound)
 	tests.Assert(t, err == nil)
 }
+
+func waitForBlockVolumeAuth(t *testing.T,
+	url string, request []byte) api.BlockVolumeInfoResponse {
+
+	r, err := http.Post(url, "application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got", r.StatusCode)
+	location, err := r.Location()
+	tests.Assert(t, err == nil)
+
+	var info api.BlockVolumeInfoResponse
+	for {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusOK, "got", r.StatusCode)
+		if r.Header.Get("X-Pending") == "true" {
+			time.Sleep(time.Millisecond * 10)
+			continue
+		}
+		err = utils.GetJsonFromResponse(r, &info)
+		tests.Assert(t, err == nil)
+		break
+	}
+	return info
+}
+
+func TestBlockVolumeSetAuth(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Setup database
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create a block volume without auth
+	v := createSampleBlockVolumeEntry(10)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil)
+
+	// Enable auth
+	url := ts.URL + "/blockvolumes/" + v.Info.Id + "/auth"
+	info := waitForBlockVolumeAuth(t, url, []byte(`{"auth": true}`))
+	tests.Assert(t, info.Id == v.Info.Id)
+	tests.Assert(t, info.Auth == true)
+	tests.Assert(t, info.BlockVolume.Username != "")
+	tests.Assert(t, info.BlockVolume.Password != "")
+
+	// Enabling auth again rotates the password
+	rotated := waitForBlockVolumeAuth(t, url, []byte(`{"auth": true}`))
+	tests.Assert(t, rotated.Auth == true)
+	tests.Assert(t, rotated.BlockVolume.Password != "")
+	tests.Assert(t, rotated.BlockVolume.Password != info.BlockVolume.Password,
+		"expected new password, got", rotated.BlockVolume.Password)
+
+	// Disable auth
+	info = waitForBlockVolumeAuth(t, url, []byte(`{"auth": false}`))
+	tests.Assert(t, info.Auth == false)
+	tests.Assert(t, info.BlockVolume.Username == "")
+	tests.Assert(t, info.BlockVolume.Password == "")
+
+	// The entry is no longer pending
+	err = app.db.View(func(tx wdb.Tx) error {
+		entry, err := NewBlockVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.Pending.Id == "")
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// No operations must be left behind
+	tests.Assert(t, !HasPendingOperations(app.db))
+}
+
+func TestBlockVolumeSetAuthFailure(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Setup database
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 10
+	req.Auth = true
+	v := NewBlockVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil)
+
+	app.xo.MockBlockVolumeModifyAuth = func(host string,
+		blockHostingVolumeName string,
+		blockVolumeName string,
+		auth bool) (*executors.BlockVolumeInfo, error) {
+		// the entry is marked pending while the operation runs
+		err := app.db.View(func(tx wdb.Tx) error {
+			entry, err := NewBlockVolumeEntryFromId(tx, v.Info.Id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, entry.Pending.Id != "")
+			return nil
+		})
+		tests.Assert(t, err == nil)
+		return nil, errors.New("modify failed")
+	}
+
+	r, err := http.Post(ts.URL+"/blockvolumes/"+v.Info.Id+"/auth",
+		"application/json", bytes.NewBuffer([]byte(`{"auth": false}`)))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location, err := r.Location()
+	tests.Assert(t, err == nil)
+
+	for {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil)
+		if r.Header.Get("X-Pending") == "true" {
+			time.Sleep(time.Millisecond * 10)
+			continue
+		}
+		tests.Assert(t, r.StatusCode == http.StatusInternalServerError)
+		break
+	}
+
+	// the entry must keep its credentials
+	err = app.db.View(func(tx wdb.Tx) error {
+		entry, err := NewBlockVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.Info.Auth == true)
+		tests.Assert(t, entry.Info.BlockVolume.Password == v.Info.BlockVolume.Password)
+		tests.Assert(t, entry.Pending.Id == "")
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, !HasPendingOperations(app.db))
+}
+
+func TestBlockVolumeRotateAuthSamePassword(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Setup database
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 10
+	req.Auth = true
+	v := NewBlockVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil)
+	tests.Assert(t, v.Info.BlockVolume.Password != "")
+
+	// gluster-block hands back the password the volume already has
+	app.xo.MockBlockVolumeModifyAuth = func(host string,
+		blockHostingVolumeName string,
+		blockVolumeName string,
+		auth bool) (*executors.BlockVolumeInfo, error) {
+		return &executors.BlockVolumeInfo{
+			Name:     blockVolumeName,
+			Username: v.Info.BlockVolume.Username,
+			Password: v.Info.BlockVolume.Password,
+		}, nil
+	}
+
+	r, err := http.Post(ts.URL+"/blockvolumes/"+v.Info.Id+"/auth",
+		"application/json", bytes.NewBuffer([]byte(`{"auth": true}`)))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location, err := r.Location()
+	tests.Assert(t, err == nil)
+
+	for {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil)
+		if r.Header.Get("X-Pending") == "true" {
+			time.Sleep(time.Millisecond * 10)
+			continue
+		}
+		tests.Assert(t, r.StatusCode == http.StatusInternalServerError)
+		break
+	}
+
+	// the rotation must not be reported as done
+	err = app.db.View(func(tx wdb.Tx) error {
+		entry, err := NewBlockVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.Info.Auth == true)
+		tests.Assert(t, entry.Info.BlockVolume.Password == v.Info.BlockVolume.Password)
+		tests.Assert(t, entry.Pending.Id == "")
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, !HasPendingOperations(app.db))
+}
+
+func TestBlockVolumeSetAuthNotFound(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	r, err := http.Post(ts.URL+"/blockvolumes/12345/auth",
+		"application/json", bytes.NewBuffer([]byte(`{"auth": true}`)))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+}
+
+func TestBlockVolumeCredentialsRedacted(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 10
+	req.Auth = true
+	v := NewBlockVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil)
+	tests.Assert(t, v.Info.BlockVolume.Password != "")
+
+	// db dump redacts by default
+	r, err := http.Get(ts.URL + "/db/dump")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK)
+	var dump Db
+	err = utils.GetJsonFromResponse(r, &dump)
+	tests.Assert(t, err == nil)
+	bv := dump.BlockVolumes[v.Info.Id]
+	tests.Assert(t, bv.Info.BlockVolume.Password == REDACTED,
+		"expected redacted password, got", bv.Info.BlockVolume.Password)
+
+	// and includes the credentials only when asked
+	r, err = http.Get(ts.URL + "/db/dump?credentials=true")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK)
+	err = utils.GetJsonFromResponse(r, &dump)
+	tests.Assert(t, err == nil)
+	bv = dump.BlockVolumes[v.Info.Id]
+	tests.Assert(t, bv.Info.BlockVolume.Password == v.Info.BlockVolume.Password)
+
+	// backup redacts by default
+	backupfile := tests.Tempfile()
+	defer os.Remove(backupfile)
+	r, err = http.Get(ts.URL + "/backup/db")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK)
+	data, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	tests.Assert(t, err == nil)
+	tests.Assert(t, !bytes.Contains(data, []byte(v.Info.BlockVolume.Password)))
+	err = ioutil.WriteFile(backupfile, data, 0600)
+	tests.Assert(t, err == nil)
+
+	backup, err := wdb.OpenBoltStore(backupfile, false)
+	tests.Assert(t, err == nil)
+	defer backup.Close()
+	err = backup.View(func(tx wdb.Tx) error {
+		entry, err := NewBlockVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.Info.BlockVolume.Password == REDACTED)
+		tests.Assert(t, entry.Info.BlockVolume.Username == v.Info.BlockVolume.Username)
+
+		_, err = NewClusterEntryFromId(tx, v.Info.Cluster)
+		tests.Assert(t, err == nil)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
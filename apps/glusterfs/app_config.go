@@ -14,28 +14,75 @@ import (
 	"io"
 	"os"
 
+	"github.com/chinacoolhacker/heketi/executors/agentexec"
+	"github.com/chinacoolhacker/heketi/executors/faultexec"
+	"github.com/chinacoolhacker/heketi/executors/gd2exec"
 	"github.com/chinacoolhacker/heketi/executors/kubeexec"
+	"github.com/chinacoolhacker/heketi/executors/localexec"
+	"github.com/chinacoolhacker/heketi/executors/retryexec"
+	"github.com/chinacoolhacker/heketi/executors/simexec"
 	"github.com/chinacoolhacker/heketi/executors/sshexec"
 )
 
 type GlusterFSConfig struct {
-	DBfile     string              `json:"db"`
-	Executor   string              `json:"executor"`
-	Allocator  string              `json:"allocator"`
-	SshConfig  sshexec.SshConfig   `json:"sshexec"`
-	KubeConfig kubeexec.KubeConfig `json:"kubeexec"`
-	Loglevel   string              `json:"loglevel"`
+	DBfile          string `json:"db"`
+	DbBackend       string `json:"db_backend"`
+	DbEncryptionKey string `json:"db_encryption_key"`
+	Allocator       string `json:"allocator"`
+	Loglevel        string `json:"loglevel"`
+
+	// executor of the nodes not selected below and its settings
+	ExecutorConfig
+
+	// executors used instead of the one above for some of the
+	// clusters or nodes, by name. The nodes are matched by id or
+	// manage hostname, the clusters by id.
+	Executors        map[string]*ExecutorConfig `json:"executors"`
+	ClusterExecutors map[string]string          `json:"cluster_executors"`
+	NodeExecutors    map[string]string          `json:"node_executors"`
+
+	// retries of the executor commands that only query the nodes
+	RetryConfig retryexec.RetryConfig `json:"executor_retry"`
+
+	// file the executor calls are recorded to
+	RecordFile string `json:"executor_record_file"`
+
+	// faults injected in the builds made with the faultinject tag
+	FaultInjection []faultexec.FaultRule `json:"fault_injection"`
 
 	// advanced settings
 	BrickMaxSize int `json:"brick_max_size_gb"`
 	BrickMinSize int `json:"brick_min_size_gb"`
 	BrickMaxNum  int `json:"max_bricks_per_volume"`
 
+	// seconds the results of async operations are kept
+	AsyncOperationTtl int `json:"async_operation_ttl"`
+
+	// operations run at the same time and waiting to run, zero means
+	// no limit
+	MaxOperations        int `json:"max_concurrent_operations"`
+	MaxClusterOperations int `json:"max_concurrent_operations_per_cluster"`
+	MaxQueuedOperations  int `json:"max_queued_operations"`
+
 	//block settings
 	CreateBlockHostingVolumes bool `json:"auto_create_block_hosting_volume"`
 	BlockHostingVolumeSize    int  `json:"block_hosting_volume_size"`
 }
 
+// ExecutorConfig is an executor, the default one or one selected for
+// some of the clusters or nodes, and its settings.
+type ExecutorConfig struct {
+	Executor    string                `json:"executor"`
+	SshConfig   sshexec.SshConfig     `json:"sshexec"`
+	KubeConfig  kubeexec.KubeConfig   `json:"kubeexec"`
+	LocalConfig localexec.LocalConfig `json:"localexec"`
+	Gd2Config   gd2exec.Gd2Config     `json:"gd2exec"`
+	AgentConfig agentexec.AgentConfig `json:"agentexec"`
+	SimConfig   simexec.SimConfig     `json:"simexec"`
+	// recording served by the replay executor
+	ReplayFile string `json:"executor_replay_file"`
+}
+
 type ConfigFile struct {
 	GlusterFS GlusterFSConfig `json:"glusterfs"`
 }
@@ -10,14 +10,16 @@
 package glusterfs
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
-	"time"
 
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 )
@@ -33,7 +35,7 @@ type Db struct {
 	PendingOperations map[string]PendingOperationEntry `json:"pendingoperations"`
 }
 
-func dbDumpInternal(db *bolt.DB) (Db, error) {
+func dbDumpInternal(db wdb.RODB) (Db, error) {
 	var dump Db
 	clusterEntryList := make(map[string]ClusterEntry, 0)
 	volEntryList := make(map[string]VolumeEntry, 0)
@@ -44,7 +46,7 @@ func dbDumpInternal(db *bolt.DB) (Db, error) {
 	dbattributeEntryList := make(map[string]DbAttributeEntry, 0)
 	pendingOpEntryList := make(map[string]PendingOperationEntry, 0)
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx wdb.Tx) error {
 
 		logger.Debug("volume bucket")
 
@@ -175,6 +177,10 @@ func dbDumpInternal(db *bolt.DB) (Db, error) {
 			}
 
 			for _, dbattribute := range dbattributes {
+				if dbattribute == DB_DATA_KEY {
+					// the dump holds the sensitive fields in clear text
+					continue
+				}
 				logger.Debug("adding dbattribute entry %v", dbattribute)
 				dbattributeEntry, err := NewDbAttributeEntryFromKey(tx, dbattribute)
 				if err != nil {
@@ -220,10 +226,98 @@ func dbDumpInternal(db *bolt.DB) (Db, error) {
 	return dump, nil
 }
 
+// redactCredentials removes block volume credentials from the dump.
+func (dump *Db) redactCredentials() {
+	for id, blockvolume := range dump.BlockVolumes {
+		blockvolume.RedactCredentials()
+		dump.BlockVolumes[id] = blockvolume
+	}
+}
+
+// credentialsRequested returns true if the client explicitly asked for
+// credentials to be included in db dumps or backups.
+func credentialsRequested(r *http.Request) bool {
+	show, err := strconv.ParseBool(r.URL.Query().Get("credentials"))
+	return err == nil && show
+}
+
+// backupRedactedDb writes a copy of the db, with block volume credentials
+// removed, to the response. The copy is built key by key into a new db file
+// rather than modified in place so no freed page of the copy can contain
+// the original credentials.
+func backupRedactedDb(db wdb.RODB, w http.ResponseWriter) error {
+	tmpfile, err := ioutil.TempFile("", "heketi-backup")
+	if err != nil {
+		return err
+	}
+	tmpfile.Close()
+	defer os.Remove(tmpfile.Name())
+
+	dbcopy, err := wdb.OpenBoltStore(tmpfile.Name(), false)
+	if err != nil {
+		return err
+	}
+	defer dbcopy.Close()
+
+	err = db.View(func(tx wdb.Tx) error {
+		return dbcopy.Update(func(copytx wdb.Tx) error {
+			return tx.ForEach(func(name []byte, b wdb.Bucket) error {
+				copyb, err := copytx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				return b.ForEach(func(k, v []byte) error {
+					if v == nil {
+						// heketi does not use nested buckets
+						return nil
+					}
+					if string(name) == BOLTDB_BUCKET_BLOCKVOLUME {
+						entry := NewBlockVolumeEntry()
+						if err := entry.Unmarshal(v); err != nil {
+							return err
+						}
+						entry.RedactCredentials()
+						if v, err = entry.Marshal(); err != nil {
+							return err
+						}
+					}
+					return copyb.Put(k, v)
+				})
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeDbBackup(dbcopy, w)
+}
+
+// writeDbBackup writes a copy of the db to the response. The copy is
+// always in BoltDB format, whatever the backend, so its size is only
+// known once it has been written.
+func writeDbBackup(db wdb.RODB, w http.ResponseWriter) error {
+	var backup bytes.Buffer
+	err := db.View(func(tx wdb.Tx) error {
+		_, err := tx.WriteTo(&backup)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="heketi.db"`)
+	w.Header().Set("Content-Length", strconv.Itoa(backup.Len()))
+	_, err = backup.WriteTo(w)
+	return err
+}
+
 // DbDump ... Creates a JSON output representing the state of DB
 // This is the variant to be called offline, i.e. when the server is not
-// running.
-func DbDump(jsonfile string, dbfile string, debug bool) error {
+// running. The key is needed to decrypt the sensitive fields of an
+// encrypted db.
+func DbDump(jsonfile string, dbfile string, key string, debug bool) error {
 	if debug {
 		logger.SetLevel(utils.LEVEL_DEBUG)
 	}
@@ -233,10 +327,20 @@ func DbDump(jsonfile string, dbfile string, debug bool) error {
 	}
 	defer fp.Close()
 
-	db, err := bolt.Open(dbfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	db, err := wdb.Open("", dbfile, false)
 	if err != nil {
 		return fmt.Errorf("Unable to open database: %v", err)
 	}
+	defer db.Close()
+
+	err = db.View(func(tx wdb.Tx) error {
+		box, err := loadDataKey(tx, key)
+		DbSecretBox = box
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to decrypt database: %v", err)
+	}
 
 	dump, err := dbDumpInternal(db)
 	if err != nil {
@@ -259,6 +363,10 @@ func (a *App) DbDump(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !credentialsRequested(r) {
+		dump.redactCredentials()
+	}
+
 	// Write msg
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
@@ -267,8 +375,10 @@ func (a *App) DbDump(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// DbCreate ... Creates a bolt db file based on JSON input
-func DbCreate(jsonfile string, dbfile string, debug bool) error {
+// DbCreate ... Creates a db file, using the given storage backend,
+// based on JSON input
+// If a key is given the sensitive fields of the new db are encrypted.
+func DbCreate(jsonfile string, dbfile string, backend string, key string, debug bool) error {
 	if debug {
 		logger.SetLevel(utils.LEVEL_DEBUG)
 	}
@@ -295,14 +405,15 @@ func DbCreate(jsonfile string, dbfile string, debug bool) error {
 		return fmt.Errorf("unable to stat path given for dbfile: %v", dbfile)
 	}
 
-	// Setup BoltDB database
-	dbhandle, err := bolt.Open(dbfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	// Setup database
+	dbhandle, err := wdb.Open(backend, dbfile, false)
 	if err != nil {
 		logger.Debug("Unable to open database: %v", err)
 		return fmt.Errorf("Could not open db file: %v", err.Error())
 	}
+	defer dbhandle.Close()
 
-	err = dbhandle.Update(func(tx *bolt.Tx) error {
+	err = dbhandle.Update(func(tx wdb.Tx) error {
 		return initializeBuckets(tx)
 	})
 	if err != nil {
@@ -310,7 +421,16 @@ func DbCreate(jsonfile string, dbfile string, debug bool) error {
 		return nil
 	}
 
-	err = dbhandle.Update(func(tx *bolt.Tx) error {
+	err = dbhandle.Update(func(tx wdb.Tx) error {
+		box, err := setupDbEncryption(tx, key)
+		DbSecretBox = box
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Could not set up db encryption: %v", err.Error())
+	}
+
+	err = dbhandle.Update(func(tx wdb.Tx) error {
 		for _, cluster := range dump.Clusters {
 			logger.Debug("adding cluster entry %v", cluster.Info.Id)
 			err := cluster.Save(tx)
@@ -384,6 +504,10 @@ func DbCreate(jsonfile string, dbfile string, debug bool) error {
 			}
 		}
 		for _, dbattribute := range dump.DbAttributes {
+			if dbattribute.Key == DB_DATA_KEY {
+				// the new db got its own data key above
+				continue
+			}
 			logger.Debug("adding dbattribute entry %v", dbattribute.Key)
 			err := dbattribute.Save(tx)
 			if err != nil {
@@ -13,7 +13,8 @@ import (
 	"encoding/json"
 	"net/http"
 
-	"github.com/boltdb/bolt"
+	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/gorilla/mux"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
@@ -46,7 +47,7 @@ func (a *App) DeviceAdd(w http.ResponseWriter, r *http.Request) {
 
 	// Check the node is in the db
 	var node *NodeEntry
-	err = a.db.Update(func(tx *bolt.Tx) error {
+	err = a.db.Update(func(tx wdb.Tx) error {
 		var err error
 		node, err = NewNodeEntryFromId(tx, msg.NodeId)
 		if err == ErrNotFound {
@@ -78,7 +79,7 @@ func (a *App) DeviceAdd(w http.ResponseWriter, r *http.Request) {
 
 		defer func() {
 			if e != nil {
-				a.db.Update(func(tx *bolt.Tx) error {
+				a.db.Update(func(tx wdb.Tx) error {
 					err := device.Deregister(tx)
 					if err != nil {
 						logger.Err(err)
@@ -111,7 +112,7 @@ func (a *App) DeviceAdd(w http.ResponseWriter, r *http.Request) {
 		}()
 
 		// Save on db
-		err = a.db.Update(func(tx *bolt.Tx) error {
+		err = a.db.Update(func(tx wdb.Tx) error {
 
 			nodeEntry, err := NewNodeEntryFromId(tx, msg.NodeId)
 			if err != nil {
@@ -158,7 +159,7 @@ func (a *App) DeviceInfo(w http.ResponseWriter, r *http.Request) {
 
 	// Get device information
 	var info *api.DeviceInfoResponse
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 		entry, err := NewDeviceEntryFromId(tx, id)
 		if err == ErrNotFound {
 			http.Error(w, "Id not found", http.StatusNotFound)
@@ -199,7 +200,7 @@ func (a *App) DeviceDelete(w http.ResponseWriter, r *http.Request) {
 		device *DeviceEntry
 		node   *NodeEntry
 	)
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 		var err error
 		// Access device entry
 		device, err = NewDeviceEntryFromId(tx, id)
@@ -243,7 +244,7 @@ func (a *App) DeviceDelete(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Get info from db
-		err = a.db.Update(func(tx *bolt.Tx) error {
+		err = a.db.Update(func(tx wdb.Tx) error {
 
 			// Access node entry
 			node, err := NewNodeEntryFromId(tx, device.NodeId)
@@ -298,6 +299,7 @@ func (a *App) DeviceSetState(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	var device *DeviceEntry
+	var node *NodeEntry
 
 	// Unmarshal JSON
 	var msg api.StateRequest
@@ -314,7 +316,7 @@ func (a *App) DeviceSetState(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check for valid id, return immediately if not valid
-	err = a.db.View(func(tx *bolt.Tx) error {
+	err = a.db.View(func(tx wdb.Tx) error {
 		device, err = NewDeviceEntryFromId(tx, id)
 		if err == ErrNotFound {
 			http.Error(w, "Id not found", http.StatusNotFound)
@@ -324,20 +326,36 @@ func (a *App) DeviceSetState(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
+		node, err = NewNodeEntryFromId(tx, device.NodeId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
 		return nil
 	})
 	if err != nil {
 		return
 	}
 
+	if dryRunRequested(r) {
+		a.dryRunHttp(w, func(db wdb.DB, executor executors.Executor) error {
+			return device.SetState(db, executor, a.Allocator(), msg.State)
+		})
+		return
+	}
+
 	// Set state
-	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
-		err = device.SetState(a.db, a.executor, a.Allocator(), msg.State)
+	err = AsyncHttpScheduledFunc(a, w, r, node.Info.ClusterId, func() (string, error) {
+		err := device.SetState(a.db, a.executor, a.Allocator(), msg.State)
 		if err != nil {
 			return "", err
 		}
 		return "", nil
 	})
+	if err != nil {
+		OperationHttpError(w, err.Error(), err)
+	}
 }
 
 func (a *App) DeviceResync(w http.ResponseWriter, r *http.Request) {
@@ -351,7 +369,7 @@ func (a *App) DeviceResync(w http.ResponseWriter, r *http.Request) {
 	)
 
 	// Get device info from DB
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 		var err error
 		device, err = NewDeviceEntryFromId(tx, deviceId)
 		if err != nil {
@@ -397,7 +415,7 @@ func (a *App) DeviceResync(w http.ResponseWriter, r *http.Request) {
 			device.Info.Storage.Free, info.Size)
 
 		// Update device
-		err = a.db.Update(func(tx *bolt.Tx) error {
+		err = a.db.Update(func(tx wdb.Tx) error {
 
 			// Reload device in current transaction
 			device, err := NewDeviceEntryFromId(tx, deviceId)
@@ -18,10 +18,10 @@ import (
 	"testing"
 	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
 	client "github.com/chinacoolhacker/heketi/client/api/go-client"
 	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/heketi/tests"
@@ -109,7 +109,7 @@ func TestDeviceAddDelete(t *testing.T) {
 	cluster.NodeAdd(node.Info.Id)
 
 	// Save information in the db
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		err := cluster.Save(tx)
 		if err != nil {
 			return err
@@ -182,7 +182,7 @@ func TestDeviceAddDelete(t *testing.T) {
 
 	// Check db to make sure devices where added
 	devicemap := make(map[string]*DeviceEntry)
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		node, err = NewNodeEntryFromId(tx, node.Info.Id)
 		if err != nil {
 			return err
@@ -212,7 +212,7 @@ func TestDeviceAddDelete(t *testing.T) {
 
 	// Add some bricks to check if delete conflicts works
 	fakeid := devicemap["/dev/fake1"].Info.Id
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		device, err := NewDeviceEntryFromId(tx, fakeid)
 		if err != nil {
 			return err
@@ -233,7 +233,7 @@ func TestDeviceAddDelete(t *testing.T) {
 	tests.Assert(t, utils.GetErrorFromResponse(r).Error() == devicemap["/dev/fake1"].ConflictString())
 
 	// Check the db is still intact
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		device, err := NewDeviceEntryFromId(tx, fakeid)
 		if err != nil {
 			return err
@@ -250,7 +250,7 @@ func TestDeviceAddDelete(t *testing.T) {
 	tests.Assert(t, utils.SortedStringHas(node.Devices, fakeid))
 
 	// Node delete bricks from the device
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		device, err := NewDeviceEntryFromId(tx, fakeid)
 		if err != nil {
 			return err
@@ -353,14 +353,14 @@ func TestDeviceAddDelete(t *testing.T) {
 	}
 
 	// Check db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		_, err := NewDeviceEntryFromId(tx, fakeid)
 		return err
 	})
 	tests.Assert(t, err == ErrNotFound)
 
 	// Check node does not have the device
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		node, err = NewNodeEntryFromId(tx, node.Info.Id)
 		return err
 	})
@@ -428,7 +428,7 @@ func TestDeviceAddCleansUp(t *testing.T) {
 	cluster.NodeAdd(node.Info.Id)
 
 	// Save information in the db
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		err := cluster.Save(tx)
 		if err != nil {
 			return err
@@ -544,7 +544,7 @@ func TestDeviceInfo(t *testing.T) {
 	device.StorageAllocate(1000)
 
 	// Save device in the db
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return device.Save(tx)
 	})
 	tests.Assert(t, err == nil)
@@ -589,7 +589,7 @@ func TestDeviceDeleteErrors(t *testing.T) {
 	device.StorageAllocate(1000)
 
 	// Save device in the db
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return device.Save(tx)
 	})
 	tests.Assert(t, err == nil)
@@ -795,7 +795,7 @@ func TestDeviceSync(t *testing.T) {
 	deviceId := utils.GenUUID()
 
 	// Init test database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		cluster := NewClusterEntry()
 		cluster.Info.Id = utils.GenUUID()
 		if err := cluster.Save(tx); err != nil {
@@ -850,7 +850,7 @@ func TestDeviceSync(t *testing.T) {
 		}
 	}
 
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		device, err := NewDeviceEntryFromId(tx, deviceId)
 		tests.Assert(t, err == nil)
 		tests.Assert(t, device.Info.Storage.Total == newFree+used)
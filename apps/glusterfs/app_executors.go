@@ -0,0 +1,169 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/agentexec"
+	"github.com/chinacoolhacker/heketi/executors/gd2exec"
+	"github.com/chinacoolhacker/heketi/executors/kubeexec"
+	"github.com/chinacoolhacker/heketi/executors/localexec"
+	"github.com/chinacoolhacker/heketi/executors/mockexec"
+	"github.com/chinacoolhacker/heketi/executors/recordexec"
+	"github.com/chinacoolhacker/heketi/executors/routeexec"
+	"github.com/chinacoolhacker/heketi/executors/simexec"
+	"github.com/chinacoolhacker/heketi/executors/sshexec"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+)
+
+// newSelectedExecutor returns the executor configured by conf.
+func newSelectedExecutor(conf *ExecutorConfig) (executors.Executor, error) {
+	switch conf.Executor {
+	case "mock":
+		return mockexec.NewMockExecutor()
+	case "kube", "kubernetes":
+		return kubeexec.NewKubeExecutor(&conf.KubeConfig)
+	case "ssh", "":
+		return sshexec.NewSshExecutor(&conf.SshConfig)
+	case "local":
+		return localexec.NewLocalExecutor(&conf.LocalConfig)
+	case "gd2", "glusterd2":
+		return gd2exec.NewGd2Executor(&conf.Gd2Config)
+	case "agent":
+		return agentexec.NewAgentExecutor(&conf.AgentConfig)
+	case "sim":
+		return simexec.NewSimExecutor(&conf.SimConfig)
+	case "replay":
+		return newReplayExecutor(conf.ReplayFile)
+	}
+	return nil, fmt.Errorf("Unknown executor %v", conf.Executor)
+}
+
+func newReplayExecutor(filename string) (executors.Executor, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open executor replay file: %v", err)
+	}
+	defer fp.Close()
+	return recordexec.NewReplayExecutor(fp)
+}
+
+// hostKeyPinnerOf returns executor if it verifies the host keys of the
+// nodes against the keys pinned for them, nil otherwise.
+func hostKeyPinnerOf(executor executors.Executor) hostKeyPinner {
+	if s, ok := executor.(*sshexec.SshExecutor); ok {
+		return s
+	}
+	return nil
+}
+
+// newRouteExecutor returns an executor sending the commands of the
+// nodes to the executors selected for them in the configuration, and
+// the commands of the other nodes to executor. The executors pinning
+// the host keys of the nodes are added to hostKeys by name.
+func newRouteExecutor(executor executors.Executor,
+	conf *GlusterFSConfig,
+	hostKeys map[string]hostKeyPinner) (*routeexec.RouteExecutor, error) {
+
+	named := map[string]executors.Executor{}
+	for name, c := range conf.Executors {
+		if name == "" || c == nil {
+			return nil, fmt.Errorf("Invalid executor %q", name)
+		}
+		e, err := newSelectedExecutor(c)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load executor %v: %v", name, err)
+		}
+		logger.Info("Loaded %v executor as %v", c.Executor, name)
+		named[name] = e
+		if pinner := hostKeyPinnerOf(e); pinner != nil {
+			hostKeys[name] = pinner
+		}
+	}
+
+	for id, name := range conf.ClusterExecutors {
+		if _, ok := named[name]; !ok {
+			return nil, fmt.Errorf("Unknown executor %v selected for cluster %v",
+				name, id)
+		}
+	}
+	for node, name := range conf.NodeExecutors {
+		if _, ok := named[name]; !ok {
+			return nil, fmt.Errorf("Unknown executor %v selected for node %v",
+				name, node)
+		}
+	}
+
+	return routeexec.NewRouteExecutor(executor, named), nil
+}
+
+// executorName returns the name of the executor selected for node, by
+// node id, then manage hostname, then cluster id. It is empty if the
+// node uses the default executor.
+func (a *App) executorName(node *NodeEntry) string {
+	if name, ok := a.conf.NodeExecutors[node.Info.Id]; ok {
+		return name
+	}
+	for _, host := range node.Info.Hostnames.Manage {
+		if name, ok := a.conf.NodeExecutors[host]; ok {
+			return name
+		}
+	}
+	return a.conf.ClusterExecutors[node.Info.ClusterId]
+}
+
+// routeNode sends the commands of node to the executor selected for
+// it. It does nothing if no executor is selected per cluster or node.
+func (a *App) routeNode(node *NodeEntry) {
+	if a.router == nil {
+		return
+	}
+	name := a.executorName(node)
+	for _, host := range node.Info.Hostnames.Manage {
+		if err := a.router.Route(host, name); err != nil {
+			logger.Err(err)
+		}
+	}
+}
+
+// unrouteNode sends the commands of the hosts of a deleted node back to
+// the default executor.
+func (a *App) unrouteNode(node *NodeEntry) {
+	if a.router == nil {
+		return
+	}
+	for _, host := range node.Info.Hostnames.Manage {
+		a.router.Route(host, "")
+	}
+}
+
+// routeNodes routes the nodes in the db to their executors.
+func (a *App) routeNodes() error {
+	if a.router == nil {
+		return nil
+	}
+	return a.db.View(func(tx wdb.Tx) error {
+		nodes, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			a.routeNode(node)
+		}
+		return nil
+	})
+}
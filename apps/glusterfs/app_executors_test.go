@@ -0,0 +1,223 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors/mockexec"
+	"github.com/chinacoolhacker/heketi/executors/sshexec"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+)
+
+func newRoutedTestApp(dbfile, selection string) *App {
+	data := []byte(`{
+		"glusterfs" : {
+			"executor" : "mock",
+			"db" : "` + dbfile + `",
+			"executors" : {
+				"kube" : { "executor" : "mock" },
+				"metal" : { "executor" : "mock" }
+			}` + selection + `
+		}
+	}`)
+	return NewApp(bytes.NewReader(data))
+}
+
+func TestAppExecutorSelection(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	app := newRoutedTestApp(dbfile, "")
+	tests.Assert(t, app != nil)
+	err := setupSampleDbWithTopology(app, 2, 2, 1, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusters []string
+	var nodes []*NodeEntry
+	err = app.db.View(func(tx wdb.Tx) error {
+		clusters, err = ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range clusters {
+			cluster, err := NewClusterEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			for _, nodeId := range cluster.Info.Nodes {
+				node, err := NewNodeEntryFromId(tx, nodeId)
+				if err != nil {
+					return err
+				}
+				nodes = append(nodes, node)
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	// the first cluster runs in kube, the second node of the second
+	// cluster is reached over ssh, the first one uses the default
+	app = newRoutedTestApp(dbfile, `,
+			"cluster_executors" : { "`+clusters[0]+`" : "kube" },
+			"node_executors" : { "`+nodes[3].ManageHostName()+`" : "metal" }`)
+	tests.Assert(t, app != nil)
+	defer app.Close()
+
+	checked := map[string]string{}
+	for _, name := range []string{"", "kube", "metal"} {
+		name := name
+		m := app.router.Executor(name).(*mockexec.MockExecutor)
+		m.MockGlusterdCheck = func(host string) error {
+			checked[host] = name
+			return nil
+		}
+	}
+	for _, node := range nodes {
+		err := app.executor.GlusterdCheck(node.ManageHostName())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	tests.Assert(t, checked[nodes[0].ManageHostName()] == "kube", checked)
+	tests.Assert(t, checked[nodes[1].ManageHostName()] == "kube", checked)
+	tests.Assert(t, checked[nodes[2].ManageHostName()] == "", checked)
+	tests.Assert(t, checked[nodes[3].ManageHostName()] == "metal", checked)
+
+	// the hosts of deleted nodes use the default executor
+	app.unrouteNode(nodes[0])
+	app.executor.GlusterdCheck(nodes[0].ManageHostName())
+	tests.Assert(t, checked[nodes[0].ManageHostName()] == "", checked)
+}
+
+func TestAppExecutorSelectionUnknown(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	app := newRoutedTestApp(dbfile, `,
+			"node_executors" : { "node1" : "nosuchexecutor" }`)
+	tests.Assert(t, app == nil)
+
+	app = newRoutedTestApp(dbfile, `,
+			"cluster_executors" : { "abc" : "nosuchexecutor" }`)
+	tests.Assert(t, app == nil)
+}
+
+func TestAppExecutorSelectionHostKeys(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+	os.Setenv("HEKETI_TEST_SSH_PASSWORD", "secret")
+	defer os.Unsetenv("HEKETI_TEST_SSH_PASSWORD")
+
+	// the ssh executors selected for some of the nodes pin the host
+	// keys of their nodes too, and all of them verify the pinned keys
+	data := []byte(`{
+		"glusterfs" : {
+			"executor" : "mock",
+			"db" : "` + dbfile + `",
+			"executors" : {
+				"metal" : {
+					"executor" : "ssh",
+					"sshexec" : {
+						"auth" : "password",
+						"password_env" : "HEKETI_TEST_SSH_PASSWORD",
+						"host_key_policy" : "tofu"
+					}
+				},
+				"plain" : {
+					"executor" : "ssh",
+					"sshexec" : {
+						"auth" : "password",
+						"password_env" : "HEKETI_TEST_SSH_PASSWORD"
+					}
+				}
+			},
+			"node_executors" : { "node1" : "metal", "node3" : "plain" }
+		}
+	}`)
+	app := NewApp(bytes.NewReader(data))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+	tests.Assert(t, len(app.hostKeys) == 2, app.hostKeys)
+	_, ok := app.hostKeys["metal"].(*sshexec.SshExecutor)
+	tests.Assert(t, ok, app.hostKeys)
+	_, ok = app.hostKeys["plain"].(*sshexec.SshExecutor)
+	tests.Assert(t, ok, app.hostKeys)
+
+	node := NewNodeEntry()
+	node.Info.Hostnames.Manage = []string{"node1"}
+	tests.Assert(t, app.nodeHostKeyPinner(node) == app.hostKeys["metal"])
+	node.Info.Hostnames.Manage = []string{"node2"}
+	tests.Assert(t, app.nodeHostKeyPinner(node) == nil)
+	node.Info.Hostnames.Manage = []string{"node3"}
+	tests.Assert(t, app.nodeHostKeyPinner(node) == nil)
+}
+
+func TestAppExecutorSelectionNodeAddFails(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	app := newRoutedTestApp(dbfile, `,
+			"node_executors" : { "manage0.hostname.com" : "metal" }`)
+	tests.Assert(t, app != nil)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	r, err := http.Post(ts.URL+"/clusters", "application/json",
+		bytes.NewBufferString(`{}`))
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, r.StatusCode == http.StatusCreated)
+	var cluster api.ClusterInfoResponse
+	err = utils.GetJsonFromResponse(r, &cluster)
+	tests.Assert(t, err == nil, err)
+
+	checked := map[string]string{}
+	for _, name := range []string{"", "metal"} {
+		name := name
+		m := app.router.Executor(name).(*mockexec.MockExecutor)
+		m.MockGlusterdCheck = func(host string) error {
+			checked[host] = name
+			return logger.LogError("Glusterd is down")
+		}
+	}
+
+	request := `{
+		"cluster" : "` + cluster.Id + `",
+		"hostnames" : {
+			"storage" : [ "storage0.hostname.com" ],
+			"manage" : [ "manage0.hostname.com" ]
+		},
+		"zone" : 1
+	}`
+	r, err = http.Post(ts.URL+"/nodes", "application/json",
+		bytes.NewBufferString(request))
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, r.StatusCode)
+	tests.Assert(t, checked["manage0.hostname.com"] == "metal", checked)
+
+	// the node that was not added is neither routed nor registered
+	app.executor.GlusterdCheck("manage0.hostname.com")
+	tests.Assert(t, checked["manage0.hostname.com"] == "", checked)
+	r, err = http.Post(ts.URL+"/nodes", "application/json",
+		bytes.NewBufferString(request))
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, r.StatusCode)
+}
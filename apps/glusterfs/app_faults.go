@@ -0,0 +1,148 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/faultexec"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/heketi/rest"
+)
+
+// The fault injection points of an operation are named after its type,
+// such as VolumeCreateOperation.Exec:start. Exec:start and Exec:done
+// are reached before and after its Exec step, Finalize:start and
+// Finalize:done before and after its Finalize step has been committed.
+
+// faultPoint applies the fault injection rules for point if executor
+// injects faults.
+func faultPoint(executor executors.Executor, point string) error {
+	if f, ok := executor.(*faultexec.FaultExecutor); ok {
+		return f.Point(point)
+	}
+	return nil
+}
+
+func operationName(o Operation) string {
+	t := reflect.TypeOf(o)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// execOperation performs the Exec step of o between its fault
+// injection points.
+func execOperation(ctx context.Context, o Operation,
+	executor executors.Executor) error {
+
+	name := operationName(o)
+	if err := faultPoint(executor, name+".Exec:start"); err != nil {
+		return err
+	}
+	if err := o.Exec(ctx, executor); err != nil {
+		return err
+	}
+	return faultPoint(executor, name+".Exec:done")
+}
+
+// finalizeOperation performs the Finalize step of o between its fault
+// injection points.
+func finalizeOperation(o Operation, executor executors.Executor) error {
+	name := operationName(o)
+	if err := faultPoint(executor, name+".Finalize:start"); err != nil {
+		return err
+	}
+	if err := o.Finalize(); err != nil {
+		return err
+	}
+	return faultPoint(executor, name+".Finalize:done")
+}
+
+// newFaultExecutor wraps executor with a fault injector using the
+// rules of the configuration. Fault injection is only available in
+// the builds made with the faultinject tag.
+func newFaultExecutor(executor executors.Executor,
+	rules []faultexec.FaultRule) (*faultexec.FaultExecutor, error) {
+
+	if !faultInjectionEnabled {
+		if len(rules) != 0 {
+			logger.Warning("Fault injection is not available in this " +
+				"build, ignoring the fault_injection rules")
+		}
+		return nil, nil
+	}
+	injector, err := faultexec.NewInjector(rules)
+	if err != nil {
+		return nil, err
+	}
+	logger.Warning("Fault injection enabled with %v rules", len(rules))
+	return faultexec.NewFaultExecutor(executor, injector), nil
+}
+
+func (a *App) faultRoutes() rest.Routes {
+	if a.faults == nil {
+		return nil
+	}
+	return rest.Routes{
+		rest.Route{
+			Name:        "FaultInjectionRules",
+			Method:      "GET",
+			Pattern:     "/admin/faults",
+			HandlerFunc: a.FaultInjectionRules},
+		rest.Route{
+			Name:        "FaultInjectionSetRules",
+			Method:      "PUT",
+			Pattern:     "/admin/faults",
+			HandlerFunc: a.FaultInjectionSetRules},
+		rest.Route{
+			Name:        "FaultInjectionClearRules",
+			Method:      "DELETE",
+			Pattern:     "/admin/faults",
+			HandlerFunc: a.FaultInjectionClearRules},
+	}
+}
+
+// FaultInjectionRules returns the fault injection rules in use.
+func (a *App) FaultInjectionRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(a.faults.Injector().Rules()); err != nil {
+		panic(err)
+	}
+}
+
+// FaultInjectionSetRules replaces the fault injection rules and resets
+// the count of the calls of each point.
+func (a *App) FaultInjectionSetRules(w http.ResponseWriter, r *http.Request) {
+	var rules []faultexec.FaultRule
+	if err := utils.GetJsonFromRequest(r, &rules); err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	if err := a.faults.Injector().SetRules(rules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Warning("Fault injection rules set to %+v", rules)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FaultInjectionClearRules removes all the fault injection rules.
+func (a *App) FaultInjectionClearRules(w http.ResponseWriter, r *http.Request) {
+	a.faults.Injector().SetRules(nil)
+	logger.Info("Fault injection rules cleared")
+	w.WriteHeader(http.StatusNoContent)
+}
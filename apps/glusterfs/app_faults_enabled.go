@@ -0,0 +1,16 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// +build faultinject
+
+package glusterfs
+
+// faultInjectionEnabled allows the configuration and the admin api to
+// inject faults. It must never be set in the builds that are shipped.
+const faultInjectionEnabled = true
@@ -0,0 +1,93 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors/faultexec"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+)
+
+func TestAppFaultInjection(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	data := []byte(`{
+		"glusterfs" : {
+			"executor" : "mock",
+			"db" : "` + dbfile + `",
+			"fault_injection" : [
+				{"point" : "GlusterdCheck", "error" : "injected fault"}
+			]
+		}
+	}`)
+	app := NewApp(bytes.NewReader(data))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// the rules are ignored by the builds without the faultinject tag
+	if !faultInjectionEnabled {
+		tests.Assert(t, app.faults == nil)
+		err := app.executor.GlusterdCheck("host1")
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r, err := http.Get(ts.URL + "/admin/faults")
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusNotFound, "got:", r.StatusCode)
+		return
+	}
+
+	err := app.executor.GlusterdCheck("host1")
+	tests.Assert(t, err != nil && err.Error() == "injected fault", "got:", err)
+
+	r, err := http.Get(ts.URL + "/admin/faults")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK, "got:", r.StatusCode)
+	var rules []faultexec.FaultRule
+	err = utils.GetJsonFromResponse(r, &rules)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(rules) == 1 && rules[0].Point == "GlusterdCheck", "got:", rules)
+
+	put := func(body string) int {
+		req, err := http.NewRequest("PUT", ts.URL+"/admin/faults",
+			bytes.NewBufferString(body))
+		tests.Assert(t, err == nil)
+		req.Header.Set("Content-Type", "application/json")
+		r, err := http.DefaultClient.Do(req)
+		tests.Assert(t, err == nil)
+		return r.StatusCode
+	}
+	status := put(`[{"point" : "PeerProbe", "nth" : 2, "error" : "probe failed"}]`)
+	tests.Assert(t, status == http.StatusNoContent, "got:", status)
+	tests.Assert(t, app.executor.GlusterdCheck("host1") == nil)
+	tests.Assert(t, app.executor.PeerProbe("host1", "host2") == nil)
+	tests.Assert(t, app.executor.PeerProbe("host1", "host2") != nil)
+
+	// rules without a fault are rejected
+	status = put(`[{"point" : "PeerProbe"}]`)
+	tests.Assert(t, status == http.StatusBadRequest, "got:", status)
+
+	req, err := http.NewRequest("DELETE", ts.URL+"/admin/faults", nil)
+	tests.Assert(t, err == nil)
+	r, err = http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNoContent, "got:", r.StatusCode)
+	tests.Assert(t, len(app.faults.Injector().Rules()) == 0)
+}
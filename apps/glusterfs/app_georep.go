@@ -13,7 +13,7 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/gorilla/mux"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/heketi/utils"
@@ -27,7 +27,7 @@ func (a *App) GeoReplicationStatus(w http.ResponseWriter, r *http.Request) {
 	var node *NodeEntry
 	var err error
 
-	err = a.db.View(func(tx *bolt.Tx) error {
+	err = a.db.View(func(tx wdb.Tx) error {
 		clusters, err := ClusterList(tx)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -83,6 +83,8 @@ func (a *App) GeoReplicationStatus(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := node.NewGeoReplicationStatusResponse(a.executor)
 	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		logger.LogError("Failed to get geo-replication status: %s", err.Error())
 		return
 	}
 
@@ -105,7 +107,7 @@ func (a *App) GeoReplicationVolumeStatus(w http.ResponseWriter, r *http.Request)
 	var host string
 	var err error
 
-	err = a.db.View(func(tx *bolt.Tx) error {
+	err = a.db.View(func(tx wdb.Tx) error {
 		volume, err = NewVolumeEntryFromId(tx, id)
 		if err == ErrNotFound {
 			http.Error(w, "Volume Id not found", http.StatusNotFound)
@@ -143,7 +145,7 @@ func (a *App) GeoReplicationVolumeStatus(w http.ResponseWriter, r *http.Request)
 
 	resp, err := volume.NewGeoReplicationStatusResponse(a.executor, host)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		logger.LogError("Failed to get geo-replication status: %s", err.Error())
 		return
 	}
@@ -189,7 +191,7 @@ func (a *App) GeoReplicationPostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = a.db.View(func(tx *bolt.Tx) error {
+	err = a.db.View(func(tx wdb.Tx) error {
 		volume, err = NewVolumeEntryFromId(tx, id)
 		fmt.Printf("VOLUME geo %v \n", volume)
 		fmt.Printf("VOLUME geo INFO %v \n", volume.Info)
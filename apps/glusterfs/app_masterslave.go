@@ -11,7 +11,7 @@ package glusterfs
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/gorilla/mux"
 	"github.com/heketi/utils"
@@ -31,7 +31,7 @@ func (a *App) MasterSlaveClustersStatus(w http.ResponseWriter, r *http.Request)
 
 	// Get info from db
 	var info *api.ClusterInfoResponse
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 
 		// Create a db entry from the id
 		entry, err := NewClusterEntryFromId(tx, id)
@@ -87,7 +87,18 @@ func (a *App) MasterSlaveClusterPostHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = a.db.Update(func(tx *bolt.Tx) error {
+	// The result of the sshd actions of each node is returned, also
+	// when one failed
+	var response api.ClusterSetMasterSlaveResponse
+	var sshdErr error
+	sshdSet := func(action, clusterid string) error {
+		results, err := a.MasterSlaveSshdSet(action, clusterid)
+		response.Sshd = append(response.Sshd, results...)
+		sshdErr = err
+		return err
+	}
+
+	err = a.db.Update(func(tx wdb.Tx) error {
 		if err == ErrNotFound {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return err
@@ -130,7 +141,7 @@ func (a *App) MasterSlaveClusterPostHandler(w http.ResponseWriter, r *http.Reque
 						actionParams["option"] = "push-pem"
 						actionParams["force"] = "true"
 
-						err = a.db.View(func(tx *bolt.Tx) error {
+						err = a.db.View(func(tx wdb.Tx) error {
 							node, err := NewNodeEntryFromId(tx, rementry.Info.Nodes[0])
 							if err == ErrNotFound {
 								logger.LogError("Node Id not found: %v", err)
@@ -174,13 +185,13 @@ func (a *App) MasterSlaveClusterPostHandler(w http.ResponseWriter, r *http.Reque
 			//enslaved
 
 			// stop sshd on current cluster
-			err = a.MasterSlaveSshdSet("stop", entry.Info.Id)
+			err = sshdSet("stop", entry.Info.Id)
 			if err != nil {
 				return err
 			}
 
 			// start sshd on cluster which will be a slave
-			err = a.MasterSlaveSshdSet("start", rementry.Info.Id)
+			err = sshdSet("start", rementry.Info.Id)
 			if err != nil {
 				return err
 			}
@@ -204,7 +215,7 @@ func (a *App) MasterSlaveClusterPostHandler(w http.ResponseWriter, r *http.Reque
 						actionParams["option"] = "push-pem"
 						actionParams["force"] = "true"
 
-						err = a.db.View(func(tx *bolt.Tx) error {
+						err = a.db.View(func(tx wdb.Tx) error {
 							node, err := NewNodeEntryFromId(tx, entry.Info.Nodes[0])
 							if err == ErrNotFound {
 								logger.LogError("Node Id not found: %v", err)
@@ -272,7 +283,7 @@ func (a *App) MasterSlaveClusterPostHandler(w http.ResponseWriter, r *http.Reque
 						actionParams["option"] = "push-pem"
 						actionParams["force"] = "true"
 
-						err = a.db.View(func(tx *bolt.Tx) error {
+						err = a.db.View(func(tx wdb.Tx) error {
 							node, err := NewNodeEntryFromId(tx, entry.Info.Nodes[0])
 							if err == ErrNotFound {
 								logger.LogError("Node Id not found: %v", err)
@@ -316,12 +327,12 @@ func (a *App) MasterSlaveClusterPostHandler(w http.ResponseWriter, r *http.Reque
 			//enslaved
 
 			// stop sshd on cluster which will be master - rem cluster
-			err = a.MasterSlaveSshdSet("stop", rementry.Info.Id)
+			err = sshdSet("stop", rementry.Info.Id)
 			if err != nil {
 				return err
 			}
 			// start sshd on current cluster which will be slave - this cluster
-			err = a.MasterSlaveSshdSet("start", entry.Info.Id)
+			err = sshdSet("start", entry.Info.Id)
 			if err != nil {
 				return err
 			}
@@ -347,7 +358,7 @@ func (a *App) MasterSlaveClusterPostHandler(w http.ResponseWriter, r *http.Reque
 						actionParams["option"] = "push-pem"
 						actionParams["force"] = "true"
 
-						err = a.db.View(func(tx *bolt.Tx) error {
+						err = a.db.View(func(tx wdb.Tx) error {
 							node, err := NewNodeEntryFromId(tx, rementry.Info.Nodes[0])
 							if err == ErrNotFound {
 								logger.LogError("Node Id not found: %v", err)
@@ -408,12 +419,21 @@ func (a *App) MasterSlaveClusterPostHandler(w http.ResponseWriter, r *http.Reque
 
 		return nil
 	})
-	if err != nil {
+	status := http.StatusOK
+	switch {
+	case sshdErr == ErrSshdSkipped:
+		status = http.StatusConflict
+	case sshdErr != nil:
+		status = http.StatusInternalServerError
+	case err != nil:
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
 }
 
 // status total iterated by vol
@@ -423,7 +443,7 @@ func (a *App) MasterSlaveStatus(w http.ResponseWriter, r *http.Request) {
 	var volumes []api.MasterSlaveVolpair
 
 	// Get all the cluster ids from the DB
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 		var err error
 
 		clusters, err = ClusterList(tx)
@@ -444,7 +464,7 @@ func (a *App) MasterSlaveStatus(w http.ResponseWriter, r *http.Request) {
 	for _, id := range clusters {
 		var info *api.ClusterInfoResponse
 
-		err := a.db.View(func(tx *bolt.Tx) error {
+		err := a.db.View(func(tx wdb.Tx) error {
 
 			entry, err := NewClusterEntryFromId(tx, id)
 
@@ -474,7 +494,7 @@ func (a *App) MasterSlaveStatus(w http.ResponseWriter, r *http.Request) {
 				for _, id := range info.Volumes {
 
 					var vol *api.VolumeInfoResponse
-					err := a.db.View(func(tx *bolt.Tx) error {
+					err := a.db.View(func(tx wdb.Tx) error {
 						entry, err := NewVolumeEntryFromId(tx, id)
 						if err == ErrNotFound || !entry.Visible() {
 							// treat an invisible entry like it doesn't exist
@@ -0,0 +1,46 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+)
+
+// Metrics is the handler of /metrics. It writes the counters of the
+// executors in the Prometheus text format.
+func (a *App) Metrics(w http.ResponseWriter, r *http.Request) {
+	stats := cmdexec.ThrottleStats()
+	hosts := make([]string, 0, len(stats))
+	for host := range stats {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintln(w, "# HELP heketi_executor_commands_total Commands sent to the node.")
+	fmt.Fprintln(w, "# TYPE heketi_executor_commands_total counter")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "heketi_executor_commands_total{host=%v} %v\n",
+			strconv.Quote(host), stats[host].Commands)
+	}
+	fmt.Fprintln(w, "# HELP heketi_executor_throttle_wait_seconds_total Time the commands waited for a connection to the node.")
+	fmt.Fprintln(w, "# TYPE heketi_executor_throttle_wait_seconds_total counter")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "heketi_executor_throttle_wait_seconds_total{host=%v} %v\n",
+			strconv.Quote(host), stats[host].Wait.Seconds())
+	}
+}
@@ -0,0 +1,57 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestAppMetrics(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	data := []byte(`{
+		"glusterfs" : {
+			"executor" : "local",
+			"db" : "` + dbfile + `"
+		}
+	}`)
+	app := NewApp(bytes.NewReader(data))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+
+	// the command is counted whether it succeeds or not
+	app.executor.GlusterdCheck("metrics-host")
+
+	ts := httptest.NewServer(http.HandlerFunc(app.Metrics))
+	defer ts.Close()
+
+	r, err := http.Get(ts.URL)
+	tests.Assert(t, err == nil, err)
+	defer r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusOK)
+	body, err := ioutil.ReadAll(r.Body)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, strings.Contains(string(body),
+		"# TYPE heketi_executor_commands_total counter\n"), string(body))
+	tests.Assert(t, strings.Contains(string(body),
+		`heketi_executor_commands_total{host="metrics-host"} 1`+"\n"), string(body))
+	tests.Assert(t, strings.Contains(string(body),
+		`heketi_executor_throttle_wait_seconds_total{host="metrics-host"} `),
+		string(body))
+}
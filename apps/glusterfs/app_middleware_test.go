@@ -12,7 +12,6 @@ package glusterfs
 import (
 	"bytes"
 	"compress/gzip"
-	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -40,14 +39,15 @@ func TestBackupToKubeSecretMaxSize(t *testing.T) {
 		5*TB, // disksize)
 	)
 	tests.Assert(t, err == nil)
-	app.Close()
+	defer app.Close()
 
-	// Gzip database
+	// Gzip database backup, as it would be stored in the secret
 	var b bytes.Buffer
 	gz := gzip.NewWriter(&b)
-	dbData, err := ioutil.ReadFile(tmpfile)
-	tests.Assert(t, err == nil)
-	_, err = gz.Write(dbData)
+	err = app.db.View(func(tx wdb.Tx) error {
+		_, err := tx.WriteTo(gz)
+		return err
+	})
 	tests.Assert(t, err == nil)
 	err = gz.Close()
 	tests.Assert(t, err == nil)
@@ -72,14 +72,15 @@ func TestBackupToKubeSecretMaxSizeFailure(t *testing.T) {
 		5*TB, // disksize)
 	)
 	tests.Assert(t, err == nil)
-	app.Close()
+	defer app.Close()
 
-	// Gzip database
+	// Gzip database backup, as it would be stored in the secret
 	var b bytes.Buffer
 	gz := gzip.NewWriter(&b)
-	dbData, err := ioutil.ReadFile(tmpfile)
-	tests.Assert(t, err == nil)
-	_, err = gz.Write(dbData)
+	err = app.db.View(func(tx wdb.Tx) error {
+		_, err := tx.WriteTo(gz)
+		return err
+	})
 	tests.Assert(t, err == nil)
 	err = gz.Close()
 	tests.Assert(t, err == nil)
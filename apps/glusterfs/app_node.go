@@ -10,10 +10,12 @@
 package glusterfs
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
-	"github.com/boltdb/bolt"
+	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/gorilla/mux"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
@@ -63,11 +65,16 @@ func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
 
 	// Create a node entry
 	node := NewNodeEntryFromRequest(&msg)
+	if err := a.pinNodeHostKey(node); err != nil {
+		logger.Err(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Get cluster and peer node hostname
 	var cluster *ClusterEntry
 	var peer_node_hostname string
-	err = a.db.Update(func(tx *bolt.Tx) error {
+	err = a.db.Update(func(tx wdb.Tx) error {
 		var err error
 		cluster, err = NewClusterEntryFromId(tx, msg.ClusterId)
 		if err == ErrNotFound {
@@ -90,11 +97,25 @@ func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Send the commands of the node to the executor selected for it.
+	// The node is routed before it is added since the commands adding
+	// it go to its executor, and it is unrouted and deregistered again
+	// if it is not added.
+	a.routeNode(node)
+	abort := func() {
+		a.unrouteNode(node)
+		a.db.Update(func(tx wdb.Tx) error {
+			node.Deregister(tx)
+			return nil
+		})
+	}
+
 	// Get a node's hostname in the cluster to execute the Gluster peer command
 	// only if there is more than one node
 	if len(cluster.Info.Nodes) > 0 {
 		peer_node_hostname, err = GetVerifiedManageHostname(a.db, a.executor, cluster.Info.Id)
 		if err != nil {
+			abort()
 			logger.Err(err)
 			err := logger.LogError("None of the nodes in cluster has glusterd running")
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -103,6 +124,7 @@ func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
 	} else {
 		err := a.executor.GlusterdCheck(node.ManageHostName())
 		if err != nil {
+			abort()
 			logger.Err(err)
 			err := logger.LogError("New Node doesn't have glusterd running")
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -112,15 +134,12 @@ func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
 
 	// Add node
 	logger.Info("Adding node %v", node.ManageHostName())
-	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (seeother string, e error) {
+	err = a.asyncManager.start(w, r, false, func(ctx context.Context) (seeother string, e error) {
 
 		// Cleanup in case of failure
 		defer func() {
 			if e != nil {
-				a.db.Update(func(tx *bolt.Tx) error {
-					node.Deregister(tx)
-					return nil
-				})
+				abort()
 			}
 		}()
 
@@ -135,7 +154,7 @@ func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Add node entry into the db
-		err = a.db.Update(func(tx *bolt.Tx) error {
+		err := a.db.Update(func(tx wdb.Tx) error {
 			cluster, err := NewClusterEntryFromId(tx, msg.ClusterId)
 			if err == ErrNotFound {
 				http.Error(w, "Cluster id does not exist", http.StatusNotFound)
@@ -171,6 +190,10 @@ func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
 		logger.Info("Added node " + node.Info.Id)
 		return "/nodes/" + node.Info.Id, nil
 	})
+	if err != nil {
+		abort()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
 
 func (a *App) NodeInfo(w http.ResponseWriter, r *http.Request) {
@@ -181,7 +204,7 @@ func (a *App) NodeInfo(w http.ResponseWriter, r *http.Request) {
 
 	// Get Node information
 	var info *api.NodeInfoResponse
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 		entry, err := NewNodeEntryFromId(tx, id)
 		if err == ErrNotFound {
 			http.Error(w, "Id not found", http.StatusNotFound)
@@ -222,7 +245,7 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 		peer_node, node *NodeEntry
 		cluster         *ClusterEntry
 	)
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 
 		// Access node entry
 		var err error
@@ -288,7 +311,7 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Remove from db
-		err = a.db.Update(func(tx *bolt.Tx) error {
+		err = a.db.Update(func(tx wdb.Tx) error {
 
 			// Get Cluster
 			cluster, err := NewClusterEntryFromId(tx, node.Info.ClusterId)
@@ -326,6 +349,7 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return "", err
 		}
+		a.unrouteNode(node)
 		// Show that the key has been deleted
 		logger.Info("Deleted node [%s]", id)
 
@@ -355,7 +379,7 @@ func (a *App) NodeSetState(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check state is supported
-	err = a.db.View(func(tx *bolt.Tx) error {
+	err = a.db.View(func(tx wdb.Tx) error {
 		node, err = NewNodeEntryFromId(tx, id)
 		if err == ErrNotFound {
 			http.Error(w, "Id not found", http.StatusNotFound)
@@ -371,14 +395,23 @@ func (a *App) NodeSetState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if dryRunRequested(r) {
+		a.dryRunHttp(w, func(db wdb.DB, executor executors.Executor) error {
+			return node.SetState(db, executor, a.Allocator(), msg.State)
+		})
+		return
+	}
+
 	// Set state
-	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
-		err = node.SetState(a.db, a.executor, a.Allocator(), msg.State)
+	err = AsyncHttpScheduledFunc(a, w, r, node.Info.ClusterId, func() (string, error) {
+		err := node.SetState(a.db, a.executor, a.Allocator(), msg.State)
 		if err != nil {
 			return "", err
 		}
 		return "", nil
 
 	})
-
+	if err != nil {
+		OperationHttpError(w, err.Error(), err)
+	}
 }
@@ -0,0 +1,219 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/chinacoolhacker/heketi/pkg/utils/ssh"
+	"github.com/gorilla/mux"
+)
+
+// hostKeyPinner is an executor verifying the ssh host keys of the
+// nodes against the keys pinned for them. Executors that do not
+// verify the keys of the other nodes still verify the pinned keys,
+// but do not pin any.
+type hostKeyPinner interface {
+	SetHostKeyStore(store ssh.HostKeyStore)
+	VerifiesHostKeys() bool
+	HostKeyFingerprint(host string) (string, error)
+}
+
+// nodeHostKeys keeps the host keys pinned for the nodes in their
+// entries. The hosts are the manage hostnames of the nodes.
+type nodeHostKeys struct {
+	db wdb.DB
+}
+
+func (n *nodeHostKeys) PinnedHostKey(host string) (string, error) {
+	var fingerprint string
+	err := n.db.View(func(tx wdb.Tx) error {
+		node, err := nodeEntryFromManageHostname(tx, host)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fingerprint = node.HostKey
+		return nil
+	})
+	return fingerprint, err
+}
+
+// PinHostKey pins the key of a node with none pinned yet. Keys of hosts
+// that are not nodes, such as nodes being added, are not pinned.
+func (n *nodeHostKeys) PinHostKey(host, fingerprint string) error {
+	return n.db.Update(func(tx wdb.Tx) error {
+		node, err := nodeEntryFromManageHostname(tx, host)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if node.HostKey != "" {
+			return nil
+		}
+		logger.Info("Pinned host key %v of node %v", fingerprint, node.Info.Id)
+		node.HostKey = fingerprint
+		return node.Save(tx)
+	})
+}
+
+// nodeEntryFromManageHostname returns the node host is the manage
+// hostname of.
+func nodeEntryFromManageHostname(tx wdb.Tx, host string) (*NodeEntry, error) {
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_NODE))
+	if b == nil {
+		return nil, ErrDbAccess
+	}
+	id := b.Get([]byte(NewNodeEntry().registerManageKey(host)))
+	if id == nil {
+		return nil, ErrNotFound
+	}
+	return NewNodeEntryFromId(tx, string(id))
+}
+
+// nodeHostKeyPinner returns the executor pinning the host key of node,
+// nil if the executor of node does not verify the host keys.
+func (a *App) nodeHostKeyPinner(node *NodeEntry) hostKeyPinner {
+	var pinner hostKeyPinner
+	if a.router == nil {
+		pinner = a.hostKeys[""]
+	} else {
+		pinner = a.hostKeys[a.executorName(node)]
+	}
+	if pinner == nil || !pinner.VerifiesHostKeys() {
+		return nil
+	}
+	return pinner
+}
+
+// pinNodeHostKey pins the host key a node being added presents.
+func (a *App) pinNodeHostKey(node *NodeEntry) error {
+	pinner := a.nodeHostKeyPinner(node)
+	if pinner == nil {
+		return nil
+	}
+	fingerprint, err := pinner.HostKeyFingerprint(node.ManageHostName())
+	if err != nil {
+		return fmt.Errorf("Unable to get the host key of %v: %v",
+			node.ManageHostName(), err)
+	}
+	node.HostKey = fingerprint
+	return nil
+}
+
+func (a *App) NodeHostKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var resp api.NodeHostKeyResponse
+	err := a.db.View(func(tx wdb.Tx) error {
+		node, err := NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		resp.Fingerprint = node.HostKey
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+// NodeHostKeyPin pins a new host key for a node, after the node was
+// reinstalled for example.
+func (a *App) NodeHostKeyPin(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.NodeHostKeyRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		logger.LogError("validation failed: " + err.Error())
+		return
+	}
+
+	var node *NodeEntry
+	err = a.db.View(func(tx wdb.Tx) error {
+		node, err = NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	pinner := a.nodeHostKeyPinner(node)
+	if pinner == nil {
+		http.Error(w, "The host keys of the nodes are not verified",
+			http.StatusBadRequest)
+		return
+	}
+
+	fingerprint := msg.Fingerprint
+	if fingerprint == "" {
+		fingerprint, err = pinner.HostKeyFingerprint(node.ManageHostName())
+		if err != nil {
+			err = logger.LogError("Unable to get the host key of %v: %v",
+				node.ManageHostName(), err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = a.db.Update(func(tx wdb.Tx) error {
+		node, err := NewNodeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		node.HostKey = fingerprint
+		return node.Save(tx)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Pinned host key %v of node %v", fingerprint, id)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	resp := api.NodeHostKeyResponse{Fingerprint: fingerprint}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,248 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/chinacoolhacker/heketi/pkg/utils/ssh"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+)
+
+const (
+	testFingerprint1 = "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"
+	testFingerprint2 = "SHA256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU"
+)
+
+type fakeHostKeyPinner struct {
+	store    ssh.HostKeyStore
+	keys     map[string]string
+	insecure bool
+}
+
+func (f *fakeHostKeyPinner) SetHostKeyStore(store ssh.HostKeyStore) {
+	f.store = store
+}
+
+func (f *fakeHostKeyPinner) VerifiesHostKeys() bool {
+	return !f.insecure
+}
+
+func (f *fakeHostKeyPinner) HostKeyFingerprint(host string) (string, error) {
+	if fp, ok := f.keys[host]; ok {
+		return fp, nil
+	}
+	return "", errors.New("connection refused")
+}
+
+func hostKeyTestNode(t *testing.T, ts *httptest.Server,
+	clusterId, host string) (*http.Response, *api.NodeInfoResponse) {
+
+	request := []byte(`{
+		"cluster" : "` + clusterId + `",
+		"hostnames" : {
+			"storage" : [ "` + host + `" ],
+			"manage" : [ "` + host + `" ]
+		},
+		"zone" : 1
+	}`)
+	r, err := http.Post(ts.URL+"/nodes", "application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	if r.StatusCode != http.StatusAccepted {
+		return r, nil
+	}
+	location, err := r.Location()
+	tests.Assert(t, err == nil)
+
+	var node api.NodeInfoResponse
+	for {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusOK)
+		if r.ContentLength <= 0 {
+			time.Sleep(time.Millisecond * 10)
+			continue
+		}
+		err = utils.GetJsonFromResponse(r, &node)
+		tests.Assert(t, err == nil)
+		break
+	}
+	return r, &node
+}
+
+func TestNodeAddPinsHostKey(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	pinner := &fakeHostKeyPinner{
+		keys: map[string]string{"host1": testFingerprint1},
+	}
+	app.hostKeys = map[string]hostKeyPinner{"": pinner}
+
+	r, err := http.Post(ts.URL+"/clusters", "application/json",
+		bytes.NewBufferString(`{}`))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusCreated)
+	var cluster api.ClusterInfoResponse
+	err = utils.GetJsonFromResponse(r, &cluster)
+	tests.Assert(t, err == nil)
+
+	_, node := hostKeyTestNode(t, ts, cluster.Id, "host1")
+	tests.Assert(t, node != nil)
+	err = app.db.View(func(tx wdb.Tx) error {
+		entry, err := NewNodeEntryFromId(tx, node.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.HostKey == testFingerprint1, "got:", entry.HostKey)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// nodes whose host key can not be read are not added
+	r, node = hostKeyTestNode(t, ts, cluster.Id, "host2")
+	tests.Assert(t, node == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, "got:", r.StatusCode)
+	err = app.db.View(func(tx wdb.Tx) error {
+		_, err := nodeEntryFromManageHostname(tx, "host2")
+		tests.Assert(t, err == ErrNotFound, "got:", err)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestNodeHostKeyPin(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 1, 1, 500*GB)
+	tests.Assert(t, err == nil)
+	var node *NodeEntry
+	err = app.db.View(func(tx wdb.Tx) error {
+		ids, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		node, err = NewNodeEntryFromId(tx, ids[0])
+		return err
+	})
+	tests.Assert(t, err == nil)
+
+	hostKey := func() string {
+		r, err := http.Get(ts.URL + "/nodes/" + node.Info.Id + "/hostkey")
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusOK, "got:", r.StatusCode)
+		var resp api.NodeHostKeyResponse
+		err = utils.GetJsonFromResponse(r, &resp)
+		tests.Assert(t, err == nil)
+		return resp.Fingerprint
+	}
+	pin := func(body string) int {
+		r, err := http.Post(ts.URL+"/nodes/"+node.Info.Id+"/hostkey",
+			"application/json", bytes.NewBufferString(body))
+		tests.Assert(t, err == nil)
+		return r.StatusCode
+	}
+	tests.Assert(t, hostKey() == "")
+
+	// the host keys are not verified
+	status := pin(`{"fingerprint" : "` + testFingerprint1 + `"}`)
+	tests.Assert(t, status == http.StatusBadRequest, "got:", status)
+	app.hostKeys[""] = &fakeHostKeyPinner{insecure: true}
+	status = pin(`{"fingerprint" : "` + testFingerprint1 + `"}`)
+	tests.Assert(t, status == http.StatusBadRequest, "got:", status)
+
+	app.hostKeys[""] = &fakeHostKeyPinner{
+		keys: map[string]string{node.ManageHostName(): testFingerprint2},
+	}
+	status = pin(`{"fingerprint" : "` + testFingerprint1 + `"}`)
+	tests.Assert(t, status == http.StatusOK, "got:", status)
+	tests.Assert(t, hostKey() == testFingerprint1)
+
+	// the key the node presents is pinned by default
+	status = pin(`{}`)
+	tests.Assert(t, status == http.StatusOK, "got:", status)
+	tests.Assert(t, hostKey() == testFingerprint2)
+
+	status = pin(`{"fingerprint" : "aa:bb:cc"}`)
+	tests.Assert(t, status == http.StatusBadRequest, "got:", status)
+	tests.Assert(t, hostKey() == testFingerprint2)
+
+	r, err := http.Post(ts.URL+"/nodes/"+utils.GenUUID()+"/hostkey",
+		"application/json", bytes.NewBufferString(`{}`))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound, "got:", r.StatusCode)
+}
+
+func TestNodeHostKeysStore(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 1, 1, 500*GB)
+	tests.Assert(t, err == nil)
+	var host string
+	err = app.db.Update(func(tx wdb.Tx) error {
+		ids, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		node, err := NewNodeEntryFromId(tx, ids[0])
+		if err != nil {
+			return err
+		}
+		host = node.ManageHostName()
+		// the sample nodes are not registered
+		return node.Register(tx)
+	})
+	tests.Assert(t, err == nil)
+
+	store := &nodeHostKeys{db: app.db}
+	fp, err := store.PinnedHostKey(host)
+	tests.Assert(t, err == nil && fp == "", "got:", fp, err)
+
+	// the first key is pinned
+	err = store.PinHostKey(host, testFingerprint1)
+	tests.Assert(t, err == nil)
+	err = store.PinHostKey(host, testFingerprint2)
+	tests.Assert(t, err == nil)
+	fp, err = store.PinnedHostKey(host)
+	tests.Assert(t, err == nil && fp == testFingerprint1, "got:", fp, err)
+
+	// hosts which are not nodes have no key
+	err = store.PinHostKey("unknown", testFingerprint1)
+	tests.Assert(t, err == nil)
+	fp, err = store.PinnedHostKey("unknown")
+	tests.Assert(t, err == nil && fp == "", "got:", fp, err)
+}
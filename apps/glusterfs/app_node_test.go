@@ -20,9 +20,9 @@ import (
 	"testing"
 	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
 	client "github.com/chinacoolhacker/heketi/client/api/go-client"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/heketi/tests"
@@ -460,7 +460,7 @@ func TestNodeAddDelete(t *testing.T) {
 	tests.Assert(t, len(node.DevicesInfo) == 0)
 
 	// Check that the node has registered
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		b := tx.Bucket([]byte(BOLTDB_BUCKET_NODE))
 		tests.Assert(t, b != nil)
 
@@ -493,7 +493,7 @@ func TestNodeAddDelete(t *testing.T) {
 
 	// Check the data is in the database correctly
 	var entry *NodeEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		entry, err = NewNodeEntryFromId(tx, node.Id)
 		return err
 	})
@@ -507,7 +507,7 @@ func TestNodeAddDelete(t *testing.T) {
 	tests.Assert(t, len(entry.Devices) == 0)
 
 	// Add some devices to check if delete conflict works
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		entry, err = NewNodeEntryFromId(tx, node.Id)
 		if err != nil {
 			return err
@@ -529,7 +529,7 @@ func TestNodeAddDelete(t *testing.T) {
 
 	// Check that nothing has changed in the db
 	var cluster *ClusterEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		entry, err = NewNodeEntryFromId(tx, node.Id)
 		if err != nil {
 			return err
@@ -546,7 +546,7 @@ func TestNodeAddDelete(t *testing.T) {
 	tests.Assert(t, utils.SortedStringHas(cluster.Info.Nodes, node.Id))
 
 	// Node delete the drives
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		entry, err = NewNodeEntryFromId(tx, node.Id)
 		if err != nil {
 			return err
@@ -582,7 +582,7 @@ func TestNodeAddDelete(t *testing.T) {
 	}
 
 	// Check db to make sure key is removed
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		_, err = NewNodeEntryFromId(tx, node.Id)
 		return err
 	})
@@ -667,7 +667,7 @@ func TestNodeInfo(t *testing.T) {
 	node.Info.Zone = 10
 
 	// Save node in the db
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return node.Save(tx)
 	})
 	tests.Assert(t, err == nil)
@@ -712,7 +712,7 @@ func TestNodeDeleteErrors(t *testing.T) {
 	node.Info.Zone = 10
 
 	// Save node in the db
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return node.Save(tx)
 	})
 	tests.Assert(t, err == nil)
@@ -761,7 +761,7 @@ func TestNodePeerProbeFailure(t *testing.T) {
 
 	// Get cluter id
 	var clusterlist []string
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		clusterlist, err = ClusterList(tx)
 		return err
@@ -810,7 +810,7 @@ func TestNodePeerProbeFailure(t *testing.T) {
 	// Check that the node has not been added to the db
 	var nodelist []string
 	var cluster *ClusterEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		cluster, err = NewClusterEntryFromId(tx, clusterid)
 		if err != nil {
@@ -872,7 +872,7 @@ func TestNodePeerDetachFailure(t *testing.T) {
 
 	// Get a node id
 	var nodeid string
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		clusterlist, err := ClusterList(tx)
 		if err != nil {
 			return err
@@ -919,7 +919,7 @@ func TestNodePeerDetachFailure(t *testing.T) {
 	}
 
 	// Check that the node is still in the db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		clusters, err := ClusterList(tx)
 		if err != nil {
 			return err
@@ -970,7 +970,7 @@ func TestNodePeerDetach(t *testing.T) {
 
 	// get list of nodes
 	var nodes []string
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		clusters, err := ClusterList(tx)
 		if err != nil {
 			return err
@@ -1396,7 +1396,7 @@ func TestNodeInfoAfterDelete(t *testing.T) {
 	}
 
 	// Check db to make sure key is removed
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		_, err = NewNodeEntryFromId(tx, nodeid)
 		return err
 	})
@@ -0,0 +1,64 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"net/http"
+
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
+)
+
+// PendingOperationList lists the operations that have not completed,
+// telling apart the ones still waiting in the scheduler queue.
+func (a *App) PendingOperationList(w http.ResponseWriter, r *http.Request) {
+
+	list := api.PendingOperationListResponse{
+		PendingOperations: []api.PendingOperationInfo{},
+	}
+	queued := a.scheduler.Queued()
+
+	err := a.db.View(func(tx wdb.Tx) error {
+		ids, err := PendingOperationList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			op, err := NewPendingOperationEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			info := api.PendingOperationInfo{
+				Id:        op.Id,
+				TypeName:  op.Type.Name(),
+				Timestamp: op.Timestamp,
+				Status:    "running",
+			}
+			if position, ok := queued[op.Id]; ok {
+				info.Status = "queued"
+				info.Position = position
+			}
+			list.PendingOperations = append(list.PendingOperations, info)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		panic(err)
+	}
+}
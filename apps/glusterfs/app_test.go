@@ -11,14 +11,21 @@ package glusterfs
 
 import (
 	"bytes"
+	"fmt"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
 
-	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
 	client "github.com/chinacoolhacker/heketi/client/api/go-client"
+	"github.com/chinacoolhacker/heketi/executors/agentexec"
+	"github.com/chinacoolhacker/heketi/executors/gd2exec"
+	"github.com/chinacoolhacker/heketi/executors/localexec"
+	"github.com/chinacoolhacker/heketi/executors/retryexec"
+	"github.com/chinacoolhacker/heketi/pkg/agent/agenttest"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/heketi/tests"
 )
@@ -101,6 +108,254 @@ func TestAppAdvsettings(t *testing.T) {
 	tests.Assert(t, BrickMinSize == 4*GB)
 }
 
+func TestAppExecutorRecordReplay(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+	recordfile := tests.Tempfile()
+	defer os.Remove(recordfile)
+
+	data := []byte(`{
+		"glusterfs" : {
+			"executor" : "mock",
+			"db" : "` + dbfile + `",
+			"executor_record_file" : "` + recordfile + `"
+		}
+	}`)
+	app := NewApp(bytes.NewReader(data))
+	tests.Assert(t, app != nil)
+	err := app.executor.GlusterdCheck("host1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	// the recording is served by the replay executor
+	data = []byte(`{
+		"glusterfs" : {
+			"executor" : "replay",
+			"db" : "` + dbfile + `",
+			"executor_replay_file" : "` + recordfile + `"
+		}
+	}`)
+	app = NewApp(bytes.NewReader(data))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+	err = app.executor.GlusterdCheck("host1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = app.executor.GlusterdCheck("host2")
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// a replay file is required
+	data = []byte(`{
+		"glusterfs" : {
+			"executor" : "replay",
+			"db" : "` + dbfile + `"
+		}
+	}`)
+	tests.Assert(t, NewApp(bytes.NewReader(data)) == nil)
+}
+
+func TestAppLocalExecutor(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	data := []byte(`{
+		"glusterfs" : {
+			"executor" : "local",
+			"db" : "` + dbfile + `",
+			"localexec" : {
+				"namespaces" : {
+					"node1" : "ns1"
+				}
+			}
+		}
+	}`)
+	app := NewApp(bytes.NewReader(data))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+	_, ok := app.executor.(*localexec.LocalExecutor)
+	tests.Assert(t, ok, "got:", app.executor)
+}
+
+func TestAppExecutorRetry(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	// the deprecated retries of the executor are used alone
+	data := []byte(`{
+		"glusterfs" : {
+			"executor" : "local",
+			"db" : "` + dbfile + `",
+			"localexec" : {
+				"retries" : 2
+			}
+		}
+	}`)
+	app := NewApp(bytes.NewReader(data))
+	tests.Assert(t, app != nil)
+	_, ok := app.executor.(*retryexec.RetryExecutor)
+	tests.Assert(t, ok, "got:", app.executor)
+	tests.Assert(t, app.retryConfig().Attempts == 3,
+		"got:", app.retryConfig())
+	app.Close()
+
+	// executor_retry wins
+	data = []byte(`{
+		"glusterfs" : {
+			"executor" : "local",
+			"db" : "` + dbfile + `",
+			"executor_retry" : {
+				"attempts" : 5
+			},
+			"localexec" : {
+				"retries" : 2
+			}
+		}
+	}`)
+	app = NewApp(bytes.NewReader(data))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+	tests.Assert(t, app.retryConfig().Attempts == 5,
+		"got:", app.retryConfig())
+}
+
+func TestAppGd2Executor(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	data := []byte(`{
+		"glusterfs" : {
+			"executor" : "glusterd2",
+			"db" : "` + dbfile + `",
+			"gd2exec" : {
+				"port" : "24017"
+			}
+		}
+	}`)
+	app := NewApp(bytes.NewReader(data))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+	_, ok := app.executor.(*gd2exec.Gd2Executor)
+	tests.Assert(t, ok, "got:", app.executor)
+	tests.Assert(t, app.conf.Gd2Config.Port == "24017")
+	tests.Assert(t, app.conf.Gd2Config.AgentPort == "24010")
+
+	// the secret must be readable
+	data = []byte(`{
+		"glusterfs" : {
+			"executor" : "gd2",
+			"db" : "` + dbfile + `",
+			"gd2exec" : {
+				"secret_file" : "/no/such/file"
+			}
+		}
+	}`)
+	app = NewApp(bytes.NewReader(data))
+	tests.Assert(t, app == nil)
+}
+
+func TestAppAgentExecutor(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+	a := agenttest.NewAgentTestServer(nil)
+	defer a.Close()
+
+	data := []byte(`{
+		"glusterfs" : {
+			"executor" : "agent",
+			"db" : "` + dbfile + `",
+			"agentexec" : {
+				"certfile" : "` + a.ClientFiles.CertFile + `",
+				"keyfile" : "` + a.ClientFiles.KeyFile + `",
+				"cacert" : "` + a.ClientFiles.CACertFile + `"
+			}
+		}
+	}`)
+	app := NewApp(bytes.NewReader(data))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+	_, ok := app.executor.(*agentexec.AgentExecutor)
+	tests.Assert(t, ok, "got:", app.executor)
+	tests.Assert(t, app.conf.AgentConfig.Port == "24011")
+
+	// the agents are only reached over mTLS
+	data = []byte(`{
+		"glusterfs" : {
+			"executor" : "agent",
+			"db" : "` + dbfile + `"
+		}
+	}`)
+	app = NewApp(bytes.NewReader(data))
+	tests.Assert(t, app == nil)
+}
+
+func TestAppSimExecutor(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	data := []byte(`{
+		"glusterfs" : {
+			"executor" : "sim",
+			"db" : "` + dbfile + `",
+			"simexec" : {
+				"device_size_gb" : 10,
+				"aliases" : {
+					"10.0.0.1" : "manage1",
+					"10.0.0.2" : "manage2",
+					"10.0.0.3" : "manage3"
+				}
+			}
+		}
+	}`)
+	app := NewApp(bytes.NewReader(data))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	c := client.NewClientNoAuth(ts.URL)
+
+	cluster, err := c.ClusterCreate(&api.ClusterCreateRequest{
+		ClusterFlags: api.ClusterFlags{File: true},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for i := 1; i <= 3; i++ {
+		req := &api.NodeAddRequest{
+			Zone:      i,
+			ClusterId: cluster.Id,
+		}
+		req.Hostnames.Manage = []string{fmt.Sprintf("manage%v", i)}
+		req.Hostnames.Storage = []string{fmt.Sprintf("10.0.0.%v", i)}
+		node, err := c.NodeAdd(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		err = c.DeviceAdd(&api.DeviceAddRequest{
+			Device: api.Device{Name: "/dev/sdb"},
+			NodeId: node.Id,
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	// the simulated nodes are 10GB each
+	volreq := &api.VolumeCreateRequest{}
+	volreq.Size = 20
+	volreq.Durability.Type = api.DurabilityReplicate
+	volreq.Durability.Replicate.Replica = 3
+	_, err = c.VolumeCreate(volreq)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	volreq.Size = 5
+	vol, err := c.VolumeCreate(volreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = c.VolumeDelete(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the space of the volume is back
+	volreq.Size = 9
+	vol, err = c.VolumeCreate(volreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = c.VolumeDelete(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
 func TestAppLogLevel(t *testing.T) {
 	dbfile := tests.Tempfile()
 	defer os.Remove(dbfile)
@@ -181,9 +436,7 @@ func TestAppReadOnlyDb(t *testing.T) {
 
 	// Now open it again here.  This will force NewApp()
 	// to be unable to open RW.
-	db, err := bolt.Open(dbfile, 0666, &bolt.Options{
-		ReadOnly: true,
-	})
+	db, err := wdb.Open("", dbfile, true)
 	tests.Assert(t, err == nil, err)
 	tests.Assert(t, db != nil)
 
@@ -262,7 +515,7 @@ func TestCannotStartWhenPendingOperations(t *testing.T) {
 
 	// populate the db with a "dummy" pending op entry. this should
 	// trigger a panic the next time an app is instantiated
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		op := NewPendingOperationEntry(NEW_ID)
 		op.Save(tx)
 		return nil
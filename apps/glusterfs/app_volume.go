@@ -16,8 +16,8 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/boltdb/bolt"
-	"github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/gorilla/mux"
@@ -105,7 +105,7 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check that the clusters requested are available
-	err = a.db.View(func(tx *bolt.Tx) error {
+	err = a.db.View(func(tx wdb.Tx) error {
 
 		// :TODO: All we need to do is check for one instead of gathering all keys
 		clusters, err := ClusterList(tx)
@@ -171,11 +171,23 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if dryRunRequested(r) {
+		a.dryRunHttp(w, func(db wdb.DB, executor executors.Executor) error {
+			err := RunOperation(NewVolumeCreateOperation(vol, db),
+				a.Allocator(), executor)
+			if err != nil || len(MasterCluster) == 0 {
+				return err
+			}
+			return RunOperation(NewVolumeCreateOperation(remvol, db),
+				a.Allocator(), executor)
+		})
+		return
+	}
+
 	vc := NewVolumeCreateOperation(vol, a.db)
 	if err := AsyncHttpOperation(a, w, r, vc); err != nil {
-		http.Error(w,
-			fmt.Sprintf("Failed to allocate new volume: %v", err),
-			http.StatusInternalServerError)
+		OperationHttpError(w,
+			fmt.Sprintf("Failed to allocate new volume: %v", err), err)
 		return
 	}
 
@@ -197,9 +209,8 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 		remvc := NewVolumeCreateOperation(remvol, a.db)
 
 		if err := AsyncHttpOperation(a, w, r, remvc); err != nil {
-			http.Error(w,
-				fmt.Sprintf("Failed to allocate new replicated volume: %v", err),
-				http.StatusInternalServerError)
+			OperationHttpError(w,
+				fmt.Sprintf("Failed to allocate new replicated volume: %v", err), err)
 			return
 		}
 
@@ -211,7 +222,7 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 			time.Sleep(60 * time.Second)
 
 			// start sshd on master to init georep session
-			sshonerr := a.MasterSlaveSshdSet("start", masterSshCluster)
+			_, sshonerr := a.MasterSlaveSshdSet("start", masterSshCluster)
 			if sshonerr != nil {
 				logger.LogError("Error during stop ssh : %v \n", sshonerr)
 			}
@@ -236,7 +247,7 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 			var masterVolume *VolumeEntry
 			var host string
 
-			err = a.db.View(func(tx *bolt.Tx) error {
+			err = a.db.View(func(tx wdb.Tx) error {
 				masterVolume, err = NewVolumeEntryFromId(tx, id)
 				logger.Debug("For volume geo %v with id %v geo \n", masterVolume, masterVolume.Info.Id)
 
@@ -305,7 +316,7 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 			var masterVolume *VolumeEntry
 			var host string
 
-			err = a.db.View(func(tx *bolt.Tx) error {
+			err = a.db.View(func(tx wdb.Tx) error {
 				masterVolume, err = NewVolumeEntryFromId(tx, id)
 				logger.Debug("For volume geo %v with id %v geo \n", masterVolume, masterVolume.Info.Id)
 
@@ -374,7 +385,7 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 			// 2do : check if vol created
 			time.Sleep(30 * time.Second)
 			// disable sshd on master
-			sshofferr := a.MasterSlaveSshdSet("stop", masterSshCluster)
+			_, sshofferr := a.MasterSlaveSshdSet("stop", masterSshCluster)
 			if sshofferr != nil {
 				logger.LogError("Error during stop ssh : %v \n", sshofferr)
 			}
@@ -392,7 +403,7 @@ func (a *App) VolumeList(w http.ResponseWriter, r *http.Request) {
 	var list api.VolumeListResponse
 
 	// Get all the cluster ids from the DB
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 		var err error
 
 		list.Volumes, err = ListCompleteVolumes(tx)
@@ -421,7 +432,7 @@ func (a *App) VolumeInfo(w http.ResponseWriter, r *http.Request) {
 	id := vars["id"]
 
 	var info *api.VolumeInfoResponse
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 		entry, err := NewVolumeEntryFromId(tx, id)
 		if err == ErrNotFound || !entry.Visible() {
 			// treat an invisible entry like it doesn't exist
@@ -461,7 +472,7 @@ func (a *App) VolumeDelete(w http.ResponseWriter, r *http.Request) {
 	MasterCluster, _ = a.MasterSlaveClustersCheck()
 
 	var volume *VolumeEntry
-	err := a.db.View(func(tx *bolt.Tx) error {
+	err := a.db.View(func(tx wdb.Tx) error {
 
 		var err error
 		volume, err = NewVolumeEntryFromId(tx, id)
@@ -479,7 +490,7 @@ func (a *App) VolumeDelete(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
-		if volume.Info.Name == db.HeketiStorageVolumeName {
+		if volume.Info.Name == wdb.HeketiStorageVolumeName {
 			err := fmt.Errorf("Cannot delete volume containing the Heketi database")
 			http.Error(w, err.Error(), http.StatusConflict)
 			return err
@@ -507,18 +518,38 @@ func (a *App) VolumeDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if dryRunRequested(r) {
+		a.dryRunHttp(w, func(db wdb.DB, executor executors.Executor) error {
+			err := RunOperation(NewVolumeDeleteOperation(volume, db),
+				a.Allocator(), executor)
+			if err != nil || remotevolumeid == "" {
+				return err
+			}
+			var remvol *VolumeEntry
+			err = db.View(func(tx wdb.Tx) error {
+				remvol, err = NewVolumeEntryFromId(tx, remotevolumeid)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			return RunOperation(NewVolumeDeleteOperation(remvol, db),
+				a.Allocator(), executor)
+		})
+		return
+	}
+
 	vdel := NewVolumeDeleteOperation(volume, a.db)
 	if err := AsyncHttpOperation(a, w, r, vdel); err != nil {
-		http.Error(w,
-			fmt.Sprintf("Failed to set up volume delete: %v", err),
-			http.StatusInternalServerError)
+		OperationHttpError(w,
+			fmt.Sprintf("Failed to set up volume delete: %v", err), err)
 		return
 	}
 
 	if remotevolumeid != "" {
 		logger.Debug("For remote Volume id %v \n", remotevolumeid)
 		var volume *VolumeEntry
-		err := a.db.View(func(tx *bolt.Tx) error {
+		err := a.db.View(func(tx wdb.Tx) error {
 
 			var err error
 			volume, err = NewVolumeEntryFromId(tx, remotevolumeid)
@@ -531,7 +562,7 @@ func (a *App) VolumeDelete(w http.ResponseWriter, r *http.Request) {
 				return err
 			}
 
-			if volume.Info.Name == db.HeketiStorageVolumeName {
+			if volume.Info.Name == wdb.HeketiStorageVolumeName {
 				err := fmt.Errorf("Cannot delete volume containing the Heketi database")
 				http.Error(w, err.Error(), http.StatusConflict)
 				return err
@@ -561,9 +592,8 @@ func (a *App) VolumeDelete(w http.ResponseWriter, r *http.Request) {
 
 		vdel := NewVolumeDeleteOperation(volume, a.db)
 		if err := AsyncHttpOperation(a, w, r, vdel); err != nil {
-			http.Error(w,
-				fmt.Sprintf("Failed to set up volume delete: %v", err),
-				http.StatusInternalServerError)
+			OperationHttpError(w,
+				fmt.Sprintf("Failed to set up volume delete: %v", err), err)
 			return
 		}
 	}
@@ -597,7 +627,7 @@ func (a *App) VolumeExpand(w http.ResponseWriter, r *http.Request) {
 	logger.Debug("Size: %v", msg.Size)
 
 	var volume *VolumeEntry
-	err = a.db.View(func(tx *bolt.Tx) error {
+	err = a.db.View(func(tx wdb.Tx) error {
 
 		var err error
 		volume, err = NewVolumeEntryFromId(tx, id)
@@ -616,11 +646,18 @@ func (a *App) VolumeExpand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if dryRunRequested(r) {
+		a.dryRunHttp(w, func(db wdb.DB, executor executors.Executor) error {
+			return RunOperation(NewVolumeExpandOperation(volume, db, msg.Size),
+				a.Allocator(), executor)
+		})
+		return
+	}
+
 	ve := NewVolumeExpandOperation(volume, a.db, msg.Size)
 	if err := AsyncHttpOperation(a, w, r, ve); err != nil {
-		http.Error(w,
-			fmt.Sprintf("Failed to allocate volume expansion: %v", err),
-			http.StatusInternalServerError)
+		OperationHttpError(w,
+			fmt.Sprintf("Failed to allocate volume expansion: %v", err), err)
 		return
 	}
 }
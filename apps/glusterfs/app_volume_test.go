@@ -24,10 +24,9 @@ import (
 	"testing"
 	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
 	client "github.com/chinacoolhacker/heketi/client/api/go-client"
-	"github.com/chinacoolhacker/heketi/pkg/db"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/heketi/tests"
@@ -240,7 +239,7 @@ func TestVolumeHeketiDbStorage(t *testing.T) {
 	// VolumeCreate using default durability
 	request := []byte(`{
         "size" : 100,
-        "name" : "` + db.HeketiStorageVolumeName + `"
+        "name" : "` + wdb.HeketiStorageVolumeName + `"
     }`)
 
 	// Send request
@@ -712,7 +711,7 @@ func TestVolumeList(t *testing.T) {
 
 	// Create some volumes
 	numvolumes := 1000
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 
 		for i := 0; i < numvolumes; i++ {
 			v := createSampleReplicaVolumeEntry(100, 2)
@@ -740,7 +739,7 @@ func TestVolumeList(t *testing.T) {
 	tests.Assert(t, len(msg.Volumes) == numvolumes)
 
 	// Check that all the volumes are in the database
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		for _, id := range msg.Volumes {
 			_, err := NewVolumeEntryFromId(tx, id)
 			if err != nil {
@@ -763,7 +762,7 @@ func TestVolumeListReadOnlyDb(t *testing.T) {
 
 	// Create some volumes
 	numvolumes := 1000
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 
 		for i := 0; i < numvolumes; i++ {
 			v := createSampleReplicaVolumeEntry(100, 2)
@@ -780,9 +779,7 @@ func TestVolumeListReadOnlyDb(t *testing.T) {
 	app.Close()
 
 	// Open Db here to force read only mode
-	db, err := bolt.Open(tmpfile, 0666, &bolt.Options{
-		ReadOnly: true,
-	})
+	db, err := wdb.Open("", tmpfile, true)
 	tests.Assert(t, err == nil, err)
 	tests.Assert(t, db != nil)
 
@@ -809,7 +806,7 @@ func TestVolumeListReadOnlyDb(t *testing.T) {
 	tests.Assert(t, len(msg.Volumes) == numvolumes)
 
 	// Check that all the volumes are in the database
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		for _, id := range msg.Volumes {
 			_, err := NewVolumeEntryFromId(tx, id)
 			if err != nil {
@@ -0,0 +1,599 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/gorilla/mux"
+	"github.com/lpabon/godbc"
+)
+
+const (
+	BOLTDB_BUCKET_ASYNC_OPS = "ASYNC_OPERATIONS"
+
+	// Bucket mapping each idempotency key to the id of the most recent
+	// async operation created with it
+	BOLTDB_BUCKET_ASYNC_OPS_KEYS = "ASYNC_OPERATION_KEYS"
+
+	// Header of the request that created an async operation whose
+	// value can later be used to look the operation up.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// Header of the status of a failed async operation telling the
+	// kind of the failure of the executor, such as "not found", when
+	// it is known.
+	ErrorKindHeader = "X-Error-Kind"
+)
+
+var (
+	// Seconds the result of a completed async operation is kept
+	AsyncOperationTtl int64 = 24 * 60 * 60
+
+	// How often the expired async operations are removed from the db
+	AsyncOperationPruneInterval = 10 * time.Minute
+)
+
+type AsyncOperationState string
+
+const (
+	AsyncOperationPending   AsyncOperationState = "pending"
+	AsyncOperationSucceeded AsyncOperationState = "succeeded"
+	AsyncOperationFailed    AsyncOperationState = "failed"
+	AsyncOperationCancelled AsyncOperationState = "cancelled"
+)
+
+// AsyncOperationEntry records the state of an asynchronous request in
+// the db, so that its status can be queried from any heketi instance
+// using the db and after heketi was restarted.
+type AsyncOperationEntry struct {
+	Id             string
+	IdempotencyKey string
+	State          AsyncOperationState
+	Location       string
+	Error          string
+	Started        int64
+	Finished       int64
+	Expires        int64
+
+	// kind of the executor error the operation failed with, empty
+	// when it is not known
+	ErrorKind string
+}
+
+// NewAsyncOperationEntry returns a new, pending, async operation entry.
+func NewAsyncOperationEntry() *AsyncOperationEntry {
+	return &AsyncOperationEntry{
+		Id:      utils.GenUUID(),
+		State:   AsyncOperationPending,
+		Started: operationTimestamp(),
+	}
+}
+
+// NewAsyncOperationEntryFromId fetches an existing async operation entry
+// from the db.
+func NewAsyncOperationEntryFromId(tx wdb.Tx, id string) (
+	*AsyncOperationEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := &AsyncOperationEntry{}
+	err := EntryLoad(tx, entry, id)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// AsyncOperationList returns the IDs of all async operation entries.
+func AsyncOperationList(tx wdb.Tx) ([]string, error) {
+	list := EntryKeys(tx, BOLTDB_BUCKET_ASYNC_OPS)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
+
+func (a *AsyncOperationEntry) BucketName() string {
+	return BOLTDB_BUCKET_ASYNC_OPS
+}
+
+func (a *AsyncOperationEntry) Save(tx wdb.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(a.Id != "")
+
+	return EntrySave(tx, a, a.Id)
+}
+
+func (a *AsyncOperationEntry) Delete(tx wdb.Tx) error {
+	return EntryDelete(tx, a, a.Id)
+}
+
+func (a *AsyncOperationEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*a)
+
+	return buffer.Bytes(), err
+}
+
+func (a *AsyncOperationEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(a)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// complete sets the final state of the operation from the result of
+// the async function.
+func (a *AsyncOperationEntry) complete(location string, err error) {
+	a.Finished = operationTimestamp()
+	a.Expires = a.Finished + AsyncOperationTtl
+	if err == ErrCancelled {
+		a.State = AsyncOperationCancelled
+		a.Error = err.Error()
+	} else if err != nil {
+		a.State = AsyncOperationFailed
+		a.Error = err.Error()
+		if kind := executors.KindOf(err); kind != executors.ErrorUnknown {
+			a.ErrorKind = kind.String()
+		}
+	} else {
+		a.State = AsyncOperationSucceeded
+		a.Location = location
+	}
+}
+
+// Expired returns true if the result of the operation is no longer
+// kept. Pending operations never expire.
+func (a *AsyncOperationEntry) Expired() bool {
+	return a.Expires != 0 && a.Expires <= operationTimestamp()
+}
+
+// AsyncOperationManager runs functions in the background on behalf of
+// http requests and serves their status the same way as the
+// rest.AsyncHttpManager does. The state of the operations is kept in
+// the db instead of memory, until AsyncOperationTtl seconds after they
+// completed.
+type AsyncOperationManager struct {
+	route string
+	db    wdb.DB
+
+	// operations running in this instance, by operation id
+	lock    sync.Mutex
+	running map[string]*runningOperation
+
+	// closed to stop pruning the expired operations
+	stop chan struct{}
+}
+
+type runningOperation struct {
+	// nil if the operation can not be cancelled
+	cancel   context.CancelFunc
+	progress *OperationProgress
+}
+
+func NewAsyncOperationManager(route string, db wdb.DB) *AsyncOperationManager {
+	return &AsyncOperationManager{
+		route:   route,
+		db:      db,
+		running: map[string]*runningOperation{},
+	}
+}
+
+// Recover fails all the operations that were still pending when
+// heketi was last stopped. Their functions are not running anymore
+// and would otherwise be reported as pending forever. Expired
+// operations and idempotency keys are removed and the idempotency key
+// index is rebuilt.
+func (m *AsyncOperationManager) Recover() error {
+	return m.db.Update(func(tx wdb.Tx) error {
+		ids, err := AsyncOperationList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			op, err := NewAsyncOperationEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if op.State != AsyncOperationPending {
+				continue
+			}
+			logger.Warning("Async operation %v was interrupted", id)
+			op.complete("", ErrInterrupted)
+			if err := op.Save(tx); err != nil {
+				return err
+			}
+		}
+		if err := pruneAsyncOperations(tx); err != nil {
+			return err
+		}
+		if err := pruneIdempotencyKeys(tx); err != nil {
+			return err
+		}
+		return reindexAsyncOperations(tx)
+	})
+}
+
+// StartPruning removes the expired operations and idempotency keys
+// from the db every interval, until Stop is called.
+func (m *AsyncOperationManager) StartPruning(interval time.Duration) {
+	m.stop = make(chan struct{})
+	go func(stop <-chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := m.prune(); err != nil {
+					logger.LogError("Unable to prune async operations: %v", err)
+				}
+			}
+		}
+	}(m.stop)
+}
+
+// Stop stops pruning the expired operations and idempotency keys.
+func (m *AsyncOperationManager) Stop() {
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+func (m *AsyncOperationManager) prune() error {
+	return m.db.Update(func(tx wdb.Tx) error {
+		if err := pruneAsyncOperations(tx); err != nil {
+			return err
+		}
+		return pruneIdempotencyKeys(tx)
+	})
+}
+
+// pruneAsyncOperations removes the operations that have expired.
+func pruneAsyncOperations(tx wdb.Tx) error {
+	ids, err := AsyncOperationList(tx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		op, err := NewAsyncOperationEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if !op.Expired() {
+			continue
+		}
+		if err := unindexAsyncOperation(tx, op); err != nil {
+			return err
+		}
+		if err := op.Delete(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexAsyncOperation records op as the most recent operation created
+// with its idempotency key.
+func indexAsyncOperation(tx wdb.Tx, op *AsyncOperationEntry) error {
+	if op.IdempotencyKey == "" {
+		return nil
+	}
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_ASYNC_OPS_KEYS))
+	if b == nil {
+		logger.LogError("Unable to access async operation keys bucket")
+		return ErrDbAccess
+	}
+	return b.Put([]byte(op.IdempotencyKey), []byte(op.Id))
+}
+
+// unindexAsyncOperation removes the idempotency key of op from the
+// index, unless a more recent operation was created with it.
+func unindexAsyncOperation(tx wdb.Tx, op *AsyncOperationEntry) error {
+	if op.IdempotencyKey == "" {
+		return nil
+	}
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_ASYNC_OPS_KEYS))
+	if b == nil {
+		logger.LogError("Unable to access async operation keys bucket")
+		return ErrDbAccess
+	}
+	if string(b.Get([]byte(op.IdempotencyKey))) != op.Id {
+		return nil
+	}
+	return b.Delete([]byte(op.IdempotencyKey))
+}
+
+// reindexAsyncOperations indexes the operations by idempotency key
+// again, for example after they were saved by a heketi version that
+// did not index them.
+func reindexAsyncOperations(tx wdb.Tx) error {
+	ids, err := AsyncOperationList(tx)
+	if err != nil {
+		return err
+	}
+	latest := map[string]*AsyncOperationEntry{}
+	for _, id := range ids {
+		op, err := NewAsyncOperationEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if op.IdempotencyKey == "" {
+			continue
+		}
+		found, ok := latest[op.IdempotencyKey]
+		if !ok || op.Started > found.Started {
+			latest[op.IdempotencyKey] = op
+		}
+	}
+	for _, op := range latest {
+		if err := indexAsyncOperation(tx, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findAsyncOperation returns the most recent operation, that has not
+// expired, created with the given idempotency key.
+func findAsyncOperation(tx wdb.Tx, key string) (*AsyncOperationEntry, error) {
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_ASYNC_OPS_KEYS))
+	if b == nil {
+		logger.LogError("Unable to access async operation keys bucket")
+		return nil, ErrDbAccess
+	}
+	id := b.Get([]byte(key))
+	if id == nil {
+		return nil, ErrNotFound
+	}
+
+	op, err := NewAsyncOperationEntryFromId(tx, string(id))
+	if err != nil {
+		return nil, err
+	}
+	if op.Expired() {
+		return nil, ErrNotFound
+	}
+	return op, nil
+}
+
+// AsyncHttpRedirectFunc records a new operation, starts handlerfunc in
+// the background and redirects the client to the status of the
+// operation. The url returned by handlerfunc is where the client is
+// sent once the operation has completed.
+func (m *AsyncOperationManager) AsyncHttpRedirectFunc(w http.ResponseWriter,
+	r *http.Request,
+	handlerfunc func() (string, error)) {
+
+	err := m.start(w, r, false, func(ctx context.Context) (string, error) {
+		return handlerfunc()
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// AsyncHttpCancelableFunc is the same as AsyncHttpRedirectFunc for
+// functions that can be cancelled and report their progress. The
+// context given to handlerfunc carries the progress of the operation
+// and is cancelled when the client deletes the operation. The
+// operation is then recorded as cancelled if handlerfunc returns an
+// error.
+func (m *AsyncOperationManager) AsyncHttpCancelableFunc(w http.ResponseWriter,
+	r *http.Request,
+	handlerfunc func(ctx context.Context) (string, error)) {
+
+	if err := m.start(w, r, true, handlerfunc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// start records a new operation, starts handlerfunc in the background
+// and redirects the client to the status of the operation. If the
+// operation can not be recorded, handlerfunc is not started and the
+// error is returned without responding to the client.
+func (m *AsyncOperationManager) start(w http.ResponseWriter,
+	r *http.Request,
+	cancelable bool,
+	handlerfunc func(ctx context.Context) (string, error)) error {
+
+	op := NewAsyncOperationEntry()
+	op.IdempotencyKey = r.Header.Get(IdempotencyKeyHeader)
+	err := m.db.Update(func(tx wdb.Tx) error {
+		if op.IdempotencyKey != "" {
+			err := setIdempotencyKeyOperation(tx, op.IdempotencyKey, op.Id)
+			if err != nil {
+				return err
+			}
+		}
+		if err := indexAsyncOperation(tx, op); err != nil {
+			return err
+		}
+		return op.Save(tx)
+	})
+	if err != nil {
+		return logger.LogError("Unable to record async operation: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	running := &runningOperation{progress: NewOperationProgress()}
+	if cancelable {
+		running.cancel = cancel
+	}
+	ctx = withOperationProgress(ctx, running.progress)
+	m.lock.Lock()
+	m.running[op.Id] = running
+	m.lock.Unlock()
+
+	go func() {
+		defer cancel()
+		location, err := handlerfunc(ctx)
+		if err != nil && ctx.Err() == context.Canceled {
+			logger.Info("Async operation %v was cancelled: %v", op.Id, err)
+			err = ErrCancelled
+		}
+		m.complete(op, location, err)
+
+		m.lock.Lock()
+		delete(m.running, op.Id)
+		m.lock.Unlock()
+	}()
+
+	http.Redirect(w, r, m.route+"/"+op.Id, http.StatusAccepted)
+	return nil
+}
+
+func (m *AsyncOperationManager) runningOperation(id string) *runningOperation {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.running[id]
+}
+
+func (m *AsyncOperationManager) complete(op *AsyncOperationEntry,
+	location string, err error) {
+
+	op.complete(location, err)
+	e := m.db.Update(func(tx wdb.Tx) error {
+		return op.Save(tx)
+	})
+	if e != nil {
+		logger.LogError("Unable to record result of async operation %v: %v",
+			op.Id, e)
+	}
+}
+
+// HandlerStatus serves the status of an operation. The final status
+// is served until the operation expires, so a client that lost the
+// response, or polls a restarted heketi, can still get it.
+func (m *AsyncOperationManager) HandlerStatus(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var op *AsyncOperationEntry
+	err := m.db.View(func(tx wdb.Tx) error {
+		var err error
+		op, err = NewAsyncOperationEntryFromId(tx, id)
+		if err == nil && op.Expired() {
+			err = ErrNotFound
+		}
+		return err
+	})
+	if err == ErrNotFound {
+		http.Error(w, "Id not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case op.State == AsyncOperationPending:
+		w.Header().Add("X-Pending", "true")
+		running := m.runningOperation(id)
+		if running == nil {
+			// the operation is run by another instance
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		progress := running.progress.Info()
+		if err := json.NewEncoder(w).Encode(&progress); err != nil {
+			logger.Err(err)
+		}
+	case op.State == AsyncOperationFailed, op.State == AsyncOperationCancelled:
+		if op.ErrorKind != "" {
+			w.Header().Set(ErrorKindHeader, op.ErrorKind)
+		}
+		http.Error(w, op.Error, http.StatusInternalServerError)
+	case op.Location != "":
+		http.Redirect(w, r, op.Location, http.StatusSeeOther)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandlerCancel cancels a running operation. The client is sent to
+// the status of the operation, which is pending until the changes made
+// so far have been rolled back.
+func (m *AsyncOperationManager) HandlerCancel(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var op *AsyncOperationEntry
+	err := m.db.View(func(tx wdb.Tx) error {
+		var err error
+		op, err = NewAsyncOperationEntryFromId(tx, id)
+		if err == nil && op.Expired() {
+			err = ErrNotFound
+		}
+		return err
+	})
+	if err == ErrNotFound {
+		http.Error(w, "Id not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if op.State != AsyncOperationPending {
+		http.Error(w, "Operation already completed", http.StatusConflict)
+		return
+	}
+
+	running := m.runningOperation(id)
+	if running == nil || running.cancel == nil {
+		http.Error(w, "Operation can not be cancelled", http.StatusConflict)
+		return
+	}
+
+	logger.Info("Cancelling async operation %v", id)
+	running.cancel()
+	http.Redirect(w, r, m.route+"/"+id, http.StatusAccepted)
+}
+
+// HandlerIdempotencyKey redirects the client to the status of the
+// operation that was created with the idempotency key in the query.
+func (m *AsyncOperationManager) HandlerIdempotencyKey(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("idempotency_key")
+	if key == "" {
+		http.Error(w, "idempotency_key is required", http.StatusBadRequest)
+		return
+	}
+
+	var op *AsyncOperationEntry
+	err := m.db.View(func(tx wdb.Tx) error {
+		var err error
+		op, err = findAsyncOperation(tx, key)
+		return err
+	})
+	if err == ErrNotFound {
+		http.Error(w, "No operation found for idempotency key", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, m.route+"/"+op.Id, http.StatusSeeOther)
+}
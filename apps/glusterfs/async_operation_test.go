@@ -0,0 +1,416 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+)
+
+func newAsyncTestServer(app *App, handlerfunc func() (string, error)) *httptest.Server {
+	router := mux.NewRouter()
+	router.HandleFunc(ASYNC_ROUTE+"/{id}", app.asyncManager.HandlerStatus).Methods("GET")
+	router.HandleFunc(ASYNC_ROUTE+"/{id}", app.asyncManager.HandlerCancel).Methods("DELETE")
+	router.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		app.asyncManager.AsyncHttpRedirectFunc(w, r, handlerfunc)
+	}).Methods("POST")
+	return httptest.NewServer(router)
+}
+
+func noRedirectClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func waitAsyncOperation(t *testing.T, url string) *http.Response {
+	client := noRedirectClient()
+	for i := 0; i < 100; i++ {
+		r, err := client.Get(url)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		if r.Header.Get("X-Pending") != "true" {
+			return r
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("operation did not complete")
+	return nil
+}
+
+func TestAsyncOperationPersisted(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	ts := newAsyncTestServer(app, func() (string, error) {
+		return "/myresource", nil
+	})
+	r, err := noRedirectClient().Post(ts.URL+"/app", "application/json", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location := r.Header.Get("Location")
+	tests.Assert(t, strings.HasPrefix(location, ASYNC_ROUTE+"/"), "got:", location)
+
+	r = waitAsyncOperation(t, ts.URL+location)
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther)
+	ts.Close()
+	app.Close()
+
+	// the result is still available after a restart
+	app = NewTestApp(tmpfile)
+	defer app.Close()
+	ts = newAsyncTestServer(app, nil)
+	defer ts.Close()
+	r, err = noRedirectClient().Get(ts.URL + location)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther)
+	tests.Assert(t, r.Header.Get("Location") == "/myresource",
+		"got:", r.Header.Get("Location"))
+}
+
+func TestAsyncOperationFailed(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	ts := newAsyncTestServer(app, func() (string, error) {
+		return "", errors.New("it failed")
+	})
+	defer ts.Close()
+
+	r, err := noRedirectClient().Post(ts.URL+"/app", "application/json", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	location := r.Header.Get("Location")
+
+	r = waitAsyncOperation(t, ts.URL+location)
+	tests.Assert(t, r.StatusCode == http.StatusInternalServerError)
+	body, err := ioutil.ReadAll(r.Body)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, strings.Contains(string(body), "it failed"), "got:", string(body))
+
+	// the error is reported until the operation expires
+	r, err = noRedirectClient().Get(ts.URL + location)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusInternalServerError)
+}
+
+func TestAsyncOperationFailedErrorKind(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	for _, test := range []struct {
+		err  error
+		kind string
+	}{
+		{executors.NewError(executors.ErrorNotFound, "host", "Volume vol1 does not exist"),
+			"not found"},
+		{executors.NewError(executors.ErrorBusy, "host", "Another transaction is in progress"),
+			"busy"},
+		{executors.NewCommandError("host", 1, "", "mkfs.xfs failed"),
+			"command failed"},
+		{errors.New("no kind"), ""},
+	} {
+		err := test.err
+		ts := newAsyncTestServer(app, func() (string, error) {
+			return "", err
+		})
+
+		// failed operations keep their status, the kind of the
+		// failure is told in a header
+		r, e := noRedirectClient().Post(ts.URL+"/app", "application/json", nil)
+		tests.Assert(t, e == nil, "expected err == nil, got:", e)
+		r = waitAsyncOperation(t, ts.URL+r.Header.Get("Location"))
+		tests.Assert(t, r.StatusCode == http.StatusInternalServerError, err, r.StatusCode)
+		tests.Assert(t, r.Header.Get(ErrorKindHeader) == test.kind,
+			err, r.Header.Get(ErrorKindHeader))
+		body, e := ioutil.ReadAll(r.Body)
+		tests.Assert(t, e == nil, "expected err == nil, got:", e)
+		tests.Assert(t, strings.Contains(string(body), err.Error()), "got:", string(body))
+		ts.Close()
+	}
+}
+
+func TestAsyncOperationExpires(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	now := time.Now().Unix()
+	defer tests.Patch(&operationTimestamp, func() int64 { return now }).Restore()
+	defer tests.Patch(&AsyncOperationTtl, int64(60)).Restore()
+	defer tests.Patch(&AsyncOperationPruneInterval, 10*time.Millisecond).Restore()
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	ts := newAsyncTestServer(app, func() (string, error) {
+		return "", nil
+	})
+	defer ts.Close()
+
+	r, err := noRedirectClient().Post(ts.URL+"/app", "application/json", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	location := r.Header.Get("Location")
+	r = waitAsyncOperation(t, ts.URL+location)
+	tests.Assert(t, r.StatusCode == http.StatusNoContent)
+
+	now += 59
+	r, err = noRedirectClient().Get(ts.URL + location)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusNoContent)
+
+	now += 1
+	r, err = noRedirectClient().Get(ts.URL + location)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	// expired operations are removed from the db in the background
+	var ids []string
+	for i := 0; i < 100; i++ {
+		err = app.db.View(func(tx wdb.Tx) error {
+			var err error
+			ids, err = AsyncOperationList(tx)
+			return err
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		if len(ids) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, len(ids) == 0, "expected no operations, got:", ids)
+}
+
+func TestAsyncOperationIdempotencyKeyIndex(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	now := time.Now().Unix()
+	defer tests.Patch(&operationTimestamp, func() int64 { return now }).Restore()
+	defer tests.Patch(&AsyncOperationTtl, int64(60)).Restore()
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	first := NewAsyncOperationEntry()
+	first.IdempotencyKey = "my-key"
+	second := NewAsyncOperationEntry()
+	second.IdempotencyKey = "my-key"
+	second.Started = first.Started + 1
+	second.complete("", nil)
+	err := app.db.Update(func(tx wdb.Tx) error {
+		for _, op := range []*AsyncOperationEntry{first, second} {
+			if err := op.Save(tx); err != nil {
+				return err
+			}
+		}
+		// operations saved without an index are indexed again
+		return reindexAsyncOperations(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the most recent operation is found
+	err = app.db.View(func(tx wdb.Tx) error {
+		op, err := findAsyncOperation(tx, "my-key")
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, op.Id == second.Id, "expected", second.Id, "got:", op.Id)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// and is removed from the index once it expired
+	now += 60
+	err = app.asyncManager.prune()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = app.db.View(func(tx wdb.Tx) error {
+		_, err := findAsyncOperation(tx, "my-key")
+		tests.Assert(t, err == ErrNotFound, "expected ErrNotFound, got:", err)
+		b := tx.Bucket([]byte(BOLTDB_BUCKET_ASYNC_OPS_KEYS))
+		tests.Assert(t, b.Get([]byte("my-key")) == nil)
+
+		// the pending operation never expires
+		ids, err := AsyncOperationList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(ids) == 1 && ids[0] == first.Id, "got:", ids)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestAsyncOperationIdempotencyKey(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	err := app.SetRoutes(router)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	router.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		app.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+			return "/myresource", nil
+		})
+	}).Methods("POST")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	req, err := http.NewRequest("POST", ts.URL+"/app", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.Header.Set(IdempotencyKeyHeader, "my-key")
+	r, err := noRedirectClient().Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location := r.Header.Get("Location")
+
+	r, err = noRedirectClient().Get(ts.URL + ASYNC_ROUTE + "?idempotency_key=my-key")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther)
+	tests.Assert(t, r.Header.Get("Location") == location,
+		"expected", location, "got:", r.Header.Get("Location"))
+
+	r, err = noRedirectClient().Get(ts.URL + ASYNC_ROUTE + "?idempotency_key=other-key")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	r, err = noRedirectClient().Get(ts.URL + ASYNC_ROUTE)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+}
+
+func TestAsyncOperationInterrupted(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// an operation was running when heketi stopped
+	app := NewTestApp(tmpfile)
+	op := NewAsyncOperationEntry()
+	err := app.db.Update(func(tx wdb.Tx) error {
+		return op.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	app = NewTestApp(tmpfile)
+	defer app.Close()
+	err = app.db.View(func(tx wdb.Tx) error {
+		entry, err := NewAsyncOperationEntryFromId(tx, op.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, entry.State == AsyncOperationFailed,
+			"expected failed, got:", entry.State)
+		tests.Assert(t, entry.Error == ErrInterrupted.Error())
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func deleteAsyncOperation(t *testing.T, url string) *http.Response {
+	req, err := http.NewRequest("DELETE", url, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r, err := noRedirectClient().Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return r
+}
+
+func TestAsyncOperationCancel(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	started := make(chan bool)
+	router := mux.NewRouter()
+	err := app.SetRoutes(router)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	router.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		app.asyncManager.AsyncHttpCancelableFunc(w, r, func(ctx context.Context) (string, error) {
+			started <- true
+			<-ctx.Done()
+			return "", ctx.Err()
+		})
+	}).Methods("POST")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	r, err := noRedirectClient().Post(ts.URL+"/app", "application/json", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location := r.Header.Get("Location")
+	<-started
+
+	r = deleteAsyncOperation(t, ts.URL+location)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	tests.Assert(t, r.Header.Get("Location") == location,
+		"expected", location, "got:", r.Header.Get("Location"))
+
+	r = waitAsyncOperation(t, ts.URL+location)
+	tests.Assert(t, r.StatusCode == http.StatusInternalServerError)
+	body, err := ioutil.ReadAll(r.Body)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, strings.Contains(string(body), ErrCancelled.Error()), "got:", string(body))
+
+	err = app.db.View(func(tx wdb.Tx) error {
+		op, err := NewAsyncOperationEntryFromId(tx, strings.TrimPrefix(location, ASYNC_ROUTE+"/"))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, op.State == AsyncOperationCancelled,
+			"expected cancelled, got:", op.State)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// a completed operation can not be cancelled
+	r = deleteAsyncOperation(t, ts.URL+location)
+	tests.Assert(t, r.StatusCode == http.StatusConflict, "got:", r.StatusCode)
+
+	r = deleteAsyncOperation(t, ts.URL+ASYNC_ROUTE+"/abc")
+	tests.Assert(t, r.StatusCode == http.StatusNotFound, "got:", r.StatusCode)
+}
+
+func TestAsyncOperationNotCancelable(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	release := make(chan bool)
+	ts := newAsyncTestServer(app, func() (string, error) {
+		<-release
+		return "/myresource", nil
+	})
+	defer ts.Close()
+
+	r, err := noRedirectClient().Post(ts.URL+"/app", "application/json", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	location := r.Header.Get("Location")
+
+	r = deleteAsyncOperation(t, ts.URL+location)
+	tests.Assert(t, r.StatusCode == http.StatusConflict, "got:", r.StatusCode)
+
+	close(release)
+	r = waitAsyncOperation(t, ts.URL+location)
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther)
+}
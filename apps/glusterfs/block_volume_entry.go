@@ -14,7 +14,6 @@ import (
 	"encoding/gob"
 	"fmt"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
 	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
@@ -22,12 +21,17 @@ import (
 	"github.com/lpabon/godbc"
 )
 
+const (
+	// REDACTED replaces credentials in output which leaves heketi
+	REDACTED = "(redacted)"
+)
+
 type BlockVolumeEntry struct {
 	Info    api.BlockVolumeInfo
 	Pending PendingItem
 }
 
-func BlockVolumeList(tx *bolt.Tx) ([]string, error) {
+func BlockVolumeList(tx wdb.Tx) ([]string, error) {
 	list := EntryKeys(tx, BOLTDB_BUCKET_BLOCKVOLUME)
 	if list == nil {
 		return nil, ErrAccessList
@@ -35,6 +39,39 @@ func BlockVolumeList(tx *bolt.Tx) ([]string, error) {
 	return list, nil
 }
 
+// resealBlockVolumeCredentials loads every block volume entry with the
+// credentials opened by the box "from" and saves it again with the
+// credentials sealed by the box "to". A nil box stands for clear text.
+func resealBlockVolumeCredentials(tx wdb.Tx, from, to *utils.SecretBox) error {
+	blockvolumes, err := BlockVolumeList(tx)
+	if err != nil {
+		return err
+	}
+
+	defer func(box *utils.SecretBox) {
+		DbSecretBox = box
+	}(DbSecretBox)
+
+	DbSecretBox = from
+	entries := make([]*BlockVolumeEntry, 0, len(blockvolumes))
+	for _, id := range blockvolumes {
+		entry, err := NewBlockVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+
+	DbSecretBox = to
+	for _, entry := range entries {
+		if err := entry.Save(tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func NewVolumeEntryForBlockHosting(clusters []string) (*VolumeEntry, error) {
 	var msg api.VolumeCreateRequest
 	msg.Clusters = clusters
@@ -81,7 +118,7 @@ func NewBlockVolumeEntryFromRequest(req *api.BlockVolumeCreateRequest) *BlockVol
 	return vol
 }
 
-func NewBlockVolumeEntryFromId(tx *bolt.Tx, id string) (*BlockVolumeEntry, error) {
+func NewBlockVolumeEntryFromId(tx wdb.Tx, id string) (*BlockVolumeEntry, error) {
 	godbc.Require(tx != nil)
 
 	entry := NewBlockVolumeEntry()
@@ -101,18 +138,18 @@ func (v *BlockVolumeEntry) Visible() bool {
 	return v.Pending.Id == ""
 }
 
-func (v *BlockVolumeEntry) Save(tx *bolt.Tx) error {
+func (v *BlockVolumeEntry) Save(tx wdb.Tx) error {
 	godbc.Require(tx != nil)
 	godbc.Require(len(v.Info.Id) > 0)
 
 	return EntrySave(tx, v, v.Info.Id)
 }
 
-func (v *BlockVolumeEntry) Delete(tx *bolt.Tx) error {
+func (v *BlockVolumeEntry) Delete(tx wdb.Tx) error {
 	return EntryDelete(tx, v, v.Info.Id)
 }
 
-func (v *BlockVolumeEntry) NewInfoResponse(tx *bolt.Tx) (*api.BlockVolumeInfoResponse, error) {
+func (v *BlockVolumeEntry) NewInfoResponse(tx wdb.Tx) (*api.BlockVolumeInfoResponse, error) {
 	godbc.Require(tx != nil)
 
 	info := api.NewBlockVolumeInfoResponse()
@@ -122,15 +159,22 @@ func (v *BlockVolumeEntry) NewInfoResponse(tx *bolt.Tx) (*api.BlockVolumeInfoRes
 	info.Size = v.Info.Size
 	info.Name = v.Info.Name
 	info.Hacount = v.Info.Hacount
+	info.Auth = v.Info.Auth
 	info.BlockHostingVolume = v.Info.BlockHostingVolume
 
 	return info, nil
 }
 
 func (v *BlockVolumeEntry) Marshal() ([]byte, error) {
+	// Seal a copy so the caller keeps the clear text credentials
+	entry := *v
+	if err := entry.sealCredentials(); err != nil {
+		return nil, err
+	}
+
 	var buffer bytes.Buffer
 	enc := gob.NewEncoder(&buffer)
-	err := enc.Encode(*v)
+	err := enc.Encode(entry)
 
 	return buffer.Bytes(), err
 }
@@ -142,14 +186,60 @@ func (v *BlockVolumeEntry) Unmarshal(buffer []byte) error {
 		return err
 	}
 
+	return v.openCredentials()
+}
+
+// sealCredentials encrypts the CHAP password if the db is encrypted.
+func (v *BlockVolumeEntry) sealCredentials() error {
+	if DbSecretBox == nil {
+		return nil
+	}
+
+	password, err := DbSecretBox.Seal(v.Info.BlockVolume.Password)
+	if err != nil {
+		return fmt.Errorf("Unable to seal credentials of block volume %v: %v",
+			v.Info.Id, err)
+	}
+	v.Info.BlockVolume.Password = password
+
 	return nil
 }
 
+// openCredentials decrypts a sealed CHAP password. If the db encryption
+// key is not available the sealed value is left in place.
+func (v *BlockVolumeEntry) openCredentials() error {
+	if !utils.IsSealed(v.Info.BlockVolume.Password) {
+		return nil
+	}
+	if DbSecretBox == nil {
+		logger.Warning("Credentials of block volume %v are sealed"+
+			" but no db encryption key is available", v.Info.Id)
+		return nil
+	}
+
+	password, err := DbSecretBox.Open(v.Info.BlockVolume.Password)
+	if err != nil {
+		return fmt.Errorf("Unable to open credentials of block volume %v: %v",
+			v.Info.Id, err)
+	}
+	v.Info.BlockVolume.Password = password
+
+	return nil
+}
+
+// RedactCredentials removes the CHAP password from the entry. It is meant
+// for entries that leave heketi, such as db dumps and backups.
+func (v *BlockVolumeEntry) RedactCredentials() {
+	if v.Info.BlockVolume.Password != "" {
+		v.Info.BlockVolume.Password = REDACTED
+	}
+}
+
 func (v *BlockVolumeEntry) eligibleClustersAndVolumes(db wdb.RODB) (
 	possibleClusters []string, volumes []string, e error) {
 
 	if len(v.Info.Clusters) == 0 {
-		err := db.View(func(tx *bolt.Tx) error {
+		err := db.View(func(tx wdb.Tx) error {
 			var err error
 			possibleClusters, err = ClusterList(tx)
 			return err
@@ -177,7 +267,7 @@ func (v *BlockVolumeEntry) eligibleClustersAndVolumes(db wdb.RODB) (
 
 	var possibleVolumes []string
 	for _, clusterId := range possibleClusters {
-		err := db.View(func(tx *bolt.Tx) error {
+		err := db.View(func(tx wdb.Tx) error {
 			var err error
 			c, err := NewClusterEntryFromId(tx, clusterId)
 			for _, vol := range c.Info.Volumes {
@@ -200,7 +290,7 @@ func (v *BlockVolumeEntry) eligibleClustersAndVolumes(db wdb.RODB) (
 	logger.Debug("Using the following possible block hosting volumes: %+v", possibleVolumes)
 
 	for _, vol := range possibleVolumes {
-		err := db.View(func(tx *bolt.Tx) error {
+		err := db.View(func(tx wdb.Tx) error {
 			volEntry, err := NewVolumeEntryFromId(tx, vol)
 			if err != nil {
 				return err
@@ -245,7 +335,7 @@ func (v *BlockVolumeEntry) Create(db wdb.DB,
 }
 
 func (v *BlockVolumeEntry) saveCreateBlockVolume(db wdb.DB) error {
-	return db.Update(func(tx *bolt.Tx) error {
+	return db.Update(func(tx wdb.Tx) error {
 
 		err := v.Save(tx)
 		if err != nil {
@@ -282,7 +372,7 @@ func (v *BlockVolumeEntry) saveCreateBlockVolume(db wdb.DB) error {
 }
 
 func (v *BlockVolumeEntry) blockHostingVolumeName(db wdb.RODB) (name string, e error) {
-	e = db.View(func(tx *bolt.Tx) error {
+	e = db.View(func(tx wdb.Tx) error {
 		volume, err := NewVolumeEntryFromId(tx, v.Info.BlockHostingVolume)
 		if err != nil {
 			logger.LogError("Unable to load block hosting volume: %v", err)
@@ -313,8 +403,28 @@ func (v *BlockVolumeEntry) deleteBlockVolumeExec(db wdb.RODB,
 	return nil
 }
 
+func (v *BlockVolumeEntry) modifyBlockVolumeAuthExec(db wdb.RODB,
+	hvname string,
+	executor executors.Executor,
+	auth bool) (*executors.BlockVolumeInfo, error) {
+
+	executorhost, err := GetVerifiedManageHostname(db, executor, v.Info.Cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Using executor host [%v]", executorhost)
+
+	info, err := executor.BlockVolumeModifyAuth(executorhost, hvname, v.Info.Name, auth)
+	if err != nil {
+		logger.LogError("Unable to modify auth of block volume: %v", err)
+		return nil, err
+	}
+	return info, nil
+}
+
 func (v *BlockVolumeEntry) removeComponents(db wdb.DB) error {
-	return db.Update(func(tx *bolt.Tx) error {
+	return db.Update(func(tx wdb.Tx) error {
 		// Remove volume from cluster
 		cluster, err := NewClusterEntryFromId(tx, v.Info.Cluster)
 		if err != nil {
@@ -334,12 +444,12 @@ func (v *BlockVolumeEntry) removeComponents(db wdb.DB) error {
 			// Do not return here.. keep going
 		}
 
-		blockHostingVolume.BlockVolumeDelete(v.Info.Id)
-		if err != nil {
-			logger.Err(err)
-			// Do not return here.. keep going
+		// the space is only taken once the block volume is added to
+		// the hosting volume, not if its creation is rolled back
+		if utils.SortedStringHas(blockHostingVolume.Info.BlockInfo.BlockVolumes, v.Info.Id) {
+			blockHostingVolume.BlockVolumeDelete(v.Info.Id)
+			blockHostingVolume.Info.BlockInfo.FreeSize = blockHostingVolume.Info.BlockInfo.FreeSize + v.Info.Size
 		}
-		blockHostingVolume.Info.BlockInfo.FreeSize = blockHostingVolume.Info.BlockInfo.FreeSize + v.Info.Size
 		blockHostingVolume.Save(tx)
 
 		if err != nil {
@@ -366,7 +476,7 @@ func (v *BlockVolumeEntry) Destroy(db wdb.DB, executor executors.Executor) error
 // can host the incoming block volume. It returns false (and nil error) if
 // the volume is incompatible. It returns false, and an error if the
 // database operation fails.
-func canHostBlockVolume(tx *bolt.Tx, bv *BlockVolumeEntry, vol *VolumeEntry) (bool, error) {
+func canHostBlockVolume(tx wdb.Tx, bv *BlockVolumeEntry, vol *VolumeEntry) (bool, error) {
 	if vol.Info.BlockInfo.FreeSize < bv.Info.Size {
 		logger.Warning("Free size is less than the block volume requested")
 		return false, nil
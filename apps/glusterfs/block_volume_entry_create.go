@@ -12,7 +12,6 @@ package glusterfs
 import (
 	"fmt"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
 	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/lpabon/godbc"
@@ -53,9 +52,15 @@ func (v *BlockVolumeEntry) createBlockVolumeRequest(db wdb.RODB,
 	godbc.Require(db != nil)
 	godbc.Require(blockHostingVolumeId != "")
 
-	var blockHostingVolumeName string
+	var (
+		blockHostingVolumeName string
+		// storage hostnames of the candidate block hosts and the
+		// manage hostnames glusterd is checked on
+		candidates      []string
+		managehostnames []string
+	)
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx wdb.Tx) error {
 		logger.Debug("Getting info for block hosting volume %v", blockHostingVolumeId)
 		bhvol, err := NewVolumeEntryFromId(tx, blockHostingVolumeId)
 		if err != nil {
@@ -68,13 +73,8 @@ func (v *BlockVolumeEntry) createBlockVolumeRequest(db wdb.RODB,
 				if e != nil {
 					return fmt.Errorf("Could not find managehostname for %v", bhvol.Info.Mount.GlusterFS.Hosts[i])
 				}
-				e = executor.GlusterdCheck(managehostname)
-				if e == nil {
-					v.Info.BlockVolume.Hosts = append(v.Info.BlockVolume.Hosts, bhvol.Info.Mount.GlusterFS.Hosts[i])
-				}
-			}
-			if len(v.Info.BlockVolume.Hosts) < v.Info.Hacount {
-				return fmt.Errorf("insufficient block hosts online")
+				candidates = append(candidates, bhvol.Info.Mount.GlusterFS.Hosts[i])
+				managehostnames = append(managehostnames, managehostname)
 			}
 		} else {
 			v.Info.BlockVolume.Hosts = bhvol.Info.Mount.GlusterFS.Hosts
@@ -91,6 +91,21 @@ func (v *BlockVolumeEntry) createBlockVolumeRequest(db wdb.RODB,
 		return nil, "", err
 	}
 
+	// The nodes are checked outside of the transaction, connecting to
+	// them may have to pin their host keys in the db.
+	if len(candidates) > 0 {
+		for i, managehostname := range managehostnames {
+			if e := executor.GlusterdCheck(managehostname); e == nil {
+				v.Info.BlockVolume.Hosts = append(v.Info.BlockVolume.Hosts, candidates[i])
+			}
+		}
+		if len(v.Info.BlockVolume.Hosts) < v.Info.Hacount {
+			err = fmt.Errorf("insufficient block hosts online")
+			logger.Err(err)
+			return nil, "", err
+		}
+	}
+
 	// Select the host on which glusterd is running. To avoid request failing on host down senario.
 	executorhost, err := GetVerifiedManageHostname(db, executor, v.Info.Cluster)
 	if err != nil {
@@ -9,12 +9,14 @@
 package glusterfs
 
 import (
+	"bytes"
 	"os"
 	"reflect"
 	"testing"
 
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/heketi/tests"
 )
 
@@ -126,6 +128,82 @@ func TestNewBlockVolumeEntryMarshal(t *testing.T) {
 
 }
 
+func TestBlockVolumeEntryMarshalSealedCredentials(t *testing.T) {
+	box, err := utils.NewSecretBox("my secret", testSecretSalt)
+	tests.Assert(t, err == nil)
+	defer tests.Patch(&DbSecretBox, box).Restore()
+
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 512
+	req.Auth = true
+
+	bv := NewBlockVolumeEntryFromRequest(req)
+	bv.Info.BlockVolume.Username = "heketi-user"
+	bv.Info.BlockVolume.Password = "clear-text-password"
+
+	buffer, err := bv.Marshal()
+	tests.Assert(t, err == nil)
+	tests.Assert(t, !bytes.Contains(buffer, []byte("clear-text-password")))
+	// marshaling must not modify the entry itself
+	tests.Assert(t, bv.Info.BlockVolume.Password == "clear-text-password")
+
+	um := &BlockVolumeEntry{}
+	err = um.Unmarshal(buffer)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(bv, um))
+
+	// without a key the sealed value is kept as-is
+	DbSecretBox = nil
+	um = &BlockVolumeEntry{}
+	err = um.Unmarshal(buffer)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, utils.IsSealed(um.Info.BlockVolume.Password))
+
+	// and with the wrong key it cannot be loaded
+	DbSecretBox, err = utils.NewSecretBox("other secret", testSecretSalt)
+	tests.Assert(t, err == nil)
+	um = &BlockVolumeEntry{}
+	err = um.Unmarshal(buffer)
+	tests.Assert(t, err != nil)
+}
+
+func TestResealBlockVolumeCredentials(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	// Save an entry before a key is configured
+	bv := createSampleBlockVolumeEntry(10)
+	bv.Info.BlockVolume.Password = "clear-text-password"
+	err := app.db.Update(func(tx wdb.Tx) error {
+		return bv.Save(tx)
+	})
+	tests.Assert(t, err == nil)
+
+	box, err := utils.NewSecretBox("my secret", testSecretSalt)
+	tests.Assert(t, err == nil)
+	defer tests.Patch(&DbSecretBox, box).Restore()
+
+	err = app.db.Update(func(tx wdb.Tx) error {
+		return resealBlockVolumeCredentials(tx, nil, box)
+	})
+	tests.Assert(t, err == nil)
+
+	err = app.db.View(func(tx wdb.Tx) error {
+		raw := tx.Bucket([]byte(BOLTDB_BUCKET_BLOCKVOLUME)).Get([]byte(bv.Info.Id))
+		tests.Assert(t, !bytes.Contains(raw, []byte("clear-text-password")))
+
+		entry, err := NewBlockVolumeEntryFromId(tx, bv.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.Info.BlockVolume.Password == "clear-text-password")
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
 func TestBlockVolumeEntryFromIdNotFound(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
@@ -135,7 +213,7 @@ func TestBlockVolumeEntryFromIdNotFound(t *testing.T) {
 	defer app.Close()
 
 	// Test for ID not found
-	err := app.db.View(func(tx *bolt.Tx) error {
+	err := app.db.View(func(tx wdb.Tx) error {
 		_, err := NewBlockVolumeEntryFromId(tx, "123")
 		return err
 	})
@@ -155,14 +233,14 @@ func TestBlockVolumeEntryFromId(t *testing.T) {
 	bv := createSampleBlockVolumeEntry(1024)
 
 	// Save in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return bv.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	// Load from database
 	var entry *BlockVolumeEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		entry, err = NewBlockVolumeEntryFromId(tx, bv.Info.Id)
 		return err
@@ -184,14 +262,14 @@ func TestBlockVolumeEntrySaveDelete(t *testing.T) {
 	bv := createSampleBlockVolumeEntry(1024)
 
 	// Save in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return bv.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	// Delete entry which has devices
 	var entry *BlockVolumeEntry
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		var err error
 		entry, err = NewBlockVolumeEntryFromId(tx, bv.Info.Id)
 		if err != nil {
@@ -209,7 +287,7 @@ func TestBlockVolumeEntrySaveDelete(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Check volume has been deleted and is not in db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		entry, err = NewBlockVolumeEntryFromId(tx, bv.Info.Id)
 		if err != nil {
@@ -233,14 +311,14 @@ func TestNewBlockVolumeEntryNewInfoResponse(t *testing.T) {
 	bv := createSampleBlockVolumeEntry(1024)
 
 	// Save in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return bv.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	// Retrieve info response
 	var info *api.BlockVolumeInfoResponse
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		volume, err := NewBlockVolumeEntryFromId(tx, bv.Info.Id)
 		if err != nil {
 			return err
@@ -275,7 +353,7 @@ func TestBlockVolumeEntryCreateMissingCluster(t *testing.T) {
 	bv.Info.Clusters = []string{}
 
 	// Save in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return bv.Save(tx)
 	})
 	tests.Assert(t, err == nil)
@@ -314,7 +392,7 @@ func TestBlockVolumeEntryDestroy(t *testing.T) {
 
 	// Destroy the block hosting volume
 	var vol *VolumeEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		vol, err = NewVolumeEntryFromId(tx, bv.Info.BlockHostingVolume)
 		tests.Assert(t, err == nil)
@@ -329,7 +407,7 @@ func TestBlockVolumeEntryDestroy(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Check database volume does not exist
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 
 		// Check that all devices have no used data
 		devices, err := DeviceList(tx)
@@ -351,7 +429,7 @@ func TestBlockVolumeEntryDestroy(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Check that the devices have no bricks
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		devices, err := DeviceList(tx)
 		if err != nil {
 			return err
@@ -370,7 +448,7 @@ func TestBlockVolumeEntryDestroy(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Check that the cluster has no volumes
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		clusters, err := ClusterList(tx)
 		if err != nil {
 			return err
@@ -10,6 +10,8 @@
 package glusterfs
 
 import (
+	"context"
+
 	"github.com/chinacoolhacker/heketi/executors"
 	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
@@ -22,23 +24,40 @@ const (
 	CREATOR_DESTROY
 )
 
-func createDestroyConcurrently(db wdb.RODB,
+func createDestroyConcurrently(ctx context.Context,
+	db wdb.RODB,
 	executor executors.Executor,
 	brick_entries []*BrickEntry,
 	create_type CreateType) error {
 
 	sg := utils.NewStatusGroup()
 
+	progress := operationProgress(ctx)
+	if create_type == CREATOR_CREATE {
+		progress.StartStep("bricks created", len(brick_entries))
+	} else {
+		progress.StartStep("bricks destroyed", len(brick_entries))
+	}
+
 	// Create a goroutine for each brick
 	for _, brick := range brick_entries {
 		sg.Add(1)
 		go func(b *BrickEntry) {
 			defer sg.Done()
+			if err := ctx.Err(); err != nil {
+				sg.Err(err)
+				return
+			}
+			var err error
 			if create_type == CREATOR_CREATE {
-				sg.Err(b.Create(db, executor))
+				err = b.Create(db, executor)
 			} else {
-				sg.Err(b.Destroy(db, executor))
+				err = b.Destroy(db, executor)
+			}
+			if err == nil {
+				progress.Advance()
 			}
+			sg.Err(err)
 		}(brick)
 	}
 
@@ -47,19 +66,28 @@ func createDestroyConcurrently(db wdb.RODB,
 	err := sg.Result()
 	if err != nil {
 		logger.Err(err)
-
-		// Destroy all bricks and cleanup
-		if create_type == CREATOR_CREATE {
-			createDestroyConcurrently(db, executor, brick_entries, CREATOR_DESTROY)
-		}
 	}
 	return err
 }
 
-func CreateBricks(db wdb.RODB, executor executors.Executor, brick_entries []*BrickEntry) error {
-	return createDestroyConcurrently(db, executor, brick_entries, CREATOR_CREATE)
+// CreateBricks creates the bricks concurrently. No brick is created
+// once ctx is done, and all the bricks are destroyed if any of them
+// failed to be created. The bricks created are reported to the
+// progress of the operation carried by ctx.
+func CreateBricks(ctx context.Context, db wdb.RODB, executor executors.Executor, brick_entries []*BrickEntry) error {
+	err := createDestroyConcurrently(ctx,
+		db, executors.WithContext(ctx, executor), brick_entries, CREATOR_CREATE)
+	if err != nil {
+		// Destroy all bricks and cleanup, even if the creation
+		// was cancelled
+		dctx := detachContext(ctx)
+		createDestroyConcurrently(dctx,
+			db, executors.WithContext(dctx, executor), brick_entries, CREATOR_DESTROY)
+	}
+	return err
 }
 
 func DestroyBricks(db wdb.RODB, executor executors.Executor, brick_entries []*BrickEntry) error {
-	return createDestroyConcurrently(db, executor, brick_entries, CREATOR_DESTROY)
+	return createDestroyConcurrently(context.Background(),
+		db, executor, brick_entries, CREATOR_DESTROY)
 }
@@ -13,7 +13,6 @@ import (
 	"bytes"
 	"encoding/gob"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
 	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
@@ -29,7 +28,7 @@ type BrickEntry struct {
 	Pending          PendingItem
 }
 
-func BrickList(tx *bolt.Tx) ([]string, error) {
+func BrickList(tx wdb.Tx) ([]string, error) {
 
 	list := EntryKeys(tx, BOLTDB_BUCKET_BRICK)
 	if list == nil {
@@ -66,7 +65,7 @@ func NewBrickEntry(size, tpsize, poolMetadataSize uint64,
 	return entry
 }
 
-func NewBrickEntryFromId(tx *bolt.Tx, id string) (*BrickEntry, error) {
+func NewBrickEntryFromId(tx wdb.Tx, id string) (*BrickEntry, error) {
 	godbc.Require(tx != nil)
 
 	entry := &BrickEntry{}
@@ -91,18 +90,18 @@ func (b *BrickEntry) Id() string {
 	return b.Info.Id
 }
 
-func (b *BrickEntry) Save(tx *bolt.Tx) error {
+func (b *BrickEntry) Save(tx wdb.Tx) error {
 	godbc.Require(tx != nil)
 	godbc.Require(len(b.Info.Id) > 0)
 
 	return EntrySave(tx, b, b.Info.Id)
 }
 
-func (b *BrickEntry) Delete(tx *bolt.Tx) error {
+func (b *BrickEntry) Delete(tx wdb.Tx) error {
 	return EntryDelete(tx, b, b.Info.Id)
 }
 
-func (b *BrickEntry) NewInfoResponse(tx *bolt.Tx) (*api.BrickInfo, error) {
+func (b *BrickEntry) NewInfoResponse(tx wdb.Tx) (*api.BrickInfo, error) {
 	info := &api.BrickInfo{}
 	*info = b.Info
 
@@ -135,7 +134,7 @@ func (b *BrickEntry) Create(db wdb.RODB, executor executors.Executor) error {
 
 	// Get node hostname
 	var host string
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx wdb.Tx) error {
 		node, err := NewNodeEntryFromId(tx, b.Info.NodeId)
 		if err != nil {
 			return err
@@ -178,7 +177,7 @@ func (b *BrickEntry) Destroy(db wdb.RODB, executor executors.Executor) error {
 
 	// Get node hostname
 	var host string
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx wdb.Tx) error {
 		node, err := NewNodeEntryFromId(tx, b.Info.NodeId)
 		if err != nil {
 			return err
@@ -216,7 +215,7 @@ func (b *BrickEntry) DestroyCheck(db wdb.RODB, executor executors.Executor) erro
 
 	// Get node hostname
 	var host string
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx wdb.Tx) error {
 		node, err := NewNodeEntryFromId(tx, b.Info.NodeId)
 		if err != nil {
 			return err
@@ -246,7 +245,7 @@ func (b *BrickEntry) TotalSize() uint64 {
 	return b.TpSize + b.PoolMetadataSize
 }
 
-func BrickEntryUpgrade(tx *bolt.Tx) error {
+func BrickEntryUpgrade(tx wdb.Tx) error {
 	err := addVolumeIdInBrickEntry(tx)
 	if err != nil {
 		return err
@@ -254,7 +253,7 @@ func BrickEntryUpgrade(tx *bolt.Tx) error {
 	return nil
 }
 
-func addVolumeIdInBrickEntry(tx *bolt.Tx) error {
+func addVolumeIdInBrickEntry(tx wdb.Tx) error {
 	clusters, err := ClusterList(tx)
 	if err != nil {
 		return err
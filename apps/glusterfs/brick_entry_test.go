@@ -15,8 +15,8 @@ import (
 	"reflect"
 	"testing"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/heketi/tests"
 )
@@ -73,7 +73,7 @@ func TestNewBrickEntryFromIdNotFound(t *testing.T) {
 	defer app.Close()
 
 	// Test for ID not found
-	err := app.db.View(func(tx *bolt.Tx) error {
+	err := app.db.View(func(tx wdb.Tx) error {
 		_, err := NewBrickEntryFromId(tx, "123")
 		return err
 	})
@@ -93,13 +93,13 @@ func TestNewBrickEntryFromId(t *testing.T) {
 	b := NewBrickEntry(10, 20, 5, "abc", "def", 0, "ghi")
 
 	// Save element in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return b.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	var brick *BrickEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		brick, err = NewBrickEntryFromId(tx, b.Info.Id)
 		return err
@@ -121,14 +121,14 @@ func TestNewBrickEntrySaveDelete(t *testing.T) {
 	b := NewBrickEntry(10, 20, 5, "abc", "def", 1000, "ghi")
 
 	// Save element in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return b.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	// Delete entry which has devices
 	var brick *BrickEntry
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		var err error
 		brick, err = NewBrickEntryFromId(tx, b.Info.Id)
 		if err != nil {
@@ -146,7 +146,7 @@ func TestNewBrickEntrySaveDelete(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Check brick has been deleted and is not in db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		brick, err = NewBrickEntryFromId(tx, b.Info.Id)
 		return err
@@ -166,13 +166,13 @@ func TestNewBrickEntryNewInfoResponse(t *testing.T) {
 	b := NewBrickEntry(10, 20, 5, "abc", "def", 1000, "ghi")
 
 	// Save element in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return b.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	var info *api.BrickInfo
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		brick, err := NewBrickEntryFromId(tx, b.Id())
 		if err != nil {
 			return err
@@ -201,7 +201,7 @@ func TestBrickEntryDestroyCheck(t *testing.T) {
 	n.Info.Hostnames.Storage = []string{"storage"}
 
 	// Save element in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		err := n.Save(tx)
 		tests.Assert(t, err == nil)
 		return b.Save(tx)
@@ -249,7 +249,7 @@ func TestBrickEntryCreate(t *testing.T) {
 	n.Info.Hostnames.Storage = []string{"storage"}
 
 	// Save element in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		err := n.Save(tx)
 		tests.Assert(t, err == nil)
 		return b.Save(tx)
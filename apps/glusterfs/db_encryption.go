@@ -0,0 +1,213 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+)
+
+// Sensitive fields of db entries are encrypted with a random data key.
+// The data key itself is stored in the db, sealed with a key encryption
+// key derived with scrypt from the db encryption key given by the
+// administrator and a random salt. The salt is stored in front of the
+// sealed data key, separated by a colon. Changing the db encryption key
+// therefore only needs the data key to be sealed again, not every entry.
+
+const (
+	DB_DATA_KEY = "DB_DATA_KEY"
+)
+
+var (
+	// Seals sensitive entry fields in the db. Nil if the db is not encrypted.
+	DbSecretBox *utils.SecretBox
+
+	ErrDbKeyMissing = errors.New(
+		"db is encrypted but no db encryption key was given")
+	ErrDbKeyIncorrect = errors.New("db encryption key is incorrect")
+)
+
+// openDataKey returns the data key of the db, opened with the given db
+// encryption key. Nil is returned if the db is not encrypted.
+func openDataKey(tx wdb.Tx, key string) ([]byte, error) {
+	entry, err := NewDbAttributeEntryFromKey(tx, DB_DATA_KEY)
+	if err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		return nil, ErrDbKeyMissing
+	}
+	parts := strings.SplitN(entry.Value, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Unable to decode db data key: missing salt")
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode db data key salt: %v", err)
+	}
+	kek, err := utils.NewSecretBox(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := kek.Open(parts[1])
+	if err == utils.ErrSealedCorrupt {
+		return nil, ErrDbKeyIncorrect
+	} else if err != nil {
+		return nil, err
+	}
+	datakey, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode db data key: %v", err)
+	}
+
+	return datakey, nil
+}
+
+// loadDataKey returns a box for the data key of the db, opened with the
+// given db encryption key. Nil is returned if the db is not encrypted.
+func loadDataKey(tx wdb.Tx, key string) (*utils.SecretBox, error) {
+	datakey, err := openDataKey(tx, key)
+	if err != nil || datakey == nil {
+		return nil, err
+	}
+
+	return utils.NewSecretBoxFromKey(datakey)
+}
+
+// saveDataKey seals the data key with the given db encryption key and
+// a new salt and stores it in the db.
+func saveDataKey(tx wdb.Tx, datakey []byte, key string) error {
+	salt, err := utils.NewSecretSalt()
+	if err != nil {
+		return err
+	}
+	kek, err := utils.NewSecretBox(key, salt)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := kek.Seal(base64.StdEncoding.EncodeToString(datakey))
+	if err != nil {
+		return err
+	}
+
+	entry := NewDbAttributeEntry()
+	entry.Key = DB_DATA_KEY
+	entry.Value = base64.StdEncoding.EncodeToString(salt) + ":" + sealed
+	return entry.Save(tx)
+}
+
+// newDataKey creates a data key for a db that is not yet encrypted,
+// stores it sealed with the given db encryption key and encrypts the
+// sensitive fields of the existing entries.
+func newDataKey(tx wdb.Tx, key string) (*utils.SecretBox, error) {
+	datakey, err := utils.NewSecretKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := saveDataKey(tx, datakey, key); err != nil {
+		return nil, err
+	}
+
+	box, err := utils.NewSecretBoxFromKey(datakey)
+	if err != nil {
+		return nil, err
+	}
+	if err := resealBlockVolumeCredentials(tx, nil, box); err != nil {
+		return nil, err
+	}
+
+	return box, nil
+}
+
+// setupDbEncryption returns the box for the data key of the db. If the db
+// is not encrypted yet and a db encryption key is given, a new data key
+// is created and the sensitive fields of existing entries are encrypted.
+func setupDbEncryption(tx wdb.Tx, key string) (*utils.SecretBox, error) {
+	box, err := loadDataKey(tx, key)
+	if err != nil {
+		return nil, err
+	}
+	if box != nil || key == "" {
+		return box, nil
+	}
+
+	logger.Info("Encrypting sensitive fields in the db")
+	return newDataKey(tx, key)
+}
+
+// DbRekey changes the db encryption key of an offline db. The data key is
+// sealed again with the new key, so the entries themselves are not
+// rewritten. If the db is not encrypted yet oldKey must be empty and the
+// db gets encrypted. If decrypt is true the encryption is removed from
+// the db instead and newKey is ignored.
+func DbRekey(dbfile string, oldKey string, newKey string, decrypt bool, debug bool) error {
+	if debug {
+		logger.SetLevel(utils.LEVEL_DEBUG)
+	}
+	if newKey == "" && !decrypt {
+		return fmt.Errorf("Please provide a new db encryption key")
+	}
+
+	db, err := wdb.Open("", dbfile, false)
+	if err != nil {
+		return fmt.Errorf("Unable to open database: %v", err)
+	}
+	defer db.Close()
+
+	return db.Update(func(tx wdb.Tx) error {
+		datakey, err := openDataKey(tx, oldKey)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case decrypt && datakey == nil:
+			logger.Info("db is not encrypted")
+			return nil
+
+		case decrypt:
+			logger.Debug("removing encryption from db")
+			box, err := utils.NewSecretBoxFromKey(datakey)
+			if err != nil {
+				return err
+			}
+			if err := resealBlockVolumeCredentials(tx, box, nil); err != nil {
+				return err
+			}
+			entry, err := NewDbAttributeEntryFromKey(tx, DB_DATA_KEY)
+			if err != nil {
+				return err
+			}
+			return entry.Delete(tx)
+
+		case datakey == nil:
+			if oldKey != "" {
+				return fmt.Errorf("db is not encrypted, no old key is needed")
+			}
+			logger.Debug("encrypting db")
+			_, err := newDataKey(tx, newKey)
+			return err
+
+		default:
+			logger.Debug("sealing db data key with the new key")
+			return saveDataKey(tx, datakey, newKey)
+		}
+	})
+}
@@ -0,0 +1,259 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+var testSecretSalt = []byte("0123456789abcdef")
+
+func newTestAppWithDbKey(dbfile string, key string) *App {
+	appConfig := bytes.NewBuffer([]byte(`{
+		"glusterfs" : {
+			"executor" : "mock",
+			"allocator" : "simple",
+			"db" : "` + dbfile + `",
+			"db_backend" : "` + TestDbBackend() + `",
+			"db_encryption_key" : "` + key + `"
+		}
+	}`))
+	return NewApp(appConfig)
+}
+
+func saveTestBlockVolume(t *testing.T, app *App, password string) *BlockVolumeEntry {
+	bv := createSampleBlockVolumeEntry(10)
+	bv.Info.BlockVolume.Password = password
+	err := app.db.Update(func(tx wdb.Tx) error {
+		return bv.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return bv
+}
+
+func rawBlockVolume(t *testing.T, dbfile string, id string) []byte {
+	db, err := wdb.Open("", dbfile, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer db.Close()
+
+	var raw []byte
+	err = db.View(func(tx wdb.Tx) error {
+		v := tx.Bucket([]byte(BOLTDB_BUCKET_BLOCKVOLUME)).Get([]byte(id))
+		raw = append(raw, v...)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return raw
+}
+
+func checkBlockVolumePassword(t *testing.T, app *App, id string, password string) {
+	err := app.db.View(func(tx wdb.Tx) error {
+		entry, err := NewBlockVolumeEntryFromId(tx, id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, entry.Info.BlockVolume.Password == password,
+			"expected", password, "got:", entry.Info.BlockVolume.Password)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestDbEncryptionNewApp(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	defer tests.Patch(&DbSecretBox, DbSecretBox).Restore()
+
+	// entries saved before the db is encrypted
+	app := newTestAppWithDbKey(tmpfile, "")
+	tests.Assert(t, app != nil)
+	tests.Assert(t, DbSecretBox == nil)
+	bv := saveTestBlockVolume(t, app, "clear-text-password")
+	app.Close()
+	raw := rawBlockVolume(t, tmpfile, bv.Info.Id)
+	tests.Assert(t, bytes.Contains(raw, []byte("clear-text-password")))
+
+	// are encrypted once a key is configured
+	app = newTestAppWithDbKey(tmpfile, "my secret")
+	tests.Assert(t, app != nil)
+	tests.Assert(t, DbSecretBox != nil)
+	checkBlockVolumePassword(t, app, bv.Info.Id, "clear-text-password")
+	bv2 := saveTestBlockVolume(t, app, "another-password")
+	app.Close()
+	raw = rawBlockVolume(t, tmpfile, bv.Info.Id)
+	tests.Assert(t, !bytes.Contains(raw, []byte("clear-text-password")))
+	raw = rawBlockVolume(t, tmpfile, bv2.Info.Id)
+	tests.Assert(t, !bytes.Contains(raw, []byte("another-password")))
+
+	// the app refuses to start without the key or with the wrong key
+	app = newTestAppWithDbKey(tmpfile, "")
+	tests.Assert(t, app == nil)
+	app = newTestAppWithDbKey(tmpfile, "other secret")
+	tests.Assert(t, app == nil)
+
+	// the key can also be given in the environment
+	os.Setenv("HEKETI_DB_ENCRYPTION_KEY", "my secret")
+	defer os.Unsetenv("HEKETI_DB_ENCRYPTION_KEY")
+	app = newTestAppWithDbKey(tmpfile, "")
+	tests.Assert(t, app != nil)
+	checkBlockVolumePassword(t, app, bv2.Info.Id, "another-password")
+	app.Close()
+}
+
+func rawDataKey(t *testing.T, dbfile string) string {
+	db, err := wdb.Open("", dbfile, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer db.Close()
+
+	var value string
+	err = db.View(func(tx wdb.Tx) error {
+		entry, err := NewDbAttributeEntryFromKey(tx, DB_DATA_KEY)
+		if err != nil {
+			return err
+		}
+		value = entry.Value
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return value
+}
+
+func TestDbDataKeySalt(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	defer tests.Patch(&DbSecretBox, DbSecretBox).Restore()
+
+	app := newTestAppWithDbKey(tmpfile, "my secret")
+	tests.Assert(t, app != nil)
+	app.Close()
+
+	// the salt is stored with the sealed data key
+	before := rawDataKey(t, tmpfile)
+	parts := strings.SplitN(before, ":", 2)
+	tests.Assert(t, len(parts) == 2, "expected salt, got:", before)
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(salt) == utils.SecretSaltSize)
+	tests.Assert(t, utils.IsSealed(parts[1]))
+
+	// sealing again with the same key uses a new salt
+	err = DbRekey(tmpfile, "my secret", "my secret", false, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	after := rawDataKey(t, tmpfile)
+	tests.Assert(t, strings.SplitN(after, ":", 2)[0] != parts[0])
+
+	app = newTestAppWithDbKey(tmpfile, "my secret")
+	tests.Assert(t, app != nil)
+	app.Close()
+}
+
+func TestDbRekey(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	defer tests.Patch(&DbSecretBox, DbSecretBox).Restore()
+
+	app := newTestAppWithDbKey(tmpfile, "key one")
+	tests.Assert(t, app != nil)
+	bv := saveTestBlockVolume(t, app, "clear-text-password")
+	app.Close()
+	before := rawBlockVolume(t, tmpfile, bv.Info.Id)
+
+	// the old key must be correct
+	err := DbRekey(tmpfile, "other key", "key two", false, false)
+	tests.Assert(t, err == ErrDbKeyIncorrect, "expected ErrDbKeyIncorrect, got:", err)
+	err = DbRekey(tmpfile, "", "key two", false, false)
+	tests.Assert(t, err == ErrDbKeyMissing, "expected ErrDbKeyMissing, got:", err)
+
+	err = DbRekey(tmpfile, "key one", "key two", false, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// only the data key is sealed again, the entries are untouched
+	after := rawBlockVolume(t, tmpfile, bv.Info.Id)
+	tests.Assert(t, bytes.Equal(before, after))
+
+	app = newTestAppWithDbKey(tmpfile, "key one")
+	tests.Assert(t, app == nil)
+	app = newTestAppWithDbKey(tmpfile, "key two")
+	tests.Assert(t, app != nil)
+	checkBlockVolumePassword(t, app, bv.Info.Id, "clear-text-password")
+	app.Close()
+
+	// remove the encryption
+	err = DbRekey(tmpfile, "key two", "", true, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	raw := rawBlockVolume(t, tmpfile, bv.Info.Id)
+	tests.Assert(t, bytes.Contains(raw, []byte("clear-text-password")))
+
+	app = newTestAppWithDbKey(tmpfile, "")
+	tests.Assert(t, app != nil)
+	checkBlockVolumePassword(t, app, bv.Info.Id, "clear-text-password")
+	app.Close()
+
+	// and encrypt the db again
+	err = DbRekey(tmpfile, "key two", "key three", false, false)
+	tests.Assert(t, err != nil)
+	err = DbRekey(tmpfile, "", "key three", false, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	raw = rawBlockVolume(t, tmpfile, bv.Info.Id)
+	tests.Assert(t, !bytes.Contains(raw, []byte("clear-text-password")))
+
+	app = newTestAppWithDbKey(tmpfile, "key three")
+	tests.Assert(t, app != nil)
+	checkBlockVolumePassword(t, app, bv.Info.Id, "clear-text-password")
+	app.Close()
+}
+
+func TestDbDumpCreateEncrypted(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	defer tests.Patch(&DbSecretBox, DbSecretBox).Restore()
+
+	app := newTestAppWithDbKey(tmpfile, "my secret")
+	tests.Assert(t, app != nil)
+	bv := saveTestBlockVolume(t, app, "clear-text-password")
+	app.Close()
+
+	// dumping needs the key
+	jsonfile := tests.Tempfile()
+	defer os.Remove(jsonfile)
+	os.Remove(jsonfile)
+	err := DbDump(jsonfile, tmpfile, "", false)
+	tests.Assert(t, err != nil)
+	os.Remove(jsonfile)
+
+	err = DbDump(jsonfile, tmpfile, "my secret", false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	dump, err := ioutil.ReadFile(jsonfile)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, bytes.Contains(dump, []byte("clear-text-password")))
+	tests.Assert(t, !bytes.Contains(dump, []byte(DB_DATA_KEY)))
+
+	// a db created from the dump with a key is encrypted again
+	newdbfile := tests.Tempfile()
+	defer os.Remove(newdbfile)
+	os.Remove(newdbfile)
+	err = DbCreate(jsonfile, newdbfile, TestDbBackend(), "new secret", false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	raw := rawBlockVolume(t, newdbfile, bv.Info.Id)
+	tests.Assert(t, len(raw) > 0)
+	tests.Assert(t, !bytes.Contains(raw, []byte("clear-text-password")))
+
+	app = newTestAppWithDbKey(newdbfile, "new secret")
+	tests.Assert(t, app != nil)
+	checkBlockVolumePassword(t, app, bv.Info.Id, "clear-text-password")
+	app.Close()
+}
@@ -10,7 +10,7 @@
 package glusterfs
 
 import (
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 )
@@ -19,7 +19,7 @@ const (
 	DB_GENERATION_ID = "DB_GENERATION_ID"
 )
 
-func initializeBuckets(tx *bolt.Tx) error {
+func initializeBuckets(tx wdb.Tx) error {
 	// Create Cluster Bucket
 	_, err := tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_CLUSTER))
 	if err != nil {
@@ -73,12 +73,30 @@ func initializeBuckets(tx *bolt.Tx) error {
 		return err
 	}
 
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_ASYNC_OPS))
+	if err != nil {
+		logger.LogError("Unable to create async ops bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_ASYNC_OPS_KEYS))
+	if err != nil {
+		logger.LogError("Unable to create async op keys bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_IDEMPOTENCY_KEYS))
+	if err != nil {
+		logger.LogError("Unable to create idempotency keys bucket in DB")
+		return err
+	}
+
 	return nil
 }
 
 // UpgradeDB runs all upgrade routines in order to to update the DB
 // to the latest "schemas" and data.
-func UpgradeDB(tx *bolt.Tx) error {
+func UpgradeDB(tx wdb.Tx) error {
 
 	err := ClusterEntryUpgrade(tx)
 	if err != nil {
@@ -125,7 +143,7 @@ func UpgradeDB(tx *bolt.Tx) error {
 	return nil
 }
 
-func upgradeDBGenerationID(tx *bolt.Tx) error {
+func upgradeDBGenerationID(tx wdb.Tx) error {
 	_, err := NewDbAttributeEntryFromKey(tx, DB_GENERATION_ID)
 	switch err {
 	case ErrNotFound:
@@ -137,14 +155,14 @@ func upgradeDBGenerationID(tx *bolt.Tx) error {
 	}
 }
 
-func recordNewDBGenerationID(tx *bolt.Tx) error {
+func recordNewDBGenerationID(tx wdb.Tx) error {
 	entry := NewDbAttributeEntry()
 	entry.Key = DB_GENERATION_ID
 	entry.Value = utils.GenUUID()
 	return entry.Save(tx)
 }
 
-func DeleteBricksWithEmptyPath(db *bolt.DB, all bool, clusterIDs []string, nodeIDs []string, deviceIDs []string, debug bool) error {
+func DeleteBricksWithEmptyPath(db wdb.DB, all bool, clusterIDs []string, nodeIDs []string, deviceIDs []string, debug bool) error {
 
 	if debug {
 		logger.SetLevel(utils.LEVEL_DEBUG)
@@ -166,7 +184,7 @@ func DeleteBricksWithEmptyPath(db *bolt.DB, all bool, clusterIDs []string, nodeI
 		}
 	}
 
-	err := db.Update(func(tx *bolt.Tx) error {
+	err := db.Update(func(tx wdb.Tx) error {
 		if true == all {
 			logger.Debug("deleting all bricks with empty path")
 			clusters, err := ClusterList(tx)
@@ -13,7 +13,7 @@ import (
 	"os"
 	"testing"
 
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/heketi/tests"
@@ -49,7 +49,7 @@ func TestDeleteBricksWithEmptyPath(t *testing.T) {
 	// grab a device that has bricks
 	var d *DeviceEntry
 	var newbrick *BrickEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		dl, err := DeviceList(tx)
 		if err != nil {
 			return err
@@ -79,14 +79,14 @@ func TestDeleteBricksWithEmptyPath(t *testing.T) {
 		newbrick = d.NewBrickEntry(102400, 1, 2000, utils.GenUUID())
 		newbrick.Info.Path = ""
 		d.BrickAdd(newbrick.Id())
-		err = app.db.Update(func(tx *bolt.Tx) error {
+		err = app.db.Update(func(tx wdb.Tx) error {
 			err = d.Save(tx)
 			tests.Assert(t, err == nil)
 			return newbrick.Save(tx)
 		})
 		tests.Assert(t, err == nil)
 	}
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -98,7 +98,7 @@ func TestDeleteBricksWithEmptyPath(t *testing.T) {
 	err = DeleteBricksWithEmptyPath(app.db, true, []string{}, []string{}, []string{}, true)
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -114,14 +114,14 @@ func TestDeleteBricksWithEmptyPath(t *testing.T) {
 		newbrick = d.NewBrickEntry(102400, 1, 2000, utils.GenUUID())
 		newbrick.Info.Path = ""
 		d.BrickAdd(newbrick.Id())
-		err = app.db.Update(func(tx *bolt.Tx) error {
+		err = app.db.Update(func(tx wdb.Tx) error {
 			err = d.Save(tx)
 			tests.Assert(t, err == nil)
 			return newbrick.Save(tx)
 		})
 		tests.Assert(t, err == nil)
 	}
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -132,7 +132,7 @@ func TestDeleteBricksWithEmptyPath(t *testing.T) {
 	err = DeleteBricksWithEmptyPath(app.db, false, []string{}, []string{}, []string{d.Info.Id}, true)
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -148,14 +148,14 @@ func TestDeleteBricksWithEmptyPath(t *testing.T) {
 		newbrick = d.NewBrickEntry(102400, 1, 2000, utils.GenUUID())
 		newbrick.Info.Path = ""
 		d.BrickAdd(newbrick.Id())
-		err = app.db.Update(func(tx *bolt.Tx) error {
+		err = app.db.Update(func(tx wdb.Tx) error {
 			err = d.Save(tx)
 			tests.Assert(t, err == nil)
 			return newbrick.Save(tx)
 		})
 		tests.Assert(t, err == nil)
 	}
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -166,7 +166,7 @@ func TestDeleteBricksWithEmptyPath(t *testing.T) {
 	err = DeleteBricksWithEmptyPath(app.db, false, []string{}, []string{d.NodeId, d.NodeId}, []string{}, true)
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -182,14 +182,14 @@ func TestDeleteBricksWithEmptyPath(t *testing.T) {
 		newbrick = d.NewBrickEntry(102400, 1, 2000, utils.GenUUID())
 		newbrick.Info.Path = ""
 		d.BrickAdd(newbrick.Id())
-		err = app.db.Update(func(tx *bolt.Tx) error {
+		err = app.db.Update(func(tx wdb.Tx) error {
 			err = d.Save(tx)
 			tests.Assert(t, err == nil)
 			return newbrick.Save(tx)
 		})
 		tests.Assert(t, err == nil)
 	}
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -197,7 +197,7 @@ func TestDeleteBricksWithEmptyPath(t *testing.T) {
 	tests.Assert(t, len(d.Bricks) == 40,
 		"expected len(d.Bricks) == 40, got:", len(d.Bricks))
 
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		nodeEntry, err = NewNodeEntryFromId(tx, d.NodeId)
 		return err
 	})
@@ -206,7 +206,7 @@ func TestDeleteBricksWithEmptyPath(t *testing.T) {
 	err = DeleteBricksWithEmptyPath(app.db, false, []string{nodeEntry.Info.ClusterId}, []string{d.NodeId}, []string{}, true)
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
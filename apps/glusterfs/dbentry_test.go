@@ -10,11 +10,10 @@
 package glusterfs
 
 import (
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/heketi/tests"
 	"os"
 	"testing"
-	"time"
 )
 
 type testDbEntry struct {
@@ -36,13 +35,13 @@ func TestEntryRegister(t *testing.T) {
 	tmpfile := tests.Tempfile()
 
 	// Setup BoltDB database
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	db, err := wdb.OpenBoltStore(tmpfile, false)
 	tests.Assert(t, err == nil)
 	defer os.Remove(tmpfile)
 
 	// Create a bucket
 	entry := &testDbEntry{}
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx wdb.Tx) error {
 
 		// Create Cluster Bucket
 		_, err := tx.CreateBucketIfNotExists([]byte(entry.BucketName()))
@@ -57,7 +56,7 @@ func TestEntryRegister(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Try to write key again
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx wdb.Tx) error {
 
 		// Save again, it should not work
 		val, err := EntryRegister(tx, entry, "mykey", []byte("myvalue"))
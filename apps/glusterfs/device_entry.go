@@ -11,11 +11,11 @@ package glusterfs
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"fmt"
 	"sort"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
 	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
@@ -36,7 +36,7 @@ type DeviceEntry struct {
 	ExtentSize uint64
 }
 
-func DeviceList(tx *bolt.Tx) ([]string, error) {
+func DeviceList(tx wdb.Tx) ([]string, error) {
 
 	list := EntryKeys(tx, BOLTDB_BUCKET_DEVICE)
 	if list == nil {
@@ -67,7 +67,7 @@ func NewDeviceEntryFromRequest(req *api.DeviceAddRequest) *DeviceEntry {
 	return device
 }
 
-func NewDeviceEntryFromId(tx *bolt.Tx, id string) (*DeviceEntry, error) {
+func NewDeviceEntryFromId(tx wdb.Tx, id string) (*DeviceEntry, error) {
 	godbc.Require(tx != nil)
 
 	entry := NewDeviceEntry()
@@ -83,7 +83,7 @@ func (d *DeviceEntry) registerKey() string {
 	return "DEVICE" + d.NodeId + d.Info.Name
 }
 
-func (d *DeviceEntry) Register(tx *bolt.Tx) error {
+func (d *DeviceEntry) Register(tx wdb.Tx) error {
 	godbc.Require(tx != nil)
 
 	val, err := EntryRegister(tx,
@@ -117,7 +117,7 @@ func (d *DeviceEntry) Register(tx *bolt.Tx) error {
 	return nil
 }
 
-func (d *DeviceEntry) Deregister(tx *bolt.Tx) error {
+func (d *DeviceEntry) Deregister(tx wdb.Tx) error {
 	godbc.Require(tx != nil)
 
 	err := EntryDelete(tx, d, d.registerKey())
@@ -140,7 +140,7 @@ func (d *DeviceEntry) BucketName() string {
 	return BOLTDB_BUCKET_DEVICE
 }
 
-func (d *DeviceEntry) Save(tx *bolt.Tx) error {
+func (d *DeviceEntry) Save(tx wdb.Tx) error {
 	godbc.Require(tx != nil)
 	godbc.Require(len(d.Info.Id) > 0)
 
@@ -159,7 +159,7 @@ func (d *DeviceEntry) ConflictString() string {
 	return fmt.Sprintf("Unable to delete device [%v] because it contains bricks", d.Info.Id)
 }
 
-func (d *DeviceEntry) Delete(tx *bolt.Tx) error {
+func (d *DeviceEntry) Delete(tx wdb.Tx) error {
 	godbc.Require(tx != nil)
 
 	// Don't delete device unless it is in failed state
@@ -179,7 +179,7 @@ func (d *DeviceEntry) Delete(tx *bolt.Tx) error {
 }
 
 func (d *DeviceEntry) modifyState(db wdb.DB, s api.EntryState) error {
-	return db.Update(func(tx *bolt.Tx) error {
+	return db.Update(func(tx wdb.Tx) error {
 		// Save state
 		d.State = s
 		// Save new state
@@ -266,7 +266,7 @@ func (d *DeviceEntry) stateCheck(s api.EntryState) error {
 	return nil
 }
 
-func (d *DeviceEntry) NewInfoResponse(tx *bolt.Tx) (*api.DeviceInfoResponse, error) {
+func (d *DeviceEntry) NewInfoResponse(tx wdb.Tx) (*api.DeviceInfoResponse, error) {
 
 	godbc.Require(tx != nil)
 
@@ -419,7 +419,7 @@ func (d *DeviceEntry) Remove(db wdb.DB,
 	}
 	// tests currently expect d to be updated to match db state
 	// this is another fairly ugly hack
-	return db.View(func(tx *bolt.Tx) error {
+	return db.View(func(tx wdb.Tx) error {
 		dbdev, err := NewDeviceEntryFromId(tx, d.Info.Id)
 		if err != nil {
 			return err
@@ -430,16 +430,23 @@ func (d *DeviceEntry) Remove(db wdb.DB,
 
 }
 
-func (d *DeviceEntry) removeBricksFromDevice(db wdb.DB,
+func (d *DeviceEntry) removeBricksFromDevice(ctx context.Context,
+	db wdb.DB,
 	executor executors.Executor,
 	allocator Allocator) (e error) {
 
 	var errBrickWithEmptyPath error = fmt.Errorf("Brick has no path")
 
 	for _, brickId := range d.Bricks {
+		// A brick that is being replaced is not interrupted, but no
+		// other brick is replaced once the operation is cancelled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		var brickEntry *BrickEntry
 		var volumeEntry *VolumeEntry
-		err := db.View(func(tx *bolt.Tx) error {
+		err := db.View(func(tx wdb.Tx) error {
 			var err error
 			brickEntry, err = NewBrickEntryFromId(tx, brickId)
 			if err != nil {
@@ -466,13 +473,13 @@ func (d *DeviceEntry) removeBricksFromDevice(db wdb.DB,
 		logger.Info("Replacing brick %v on device %v on node %v", brickEntry.Id(), d.Id(), d.NodeId)
 		err = volumeEntry.replaceBrickInVolume(db, executor, allocator, brickEntry.Id())
 		if err != nil {
-			return logger.Err(fmt.Errorf("Failed to remove device, error: %v", err))
+			return logger.Err(executors.WrapError(err, "Failed to remove device, error: %v", err))
 		}
 	}
 	return nil
 }
 
-func DeviceEntryUpgrade(tx *bolt.Tx) error {
+func DeviceEntryUpgrade(tx wdb.Tx) error {
 	return nil
 }
 
@@ -481,7 +488,7 @@ func DeviceEntryUpgrade(tx *bolt.Tx) error {
 // if any db errors were encountered.
 func PendingOperationsOnDevice(db wdb.RODB, deviceId string) (pdev bool, e error) {
 
-	e = db.View(func(tx *bolt.Tx) error {
+	e = db.View(func(tx wdb.Tx) error {
 		pb, err := MapPendingBricks(tx)
 		if err != nil {
 			return err
@@ -531,7 +538,7 @@ func markEmptyDeviceFailed(db wdb.DB, id string) error {
 // returns nil. If ErrConflict is returned the device was not
 // empty. Any other error is a database failure.
 func markDeviceFailed(db wdb.DB, id string, force bool) error {
-	return db.Update(func(tx *bolt.Tx) error {
+	return db.Update(func(tx wdb.Tx) error {
 		d, err := NewDeviceEntryFromId(tx, id)
 		if err != nil {
 			return err
@@ -544,7 +551,7 @@ func markDeviceFailed(db wdb.DB, id string, force bool) error {
 	})
 }
 
-func (d *DeviceEntry) DeleteBricksWithEmptyPath(tx *bolt.Tx) error {
+func (d *DeviceEntry) DeleteBricksWithEmptyPath(tx wdb.Tx) error {
 	godbc.Require(tx != nil)
 	var bricksToDelete []*BrickEntry
 
@@ -16,8 +16,8 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/heketi/tests"
@@ -170,7 +170,7 @@ func TestNewDeviceEntryFromIdNotFound(t *testing.T) {
 	defer app.Close()
 
 	// Test for ID not found
-	err := app.db.View(func(tx *bolt.Tx) error {
+	err := app.db.View(func(tx wdb.Tx) error {
 		_, err := NewDeviceEntryFromId(tx, "123")
 		return err
 	})
@@ -194,7 +194,7 @@ func TestDeviceEntryRegister(t *testing.T) {
 	d := NewDeviceEntryFromRequest(req)
 
 	// Register device
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		err := d.Register(tx)
 		tests.Assert(t, err == nil)
 
@@ -203,7 +203,7 @@ func TestDeviceEntryRegister(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Should not be able to register again
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := d.Register(tx)
 		tests.Assert(t, err != nil)
 
@@ -219,7 +219,7 @@ func TestDeviceEntryRegister(t *testing.T) {
 	d2 := NewDeviceEntryFromRequest(req)
 
 	// Same device on different node should work
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := d2.Register(tx)
 		tests.Assert(t, err == nil)
 
@@ -238,7 +238,7 @@ func TestDeviceEntryRegister(t *testing.T) {
 	tests.Assert(t, err == nil, err)
 
 	// Remove d
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := d.Deregister(tx)
 		tests.Assert(t, err == nil)
 
@@ -247,7 +247,7 @@ func TestDeviceEntryRegister(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Register d node again
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := d.Register(tx)
 		tests.Assert(t, err == nil)
 
@@ -273,13 +273,13 @@ func TestDeviceEntryRegisterStaleRegistration(t *testing.T) {
 	d := NewDeviceEntryFromRequest(req)
 
 	// Only register device but do not save it
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return d.Register(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	// Should be able to register again
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := d.Register(tx)
 		tests.Assert(t, err == nil)
 
@@ -288,7 +288,7 @@ func TestDeviceEntryRegisterStaleRegistration(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Should not be able to register again
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		return d.Register(tx)
 	})
 	tests.Assert(t, err != nil)
@@ -304,7 +304,7 @@ func TestDeviceEntryRegisterStaleRegistration(t *testing.T) {
 	tests.Assert(t, err == nil, err)
 
 	// Remove d
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := d.Deregister(tx)
 		tests.Assert(t, err == nil)
 
@@ -313,7 +313,7 @@ func TestDeviceEntryRegisterStaleRegistration(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Register d node again
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := d.Register(tx)
 		tests.Assert(t, err == nil)
 
@@ -344,13 +344,13 @@ func TestNewDeviceEntryFromId(t *testing.T) {
 	d.BrickAdd("def")
 
 	// Save element in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return d.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	var device *DeviceEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		device, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		if err != nil {
@@ -384,13 +384,13 @@ func TestNewDeviceEntrySaveDelete(t *testing.T) {
 	d.BrickAdd("def")
 
 	// Save element in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return d.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	var device *DeviceEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		device, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		if err != nil {
@@ -403,7 +403,7 @@ func TestNewDeviceEntrySaveDelete(t *testing.T) {
 	tests.Assert(t, reflect.DeepEqual(device, d))
 
 	// Delete device which has bricks
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		var err error
 		device, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		if err != nil {
@@ -424,7 +424,7 @@ func TestNewDeviceEntrySaveDelete(t *testing.T) {
 	device.BrickDelete("abc")
 	device.BrickDelete("def")
 	tests.Assert(t, len(device.Bricks) == 0)
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		return device.Save(tx)
 	})
 	tests.Assert(t, err == nil)
@@ -440,7 +440,7 @@ func TestNewDeviceEntrySaveDelete(t *testing.T) {
 	tests.Assert(t, err == nil, err)
 
 	// Now try to delete the device
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		var err error
 		device, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		if err != nil {
@@ -458,7 +458,7 @@ func TestNewDeviceEntrySaveDelete(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Check device has been deleted and is not in db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		device, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		if err != nil {
@@ -492,13 +492,13 @@ func TestNewDeviceEntryNewInfoResponseBadBrickIds(t *testing.T) {
 	d.BrickAdd("def")
 
 	// Save element in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return d.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	var info *api.DeviceInfoResponse
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		device, err := NewDeviceEntryFromId(tx, d.Info.Id)
 		if err != nil {
 			return err
@@ -545,7 +545,7 @@ func TestNewDeviceEntryNewInfoResponse(t *testing.T) {
 	d.BrickAdd("bbb")
 
 	// Save element in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		err := d.Save(tx)
 		if err != nil {
 			return err
@@ -556,7 +556,7 @@ func TestNewDeviceEntryNewInfoResponse(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	var info *api.DeviceInfoResponse
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		device, err := NewDeviceEntryFromId(tx, d.Info.Id)
 		if err != nil {
 			return err
@@ -653,7 +653,7 @@ func TestDeviceSetStateFailed(t *testing.T) {
 	n.DeviceAdd(d.Info.Id)
 
 	// Save in db
-	app.db.Update(func(tx *bolt.Tx) error {
+	app.db.Update(func(tx wdb.Tx) error {
 		err := c.Save(tx)
 		tests.Assert(t, err == nil)
 
@@ -729,7 +729,7 @@ func TestDeviceSetStateOfflineOnline(t *testing.T) {
 	n.DeviceAdd(d.Info.Id)
 
 	// Save in db
-	app.db.Update(func(tx *bolt.Tx) error {
+	app.db.Update(func(tx wdb.Tx) error {
 		err := c.Save(tx)
 		tests.Assert(t, err == nil)
 
@@ -786,7 +786,7 @@ func TestDeviceSetStateFailedWithBricks(t *testing.T) {
 
 	// grab a device that has bricks
 	var d *DeviceEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		dl, err := DeviceList(tx)
 		if err != nil {
 			return err
@@ -810,7 +810,7 @@ func TestDeviceSetStateFailedWithBricks(t *testing.T) {
 	tests.Assert(t, d.State == api.EntryStateOffline)
 
 	// update d from db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -830,7 +830,7 @@ func TestDeviceSetStateFailedWithBricks(t *testing.T) {
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
 	// update d from db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -868,7 +868,7 @@ func TestDeviceSetStateFailedTooFewDevices(t *testing.T) {
 
 	// grab a device that has bricks
 	var d *DeviceEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		dl, err := DeviceList(tx)
 		if err != nil {
 			return err
@@ -892,7 +892,7 @@ func TestDeviceSetStateFailedTooFewDevices(t *testing.T) {
 	tests.Assert(t, d.State == api.EntryStateOffline)
 
 	// update d from db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -914,10 +914,10 @@ func TestDeviceSetStateFailedTooFewDevices(t *testing.T) {
 		err.Error())
 }
 
-func mockVolumeInfoFromDb(db *bolt.DB, volume string) (*executors.Volume, error) {
+func mockVolumeInfoFromDb(db wdb.RODB, volume string) (*executors.Volume, error) {
 	volume = volume[4:]
 	vi := &executors.Volume{}
-	db.View(func(tx *bolt.Tx) error {
+	db.View(func(tx wdb.Tx) error {
 		bl, _ := BrickList(tx)
 		for _, id := range bl {
 			b, err := NewBrickEntryFromId(tx, id)
@@ -940,10 +940,10 @@ func mockVolumeInfoFromDb(db *bolt.DB, volume string) (*executors.Volume, error)
 	return vi, nil
 }
 
-func mockHealStatusFromDb(db *bolt.DB, volume string) (*executors.HealInfo, error) {
+func mockHealStatusFromDb(db wdb.RODB, volume string) (*executors.HealInfo, error) {
 	hi := &executors.HealInfo{}
 	volume = volume[4:]
-	db.View(func(tx *bolt.Tx) error {
+	db.View(func(tx wdb.Tx) error {
 		bl, _ := BrickList(tx)
 		for _, id := range bl {
 			b, err := NewBrickEntryFromId(tx, id)
@@ -997,7 +997,7 @@ func TestDeviceSetStateFailedWithEmptyPathBricks(t *testing.T) {
 	// and a brick to create copy of it
 	var d *DeviceEntry
 	var newbrick *BrickEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		dl, err := DeviceList(tx)
 		if err != nil {
 			return err
@@ -1021,7 +1021,7 @@ func TestDeviceSetStateFailedWithEmptyPathBricks(t *testing.T) {
 	newbrick = d.NewBrickEntry(102400, 1, 2000, utils.GenUUID())
 	newbrick.Info.Path = ""
 	d.BrickAdd(newbrick.Id())
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err = d.Save(tx)
 		tests.Assert(t, err == nil)
 		return newbrick.Save(tx)
@@ -1033,7 +1033,7 @@ func TestDeviceSetStateFailedWithEmptyPathBricks(t *testing.T) {
 	tests.Assert(t, d.State == api.EntryStateOffline)
 
 	// update d from db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -1055,7 +1055,7 @@ func TestDeviceSetStateFailedWithEmptyPathBricks(t *testing.T) {
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
 	// update d from db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
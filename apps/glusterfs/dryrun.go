@@ -0,0 +1,180 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+	"github.com/chinacoolhacker/heketi/executors/planexec"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
+)
+
+// errDryRun discards the transaction a dry run was made in.
+var errDryRun = errors.New("dry run")
+
+// dryRunFlow performs the changes of a request using db and executor.
+type dryRunFlow func(db wdb.DB, executor executors.Executor) error
+
+// dryRunDB runs all transactions of a dry run in the single write
+// transaction it was made in. The transactions are serialized as the
+// operations may use the db from several goroutines.
+type dryRunDB struct {
+	lock sync.Mutex
+	tx   wdb.Tx
+}
+
+func (d *dryRunDB) View(cb func(wdb.Tx) error) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return cb(d.tx)
+}
+
+func (d *dryRunDB) Update(cb func(wdb.Tx) error) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return cb(d.tx)
+}
+
+// dryRunRequested returns true if the client asked to only be told
+// what the request would do.
+func dryRunRequested(r *http.Request) bool {
+	dryrun, err := strconv.ParseBool(r.URL.Query().Get("dryrun"))
+	return err == nil && dryrun
+}
+
+// planConfig returns the command configuration of the executor the
+// commands of a dry run are planned for.
+func (a *App) planConfig() *cmdexec.CmdConfig {
+	switch a.conf.Executor {
+	case "kube", "kubernetes":
+		return &a.conf.KubeConfig.CmdConfig
+	case "local":
+		return &a.conf.LocalConfig.CmdConfig
+	case "gd2", "glusterd2":
+		return &a.conf.Gd2Config.CmdConfig
+	case "agent":
+		return &a.conf.AgentConfig.CmdConfig
+	}
+	return &a.conf.SshConfig.CmdConfig
+}
+
+// dryRun performs flow in a transaction that is thrown away and with
+// an executor that plans the commands to run on the nodes instead of
+// running them. It returns the bricks the flow created or deleted and
+// the commands it would have run.
+func (a *App) dryRun(flow dryRunFlow) (*api.DryRunResponse, error) {
+	plan := planexec.NewPlanExecutor(a.executor, a.planConfig())
+	resp := &api.DryRunResponse{
+		Bricks:   []api.DryRunBrick{},
+		Commands: []api.DryRunCommand{},
+	}
+	err := a.db.Update(func(tx wdb.Tx) error {
+		before, err := dryRunBricks(tx)
+		if err != nil {
+			return err
+		}
+		if err := flow(&dryRunDB{tx: tx}, plan); err != nil {
+			return err
+		}
+		after, err := dryRunBricks(tx)
+		if err != nil {
+			return err
+		}
+		resp.Bricks = dryRunBrickChanges(resp.Bricks,
+			before, after, api.DryRunBrickDelete)
+		resp.Bricks = dryRunBrickChanges(resp.Bricks,
+			after, before, api.DryRunBrickAdd)
+		return errDryRun
+	})
+	if err != errDryRun {
+		return nil, err
+	}
+	for _, c := range plan.Commands() {
+		resp.Commands = append(resp.Commands, api.DryRunCommand{
+			Host:    c.Host,
+			Command: c.Command,
+		})
+	}
+	return resp, nil
+}
+
+// dryRunBricks returns all bricks of the db, with the manage hostname
+// of their node, by id.
+func dryRunBricks(tx wdb.Tx) (map[string]api.DryRunBrick, error) {
+	ids, err := BrickList(tx)
+	if err != nil {
+		return nil, err
+	}
+	hosts := map[string]string{}
+	bricks := map[string]api.DryRunBrick{}
+	for _, id := range ids {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		host, ok := hosts[brick.Info.NodeId]
+		if !ok {
+			node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+			if err != nil {
+				return nil, err
+			}
+			host = node.ManageHostName()
+			hosts[brick.Info.NodeId] = host
+		}
+		bricks[id] = api.DryRunBrick{
+			BrickInfo: brick.Info,
+			Host:      host,
+		}
+	}
+	return bricks, nil
+}
+
+// dryRunBrickChanges appends to changes the bricks of from missing in
+// to, in brick id order.
+func dryRunBrickChanges(changes []api.DryRunBrick,
+	from, to map[string]api.DryRunBrick, change string) []api.DryRunBrick {
+
+	ids := []string{}
+	for id := range from {
+		if _, ok := to[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		brick := from[id]
+		brick.Change = change
+		changes = append(changes, brick)
+	}
+	return changes
+}
+
+// dryRunHttp responds to a request made with dryrun=true with what
+// flow would do.
+func (a *App) dryRunHttp(w http.ResponseWriter, flow dryRunFlow) {
+	resp, err := a.dryRun(flow)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
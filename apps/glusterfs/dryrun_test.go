@@ -0,0 +1,299 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+)
+
+func dryRunTestApp(t *testing.T) (*App, *httptest.Server, func()) {
+	tmpfile := tests.Tempfile()
+	app := NewTestApp(tmpfile)
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		4,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	return app, ts, func() {
+		ts.Close()
+		app.Close()
+		os.Remove(tmpfile)
+	}
+}
+
+func dryRunRequest(t *testing.T, method, url, body string) *api.DryRunResponse {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	tests.Assert(t, err == nil)
+	req.Header.Set("Content-Type", "application/json")
+	r, err := http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK, "got:", r.StatusCode)
+	var resp api.DryRunResponse
+	err = utils.GetJsonFromResponse(r, &resp)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return &resp
+}
+
+func dryRunChanges(resp *api.DryRunResponse, change string) int {
+	n := 0
+	for _, b := range resp.Bricks {
+		if b.Change == change {
+			n++
+		}
+	}
+	return n
+}
+
+func dryRunCommand(resp *api.DryRunResponse, command string) bool {
+	for _, c := range resp.Commands {
+		if strings.HasPrefix(c.Command, command) {
+			return true
+		}
+	}
+	return false
+}
+
+func dryRunPendingOps(t *testing.T, db wdb.RODB) int {
+	var n int
+	err := db.View(func(tx wdb.Tx) error {
+		ids, err := PendingOperationList(tx)
+		n = len(ids)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return n
+}
+
+func TestVolumeCreateDryRun(t *testing.T) {
+	app, ts, cleanup := dryRunTestApp(t)
+	defer cleanup()
+
+	resp := dryRunRequest(t, "POST", ts.URL+"/volumes?dryrun=true", `{
+		"size" : 100,
+		"durability" : {
+			"type" : "replicate",
+			"replicate" : {"replica" : 3}
+		}
+	}`)
+	tests.Assert(t, len(resp.Bricks) == 3, "got:", resp.Bricks)
+	tests.Assert(t, dryRunChanges(resp, api.DryRunBrickAdd) == 3)
+	for _, b := range resp.Bricks {
+		tests.Assert(t, b.Host != "" && b.Path != "", "got:", b)
+	}
+	tests.Assert(t, dryRunCommand(resp, "lvcreate"))
+	tests.Assert(t, dryRunCommand(resp, "gluster --mode=script volume create"))
+
+	// the bricks are created before the volume
+	tests.Assert(t, strings.HasPrefix(resp.Commands[0].Command, "mkdir"),
+		"got:", resp.Commands[0])
+
+	// nothing was saved
+	counts := dbCounts(t, app.db)
+	tests.Assert(t, counts == [3]int{0, 0, 0}, "got:", counts)
+	tests.Assert(t, dryRunPendingOps(t, app.db) == 0)
+	tests.Assert(t, checkDbConsistent(app.db) == nil)
+}
+
+func TestVolumeExpandDryRun(t *testing.T) {
+	app, ts, cleanup := dryRunTestApp(t)
+	defer cleanup()
+
+	v := faultTestVolume(t, app, 100)
+	before := dbCounts(t, app.db)
+
+	resp := dryRunRequest(t, "POST",
+		ts.URL+"/volumes/"+v.Info.Id+"/expand?dryrun=true",
+		`{"expand_size" : 100}`)
+	tests.Assert(t, dryRunChanges(resp, api.DryRunBrickAdd) == 3,
+		"got:", resp.Bricks)
+	tests.Assert(t, dryRunChanges(resp, api.DryRunBrickDelete) == 0)
+	tests.Assert(t, dryRunCommand(resp, "gluster --mode=script volume add-brick"))
+
+	after := dbCounts(t, app.db)
+	tests.Assert(t, before == after, "expected", before, "got:", after)
+	err := app.db.View(func(tx wdb.Tx) error {
+		vol, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, vol.Info.Size == 100, "got:", vol.Info.Size)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestVolumeDeleteDryRun(t *testing.T) {
+	app, ts, cleanup := dryRunTestApp(t)
+	defer cleanup()
+
+	v := faultTestVolume(t, app, 100)
+	before := dbCounts(t, app.db)
+
+	resp := dryRunRequest(t, "DELETE",
+		ts.URL+"/volumes/"+v.Info.Id+"?dryrun=true", "")
+	tests.Assert(t, dryRunChanges(resp, api.DryRunBrickDelete) == 3,
+		"got:", resp.Bricks)
+	tests.Assert(t, dryRunChanges(resp, api.DryRunBrickAdd) == 0)
+	tests.Assert(t, dryRunCommand(resp, "gluster --mode=script volume stop"))
+	tests.Assert(t, dryRunCommand(resp, "lvremove"))
+
+	after := dbCounts(t, app.db)
+	tests.Assert(t, before == after, "expected", before, "got:", after)
+	tests.Assert(t, dryRunPendingOps(t, app.db) == 0)
+}
+
+func TestDeviceRemoveDryRun(t *testing.T) {
+	app, ts, cleanup := dryRunTestApp(t)
+	defer cleanup()
+
+	v := faultTestVolume(t, app, 100)
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return mockVolumeInfoFromDb(app.db, volume)
+	}
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		return mockHealStatusFromDb(app.db, volume)
+	}
+	var device *DeviceEntry
+	err := app.db.Update(func(tx wdb.Tx) error {
+		brick, err := NewBrickEntryFromId(tx, v.Bricks[0])
+		if err != nil {
+			return err
+		}
+		device, err = NewDeviceEntryFromId(tx, brick.Info.DeviceId)
+		if err != nil {
+			return err
+		}
+		device.State = api.EntryStateOffline
+		return device.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	resp := dryRunRequest(t, "POST",
+		ts.URL+"/devices/"+device.Info.Id+"/state?dryrun=true",
+		`{"state" : "failed"}`)
+	removed := dryRunChanges(resp, api.DryRunBrickDelete)
+	tests.Assert(t, removed == len(device.Bricks), "got:", resp.Bricks)
+	tests.Assert(t, dryRunChanges(resp, api.DryRunBrickAdd) == removed)
+	for _, b := range resp.Bricks {
+		if b.Change == api.DryRunBrickDelete {
+			tests.Assert(t, b.DeviceId == device.Info.Id, "got:", b)
+		} else {
+			tests.Assert(t, b.DeviceId != device.Info.Id, "got:", b)
+		}
+	}
+	tests.Assert(t, dryRunCommand(resp, "gluster --mode=script volume replace-brick"))
+
+	err = app.db.View(func(tx wdb.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, device.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, d.State == api.EntryStateOffline, "got:", d.State)
+		tests.Assert(t, len(d.Bricks) == len(device.Bricks))
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, checkDbConsistent(app.db) == nil)
+}
+
+func TestNodeSetStateDryRun(t *testing.T) {
+	app, ts, cleanup := dryRunTestApp(t)
+	defer cleanup()
+
+	var node *NodeEntry
+	err := app.db.View(func(tx wdb.Tx) error {
+		ids, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		node, err = NewNodeEntryFromId(tx, ids[0])
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	resp := dryRunRequest(t, "POST",
+		ts.URL+"/nodes/"+node.Info.Id+"/state?dryrun=true",
+		`{"state" : "offline"}`)
+	tests.Assert(t, len(resp.Bricks) == 0, "got:", resp.Bricks)
+	tests.Assert(t, len(resp.Commands) == 0, "got:", resp.Commands)
+
+	err = app.db.View(func(tx wdb.Tx) error {
+		n, err := NewNodeEntryFromId(tx, node.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, n.State == api.EntryStateOnline, "got:", n.State)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestDryRunFailure(t *testing.T) {
+	app, ts, cleanup := dryRunTestApp(t)
+	defer cleanup()
+
+	// the request can not be placed
+	r, err := http.Post(ts.URL+"/volumes?dryrun=true", "application/json",
+		bytes.NewBufferString(`{"size" : 100000}`))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusInternalServerError,
+		"got:", r.StatusCode)
+
+	counts := dbCounts(t, app.db)
+	tests.Assert(t, counts == [3]int{0, 0, 0}, "got:", counts)
+}
+
+func TestDryRunNodeFailure(t *testing.T) {
+	app, ts, cleanup := dryRunTestApp(t)
+	defer cleanup()
+
+	v := faultTestVolume(t, app, 100)
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return nil, &executors.Error{
+			Kind:    executors.ErrorUnreachable,
+			Host:    host,
+			Message: "connection refused",
+		}
+	}
+	var device *DeviceEntry
+	err := app.db.Update(func(tx wdb.Tx) error {
+		brick, err := NewBrickEntryFromId(tx, v.Bricks[0])
+		if err != nil {
+			return err
+		}
+		device, err = NewDeviceEntryFromId(tx, brick.Info.DeviceId)
+		if err != nil {
+			return err
+		}
+		device.State = api.EntryStateOffline
+		return device.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the commands reading the nodes fail as they would without dryrun
+	r, err := http.Post(ts.URL+"/devices/"+device.Info.Id+"/state?dryrun=true",
+		"application/json", bytes.NewBufferString(`{"state" : "failed"}`))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadGateway,
+		"got:", r.StatusCode)
+}
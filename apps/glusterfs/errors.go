@@ -11,17 +11,45 @@ package glusterfs
 
 import (
 	"errors"
+	"net/http"
+
+	"github.com/chinacoolhacker/heketi/executors"
 )
 
 var (
-	ErrNoSpace          = errors.New("No space")
-	ErrFound            = errors.New("Id already exists")
-	ErrNotFound         = errors.New("Id not found")
-	ErrConflict         = errors.New("The target exists, contains other items, or is in use.")
-	ErrMaxBricks        = errors.New("Maximum number of bricks reached.")
-	ErrMinimumBrickSize = errors.New("Minimum brick size limit reached.  Out of space.")
-	ErrDbAccess         = errors.New("Unable to access db")
-	ErrAccessList       = errors.New("Unable to access list")
-	ErrKeyExists        = errors.New("Key already exists in the database")
-	ErrNoReplacement    = errors.New("No Replacement was found for resource requested to be removed")
+	ErrNoSpace           = errors.New("No space")
+	ErrFound             = errors.New("Id already exists")
+	ErrNotFound          = errors.New("Id not found")
+	ErrConflict          = errors.New("The target exists, contains other items, or is in use.")
+	ErrMaxBricks         = errors.New("Maximum number of bricks reached.")
+	ErrMinimumBrickSize  = errors.New("Minimum brick size limit reached.  Out of space.")
+	ErrDbAccess          = errors.New("Unable to access db")
+	ErrAccessList        = errors.New("Unable to access list")
+	ErrKeyExists         = errors.New("Key already exists in the database")
+	ErrNoReplacement     = errors.New("No Replacement was found for resource requested to be removed")
+	ErrInterrupted       = errors.New("Heketi terminated before the operation completed")
+	ErrCancelled         = errors.New("Operation was cancelled")
+	ErrTooManyOperations = errors.New("Too many operations queued, try again later")
+	ErrSshdSkipped       = errors.New("The sshd of none of the nodes could be managed")
 )
+
+// errorStatus returns the http status a request which failed with err
+// is answered with, by the kind of the executor error. It is used by
+// the requests sending commands to the nodes before they are answered.
+// Asynchronous operations always fail with 500, their requests were
+// already accepted, and tell the kind in the ErrorKindHeader instead.
+func errorStatus(err error) int {
+	switch executors.KindOf(err) {
+	case executors.ErrorNotFound:
+		return http.StatusNotFound
+	case executors.ErrorAlreadyExists, executors.ErrorBusy:
+		return http.StatusConflict
+	case executors.ErrorUnreachable:
+		return http.StatusBadGateway
+	case executors.ErrorTimeout:
+		return http.StatusGatewayTimeout
+	case executors.ErrorResourceExhausted:
+		return http.StatusInsufficientStorage
+	}
+	return http.StatusInternalServerError
+}
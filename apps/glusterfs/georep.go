@@ -3,13 +3,13 @@ package glusterfs
 import (
 	"fmt"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/lpabon/godbc"
 )
 
-func (v *VolumeEntry) GeoReplicationAction(db *bolt.DB,
+func (v *VolumeEntry) GeoReplicationAction(db wdb.RODB,
 	executor executors.Executor,
 	host string,
 	msg api.GeoReplicationRequest) error {
@@ -0,0 +1,243 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/lpabon/godbc"
+)
+
+const (
+	BOLTDB_BUCKET_IDEMPOTENCY_KEYS = "IDEMPOTENCY_KEYS"
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("Idempotency-Key was already used for a different request")
+	ErrIdempotencyKeyInProgress = errors.New("A request with the same Idempotency-Key is in progress")
+)
+
+// IdempotencyKeyEntry records the request that was made with an
+// idempotency key and the async operation it started. Keys expire
+// AsyncOperationTtl seconds after they were first used.
+type IdempotencyKeyEntry struct {
+	Key         string
+	RequestHash string
+	OperationId string
+	Expires     int64
+}
+
+func NewIdempotencyKeyEntryFromKey(tx wdb.Tx, key string) (
+	*IdempotencyKeyEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := &IdempotencyKeyEntry{}
+	err := EntryLoad(tx, entry, key)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func IdempotencyKeyList(tx wdb.Tx) ([]string, error) {
+	list := EntryKeys(tx, BOLTDB_BUCKET_IDEMPOTENCY_KEYS)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
+
+func (k *IdempotencyKeyEntry) BucketName() string {
+	return BOLTDB_BUCKET_IDEMPOTENCY_KEYS
+}
+
+func (k *IdempotencyKeyEntry) Save(tx wdb.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(k.Key != "")
+
+	return EntrySave(tx, k, k.Key)
+}
+
+func (k *IdempotencyKeyEntry) Delete(tx wdb.Tx) error {
+	return EntryDelete(tx, k, k.Key)
+}
+
+func (k *IdempotencyKeyEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*k)
+
+	return buffer.Bytes(), err
+}
+
+func (k *IdempotencyKeyEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(k)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (k *IdempotencyKeyEntry) Expired() bool {
+	return k.Expires <= operationTimestamp()
+}
+
+// pruneIdempotencyKeys removes the keys that have expired.
+func pruneIdempotencyKeys(tx wdb.Tx) error {
+	keys, err := IdempotencyKeyList(tx)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		entry, err := NewIdempotencyKeyEntryFromKey(tx, key)
+		if err != nil {
+			return err
+		}
+		if !entry.Expired() {
+			continue
+		}
+		if err := entry.Delete(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setIdempotencyKeyOperation records the async operation started by
+// the request made with key. Nothing is recorded for keys that were
+// not reserved by an idempotent handler.
+func setIdempotencyKeyOperation(tx wdb.Tx, key string, id string) error {
+	entry, err := NewIdempotencyKeyEntryFromKey(tx, key)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	entry.OperationId = id
+	return entry.Save(tx)
+}
+
+// requestHash identifies a request by its method, path and body. A
+// JSON body is hashed in its canonical form so that requests only
+// differing in the order or spacing of the fields are the same.
+func requestHash(r *http.Request, body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err == nil {
+		if canonical, err := json.Marshal(v); err == nil {
+			body = canonical
+		}
+	}
+
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reserveIdempotencyKey records that a request is being served for
+// key. If the key was used before, and has not expired, the entry of
+// the earlier request is returned instead. Expired keys are removed
+// from the db along with the expired async operations.
+func (a *App) reserveIdempotencyKey(key, hash string) (
+	reserved bool, entry *IdempotencyKeyEntry, err error) {
+
+	err = a.db.Update(func(tx wdb.Tx) error {
+		entry, err = NewIdempotencyKeyEntryFromKey(tx, key)
+		if err == nil && !entry.Expired() {
+			return nil
+		} else if err != nil && err != ErrNotFound {
+			return err
+		}
+
+		reserved = true
+		entry = &IdempotencyKeyEntry{
+			Key:         key,
+			RequestHash: hash,
+			Expires:     operationTimestamp() + AsyncOperationTtl,
+		}
+		return entry.Save(tx)
+	})
+	return
+}
+
+// releaseIdempotencyKey removes the reservation of key if the request
+// did not start an async operation, for example because it was
+// invalid, so that the key can be used again.
+func (a *App) releaseIdempotencyKey(key string) {
+	err := a.db.Update(func(tx wdb.Tx) error {
+		entry, err := NewIdempotencyKeyEntryFromKey(tx, key)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if entry.OperationId != "" {
+			return nil
+		}
+		return entry.Delete(tx)
+	})
+	if err != nil {
+		logger.LogError("Unable to release idempotency key %v: %v", key, err)
+	}
+}
+
+// Idempotent wraps the handler of a create request so that it honors
+// the Idempotency-Key header. The first request made with a key is
+// served by handler. A replay of the same request is sent to the async
+// operation started by the first request, while a different request
+// made with the same key is rejected.
+func (a *App) Idempotent(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			handler(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			http.Error(w, "request unable to be read", http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		hash := requestHash(r, body)
+
+		reserved, entry, err := a.reserveIdempotencyKey(key, hash)
+		if err != nil {
+			logger.Err(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		switch {
+		case reserved:
+			handler(w, r)
+			a.releaseIdempotencyKey(key)
+		case entry.RequestHash != hash:
+			http.Error(w, ErrIdempotencyKeyReused.Error(), http.StatusConflict)
+		case entry.OperationId == "":
+			http.Error(w, ErrIdempotencyKeyInProgress.Error(), http.StatusConflict)
+		default:
+			logger.Info("Replaying request with idempotency key %v", key)
+			http.Redirect(w, r, ASYNC_ROUTE+"/"+entry.OperationId, http.StatusAccepted)
+		}
+	}
+}
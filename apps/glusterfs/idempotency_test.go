@@ -0,0 +1,189 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+)
+
+func postWithIdempotencyKey(t *testing.T, url, key, body string) *http.Response {
+	req, err := http.NewRequest("POST", url, bytes.NewBufferString(body))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	r, err := noRedirectClient().Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return r
+}
+
+func countVolumes(t *testing.T, app *App) int {
+	var n int
+	err := app.db.View(func(tx wdb.Tx) error {
+		l, err := VolumeList(tx)
+		n = len(l)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return n
+}
+
+func TestVolumeCreateIdempotencyKey(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	r := postWithIdempotencyKey(t, ts.URL+"/volumes", "key1", `{"size" : 10}`)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	location := r.Header.Get("Location")
+	r = waitAsyncOperation(t, ts.URL+location)
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther, "got:", r.StatusCode)
+	tests.Assert(t, countVolumes(t, app) == 1)
+
+	// replaying the request returns the original operation, the
+	// formatting of the body does not matter
+	r = postWithIdempotencyKey(t, ts.URL+"/volumes", "key1", `{ "size":10 }`)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	tests.Assert(t, r.Header.Get("Location") == location,
+		"expected", location, "got:", r.Header.Get("Location"))
+	tests.Assert(t, countVolumes(t, app) == 1)
+
+	// a different request with the same key is rejected
+	r = postWithIdempotencyKey(t, ts.URL+"/volumes", "key1", `{"size" : 20}`)
+	tests.Assert(t, r.StatusCode == http.StatusConflict, "got:", r.StatusCode)
+	r = postWithIdempotencyKey(t, ts.URL+"/blockvolumes", "key1", `{"size" : 10}`)
+	tests.Assert(t, r.StatusCode == http.StatusConflict, "got:", r.StatusCode)
+
+	// requests without a key are not affected
+	r = postWithIdempotencyKey(t, ts.URL+"/volumes", "", `{"size" : 10}`)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	waitAsyncOperation(t, ts.URL+r.Header.Get("Location"))
+	tests.Assert(t, countVolumes(t, app) == 2)
+}
+
+func TestIdempotencyKeyReleasedOnBadRequest(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 1*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the request fails before an operation is started, the key can
+	// be used again for a fixed request
+	r := postWithIdempotencyKey(t, ts.URL+"/volumes", "key1", `{"size" : 0}`)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest, "got:", r.StatusCode)
+	r = postWithIdempotencyKey(t, ts.URL+"/volumes", "key1", `{"size" : 10}`)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	waitAsyncOperation(t, ts.URL+r.Header.Get("Location"))
+}
+
+func TestIdempotencyKeyInProgress(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	started := make(chan bool)
+	release := make(chan bool)
+	router := mux.NewRouter()
+	router.HandleFunc("/slow", app.Idempotent(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})).Methods("POST")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	done := make(chan *http.Response)
+	go func() {
+		done <- postWithIdempotencyKey(t, ts.URL+"/slow", "key1", `{}`)
+	}()
+	<-started
+
+	r := postWithIdempotencyKey(t, ts.URL+"/slow", "key1", `{}`)
+	tests.Assert(t, r.StatusCode == http.StatusConflict, "got:", r.StatusCode)
+
+	release <- true
+	r = <-done
+	tests.Assert(t, r.StatusCode == http.StatusOK, "got:", r.StatusCode)
+}
+
+func TestIdempotencyKeyExpires(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	now := time.Now().Unix()
+	defer tests.Patch(&operationTimestamp, func() int64 { return now }).Restore()
+	defer tests.Patch(&AsyncOperationTtl, int64(60)).Restore()
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	reserved, _, err := app.reserveIdempotencyKey("key1", "hash1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reserved)
+	reserved, entry, err := app.reserveIdempotencyKey("key1", "hash2")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !reserved)
+	tests.Assert(t, entry.RequestHash == "hash1")
+
+	now += 60
+	reserved, entry, err = app.reserveIdempotencyKey("key1", "hash2")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reserved)
+	tests.Assert(t, entry.RequestHash == "hash2")
+
+	// expired keys are removed by the periodic pruning
+	reserved, _, err = app.reserveIdempotencyKey("key2", "hash1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reserved)
+	now += 60
+	err = app.asyncManager.prune()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = app.db.View(func(tx wdb.Tx) error {
+		keys, err := IdempotencyKeyList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(keys) == 0, "expected no keys, got:", keys)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
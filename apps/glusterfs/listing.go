@@ -10,14 +10,14 @@
 package glusterfs
 
 import (
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 )
 
 // ListCompleteVolumes returns a list of volume ID strings for volumes
 // that are not pending.
-func ListCompleteVolumes(tx *bolt.Tx) ([]string, error) {
+func ListCompleteVolumes(tx wdb.Tx) ([]string, error) {
 	p, err := MapPendingVolumes(tx)
 	if err != nil {
 		return []string{}, err
@@ -35,7 +35,7 @@ func ListCompleteVolumes(tx *bolt.Tx) ([]string, error) {
 
 // ListCompleteBlockVolumes returns a list of block volume ID strings for bricks
 // that are not pending.
-func ListCompleteBlockVolumes(tx *bolt.Tx) ([]string, error) {
+func ListCompleteBlockVolumes(tx wdb.Tx) ([]string, error) {
 	p, err := MapPendingBlockVolumes(tx)
 	if err != nil {
 		return []string{}, err
@@ -53,7 +53,7 @@ func ListCompleteBlockVolumes(tx *bolt.Tx) ([]string, error) {
 
 // UpdateClusterInfoComplete updates the given ClusterInfoResponse object so
 // that it only contains references to complete volumes, etc.
-func UpdateClusterInfoComplete(tx *bolt.Tx, ci *api.ClusterInfoResponse) error {
+func UpdateClusterInfoComplete(tx wdb.Tx, ci *api.ClusterInfoResponse) error {
 	pvol, err := MapPendingVolumes(tx)
 	if err != nil {
 		return err
@@ -74,7 +74,7 @@ func UpdateClusterInfoComplete(tx *bolt.Tx, ci *api.ClusterInfoResponse) error {
 
 // MapPendingVolumes returns a map of volume-id to pending-op-id or
 // an error if the db cannot be read.
-func MapPendingVolumes(tx *bolt.Tx) (map[string]string, error) {
+func MapPendingVolumes(tx wdb.Tx) (map[string]string, error) {
 	return mapPendingItems(tx, func(op *PendingOperationEntry, a PendingOperationAction) bool {
 		return (op.Type == OperationCreateVolume && a.Change == OpAddVolume)
 	})
@@ -82,7 +82,7 @@ func MapPendingVolumes(tx *bolt.Tx) (map[string]string, error) {
 
 // MapPendingBlockVolumes returns a map of block-volume-id to pending-op-id or
 // an error if the db cannot be read.
-func MapPendingBlockVolumes(tx *bolt.Tx) (map[string]string, error) {
+func MapPendingBlockVolumes(tx wdb.Tx) (map[string]string, error) {
 	return mapPendingItems(tx, func(op *PendingOperationEntry, a PendingOperationAction) bool {
 		return (op.Type == OperationCreateBlockVolume && a.Change == OpAddBlockVolume)
 	})
@@ -90,13 +90,13 @@ func MapPendingBlockVolumes(tx *bolt.Tx) (map[string]string, error) {
 
 // MapPendingBricks returns a map of brick-id to pending-op-id or
 // an error if the db cannot be read.
-func MapPendingBricks(tx *bolt.Tx) (map[string]string, error) {
+func MapPendingBricks(tx wdb.Tx) (map[string]string, error) {
 	return mapPendingItems(tx, func(op *PendingOperationEntry, a PendingOperationAction) bool {
 		return (a.Change == OpAddBrick)
 	})
 }
 
-func mapPendingItems(tx *bolt.Tx,
+func mapPendingItems(tx wdb.Tx,
 	pred func(op *PendingOperationEntry, a PendingOperationAction) bool) (
 	items map[string]string, e error) {
 
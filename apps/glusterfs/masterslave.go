@@ -9,45 +9,86 @@
 package glusterfs
 
 import (
-	//	"fmt"
-	"github.com/boltdb/bolt"
-	"github.com/chinacoolhacker/heketi/executors"
+	"fmt"
 	"strings"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 )
 
-//SshdControl(a.executor, entry.Info.Id, start)
-func (a *App) MasterSlaveSshdSet(action, clusterid string) error {
+// MasterSlaveSshdSet runs the sshd action (start, stop, enable, disable
+// or status) on every node of the cluster and returns the result of
+// each node. The nodes whose sshd heketi cannot manage, such as the
+// nodes it reaches over ssh, are skipped. An error listing the nodes
+// where the action failed is returned, or ErrSshdSkipped if every node
+// was skipped.
+func (a *App) MasterSlaveSshdSet(action, clusterid string) (
+	[]api.MasterSlaveSshdResult, error) {
+
 	logger.Debug("in Cluster %v action  %v \n", clusterid, action)
-	err := a.db.View(func(tx *bolt.Tx) error {
+
+	// Collect the hosts first, the executor is not run in the
+	// transaction
+	hosts := map[string]string{}
+	var nodes []string
+	err := a.db.View(func(tx wdb.Tx) error {
 		entry, err := NewClusterEntryFromId(tx, clusterid)
-		if err == ErrNotFound {
-			return err
-		} else if err != nil {
+		if err != nil {
 			return err
 		}
-		logger.Debug("in Cluster %v nodes %v \n", clusterid, entry.Info.Nodes)
-
-		for _, n := range entry.Info.Nodes {
-			var newNode *NodeEntry
-			newNode, err = NewNodeEntryFromId(tx, n)
-			hostforexex := strings.Join(newNode.Info.Hostnames.Manage, ",")
-			logger.Debug("in node %v \n", hostforexex)
-
-			if err := executors.Executor.SshdControl(a.executor, hostforexex, action); err != nil {
+		for _, id := range entry.Info.Nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			if err != nil {
 				return err
 			}
-
-		}
-
-		if err != nil {
-			return err
+			nodes = append(nodes, id)
+			hosts[id] = node.ManageHostName()
 		}
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	results := make([]api.MasterSlaveSshdResult, 0, len(nodes))
+	var failed []string
+	skipped := 0
+	for _, id := range nodes {
+		result := api.MasterSlaveSshdResult{
+			Node:   id,
+			Host:   hosts[id],
+			Action: action,
+		}
+		err := a.executor.SshdControl(hosts[id], action)
+		switch {
+		case err == nil:
+			result.Result = api.SshdActionDone
+			logger.Info("sshd %v on node %v (%v): done", action, id, hosts[id])
+		case err == executors.ErrSshdInUse || err == executors.ErrSshdNotSupported:
+			result.Result = api.SshdActionSkipped
+			result.Error = err.Error()
+			skipped++
+			logger.Warning("sshd %v on node %v (%v): skipped, %v",
+				action, id, hosts[id], err)
+		default:
+			result.Result = api.SshdActionFailed
+			result.Error = err.Error()
+			logger.Err(err)
+			failed = append(failed, fmt.Sprintf("%v (%v): %v", id, hosts[id], err))
+		}
+		results = append(results, result)
+	}
+	if len(failed) != 0 {
+		return results, fmt.Errorf("Unable to %v sshd on %v of %v nodes of cluster %v: %v",
+			action, len(failed), len(nodes), clusterid, strings.Join(failed, "; "))
+	}
+	if len(nodes) != 0 && skipped == len(nodes) {
+		logger.LogError("Unable to %v sshd on cluster %v: every node was skipped",
+			action, clusterid)
+		return results, ErrSshdSkipped
 	}
-	return nil
+	return results, nil
 }
 
 // MasterSlaveStatus of cluster
@@ -56,7 +97,7 @@ func (a *App) MasterSlaveSshdSet(action, clusterid string) error {
 func (a *App) MasterSlaveClustersCheck() (MasterClusters, SlaveClusters []string) {
 	logger.Debug("In  MasterSlaveClustersCheck \n")
 	var err error
-	err = a.db.View(func(tx *bolt.Tx) error {
+	err = a.db.View(func(tx wdb.Tx) error {
 		clusters, err := ClusterList(tx)
 		if err != nil {
 			return err
@@ -65,7 +106,7 @@ func (a *App) MasterSlaveClustersCheck() (MasterClusters, SlaveClusters []string
 			return ErrNotFound
 		}
 		for _, cluster := range clusters {
-			err := a.db.View(func(tx *bolt.Tx) error {
+			err := a.db.View(func(tx wdb.Tx) error {
 				entry, err := NewClusterEntryFromId(tx, cluster)
 				if err == ErrNotFound {
 					return err
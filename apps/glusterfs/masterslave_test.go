@@ -0,0 +1,118 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestMasterSlaveSshdSet(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 1, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusterId string
+	hosts := map[string]string{}
+	err = app.db.View(func(tx wdb.Tx) error {
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		clusterId = clusters[0]
+		nodes, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			hosts[node.ManageHostName()] = id
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(hosts) == 3, hosts)
+
+	// every node is set
+	var received []string
+	app.xo.MockSshdControl = func(host, action string) error {
+		tests.Assert(t, action == "stop", action)
+		received = append(received, host)
+		return nil
+	}
+	results, err := app.MasterSlaveSshdSet("stop", clusterId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(received) == 3, received)
+	for _, host := range received {
+		_, ok := hosts[host]
+		tests.Assert(t, ok, host)
+	}
+	tests.Assert(t, len(results) == 3, results)
+	for _, result := range results {
+		tests.Assert(t, result.Result == api.SshdActionDone, result)
+		tests.Assert(t, result.Action == "stop", result)
+		tests.Assert(t, hosts[result.Host] == result.Node, result)
+	}
+
+	// the nodes heketi reaches over ssh are skipped, the other nodes
+	// are set even when one fails
+	received = nil
+	app.xo.MockSshdControl = func(host, action string) error {
+		received = append(received, host)
+		switch len(received) {
+		case 1:
+			return executors.ErrSshdInUse
+		case 2:
+			return errors.New("sshd failed")
+		}
+		return nil
+	}
+	results, err = app.MasterSlaveSshdSet("stop", clusterId)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(received) == 3, received)
+	tests.Assert(t, strings.Contains(err.Error(), "on 1 of 3 nodes"), err)
+	tests.Assert(t, strings.Contains(err.Error(), hosts[received[1]]), err)
+	tests.Assert(t, strings.Contains(err.Error(), "sshd failed"), err)
+	tests.Assert(t, len(results) == 3, results)
+	tests.Assert(t, results[0].Result == api.SshdActionSkipped, results[0])
+	tests.Assert(t, results[0].Error == executors.ErrSshdInUse.Error(), results[0])
+	tests.Assert(t, results[1].Result == api.SshdActionFailed, results[1])
+	tests.Assert(t, results[1].Error == "sshd failed", results[1])
+	tests.Assert(t, results[2].Result == api.SshdActionDone, results[2])
+
+	// an action skipped on every node is an error
+	app.xo.MockSshdControl = func(host, action string) error {
+		return executors.ErrSshdNotSupported
+	}
+	results, err = app.MasterSlaveSshdSet("stop", clusterId)
+	tests.Assert(t, err == ErrSshdSkipped, err)
+	tests.Assert(t, len(results) == 3, results)
+	for _, result := range results {
+		tests.Assert(t, result.Result == api.SshdActionSkipped, result)
+	}
+
+	_, err = app.MasterSlaveSshdSet("stop", "nosuchcluster")
+	tests.Assert(t, err == ErrNotFound, err)
+}
@@ -15,7 +15,6 @@ import (
 	"fmt"
 	"sort"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
 	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
@@ -28,6 +27,9 @@ type NodeEntry struct {
 
 	Info    api.NodeInfo
 	Devices sort.StringSlice
+	// Fingerprint of the ssh host key of the manage hostname, empty
+	// if the key is not pinned
+	HostKey string
 }
 
 func NewNodeEntry() *NodeEntry {
@@ -50,7 +52,7 @@ func NewNodeEntryFromRequest(req *api.NodeAddRequest) *NodeEntry {
 	return node
 }
 
-func NewNodeEntryFromId(tx *bolt.Tx, id string) (*NodeEntry, error) {
+func NewNodeEntryFromId(tx wdb.Tx, id string) (*NodeEntry, error) {
 	godbc.Require(tx != nil)
 
 	entry := NewNodeEntry()
@@ -76,7 +78,7 @@ func GetVerifiedManageHostname(db wdb.RODB, e executors.Executor, clusterId stri
 	var cluster *ClusterEntry
 	var node *NodeEntry
 	var err error
-	err = db.View(func(tx *bolt.Tx) error {
+	err = db.View(func(tx wdb.Tx) error {
 		var err error
 		cluster, err = NewClusterEntryFromId(tx, clusterId)
 		return err
@@ -88,7 +90,7 @@ func GetVerifiedManageHostname(db wdb.RODB, e executors.Executor, clusterId stri
 
 	for _, n := range cluster.Info.Nodes {
 		var newNode *NodeEntry
-		err = db.View(func(tx *bolt.Tx) error {
+		err = db.View(func(tx wdb.Tx) error {
 			var err error
 			newNode, err = NewNodeEntryFromId(tx, n)
 			return err
@@ -118,7 +120,7 @@ func GetVerifiedManageHostname(db wdb.RODB, e executors.Executor, clusterId stri
 }
 
 // Returns Manage Hostname, given a Storage Hostname
-func GetManageHostnameFromStorageHostname(tx *bolt.Tx, shostname string) (string, error) {
+func GetManageHostnameFromStorageHostname(tx wdb.Tx, shostname string) (string, error) {
 	godbc.Require(shostname != "")
 	var cluster *ClusterEntry
 	var node *NodeEntry
@@ -153,7 +155,7 @@ func GetManageHostnameFromStorageHostname(tx *bolt.Tx, shostname string) (string
 	return "", ErrNotFound
 }
 
-func (n *NodeEntry) Register(tx *bolt.Tx) error {
+func (n *NodeEntry) Register(tx wdb.Tx) error {
 
 	// Save manage hostnames
 	for _, h := range n.Info.Hostnames.Manage {
@@ -208,7 +210,7 @@ func (n *NodeEntry) Register(tx *bolt.Tx) error {
 
 }
 
-func (n *NodeEntry) Deregister(tx *bolt.Tx) error {
+func (n *NodeEntry) Deregister(tx wdb.Tx) error {
 
 	// Remove manage hostnames from Db
 	for _, h := range n.Info.Hostnames.Manage {
@@ -233,7 +235,7 @@ func (n *NodeEntry) BucketName() string {
 	return BOLTDB_BUCKET_NODE
 }
 
-func (n *NodeEntry) Save(tx *bolt.Tx) error {
+func (n *NodeEntry) Save(tx wdb.Tx) error {
 	godbc.Require(tx != nil)
 	godbc.Require(len(n.Info.Id) > 0)
 
@@ -267,7 +269,7 @@ func (n *NodeEntry) ConflictString() string {
 	return fmt.Sprintf("Unable to delete node [%v] because it contains devices", n.Info.Id)
 }
 
-func (n *NodeEntry) Delete(tx *bolt.Tx) error {
+func (n *NodeEntry) Delete(tx wdb.Tx) error {
 	godbc.Require(tx != nil)
 
 	// Check if the nodes still has drives
@@ -305,7 +307,7 @@ func (n *NodeEntry) SetState(db wdb.DB, e executors.Executor,
 		case api.EntryStateOnline:
 			return nil
 		case api.EntryStateOffline:
-			err := db.Update(func(tx *bolt.Tx) error {
+			err := db.Update(func(tx wdb.Tx) error {
 				// Save state
 				n.State = s
 				// Save new state
@@ -330,7 +332,7 @@ func (n *NodeEntry) SetState(db wdb.DB, e executors.Executor,
 		case api.EntryStateOffline:
 			return nil
 		case api.EntryStateOnline:
-			err := db.Update(func(tx *bolt.Tx) error {
+			err := db.Update(func(tx wdb.Tx) error {
 				n.State = s
 				err := n.Save(tx)
 				if err != nil {
@@ -344,7 +346,7 @@ func (n *NodeEntry) SetState(db wdb.DB, e executors.Executor,
 		case api.EntryStateFailed:
 			for _, id := range n.Devices {
 				var d *DeviceEntry
-				err := db.View(func(tx *bolt.Tx) error {
+				err := db.View(func(tx wdb.Tx) error {
 					var err error
 					d, err = NewDeviceEntryFromId(tx, id)
 					if err != nil {
@@ -362,7 +364,7 @@ func (n *NodeEntry) SetState(db wdb.DB, e executors.Executor,
 			}
 
 			// Make the state change to failed
-			err := db.Update(func(tx *bolt.Tx) error {
+			err := db.Update(func(tx wdb.Tx) error {
 				n.State = s
 				err := n.Save(tx)
 				if err != nil {
@@ -381,7 +383,7 @@ func (n *NodeEntry) SetState(db wdb.DB, e executors.Executor,
 	return nil
 }
 
-func (n *NodeEntry) NewInfoReponse(tx *bolt.Tx) (*api.NodeInfoResponse, error) {
+func (n *NodeEntry) NewInfoReponse(tx wdb.Tx) (*api.NodeInfoResponse, error) {
 
 	godbc.Require(tx != nil)
 
@@ -444,11 +446,11 @@ func (n *NodeEntry) DeviceDelete(id string) {
 	n.Devices = utils.SortedStringsDelete(n.Devices, id)
 }
 
-func NodeEntryUpgrade(tx *bolt.Tx) error {
+func NodeEntryUpgrade(tx wdb.Tx) error {
 	return nil
 }
 
-func NodeList(tx *bolt.Tx) ([]string, error) {
+func NodeList(tx wdb.Tx) ([]string, error) {
 
 	list := EntryKeys(tx, BOLTDB_BUCKET_NODE)
 	if list == nil {
@@ -457,7 +459,7 @@ func NodeList(tx *bolt.Tx) ([]string, error) {
 	return list, nil
 }
 
-func (n *NodeEntry) DeleteBricksWithEmptyPath(tx *bolt.Tx) error {
+func (n *NodeEntry) DeleteBricksWithEmptyPath(tx wdb.Tx) error {
 
 	for _, deviceid := range n.Devices {
 		device, err := NewDeviceEntryFromId(tx, deviceid)
@@ -14,7 +14,7 @@ import (
 	"reflect"
 	"testing"
 
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/heketi/tests"
@@ -133,7 +133,7 @@ func TestNodeEntryRegister(t *testing.T) {
 	n := NewNodeEntryFromRequest(req)
 
 	// Register node
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		err := n.Register(tx)
 		tests.Assert(t, err == nil)
 
@@ -142,7 +142,7 @@ func TestNodeEntryRegister(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Should not be able to register again
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := n.Register(tx)
 		tests.Assert(t, err != nil)
 
@@ -163,7 +163,7 @@ func TestNodeEntryRegister(t *testing.T) {
 	diff_cluster_n := NewNodeEntryFromRequest(req)
 
 	// Should not be able to register diff_cluster_n
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		return diff_cluster_n.Register(tx)
 	})
 	tests.Assert(t, err != nil)
@@ -180,7 +180,7 @@ func TestNodeEntryRegister(t *testing.T) {
 	n2 := NewNodeEntryFromRequest(req)
 
 	// Register n2 node
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := n2.Register(tx)
 		tests.Assert(t, err == nil)
 
@@ -189,7 +189,7 @@ func TestNodeEntryRegister(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Remove n
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := n.Deregister(tx)
 		tests.Assert(t, err == nil)
 
@@ -198,7 +198,7 @@ func TestNodeEntryRegister(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Register n node again
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := n.Register(tx)
 		tests.Assert(t, err == nil)
 
@@ -228,14 +228,14 @@ func TestNodeEntryRegisterStaleRegistration(t *testing.T) {
 	n := NewNodeEntryFromRequest(req)
 
 	// Only save the registration
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return n.Register(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	// Register node again.  This should
 	// work because a real node entry is not saved
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := n.Register(tx)
 		tests.Assert(t, err == nil)
 
@@ -244,13 +244,13 @@ func TestNodeEntryRegisterStaleRegistration(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Register again.  Should not work
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		return n.Register(tx)
 	})
 	tests.Assert(t, err != nil)
 
 	// Remove n
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := n.Deregister(tx)
 		tests.Assert(t, err == nil)
 
@@ -259,7 +259,7 @@ func TestNodeEntryRegisterStaleRegistration(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Register n node again
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		err := n.Register(tx)
 		tests.Assert(t, err == nil)
 
@@ -278,7 +278,7 @@ func TestNewNodeEntryFromIdNotFound(t *testing.T) {
 	defer app.Close()
 
 	// Test for ID not found
-	err := app.db.View(func(tx *bolt.Tx) error {
+	err := app.db.View(func(tx wdb.Tx) error {
 		_, err := NewNodeEntryFromId(tx, "123")
 		return err
 	})
@@ -309,13 +309,13 @@ func TestNewNodeEntryFromId(t *testing.T) {
 	n.DeviceAdd("def")
 
 	// Save element in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return n.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	var node *NodeEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		node, err = NewNodeEntryFromId(tx, n.Info.Id)
 		if err != nil {
@@ -352,13 +352,13 @@ func TestNewNodeEntrySaveDelete(t *testing.T) {
 	n.DeviceAdd("def")
 
 	// Save element in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return n.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	var node *NodeEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		node, err = NewNodeEntryFromId(tx, n.Info.Id)
 		if err != nil {
@@ -371,7 +371,7 @@ func TestNewNodeEntrySaveDelete(t *testing.T) {
 	tests.Assert(t, reflect.DeepEqual(node, n))
 
 	// Delete entry which has devices
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		var err error
 		node, err = NewNodeEntryFromId(tx, n.Info.Id)
 		if err != nil {
@@ -392,13 +392,13 @@ func TestNewNodeEntrySaveDelete(t *testing.T) {
 	node.DeviceDelete("abc")
 	node.DeviceDelete("def")
 	tests.Assert(t, len(node.Devices) == 0)
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		return node.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	// Now try to delete the node
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		var err error
 		node, err = NewNodeEntryFromId(tx, n.Info.Id)
 		if err != nil {
@@ -416,7 +416,7 @@ func TestNewNodeEntrySaveDelete(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Check node has been deleted and is not in db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		node, err = NewNodeEntryFromId(tx, n.Info.Id)
 		if err != nil {
@@ -449,13 +449,13 @@ func TestNewNodeEntryNewInfoResponse(t *testing.T) {
 	n := NewNodeEntryFromRequest(req)
 
 	// Save element in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return n.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	var info *api.NodeInfoResponse
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		node, err := NewNodeEntryFromId(tx, n.Info.Id)
 		if err != nil {
 			return err
@@ -512,7 +512,7 @@ func TestNodeSetStateFailed(t *testing.T) {
 	n.DeviceAdd(d.Info.Id)
 
 	// Save in db
-	app.db.Update(func(tx *bolt.Tx) error {
+	app.db.Update(func(tx wdb.Tx) error {
 		err := c.Save(tx)
 		tests.Assert(t, err == nil)
 
@@ -583,7 +583,7 @@ func TestNodeSetStateOfflineOnline(t *testing.T) {
 	n.DeviceAdd(d.Info.Id)
 
 	// Save in db
-	app.db.Update(func(tx *bolt.Tx) error {
+	app.db.Update(func(tx wdb.Tx) error {
 		err := c.Save(tx)
 		tests.Assert(t, err == nil)
 
@@ -637,7 +637,7 @@ func TestGetVerifiedManageHostname(t *testing.T) {
 	c.NodeAdd(n.Info.Id)
 
 	// Save in db
-	app.db.Update(func(tx *bolt.Tx) error {
+	app.db.Update(func(tx wdb.Tx) error {
 		err := c.Save(tx)
 		tests.Assert(t, err == nil)
 
@@ -652,7 +652,7 @@ func TestGetVerifiedManageHostname(t *testing.T) {
 	tests.Assert(t, err == nil)
 	tests.Assert(t, n.State == api.EntryStateOnline)
 
-	app.db.Update(func(tx *bolt.Tx) error {
+	app.db.Update(func(tx wdb.Tx) error {
 		// Set offline
 		n.State = api.EntryStateOffline
 		tests.Assert(t, n.State == api.EntryStateOffline)
@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
+)
+
+// Phases of an operation reported in its progress. Operations are
+// built before they are accepted, so there is no build phase.
+const (
+	OperationPhaseQueued   = "queued"
+	OperationPhaseExec     = "exec"
+	OperationPhaseFinalize = "finalize"
+	OperationPhaseRollback = "rollback"
+)
+
+// OperationProgress tracks how far a running async operation got, so
+// that it can be reported to clients polling its status. It is safe
+// for concurrent use and all its methods can be called on a nil
+// progress, which does nothing.
+type OperationProgress struct {
+	lock sync.Mutex
+	info api.OperationProgress
+}
+
+func NewOperationProgress() *OperationProgress {
+	return &OperationProgress{}
+}
+
+// SetPhase starts a new phase of the operation.
+func (p *OperationProgress) SetPhase(phase string) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.info = api.OperationProgress{Phase: phase}
+}
+
+// StartStep starts a step of the current phase made of total items.
+func (p *OperationProgress) StartStep(step string, total int) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.info.Step = step
+	p.info.Done = 0
+	p.info.Total = total
+}
+
+// Advance records that one more item of the current step is done.
+func (p *OperationProgress) Advance() {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.info.Done++
+}
+
+// SetHost records the host the operation is currently acting on.
+func (p *OperationProgress) SetHost(host string) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.info.Host = host
+}
+
+// Info returns a snapshot of the progress.
+func (p *OperationProgress) Info() api.OperationProgress {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.info
+}
+
+type operationProgressKey struct{}
+
+// withOperationProgress returns a context carrying p. The executors
+// bound to the context report the hosts they act on to p.
+func withOperationProgress(ctx context.Context,
+	p *OperationProgress) context.Context {
+
+	ctx = context.WithValue(ctx, operationProgressKey{}, p)
+	return executors.WithHostReporter(ctx, p.SetHost)
+}
+
+// operationProgress returns the progress carried by ctx, or nil.
+func operationProgress(ctx context.Context) *OperationProgress {
+	p, _ := ctx.Value(operationProgressKey{}).(*OperationProgress)
+	return p
+}
+
+// detachedContext keeps the values of its parent but is never done.
+// It is used to clean up after an operation was cancelled.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func detachContext(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
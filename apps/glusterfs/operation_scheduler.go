@@ -0,0 +1,209 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	// Seconds a client is asked to wait before retrying a request
+	// that was rejected because the operation queue is full
+	OperationRetryAfter = 10
+)
+
+// OperationScheduler bounds how many operations run at the same time,
+// in total and on each cluster. Operations that can not run yet wait
+// in a queue and are started in the order they were submitted, as
+// soon as their cluster has a free slot. Operations on no particular
+// cluster are only bounded by the global limit. A limit of zero means
+// no limit.
+type OperationScheduler struct {
+	lock sync.Mutex
+
+	maxRunning        int
+	maxClusterRunning int
+	maxQueued         int
+
+	// operations reserved but not yet submitted
+	reserved int
+	queue    []*OperationTicket
+	running  int
+	clusters map[string]int
+}
+
+// ClusterOperation is implemented by the operations that act on a
+// single cluster, so that they are also bounded by the per-cluster
+// limit of the scheduler. ClusterId is called after Build.
+type ClusterOperation interface {
+	ClusterId() string
+}
+
+func operationCluster(op Operation) string {
+	if o, ok := op.(ClusterOperation); ok {
+		return o.ClusterId()
+	}
+	return ""
+}
+
+// operationId returns the id of the pending operation entry of op, if
+// it has one.
+func operationId(op Operation) string {
+	if o, ok := op.(interface {
+		Id() string
+	}); ok {
+		return o.Id()
+	}
+	return ""
+}
+
+// OperationTicket is the place of an operation in the scheduler.
+type OperationTicket struct {
+	scheduler *OperationScheduler
+
+	// pending operation entry id, if any
+	Id      string
+	Cluster string
+	Queued  int64
+
+	started chan struct{}
+}
+
+func NewOperationScheduler(maxRunning, maxClusterRunning,
+	maxQueued int) *OperationScheduler {
+
+	return &OperationScheduler{
+		maxRunning:        maxRunning,
+		maxClusterRunning: maxClusterRunning,
+		maxQueued:         maxQueued,
+		clusters:          map[string]int{},
+	}
+}
+
+// Reserve takes a place in the queue for an operation that is about
+// to be built. It returns ErrTooManyOperations if the queue is full.
+// The ticket must then be either submitted or released.
+func (s *OperationScheduler) Reserve() (*OperationTicket, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.maxQueued > 0 && s.reserved+len(s.queue) >= s.maxQueued {
+		return nil, ErrTooManyOperations
+	}
+	s.reserved++
+	return &OperationTicket{
+		scheduler: s,
+		started:   make(chan struct{}),
+	}, nil
+}
+
+// Release gives back the place of an operation that was never
+// submitted.
+func (t *OperationTicket) Release() {
+	s := t.scheduler
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reserved--
+}
+
+// Submit queues the operation with the given pending operation id to
+// run on cluster, and starts it right away if there is a free slot.
+func (t *OperationTicket) Submit(id, cluster string) {
+	s := t.scheduler
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t.Id = id
+	t.Cluster = cluster
+	t.Queued = operationTimestamp()
+	s.reserved--
+	s.queue = append(s.queue, t)
+	s.dispatch()
+}
+
+// Wait blocks until the operation is started or ctx is done. If Wait
+// returns nil Done must be called once the operation has completed,
+// otherwise the operation was removed from the queue.
+func (t *OperationTicket) Wait(ctx context.Context) error {
+	select {
+	case <-t.started:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s := t.scheduler
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, q := range s.queue {
+		if q == t {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return ctx.Err()
+		}
+	}
+	// started at the same time ctx was done
+	return nil
+}
+
+// Done frees the slot of a completed operation.
+func (t *OperationTicket) Done() {
+	s := t.scheduler
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.running--
+	s.clusters[t.Cluster]--
+	if s.clusters[t.Cluster] == 0 {
+		delete(s.clusters, t.Cluster)
+	}
+	s.dispatch()
+}
+
+// Queued returns the position in the queue of the waiting operations,
+// by pending operation id. The first operation is at position 1.
+func (s *OperationScheduler) Queued() map[string]int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	queued := map[string]int{}
+	for i, t := range s.queue {
+		if t.Id != "" {
+			queued[t.Id] = i + 1
+		}
+	}
+	return queued
+}
+
+// dispatch starts the queued operations that fit the limits, in
+// order. Must be called with the lock held.
+func (s *OperationScheduler) dispatch() {
+	waiting := s.queue[:0]
+	for _, t := range s.queue {
+		if s.canRun(t.Cluster) {
+			s.running++
+			s.clusters[t.Cluster]++
+			close(t.started)
+		} else {
+			waiting = append(waiting, t)
+		}
+	}
+	s.queue = waiting
+}
+
+func (s *OperationScheduler) canRun(cluster string) bool {
+	if s.maxRunning > 0 && s.running >= s.maxRunning {
+		return false
+	}
+	if cluster != "" && s.maxClusterRunning > 0 &&
+		s.clusters[cluster] >= s.maxClusterRunning {
+		return false
+	}
+	return true
+}
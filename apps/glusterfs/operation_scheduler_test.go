@@ -0,0 +1,137 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/heketi/tests"
+)
+
+func submitTicket(t *testing.T, s *OperationScheduler,
+	id, cluster string) *OperationTicket {
+
+	ticket, err := s.Reserve()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	ticket.Submit(id, cluster)
+	return ticket
+}
+
+func ticketStarted(ticket *OperationTicket) bool {
+	select {
+	case <-ticket.started:
+		return true
+	case <-time.After(10 * time.Millisecond):
+		return false
+	}
+}
+
+func TestOperationSchedulerUnlimited(t *testing.T) {
+	s := NewOperationScheduler(0, 0, 0)
+
+	for i := 0; i < 10; i++ {
+		ticket := submitTicket(t, s, "", "c1")
+		tests.Assert(t, ticket.Wait(context.Background()) == nil)
+	}
+	tests.Assert(t, len(s.Queued()) == 0)
+}
+
+func TestOperationSchedulerFifo(t *testing.T) {
+	s := NewOperationScheduler(1, 0, 0)
+
+	t1 := submitTicket(t, s, "op1", "c1")
+	t2 := submitTicket(t, s, "op2", "c2")
+	t3 := submitTicket(t, s, "op3", "c1")
+	tests.Assert(t, ticketStarted(t1))
+	tests.Assert(t, !ticketStarted(t2))
+	tests.Assert(t, !ticketStarted(t3))
+
+	queued := s.Queued()
+	tests.Assert(t, len(queued) == 2, "got:", queued)
+	tests.Assert(t, queued["op2"] == 1, "got:", queued)
+	tests.Assert(t, queued["op3"] == 2, "got:", queued)
+
+	t1.Done()
+	tests.Assert(t, ticketStarted(t2))
+	tests.Assert(t, !ticketStarted(t3))
+
+	t2.Done()
+	tests.Assert(t, ticketStarted(t3))
+	t3.Done()
+	tests.Assert(t, s.running == 0, "got:", s.running)
+	tests.Assert(t, len(s.clusters) == 0, "got:", s.clusters)
+}
+
+func TestOperationSchedulerPerCluster(t *testing.T) {
+	s := NewOperationScheduler(0, 1, 0)
+
+	t1 := submitTicket(t, s, "op1", "c1")
+	t2 := submitTicket(t, s, "op2", "c1")
+	t3 := submitTicket(t, s, "op3", "c2")
+	t4 := submitTicket(t, s, "op4", "")
+	t5 := submitTicket(t, s, "op5", "")
+
+	// a busy cluster does not hold up the others
+	tests.Assert(t, ticketStarted(t1))
+	tests.Assert(t, !ticketStarted(t2))
+	tests.Assert(t, ticketStarted(t3))
+	tests.Assert(t, ticketStarted(t4))
+	tests.Assert(t, ticketStarted(t5))
+
+	t1.Done()
+	tests.Assert(t, ticketStarted(t2))
+}
+
+func TestOperationSchedulerQueueFull(t *testing.T) {
+	s := NewOperationScheduler(1, 0, 1)
+
+	t1 := submitTicket(t, s, "op1", "c1")
+	tests.Assert(t, ticketStarted(t1))
+
+	// a reserved ticket takes a place in the queue until released
+	t2, err := s.Reserve()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = s.Reserve()
+	tests.Assert(t, err == ErrTooManyOperations, "got:", err)
+	t2.Release()
+
+	t2 = submitTicket(t, s, "op2", "c1")
+	_, err = s.Reserve()
+	tests.Assert(t, err == ErrTooManyOperations, "got:", err)
+
+	t1.Done()
+	tests.Assert(t, ticketStarted(t2))
+	t3, err := s.Reserve()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	t3.Release()
+}
+
+func TestOperationSchedulerWaitCancelled(t *testing.T) {
+	s := NewOperationScheduler(1, 0, 0)
+
+	t1 := submitTicket(t, s, "op1", "c1")
+	t2 := submitTicket(t, s, "op2", "c1")
+	t3 := submitTicket(t, s, "op3", "c1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := t2.Wait(ctx)
+	tests.Assert(t, err == context.Canceled, "got:", err)
+	queued := s.Queued()
+	tests.Assert(t, len(queued) == 1, "got:", queued)
+	tests.Assert(t, queued["op3"] == 1, "got:", queued)
+
+	// the cancelled ticket is skipped
+	t1.Done()
+	tests.Assert(t, !ticketStarted(t2))
+	tests.Assert(t, t3.Wait(context.Background()) == nil)
+}
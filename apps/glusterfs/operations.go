@@ -10,13 +10,14 @@
 package glusterfs
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/chinacoolhacker/heketi/executors"
 	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 
-	"github.com/boltdb/bolt"
 )
 
 // The operations.go file is meant to provide a common approach to planning,
@@ -37,7 +38,7 @@ type Operation interface {
 	Label() string
 	ResourceUrl() string
 	Build(allocator Allocator) error
-	Exec(executor executors.Executor) error
+	Exec(ctx context.Context, executor executors.Executor) error
 	Rollback(executor executors.Executor) error
 	Finalize() error
 }
@@ -84,10 +85,14 @@ func (vc *VolumeCreateOperation) ResourceUrl() string {
 	return fmt.Sprintf("/volumes/%v", vc.vol.Info.Id)
 }
 
+func (vc *VolumeCreateOperation) ClusterId() string {
+	return vc.vol.Info.Cluster
+}
+
 // Build allocates and saves new volume and brick entries (tagged as pending)
 // in the db.
 func (vc *VolumeCreateOperation) Build(allocator Allocator) error {
-	return vc.db.Update(func(tx *bolt.Tx) error {
+	return vc.db.Update(func(tx wdb.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		brick_entries, err := vc.vol.createVolumeComponents(txdb, allocator)
 		if err != nil {
@@ -111,13 +116,13 @@ func (vc *VolumeCreateOperation) Build(allocator Allocator) error {
 }
 
 // Exec creates new bricks and volume on the underlying glusterfs storage system.
-func (vc *VolumeCreateOperation) Exec(executor executors.Executor) error {
+func (vc *VolumeCreateOperation) Exec(ctx context.Context, executor executors.Executor) error {
 	brick_entries, err := bricksFromOp(vc.db, vc.op, vc.vol.Info.Gid)
 	if err != nil {
 		logger.LogError("Failed to get bricks from op: %v", err)
 		return err
 	}
-	err = vc.vol.createVolumeExec(vc.db, executor, brick_entries)
+	err = vc.vol.createVolumeExec(ctx, vc.db, executor, brick_entries)
 	if err != nil {
 		logger.LogError("Error executing create volume: %v", err)
 	}
@@ -126,7 +131,7 @@ func (vc *VolumeCreateOperation) Exec(executor executors.Executor) error {
 
 // Finalize marks our new volume and brick db entries as no longer pending.
 func (vc *VolumeCreateOperation) Finalize() error {
-	return vc.db.Update(func(tx *bolt.Tx) error {
+	return vc.db.Update(func(tx wdb.Tx) error {
 		brick_entries, err := bricksFromOp(wdb.WrapTx(tx), vc.op, vc.vol.Info.Gid)
 		if err != nil {
 			logger.LogError("Failed to get bricks from op: %v", err)
@@ -163,7 +168,7 @@ func (vc *VolumeCreateOperation) Rollback(executor executors.Executor) error {
 		logger.LogError("Error on create volume rollback: %v", err)
 		return err
 	}
-	err = vc.db.Update(func(tx *bolt.Tx) error {
+	err = vc.db.Update(func(tx wdb.Tx) error {
 		return vc.op.Delete(tx)
 	})
 	return err
@@ -203,10 +208,14 @@ func (ve *VolumeExpandOperation) ResourceUrl() string {
 	return fmt.Sprintf("/volumes/%v", ve.vol.Info.Id)
 }
 
+func (ve *VolumeExpandOperation) ClusterId() string {
+	return ve.vol.Info.Cluster
+}
+
 // Build determines what new bricks needs to be created to satisfy the
 // new volume size. It marks new bricks as pending in the db.
 func (ve *VolumeExpandOperation) Build(allocator Allocator) error {
-	return ve.db.Update(func(tx *bolt.Tx) error {
+	return ve.db.Update(func(tx wdb.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		brick_entries, err := ve.vol.expandVolumeComponents(
 			txdb, allocator, ve.ExpandSize, false)
@@ -228,13 +237,13 @@ func (ve *VolumeExpandOperation) Build(allocator Allocator) error {
 }
 
 // Exec creates new bricks on the underlying storage systems.
-func (ve *VolumeExpandOperation) Exec(executor executors.Executor) error {
+func (ve *VolumeExpandOperation) Exec(ctx context.Context, executor executors.Executor) error {
 	brick_entries, err := bricksFromOp(ve.db, ve.op, ve.vol.Info.Gid)
 	if err != nil {
 		logger.LogError("Failed to get bricks from op: %v", err)
 		return err
 	}
-	err = ve.vol.expandVolumeExec(ve.db, executor, brick_entries)
+	err = ve.vol.expandVolumeExec(ctx, ve.db, executor, brick_entries)
 	if err != nil {
 		logger.LogError("Error executing expand volume: %v", err)
 	}
@@ -256,7 +265,7 @@ func (ve *VolumeExpandOperation) Rollback(executor executors.Executor) error {
 		logger.LogError("Error on create volume rollback: %v", err)
 		return err
 	}
-	err = ve.db.Update(func(tx *bolt.Tx) error {
+	err = ve.db.Update(func(tx wdb.Tx) error {
 		return ve.op.Delete(tx)
 	})
 	return err
@@ -265,7 +274,7 @@ func (ve *VolumeExpandOperation) Rollback(executor executors.Executor) error {
 // Finalize marks new bricks as no longer pending and updates the size
 // of the existing volume entry.
 func (ve *VolumeExpandOperation) Finalize() error {
-	return ve.db.Update(func(tx *bolt.Tx) error {
+	return ve.db.Update(func(tx wdb.Tx) error {
 		brick_entries, err := bricksFromOp(wdb.WrapTx(tx), ve.op, ve.vol.Info.Gid)
 		if err != nil {
 			logger.LogError("Failed to get bricks from op: %v", err)
@@ -321,10 +330,14 @@ func (vdel *VolumeDeleteOperation) ResourceUrl() string {
 	return ""
 }
 
+func (vdel *VolumeDeleteOperation) ClusterId() string {
+	return vdel.vol.Info.Cluster
+}
+
 // Build determines what volumes and bricks need to be deleted and
 // marks the db entries as such.
 func (vdel *VolumeDeleteOperation) Build(allocator Allocator) error {
-	return vdel.db.Update(func(tx *bolt.Tx) error {
+	return vdel.db.Update(func(tx wdb.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		brick_entries, err := vdel.vol.deleteVolumeComponents(txdb)
 		if err != nil {
@@ -337,6 +350,9 @@ func (vdel *VolumeDeleteOperation) Build(allocator Allocator) error {
 			}
 		}
 		vdel.op.RecordDeleteVolume(vdel.vol)
+		if e := vdel.vol.Save(tx); e != nil {
+			return e
+		}
 		if e := vdel.op.Save(tx); e != nil {
 			return e
 		}
@@ -345,7 +361,7 @@ func (vdel *VolumeDeleteOperation) Build(allocator Allocator) error {
 }
 
 // Exec performs the volume and brick deletions on the storage systems.
-func (vdel *VolumeDeleteOperation) Exec(executor executors.Executor) error {
+func (vdel *VolumeDeleteOperation) Exec(ctx context.Context, executor executors.Executor) error {
 	brick_entries, err := bricksFromOp(vdel.db, vdel.op, vdel.vol.Info.Gid)
 	if err != nil {
 		logger.LogError("Failed to get bricks from op: %v", err)
@@ -355,7 +371,8 @@ func (vdel *VolumeDeleteOperation) Exec(executor executors.Executor) error {
 	if err != nil {
 		return err
 	}
-	err = vdel.vol.deleteVolumeExec(vdel.db, executor, brick_entries, sshhost)
+	err = vdel.vol.deleteVolumeExec(vdel.db,
+		executors.WithContext(ctx, executor), brick_entries, sshhost)
 	if err != nil {
 		logger.LogError("Error executing delete volume: %v", err)
 	}
@@ -366,7 +383,7 @@ func (vdel *VolumeDeleteOperation) Rollback(executor executors.Executor) error {
 	// currently rollback only removes the pending operation for delete volume,
 	// leaving the db in the same state as it was before an exec failure.
 	// In the future we should make this operation resume-able
-	return vdel.db.Update(func(tx *bolt.Tx) error {
+	return vdel.db.Update(func(tx wdb.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		brick_entries, err := bricksFromOp(txdb, vdel.op, vdel.vol.Info.Gid)
 		if err != nil {
@@ -393,7 +410,7 @@ func (vdel *VolumeDeleteOperation) Rollback(executor executors.Executor) error {
 // Finalize marks all brick and volume entries for this operation as
 // fully deleted.
 func (vdel *VolumeDeleteOperation) Finalize() error {
-	return vdel.db.Update(func(tx *bolt.Tx) error {
+	return vdel.db.Update(func(tx wdb.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		brick_entries, err := bricksFromOp(txdb, vdel.op, vdel.vol.Info.Gid)
 		if err != nil {
@@ -415,6 +432,9 @@ type BlockVolumeCreateOperation struct {
 	OperationManager
 	bvol *BlockVolumeEntry
 	//vol *VolumeEntry
+
+	// cluster of the block hosting volume, set in Build
+	cluster string
 }
 
 // NewBlockVolumeCreateOperation  returns a new BlockVolumeCreateOperation  populated
@@ -440,10 +460,14 @@ func (bvc *BlockVolumeCreateOperation) ResourceUrl() string {
 	return fmt.Sprintf("/blockvolumes/%v", bvc.bvol.Info.Id)
 }
 
+func (bvc *BlockVolumeCreateOperation) ClusterId() string {
+	return bvc.cluster
+}
+
 // Build allocates and saves new volume and brick entries (tagged as pending)
 // in the db.
 func (bvc *BlockVolumeCreateOperation) Build(allocator Allocator) error {
-	return bvc.db.Update(func(tx *bolt.Tx) error {
+	return bvc.db.Update(func(tx wdb.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		clusters, volumes, err := bvc.bvol.eligibleClustersAndVolumes(txdb)
 		if err != nil {
@@ -451,7 +475,13 @@ func (bvc *BlockVolumeCreateOperation) Build(allocator Allocator) error {
 		}
 
 		if len(volumes) > 0 {
+			vol, err := NewVolumeEntryFromId(tx, volumes[0])
+			if err != nil {
+				return err
+			}
 			bvc.bvol.Info.BlockHostingVolume = volumes[0]
+			bvc.cluster = vol.Info.Cluster
+			bvc.bvol.Info.Cluster = vol.Info.Cluster
 		} else {
 			vol, err := NewVolumeEntryForBlockHosting(clusters)
 			if err != nil {
@@ -470,10 +500,12 @@ func (bvc *BlockVolumeCreateOperation) Build(allocator Allocator) error {
 				}
 			}
 			bvc.op.RecordAddHostingVolume(vol)
-			if e := bvc.bvol.Save(tx); e != nil {
+			if e := vol.Save(tx); e != nil {
 				return e
 			}
 			bvc.bvol.Info.BlockHostingVolume = vol.Info.Id
+			bvc.cluster = vol.Info.Cluster
+			bvc.bvol.Info.Cluster = vol.Info.Cluster
 		}
 
 		// we've figured out what block-volume, hosting volume, and bricks we
@@ -534,14 +566,14 @@ func (bvc *BlockVolumeCreateOperation) volAndBricks(db wdb.RODB) (
 }
 
 // Exec creates new bricks and volume on the underlying glusterfs storage system.
-func (bvc *BlockVolumeCreateOperation) Exec(executor executors.Executor) error {
+func (bvc *BlockVolumeCreateOperation) Exec(ctx context.Context, executor executors.Executor) error {
 	vol, brick_entries, err := bvc.volAndBricks(bvc.db)
 	if err != nil {
 		return err
 	}
 
 	if vol != nil {
-		err = vol.createVolumeExec(bvc.db, executor, brick_entries)
+		err = vol.createVolumeExec(ctx, bvc.db, executor, brick_entries)
 		if err != nil {
 			logger.LogError("Error executing create volume: %v", err)
 			return err
@@ -551,7 +583,11 @@ func (bvc *BlockVolumeCreateOperation) Exec(executor executors.Executor) error {
 	// of the block volume entry with values that come back from the exec commands.
 	// this doesn't break the Operation model but does mean this is non trivially
 	// resumeable if we ever add resume support to normal volume create.
-	err = bvc.bvol.createBlockVolume(bvc.db, executor, bvc.bvol.Info.BlockHostingVolume)
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	err = bvc.bvol.createBlockVolume(bvc.db,
+		executors.WithContext(ctx, executor), bvc.bvol.Info.BlockHostingVolume)
 	if err != nil {
 		logger.LogError("Error executing create block volume: %v", err)
 	}
@@ -560,7 +596,7 @@ func (bvc *BlockVolumeCreateOperation) Exec(executor executors.Executor) error {
 
 // Finalize marks our new volume and brick db entries as no longer pending.
 func (bvc *BlockVolumeCreateOperation) Finalize() error {
-	return bvc.db.Update(func(tx *bolt.Tx) error {
+	return bvc.db.Update(func(tx wdb.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		vol, brick_entries, err := bvc.volAndBricks(txdb)
 		if err != nil {
@@ -616,7 +652,7 @@ func (bvc *BlockVolumeCreateOperation) Rollback(executor executors.Executor) err
 			return err
 		}
 	}
-	err = bvc.db.Update(func(tx *bolt.Tx) error {
+	err = bvc.db.Update(func(tx wdb.Tx) error {
 		return bvc.op.Delete(tx)
 	})
 	return err
@@ -649,11 +685,18 @@ func (vdel *BlockVolumeDeleteOperation) ResourceUrl() string {
 	return ""
 }
 
+func (vdel *BlockVolumeDeleteOperation) ClusterId() string {
+	return vdel.bvol.Info.Cluster
+}
+
 // Build determines what volumes and bricks need to be deleted and
 // marks the db entries as such.
 func (vdel *BlockVolumeDeleteOperation) Build(allocator Allocator) error {
-	return vdel.db.Update(func(tx *bolt.Tx) error {
+	return vdel.db.Update(func(tx wdb.Tx) error {
 		vdel.op.RecordDeleteBlockVolume(vdel.bvol)
+		if e := vdel.bvol.Save(tx); e != nil {
+			return e
+		}
 		if e := vdel.op.Save(tx); e != nil {
 			return e
 		}
@@ -662,19 +705,20 @@ func (vdel *BlockVolumeDeleteOperation) Build(allocator Allocator) error {
 }
 
 // Exec performs the volume and brick deletions on the storage systems.
-func (vdel *BlockVolumeDeleteOperation) Exec(executor executors.Executor) error {
+func (vdel *BlockVolumeDeleteOperation) Exec(ctx context.Context, executor executors.Executor) error {
 	hvname, err := vdel.bvol.blockHostingVolumeName(vdel.db)
 	if err != nil {
 		return err
 	}
-	return vdel.bvol.deleteBlockVolumeExec(vdel.db, hvname, executor)
+	return vdel.bvol.deleteBlockVolumeExec(vdel.db, hvname,
+		executors.WithContext(ctx, executor))
 }
 
 func (vdel *BlockVolumeDeleteOperation) Rollback(executor executors.Executor) error {
 	// currently rollback only removes the pending operation for delete block volume,
 	// leaving the db in the same state as it was before an exec failure.
 	// In the future we should make this operation resume-able
-	return vdel.db.Update(func(tx *bolt.Tx) error {
+	return vdel.db.Update(func(tx wdb.Tx) error {
 		// REMINDER: Block volume delete and create are not symmetric in regards to
 		// removing vs. creating the block hosting volume
 		vdel.op.FinalizeBlockVolume(vdel.bvol)
@@ -690,7 +734,7 @@ func (vdel *BlockVolumeDeleteOperation) Rollback(executor executors.Executor) er
 // Finalize marks all brick and volume entries for this operation as
 // fully deleted.
 func (vdel *BlockVolumeDeleteOperation) Finalize() error {
-	return vdel.db.Update(func(tx *bolt.Tx) error {
+	return vdel.db.Update(func(tx wdb.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		if e := vdel.bvol.removeComponents(txdb); e != nil {
 			logger.LogError("Failed to remove block volume from db")
@@ -702,6 +746,138 @@ func (vdel *BlockVolumeDeleteOperation) Finalize() error {
 	})
 }
 
+// BlockVolumeAuthOperation implements the operation functions used to
+// enable, disable or rotate the CHAP credentials of an existing
+// block volume.
+type BlockVolumeAuthOperation struct {
+	OperationManager
+	bvol *BlockVolumeEntry
+	auth bool
+
+	// credentials reported by the executor, set in Exec
+	info *executors.BlockVolumeInfo
+}
+
+func NewBlockVolumeAuthOperation(
+	bvol *BlockVolumeEntry, db wdb.DB, auth bool) *BlockVolumeAuthOperation {
+
+	return &BlockVolumeAuthOperation{
+		OperationManager: OperationManager{
+			db: db,
+			op: NewPendingOperationEntry(NEW_ID),
+		},
+		bvol: bvol,
+		auth: auth,
+	}
+}
+
+func (bva *BlockVolumeAuthOperation) Label() string {
+	return "Modify Block Volume Auth"
+}
+
+func (bva *BlockVolumeAuthOperation) ResourceUrl() string {
+	return fmt.Sprintf("/blockvolumes/%v", bva.bvol.Info.Id)
+}
+
+func (bva *BlockVolumeAuthOperation) ClusterId() string {
+	return bva.bvol.Info.Cluster
+}
+
+// Build checks that the block volume has no other pending operation
+// and marks the block volume entry as pending in the db.
+func (bva *BlockVolumeAuthOperation) Build(allocator Allocator) error {
+	return bva.db.Update(func(tx wdb.Tx) error {
+		bv, err := NewBlockVolumeEntryFromId(tx, bva.bvol.Info.Id)
+		if err != nil {
+			return err
+		}
+		if !bv.Visible() {
+			logger.LogError("Block volume %v has a pending operation",
+				bv.Info.Id)
+			return ErrConflict
+		}
+
+		bva.op.RecordModifyBlockVolumeAuth(bv)
+		if e := bv.Save(tx); e != nil {
+			return e
+		}
+		if e := bva.op.Save(tx); e != nil {
+			return e
+		}
+		bva.bvol = bv
+		return nil
+	})
+}
+
+// Exec changes the auth settings of the block volume on the storage system.
+func (bva *BlockVolumeAuthOperation) Exec(ctx context.Context, executor executors.Executor) error {
+	hvname, err := bva.bvol.blockHostingVolumeName(bva.db)
+	if err != nil {
+		return err
+	}
+	bva.info, err = bva.bvol.modifyBlockVolumeAuthExec(
+		bva.db, hvname, executors.WithContext(ctx, executor), bva.auth)
+	if err != nil {
+		return err
+	}
+
+	// enabling auth on a volume that already has it rotates the
+	// credentials, which must not quietly store the old password again
+	if bva.auth && bva.bvol.Info.Auth &&
+		bva.info.Password == bva.bvol.Info.BlockVolume.Password {
+		return logger.LogError("Password of block volume %v was not changed",
+			bva.bvol.Info.Id)
+	}
+	return nil
+}
+
+// Rollback removes the pending operation and marks the block volume
+// entry, whose settings were not modified, as no longer pending.
+func (bva *BlockVolumeAuthOperation) Rollback(executor executors.Executor) error {
+	return bva.db.Update(func(tx wdb.Tx) error {
+		bv, err := NewBlockVolumeEntryFromId(tx, bva.bvol.Info.Id)
+		if err != nil {
+			return err
+		}
+
+		bva.op.FinalizeBlockVolume(bv)
+		if e := bv.Save(tx); e != nil {
+			return e
+		}
+		bva.bvol = bv
+
+		return bva.op.Delete(tx)
+	})
+}
+
+// Finalize records the new auth settings and credentials on the
+// block volume entry.
+func (bva *BlockVolumeAuthOperation) Finalize() error {
+	return bva.db.Update(func(tx wdb.Tx) error {
+		bv, err := NewBlockVolumeEntryFromId(tx, bva.bvol.Info.Id)
+		if err != nil {
+			return err
+		}
+
+		bv.Info.Auth = bva.auth
+		if bva.auth {
+			bv.Info.BlockVolume.Username = bva.info.Username
+			bv.Info.BlockVolume.Password = bva.info.Password
+		} else {
+			bv.Info.BlockVolume.Username = ""
+			bv.Info.BlockVolume.Password = ""
+		}
+		bva.op.FinalizeBlockVolume(bv)
+		if e := bv.Save(tx); e != nil {
+			return e
+		}
+		bva.bvol = bv
+
+		bva.op.Delete(tx)
+		return nil
+	})
+}
+
 // DeviceRemoveOperation is a phony-ish operation that exists
 // primarily to a) know that set state was being performed
 // and b) to serve as a starting point for a more proper
@@ -736,7 +912,7 @@ func (dro *DeviceRemoveOperation) ResourceUrl() string {
 }
 
 func (dro *DeviceRemoveOperation) Build(allocator Allocator) error {
-	return dro.db.Update(func(tx *bolt.Tx) error {
+	return dro.db.Update(func(tx wdb.Tx) error {
 		d, err := NewDeviceEntryFromId(tx, dro.DeviceId)
 		if err != nil {
 			return err
@@ -785,7 +961,7 @@ func (dro *DeviceRemoveOperation) deviceId() (string, error) {
 	return dro.op.Actions[0].Id, nil
 }
 
-func (dro *DeviceRemoveOperation) Exec(executor executors.Executor) error {
+func (dro *DeviceRemoveOperation) Exec(ctx context.Context, executor executors.Executor) error {
 	id, err := dro.deviceId()
 	if err != nil {
 		return err
@@ -795,7 +971,7 @@ func (dro *DeviceRemoveOperation) Exec(executor executors.Executor) error {
 	}
 
 	var d *DeviceEntry
-	if e := dro.db.View(func(tx *bolt.Tx) error {
+	if e := dro.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, id)
 		return err
 	}); e != nil {
@@ -806,11 +982,11 @@ func (dro *DeviceRemoveOperation) Exec(executor executors.Executor) error {
 	// its basically an intentional violation of the Operation model that
 	// we need to do if for now because the remove bricks code is an
 	// extra big tangle
-	return d.removeBricksFromDevice(dro.db, executor, dro.allocator)
+	return d.removeBricksFromDevice(ctx, dro.db, executor, dro.allocator)
 }
 
 func (dro *DeviceRemoveOperation) Rollback(executor executors.Executor) error {
-	return dro.db.Update(func(tx *bolt.Tx) error {
+	return dro.db.Update(func(tx wdb.Tx) error {
 		dro.op.Delete(tx)
 		return nil
 	})
@@ -824,7 +1000,7 @@ func (dro *DeviceRemoveOperation) Finalize() error {
 	if id == "" {
 		return nil
 	}
-	return dro.db.Update(func(tx *bolt.Tx) error {
+	return dro.db.Update(func(tx wdb.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		if e := markDeviceFailed(txdb, id, true); e != nil {
 			return e
@@ -840,7 +1016,7 @@ func bricksFromOp(db wdb.RODB,
 	op *PendingOperationEntry, gid int64) ([]*BrickEntry, error) {
 
 	brick_entries := []*BrickEntry{}
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx wdb.Tx) error {
 		for _, a := range op.Actions {
 			if a.Change == OpAddBrick || a.Change == OpDeleteBrick {
 				brick, err := NewBrickEntryFromId(tx, a.Id)
@@ -863,7 +1039,7 @@ func volumesFromOp(db wdb.RODB,
 	op *PendingOperationEntry) ([]*VolumeEntry, error) {
 
 	volume_entries := []*VolumeEntry{}
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx wdb.Tx) error {
 		for _, a := range op.Actions {
 			if a.Change == OpAddVolume {
 				brick, err := NewVolumeEntryFromId(tx, a.Id)
@@ -898,41 +1074,123 @@ func expandSizeFromOp(op *PendingOperationEntry) (sizeGB int, e error) {
 // then it has started the async function and the caller should respond to the
 // client with success - otherwise an error object is returned. In the async
 // function the Exec and Finalize or Rollback steps of the operation will be
-// performed.
+// performed. If the client cancels the operation while it is executed the
+// Rollback step is performed. The operation waits for the scheduler before
+// it is executed, and ErrTooManyOperations is returned if the scheduler
+// queue is full.
 func AsyncHttpOperation(app *App,
 	w http.ResponseWriter,
 	r *http.Request,
 	op Operation) error {
 
 	label := op.Label()
+	ticket, err := app.scheduler.Reserve()
+	if err != nil {
+		logger.LogError("%v rejected: %v", label, err)
+		return err
+	}
 	if err := op.Build(app.Allocator()); err != nil {
+		ticket.Release()
 		logger.LogError("%v Build Failed: %v", label, err)
 		return err
 	}
 
-	app.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
-		logger.Info("Started async operation: %v", label)
-		if err := op.Exec(app.executor); err != nil {
-			if rerr := op.Rollback(app.executor); rerr != nil {
+	err = app.asyncManager.start(w, r, true, func(ctx context.Context) (string, error) {
+		progress := operationProgress(ctx)
+		progress.SetPhase(OperationPhaseQueued)
+		ticket.Submit(operationId(op), operationCluster(op))
+		// an operation cancelled while queued did not change
+		// anything yet but its pending entries must be rolled back
+		err := ticket.Wait(ctx)
+		if err == nil {
+			defer ticket.Done()
+			logger.Info("Started async operation: %v", label)
+			progress.SetPhase(OperationPhaseExec)
+			err = execOperation(ctx, op, app.executor)
+		}
+		if err != nil {
+			// the rollback must run to completion even if the
+			// operation was cancelled
+			progress.SetPhase(OperationPhaseRollback)
+			rexecutor := executors.WithContext(detachContext(ctx), app.executor)
+			if rerr := op.Rollback(rexecutor); rerr != nil {
 				logger.LogError("%v Rollback error: %v", label, rerr)
 			}
 			logger.LogError("%v Failed: %v", label, err)
 			return "", err
 		}
-		if err := op.Finalize(); err != nil {
+		progress.SetPhase(OperationPhaseFinalize)
+		if err := finalizeOperation(op, app.executor); err != nil {
 			logger.LogError("%v Finalize failed: %v", label, err)
 			return "", err
 		}
 		logger.Info("%v succeeded", label)
 		return op.ResourceUrl(), nil
 	})
+	if err != nil {
+		// the async function was not started, nothing was executed
+		// but the pending entries made by Build must be rolled back
+		ticket.Release()
+		if rerr := op.Rollback(app.executor); rerr != nil {
+			logger.LogError("%v Rollback error: %v", label, rerr)
+		}
+		logger.LogError("%v Failed: %v", label, err)
+		return err
+	}
+	return nil
+}
+
+// AsyncHttpScheduledFunc runs handlerfunc as an async http function
+// once the scheduler has a free slot for an operation on cluster. It
+// is used for the requests that change the state of the nodes and
+// devices, which are not a single Operation but run operations of
+// their own. ErrTooManyOperations is returned if the scheduler queue
+// is full, in which case nothing was started.
+func AsyncHttpScheduledFunc(app *App,
+	w http.ResponseWriter,
+	r *http.Request,
+	cluster string,
+	handlerfunc func() (string, error)) error {
+
+	ticket, err := app.scheduler.Reserve()
+	if err != nil {
+		return err
+	}
+
+	err = app.asyncManager.start(w, r, false, func(ctx context.Context) (string, error) {
+		progress := operationProgress(ctx)
+		progress.SetPhase(OperationPhaseQueued)
+		ticket.Submit("", cluster)
+		if err := ticket.Wait(ctx); err != nil {
+			return "", err
+		}
+		defer ticket.Done()
+		progress.SetPhase(OperationPhaseExec)
+		return handlerfunc()
+	})
+	if err != nil {
+		ticket.Release()
+		return err
+	}
 	return nil
 }
 
+// OperationHttpError responds to a request for which AsyncHttpOperation
+// failed with msg. Requests rejected because the operation queue is
+// full get a 429 status telling the client when to retry.
+func OperationHttpError(w http.ResponseWriter, msg string, err error) {
+	if err == ErrTooManyOperations {
+		w.Header().Set("Retry-After", strconv.Itoa(OperationRetryAfter))
+		http.Error(w, msg, http.StatusTooManyRequests)
+		return
+	}
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
 // RunOperation performs all steps of an Operation and returns
 // an error if any of those steps fail. This function is meant to
 // make it easy to run an operation outside of the rest endpoints
-// and should only be used in test code.
+// and should only be used in test code and dry runs.
 func RunOperation(o Operation,
 	allocator Allocator,
 	executor executors.Executor) (err error) {
@@ -949,14 +1207,14 @@ func RunOperation(o Operation,
 		logger.LogError("%v Build Failed: %v", label, err)
 		return err
 	}
-	if err := o.Exec(executor); err != nil {
+	if err := execOperation(context.Background(), o, executor); err != nil {
 		if rerr := o.Rollback(executor); rerr != nil {
 			logger.LogError("%v Rollback error: %v", label, rerr)
 		}
 		logger.LogError("%v Failed: %v", label, err)
 		return err
 	}
-	if err := o.Finalize(); err != nil {
+	if err := finalizeOperation(o, executor); err != nil {
 		return err
 	}
 	return nil
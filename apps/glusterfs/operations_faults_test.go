@@ -0,0 +1,452 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/faultexec"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
+
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/heketi/tests"
+)
+
+// faultKilled is what the tests panic with instead of exiting when a
+// fault kills the process.
+type faultKilled string
+
+// concurrentPoints are called by goroutines of their own, the panic
+// the tests are killed with can not be recovered there.
+var concurrentPoints = map[string]bool{
+	"BrickCreate":       true,
+	"BrickDestroy":      true,
+	"BrickDestroyCheck": true,
+}
+
+// faultCase is an operation run with faults injected at the calls of
+// the executor methods it makes.
+type faultCase struct {
+	name string
+	// setup creates the entries the operation needs in app and returns
+	// the operation
+	setup  func(t *testing.T, app *App) Operation
+	points []faultexec.FaultRule
+}
+
+// dbCounts returns the number of volumes, bricks and block volumes.
+func dbCounts(t *testing.T, db wdb.RODB) (counts [3]int) {
+	err := db.View(func(tx wdb.Tx) error {
+		vl, err := VolumeList(tx)
+		if err != nil {
+			return err
+		}
+		bl, err := BrickList(tx)
+		if err != nil {
+			return err
+		}
+		bvl, err := BlockVolumeList(tx)
+		if err != nil {
+			return err
+		}
+		counts = [3]int{len(vl), len(bl), len(bvl)}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return
+}
+
+// checkDbConsistent returns an error if an entry refers to an entry
+// that does not exist, if an entry is pending on an operation that
+// does not exist, or if a pending operation refers to entries that do
+// not exist or are not pending on it.
+func checkDbConsistent(db wdb.RODB) error {
+	return db.View(func(tx wdb.Tx) error {
+		ops := map[string]bool{}
+		ids, err := PendingOperationList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			ops[id] = true
+			op, err := NewPendingOperationEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			for _, a := range op.Actions {
+				var pending string
+				switch a.Change {
+				case OpAddBrick, OpDeleteBrick:
+					b, err := NewBrickEntryFromId(tx, a.Id)
+					if err != nil {
+						return fmt.Errorf("op %v: brick %v: %v", id, a.Id, err)
+					}
+					pending = b.Pending.Id
+				case OpAddVolume, OpDeleteVolume, OpExpandVolume:
+					v, err := NewVolumeEntryFromId(tx, a.Id)
+					if err != nil {
+						return fmt.Errorf("op %v: volume %v: %v", id, a.Id, err)
+					}
+					pending = v.Pending.Id
+					if a.Change == OpExpandVolume {
+						pending = id
+					}
+				case OpAddBlockVolume, OpDeleteBlockVolume, OpModifyBlockVolumeAuth:
+					bv, err := NewBlockVolumeEntryFromId(tx, a.Id)
+					if err != nil {
+						return fmt.Errorf("op %v: block volume %v: %v", id, a.Id, err)
+					}
+					pending = bv.Pending.Id
+				case OpRemoveDevice:
+					if _, err := NewDeviceEntryFromId(tx, a.Id); err != nil {
+						return fmt.Errorf("op %v: device %v: %v", id, a.Id, err)
+					}
+					pending = id
+				}
+				if pending != id {
+					return fmt.Errorf("op %v: entry %v is pending on %q",
+						id, a.Id, pending)
+				}
+			}
+		}
+
+		vl, err := VolumeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range vl {
+			v, err := NewVolumeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if v.Pending.Id != "" && !ops[v.Pending.Id] {
+				return fmt.Errorf("volume %v: pending on missing op %v",
+					id, v.Pending.Id)
+			}
+			for _, bid := range v.Bricks {
+				if _, err := NewBrickEntryFromId(tx, bid); err != nil {
+					return fmt.Errorf("volume %v: brick %v: %v", id, bid, err)
+				}
+			}
+			if !v.Info.Block {
+				continue
+			}
+			used := 0
+			for _, bvid := range v.Info.BlockInfo.BlockVolumes {
+				bv, err := NewBlockVolumeEntryFromId(tx, bvid)
+				if err != nil {
+					return fmt.Errorf("volume %v: block volume %v: %v",
+						id, bvid, err)
+				}
+				used += bv.Info.Size
+			}
+			if v.Info.BlockInfo.FreeSize+used != v.Info.Size {
+				return fmt.Errorf("volume %v: %v free and %v used out of %v",
+					id, v.Info.BlockInfo.FreeSize, used, v.Info.Size)
+			}
+		}
+
+		bl, err := BrickList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range bl {
+			b, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if b.Pending.Id != "" && !ops[b.Pending.Id] {
+				return fmt.Errorf("brick %v: pending on missing op %v",
+					id, b.Pending.Id)
+			}
+			if _, err := NewVolumeEntryFromId(tx, b.Info.VolumeId); err != nil {
+				return fmt.Errorf("brick %v: volume %v: %v",
+					id, b.Info.VolumeId, err)
+			}
+			d, err := NewDeviceEntryFromId(tx, b.Info.DeviceId)
+			if err != nil {
+				return fmt.Errorf("brick %v: device %v: %v",
+					id, b.Info.DeviceId, err)
+			}
+			found := false
+			for _, dbid := range d.Bricks {
+				found = found || dbid == id
+			}
+			if !found {
+				return fmt.Errorf("brick %v: not in device %v", id, d.Info.Id)
+			}
+		}
+
+		dl, err := DeviceList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range dl {
+			d, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			for _, bid := range d.Bricks {
+				if _, err := NewBrickEntryFromId(tx, bid); err != nil {
+					return fmt.Errorf("device %v: brick %v: %v", id, bid, err)
+				}
+			}
+		}
+
+		bvl, err := BlockVolumeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range bvl {
+			bv, err := NewBlockVolumeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if bv.Pending.Id != "" && !ops[bv.Pending.Id] {
+				return fmt.Errorf("block volume %v: pending on missing op %v",
+					id, bv.Pending.Id)
+			}
+			if _, err := NewVolumeEntryFromId(tx, bv.Info.BlockHostingVolume); err != nil {
+				return fmt.Errorf("block volume %v: hosting volume %v: %v",
+					id, bv.Info.BlockHostingVolume, err)
+			}
+		}
+		return nil
+	})
+}
+
+// runWithFaults runs op with the faults of rules injected. Killed is
+// true if a fault killed the process.
+func runWithFaults(t *testing.T, app *App, op Operation,
+	rules []faultexec.FaultRule) (err error, killed bool) {
+
+	injector, e := faultexec.NewInjector(rules)
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(faultKilled); !ok {
+				panic(r)
+			}
+			killed = true
+		}
+	}()
+	err = RunOperation(op, app.Allocator(),
+		faultexec.NewFaultExecutor(app.executor, injector))
+	return
+}
+
+func faultTestVolume(t *testing.T, app *App, size int) *VolumeEntry {
+	req := &api.VolumeCreateRequest{}
+	req.Size = size
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol := NewVolumeEntryFromRequest(req)
+	err := vol.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return vol
+}
+
+func faultTestBlockVolume(t *testing.T, app *App) *BlockVolumeEntry {
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 100
+	bv := NewBlockVolumeEntryFromRequest(req)
+	err := bv.Create(app.db, app.executor, app.Allocator())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return bv
+}
+
+var operationFaultCases = []faultCase{
+	{
+		name: "VolumeCreateOperation",
+		setup: func(t *testing.T, app *App) Operation {
+			req := &api.VolumeCreateRequest{}
+			req.Size = 1024
+			req.Durability.Type = api.DurabilityReplicate
+			req.Durability.Replicate.Replica = 3
+			return NewVolumeCreateOperation(NewVolumeEntryFromRequest(req), app.db)
+		},
+		points: []faultexec.FaultRule{
+			{Point: "BrickCreate", Nth: 1},
+			{Point: "BrickCreate", Nth: 3},
+			{Point: "VolumeCreate", Nth: 1},
+		},
+	},
+	{
+		name: "VolumeExpandOperation",
+		setup: func(t *testing.T, app *App) Operation {
+			vol := faultTestVolume(t, app, 100)
+			return NewVolumeExpandOperation(vol, app.db, 100)
+		},
+		points: []faultexec.FaultRule{
+			{Point: "BrickCreate", Nth: 2},
+			{Point: "VolumeExpand", Nth: 1},
+		},
+	},
+	{
+		name: "VolumeDeleteOperation",
+		setup: func(t *testing.T, app *App) Operation {
+			vol := faultTestVolume(t, app, 100)
+			return NewVolumeDeleteOperation(vol, app.db)
+		},
+		points: []faultexec.FaultRule{
+			{Point: "VolumeDestroyCheck", Nth: 1},
+			{Point: "BrickDestroyCheck", Nth: 2},
+			{Point: "VolumeDestroy", Nth: 1},
+			{Point: "BrickDestroy", Nth: 2},
+		},
+	},
+	{
+		name: "BlockVolumeCreateOperation",
+		setup: func(t *testing.T, app *App) Operation {
+			req := &api.BlockVolumeCreateRequest{}
+			req.Size = 100
+			return NewBlockVolumeCreateOperation(
+				NewBlockVolumeEntryFromRequest(req), app.db)
+		},
+		points: []faultexec.FaultRule{
+			{Point: "BrickCreate", Nth: 2},
+			{Point: "VolumeCreate", Nth: 1},
+			{Point: "BlockVolumeCreate", Nth: 1},
+		},
+	},
+	{
+		name: "BlockVolumeDeleteOperation",
+		setup: func(t *testing.T, app *App) Operation {
+			return NewBlockVolumeDeleteOperation(
+				faultTestBlockVolume(t, app), app.db)
+		},
+		points: []faultexec.FaultRule{
+			{Point: "BlockVolumeDestroy", Nth: 1},
+		},
+	},
+	{
+		name: "BlockVolumeAuthOperation",
+		setup: func(t *testing.T, app *App) Operation {
+			return NewBlockVolumeAuthOperation(
+				faultTestBlockVolume(t, app), app.db, true)
+		},
+		points: []faultexec.FaultRule{
+			{Point: "BlockVolumeModifyAuth", Nth: 1},
+		},
+	},
+	{
+		name: "DeviceRemoveOperation",
+		setup: func(t *testing.T, app *App) Operation {
+			vol := faultTestVolume(t, app, 100)
+			app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+				return mockVolumeInfoFromDb(app.db, volume)
+			}
+			app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+				return mockHealStatusFromDb(app.db, volume)
+			}
+
+			var d *DeviceEntry
+			err := app.db.View(func(tx wdb.Tx) error {
+				b, err := NewBrickEntryFromId(tx, vol.Bricks[0])
+				if err != nil {
+					return err
+				}
+				d, err = NewDeviceEntryFromId(tx, b.Info.DeviceId)
+				return err
+			})
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			err = d.SetState(app.db, app.executor, app.Allocator(),
+				api.EntryStateOffline)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			return NewDeviceRemoveOperation(d.Info.Id, app.Allocator(), app.db)
+		},
+		points: []faultexec.FaultRule{
+			{Point: "BrickCreate", Nth: 1},
+			{Point: "VolumeReplaceBrick", Nth: 1},
+		},
+	},
+}
+
+// runOperationFault runs the operation of c in a new app with rule
+// injected and returns the error of the operation.
+func runOperationFault(t *testing.T, c faultCase,
+	rule faultexec.FaultRule) (err error, killed bool, app *App) {
+
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	app = NewTestApp(tmpfile)
+
+	err = setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	op := c.setup(t, app)
+	before := dbCounts(t, app.db)
+	err, killed = runWithFaults(t, app, op, []faultexec.FaultRule{rule})
+
+	e := checkDbConsistent(app.db)
+	tests.Assert(t, e == nil, c.name, rule, "left the db inconsistent:", e)
+	if err != nil && !killed {
+		// a failed operation must be rolled back completely
+		tests.Assert(t, !HasPendingOperations(app.db),
+			c.name, rule, "left pending operations")
+		after := dbCounts(t, app.db)
+		tests.Assert(t, before == after, c.name, rule,
+			"changed the entries from", before, "to", after)
+	}
+	return
+}
+
+func TestOperationsRollbackOnFaults(t *testing.T) {
+	for _, c := range operationFaultCases {
+		rules := append([]faultexec.FaultRule{
+			{Point: c.name + ".Exec:start"},
+			{Point: c.name + ".Exec:done"},
+		}, c.points...)
+		for _, rule := range rules {
+			rule.Error = "injected fault"
+			err, killed, app := runOperationFault(t, c, rule)
+			app.Close()
+			tests.Assert(t, !killed)
+			tests.Assert(t, err != nil, c.name, rule, "expected err != nil")
+		}
+	}
+}
+
+func TestOperationsConsistentOnKill(t *testing.T) {
+	defer tests.Patch(&faultexec.Kill, func(point string) {
+		panic(faultKilled(point))
+	}).Restore()
+
+	for _, c := range operationFaultCases {
+		rules := append([]faultexec.FaultRule{
+			{Point: c.name + ".Exec:start"},
+			{Point: c.name + ".Exec:done"},
+			{Point: c.name + ".Finalize:start"},
+			{Point: c.name + ".Finalize:done"},
+		}, c.points...)
+		for _, rule := range rules {
+			if concurrentPoints[rule.Point] {
+				continue
+			}
+			rule.Kill = true
+			_, killed, app := runOperationFault(t, c, rule)
+			tests.Assert(t, killed, c.name, rule, "expected the fault to kill")
+			if rule.Point == c.name+".Finalize:done" {
+				// killed once the operation was committed
+				tests.Assert(t, !HasPendingOperations(app.db),
+					c.name, "left pending operations")
+			}
+			app.Close()
+		}
+	}
+}
@@ -1,19 +1,25 @@
 package glusterfs
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/recordexec"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
 
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/heketi/tests"
 
 	"github.com/gorilla/mux"
@@ -44,7 +50,7 @@ func TestVolumeCreatePendingCreatedCleared(t *testing.T) {
 	vc := NewVolumeCreateOperation(vol, app.db)
 
 	// verify that there are no volumes, bricks or pending operations
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got", len(vl))
@@ -61,7 +67,7 @@ func TestVolumeCreatePendingCreatedCleared(t *testing.T) {
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// verify volumes, bricks, & pending ops exist
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 1, "expected len(vl) == 1, got", len(vl))
@@ -87,14 +93,14 @@ func TestVolumeCreatePendingCreatedCleared(t *testing.T) {
 		return nil
 	})
 
-	e = vc.Exec(app.executor)
+	e = vc.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	e = vc.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// verify volumes & bricks exist but pending is gone
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 1, "expected len(vl) == 1, got", len(vl))
@@ -146,7 +152,7 @@ func TestVolumeCreatePendingRollback(t *testing.T) {
 	vc := NewVolumeCreateOperation(vol, app.db)
 
 	// verify that there are no volumes, bricks or pending operations
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got", len(vl))
@@ -163,7 +169,7 @@ func TestVolumeCreatePendingRollback(t *testing.T) {
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// verify volumes, bricks, & pending ops exist
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 1, "expected len(vl) == 1, got", len(vl))
@@ -189,14 +195,14 @@ func TestVolumeCreatePendingRollback(t *testing.T) {
 		return nil
 	})
 
-	e = vc.Exec(app.executor)
+	e = vc.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	e = vc.Rollback(app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// verify that there are no volumes, bricks or pending operations
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got", len(vl))
@@ -235,7 +241,7 @@ func TestVolumeCreatePendingNoSpace(t *testing.T) {
 	vc := NewVolumeCreateOperation(vol, app.db)
 
 	// verify that there are no volumes, bricks or pending operations
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got", len(vl))
@@ -253,7 +259,7 @@ func TestVolumeCreatePendingNoSpace(t *testing.T) {
 	tests.Assert(t, e == ErrNoSpace, "expected e == ErrNoSpace, got", e)
 
 	// verify no volumes, bricks or pending ops in db
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got", len(vl))
@@ -292,7 +298,7 @@ func TestVolumeCreatePendingBrickMissing(t *testing.T) {
 	vc := NewVolumeCreateOperation(vol, app.db)
 
 	// verify that there are no volumes, bricks or pending operations
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got", len(vl))
@@ -309,7 +315,7 @@ func TestVolumeCreatePendingBrickMissing(t *testing.T) {
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// verify volumes, bricks, & pending ops exist
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 1, "expected len(vl) == 1, got", len(vl))
@@ -335,7 +341,7 @@ func TestVolumeCreatePendingBrickMissing(t *testing.T) {
 		return nil
 	})
 
-	app.db.Update(func(tx *bolt.Tx) error {
+	app.db.Update(func(tx wdb.Tx) error {
 		bl, e := BrickList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		b, e := NewBrickEntryFromId(tx, bl[0])
@@ -348,7 +354,7 @@ func TestVolumeCreatePendingBrickMissing(t *testing.T) {
 	// now that the brick list in the db is broken Exec/Finalize/Rollback
 	// will return errors
 
-	e = vc.Exec(app.executor)
+	e = vc.Exec(context.Background(), app.executor)
 	tests.Assert(t, e != nil, "expected e != nil, got", e)
 
 	e = vc.Finalize()
@@ -419,12 +425,12 @@ func TestVolumeDeleteOperation(t *testing.T) {
 
 	e := vc.Build(app.Allocator())
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
-	e = vc.Exec(app.executor)
+	e = vc.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 	e = vc.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bl, e := BrickList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bl) == 3, "expected len(bl) == 3, got:", len(bl))
@@ -438,7 +444,7 @@ func TestVolumeDeleteOperation(t *testing.T) {
 	e = vd.Build(app.Allocator())
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bl, e := BrickList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bl) == 3, "expected len(bl) == 3, got:", len(bl))
@@ -448,12 +454,12 @@ func TestVolumeDeleteOperation(t *testing.T) {
 		return nil
 	})
 
-	e = vd.Exec(app.executor)
+	e = vd.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 	e = vd.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bl, e := BrickList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bl) == 0, "expected len(bl) == 0, got:", len(bl))
@@ -491,12 +497,12 @@ func TestVolumeDeleteOperationRollback(t *testing.T) {
 
 	e := vc.Build(app.Allocator())
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
-	e = vc.Exec(app.executor)
+	e = vc.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 	e = vc.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bl, e := BrickList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bl) == 3, "expected len(bl) == 3, got:", len(bl))
@@ -510,7 +516,7 @@ func TestVolumeDeleteOperationRollback(t *testing.T) {
 	e = vd.Build(app.Allocator())
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bl, e := BrickList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bl) == 3, "expected len(bl) == 3, got:", len(bl))
@@ -523,7 +529,7 @@ func TestVolumeDeleteOperationRollback(t *testing.T) {
 	e = vd.Rollback(app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 1, "expected len(vl) == 1, got:", len(vl))
@@ -564,12 +570,12 @@ func TestVolumeExpandOperation(t *testing.T) {
 
 	e := vc.Build(app.Allocator())
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
-	e = vc.Exec(app.executor)
+	e = vc.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 	e = vc.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bl, e := BrickList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bl) == 3, "expected len(bl) == 3, got:", len(bl))
@@ -583,7 +589,7 @@ func TestVolumeExpandOperation(t *testing.T) {
 	e = ve.Build(app.Allocator())
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bl, e := BrickList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bl) == 6, "expected len(bl) == 6, got:", len(bl))
@@ -602,13 +608,13 @@ func TestVolumeExpandOperation(t *testing.T) {
 		return nil
 	})
 
-	e = ve.Exec(app.executor)
+	e = ve.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
 	e = ve.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bl, e := BrickList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bl) == 6, "expected len(bl) == 6, got:", len(bl))
@@ -651,7 +657,7 @@ func TestBlockVolumeCreateOperation(t *testing.T) {
 	vc := NewBlockVolumeCreateOperation(vol, app.db)
 
 	// verify that there are no volumes, bricks or pending operations
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got", len(vl))
@@ -668,7 +674,7 @@ func TestBlockVolumeCreateOperation(t *testing.T) {
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// verify there is one pending op, volume and some bricks
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 1, "expected len(vl) == 1, got", len(vl))
@@ -681,14 +687,14 @@ func TestBlockVolumeCreateOperation(t *testing.T) {
 		return nil
 	})
 
-	e = vc.Exec(app.executor)
+	e = vc.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	e = vc.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// verify the volume and bricks exist but no pending op
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 1, "expected len(vl) == 1, got", len(vl))
@@ -731,12 +737,12 @@ func TestBlockVolumeCreateOperationExistingHostVol(t *testing.T) {
 
 	e := vc.Build(app.Allocator())
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
-	e = vc.Exec(app.executor)
+	e = vc.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 	e = vc.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 0, "expected len(bvl) == 0, got", len(bvl))
@@ -763,7 +769,7 @@ func TestBlockVolumeCreateOperationExistingHostVol(t *testing.T) {
 
 	// at this point we shouldn't have a new volume or bricks,
 	// just a pending op for the block volume itself
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 1, "expected len(bvl) == 1, got", len(bvl))
@@ -779,14 +785,14 @@ func TestBlockVolumeCreateOperationExistingHostVol(t *testing.T) {
 		return nil
 	})
 
-	e = bco.Exec(app.executor)
+	e = bco.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
 	e = bco.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
 	// the block volume is there but the pending op is gone
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 1, "expected len(bvl) == 1, got", len(bvl))
@@ -826,7 +832,7 @@ func TestBlockVolumeCreateOperationRollback(t *testing.T) {
 	vc := NewBlockVolumeCreateOperation(vol, app.db)
 
 	// verify that there are no volumes, bricks or pending operations
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got", len(vl))
@@ -843,7 +849,7 @@ func TestBlockVolumeCreateOperationRollback(t *testing.T) {
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// verify there is one pending op, volume and some bricks
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 1, "expected len(vl) == 1, got", len(vl))
@@ -856,7 +862,7 @@ func TestBlockVolumeCreateOperationRollback(t *testing.T) {
 		return nil
 	})
 
-	e = vc.Exec(app.executor)
+	e = vc.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// it doesn't matter if exec worked, were going to rollback for test
@@ -864,7 +870,7 @@ func TestBlockVolumeCreateOperationRollback(t *testing.T) {
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// verify that everything got trashed
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 0, "expected len(bvl) == 0, got", len(bvl))
@@ -910,12 +916,12 @@ func TestBlockVolumeCreateOperationExistingHostVolRollback(t *testing.T) {
 
 	e := vc.Build(app.Allocator())
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
-	e = vc.Exec(app.executor)
+	e = vc.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 	e = vc.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 0, "expected len(bvl) == 0, got", len(bvl))
@@ -942,7 +948,7 @@ func TestBlockVolumeCreateOperationExistingHostVolRollback(t *testing.T) {
 
 	// at this point we shouldn't have a new volume or bricks,
 	// just a pending op for the block volume itself
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 1, "expected len(bvl) == 1, got", len(bvl))
@@ -958,7 +964,7 @@ func TestBlockVolumeCreateOperationExistingHostVolRollback(t *testing.T) {
 		return nil
 	})
 
-	e = bco.Exec(app.executor)
+	e = bco.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got:", e)
 
 	// it doesn't matter if exec worked, were going to rollback for test
@@ -966,7 +972,7 @@ func TestBlockVolumeCreateOperationExistingHostVolRollback(t *testing.T) {
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// verify that only the block volume got trashed
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 0, "expected len(bvl) == 0, got", len(bvl))
@@ -1006,7 +1012,7 @@ func TestBlockVolumeDeleteOperation(t *testing.T) {
 	vc := NewBlockVolumeCreateOperation(vol, app.db)
 
 	// verify that there are no volumes, bricks or pending operations
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got", len(vl))
@@ -1021,13 +1027,13 @@ func TestBlockVolumeDeleteOperation(t *testing.T) {
 
 	e := vc.Build(app.Allocator())
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
-	e = vc.Exec(app.executor)
+	e = vc.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 	e = vc.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// verify the volume and bricks exist but no pending op
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 1, "expected len(bvl) == 1, got", len(bvl))
@@ -1049,7 +1055,7 @@ func TestBlockVolumeDeleteOperation(t *testing.T) {
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// we should now have a pending op for the delete
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 1, "expected len(bvl) == 1, got", len(bvl))
@@ -1065,14 +1071,14 @@ func TestBlockVolumeDeleteOperation(t *testing.T) {
 		return nil
 	})
 
-	e = bdel.Exec(app.executor)
+	e = bdel.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	e = bdel.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// the block volume and pending op should be gone. hosting volume stays
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 0, "expected len(bvl) == 0, got", len(bvl))
@@ -1112,7 +1118,7 @@ func TestBlockVolumeDeleteOperationRollback(t *testing.T) {
 	vc := NewBlockVolumeCreateOperation(vol, app.db)
 
 	// verify that there are no volumes, bricks or pending operations
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		vl, e := VolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got", len(vl))
@@ -1127,13 +1133,13 @@ func TestBlockVolumeDeleteOperationRollback(t *testing.T) {
 
 	e := vc.Build(app.Allocator())
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
-	e = vc.Exec(app.executor)
+	e = vc.Exec(context.Background(), app.executor)
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 	e = vc.Finalize()
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// verify the volume and bricks exist but no pending op
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 1, "expected len(bvl) == 1, got", len(bvl))
@@ -1155,7 +1161,7 @@ func TestBlockVolumeDeleteOperationRollback(t *testing.T) {
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// we should now have a pending op for the delete
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 1, "expected len(bvl) == 1, got", len(bvl))
@@ -1175,7 +1181,7 @@ func TestBlockVolumeDeleteOperationRollback(t *testing.T) {
 	tests.Assert(t, e == nil, "expected e == nil, got", e)
 
 	// the pending op should be gone, but other items remain
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bvl, e := BlockVolumeList(tx)
 		tests.Assert(t, e == nil, "expected e == nil, got", e)
 		tests.Assert(t, len(bvl) == 1, "expected len(bvl) == 1, got", len(bvl))
@@ -1210,7 +1216,7 @@ func TestDeviceRemoveOperationEmpty(t *testing.T) {
 
 	// grab a device
 	var d *DeviceEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		dl, err := DeviceList(tx)
 		if err != nil {
 			return err
@@ -1235,14 +1241,14 @@ func TestDeviceRemoveOperationEmpty(t *testing.T) {
 
 	// because there are no bricks on this device it can be disabled
 	// instantly and there are no pending ops for it in the db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		l, err := PendingOperationList(tx)
 		tests.Assert(t, err == nil, "expected err == nil, got:", err)
 		tests.Assert(t, len(l) == 0, "expected len(l) == 0, got:", len(l))
 		return nil
 	})
 
-	err = dro.Exec(app.executor)
+	err = dro.Exec(context.Background(), app.executor)
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
 	err = dro.Finalize()
@@ -1278,7 +1284,7 @@ func TestDeviceRemoveOperationWithBricks(t *testing.T) {
 
 	// grab a devices that has bricks
 	var d *DeviceEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		dl, err := DeviceList(tx)
 		if err != nil {
 			return err
@@ -1306,7 +1312,7 @@ func TestDeviceRemoveOperationWithBricks(t *testing.T) {
 
 	// because there were bricks on this device it needs to perform
 	// a full "operation cycle"
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		l, err := PendingOperationList(tx)
 		tests.Assert(t, err == nil, "expected err == nil, got:", err)
 		tests.Assert(t, len(l) == 1, "expected len(l) == 1, got:", len(l))
@@ -1320,11 +1326,11 @@ func TestDeviceRemoveOperationWithBricks(t *testing.T) {
 		return mockHealStatusFromDb(app.db, volume)
 	}
 
-	err = dro.Exec(app.executor)
+	err = dro.Exec(context.Background(), app.executor)
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
 	// operation is not over. we should still have a pending op
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		l, err := PendingOperationList(tx)
 		tests.Assert(t, err == nil, "expected err == nil, got:", err)
 		tests.Assert(t, len(l) == 1, "expected len(l) == 1, got:", len(l))
@@ -1335,7 +1341,7 @@ func TestDeviceRemoveOperationWithBricks(t *testing.T) {
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
 	// operation is over. we should _not_ have a pending op now
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		l, err := PendingOperationList(tx)
 		tests.Assert(t, err == nil, "expected err == nil, got:", err)
 		tests.Assert(t, len(l) == 0, "expected len(l) == 0, got:", len(l))
@@ -1343,7 +1349,7 @@ func TestDeviceRemoveOperationWithBricks(t *testing.T) {
 	})
 
 	// update d from db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -1383,7 +1389,7 @@ func TestDeviceRemoveOperationTooFewDevices(t *testing.T) {
 
 	// grab a devices that has bricks
 	var d *DeviceEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		dl, err := DeviceList(tx)
 		if err != nil {
 			return err
@@ -1411,7 +1417,7 @@ func TestDeviceRemoveOperationTooFewDevices(t *testing.T) {
 
 	// because there were bricks on this device it needs to perform
 	// a full "operation cycle"
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		l, err := PendingOperationList(tx)
 		tests.Assert(t, err == nil, "expected err == nil, got:", err)
 		tests.Assert(t, len(l) == 1, "expected len(l) == 1, got:", len(l))
@@ -1425,13 +1431,13 @@ func TestDeviceRemoveOperationTooFewDevices(t *testing.T) {
 		return mockHealStatusFromDb(app.db, volume)
 	}
 
-	err = dro.Exec(app.executor)
+	err = dro.Exec(context.Background(), app.executor)
 	tests.Assert(t, strings.Contains(err.Error(), ErrNoReplacement.Error()),
 		"expected strings.Contains(err.Error(), ErrNoReplacement.Error()), got:",
 		err.Error())
 
 	// operation is not over. we should still have a pending op
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		l, err := PendingOperationList(tx)
 		tests.Assert(t, err == nil, "expected err == nil, got:", err)
 		tests.Assert(t, len(l) == 1, "expected len(l) == 1, got:", len(l))
@@ -1442,7 +1448,7 @@ func TestDeviceRemoveOperationTooFewDevices(t *testing.T) {
 	tests.Assert(t, err == nil, "expected err == nil, got:", err)
 
 	// operation is over. we should _not_ have a pending op now
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		l, err := PendingOperationList(tx)
 		tests.Assert(t, err == nil, "expected err == nil, got:", err)
 		tests.Assert(t, len(l) == 0, "expected len(l) == 0, got:", len(l))
@@ -1450,7 +1456,7 @@ func TestDeviceRemoveOperationTooFewDevices(t *testing.T) {
 	})
 
 	// update d from db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
 		return err
 	})
@@ -1490,7 +1496,7 @@ func TestDeviceRemoveOperationOtherPendingOps(t *testing.T) {
 
 	// grab a devices that has bricks
 	var d *DeviceEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		dl, err := DeviceList(tx)
 		if err != nil {
 			return err
@@ -1515,7 +1521,7 @@ func TestDeviceRemoveOperationOtherPendingOps(t *testing.T) {
 	err = vc.Build(app.Allocator())
 	tests.Assert(t, err == nil, "expected e == nil, got", err)
 	// we should have one pending operation
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		l, err := PendingOperationList(tx)
 		tests.Assert(t, err == nil, "expected err == nil, got:", err)
 		tests.Assert(t, len(l) == 1, "expected len(l) == 1, got:", len(l))
@@ -1530,7 +1536,7 @@ func TestDeviceRemoveOperationOtherPendingOps(t *testing.T) {
 	tests.Assert(t, err == ErrConflict, "expected err == ErrConflict, got:", err)
 
 	// we should have one pending operation (the volume create)
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		l, err := PendingOperationList(tx)
 		tests.Assert(t, err == nil, "expected err == nil, got:", err)
 		tests.Assert(t, len(l) == 1, "expected len(l) == 1, got:", len(l))
@@ -1562,7 +1568,7 @@ func (o *testOperation) Build(allocator Allocator) error {
 	return o.build()
 }
 
-func (o *testOperation) Exec(executor executors.Executor) error {
+func (o *testOperation) Exec(ctx context.Context, executor executors.Executor) error {
 	if o.exec == nil {
 		return nil
 	}
@@ -1602,6 +1608,9 @@ func TestAsyncHttpOperationOK(t *testing.T) {
 			time.Sleep(time.Millisecond)
 			r, err = client.Get(location.String())
 			tests.Assert(t, err == nil, "expected err == nil, got", err)
+			if r.Header.Get("X-Pending") == "true" {
+				continue
+			}
 			switch r.StatusCode {
 			case http.StatusSeeOther:
 				location, err = r.Location()
@@ -1666,6 +1675,9 @@ func TestAsyncHttpOperationExecFailure(t *testing.T) {
 			time.Sleep(time.Millisecond)
 			r, err = client.Get(location.String())
 			tests.Assert(t, err == nil, "expected err == nil, got", err)
+			if r.Header.Get("X-Pending") == "true" {
+				continue
+			}
 			switch r.StatusCode {
 			case http.StatusSeeOther:
 				location, err = r.Location()
@@ -1719,6 +1731,9 @@ func TestAsyncHttpOperationRollbackFailure(t *testing.T) {
 			time.Sleep(time.Millisecond)
 			r, err = client.Get(location.String())
 			tests.Assert(t, err == nil, "expected err == nil, got", err)
+			if r.Header.Get("X-Pending") == "true" {
+				continue
+			}
 			switch r.StatusCode {
 			case http.StatusSeeOther:
 				location, err = r.Location()
@@ -1768,6 +1783,9 @@ func TestAsyncHttpOperationFinalizeFailure(t *testing.T) {
 			time.Sleep(time.Millisecond)
 			r, err = client.Get(location.String())
 			tests.Assert(t, err == nil, "expected err == nil, got", err)
+			if r.Header.Get("X-Pending") == "true" {
+				continue
+			}
 			switch r.StatusCode {
 			case http.StatusSeeOther:
 				location, err = r.Location()
@@ -1794,6 +1812,373 @@ func TestAsyncHttpOperationFinalizeFailure(t *testing.T) {
 	})
 }
 
+func TestVolumeCreateOperationCancel(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the bricks are being created when the operation is cancelled
+	var lock sync.Mutex
+	started := make(chan bool, 10)
+	release := make(chan bool)
+	brickDestroys := 0
+	volumeCreates := 0
+	app.xo.MockBrickCreate = func(host string,
+		brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+		started <- true
+		<-release
+		return &executors.BrickInfo{Path: "/mockpath"}, nil
+	}
+	app.xo.MockBrickDestroy = func(host string,
+		brick *executors.BrickRequest) error {
+		lock.Lock()
+		defer lock.Unlock()
+		brickDestroys++
+		return nil
+	}
+	app.xo.MockVolumeCreate = func(host string,
+		volume *executors.VolumeRequest) (*executors.Volume, error) {
+		volumeCreates++
+		return &executors.Volume{}, nil
+	}
+
+	r, err := http.Post(ts.URL+"/volumes", "application/json",
+		strings.NewReader(`{"size": 100, "durability": {"type": "replicate", "replicate": {"replica": 3}}}`))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	location := r.Header.Get("Location")
+	<-started
+
+	r = deleteAsyncOperation(t, ts.URL+location)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	close(release)
+
+	r = waitAsyncOperation(t, ts.URL+location)
+	tests.Assert(t, r.StatusCode == http.StatusInternalServerError, "got:", r.StatusCode)
+	body, err := ioutil.ReadAll(r.Body)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, strings.Contains(string(body), ErrCancelled.Error()), "got:", string(body))
+
+	// the volume was never created and the bricks were rolled back
+	tests.Assert(t, volumeCreates == 0, "expected volumeCreates == 0, got:", volumeCreates)
+	tests.Assert(t, brickDestroys > 0, "expected brickDestroys > 0, got:", brickDestroys)
+	app.db.View(func(tx wdb.Tx) error {
+		vl, e := VolumeList(tx)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got", len(vl))
+		bl, e := BrickList(tx)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, len(bl) == 0, "expected len(bl) == 0, got", len(bl))
+		pol, e := PendingOperationList(tx)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, len(pol) == 0, "expected len(pol) == 0, got", len(pol))
+		return nil
+	})
+}
+
+func TestVolumeCreateOperationProgress(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// all but the last brick are created right away
+	var lock sync.Mutex
+	created := 0
+	release := make(chan bool)
+	app.xo.MockBrickCreate = func(host string,
+		brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+		lock.Lock()
+		created++
+		last := created == 3
+		lock.Unlock()
+		if last {
+			<-release
+		}
+		return &executors.BrickInfo{Path: "/mockpath"}, nil
+	}
+
+	r, err := http.Post(ts.URL+"/volumes", "application/json",
+		strings.NewReader(`{"size": 100, "durability": {"type": "replicate", "replicate": {"replica": 3}}}`))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	location := r.Header.Get("Location")
+
+	var progress api.OperationProgress
+	for i := 0; i < 100; i++ {
+		r, err = http.Get(ts.URL + location)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.StatusCode == http.StatusOK, "got:", r.StatusCode)
+		tests.Assert(t, r.Header.Get("X-Pending") == "true")
+		err = utils.GetJsonFromResponse(r, &progress)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		if progress.Done == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, progress.Phase == OperationPhaseExec, "got:", progress.Phase)
+	tests.Assert(t, progress.Step == "bricks created", "got:", progress.Step)
+	tests.Assert(t, progress.Done == 2, "got:", progress.Done)
+	tests.Assert(t, progress.Total == 3, "got:", progress.Total)
+	tests.Assert(t, progress.String() == "exec: bricks created 2/3",
+		"got:", progress.String())
+
+	close(release)
+	r = waitAsyncOperation(t, ts.URL+location)
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther, "got:", r.StatusCode)
+}
+
+func TestOperationProgress(t *testing.T) {
+	// a nil progress is ignored
+	var p *OperationProgress
+	p.SetPhase(OperationPhaseExec)
+	p.StartStep("bricks created", 2)
+	p.Advance()
+	p.SetHost("host1")
+
+	p = NewOperationProgress()
+	ctx := withOperationProgress(context.Background(), p)
+	tests.Assert(t, operationProgress(ctx) == p)
+	tests.Assert(t, operationProgress(context.Background()) == nil)
+
+	p.SetPhase(OperationPhaseRollback)
+	p.StartStep("bricks destroyed", 2)
+	p.Advance()
+	executors.ReportHost(ctx, "host1")
+	info := p.Info()
+	tests.Assert(t, info.String() == "rollback: bricks destroyed 1/2 on host1",
+		"got:", info.String())
+
+	// a new phase resets the progress
+	p.SetPhase(OperationPhaseFinalize)
+	info = p.Info()
+	tests.Assert(t, info.String() == "finalize", "got:", info.String())
+
+	// the values survive detaching the context from its cancellation
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	dctx := detachContext(cctx)
+	tests.Assert(t, dctx.Err() == nil)
+	tests.Assert(t, operationProgress(dctx) == p)
+}
+
+func TestVolumeCreateOperationQueued(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	app.scheduler = NewOperationScheduler(1, 0, 1)
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the first volume holds the only slot until released
+	started := make(chan bool, 10)
+	release := make(chan bool)
+	app.xo.MockBrickCreate = func(host string,
+		brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+		started <- true
+		<-release
+		return &executors.BrickInfo{Path: "/mockpath"}, nil
+	}
+
+	request := `{"size": 100, "durability": {"type": "replicate", "replicate": {"replica": 3}}}`
+	r, err := http.Post(ts.URL+"/volumes", "application/json",
+		strings.NewReader(request))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	running := r.Header.Get("Location")
+	<-started
+
+	r, err = http.Post(ts.URL+"/volumes", "application/json",
+		strings.NewReader(request))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	queued := r.Header.Get("Location")
+
+	var progress api.OperationProgress
+	for i := 0; i < 100 && progress.Phase == ""; i++ {
+		r, err = http.Get(ts.URL + queued)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.StatusCode == http.StatusOK, "got:", r.StatusCode)
+		err = utils.GetJsonFromResponse(r, &progress)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	tests.Assert(t, progress.Phase == OperationPhaseQueued, "got:", progress.Phase)
+
+	// the queue is full
+	r, err = http.Post(ts.URL+"/volumes", "application/json",
+		strings.NewReader(request))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusTooManyRequests, "got:", r.StatusCode)
+	tests.Assert(t, r.Header.Get("Retry-After") == "10",
+		"got:", r.Header.Get("Retry-After"))
+
+	var list api.PendingOperationListResponse
+	r, err = http.Get(ts.URL + "/operations/pending")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusOK, "got:", r.StatusCode)
+	err = utils.GetJsonFromResponse(r, &list)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.PendingOperations) == 2, "got:", list)
+	statuses := map[string]int{}
+	for _, op := range list.PendingOperations {
+		tests.Assert(t, op.TypeName == "create-volume", "got:", op.TypeName)
+		statuses[op.Status] += op.Position
+	}
+	tests.Assert(t, statuses["running"] == 0, "got:", statuses)
+	tests.Assert(t, statuses["queued"] == 1, "got:", statuses)
+
+	// an operation cancelled while queued is rolled back
+	r = deleteAsyncOperation(t, ts.URL+queued)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	r = waitAsyncOperation(t, ts.URL+queued)
+	tests.Assert(t, r.StatusCode == http.StatusInternalServerError, "got:", r.StatusCode)
+
+	r, err = http.Get(ts.URL + "/operations/pending")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = utils.GetJsonFromResponse(r, &list)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.PendingOperations) == 1, "got:", list)
+	tests.Assert(t, list.PendingOperations[0].Status == "running",
+		"got:", list.PendingOperations[0].Status)
+
+	close(release)
+	r = waitAsyncOperation(t, ts.URL+running)
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther, "got:", r.StatusCode)
+
+	app.db.View(func(tx wdb.Tx) error {
+		vl, e := VolumeList(tx)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, len(vl) == 1, "expected len(vl) == 1, got", len(vl))
+		pol, e := PendingOperationList(tx)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, len(pol) == 0, "expected len(pol) == 0, got", len(pol))
+		return nil
+	})
+}
+
+func TestNodeSetStateQueued(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	app.scheduler = NewOperationScheduler(1, 0, 1)
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var nodeIds []string
+	err = app.db.View(func(tx wdb.Tx) error {
+		var err error
+		nodeIds, err = NodeList(tx)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// a volume holds the only slot until released
+	started := make(chan bool, 10)
+	release := make(chan bool)
+	app.xo.MockBrickCreate = func(host string,
+		brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+		started <- true
+		<-release
+		return &executors.BrickInfo{Path: "/mockpath"}, nil
+	}
+	request := `{"size": 100, "durability": {"type": "replicate", "replicate": {"replica": 3}}}`
+	r, err := http.Post(ts.URL+"/volumes", "application/json",
+		strings.NewReader(request))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	running := r.Header.Get("Location")
+	<-started
+
+	// the node state change waits for a slot
+	r, err = http.Post(ts.URL+"/nodes/"+nodeIds[0]+"/state",
+		"application/json", strings.NewReader(`{"state": "offline"}`))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted, "got:", r.StatusCode)
+	queued := r.Header.Get("Location")
+
+	var progress api.OperationProgress
+	for i := 0; i < 100 && progress.Phase == ""; i++ {
+		r, err = http.Get(ts.URL + queued)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.StatusCode == http.StatusOK, "got:", r.StatusCode)
+		err = utils.GetJsonFromResponse(r, &progress)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	tests.Assert(t, progress.Phase == OperationPhaseQueued, "got:", progress.Phase)
+
+	// and takes the place of the queue
+	r, err = http.Post(ts.URL+"/nodes/"+nodeIds[1]+"/state",
+		"application/json", strings.NewReader(`{"state": "offline"}`))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusTooManyRequests, "got:", r.StatusCode)
+
+	close(release)
+	r = waitAsyncOperation(t, ts.URL+running)
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther, "got:", r.StatusCode)
+	r = waitAsyncOperation(t, ts.URL+queued)
+	tests.Assert(t, r.StatusCode == http.StatusNoContent, "got:", r.StatusCode)
+
+	err = app.db.View(func(tx wdb.Tx) error {
+		node, err := NewNodeEntryFromId(tx, nodeIds[0])
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, node.State == api.EntryStateOffline, "got:", node.State)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
 func testAsyncHttpOperation(t *testing.T,
 	o Operation,
 	testFunc func(*testing.T, string)) {
@@ -1888,3 +2273,78 @@ func TestExpandSizeFromOpErrorHandling(t *testing.T) {
 		`expected strings.Contains(e.Error(), "no OpExpandVolume action"), got:`,
 		e)
 }
+
+func TestVolumeDeleteOperationReplay(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	jsonfile := tests.Tempfile()
+	defer os.Remove(jsonfile)
+	copyfile := tests.Tempfile()
+	defer os.Remove(copyfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vol := NewVolumeEntryFromRequest(req)
+	vc := NewVolumeCreateOperation(vol, app.db)
+	err = RunOperation(vc, app.Allocator(), app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// copy the db as it was before the failure
+	dump, err := dbDumpInternal(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	b, err := json.Marshal(&dump)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = ioutil.WriteFile(jsonfile, b, 0600)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = DbCreate(jsonfile, copyfile, TestDbBackend(), "", false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// record the failure
+	failedBrick := vol.Bricks[1]
+	app.xo.MockBrickDestroy = func(host string,
+		brick *executors.BrickRequest) error {
+		if brick.Name == failedBrick {
+			return fmt.Errorf("Unable to delete brick %v", brick.Name)
+		}
+		return nil
+	}
+	var recording bytes.Buffer
+	vd := NewVolumeDeleteOperation(vol, app.db)
+	recorded := RunOperation(vd, app.Allocator(),
+		recordexec.NewRecordingExecutor(app.executor, &recording))
+	tests.Assert(t, recorded != nil, "expected recorded != nil")
+
+	// replay it against the copy of the db
+	copyApp := NewTestApp(copyfile)
+	defer copyApp.Close()
+	replay, err := recordexec.NewReplayExecutor(&recording)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var copyVol *VolumeEntry
+	err = copyApp.db.View(func(tx wdb.Tx) error {
+		copyVol, err = NewVolumeEntryFromId(tx, vol.Info.Id)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	vd = NewVolumeDeleteOperation(copyVol, copyApp.db)
+	err = RunOperation(vd, copyApp.Allocator(), replay)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, err.Error() == recorded.Error(),
+		"got:", err, "expected:", recorded)
+	remaining := replay.Remaining()
+	tests.Assert(t, len(remaining) == 0, "got:", remaining)
+}
@@ -35,8 +35,31 @@ const (
 	OperationCreateBlockVolume
 	OperationDeleteBlockVolume
 	OperationRemoveDevice
+	OperationModifyBlockVolumeAuth
 )
 
+// Name returns the name of the operation type as shown in the api.
+func (t PendingOperationType) Name() string {
+	switch t {
+	case OperationCreateVolume:
+		return "create-volume"
+	case OperationDeleteVolume:
+		return "delete-volume"
+	case OperationExpandVolume:
+		return "expand-volume"
+	case OperationCreateBlockVolume:
+		return "create-block-volume"
+	case OperationDeleteBlockVolume:
+		return "delete-block-volume"
+	case OperationRemoveDevice:
+		return "remove-device"
+	case OperationModifyBlockVolumeAuth:
+		return "modify-block-volume-auth"
+	default:
+		return "unknown"
+	}
+}
+
 // PendingChangeType identifies what kind of lower-level new item or change
 // is being made to the system as part of a higher-level pending operation.
 type PendingChangeType int
@@ -51,6 +74,7 @@ const (
 	OpAddBlockVolume
 	OpDeleteBlockVolume
 	OpRemoveDevice
+	OpModifyBlockVolumeAuth
 )
 
 // PendingOperationAction tracks individual changes to entries within the
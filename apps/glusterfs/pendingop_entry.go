@@ -14,7 +14,6 @@ import (
 	"encoding/gob"
 	"time"
 
-	"github.com/boltdb/bolt"
 	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/lpabon/godbc"
@@ -38,7 +37,7 @@ type PendingOperationEntry struct {
 
 // PendingOperationList returns the IDs of all pending operation entries
 // currently in the Heketi db.
-func PendingOperationList(tx *bolt.Tx) ([]string, error) {
+func PendingOperationList(tx wdb.Tx) ([]string, error) {
 	list := EntryKeys(tx, BOLTDB_BUCKET_PENDING_OPS)
 	if list == nil {
 		return nil, ErrAccessList
@@ -50,7 +49,7 @@ func PendingOperationList(tx *bolt.Tx) ([]string, error) {
 // operation entries. If the db cannot be read the function panics.
 func HasPendingOperations(db wdb.RODB) bool {
 	var pending bool
-	if err := db.View(func(tx *bolt.Tx) error {
+	if err := db.View(func(tx wdb.Tx) error {
 		l, err := PendingOperationList(tx)
 		if err != nil {
 			return err
@@ -86,7 +85,7 @@ func NewPendingOperationEntry(id string) *PendingOperationEntry {
 
 // NewPendingOperationEntryFromId fetches an existing pending operation entry
 // from the heketi db based on the provided id.
-func NewPendingOperationEntryFromId(tx *bolt.Tx, id string) (
+func NewPendingOperationEntryFromId(tx wdb.Tx, id string) (
 	*PendingOperationEntry, error) {
 	godbc.Require(tx != nil)
 	godbc.Require(id != "")
@@ -106,7 +105,7 @@ func NewPendingOperationEntryFromId(tx *bolt.Tx, id string) (
 
 // Save records the pending operation entry object in the db, keyed by the
 // value of its ID.
-func (p *PendingOperationEntry) Save(tx *bolt.Tx) error {
+func (p *PendingOperationEntry) Save(tx wdb.Tx) error {
 	godbc.Require(tx != nil)
 	godbc.Require(p.Id != "")
 
@@ -114,7 +113,7 @@ func (p *PendingOperationEntry) Save(tx *bolt.Tx) error {
 }
 
 // Delete removes a pending operation entry from the db.
-func (p *PendingOperationEntry) Delete(tx *bolt.Tx) error {
+func (p *PendingOperationEntry) Delete(tx wdb.Tx) error {
 	return EntryDelete(tx, p, p.Id)
 }
 
@@ -243,6 +242,14 @@ func (p *PendingOperationEntry) RecordDeleteBlockVolume(bv *BlockVolumeEntry) {
 	bv.Pending.Id = p.Id
 }
 
+// RecordModifyBlockVolumeAuth adds tracking metadata for a change to
+// the authentication settings of an existing block volume.
+func (p *PendingOperationEntry) RecordModifyBlockVolumeAuth(bv *BlockVolumeEntry) {
+	p.recordChange(OpModifyBlockVolumeAuth, bv.Info.Id)
+	p.Type = OperationModifyBlockVolumeAuth
+	bv.Pending.Id = p.Id
+}
+
 // RecordRemoveDevice adds tracking metadata for a long-running device
 // removal operation.
 func (p *PendingOperationEntry) RecordRemoveDevice(d *DeviceEntry) {
@@ -252,7 +259,7 @@ func (p *PendingOperationEntry) RecordRemoveDevice(d *DeviceEntry) {
 
 // PendingOperationUpgrade updates the heketi db with metadata needed to
 // support pending operation entries.
-func PendingOperationUpgrade(tx *bolt.Tx) error {
+func PendingOperationUpgrade(tx wdb.Tx) error {
 	entry, err := NewDbAttributeEntryFromKey(tx, DB_HAS_PENDING_OPS_BUCKET)
 	switch err {
 	case ErrNotFound:
@@ -11,10 +11,17 @@ package glusterfs
 
 import (
 	"bytes"
+	"os"
 
 	"github.com/lpabon/godbc"
 )
 
+// TestDbBackend returns the db backend the unit tests run against.
+// It is set with HEKETI_TEST_DB_BACKEND, the default is BoltDB.
+func TestDbBackend() string {
+	return os.Getenv("HEKETI_TEST_DB_BACKEND")
+}
+
 func NewTestApp(dbfile string) *App {
 
 	// Create simple configuration for unit tests
@@ -23,6 +30,7 @@ func NewTestApp(dbfile string) *App {
 			"executor" : "mock",
 			"allocator" : "simple",
 			"db" : "` + dbfile + `",
+			"db_backend" : "` + TestDbBackend() + `",
 			"auto_create_block_hosting_volume" : true
 		}
 	}`))
@@ -11,11 +11,11 @@ package glusterfs
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"fmt"
 	"sort"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
 	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
@@ -54,7 +54,7 @@ type VolumeEntry struct {
 	Pending              PendingItem
 }
 
-func VolumeList(tx *bolt.Tx) ([]string, error) {
+func VolumeList(tx wdb.Tx) ([]string, error) {
 
 	list := EntryKeys(tx, BOLTDB_BUCKET_VOLUME)
 	if list == nil {
@@ -138,7 +138,7 @@ func NewVolumeEntryFromRequest(req *api.VolumeCreateRequest) *VolumeEntry {
 	return vol
 }
 
-func NewVolumeEntryFromId(tx *bolt.Tx, id string) (*VolumeEntry, error) {
+func NewVolumeEntryFromId(tx wdb.Tx, id string) (*VolumeEntry, error) {
 	godbc.Require(tx != nil)
 
 	entry := NewVolumeEntry()
@@ -154,18 +154,18 @@ func (v *VolumeEntry) BucketName() string {
 	return BOLTDB_BUCKET_VOLUME
 }
 
-func (v *VolumeEntry) Save(tx *bolt.Tx) error {
+func (v *VolumeEntry) Save(tx wdb.Tx) error {
 	godbc.Require(tx != nil)
 	godbc.Require(len(v.Info.Id) > 0)
 
 	return EntrySave(tx, v, v.Info.Id)
 }
 
-func (v *VolumeEntry) Delete(tx *bolt.Tx) error {
+func (v *VolumeEntry) Delete(tx wdb.Tx) error {
 	return EntryDelete(tx, v, v.Info.Id)
 }
 
-func (v *VolumeEntry) NewInfoResponse(tx *bolt.Tx) (*api.VolumeInfoResponse, error) {
+func (v *VolumeEntry) NewInfoResponse(tx wdb.Tx) (*api.VolumeInfoResponse, error) {
 	godbc.Require(tx != nil)
 
 	info := api.NewVolumeInfoResponse()
@@ -276,7 +276,7 @@ func (v *VolumeEntry) cleanupCreateVolume(db wdb.DB,
 	// from a quick read its "safe" to unconditionally try to delete
 	// bricks. TODO: find out if that is true with functional tests
 	DestroyBricks(db, executor, brick_entries)
-	return db.Update(func(tx *bolt.Tx) error {
+	return db.Update(func(tx wdb.Tx) error {
 		for _, brick := range brick_entries {
 			v.removeBrickFromDb(tx, brick)
 		}
@@ -308,7 +308,7 @@ func (v *VolumeEntry) createOneShot(db wdb.DB,
 	if e != nil {
 		return e
 	}
-	return v.createVolumeExec(db, executor, brick_entries)
+	return v.createVolumeExec(context.Background(), db, executor, brick_entries)
 }
 
 func (v *VolumeEntry) createVolumeComponents(db wdb.DB,
@@ -317,7 +317,7 @@ func (v *VolumeEntry) createVolumeComponents(db wdb.DB,
 	// Get list of clusters
 	var possibleClusters []string
 	if len(v.Info.Clusters) == 0 {
-		err := db.View(func(tx *bolt.Tx) error {
+		err := db.View(func(tx wdb.Tx) error {
 			var err error
 			possibleClusters, err = ClusterList(tx)
 			return err
@@ -343,25 +343,35 @@ func (v *VolumeEntry) createVolumeComponents(db wdb.DB,
 	return v.saveCreateVolume(db, allocator, possibleClusters)
 }
 
-func (v *VolumeEntry) createVolumeExec(db wdb.DB,
+func (v *VolumeEntry) createVolumeExec(ctx context.Context,
+	db wdb.DB,
 	executor executors.Executor,
 	brick_entries []*BrickEntry) (e error) {
 
 	// Create the bricks on the nodes
-	e = CreateBricks(db, executor, brick_entries)
+	e = CreateBricks(ctx, db, executor, brick_entries)
 	if e != nil {
 		return
 	}
+	if e = ctx.Err(); e != nil {
+		return
+	}
 
 	// Create GlusterFS volume
-	return v.createVolume(db, executor, brick_entries)
+	progress := operationProgress(ctx)
+	progress.StartStep("volume created", 1)
+	e = v.createVolume(db, executors.WithContext(ctx, executor), brick_entries)
+	if e == nil {
+		progress.Advance()
+	}
+	return
 }
 
 func (v *VolumeEntry) saveCreateVolume(db wdb.DB,
 	allocator Allocator,
 	possibleClusters []string) (brick_entries []*BrickEntry, err error) {
 
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx wdb.Tx) error {
 		txdb := wdb.WrapTx(tx)
 		// For each cluster look for storage space for this volume
 		brick_entries, err = v.tryAllocateBricks(txdb, allocator, possibleClusters)
@@ -439,7 +449,7 @@ func (v *VolumeEntry) saveDeleteVolume(db wdb.DB,
 	brick_entries []*BrickEntry) error {
 
 	// Remove from entries from the db
-	return db.Update(func(tx *bolt.Tx) error {
+	return db.Update(func(tx wdb.Tx) error {
 		for _, brick := range brick_entries {
 			err := v.removeBrickFromDb(tx, brick)
 			if err != nil {
@@ -473,7 +483,7 @@ func (v *VolumeEntry) saveDeleteVolume(db wdb.DB,
 func (v *VolumeEntry) manageHostFromBricks(db wdb.DB,
 	brick_entries []*BrickEntry) (sshhost string, err error) {
 
-	err = db.View(func(tx *bolt.Tx) error {
+	err = db.View(func(tx wdb.Tx) error {
 		for _, brick := range brick_entries {
 			node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
 			if err != nil {
@@ -490,7 +500,7 @@ func (v *VolumeEntry) manageHostFromBricks(db wdb.DB,
 func (v *VolumeEntry) deleteVolumeComponents(
 	db wdb.RODB) (brick_entries []*BrickEntry, e error) {
 
-	e = db.View(func(tx *bolt.Tx) error {
+	e = db.View(func(tx wdb.Tx) error {
 		for _, id := range v.BricksIds() {
 			brick, err := NewBrickEntryFromId(tx, id)
 			if err != nil {
@@ -518,7 +528,7 @@ func (v *VolumeEntry) expandVolumeComponents(db wdb.DB,
 	sizeGB int,
 	setSize bool) (brick_entries []*BrickEntry, e error) {
 
-	e = db.Update(func(tx *bolt.Tx) error {
+	e = db.Update(func(tx wdb.Tx) error {
 		// Allocate new bricks in the cluster
 		txdb := wdb.WrapTx(tx)
 		var err error
@@ -554,7 +564,7 @@ func (v *VolumeEntry) cleanupExpandVolume(db wdb.DB,
 	DestroyBricks(db, executor, brick_entries)
 
 	// Remove from db
-	return db.Update(func(tx *bolt.Tx) error {
+	return db.Update(func(tx wdb.Tx) error {
 		for _, brick := range brick_entries {
 			v.removeBrickFromDb(tx, brick)
 		}
@@ -566,15 +576,19 @@ func (v *VolumeEntry) cleanupExpandVolume(db wdb.DB,
 	})
 }
 
-func (v *VolumeEntry) expandVolumeExec(db wdb.DB,
+func (v *VolumeEntry) expandVolumeExec(ctx context.Context,
+	db wdb.DB,
 	executor executors.Executor,
 	brick_entries []*BrickEntry) (e error) {
 
 	// Create bricks
-	err := CreateBricks(db, executor, brick_entries)
+	err := CreateBricks(ctx, db, executor, brick_entries)
 	if err != nil {
 		return err
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	// Create a volume request to send to executor
 	// so that it can add the new bricks
@@ -584,7 +598,7 @@ func (v *VolumeEntry) expandVolumeExec(db wdb.DB,
 	}
 
 	// Expand the volume
-	_, err = executor.VolumeExpand(host, vr)
+	_, err = executors.WithContext(ctx, executor).VolumeExpand(host, vr)
 	if err != nil {
 		return err
 	}
@@ -633,7 +647,7 @@ func (v *VolumeEntry) checkBricksCanBeDestroyed(db wdb.RODB,
 	return err
 }
 
-func VolumeEntryUpgrade(tx *bolt.Tx) error {
+func VolumeEntryUpgrade(tx wdb.Tx) error {
 	return nil
 }
 
@@ -652,7 +666,7 @@ func (v *VolumeEntry) Visible() bool {
 	return v.Pending.Id == ""
 }
 
-func volumeNameExistsInCluster(tx *bolt.Tx, cluster *ClusterEntry,
+func volumeNameExistsInCluster(tx wdb.Tx, cluster *ClusterEntry,
 	name string) (found bool, e error) {
 	for _, volumeId := range cluster.Info.Volumes {
 		volume, err := NewVolumeEntryFromId(tx, volumeId)
@@ -683,7 +697,7 @@ func eligibleClusters(db wdb.RODB, req ClusterReq,
 	// only those clusters that do not carry the Block flag.
 	//
 	candidateClusters := []string{}
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx wdb.Tx) error {
 		for _, clusterId := range possibleClusters {
 			c, err := NewClusterEntryFromId(tx, clusterId)
 			if err != nil {
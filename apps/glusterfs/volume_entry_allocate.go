@@ -10,9 +10,9 @@
 package glusterfs
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
 	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
@@ -42,7 +42,7 @@ func tryAllocateBrickOnDevice(v *VolumeEntry, device *DeviceEntry,
 	return brick
 }
 
-func findDeviceAndBrickForSet(tx *bolt.Tx, v *VolumeEntry,
+func findDeviceAndBrickForSet(tx wdb.Tx, v *VolumeEntry,
 	devcache map[string](*DeviceEntry),
 	deviceCh <-chan string,
 	errc <-chan error,
@@ -101,7 +101,7 @@ func allocateBricks(
 
 	devcache := map[string](*DeviceEntry){}
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx wdb.Tx) error {
 		txdb := wdb.WrapTx(tx)
 
 		// Determine allocation for each brick required for this volume
@@ -217,7 +217,7 @@ func (v *VolumeEntry) getBrickEntryfromBrickName(db wdb.RODB, brickname string)
 	var nodeEntry *NodeEntry
 	for _, brickid := range v.BricksIds() {
 
-		err := db.View(func(tx *bolt.Tx) error {
+		err := db.View(func(tx wdb.Tx) error {
 			var err error
 			brickEntry, err = NewBrickEntryFromId(tx, brickid)
 			if err != nil {
@@ -355,7 +355,7 @@ func (v *VolumeEntry) replaceBrickInVolume(db wdb.DB, executor executors.Executo
 		return fmt.Errorf("replace brick is not supported for volume durability type %v", v.Info.Durability.Type)
 	}
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx wdb.Tx) error {
 		var err error
 		oldBrickEntry, err = NewBrickEntryFromId(tx, oldBrickId)
 		if err != nil {
@@ -407,7 +407,7 @@ func (v *VolumeEntry) replaceBrickInVolume(db wdb.DB, executor executors.Executo
 	for deviceId := range deviceCh {
 
 		// Get device entry
-		err = db.View(func(tx *bolt.Tx) error {
+		err = db.View(func(tx wdb.Tx) error {
 			newDeviceEntry, err = NewDeviceEntryFromId(tx, deviceId)
 			if err != nil {
 				return err
@@ -440,7 +440,7 @@ func (v *VolumeEntry) replaceBrickInVolume(db wdb.DB, executor executors.Executo
 		// NewBrickEntry would deduct storage from device entry
 		// which we will save to disk, hence reload the latest device
 		// entry to get latest storage state of device
-		err = db.Update(func(tx *bolt.Tx) error {
+		err = db.Update(func(tx wdb.Tx) error {
 			newDeviceEntry, err := NewDeviceEntryFromId(tx, deviceId)
 			if err != nil {
 				return err
@@ -465,7 +465,7 @@ func (v *VolumeEntry) replaceBrickInVolume(db wdb.DB, executor executors.Executo
 
 		defer func() {
 			if e != nil {
-				db.Update(func(tx *bolt.Tx) error {
+				db.Update(func(tx wdb.Tx) error {
 					newDeviceEntry, err = NewDeviceEntryFromId(tx, newBrickEntry.Info.DeviceId)
 					if err != nil {
 						return err
@@ -477,7 +477,7 @@ func (v *VolumeEntry) replaceBrickInVolume(db wdb.DB, executor executors.Executo
 			}
 		}()
 
-		err = db.View(func(tx *bolt.Tx) error {
+		err = db.View(func(tx wdb.Tx) error {
 			newBrickNodeEntry, err = NewNodeEntryFromId(tx, newBrickEntry.Info.NodeId)
 			if err != nil {
 				return err
@@ -491,7 +491,7 @@ func (v *VolumeEntry) replaceBrickInVolume(db wdb.DB, executor executors.Executo
 		newBrickEntry.SetId(newBrickId)
 		var brickEntries []*BrickEntry
 		brickEntries = append(brickEntries, newBrickEntry)
-		err = CreateBricks(db, executor, brickEntries)
+		err = CreateBricks(context.Background(), db, executor, brickEntries)
 		if err != nil {
 			return err
 		}
@@ -523,7 +523,7 @@ func (v *VolumeEntry) replaceBrickInVolume(db wdb.DB, executor executors.Executo
 		// We must read entries from db again as state on disk might
 		// have changed
 
-		err = db.Update(func(tx *bolt.Tx) error {
+		err = db.Update(func(tx wdb.Tx) error {
 			err = newBrickEntry.Save(tx)
 			if err != nil {
 				return err
@@ -585,7 +585,7 @@ func (v *VolumeEntry) allocBricks(
 		// Check the named return value 'err'
 		if e != nil {
 			logger.Debug("Error detected.  Cleaning up volume %v: Len(%v) ", v.Info.Id, len(brick_entries))
-			db.Update(func(tx *bolt.Tx) error {
+			db.Update(func(tx wdb.Tx) error {
 				for _, brick := range brick_entries {
 					v.removeBrickFromDb(tx, brick)
 				}
@@ -595,7 +595,7 @@ func (v *VolumeEntry) allocBricks(
 	}()
 
 	// mimic the previous unconditional db update behavior
-	err := db.Update(func(tx *bolt.Tx) error {
+	err := db.Update(func(tx wdb.Tx) error {
 		wtx := wdb.WrapTx(tx)
 		r, e := allocateBricks(wtx, allocator, cluster, v, bricksets, brick_size)
 		if e != nil {
@@ -623,7 +623,7 @@ func (v *VolumeEntry) allocBricks(
 	return brick_entries, nil
 }
 
-func (v *VolumeEntry) removeBrickFromDb(tx *bolt.Tx, brick *BrickEntry) error {
+func (v *VolumeEntry) removeBrickFromDb(tx wdb.Tx, brick *BrickEntry) error {
 
 	// Access device
 	device, err := NewDeviceEntryFromId(tx, brick.Info.DeviceId)
@@ -13,7 +13,6 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
 	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/lpabon/godbc"
@@ -45,7 +44,7 @@ func (v *VolumeEntry) updateMountInfo(db wdb.RODB) error {
 
 	// Get all brick hosts
 	hosts := []string{}
-	if err := db.View(func(tx *bolt.Tx) error {
+	if err := db.View(func(tx wdb.Tx) error {
 		cluster, err := NewClusterEntryFromId(tx, v.Info.Cluster)
 		if err != nil {
 			return err
@@ -91,7 +90,7 @@ func (v *VolumeEntry) createVolumeRequest(db wdb.RODB,
 		vr.Bricks[i].Path = b.Info.Path
 
 		// Get storage host name from Node entry
-		err := db.View(func(tx *bolt.Tx) error {
+		err := db.View(func(tx wdb.Tx) error {
 			node, err := NewNodeEntryFromId(tx, b.Info.NodeId)
 			if err != nil {
 				return err
@@ -19,8 +19,8 @@ import (
 	"sync"
 	"testing"
 
-	"github.com/boltdb/bolt"
 	"github.com/chinacoolhacker/heketi/executors"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/heketi/tests"
@@ -42,7 +42,7 @@ func setupSampleDbWithTopology(app *App,
 	disksize uint64) error {
 
 	var clusterlist []string
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		for c := 0; c < clusters; c++ {
 			cluster := createSampleClusterEntry()
 
@@ -340,7 +340,7 @@ func TestVolumeEntryFromIdNotFound(t *testing.T) {
 	defer app.Close()
 
 	// Test for ID not found
-	err := app.db.View(func(tx *bolt.Tx) error {
+	err := app.db.View(func(tx wdb.Tx) error {
 		_, err := NewVolumeEntryFromId(tx, "123")
 		return err
 	})
@@ -360,14 +360,14 @@ func TestVolumeEntryFromId(t *testing.T) {
 	v := createSampleReplicaVolumeEntry(1024, 2)
 
 	// Save in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return v.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	// Load from database
 	var entry *VolumeEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		entry, err = NewVolumeEntryFromId(tx, v.Info.Id)
 		return err
@@ -389,14 +389,14 @@ func TestVolumeEntrySaveDelete(t *testing.T) {
 	v := createSampleReplicaVolumeEntry(1024, 2)
 
 	// Save in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return v.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	// Delete entry which has devices
 	var entry *VolumeEntry
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		var err error
 		entry, err = NewVolumeEntryFromId(tx, v.Info.Id)
 		if err != nil {
@@ -414,7 +414,7 @@ func TestVolumeEntrySaveDelete(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Check volume has been deleted and is not in db
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		entry, err = NewVolumeEntryFromId(tx, v.Info.Id)
 		if err != nil {
@@ -438,14 +438,14 @@ func TestNewVolumeEntryNewInfoResponse(t *testing.T) {
 	v := createSampleReplicaVolumeEntry(1024, 2)
 
 	// Save in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return v.Save(tx)
 	})
 	tests.Assert(t, err == nil)
 
 	// Retrieve info response
 	var info *api.VolumeInfoResponse
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		volume, err := NewVolumeEntryFromId(tx, v.Info.Id)
 		if err != nil {
 			return err
@@ -482,7 +482,7 @@ func TestVolumeEntryCreateMissingCluster(t *testing.T) {
 	v.Info.Clusters = []string{}
 
 	// Save in database
-	err := app.db.Update(func(tx *bolt.Tx) error {
+	err := app.db.Update(func(tx wdb.Tx) error {
 		return v.Save(tx)
 	})
 	tests.Assert(t, err == nil)
@@ -517,7 +517,7 @@ func TestVolumeEntryCreateRunOutOfSpaceMinBrickSizeLimit(t *testing.T) {
 	tests.Assert(t, v.Info.Cluster == "")
 
 	// Check database volume does not exist
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		_, err := NewVolumeEntryFromId(tx, v.Info.Id)
 		return err
 	})
@@ -526,7 +526,7 @@ func TestVolumeEntryCreateRunOutOfSpaceMinBrickSizeLimit(t *testing.T) {
 	// Check no bricks or volumes exist
 	var bricks []string
 	var volumes []string
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		bricks = EntryKeys(tx, BOLTDB_BUCKET_BRICK)
 		volumes = EntryKeys(tx, BOLTDB_BUCKET_VOLUME)
 
@@ -564,7 +564,7 @@ func TestVolumeEntryCreateRunOutOfSpaceMaxBrickLimit(t *testing.T) {
 	tests.Assert(t, err == ErrNoSpace)
 
 	// Check database volume does not exist
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		_, err := NewVolumeEntryFromId(tx, v.Info.Id)
 		return err
 	})
@@ -573,7 +573,7 @@ func TestVolumeEntryCreateRunOutOfSpaceMaxBrickLimit(t *testing.T) {
 	// Check no bricks or volumes exist
 	var bricks []string
 	var volumes []string
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		bricks = EntryKeys(tx, BOLTDB_BUCKET_BRICK)
 
 		volumes = EntryKeys(tx, BOLTDB_BUCKET_VOLUME)
@@ -634,7 +634,7 @@ func TestVolumeEntryCreateTwoBricks(t *testing.T) {
 	// Check database
 	var info *api.VolumeInfoResponse
 	var nodelist sort.StringSlice
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
 		if err != nil {
 			return err
@@ -691,7 +691,7 @@ func TestVolumeEntryCreateTwoBricks(t *testing.T) {
 		info)
 
 	// Check all hosts are in the list
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		for _, brick := range info.Bricks {
 			found := false
 
@@ -738,7 +738,7 @@ func TestVolumeEntryCreateBrickDivision(t *testing.T) {
 
 	var info *api.VolumeInfoResponse
 	var nodelist sort.StringSlice
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
 		if err != nil {
 			return err
@@ -819,7 +819,7 @@ func TestVolumeEntryCreateMaxBrickSize(t *testing.T) {
 
 	// Get volume information
 	var info *api.VolumeInfoResponse
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
 		if err != nil {
 			return err
@@ -863,7 +863,7 @@ func TestVolumeEntryCreateOnClustersRequested(t *testing.T) {
 
 	// Get a cluster list
 	var clusters sort.StringSlice
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		clusters, err = ClusterList(tx)
 		return err
@@ -883,7 +883,7 @@ func TestVolumeEntryCreateOnClustersRequested(t *testing.T) {
 
 	// Check database volume does not exist
 	var info *api.VolumeInfoResponse
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
 		if err != nil {
 			return err
@@ -908,7 +908,7 @@ func TestVolumeEntryCreateOnClustersRequested(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Check database volume exists
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
 		if err != nil {
 			return err
@@ -946,7 +946,7 @@ func TestVolumeEntryCreateCheckingClustersForSpace(t *testing.T) {
 
 	// Create one large cluster
 	cluster := createSampleClusterEntry()
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		for n := 0; n < 100; n++ {
 			node := createSampleNodeEntry()
 			node.Info.ClusterId = cluster.Info.Id
@@ -986,7 +986,7 @@ func TestVolumeEntryCreateCheckingClustersForSpace(t *testing.T) {
 
 	// Check database volume exists
 	var info *api.VolumeInfoResponse
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
 		if err != nil {
 			return err
@@ -1033,7 +1033,7 @@ func TestVolumeEntryCreateWithSnapshot(t *testing.T) {
 
 	// Check database volume exists
 	var info *api.VolumeInfoResponse
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
 		if err != nil {
 			return err
@@ -1051,7 +1051,7 @@ func TestVolumeEntryCreateWithSnapshot(t *testing.T) {
 
 	// Check that it used only two bricks each with only two replicas
 	tests.Assert(t, len(info.Bricks) == 2)
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		for _, b := range info.Bricks {
 			device, err := NewDeviceEntryFromId(tx, b.DeviceId)
 			if err != nil {
@@ -1097,7 +1097,7 @@ func TestVolumeEntryCreateBrickCreationFailure(t *testing.T) {
 	tests.Assert(t, err == mockerror, err, mockerror)
 
 	// Check database is still clean. No bricks and No volumes
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		volumes, err := VolumeList(tx)
 		tests.Assert(t, err == nil)
 		tests.Assert(t, len(volumes) == 0)
@@ -1151,7 +1151,7 @@ func TestVolumeEntryCreateVolumeCreationFailure(t *testing.T) {
 	tests.Assert(t, err == mockerror)
 
 	// Check database is still clean. No bricks and No volumes
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		volumes, err := VolumeList(tx)
 		tests.Assert(t, err == nil)
 		tests.Assert(t, len(volumes) == 0)
@@ -1208,7 +1208,7 @@ func TestVolumeEntryDestroy(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Check database volume does not exist
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 
 		// Check that all devices have no used data
 		devices, err := DeviceList(tx)
@@ -1230,7 +1230,7 @@ func TestVolumeEntryDestroy(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Check that the devices have no bricks
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		devices, err := DeviceList(tx)
 		if err != nil {
 			return err
@@ -1249,7 +1249,7 @@ func TestVolumeEntryDestroy(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 	// Check that the cluster has no volumes
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		clusters, err := ClusterList(tx)
 		if err != nil {
 			return err
@@ -1302,7 +1302,7 @@ func TestVolumeEntryExpandNoSpace(t *testing.T) {
 
 	// Check db is the same as before expansion
 	var entry *VolumeEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		entry, err = NewVolumeEntryFromId(tx, v.Info.Id)
 
@@ -1382,7 +1382,7 @@ func TestVolumeEntryExpandCreateBricksFailure(t *testing.T) {
 
 	// Check db is the same as before expansion
 	var entry *VolumeEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		entry, err = NewVolumeEntryFromId(tx, v.Info.Id)
 
@@ -1424,7 +1424,7 @@ func TestVolumeEntryExpand(t *testing.T) {
 
 	// Check db
 	var entry *VolumeEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		var err error
 		entry, err = NewVolumeEntryFromId(tx, v.Info.Id)
 
@@ -1604,7 +1604,7 @@ func TestReplaceBrickInVolume(t *testing.T) {
 	tests.Assert(t, err == nil, err)
 	var brickNames []string
 	var be *BrickEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 
 		for _, brick := range v.Bricks {
 			be, err = NewBrickEntryFromId(tx, brick)
@@ -1660,7 +1660,7 @@ func TestReplaceBrickInVolume(t *testing.T) {
 	brickOnOldNode := false
 	oldBrickIdExists := false
 
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 
 		for _, brick := range v.Bricks {
 			be, err = NewBrickEntryFromId(tx, brick)
@@ -1719,7 +1719,7 @@ func TestNewVolumeEntryWithVolumeOptions(t *testing.T) {
 
 	// Check that the data on the database is recorded correctly
 	var entry VolumeEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		return entry.Unmarshal(
 			tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME)).
 				Get([]byte(v.Info.Id)))
@@ -1760,7 +1760,7 @@ func TestNewVolumeEntryWithTSPForMountHosts(t *testing.T) {
 
 	// Check that the data on the database is recorded correctly
 	var entry VolumeEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 		return entry.Unmarshal(
 			tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME)).
 				Get([]byte(v.Info.Id)))
@@ -1792,7 +1792,7 @@ func TestReplaceBrickInVolumeSelfHeal1(t *testing.T) {
 	tests.Assert(t, err == nil, err)
 	var brickNames []string
 	var be *BrickEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 
 		for _, brick := range v.Bricks {
 			be, err = NewBrickEntryFromId(tx, brick)
@@ -1846,7 +1846,7 @@ func TestReplaceBrickInVolumeSelfHeal1(t *testing.T) {
 	brickOnOldNode := false
 	oldBrickIdExists := false
 
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 
 		for _, brick := range v.Bricks {
 			be, err = NewBrickEntryFromId(tx, brick)
@@ -1893,7 +1893,7 @@ func TestReplaceBrickInVolumeSelfHeal2(t *testing.T) {
 	tests.Assert(t, err == nil, err)
 	var brickNames []string
 	var be *BrickEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 
 		for _, brick := range v.Bricks {
 			be, err = NewBrickEntryFromId(tx, brick)
@@ -1950,7 +1950,7 @@ func TestReplaceBrickInVolumeSelfHeal2(t *testing.T) {
 	brickOnOldNode := false
 	oldBrickIdExists := false
 
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 
 		for _, brick := range v.Bricks {
 			be, err = NewBrickEntryFromId(tx, brick)
@@ -1997,7 +1997,7 @@ func TestReplaceBrickInVolumeSelfHealQuorumNotMet(t *testing.T) {
 	tests.Assert(t, err == nil, err)
 	var brickNames []string
 	var be *BrickEntry
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 
 		for _, brick := range v.Bricks {
 			be, err = NewBrickEntryFromId(tx, brick)
@@ -2051,7 +2051,7 @@ func TestReplaceBrickInVolumeSelfHealQuorumNotMet(t *testing.T) {
 	brickOnOldNode := false
 	oldBrickIdExists := false
 
-	err = app.db.View(func(tx *bolt.Tx) error {
+	err = app.db.View(func(tx wdb.Tx) error {
 
 		for _, brick := range v.Bricks {
 			be, err = NewBrickEntryFromId(tx, brick)
@@ -2092,7 +2092,7 @@ func TestVolumeEntryNoMatchingFlags(t *testing.T) {
 	)
 	tests.Assert(t, err == nil)
 	// now change the clusters to disable block access
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		cl, err := ClusterList(tx)
 		if err != nil {
 			return err
@@ -2135,7 +2135,7 @@ func TestVolumeEntryMissingFlags(t *testing.T) {
 	)
 	tests.Assert(t, err == nil)
 	// now change the clusters to disable block and file flags
-	err = app.db.Update(func(tx *bolt.Tx) error {
+	err = app.db.Update(func(tx wdb.Tx) error {
 		cl, err := ClusterList(tx)
 		if err != nil {
 			return err
@@ -2204,7 +2204,7 @@ func TestVolumeCreateBrickAlloc(t *testing.T) {
 
 	// verify that the corrent number of bricks is saved in the DB
 	var bc int
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		bl, err := BrickList(tx)
 		tests.Assert(t, err == nil, "expected err == nil, got:", err)
 		bc = len(bl)
@@ -2256,7 +2256,7 @@ func TestVolumeCreateConcurrent(t *testing.T) {
 	}
 
 	brickCount := 0
-	app.db.View(func(tx *bolt.Tx) error {
+	app.db.View(func(tx wdb.Tx) error {
 		devices, err := DeviceList(tx)
 		tests.Assert(t, err == nil, "expected err == nil, got:", err)
 		tests.Assert(t, len(devices) == 24,
@@ -19,6 +19,7 @@ import (
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 )
 
@@ -32,6 +33,7 @@ type Client struct {
 	key      string
 	user     string
 	throttle chan bool
+	progress func(*api.OperationProgress)
 }
 
 // Creates a new client to access a Heketi server
@@ -53,6 +55,13 @@ func NewClientNoAuth(host string) *Client {
 	return NewClient(host, "", "")
 }
 
+// SetProgressFunc sets a function that is called with the progress
+// reported by the server while the client waits for an asynchronous
+// operation to complete.
+func (c *Client) SetProgressFunc(fn func(*api.OperationProgress)) {
+	c.progress = fn
+}
+
 // Simple Hello test to check if the server is up
 func (c *Client) Hello() error {
 	// Create request
@@ -133,6 +142,8 @@ func (c *Client) waitForResponseWithTimer(r *http.Response,
 			if r.StatusCode != http.StatusOK {
 				return nil, utils.GetErrorFromResponse(r)
 			}
+			c.reportProgress(r)
+			r.Body.Close()
 			time.Sleep(waitTime)
 		} else {
 			return r, nil
@@ -141,6 +152,19 @@ func (c *Client) waitForResponseWithTimer(r *http.Response,
 
 }
 
+// reportProgress passes the progress in the response to a pending
+// operation to the progress function. Servers that do not report
+// progress send an empty body.
+func (c *Client) reportProgress(r *http.Response) {
+	if c.progress == nil || r.ContentLength == 0 {
+		return
+	}
+	var progress api.OperationProgress
+	if err := utils.GetJsonFromResponse(r, &progress); err == nil {
+		c.progress(&progress)
+	}
+}
+
 // Create JSON Web Token
 func (c *Client) setToken(r *http.Request) error {
 
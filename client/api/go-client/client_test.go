@@ -14,10 +14,12 @@ package client
 
 import (
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/chinacoolhacker/heketi/apps/glusterfs"
@@ -700,3 +702,37 @@ func TestClientVolume(t *testing.T) {
 	tests.Assert(t, err == nil)
 
 }
+
+func TestClientProgress(t *testing.T) {
+	polls := 0
+	router := mux.NewRouter()
+	router.HandleFunc("/queue/123", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls < 3 {
+			w.Header().Add("X-Pending", "true")
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, `{"phase": "exec", "step": "bricks created", "done": %v, "total": 2}`, polls)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("GET")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := NewClientNoAuth(ts.URL)
+	var reported []string
+	c.SetProgressFunc(func(p *api.OperationProgress) {
+		reported = append(reported, p.String())
+	})
+
+	r := &http.Response{Header: http.Header{}}
+	r.Header.Set("Location", ts.URL+"/queue/123")
+	r, err := c.waitForResponseWithTimer(r, time.Millisecond)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusNoContent)
+	tests.Assert(t, reflect.DeepEqual(reported, []string{
+		"exec: bricks created 1/2",
+		"exec: bricks created 2/2",
+	}), "got:", reported)
+}
@@ -0,0 +1,56 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), as published by the Free Software Foundation,
+// or under the Apache License, Version 2.0 <LICENSE-APACHE2 or
+// http://www.apache.org/licenses/LICENSE-2.0>.
+//
+// You may not use this file except in compliance with those terms.
+//
+
+package client
+
+import (
+	"net/http"
+
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+)
+
+// PendingOperationList returns the operations that have not completed,
+// including the ones waiting in the server queue.
+func (c *Client) PendingOperationList() (*api.PendingOperationListResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/operations/pending", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var ops api.PendingOperationListResponse
+	err = utils.GetJsonFromResponse(r, &ops)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ops, nil
+}
@@ -27,6 +27,8 @@ var (
 	bv_auth     bool
 	bv_clusters string
 	bv_ha       int
+	bv_enable   bool
+	bv_disable  bool
 )
 
 func init() {
@@ -35,6 +37,7 @@ func init() {
 	blockVolumeCommand.AddCommand(blockVolumeDeleteCommand)
 	blockVolumeCommand.AddCommand(blockVolumeInfoCommand)
 	blockVolumeCommand.AddCommand(blockVolumeListCommand)
+	blockVolumeCommand.AddCommand(blockVolumeAuthCommand)
 
 	blockVolumeCreateCommand.Flags().IntVar(&bv_size, "size", -1,
 		"\n\tSize of volume in GiB")
@@ -50,10 +53,16 @@ func init() {
 			"\n\ton any of the configured clusters which have the available space."+
 			"\n\tProviding a set of clusters will ensure Heketi allocates storage"+
 			"\n\tfor this volume only in the clusters specified.")
+	blockVolumeAuthCommand.Flags().BoolVar(&bv_enable, "enable", false,
+		"\n\tEnable authentication, or rotate the credentials if"+
+			"\n\tauthentication is already enabled")
+	blockVolumeAuthCommand.Flags().BoolVar(&bv_disable, "disable", false,
+		"\n\tDisable authentication")
 	blockVolumeCreateCommand.SilenceUsage = true
 	blockVolumeDeleteCommand.SilenceUsage = true
 	blockVolumeInfoCommand.SilenceUsage = true
 	blockVolumeListCommand.SilenceUsage = true
+	blockVolumeAuthCommand.SilenceUsage = true
 }
 
 var blockVolumeCommand = &cobra.Command{
@@ -104,6 +113,7 @@ var blockVolumeCreateCommand = &cobra.Command{
 		}
 
 		heketi := client.NewClient(options.Url, options.User, options.Key)
+		printProgress(heketi)
 
 		blockvolume, err := heketi.BlockVolumeCreate(req)
 		if err != nil {
@@ -229,3 +239,53 @@ var blockVolumeListCommand = &cobra.Command{
 		return nil
 	},
 }
+
+var blockVolumeAuthCommand = &cobra.Command{
+	Use:   "auth",
+	Short: "Enables, disables or rotates block volume authentication",
+	Long:  "Enables, disables or rotates block volume authentication",
+	Example: `  * Enable authentication, or rotate the credentials of a block volume
+    which already has authentication enabled:
+      $ heketi-cli blockvolume auth 886a86a868711bef83001 --enable
+
+  * Disable authentication:
+      $ heketi-cli blockvolume auth 886a86a868711bef83001 --disable
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+		if bv_enable == bv_disable {
+			return errors.New("Exactly one of --enable or --disable must be given")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		req := &api.BlockVolumeAuthRequest{}
+		req.Auth = bv_enable
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		blockvolume, err := heketi.BlockVolumeSetAuth(volumeId, req)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(blockvolume)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, string(data))
+		} else {
+			fmt.Fprintf(stdout, "%v", blockvolume)
+		}
+
+		return nil
+	},
+}
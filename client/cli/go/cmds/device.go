@@ -132,6 +132,7 @@ var deviceRemoveCommand = &cobra.Command{
 
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
+		printProgress(heketi)
 
 		//set url
 		req := &api.StateRequest{
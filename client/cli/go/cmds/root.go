@@ -14,6 +14,8 @@ import (
 	"io"
 	"os"
 
+	client "github.com/chinacoolhacker/heketi/client/api/go-client"
+	"github.com/chinacoolhacker/heketi/pkg/glusterfs/api"
 	"github.com/spf13/cobra"
 )
 
@@ -87,6 +89,18 @@ func initConfig() {
 	}
 }
 
+// printProgress prints the progress of the operations the client
+// waits for on stderr, each time it changes.
+func printProgress(heketi *client.Client) {
+	var last string
+	heketi.SetProgressFunc(func(p *api.OperationProgress) {
+		if s := p.String(); s != last {
+			fmt.Fprintln(stderr, s)
+			last = s
+		}
+	})
+}
+
 func NewHeketiCli(heketiVersion string, mstderr io.Writer, mstdout io.Writer) *cobra.Command {
 	stderr = mstderr
 	stdout = mstdout
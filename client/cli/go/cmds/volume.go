@@ -186,6 +186,7 @@ var volumeCreateCommand = &cobra.Command{
 
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
+		printProgress(heketi)
 
 		// Add volume
 		volume, err := heketi.VolumeCreate(req)
@@ -252,6 +253,7 @@ var volumeDeleteCommand = &cobra.Command{
 
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
+		printProgress(heketi)
 
 		//set url
 		err := heketi.VolumeDelete(volumeId)
@@ -286,6 +288,7 @@ var volumeExpandCommand = &cobra.Command{
 
 		// Create client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
+		printProgress(heketi)
 
 		// Expand volume
 		volume, err := heketi.VolumeExpand(id, req)
@@ -0,0 +1,310 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// Package agentexec manages the nodes through the heketi node agent,
+// see the agent package. The devices and the bricks are set up with the
+// typed requests of the agent instead of shell commands, and the
+// gluster and gluster-block commands of CmdExecutor are sent to the
+// agent as arguments, never run by a shell.
+package agentexec
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+	"github.com/chinacoolhacker/heketi/pkg/agent"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+// AgentExecutor sends the requests of heketi to the agents of the
+// nodes over mTLS.
+type AgentExecutor struct {
+	cmdexec.CmdExecutor
+
+	config *AgentConfig
+	client *agent.Client
+}
+
+var (
+	logger = utils.NewLogger("[agentexec]", utils.LEVEL_DEBUG)
+)
+
+const (
+	defaultPort = "24011"
+)
+
+func setWithEnvVariables(config *AgentConfig) {
+	var env string
+
+	env = os.Getenv("HEKETI_SNAPSHOT_LIMIT")
+	if "" != env {
+		i, err := strconv.Atoi(env)
+		if err == nil {
+			config.SnapShotLimit = i
+		}
+	}
+}
+
+func NewAgentExecutor(config *AgentConfig) (*AgentExecutor, error) {
+	// Override configuration
+	setWithEnvVariables(config)
+
+	a := &AgentExecutor{}
+	a.RemoteExecutor = a
+	a.InitThrottle()
+	a.Configure(&config.CmdConfig)
+	a.config = config
+
+	if config.Port == "" {
+		config.Port = defaultPort
+	}
+
+	tlsConfig, err := config.TLSFiles.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to set up mTLS with the agents: %v", err)
+	}
+	a.client = agent.NewClient(config.Port, tlsConfig)
+
+	godbc.Ensure(a != nil)
+	godbc.Ensure(a.config == config)
+
+	return a, nil
+}
+
+// WithContext returns a copy of the executor whose requests are
+// cancelled once ctx is done.
+func (a *AgentExecutor) WithContext(ctx context.Context) executors.Executor {
+	c := *a
+	c.RemoteExecutor = &c
+	c.SetContext(ctx)
+	return &c
+}
+
+// do runs request, a series of requests to the agent of host, with the
+// timeout of class.
+func (a *AgentExecutor) do(host string, class cmdexec.CommandClass,
+	request func(ctx context.Context) error) error {
+
+	return a.doContext(a.Context(), host, a.Timeout(class), request)
+}
+
+func (a *AgentExecutor) doContext(ctx context.Context,
+	host string,
+	timeoutMinutes int,
+	request func(ctx context.Context) error) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Throttle
+	if err := a.AccessConnectionContext(ctx, host); err != nil {
+		return err
+	}
+	defer a.FreeConnection(host)
+	executors.ReportHost(ctx, host)
+
+	reqCtx, cancel := context.WithTimeout(ctx,
+		time.Minute*time.Duration(timeoutMinutes))
+	defer cancel()
+
+	err := request(reqCtx)
+	if err != nil && ctx.Err() == nil && reqCtx.Err() != nil {
+		logger.LogError("Timeout of the agent of %v: %v", host, err)
+		return executors.NewError(executors.ErrorTimeout, host,
+			"Agent of %v timed out", host)
+	}
+	if ctx.Err() != nil {
+		return err
+	}
+	return agentError(host, err)
+}
+
+// agentError returns err, the failure of a request to the agent of
+// host, as an *executors.Error if its kind is known.
+func agentError(host string, err error) error {
+	switch e := err.(type) {
+	case *agent.Error:
+		switch e.Code {
+		case agent.ErrorNotFound:
+			return executors.NewError(executors.ErrorNotFound, host, "%s", e.Message)
+		case agent.ErrorTimeout:
+			return executors.NewError(executors.ErrorTimeout, host, "%s", e.Message)
+		case agent.ErrorFailed:
+			return &executors.Error{
+				Kind:     cmdexec.MessageKind(e.Message),
+				Host:     host,
+				ExitCode: e.ExitCode,
+				Stderr:   e.Stderr,
+				Message:  e.Message,
+			}
+		}
+	case net.Error:
+		return &executors.Error{
+			Kind:    executors.ErrorUnreachable,
+			Host:    host,
+			Message: e.Error(),
+		}
+	}
+	return err
+}
+
+// RemoteCommandExecute sends the gluster and gluster-block commands of
+// CmdExecutor to the agent of host, split in their arguments the way a
+// shell would, see splitCommand.
+func (a *AgentExecutor) RemoteCommandExecute(ctx context.Context,
+	host string,
+	commands []string,
+	timeoutMinutes int) ([]string, error) {
+
+	buffers := make([]string, len(commands))
+	for index, command := range commands {
+		args, err := splitCommand(command)
+		if err != nil {
+			return nil, logger.LogError("Unable to send command [%v] to the agent of %v: %v",
+				command, host, err)
+		}
+
+		var run func(context.Context, string, ...string) (string, error)
+		switch args[0] {
+		case "gluster":
+			run = a.client.Gluster
+		case "gluster-block":
+			run = a.client.GlusterBlock
+		default:
+			return nil, fmt.Errorf("Command %v is not supported by the node agent",
+				args[0])
+		}
+
+		err = a.doContext(ctx, host, timeoutMinutes, func(ctx context.Context) error {
+			output, err := run(ctx, host, args[1:]...)
+			buffers[index] = output
+			return err
+		})
+		if err != nil {
+			logger.LogError("Failed to run command [%v] on %v: %v", command, host, err)
+			return nil, err
+		}
+		logger.Debug("Host: %v Command: %v\nResult: %v", host, command, buffers[index])
+	}
+	return buffers, nil
+}
+
+// splitCommand splits command in its arguments the way sh -c does for
+// the commands of CmdExecutor: the arguments are separated by blanks
+// and may be quoted with single or double quotes, or escaped with a
+// backslash. Commands relying on any other feature of the shell, such
+// as pipes, redirections or expansions, are refused since the agent
+// runs no shell.
+func splitCommand(command string) ([]string, error) {
+	var (
+		args    []string
+		arg     []rune
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, c := range command {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("$`\"\\\n", c) {
+				arg = append(arg, '\\')
+			}
+			if c != '\n' {
+				arg = append(arg, c)
+			}
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg = append(arg, c)
+			}
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote == '"':
+			switch c {
+			case '"':
+				quote = 0
+			case '$', '`':
+				return nil, fmt.Errorf("Unsupported %q in command", c)
+			default:
+				arg = append(arg, c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, string(arg))
+				arg, inArg = nil, false
+			}
+		case strings.ContainsRune("|&;<>()$`*?[]{}~#\n", c):
+			return nil, fmt.Errorf("Unsupported %q in command", c)
+		default:
+			arg = append(arg, c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("Unterminated quote or escape in command")
+	}
+	if inArg {
+		args = append(args, string(arg))
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Empty command")
+	}
+	return args, nil
+}
+
+func (a *AgentExecutor) GlusterdCheck(host string) error {
+	godbc.Require(host != "")
+
+	logger.Info("Check Glusterd service status in node %v", host)
+	var status *agent.ServiceStatus
+	err := a.do(host, cmdexec.CommandOther, func(ctx context.Context) (err error) {
+		status, err = a.client.ServiceStatus(ctx, host, "glusterd")
+		return
+	})
+	if err == nil && !status.Active {
+		err = fmt.Errorf("glusterd is not running on %v", host)
+	}
+	if err != nil {
+		logger.Err(err)
+		return err
+	}
+
+	return nil
+}
+
+// SshdControl fails with ErrSshdNotSupported, the agent only runs
+// gluster and gluster-block commands.
+func (a *AgentExecutor) SshdControl(host string, action string) error {
+	logger.Warning("Unable to %v sshd on %v: %v", action, host,
+		executors.ErrSshdNotSupported)
+	return executors.ErrSshdNotSupported
+}
+
+func (a *AgentExecutor) RebalanceOnExpansion() bool {
+	return a.config.RebalanceOnExpansion
+}
+
+func (a *AgentExecutor) SnapShotLimit() int {
+	return a.config.SnapShotLimit
+}
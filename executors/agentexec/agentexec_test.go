@@ -0,0 +1,299 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agentexec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/pkg/agent"
+	"github.com/chinacoolhacker/heketi/pkg/agent/agenttest"
+	"github.com/heketi/tests"
+)
+
+// fakeAgent records the requests it receives and answers the results
+// and errors set for their paths.
+type fakeAgent struct {
+	*agenttest.AgentTestServer
+
+	lock     sync.Mutex
+	received []string
+	results  map[string]interface{}
+	errors   map[string]*agent.Error
+}
+
+func newFakeAgent() *fakeAgent {
+	f := &fakeAgent{
+		results: map[string]interface{}{},
+		errors:  map[string]*agent.Error{},
+	}
+	f.AgentTestServer = agenttest.NewAgentTestServerHandler(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeAgent) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.received = append(f.received, r.URL.Path+" "+strings.TrimSpace(string(body)))
+
+	w.Header().Set("Content-Type", "application/json")
+	if e, ok := f.errors[r.URL.Path]; ok {
+		w.WriteHeader(e.StatusCode())
+		json.NewEncoder(w).Encode(e)
+		return
+	}
+	result, ok := f.results[r.URL.Path]
+	if !ok {
+		result = struct{}{}
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeAgent) config() *AgentConfig {
+	return &AgentConfig{
+		Port:     f.Port,
+		TLSFiles: f.ClientFiles,
+	}
+}
+
+func (f *fakeAgent) paths() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var paths []string
+	for _, r := range f.received {
+		paths = append(paths, strings.Fields(r)[0])
+	}
+	return paths
+}
+
+func testAgentExecutor(t *testing.T, f *fakeAgent) *AgentExecutor {
+	a, err := NewAgentExecutor(f.config())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return a
+}
+
+func TestNewAgentExecutor(t *testing.T) {
+	f := newFakeAgent()
+	defer f.Close()
+
+	config := f.config()
+	config.Port = ""
+	a, err := NewAgentExecutor(config)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, a.RemoteExecutor == a)
+	tests.Assert(t, a.config.Port == "24011")
+
+	// the agents are only reached over mTLS
+	_, err = NewAgentExecutor(&AgentConfig{})
+	tests.Assert(t, err != nil)
+	config.KeyFile = "/no/such/file"
+	_, err = NewAgentExecutor(config)
+	tests.Assert(t, err != nil)
+}
+
+func TestAgentExecutorDevice(t *testing.T) {
+	f := newFakeAgent()
+	defer f.Close()
+	a := testAgentExecutor(t, f)
+
+	f.results[agent.PathVgInfo] = &agent.VgInfo{
+		Vg:          "vg_abc",
+		ExtentSize:  4096,
+		FreeExtents: 100,
+	}
+	d, err := a.DeviceSetup(f.Host, "/dev/sdb", "abc")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, d.Size == 409600, d)
+	tests.Assert(t, d.ExtentSize == 4096, d)
+	tests.Assert(t, len(f.received) == 3, f.received)
+	tests.Assert(t, f.received[0] == agent.PathPvCreate+` {"device":"/dev/sdb"}`,
+		f.received[0])
+	tests.Assert(t, f.received[1] == agent.PathVgCreate+` {"vg":"vg_abc","devices":["/dev/sdb"]}`,
+		f.received[1])
+	tests.Assert(t, f.received[2] == agent.PathVgInfo+` {"vg":"vg_abc"}`,
+		f.received[2])
+
+	// the device is torn down when its size cannot be read
+	f.received = nil
+	f.errors[agent.PathVgInfo] = &agent.Error{Code: agent.ErrorFailed, Message: "failed"}
+	_, err = a.DeviceSetup(f.Host, "/dev/sdb", "abc")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "failed", err)
+	paths := f.paths()
+	tests.Assert(t, len(paths) == 6, paths)
+	tests.Assert(t, paths[3] == agent.PathVgRemove, paths)
+	tests.Assert(t, paths[4] == agent.PathPvRemove, paths)
+	tests.Assert(t, paths[5] == agent.PathRmdir, paths)
+	tests.Assert(t, f.received[5] == agent.PathRmdir+` {"path":"/var/lib/heketi/mounts/vg_abc"}`,
+		f.received[5])
+}
+
+func TestAgentExecutorBrick(t *testing.T) {
+	f := newFakeAgent()
+	defer f.Close()
+	a := testAgentExecutor(t, f)
+
+	brick := &executors.BrickRequest{
+		VgId:             "abc",
+		Name:             "b1",
+		TpSize:           2048,
+		Size:             1024,
+		PoolMetadataSize: 16,
+		Gid:              2000,
+		Path:             "/var/lib/heketi/mounts/vg_abc/brick_b1/brick",
+	}
+	info, err := a.BrickCreate(f.Host, brick)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Path == brick.Path, info)
+	tests.Assert(t, len(f.received) == 4, f.received)
+	tests.Assert(t, f.received[0] == agent.PathThinLvCreate+
+		` {"vg":"vg_abc","thin_pool":"tp_b1","pool_size_kb":2048,"pool_metadata_size_kb":16,"lv":"brick_b1","size_kb":1024}`,
+		f.received[0])
+	tests.Assert(t, f.received[1] == agent.PathMkfs+` {"device":"/dev/mapper/vg_abc-brick_b1"}`,
+		f.received[1])
+	tests.Assert(t, f.received[2] == agent.PathMount+
+		` {"device":"/dev/mapper/vg_abc-brick_b1","path":"/var/lib/heketi/mounts/vg_abc/brick_b1"}`,
+		f.received[2])
+	tests.Assert(t, f.received[3] == agent.PathMkdir+
+		` {"path":"/var/lib/heketi/mounts/vg_abc/brick_b1/brick","gid":2000}`,
+		f.received[3])
+
+	// the thin pool of the brick is only used by the brick
+	f.received = nil
+	f.results[agent.PathThinPoolUsage] = &agent.ThinPoolUsage{ThinCount: 1}
+	err = a.BrickDestroyCheck(f.Host, brick)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f.received[0] == agent.PathThinPoolUsage+` {"vg":"vg_abc","lv":"tp_b1"}`,
+		f.received[0])
+	f.results[agent.PathThinPoolUsage] = &agent.ThinPoolUsage{ThinCount: 3}
+	err = a.BrickDestroyCheck(f.Host, brick)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "used by [2] snapshot(s)"), err)
+
+	// a failed brick is destroyed
+	f.received = nil
+	f.errors[agent.PathMkfs] = &agent.Error{Code: agent.ErrorFailed, Message: "mkfs failed"}
+	_, err = a.BrickCreate(f.Host, brick)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "mkfs failed", err)
+	paths := f.paths()
+	tests.Assert(t, len(paths) == 5, paths)
+	tests.Assert(t, paths[2] == agent.PathUnmount, paths)
+	tests.Assert(t, f.received[2] == agent.PathUnmount+
+		` {"path":"/var/lib/heketi/mounts/vg_abc/brick_b1"}`,
+		f.received[2])
+	tests.Assert(t, f.received[3] == agent.PathLvRemove+` {"vg":"vg_abc","lv":"tp_b1"}`,
+		f.received[3])
+	tests.Assert(t, paths[4] == agent.PathRmdir, paths)
+}
+
+func TestAgentExecutorGluster(t *testing.T) {
+	f := newFakeAgent()
+	defer f.Close()
+	a := testAgentExecutor(t, f)
+
+	err := a.PeerProbe(f.Host, "node2")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f.received[0] == agent.PathGluster+` {"args":["peer","probe","node2"]}`,
+		f.received[0])
+
+	f.errors[agent.PathGluster] = &agent.Error{
+		Code:     agent.ErrorFailed,
+		Message:  "volume stop: vol1: failed: Volume vol1 does not exist",
+		ExitCode: 1,
+	}
+	err = a.VolumeDestroy(f.Host, "vol1")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "Volume vol1 does not exist"), err)
+	tests.Assert(t, executors.KindOf(err) == executors.ErrorNotFound, err)
+
+	// the agent does not run other commands
+	f.received = nil
+	_, err = a.RemoteCommandExecute(a.Context(), f.Host, []string{"rm -rf /"}, 1)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(f.received) == 0, f.received)
+
+	// nor commands needing a shell
+	_, err = a.RemoteCommandExecute(a.Context(), f.Host,
+		[]string{"gluster volume info; rm -rf /"}, 1)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(f.received) == 0, f.received)
+
+	// quoted arguments are kept whole
+	delete(f.errors, agent.PathGluster)
+	_, err = a.RemoteCommandExecute(a.Context(), f.Host,
+		[]string{`gluster volume geo-replication vol slave::vol config ssh-command 'ssh -p 22'`}, 1)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, f.received[0] == agent.PathGluster+
+		` {"args":["volume","geo-replication","vol","slave::vol","config","ssh-command","ssh -p 22"]}`,
+		f.received[0])
+}
+
+func TestSplitCommand(t *testing.T) {
+	for command, expected := range map[string][]string{
+		"gluster peer probe node2":     {"gluster", "peer", "probe", "node2"},
+		"gluster-block create v/b  ha": {"gluster-block", "create", "v/b", "ha"},
+		`a 'b c' "d e" f\ g`:           {"a", "b c", "d e", "f g"},
+		`a "b \"c\" \d" 'e\f'`:         {"a", `b "c" \d`, `e\f`},
+		`a '' "" 'b;c|d'`:              {"a", "", "", "b;c|d"},
+	} {
+		args, err := splitCommand(command)
+		tests.Assert(t, err == nil, command, err)
+		tests.Assert(t, reflect.DeepEqual(args, expected), command, args)
+	}
+
+	for _, command := range []string{
+		"",
+		"  ",
+		"gluster volume info | tee out",
+		"gluster volume info > out",
+		"gluster volume info $VOL",
+		`gluster volume info "$VOL"`,
+		"gluster volume info `id`",
+		"gluster volume info 'vol",
+		`gluster volume info vol\`,
+	} {
+		_, err := splitCommand(command)
+		tests.Assert(t, err != nil, command)
+	}
+}
+
+func TestAgentExecutorSshdControl(t *testing.T) {
+	f := newFakeAgent()
+	defer f.Close()
+	a := testAgentExecutor(t, f)
+
+	err := a.SshdControl(f.Host, "start")
+	tests.Assert(t, err == executors.ErrSshdNotSupported, err)
+	tests.Assert(t, len(f.received) == 0, f.received)
+}
+
+func TestAgentExecutorGlusterdCheck(t *testing.T) {
+	f := newFakeAgent()
+	defer f.Close()
+	a := testAgentExecutor(t, f)
+
+	f.results[agent.PathServiceStatus] = &agent.ServiceStatus{Service: "glusterd", Active: true}
+	err := a.GlusterdCheck(f.Host)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f.received[0] == agent.PathServiceStatus+` {"service":"glusterd"}`,
+		f.received[0])
+
+	f.results[agent.PathServiceStatus] = &agent.ServiceStatus{Service: "glusterd"}
+	err = a.GlusterdCheck(f.Host)
+	tests.Assert(t, err != nil)
+}
@@ -0,0 +1,155 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agentexec
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+	"github.com/chinacoolhacker/heketi/pkg/agent"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+func (a *AgentExecutor) BrickCreate(host string,
+	brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+
+	godbc.Require(brick != nil)
+	godbc.Require(host != "")
+	godbc.Require(brick.Name != "")
+	godbc.Require(brick.Size > 0)
+	godbc.Require(brick.TpSize >= brick.Size)
+	godbc.Require(brick.VgId != "")
+	godbc.Require(brick.Path != "")
+
+	brickPath := brick.Path
+	devnode := utils.BrickDevNode(brick.VgId, brick.Name)
+	err := a.do(host, cmdexec.CommandLvm, func(ctx context.Context) error {
+		// Setup the LV
+		err := a.client.ThinLvCreate(ctx, host, &agent.ThinLvRequest{
+			Vg:               utils.VgIdToName(brick.VgId),
+			ThinPool:         utils.BrickIdToThinPoolName(brick.Name),
+			PoolSize:         brick.TpSize,
+			PoolMetadataSize: brick.PoolMetadataSize,
+			Lv:               utils.BrickIdToName(brick.Name),
+			Size:             brick.Size,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Format
+		if err := a.client.Mkfs(ctx, host, devnode); err != nil {
+			return err
+		}
+
+		// Mount, creating the mount point and adding it to the fstab
+		// of the agent
+		err = a.client.Mount(ctx, host, &agent.MountRequest{
+			Device: devnode,
+			Path:   utils.BrickMountFromPath(brickPath),
+		})
+		if err != nil {
+			return err
+		}
+
+		// Create a directory inside the formated volume for GlusterFS,
+		// writable by the group of the volume if it has one
+		return a.client.Mkdir(ctx, host, &agent.DirRequest{
+			Path: brickPath,
+			Gid:  brick.Gid,
+		})
+	})
+	if err != nil {
+		// Cleanup
+		a.BrickDestroy(host, brick)
+		return nil, err
+	}
+
+	// Save brick location
+	b := &executors.BrickInfo{
+		Path: brickPath,
+	}
+	return b, nil
+}
+
+func (a *AgentExecutor) BrickDestroy(host string,
+	brick *executors.BrickRequest) error {
+
+	godbc.Require(brick != nil)
+	godbc.Require(host != "")
+	godbc.Require(brick.Name != "")
+	godbc.Require(brick.VgId != "")
+
+	mp := utils.BrickMountPoint(brick.VgId, brick.Name)
+	// Try to unmount first, removing the mount from the fstab
+	err := a.do(host, cmdexec.CommandMount, func(ctx context.Context) error {
+		return a.client.Unmount(ctx, host, &agent.UnmountRequest{
+			Path: mp,
+		})
+	})
+	if err != nil {
+		logger.Err(err)
+	}
+
+	// Now try to remove the LV
+	err = a.do(host, cmdexec.CommandLvm, func(ctx context.Context) error {
+		return a.client.LvRemove(ctx, host, utils.VgIdToName(brick.VgId),
+			utils.BrickIdToThinPoolName(brick.Name))
+	})
+	if err != nil {
+		logger.Err(err)
+	}
+
+	// Now cleanup the mount point
+	err = a.do(host, cmdexec.CommandMount, func(ctx context.Context) error {
+		return a.client.Rmdir(ctx, host, mp)
+	})
+	if err != nil {
+		logger.Err(err)
+	}
+
+	return nil
+}
+
+// BrickDestroyCheck refuses to destroy a brick whose thin pool is also
+// used by snapshots or cloned volumes.
+func (a *AgentExecutor) BrickDestroyCheck(host string,
+	brick *executors.BrickRequest) error {
+	godbc.Require(brick != nil)
+	godbc.Require(host != "")
+	godbc.Require(brick.Name != "")
+	godbc.Require(brick.VgId != "")
+
+	tp := utils.BrickIdToThinPoolName(brick.Name)
+	var usage *agent.ThinPoolUsage
+	err := a.do(host, cmdexec.CommandLvm, func(ctx context.Context) (err error) {
+		usage, err = a.client.ThinPoolUsage(ctx, host,
+			utils.VgIdToName(brick.VgId), tp)
+		return
+	})
+	if err != nil {
+		logger.Err(err)
+		return fmt.Errorf("Unable to determine number of logical volumes in "+
+			"thin pool %v on host %v", tp, host)
+	}
+
+	if usage.ThinCount != 1 {
+		return fmt.Errorf("Cannot delete thin pool %v on %v because it "+
+			"is used by [%v] snapshot(s) or cloned volume(s)",
+			tp,
+			host,
+			usage.ThinCount-1)
+	}
+
+	return nil
+}
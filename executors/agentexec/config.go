@@ -0,0 +1,27 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agentexec
+
+import (
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+	"github.com/chinacoolhacker/heketi/pkg/agent"
+)
+
+type AgentConfig struct {
+	cmdexec.CmdConfig
+
+	// port of the agents on the nodes
+	Port string `json:"port"`
+
+	// certificate heketi presents to the agents and certificate of the
+	// authority which signed the certificates of heketi and the agents.
+	// They are required, the agents only talk mTLS.
+	agent.TLSFiles
+}
@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agentexec
+
+import (
+	"context"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+	"github.com/chinacoolhacker/heketi/pkg/agent"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+)
+
+func (a *AgentExecutor) DeviceSetup(host, device, vgid string) (d *executors.DeviceInfo, e error) {
+
+	vg := utils.VgIdToName(vgid)
+	err := a.do(host, cmdexec.CommandLvm, func(ctx context.Context) error {
+		if err := a.client.PvCreate(ctx, host, device); err != nil {
+			return err
+		}
+		return a.client.VgCreate(ctx, host, vg, device)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a cleanup function if anything fails
+	defer func() {
+		if e != nil {
+			a.DeviceTeardown(host, device, vgid)
+		}
+	}()
+
+	return a.GetDeviceInfo(host, device, vgid)
+}
+
+func (a *AgentExecutor) GetDeviceInfo(host, device, vgid string) (*executors.DeviceInfo, error) {
+	var info *agent.VgInfo
+	err := a.do(host, cmdexec.CommandLvm, func(ctx context.Context) (err error) {
+		info, err = a.client.VgInfo(ctx, host, utils.VgIdToName(vgid))
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	d := &executors.DeviceInfo{
+		Size:       info.FreeExtents * info.ExtentSize,
+		ExtentSize: info.ExtentSize,
+	}
+	logger.Debug("Size of %v in %v is %v", device, host, d.Size)
+	return d, nil
+}
+
+func (a *AgentExecutor) DeviceTeardown(host, device, vgid string) error {
+
+	err := a.do(host, cmdexec.CommandLvm, func(ctx context.Context) error {
+		if err := a.client.VgRemove(ctx, host, utils.VgIdToName(vgid)); err != nil {
+			return err
+		}
+		return a.client.PvRemove(ctx, host, device)
+	})
+	if err != nil {
+		logger.LogError("Error while deleting device %v with id %v on host %v: %v",
+			device, vgid, host, err)
+	}
+
+	err = a.do(host, cmdexec.CommandMount, func(ctx context.Context) error {
+		return a.client.Rmdir(ctx, host, utils.BrickMountPointParent(vgid))
+	})
+	if err != nil && executors.KindOf(err) != executors.ErrorNotFound {
+		logger.LogError("Error while removing the VG directory")
+	}
+
+	return nil
+}
@@ -49,7 +49,7 @@ func (s *CmdExecutor) BlockVolumeCreate(host string,
 	commands := []string{cmd}
 
 	// Execute command
-	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	output, err := s.ExecCommands(host, commands, CommandGluster)
 	if err != nil {
 		s.BlockVolumeDestroy(host, volume.GlusterVolumeName, volume.Name)
 		return nil, err
@@ -64,7 +64,7 @@ func (s *CmdExecutor) BlockVolumeCreate(host string,
 	if blockVolumeCreate.Result == "FAIL" {
 		s.BlockVolumeDestroy(host, volume.GlusterVolumeName, volume.Name)
 		logger.LogError("%v", blockVolumeCreate.ErrMsg)
-		return nil, fmt.Errorf("%v", blockVolumeCreate.ErrMsg)
+		return nil, commandError(host, blockVolumeCreate.ErrMsg)
 	}
 
 	var blockVolumeInfo executors.BlockVolumeInfo
@@ -97,7 +97,7 @@ func (s *CmdExecutor) BlockVolumeDestroy(host string, blockHostingVolumeName str
 		ErrCode      int    `json:"errCode"`
 		ErrMsg       string `json:"errMsg"`
 	}
-	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	output, err := s.ExecCommands(host, commands, CommandGluster)
 	if err != nil {
 		logger.LogError("Unable to delete volume %v: %v", blockVolumeName, err)
 		return err
@@ -111,9 +111,70 @@ func (s *CmdExecutor) BlockVolumeDestroy(host string, blockHostingVolumeName str
 	}
 
 	if blockVolumeDelete.Result == "FAIL" {
-		err := logger.LogError("%v", blockVolumeDelete.ErrMsg)
-		return err
+		logger.LogError("%v", blockVolumeDelete.ErrMsg)
+		return commandError(host, blockVolumeDelete.ErrMsg)
 	}
 
 	return nil
 }
+
+func (s *CmdExecutor) BlockVolumeModifyAuth(host string,
+	blockHostingVolumeName string,
+	blockVolumeName string,
+	auth bool) (*executors.BlockVolumeInfo, error) {
+
+	godbc.Require(host != "")
+	godbc.Require(blockHostingVolumeName != "")
+	godbc.Require(blockVolumeName != "")
+
+	type CliOutput struct {
+		Iqn      string `json:"IQN"`
+		Username string `json:"USERNAME"`
+		Password string `json:"PASSWORD"`
+		Result   string `json:"RESULT"`
+		ErrCode  int    `json:"errCode"`
+		ErrMsg   string `json:"errMsg"`
+	}
+
+	var auth_set string
+	if auth {
+		auth_set = "enable"
+	} else {
+		auth_set = "disable"
+	}
+
+	// Enabling auth on a block volume which already has auth enabled
+	// is how credentials are rotated; the caller checks that the
+	// returned password differs from the stored one.
+	commands := []string{
+		fmt.Sprintf("gluster-block modify %v/%v auth %v --json",
+			blockHostingVolumeName, blockVolumeName, auth_set),
+	}
+
+	output, err := s.ExecCommands(host, commands, CommandGluster)
+	if err != nil {
+		logger.LogError("Unable to modify auth of block volume %v: %v", blockVolumeName, err)
+		return nil, err
+	}
+
+	var blockVolumeModify CliOutput
+	err = json.Unmarshal([]byte(output[0]), &blockVolumeModify)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the block volume modify info for block volume %v", blockVolumeName)
+	}
+
+	if blockVolumeModify.Result == "FAIL" {
+		logger.LogError("%v", blockVolumeModify.ErrMsg)
+		return nil, commandError(host, blockVolumeModify.ErrMsg)
+	}
+
+	var blockVolumeInfo executors.BlockVolumeInfo
+
+	blockVolumeInfo.GlusterVolumeName = blockHostingVolumeName
+	blockVolumeInfo.Name = blockVolumeName
+	blockVolumeInfo.Iqn = blockVolumeModify.Iqn
+	blockVolumeInfo.Username = blockVolumeModify.Username
+	blockVolumeInfo.Password = blockVolumeModify.Password
+
+	return &blockVolumeInfo, nil
+}
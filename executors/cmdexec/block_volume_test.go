@@ -0,0 +1,93 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestBlockVolumeModifyAuthEnable(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t,
+			commands[0] == "gluster-block modify hostvol/blockvol auth enable --json",
+			commands)
+
+		return []string{`{ "IQN":"iqn.2016-12.org.gluster-block:aaaa",` +
+			` "USERNAME":"aaaa", "PASSWORD":"bbbb",` +
+			` "SUCCESSFUL ON":[ "192.168.10.100" ], "RESULT":"SUCCESS" }`}, nil
+	}
+
+	info, err := s.BlockVolumeModifyAuth("myhost", "hostvol", "blockvol", true)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.Name == "blockvol")
+	tests.Assert(t, info.GlusterVolumeName == "hostvol")
+	tests.Assert(t, info.Iqn == "iqn.2016-12.org.gluster-block:aaaa")
+	tests.Assert(t, info.Username == "aaaa")
+	tests.Assert(t, info.Password == "bbbb")
+}
+
+func TestBlockVolumeModifyAuthDisable(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t,
+			commands[0] == "gluster-block modify hostvol/blockvol auth disable --json",
+			commands)
+
+		return []string{`{ "IQN":"iqn.2016-12.org.gluster-block:aaaa",` +
+			` "SUCCESSFUL ON":[ "192.168.10.100" ], "RESULT":"SUCCESS" }`}, nil
+	}
+
+	info, err := s.BlockVolumeModifyAuth("myhost", "hostvol", "blockvol", false)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.Username == "")
+	tests.Assert(t, info.Password == "")
+}
+
+func TestBlockVolumeModifyAuthFail(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		return []string{`{ "RESULT":"FAIL", "errCode":255,` +
+			` "errMsg":"block blockvol doesn't exist" }`}, nil
+	}
+
+	info, err := s.BlockVolumeModifyAuth("myhost", "hostvol", "blockvol", true)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "block blockvol doesn't exist", err)
+	tests.Assert(t, info == nil)
+}
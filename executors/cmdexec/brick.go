@@ -91,7 +91,7 @@ func (s *CmdExecutor) BrickCreate(host string,
 	}
 
 	// Execute commands
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.ExecCommands(host, commands, CommandLvm)
 	if err != nil {
 		// Cleanup
 		s.BrickDestroy(host, brick)
@@ -118,7 +118,7 @@ func (s *CmdExecutor) BrickDestroy(host string,
 	commands := []string{
 		fmt.Sprintf("umount %v", mp),
 	}
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err := s.ExecCommands(host, commands, CommandMount)
 	if err != nil {
 		logger.Err(err)
 	}
@@ -127,7 +127,7 @@ func (s *CmdExecutor) BrickDestroy(host string,
 	commands = []string{
 		fmt.Sprintf("lvremove -f %v", utils.BrickThinLvName(brick.VgId, brick.Name)),
 	}
-	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err = s.ExecCommands(host, commands, CommandLvm)
 	if err != nil {
 		logger.Err(err)
 	}
@@ -136,7 +136,7 @@ func (s *CmdExecutor) BrickDestroy(host string,
 	commands = []string{
 		fmt.Sprintf("rmdir %v", mp),
 	}
-	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err = s.ExecCommands(host, commands, CommandMount)
 	if err != nil {
 		logger.Err(err)
 	}
@@ -147,7 +147,7 @@ func (s *CmdExecutor) BrickDestroy(host string,
 			utils.BrickIdToName(brick.Name),
 			s.Fstab),
 	}
-	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err = s.ExecCommands(host, commands, CommandMount)
 	if err != nil {
 		logger.Err(err)
 	}
@@ -188,10 +188,10 @@ func (s *CmdExecutor) checkThinPoolUsage(host string,
 	}
 
 	// Send command
-	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	output, err := s.ExecCommands(host, commands, CommandLvm)
 	if err != nil {
 		logger.Err(err)
-		return fmt.Errorf("Unable to determine number of logical volumes in "+
+		return executors.WrapError(err, "Unable to determine number of logical volumes in "+
 			"thin pool %v on host %v", tp, host)
 	}
 
@@ -199,8 +199,9 @@ func (s *CmdExecutor) checkThinPoolUsage(host string,
 	// we cannot delete the brick
 	lvs := strings.Index(output[0], tp+":1")
 	if lvs == -1 {
-		return fmt.Errorf("Cannot delete thin pool %v on %v because it "+
-			"is used by [%v] snapshot(s) or cloned volume(s)",
+		return executors.NewError(executors.ErrorBusy, host,
+			"Cannot delete thin pool %v on %v because it "+
+				"is used by [%v] snapshot(s) or cloned volume(s)",
 			tp,
 			host,
 			lvs)
@@ -10,30 +10,141 @@
 package cmdexec
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 )
 
 var (
 	logger = utils.NewLogger("[cmdexec]", utils.LEVEL_DEBUG)
+
+	// Per host count of commands and time they waited for a
+	// connection, see ThrottleStats
+	throttleLock  sync.Mutex
+	throttleStats = map[string]ThrottleStat{}
+
+	// Waits for a connection longer than this are logged
+	throttleLogThreshold = time.Second
+)
+
+// ThrottleStat counts the commands sent to a host and the time they
+// waited for a connection to it.
+type ThrottleStat struct {
+	Commands int64
+	Wait     time.Duration
+}
+
+// CommandClass groups commands sharing the same timeout.
+type CommandClass int
+
+const (
+	CommandOther CommandClass = iota
+	CommandLvm
+	CommandGluster
+	CommandMount
 )
 
+// Timeouts in minutes used when the configuration sets none
+var defaultTimeouts = map[CommandClass]int{
+	CommandOther:   10,
+	CommandLvm:     10,
+	CommandGluster: 10,
+	CommandMount:   5,
+}
+
 type RemoteCommandTransport interface {
-	RemoteCommandExecute(host string, commands []string, timeoutMinutes int) ([]string, error)
+	RemoteCommandExecute(ctx context.Context,
+		host string, commands []string, timeoutMinutes int) ([]string, error)
 	RebalanceOnExpansion() bool
 	SnapShotLimit() int
 }
 
 type CmdExecutor struct {
+	// The throttle is shared by the copies of the executor bound
+	// to a context, hence the lock is a pointer.
 	Throttlemap map[string]chan bool
-	Lock        sync.Mutex
+	Lock        *sync.Mutex
 
 	RemoteExecutor RemoteCommandTransport
 	Fstab          string
+
+	// The nodes are reached over ssh, SshdControl refuses to stop
+	// or disable their sshd.
+	SshTransport bool
+
+	ctx            context.Context
+	maxConnections int
+	timeouts       CmdTimeouts
+}
+
+// InitThrottle sets up the per host throttle of the executor.
+func (s *CmdExecutor) InitThrottle() {
+	s.Throttlemap = make(map[string]chan bool)
+	s.Lock = &sync.Mutex{}
+}
+
+// Configure applies the concurrency and timeout settings of config. It
+// must be called before any command is run.
+func (s *CmdExecutor) Configure(config *CmdConfig) {
+	s.maxConnections = config.MaxConnectionsPerHost
+	s.timeouts = config.Timeouts
+}
+
+// Timeout returns the minutes commands of class are given to complete.
+func (s *CmdExecutor) Timeout(class CommandClass) int {
+	var timeout int
+	switch class {
+	case CommandLvm:
+		timeout = s.timeouts.Lvm
+	case CommandGluster:
+		timeout = s.timeouts.Gluster
+	case CommandMount:
+		timeout = s.timeouts.Mount
+	}
+	if timeout == 0 {
+		timeout = s.timeouts.Default
+	}
+	if timeout == 0 {
+		timeout = defaultTimeouts[class]
+	}
+	return timeout
+}
+
+// ExecCommands runs commands on host with the timeout of their class.
+// The failures of the commands are classified, see classifyError.
+func (s *CmdExecutor) ExecCommands(host string,
+	commands []string, class CommandClass) ([]string, error) {
+
+	output, err := s.RemoteExecutor.RemoteCommandExecute(s.Context(),
+		host, commands, s.Timeout(class))
+	return output, classifyError(err)
+}
+
+// Context returns the context the commands of the executor are bound
+// to. Executors not bound to a context are never cancelled.
+func (s *CmdExecutor) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// SetContext binds the commands of the executor to ctx. It is meant to
+// be called on a copy of the executor, see WithContext of sshexec.
+func (s *CmdExecutor) SetContext(ctx context.Context) {
+	s.ctx = ctx
 }
 
 func (s *CmdExecutor) AccessConnection(host string) {
+	s.AccessConnectionContext(context.Background(), host)
+}
+
+// AccessConnectionContext waits for the connection to host to be
+// available. It returns an error, without the connection, if ctx is
+// done first.
+func (s *CmdExecutor) AccessConnectionContext(ctx context.Context, host string) error {
 	var (
 		c  chan bool
 		ok bool
@@ -41,12 +152,47 @@ func (s *CmdExecutor) AccessConnection(host string) {
 
 	s.Lock.Lock()
 	if c, ok = s.Throttlemap[host]; !ok {
-		c = make(chan bool, 1)
+		max := s.maxConnections
+		if max < 1 {
+			max = 1
+		}
+		c = make(chan bool, max)
 		s.Throttlemap[host] = c
 	}
 	s.Lock.Unlock()
 
-	c <- true
+	start := time.Now()
+	select {
+	case c <- true:
+		recordThrottleWait(host, time.Since(start))
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func recordThrottleWait(host string, wait time.Duration) {
+	if wait >= throttleLogThreshold {
+		logger.Info("Waited %v for a connection to %v", wait, host)
+	}
+	throttleLock.Lock()
+	defer throttleLock.Unlock()
+	stat := throttleStats[host]
+	stat.Commands++
+	stat.Wait += wait
+	throttleStats[host] = stat
+}
+
+// ThrottleStats returns, per host, the commands sent by the executors
+// of the process and the time they waited for a connection.
+func ThrottleStats() map[string]ThrottleStat {
+	throttleLock.Lock()
+	defer throttleLock.Unlock()
+	stats := make(map[string]ThrottleStat, len(throttleStats))
+	for host, stat := range throttleStats {
+		stats[host] = stat
+	}
+	return stats
 }
 
 func (s *CmdExecutor) FreeConnection(host string) {
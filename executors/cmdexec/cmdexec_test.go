@@ -0,0 +1,124 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/heketi/tests"
+)
+
+func TestCmdExecutorTimeouts(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+
+	// the timeouts heketi always used
+	tests.Assert(t, s.Timeout(CommandOther) == 10)
+	tests.Assert(t, s.Timeout(CommandLvm) == 10)
+	tests.Assert(t, s.Timeout(CommandGluster) == 10)
+	tests.Assert(t, s.Timeout(CommandMount) == 5)
+
+	s.Configure(&CmdConfig{Timeouts: CmdTimeouts{Default: 3, Gluster: 20}})
+	tests.Assert(t, s.Timeout(CommandOther) == 3)
+	tests.Assert(t, s.Timeout(CommandLvm) == 3)
+	tests.Assert(t, s.Timeout(CommandGluster) == 20)
+	tests.Assert(t, s.Timeout(CommandMount) == 3)
+
+	var timeouts []int
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		timeouts = append(timeouts, timeoutMinutes)
+		return []string{"<cliOutput></cliOutput>"}, nil
+	}
+	err = s.PeerProbe("host", "newnode")
+	tests.Assert(t, err == nil, err)
+	err = s.VolumeDestroyCheck("host", "vol")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(timeouts) == 2, timeouts)
+	tests.Assert(t, timeouts[0] == 20, timeouts)
+	tests.Assert(t, timeouts[1] == 20, timeouts)
+}
+
+func TestCmdExecutorConnectionsPerHost(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	s.Configure(&CmdConfig{MaxConnectionsPerHost: 2})
+
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	release := make(chan bool)
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		<-release
+		lock.Lock()
+		running--
+		lock.Unlock()
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.GlusterdCheck("host")
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	lock.Lock()
+	tests.Assert(t, running == 2, "got:", running)
+	lock.Unlock()
+
+	close(release)
+	wg.Wait()
+	tests.Assert(t, maxRunning == 2, "got:", maxRunning)
+	tests.Assert(t, ThrottleStats()["host"].Commands >= 3,
+		"got:", ThrottleStats()["host"])
+}
+
+func TestCmdExecutorDoesNotRetry(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	s.Configure(&CmdConfig{Retries: 2})
+
+	calls := 0
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		calls++
+		return nil, executors.NewError(executors.ErrorUnreachable,
+			host, "connection refused")
+	}
+
+	// the queries are retried by retryexec, once for all executors
+	err = s.GlusterdCheck("host")
+	tests.Assert(t, executors.KindOf(err) == executors.ErrorUnreachable, err)
+	tests.Assert(t, calls == 1, "got:", calls)
+}
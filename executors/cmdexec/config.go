@@ -14,4 +14,23 @@ type CmdConfig struct {
 	Sudo                 bool   `json:"sudo"`
 	SnapShotLimit        int    `json:"snapshot_limit"`
 	RebalanceOnExpansion bool   `json:"rebalance_on_expansion"`
+
+	// commands run at the same time on a host, one if unset
+	MaxConnectionsPerHost int `json:"max_connections_per_host"`
+	// minutes commands are given to complete
+	Timeouts CmdTimeouts `json:"timeouts"`
+	// deprecated, the commands are retried by retryexec. Used as
+	// executor_retry with Retries+1 attempts when executor_retry
+	// sets no attempts.
+	Retries int `json:"retries"`
+}
+
+// CmdTimeouts sets the minutes given to each class of commands. The
+// classes not set use Default, and if Default is not set either the
+// timeouts heketi always used.
+type CmdTimeouts struct {
+	Default int `json:"default"`
+	Lvm     int `json:"lvm"`
+	Gluster int `json:"gluster"`
+	Mount   int `json:"mount"`
 }
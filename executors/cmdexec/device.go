@@ -40,7 +40,7 @@ func (s *CmdExecutor) DeviceSetup(host, device, vgid string) (d *executors.Devic
 	}
 
 	// Execute command
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err := s.ExecCommands(host, commands, CommandLvm)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +74,7 @@ func (s *CmdExecutor) DeviceTeardown(host, device, vgid string) error {
 	}
 
 	// Execute command
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err := s.ExecCommands(host, commands, CommandLvm)
 	if err != nil {
 		logger.LogError("Error while deleting device %v with id %v on host %v: %v",
 			device, vgid, host, err)
@@ -84,7 +84,7 @@ func (s *CmdExecutor) DeviceTeardown(host, device, vgid string) error {
 	commands = []string{
 		fmt.Sprintf("ls %v", pdir),
 	}
-	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err = s.ExecCommands(host, commands, CommandMount)
 	if err != nil {
 		return nil
 	}
@@ -93,7 +93,7 @@ func (s *CmdExecutor) DeviceTeardown(host, device, vgid string) error {
 		fmt.Sprintf("rmdir %v", pdir),
 	}
 
-	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err = s.ExecCommands(host, commands, CommandMount)
 	if err != nil {
 		logger.LogError("Error while removing the VG directory")
 		return nil
@@ -112,7 +112,7 @@ func (s *CmdExecutor) getVgSizeFromNode(
 	}
 
 	// Execute command
-	b, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	b, err := s.ExecCommands(host, commands, CommandLvm)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,133 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"encoding/xml"
+	"regexp"
+	"strings"
+
+	"github.com/chinacoolhacker/heketi/executors"
+)
+
+// Messages of gluster, gluster-block and LVM telling why a command
+// failed, matched against the whole message, in lower case and with its
+// blanks collapsed. They are matched in order, so the messages of a
+// kind must not match the ones of an earlier kind.
+var errorMessages = []struct {
+	kind     executors.ErrorKind
+	messages []*regexp.Regexp
+}{
+	{executors.ErrorTimeout, messagePatterns(
+		`error : request timed out`,
+	)},
+	{executors.ErrorUnreachable, messagePatterns(
+		`please check if gluster daemon is operational`,
+		`is not in 'peer in cluster' state`,
+		`transport endpoint is not connected`,
+		`connect to host \S+ port \d+: (no route to host|connection refused)`,
+	)},
+	{executors.ErrorBusy, messagePatterns(
+		`another transaction is in progress`,
+		`locking failed on \S+`,
+		`device or resource busy`,
+		`target is busy`,
+		`can't open \S+ exclusively\. mounted filesystem\?`,
+		`logical volume \S+ in use`,
+	)},
+	{executors.ErrorResourceExhausted, messagePatterns(
+		`volume group "[^"]+" has insufficient free space`,
+		`insufficient suitable allocatable extents`,
+		`no space left on device`,
+		`thin pool \S+ out of data space`,
+	)},
+	{executors.ErrorAlreadyExists, messagePatterns(
+		`volume \S+ already exists`,
+		`logical volume "[^"]+" already exists`,
+		`\S+ is already part of a volume`,
+		`\S+ is already in peer list`,
+	)},
+	{executors.ErrorNotFound, messagePatterns(
+		`volume \S+ does not exist`,
+		`volume group "[^"]+" not found`,
+		`failed to find (logical|physical) volume`,
+	)},
+}
+
+func messagePatterns(patterns ...string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		compiled[i] = regexp.MustCompile(`(^|[\s:])` + pattern)
+	}
+	return compiled
+}
+
+// MessageKind returns the kind of the failure described by message,
+// ErrorCommandFailed if it is not a known one.
+func MessageKind(message string) executors.ErrorKind {
+	message = strings.Join(strings.Fields(strings.ToLower(message)), " ")
+	for _, m := range errorMessages {
+		for _, pattern := range m.messages {
+			if pattern.MatchString(message) {
+				return m.kind
+			}
+		}
+	}
+	return executors.ErrorCommandFailed
+}
+
+// glusterError returns the error message of the gluster command whose
+// --xml output is output, if it failed.
+//
+// Example:
+// <cliOutput><opRet>-1</opRet><opErrno>30800</opErrno>
+// <opErrstr>Volume vol1 does not exist</opErrstr></cliOutput>
+func glusterError(output string) string {
+	if !strings.Contains(output, "<cliOutput>") {
+		return ""
+	}
+	var cli struct {
+		OpRet    int    `xml:"opRet"`
+		OpErrno  int    `xml:"opErrno"`
+		OpErrStr string `xml:"opErrstr"`
+	}
+	if err := xml.Unmarshal([]byte(output), &cli); err != nil || cli.OpRet == 0 {
+		return ""
+	}
+	return strings.TrimSpace(cli.OpErrStr)
+}
+
+// classifyError returns err, the failure of a command, with the kind
+// told by the message of gluster or LVM. The message of a gluster
+// command run with --xml is its opErrstr. Errors which are not of a
+// command that ran are returned as is.
+func classifyError(err error) error {
+	e, ok := err.(*executors.Error)
+	if !ok || e.Kind != executors.ErrorCommandFailed {
+		return err
+	}
+	c := *e
+	if message := glusterError(e.Stdout); message != "" {
+		c.Message = message
+	}
+	c.Kind = MessageKind(c.Message)
+	return &c
+}
+
+// commandError returns the error of a command which failed on host
+// with message, as reported by the command in its output, such as the
+// error of gluster-block.
+func commandError(host, message string) error {
+	return &executors.Error{
+		Kind:    MessageKind(message),
+		Host:    host,
+		Message: message,
+	}
+}
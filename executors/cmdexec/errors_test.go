@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/heketi/tests"
+)
+
+func TestMessageKind(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		kind    executors.ErrorKind
+	}{
+		{"volume create: vol1: failed: Volume vol1 already exists", executors.ErrorAlreadyExists},
+		{"volume create: vol1: failed: /brick is already part of a volume", executors.ErrorAlreadyExists},
+		{"Volume vol1 does not exist", executors.ErrorNotFound},
+		{"  Volume group \"vg_abc\" not found", executors.ErrorNotFound},
+		{"  Failed to find logical volume \"vg_abc/tp_b1\"", executors.ErrorNotFound},
+		{"  Volume group \"vg_abc\" has insufficient free space (10 extents): 20 required.",
+			executors.ErrorResourceExhausted},
+		{"Another transaction is in progress for vol1. Please try again after sometime.",
+			executors.ErrorBusy},
+		{"  Can't open /dev/sdb exclusively.  Mounted filesystem?", executors.ErrorBusy},
+		{"umount: /var/lib/heketi/mounts/vg_abc/brick_b1: target is busy.", executors.ErrorBusy},
+		{"Connection failed. Please check if gluster daemon is operational.",
+			executors.ErrorUnreachable},
+		{"Error : Request timed out", executors.ErrorTimeout},
+		{"mkfs.xfs: invalid option", executors.ErrorCommandFailed},
+		// the messages merely mentioning the words of a kind are not
+		// of that kind
+		{"sh: lvcreate: command not found", executors.ErrorCommandFailed},
+		{"mount: /dev/vg_abc/brick_b1: No such file or directory",
+			executors.ErrorCommandFailed},
+		{"xfs_repair: the log was not cleanly unmounted, operation timed out",
+			executors.ErrorCommandFailed},
+		{"  /dev/sdb: open exclusively failed for reading", executors.ErrorCommandFailed},
+		{"volume set: failed: option cluster.exclusively not found",
+			executors.ErrorCommandFailed},
+	} {
+		kind := MessageKind(test.message)
+		tests.Assert(t, kind == test.kind, test.message, kind)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	// the gluster commands run with --xml report their error on stdout
+	err := classifyError(executors.NewCommandError("host", 1,
+		`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>-1</opRet>
+  <opErrno>30800</opErrno>
+  <opErrstr>Volume vol1 does not exist</opErrstr>
+</cliOutput>`, ""))
+	e, ok := err.(*executors.Error)
+	tests.Assert(t, ok, err)
+	tests.Assert(t, e.Kind == executors.ErrorNotFound, e.Kind)
+	tests.Assert(t, e.Message == "Volume vol1 does not exist", e.Message)
+	tests.Assert(t, e.ExitCode == 1 && e.Host == "host", e)
+
+	err = classifyError(executors.NewCommandError("host", 5, "",
+		"  Physical volume '/dev/sdb' is already in volume group 'vg_abc'\n"))
+	tests.Assert(t, executors.KindOf(err) == executors.ErrorCommandFailed, err)
+	tests.Assert(t, strings.Contains(err.Error(), "already in volume group"), err)
+
+	// the errors which are not of a command are returned as is
+	plain := errors.New("volume vol1 does not exist")
+	tests.Assert(t, classifyError(plain) == plain)
+	tests.Assert(t, classifyError(nil) == nil)
+	timeout := executors.NewError(executors.ErrorTimeout, "host", "not found")
+	tests.Assert(t, classifyError(timeout) == timeout)
+}
+
+func TestExecCommandsClassifiesErrors(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		if strings.Contains(commands[0], "volume stop") {
+			return []string{""}, nil
+		}
+		return nil, executors.NewCommandError(host, 1, "",
+			"volume delete: vol1: failed: Volume vol1 does not exist")
+	}
+
+	// the kind of the error is kept by the executor
+	err = s.VolumeDestroy("host", "vol1")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, executors.KindOf(err) == executors.ErrorNotFound, err)
+	tests.Assert(t, strings.HasPrefix(err.Error(), "Unable to delete volume vol1: "), err)
+	tests.Assert(t, err.(*executors.Error).ExitCode == 1, err)
+}
@@ -9,6 +9,10 @@
 
 package cmdexec
 
+import (
+	"context"
+)
+
 type CommandFaker struct {
 	FakeConnectAndExec func(host string,
 		commands []string,
@@ -38,18 +42,24 @@ type FakeExecutor struct {
 func NewFakeExecutor(f *CommandFaker) (*FakeExecutor, error) {
 	t := &FakeExecutor{}
 	t.RemoteExecutor = t
-	t.Throttlemap = make(map[string]chan bool)
+	t.InitThrottle()
 	t.fake = f
 	t.Fstab = "/my/fstab"
 	t.portStr = "22"
 	return t, nil
 }
 
-func (s *FakeExecutor) RemoteCommandExecute(host string,
+func (s *FakeExecutor) RemoteCommandExecute(ctx context.Context,
+	host string,
 	commands []string,
 	timeoutMinutes int) ([]string, error) {
 
-	s.AccessConnection(host)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.AccessConnectionContext(ctx, host); err != nil {
+		return nil, err
+	}
 	defer s.FreeConnection(host)
 
 	return s.fake.FakeConnectAndExec(
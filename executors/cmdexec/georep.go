@@ -7,7 +7,7 @@
 // cases as published by the Free Software Foundation.
 //
 
-package sshexec
+package cmdexec
 
 import (
 	"encoding/xml"
@@ -15,16 +15,11 @@ import (
 	"strconv"
 
 	"github.com/chinacoolhacker/heketi/executors"
-	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/lpabon/godbc"
 )
 
-var (
-	logger = utils.NewLogger("[cmdexec]", utils.LEVEL_DEBUG)
-)
-
 // GeoReplicationCreate creates a geo-rep session for the given volume
-func (s *SshExecutor) GeoReplicationCreate(host, volume string, geoRep *executors.GeoReplicationRequest) error {
+func (s *CmdExecutor) GeoReplicationCreate(host, volume string, geoRep *executors.GeoReplicationRequest) error {
 	logger.Debug("In GeoReplicationCreate")
 	logger.Debug("actionParams: %+v", geoRep.ActionParams)
 
@@ -46,7 +41,7 @@ func (s *SshExecutor) GeoReplicationCreate(host, volume string, geoRep *executor
 	}
 
 	commands := []string{cmd}
-	if _, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10); err != nil {
+	if _, err := s.ExecCommands(host, commands, CommandGluster); err != nil {
 		return err
 	}
 
@@ -54,7 +49,7 @@ func (s *SshExecutor) GeoReplicationCreate(host, volume string, geoRep *executor
 }
 
 // GeoReplicationAction executes the given geo-replication action for the given volume
-func (s *SshExecutor) GeoReplicationAction(host, volume, action string, geoRep *executors.GeoReplicationRequest) error {
+func (s *CmdExecutor) GeoReplicationAction(host, volume, action string, geoRep *executors.GeoReplicationRequest) error {
 	logger.Debug("In GeoReplicationAction: %s", action)
 
 	godbc.Require(host != "")
@@ -69,7 +64,7 @@ func (s *SshExecutor) GeoReplicationAction(host, volume, action string, geoRep *
 	}
 
 	commands := []string{cmd}
-	if _, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10); err != nil {
+	if _, err := s.ExecCommands(host, commands, CommandGluster); err != nil {
 		return err
 	}
 
@@ -77,7 +72,7 @@ func (s *SshExecutor) GeoReplicationAction(host, volume, action string, geoRep *
 }
 
 // GeoReplicationStatus returns the geo-replication status
-func (s *SshExecutor) GeoReplicationStatus(host string) (*executors.GeoReplicationStatus, error) {
+func (s *CmdExecutor) GeoReplicationStatus(host string) (*executors.GeoReplicationStatus, error) {
 	logger.Debug("In GeoReplicationStatus")
 
 	godbc.Require(host != "")
@@ -93,7 +88,7 @@ func (s *SshExecutor) GeoReplicationStatus(host string) (*executors.GeoReplicati
 
 	var output []string
 	var err error
-	if output, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 10); err != nil {
+	if output, err = s.ExecCommands(host, commands, CommandGluster); err != nil {
 		return nil, err
 	}
 
@@ -107,7 +102,7 @@ func (s *SshExecutor) GeoReplicationStatus(host string) (*executors.GeoReplicati
 }
 
 // GeoReplicationVolumeStatus returns the geo-replication status of a specific volume
-func (s *SshExecutor) GeoReplicationVolumeStatus(host, volume string) (*executors.GeoReplicationStatus, error) {
+func (s *CmdExecutor) GeoReplicationVolumeStatus(host, volume string) (*executors.GeoReplicationStatus, error) {
 	logger.Debug("In GeoReplicationVolumeStatus")
 
 	godbc.Require(host != "")
@@ -125,7 +120,7 @@ func (s *SshExecutor) GeoReplicationVolumeStatus(host, volume string) (*executor
 
 	var output []string
 	var err error
-	if output, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 10); err != nil {
+	if output, err = s.ExecCommands(host, commands, CommandGluster); err != nil {
 		return nil, err
 	}
 
@@ -139,7 +134,7 @@ func (s *SshExecutor) GeoReplicationVolumeStatus(host, volume string) (*executor
 }
 
 // GeoReplicationConfig configures the geo-replication session for the given volume
-func (s *SshExecutor) GeoReplicationConfig(host, volume string, geoRep *executors.GeoReplicationRequest) error {
+func (s *CmdExecutor) GeoReplicationConfig(host, volume string, geoRep *executors.GeoReplicationRequest) error {
 	logger.Debug("In GeoReplicationConfig")
 
 	godbc.Require(host != "")
@@ -149,14 +144,14 @@ func (s *SshExecutor) GeoReplicationConfig(host, volume string, geoRep *executor
 
 	commands := s.createConfigCommands(volume, geoRep)
 
-	if _, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10); err != nil {
+	if _, err := s.ExecCommands(host, commands, CommandGluster); err != nil {
 		logger.LogError("Invalid configuration for volume georeplication %s", volume)
 		return err
 	}
 	return nil
 }
 
-func (s *SshExecutor) createConfigCommands(volume string, geoRep *executors.GeoReplicationRequest) []string {
+func (s *CmdExecutor) createConfigCommands(volume string, geoRep *executors.GeoReplicationRequest) []string {
 	commands := []string{}
 
 	cmdTpl := "gluster --mode=script volume geo-replication %s %s::%s config %s %s"
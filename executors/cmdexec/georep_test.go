@@ -0,0 +1,50 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/heketi/tests"
+)
+
+func TestGeoReplicationCreate(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "gluster --mode=script volume "+
+			"geo-replication vol slave::slavevol create ssh-port 2222 "+
+			"push-pem force", commands)
+
+		return nil, nil
+	}
+
+	err = s.GeoReplicationCreate("host", "vol",
+		&executors.GeoReplicationRequest{
+			SlaveHost:    "slave",
+			SlaveVolume:  "slavevol",
+			SlaveSSHPort: 2222,
+			ActionParams: map[string]string{
+				"option": "push-pem",
+				"force":  "true",
+			},
+		})
+	tests.Assert(t, err == nil, err)
+}
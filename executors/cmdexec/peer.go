@@ -26,7 +26,7 @@ func (s *CmdExecutor) PeerProbe(host, newnode string) error {
 	commands := []string{
 		fmt.Sprintf("gluster peer probe %v", newnode),
 	}
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.ExecCommands(host, commands, CommandGluster)
 	if err != nil {
 		return err
 	}
@@ -38,7 +38,7 @@ func (s *CmdExecutor) PeerProbe(host, newnode string) error {
 			fmt.Sprintf("gluster --mode=script snapshot config snap-max-hard-limit %v",
 				s.RemoteExecutor.SnapShotLimit()),
 		}
-		_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+		_, err := s.ExecCommands(host, commands, CommandGluster)
 		if err != nil {
 			return err
 		}
@@ -56,7 +56,7 @@ func (s *CmdExecutor) PeerDetach(host, detachnode string) error {
 	commands := []string{
 		fmt.Sprintf("gluster peer detach %v", detachnode),
 	}
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.ExecCommands(host, commands, CommandGluster)
 	if err != nil {
 		logger.Err(err)
 	}
@@ -71,7 +71,7 @@ func (s *CmdExecutor) GlusterdCheck(host string) error {
 	commands := []string{
 		fmt.Sprintf("systemctl status glusterd"),
 	}
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.ExecCommands(host, commands, CommandOther)
 	if err != nil {
 		logger.Err(err)
 		return err
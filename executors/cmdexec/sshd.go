@@ -0,0 +1,97 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+// sshdState is a property of the sshd unit and the values it may have
+// once an action is done.
+type sshdState struct {
+	property string
+	values   []string
+}
+
+// Actions of SshdControl and the state they leave sshd in. The status
+// action only checks that sshd is running.
+var sshdActions = map[string]sshdState{
+	"start":   {"ActiveState", []string{"active"}},
+	"stop":    {"ActiveState", []string{"inactive", "failed"}},
+	"enable":  {"UnitFileState", []string{"enabled"}},
+	"disable": {"UnitFileState", []string{"disabled"}},
+	"status":  {"ActiveState", []string{"active"}},
+}
+
+// SshdControl starts, stops, enables or disables the sshd service of
+// host, then checks the service is in the state the action leaves it
+// in.
+func (s *CmdExecutor) SshdControl(host string, action string) error {
+	godbc.Require(host != "")
+
+	expected, ok := sshdActions[action]
+	if !ok {
+		return logger.LogError("Invalid sshd action %v, expected start, stop, "+
+			"enable, disable or status", action)
+	}
+	if s.SshTransport && (action == "stop" || action == "disable") {
+		logger.Warning("Refusing to %v sshd on %v: %v", action, host, executors.ErrSshdInUse)
+		return executors.ErrSshdInUse
+	}
+
+	if action != "status" {
+		commands := []string{
+			fmt.Sprintf("systemctl %v sshd", action),
+		}
+		if _, err := s.ExecCommands(host, commands, CommandOther); err != nil {
+			return logger.LogError("Unable to %v sshd on %v: %v", action, host, err)
+		}
+	}
+
+	state, err := s.sshdState(host)
+	if err != nil {
+		return logger.LogError("Unable to check sshd on %v: %v", host, err)
+	}
+	value := state[expected.property]
+	for _, v := range expected.values {
+		if value == v {
+			logger.Info("sshd %v on %v: %v is %v", action, host, expected.property, value)
+			return nil
+		}
+	}
+	return logger.LogError("sshd %v on %v: %v is %v instead of %v",
+		action, host, expected.property, value, strings.Join(expected.values, " or "))
+}
+
+// sshdState returns the properties of the sshd unit of host.
+func (s *CmdExecutor) sshdState(host string) (map[string]string, error) {
+	commands := []string{
+		"systemctl show --property=ActiveState,UnitFileState sshd",
+	}
+	output, err := s.ExecCommands(host, commands, CommandOther)
+	if err != nil {
+		return nil, err
+	}
+
+	// Example:
+	// ActiveState=active
+	// UnitFileState=enabled
+	state := map[string]string{}
+	for _, line := range strings.Split(output[0], "\n") {
+		if kv := strings.SplitN(strings.TrimSpace(line), "=", 2); len(kv) == 2 {
+			state[kv[0]] = kv[1]
+		}
+	}
+	return state, nil
+}
@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmdexec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/heketi/tests"
+)
+
+func TestSshdControl(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+
+	var received []string
+	state := "ActiveState=inactive\nUnitFileState=disabled\n"
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "host:22", host)
+		tests.Assert(t, len(commands) == 1, commands)
+		received = append(received, commands[0])
+		if strings.HasPrefix(commands[0], "systemctl show") {
+			return []string{state}, nil
+		}
+		return []string{""}, nil
+	}
+
+	err = s.SshdControl("host", "stop")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(received) == 2, received)
+	tests.Assert(t, received[0] == "systemctl stop sshd", received)
+	tests.Assert(t, received[1] ==
+		"systemctl show --property=ActiveState,UnitFileState sshd", received)
+
+	// the state left by the action is checked
+	received = nil
+	err = s.SshdControl("host", "start")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "ActiveState is inactive instead of active"),
+		err)
+	tests.Assert(t, received[0] == "systemctl start sshd", received)
+
+	err = s.SshdControl("host", "disable")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// status only reads the state
+	received = nil
+	state = "ActiveState=active\nUnitFileState=enabled\n"
+	err = s.SshdControl("host", "status")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(received) == 1, received)
+
+	received = nil
+	err = s.SshdControl("host", "restart; rm -rf /")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(received) == 0, received)
+}
+
+func TestSshdControlSshTransport(t *testing.T) {
+	f := NewCommandFaker()
+	s, err := NewFakeExecutor(f)
+	tests.Assert(t, err == nil)
+	s.SshTransport = true
+
+	var received []string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		received = append(received, commands...)
+		return []string{"ActiveState=active\nUnitFileState=enabled\n"}, nil
+	}
+
+	// heketi would lose the node
+	err = s.SshdControl("host", "stop")
+	tests.Assert(t, err == executors.ErrSshdInUse, err)
+	err = s.SshdControl("host", "disable")
+	tests.Assert(t, err == executors.ErrSshdInUse, err)
+	tests.Assert(t, len(received) == 0, received)
+
+	err = s.SshdControl("host", "start")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.SshdControl("host", "enable")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
@@ -66,7 +66,7 @@ func (s *CmdExecutor) VolumeCreate(host string,
 
 	commands = append(commands, fmt.Sprintf("gluster --mode=script volume start %v", volume.Name))
 
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.ExecCommands(host, commands, CommandGluster)
 	if err != nil {
 		s.VolumeDestroy(host, volume.Name)
 		return nil, err
@@ -109,7 +109,7 @@ func (s *CmdExecutor) VolumeExpand(host string,
 			fmt.Sprintf("gluster --mode=script volume rebalance %v start", volume.Name))
 	}
 
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.ExecCommands(host, commands, CommandGluster)
 	if err != nil {
 		return nil, err
 	}
@@ -127,7 +127,7 @@ func (s *CmdExecutor) VolumeDestroy(host string, volume string) error {
 		fmt.Sprintf("gluster --mode=script volume stop %v force", volume),
 	}
 
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.ExecCommands(host, commands, CommandGluster)
 	if err != nil {
 		logger.LogError("Unable to stop volume %v: %v", volume, err)
 	}
@@ -136,9 +136,9 @@ func (s *CmdExecutor) VolumeDestroy(host string, volume string) error {
 		fmt.Sprintf("gluster --mode=script volume delete %v", volume),
 	}
 
-	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err = s.ExecCommands(host, commands, CommandGluster)
 	if err != nil {
-		return logger.Err(fmt.Errorf("Unable to delete volume %v: %v", volume, err))
+		return logger.Err(executors.WrapError(err, "Unable to delete volume %v: %v", volume, err))
 	}
 
 	return nil
@@ -215,9 +215,9 @@ func (s *CmdExecutor) checkForSnapshots(host, volume string) error {
 		fmt.Sprintf("gluster --mode=script snapshot list %v --xml", volume),
 	}
 
-	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	output, err := s.ExecCommands(host, commands, CommandGluster)
 	if err != nil {
-		return fmt.Errorf("Unable to get snapshot information from volume %v: %v", volume, err)
+		return executors.WrapError(err, "Unable to get snapshot information from volume %v: %v", volume, err)
 	}
 
 	var snapInfo CliOutput
@@ -227,7 +227,8 @@ func (s *CmdExecutor) checkForSnapshots(host, volume string) error {
 	}
 
 	if snapInfo.SnapList.Count > 0 {
-		return fmt.Errorf("Unable to delete volume %v because it contains %v snapshots",
+		return executors.NewError(executors.ErrorBusy, host,
+			"Unable to delete volume %v because it contains %v snapshots",
 			volume, snapInfo.SnapList.Count)
 	}
 
@@ -251,9 +252,9 @@ func (s *CmdExecutor) VolumeInfo(host string, volume string) (*executors.Volume,
 	}
 
 	//Get the xml output of volume info
-	output, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	output, err := s.ExecCommands(host, command, CommandGluster)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to get volume info of volume name: %v", volume)
+		return nil, executors.WrapError(err, "Unable to get volume info of volume name: %v: %v", volume, err)
 	}
 	var volumeInfo CliOutput
 	err = xml.Unmarshal([]byte(output[0]), &volumeInfo)
@@ -274,9 +275,9 @@ func (s *CmdExecutor) VolumeReplaceBrick(host string, volume string, oldBrick *e
 	command := []string{
 		fmt.Sprintf("gluster --mode=script volume replace-brick %v %v:%v %v:%v commit force", volume, oldBrick.Host, oldBrick.Path, newBrick.Host, newBrick.Path),
 	}
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	_, err := s.ExecCommands(host, command, CommandGluster)
 	if err != nil {
-		return logger.Err(fmt.Errorf("Unable to replace brick %v:%v with %v:%v for volume %v", oldBrick.Host, oldBrick.Path, newBrick.Host, newBrick.Path, volume))
+		return logger.Err(executors.WrapError(err, "Unable to replace brick %v:%v with %v:%v for volume %v", oldBrick.Host, oldBrick.Path, newBrick.Host, newBrick.Path, volume))
 	}
 
 	return nil
@@ -299,9 +300,9 @@ func (s *CmdExecutor) HealInfo(host string, volume string) (*executors.HealInfo,
 		fmt.Sprintf("gluster --mode=script volume heal %v info --xml", volume),
 	}
 
-	output, err := s.RemoteExecutor.RemoteCommandExecute(host, command, 10)
+	output, err := s.ExecCommands(host, command, CommandGluster)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to get heal info of volume : %v", volume)
+		return nil, executors.WrapError(err, "Unable to get heal info of volume : %v: %v", volume, err)
 	}
 	var healInfo CliOutput
 	err = xml.Unmarshal([]byte(output[0]), &healInfo)
@@ -0,0 +1,146 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package executors
+
+import (
+	"fmt"
+)
+
+// ErrorKind is the reason a command of an executor failed.
+type ErrorKind int
+
+const (
+	// the reason is not known
+	ErrorUnknown ErrorKind = iota
+	// the command ran and failed for another reason than the ones below
+	ErrorCommandFailed
+	// the object the command is about, such as a volume, does not exist
+	ErrorNotFound
+	// the object the command creates already exists
+	ErrorAlreadyExists
+	// the node, or the service the command talks to, could not be
+	// reached
+	ErrorUnreachable
+	// the command did not complete in time
+	ErrorTimeout
+	// there is not enough space or another resource left on the node
+	ErrorResourceExhausted
+	// the object is in use or locked by another command, the command
+	// may succeed later
+	ErrorBusy
+)
+
+var errorKindNames = map[ErrorKind]string{
+	ErrorUnknown:           "unknown",
+	ErrorCommandFailed:     "command failed",
+	ErrorNotFound:          "not found",
+	ErrorAlreadyExists:     "already exists",
+	ErrorUnreachable:       "unreachable",
+	ErrorTimeout:           "timeout",
+	ErrorResourceExhausted: "resource exhausted",
+	ErrorBusy:              "busy",
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// ParseErrorKind returns the kind whose String is name, ErrorUnknown
+// if there is none.
+func ParseErrorKind(name string) ErrorKind {
+	for kind, kindName := range errorKindNames {
+		if kindName == name {
+			return kind
+		}
+	}
+	return ErrorUnknown
+}
+
+// Error is a failure of a command of an executor, classified by its
+// kind. Its message reads the same as the untyped errors the executors
+// returned so far, the standard error of the command in most cases.
+type Error struct {
+	Kind ErrorKind
+	Host string
+	// exit code and output of the command that failed, if it ran
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	Message  string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrorKind returns the kind of the error.
+func (e *Error) ErrorKind() ErrorKind {
+	return e.Kind
+}
+
+// kindError is implemented by the errors which know their kind, such
+// as the answers of the REST API of glusterd2.
+type kindError interface {
+	ErrorKind() ErrorKind
+}
+
+// NewError returns an error of kind about host.
+func NewError(kind ErrorKind, host, format string, args ...interface{}) *Error {
+	return &Error{
+		Kind:    kind,
+		Host:    host,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// NewCommandError returns the error of a command that ran on host and
+// exited with exitCode. Its message is the standard error of the
+// command, if it has one.
+func NewCommandError(host string, exitCode int, stdout, stderr string) *Error {
+	message := stderr
+	if message == "" {
+		message = fmt.Sprintf("Command failed on %v with exit code %v",
+			host, exitCode)
+	}
+	return &Error{
+		Kind:     ErrorCommandFailed,
+		Host:     host,
+		ExitCode: exitCode,
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Message:  message,
+	}
+}
+
+// WrapError returns an error with the message format, keeping the kind
+// of err, and its command output if it is an *Error.
+func WrapError(err error, format string, args ...interface{}) error {
+	message := fmt.Sprintf(format, args...)
+	if e, ok := err.(*Error); ok {
+		wrapped := *e
+		wrapped.Message = message
+		return &wrapped
+	}
+	if kind := KindOf(err); kind != ErrorUnknown {
+		return &Error{Kind: kind, Message: message}
+	}
+	return fmt.Errorf("%s", message)
+}
+
+// KindOf returns the kind of err, ErrorUnknown if it does not know it.
+func KindOf(err error) ErrorKind {
+	if e, ok := err.(kindError); ok {
+		return e.ErrorKind()
+	}
+	return ErrorUnknown
+}
@@ -9,7 +9,19 @@
 
 package executors
 
-import "encoding/xml"
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+)
+
+// ErrSshdInUse is returned by SshdControl when stopping or disabling
+// sshd would cut heketi off from the node, which it reaches over ssh.
+var ErrSshdInUse = errors.New("sshd is used by heketi to reach the node")
+
+// ErrSshdNotSupported is returned by SshdControl when the executor of
+// the node has no way to manage its sshd.
+var ErrSshdNotSupported = errors.New("sshd of the node cannot be managed by its executor")
 
 type Executor interface {
 	GlusterdCheck(host string) error
@@ -36,9 +48,41 @@ type Executor interface {
 	SetLogLevel(level string)
 	BlockVolumeCreate(host string, blockVolume *BlockVolumeRequest) (*BlockVolumeInfo, error)
 	BlockVolumeDestroy(host string, blockHostingVolumeName string, blockVolumeName string) error
+	BlockVolumeModifyAuth(host string, blockHostingVolumeName string, blockVolumeName string, auth bool) (*BlockVolumeInfo, error)
 	SshdControl(host string, action string) error
 }
 
+// ContextExecutor is implemented by executors whose commands can be
+// bound to a context. Once the context is done no new commands are
+// started and the running ones are stopped where possible.
+type ContextExecutor interface {
+	WithContext(ctx context.Context) Executor
+}
+
+// WithContext returns an executor whose commands are bound to ctx. If
+// executor can not be cancelled it is returned as is.
+func WithContext(ctx context.Context, executor Executor) Executor {
+	if ce, ok := executor.(ContextExecutor); ok {
+		return ce.WithContext(ctx)
+	}
+	return executor
+}
+
+type hostReporterKey struct{}
+
+// WithHostReporter returns a context with which the executors bound to
+// it call report with each host they are about to send commands to.
+func WithHostReporter(ctx context.Context, report func(host string)) context.Context {
+	return context.WithValue(ctx, hostReporterKey{}, report)
+}
+
+// ReportHost is called by executors before they send commands to host.
+func ReportHost(ctx context.Context, host string) {
+	if report, ok := ctx.Value(hostReporterKey{}).(func(string)); ok {
+		report(host)
+	}
+}
+
 type GeoReplicationStatus struct {
 	XMLName xml.Name               `xml:"geoRep"`
 	Volume  []GeoReplicationVolume `xml:"volume"`
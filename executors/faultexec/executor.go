@@ -0,0 +1,259 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package faultexec
+
+import (
+	"context"
+
+	"github.com/chinacoolhacker/heketi/executors"
+)
+
+// FaultExecutor passes the calls to the executor it wraps unless the
+// injector fails them. Each method is a point of the injector named
+// after the method. The callers of the executor reach their own points
+// through Point.
+type FaultExecutor struct {
+	executor executors.Executor
+	injector *Injector
+}
+
+func NewFaultExecutor(executor executors.Executor,
+	injector *Injector) *FaultExecutor {
+
+	return &FaultExecutor{
+		executor: executor,
+		injector: injector,
+	}
+}
+
+// WithContext returns a copy of the executor, sharing the injector,
+// whose wrapped executor is bound to ctx.
+func (f *FaultExecutor) WithContext(ctx context.Context) executors.Executor {
+	c := *f
+	c.executor = executors.WithContext(ctx, f.executor)
+	return &c
+}
+
+// Injector returns the injector of the executor.
+func (f *FaultExecutor) Injector() *Injector {
+	return f.injector
+}
+
+// Point applies the rules of the injector for point.
+func (f *FaultExecutor) Point(point string) error {
+	return f.injector.Point(point)
+}
+
+func (f *FaultExecutor) SetLogLevel(level string) {
+	f.executor.SetLogLevel(level)
+}
+
+func (f *FaultExecutor) GlusterdCheck(host string) error {
+	if err := f.injector.Point("GlusterdCheck"); err != nil {
+		return err
+	}
+	return f.executor.GlusterdCheck(host)
+}
+
+func (f *FaultExecutor) PeerProbe(exec_host, newnode string) error {
+	if err := f.injector.Point("PeerProbe"); err != nil {
+		return err
+	}
+	return f.executor.PeerProbe(exec_host, newnode)
+}
+
+func (f *FaultExecutor) PeerDetach(exec_host, detachnode string) error {
+	if err := f.injector.Point("PeerDetach"); err != nil {
+		return err
+	}
+	return f.executor.PeerDetach(exec_host, detachnode)
+}
+
+func (f *FaultExecutor) DeviceSetup(host, device, vgid string) (*executors.DeviceInfo, error) {
+	if err := f.injector.Point("DeviceSetup"); err != nil {
+		return nil, err
+	}
+	return f.executor.DeviceSetup(host, device, vgid)
+}
+
+func (f *FaultExecutor) GetDeviceInfo(host, device, vgid string) (*executors.DeviceInfo, error) {
+	if err := f.injector.Point("GetDeviceInfo"); err != nil {
+		return nil, err
+	}
+	return f.executor.GetDeviceInfo(host, device, vgid)
+}
+
+func (f *FaultExecutor) DeviceTeardown(host, device, vgid string) error {
+	if err := f.injector.Point("DeviceTeardown"); err != nil {
+		return err
+	}
+	return f.executor.DeviceTeardown(host, device, vgid)
+}
+
+func (f *FaultExecutor) BrickCreate(host string,
+	brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+
+	if err := f.injector.Point("BrickCreate"); err != nil {
+		return nil, err
+	}
+	return f.executor.BrickCreate(host, brick)
+}
+
+func (f *FaultExecutor) BrickDestroy(host string,
+	brick *executors.BrickRequest) error {
+
+	if err := f.injector.Point("BrickDestroy"); err != nil {
+		return err
+	}
+	return f.executor.BrickDestroy(host, brick)
+}
+
+func (f *FaultExecutor) BrickDestroyCheck(host string,
+	brick *executors.BrickRequest) error {
+
+	if err := f.injector.Point("BrickDestroyCheck"); err != nil {
+		return err
+	}
+	return f.executor.BrickDestroyCheck(host, brick)
+}
+
+func (f *FaultExecutor) VolumeCreate(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	if err := f.injector.Point("VolumeCreate"); err != nil {
+		return nil, err
+	}
+	return f.executor.VolumeCreate(host, volume)
+}
+
+func (f *FaultExecutor) VolumeDestroy(host string, volume string) error {
+	if err := f.injector.Point("VolumeDestroy"); err != nil {
+		return err
+	}
+	return f.executor.VolumeDestroy(host, volume)
+}
+
+func (f *FaultExecutor) VolumeDestroyCheck(host, volume string) error {
+	if err := f.injector.Point("VolumeDestroyCheck"); err != nil {
+		return err
+	}
+	return f.executor.VolumeDestroyCheck(host, volume)
+}
+
+func (f *FaultExecutor) VolumeExpand(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	if err := f.injector.Point("VolumeExpand"); err != nil {
+		return nil, err
+	}
+	return f.executor.VolumeExpand(host, volume)
+}
+
+func (f *FaultExecutor) VolumeReplaceBrick(host string, volume string,
+	oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+
+	if err := f.injector.Point("VolumeReplaceBrick"); err != nil {
+		return err
+	}
+	return f.executor.VolumeReplaceBrick(host, volume, oldBrick, newBrick)
+}
+
+func (f *FaultExecutor) VolumeInfo(host string, volume string) (*executors.Volume, error) {
+	if err := f.injector.Point("VolumeInfo"); err != nil {
+		return nil, err
+	}
+	return f.executor.VolumeInfo(host, volume)
+}
+
+func (f *FaultExecutor) GeoReplicationCreate(host, volume string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	if err := f.injector.Point("GeoReplicationCreate"); err != nil {
+		return err
+	}
+	return f.executor.GeoReplicationCreate(host, volume, geoRep)
+}
+
+func (f *FaultExecutor) GeoReplicationConfig(host, volume string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	if err := f.injector.Point("GeoReplicationConfig"); err != nil {
+		return err
+	}
+	return f.executor.GeoReplicationConfig(host, volume, geoRep)
+}
+
+func (f *FaultExecutor) GeoReplicationAction(host, volume, action string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	if err := f.injector.Point("GeoReplicationAction"); err != nil {
+		return err
+	}
+	return f.executor.GeoReplicationAction(host, volume, action, geoRep)
+}
+
+func (f *FaultExecutor) GeoReplicationVolumeStatus(host, volume string) (
+	*executors.GeoReplicationStatus, error) {
+	if err := f.injector.Point("GeoReplicationVolumeStatus"); err != nil {
+		return nil, err
+	}
+	return f.executor.GeoReplicationVolumeStatus(host, volume)
+}
+
+func (f *FaultExecutor) GeoReplicationStatus(host string) (
+	*executors.GeoReplicationStatus, error) {
+	if err := f.injector.Point("GeoReplicationStatus"); err != nil {
+		return nil, err
+	}
+	return f.executor.GeoReplicationStatus(host)
+}
+
+func (f *FaultExecutor) HealInfo(host string, volume string) (*executors.HealInfo, error) {
+	if err := f.injector.Point("HealInfo"); err != nil {
+		return nil, err
+	}
+	return f.executor.HealInfo(host, volume)
+}
+
+func (f *FaultExecutor) BlockVolumeCreate(host string,
+	blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
+
+	if err := f.injector.Point("BlockVolumeCreate"); err != nil {
+		return nil, err
+	}
+	return f.executor.BlockVolumeCreate(host, blockVolume)
+}
+
+func (f *FaultExecutor) BlockVolumeDestroy(host string,
+	blockHostingVolumeName string, blockVolumeName string) error {
+
+	if err := f.injector.Point("BlockVolumeDestroy"); err != nil {
+		return err
+	}
+	return f.executor.BlockVolumeDestroy(host, blockHostingVolumeName, blockVolumeName)
+}
+
+func (f *FaultExecutor) BlockVolumeModifyAuth(host string,
+	blockHostingVolumeName string, blockVolumeName string,
+	auth bool) (*executors.BlockVolumeInfo, error) {
+
+	if err := f.injector.Point("BlockVolumeModifyAuth"); err != nil {
+		return nil, err
+	}
+	return f.executor.BlockVolumeModifyAuth(host,
+		blockHostingVolumeName, blockVolumeName, auth)
+}
+
+func (f *FaultExecutor) SshdControl(host string, action string) error {
+	if err := f.injector.Point("SshdControl"); err != nil {
+		return err
+	}
+	return f.executor.SshdControl(host, action)
+}
@@ -0,0 +1,135 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package faultexec
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+)
+
+var (
+	logger = utils.NewLogger("[faultexec]", utils.LEVEL_DEBUG)
+
+	// Kill is called to kill the process when a rule reaches its point.
+	// The process exits at once, without running the deferred calls,
+	// as it would if it crashed. Tests replace it.
+	Kill = func(point string) {
+		logger.Critical("Killed by fault injected at %v", point)
+		os.Exit(1)
+	}
+)
+
+// FaultRule describes a fault injected at a point. The points are the
+// names of the executor methods, such as BrickCreate, and the points
+// the callers of the injector define.
+type FaultRule struct {
+	Point string `json:"point"`
+	// call of the point the rule applies to, counting from one, zero
+	// means all the calls
+	Nth int `json:"nth"`
+	// milliseconds the call is delayed by, before it fails or the
+	// process is killed if the rule says so
+	Delay int    `json:"delay_ms"`
+	Error string `json:"error"`
+	Kill  bool   `json:"kill"`
+}
+
+func (r *FaultRule) validate() error {
+	if r.Point == "" {
+		return errors.New("Fault rule has no point")
+	}
+	if r.Nth < 0 || r.Delay < 0 {
+		return fmt.Errorf("Fault rule for %v has a negative nth or delay",
+			r.Point)
+	}
+	if r.Error == "" && r.Delay == 0 && !r.Kill {
+		return fmt.Errorf("Fault rule for %v has no error, delay or kill",
+			r.Point)
+	}
+	return nil
+}
+
+// Injector injects the faults of a set of rules at the points its
+// callers reach. It is safe for concurrent use.
+type Injector struct {
+	lock  sync.Mutex
+	rules []FaultRule
+	// calls of each point since the rules were set
+	calls map[string]int
+}
+
+func NewInjector(rules []FaultRule) (*Injector, error) {
+	i := &Injector{}
+	if err := i.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// SetRules replaces the rules of the injector and resets the count of
+// the calls of each point.
+func (i *Injector) SetRules(rules []FaultRule) error {
+	for n := range rules {
+		if err := rules[n].validate(); err != nil {
+			return err
+		}
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.rules = append([]FaultRule{}, rules...)
+	i.calls = map[string]int{}
+	return nil
+}
+
+// Rules returns a copy of the rules of the injector.
+func (i *Injector) Rules() []FaultRule {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return append([]FaultRule{}, i.rules...)
+}
+
+// Point counts a call of point and applies the first rule matching the
+// call: it waits for the delay of the rule, then kills the process or
+// returns the error of the rule. Nil is returned if no rule matches.
+func (i *Injector) Point(point string) error {
+	i.lock.Lock()
+	i.calls[point]++
+	call := i.calls[point]
+	var rule *FaultRule
+	for n := range i.rules {
+		r := &i.rules[n]
+		if r.Point == point && (r.Nth == 0 || r.Nth == call) {
+			rule = r
+			break
+		}
+	}
+	i.lock.Unlock()
+	if rule == nil {
+		return nil
+	}
+
+	logger.Debug("Injecting fault at %v, call %v", point, call)
+	if rule.Delay > 0 {
+		time.Sleep(time.Duration(rule.Delay) * time.Millisecond)
+	}
+	if rule.Kill {
+		Kill(point)
+	}
+	if rule.Error != "" {
+		return errors.New(rule.Error)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package faultexec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/mockexec"
+	"github.com/heketi/tests"
+)
+
+func TestInjectorNthCall(t *testing.T) {
+	i, err := NewInjector([]FaultRule{
+		{Point: "op.start", Nth: 2, Error: "second call failed"},
+		{Point: "op.done", Error: "every call failed"},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	tests.Assert(t, i.Point("op.start") == nil)
+	err = i.Point("op.start")
+	tests.Assert(t, err != nil && err.Error() == "second call failed", "got:", err)
+	tests.Assert(t, i.Point("op.start") == nil)
+
+	for n := 0; n < 3; n++ {
+		err = i.Point("op.done")
+		tests.Assert(t, err != nil && err.Error() == "every call failed", "got:", err)
+	}
+	tests.Assert(t, i.Point("other") == nil)
+
+	// setting the rules resets the calls
+	err = i.SetRules([]FaultRule{{Point: "op.start", Nth: 1, Error: "failed"}})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(i.Rules()) == 1)
+	tests.Assert(t, i.Point("op.start") != nil)
+	tests.Assert(t, i.Point("op.done") == nil)
+}
+
+func TestInjectorDelayAndKill(t *testing.T) {
+	var killed string
+	defer tests.Patch(&Kill, func(point string) {
+		killed = point
+	}).Restore()
+
+	i, err := NewInjector([]FaultRule{
+		{Point: "slow", Delay: 50},
+		{Point: "crash", Kill: true},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	start := time.Now()
+	tests.Assert(t, i.Point("slow") == nil)
+	tests.Assert(t, time.Since(start) >= 50*time.Millisecond)
+
+	tests.Assert(t, killed == "")
+	i.Point("crash")
+	tests.Assert(t, killed == "crash", "got:", killed)
+}
+
+func TestInjectorBadRules(t *testing.T) {
+	for _, r := range []FaultRule{
+		{Error: "no point"},
+		{Point: "nothing"},
+		{Point: "negative", Nth: -1, Error: "failed"},
+	} {
+		_, err := NewInjector([]FaultRule{r})
+		tests.Assert(t, err != nil, "expected err != nil for", r)
+	}
+}
+
+func TestFaultExecutor(t *testing.T) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	i, err := NewInjector([]FaultRule{
+		{Point: "BrickCreate", Nth: 2, Error: "brick create failed"},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var f executors.Executor = NewFaultExecutor(m, i)
+	req := &executors.BrickRequest{VgId: "vg1", Name: "brick1", Size: 100}
+	_, err = f.BrickCreate("host1", req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = f.BrickCreate("host1", req)
+	tests.Assert(t, err != nil && err.Error() == "brick create failed", "got:", err)
+	tests.Assert(t, f.GlusterdCheck("host1") == nil)
+
+	// the copies bound to a context share the injector
+	c := executors.WithContext(context.Background(), f).(*FaultExecutor)
+	tests.Assert(t, c.Injector() == i)
+	tests.Assert(t, c.Point("BrickCreate") == nil)
+}
@@ -0,0 +1,254 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package gd2exec
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Error is an error answered by glusterd2 or by the agent of a node.
+// Its message is the one of the answer, so that the errors read the
+// same whichever executor heketi uses.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrorKind returns the kind of the error, told by its status and, for
+// the failures of glusterd2, by its message.
+func (e *Error) ErrorKind() executors.ErrorKind {
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return executors.ErrorNotFound
+	case http.StatusConflict:
+		if cmdexec.MessageKind(e.Message) == executors.ErrorBusy {
+			return executors.ErrorBusy
+		}
+		return executors.ErrorAlreadyExists
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return executors.ErrorUnreachable
+	case http.StatusGatewayTimeout:
+		return executors.ErrorTimeout
+	}
+	return cmdexec.MessageKind(e.Message)
+}
+
+// IsNotFound returns true if err is the answer to a request for an
+// object, such as a volume or a peer, that does not exist.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// IsConflict returns true if err is the answer to a request to create
+// an object that already exists or to change one that is busy.
+func IsConflict(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusConflict
+}
+
+// errorResponse is the body of the errors answered by glusterd2 and
+// the agents.
+type errorResponse struct {
+	Errors []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// responseError returns the error answered in r.
+func responseError(r *http.Response) error {
+	body, _ := ioutil.ReadAll(r.Body)
+	e := &Error{StatusCode: r.StatusCode}
+
+	var resp errorResponse
+	if json.Unmarshal(body, &resp) == nil && len(resp.Errors) > 0 {
+		messages := make([]string, 0, len(resp.Errors))
+		for _, err := range resp.Errors {
+			messages = append(messages, err.Message)
+		}
+		e.Message = strings.Join(messages, ", ")
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(r.StatusCode)
+	}
+	return e
+}
+
+// newHttpClient returns the client the requests to glusterd2 and the
+// agents are sent with.
+func newHttpClient(config *Gd2Config) (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     5 * time.Minute,
+	}
+	if config.Https {
+		tlsConfig := &tls.Config{InsecureSkipVerify: config.Insecure}
+		if config.CACertFile != "" {
+			pem, err := ioutil.ReadFile(config.CACertFile)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read CA certificate file %v: %v",
+					config.CACertFile, err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("No certificate found in %v",
+					config.CACertFile)
+			}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// url returns the url of path on the server of host listening on port.
+func (g *Gd2Executor) url(host, port, path string) string {
+	scheme := "http"
+	if g.config.Https {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%v://%v%v", scheme, net.JoinHostPort(host, port), path)
+}
+
+// setToken signs r with the secret of the user, the same way the
+// heketi client does.
+func (g *Gd2Executor) setToken(r *http.Request) error {
+	if g.secret == "" {
+		return nil
+	}
+
+	// Create qsh hash
+	qshstring := r.Method + "&" + r.URL.Path
+	hash := sha256.New()
+	hash.Write([]byte(qshstring))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": g.config.User,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute * 5).Unix(),
+		"qsh": hex.EncodeToString(hash.Sum(nil)),
+	})
+	signedtoken, err := token.SignedString([]byte(g.secret))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "bearer "+signedtoken)
+	return nil
+}
+
+// request sends a request with the json of in to host and decodes the
+// answer into out, if any. The request is throttled with the commands
+// sent to host and is given timeoutMinutes to complete.
+func (g *Gd2Executor) request(ctx context.Context,
+	host, port, method, path string,
+	in, out interface{}, timeoutMinutes int) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, g.url(host, port, path),
+		bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := g.setToken(req); err != nil {
+		return err
+	}
+
+	// Throttle
+	if err := g.AccessConnectionContext(ctx, host); err != nil {
+		return err
+	}
+	defer g.FreeConnection(host)
+	executors.ReportHost(ctx, host)
+
+	reqCtx, cancel := context.WithTimeout(ctx,
+		time.Minute*time.Duration(timeoutMinutes))
+	defer cancel()
+
+	r, err := g.client.Do(req.WithContext(reqCtx))
+	switch {
+	case ctx.Err() != nil:
+		logger.Warning("Cancelled request %v %v on %v", method, path, host)
+		return ctx.Err()
+	case reqCtx.Err() != nil:
+		logger.LogError("Timeout on request %v %v on %v", method, path, host)
+		return executors.NewError(executors.ErrorTimeout, host,
+			"Request %v %v on %v timed out", method, path, host)
+	case err != nil:
+		logger.LogError("Failed request %v %v on %v: %v", method, path, host, err)
+		return &executors.Error{
+			Kind:    executors.ErrorUnreachable,
+			Host:    host,
+			Message: err.Error(),
+		}
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode >= http.StatusBadRequest {
+		err := responseError(r)
+		logger.Debug("Host: %v Request: %v %v\nError: %v", host, method, path, err)
+		return err
+	}
+	if out == nil || r.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(out); err != nil {
+		return fmt.Errorf("Unable to decode the answer to %v %v on %v: %v",
+			method, path, host, err)
+	}
+	logger.Debug("Host: %v Request: %v %v\nResult: %+v", host, method, path, out)
+	return nil
+}
+
+// gd2 sends a request to the glusterd2 REST API of host.
+func (g *Gd2Executor) gd2(host, method, path string, in, out interface{}) error {
+	return g.request(g.Context(), host, g.config.Port, method, path, in, out,
+		g.Timeout(cmdexec.CommandGluster))
+}
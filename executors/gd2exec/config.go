@@ -0,0 +1,35 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package gd2exec
+
+import (
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+)
+
+type Gd2Config struct {
+	cmdexec.CmdConfig
+
+	// port of the glusterd2 REST API on the nodes
+	Port string `json:"port"`
+	// port of the agent running the LVM and mount commands on the nodes
+	AgentPort string `json:"agent_port"`
+
+	// talk to glusterd2 and the agents over https, verifying their
+	// certificates with the CA in CACertFile, or not at all if
+	// Insecure is set
+	Https      bool   `json:"https"`
+	CACertFile string `json:"cacert"`
+	Insecure   bool   `json:"insecure"`
+
+	// user and file holding the secret the requests are signed with,
+	// the auth file of glusterd2. No token is sent without a secret.
+	User       string `json:"user"`
+	SecretFile string `json:"secret_file"`
+}
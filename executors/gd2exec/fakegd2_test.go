@@ -0,0 +1,355 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package gd2exec
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+)
+
+// fakeGd2 stands in for the glusterd2 REST API and the agent of the
+// nodes, both served on the same port.
+type fakeGd2 struct {
+	t      *testing.T
+	server *httptest.Server
+	secret string
+
+	lock      sync.Mutex
+	peers     []peer
+	volumes   map[string]*volumeInfo
+	snapshots map[string]int
+	sessions  []geoRepSession
+	options   map[string]string
+	healInfo  []brickHealInfo
+	// requests received, as "METHOD path"
+	requests []string
+	// commands received by the agent and their outputs, by the
+	// first word of the commands
+	commands []string
+	outputs  map[string]string
+	// error status answered to the requests, by "METHOD path"
+	failures map[string]int
+}
+
+func newFakeGd2(t *testing.T) *fakeGd2 {
+	f := &fakeGd2{
+		t:         t,
+		volumes:   map[string]*volumeInfo{},
+		snapshots: map[string]int{},
+		options:   map[string]string{},
+		outputs:   map[string]string{},
+		failures:  map[string]int{},
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/version", f.version).Methods("GET")
+	r.HandleFunc("/v1/peers", f.peerList).Methods("GET")
+	r.HandleFunc("/v1/peers", f.peerAdd).Methods("POST")
+	r.HandleFunc("/v1/peers/{id}", f.peerDelete).Methods("DELETE")
+	r.HandleFunc("/v1/cluster/options", f.clusterOptions).Methods("POST")
+	r.HandleFunc("/v1/volumes", f.volumeCreate).Methods("POST")
+	r.HandleFunc("/v1/volumes/{name}", f.volumeInfo).Methods("GET")
+	r.HandleFunc("/v1/volumes/{name}", f.volumeDelete).Methods("DELETE")
+	r.HandleFunc("/v1/volumes/{name}/heal-info", f.volumeHealInfo).Methods("GET")
+	r.HandleFunc("/v1/volumes/{name}/{action:.*}", f.volumeAction).Methods("POST")
+	r.HandleFunc("/v1/snapshots", f.snapshotList).Methods("GET")
+	r.HandleFunc("/v1/geo-replication", f.geoRepList).Methods("GET")
+	r.HandleFunc("/v1/geo-replication/{path:.*}", f.ok).Methods("POST", "DELETE")
+	r.HandleFunc("/v1/commands", f.agentCommands).Methods("POST")
+
+	f.server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			f.lock.Lock()
+			defer f.lock.Unlock()
+			key := req.Method + " " + req.URL.Path
+			f.requests = append(f.requests, key)
+			if !f.authorized(req) {
+				f.fail(w, http.StatusUnauthorized, "invalid token")
+				return
+			}
+			if status, ok := f.failures[key]; ok {
+				f.fail(w, status, fmt.Sprintf("%v failed", key))
+				return
+			}
+			r.ServeHTTP(w, req)
+		}))
+	return f
+}
+
+func (f *fakeGd2) Close() {
+	f.server.Close()
+}
+
+// config returns the configuration of an executor talking to f.
+func (f *fakeGd2) config() *Gd2Config {
+	_, port, err := net.SplitHostPort(f.server.Listener.Addr().String())
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return &Gd2Config{Port: port, AgentPort: port}
+}
+
+func (f *fakeGd2) addPeer(id, name string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.peers = append(f.peers, peer{
+		ID:            id,
+		Name:          name,
+		PeerAddresses: []string{name + ":24008"},
+		Online:        true,
+	})
+}
+
+// failRequest makes the requests to path fail with status.
+func (f *fakeGd2) failRequest(method, path string, status int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.failures[method+" "+path] = status
+}
+
+func (f *fakeGd2) received(method, path string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, r := range f.requests {
+		if r == method+" "+path {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeGd2) authorized(req *http.Request) bool {
+	if f.secret == "" {
+		return true
+	}
+	auth := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(auth) != 2 || auth[0] != "bearer" {
+		return false
+	}
+	token, err := jwt.Parse(auth[1], func(token *jwt.Token) (interface{}, error) {
+		return []byte(f.secret), nil
+	})
+	return err == nil && token.Valid
+}
+
+func (f *fakeGd2) fail(w http.ResponseWriter, status int, messages ...string) {
+	var resp errorResponse
+	for _, m := range messages {
+		resp.Errors = append(resp.Errors, struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}{Code: 1, Message: m})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&resp)
+}
+
+func (f *fakeGd2) reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeGd2) decode(req *http.Request, v interface{}) {
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		f.t.Errorf("invalid request %v %v: %v", req.Method, req.URL.Path, err)
+	}
+}
+
+func (f *fakeGd2) ok(w http.ResponseWriter, req *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeGd2) version(w http.ResponseWriter, req *http.Request) {
+	f.reply(w, http.StatusOK, map[string]string{"glusterd-version": "4.1.0"})
+}
+
+func (f *fakeGd2) peerList(w http.ResponseWriter, req *http.Request) {
+	f.reply(w, http.StatusOK, f.peers)
+}
+
+func (f *fakeGd2) peerAdd(w http.ResponseWriter, req *http.Request) {
+	var r struct {
+		Addresses []string `json:"addresses"`
+	}
+	f.decode(req, &r)
+	for _, p := range f.peers {
+		if p.hasAddress(r.Addresses[0]) {
+			f.fail(w, http.StatusConflict, "Peer already in cluster")
+			return
+		}
+	}
+	p := peer{
+		ID:            fmt.Sprintf("peer%v", len(f.peers)+1),
+		Name:          r.Addresses[0],
+		PeerAddresses: r.Addresses,
+		Online:        true,
+	}
+	f.peers = append(f.peers, p)
+	f.reply(w, http.StatusCreated, p)
+}
+
+func (f *fakeGd2) peerDelete(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	for i, p := range f.peers {
+		if p.ID == id {
+			f.peers = append(f.peers[:i], f.peers[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	f.fail(w, http.StatusNotFound, "peer not found")
+}
+
+func (f *fakeGd2) clusterOptions(w http.ResponseWriter, req *http.Request) {
+	var r struct {
+		Options map[string]string `json:"options"`
+	}
+	f.decode(req, &r)
+	for k, v := range r.Options {
+		f.options[k] = v
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeGd2) peerHost(id string) string {
+	for _, p := range f.peers {
+		if p.ID == id {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+func (f *fakeGd2) volumeCreate(w http.ResponseWriter, req *http.Request) {
+	var r volCreateReq
+	f.decode(req, &r)
+	if _, ok := f.volumes[r.Name]; ok {
+		f.fail(w, http.StatusConflict, "volume already exists")
+		return
+	}
+	v := &volumeInfo{
+		ID:      "id-" + r.Name,
+		Name:    r.Name,
+		State:   "Created",
+		Options: r.Options,
+	}
+	for i, s := range r.Subvols {
+		subvol := subvolInfo{
+			Name: fmt.Sprintf("%v-%v-%v", r.Name, s.Type, i),
+			Type: s.Type,
+		}
+		for _, b := range s.Bricks {
+			subvol.Bricks = append(subvol.Bricks, brickInfo{
+				ID:     fmt.Sprintf("brick-%v", b.Path),
+				PeerID: b.PeerID,
+				Host:   f.peerHost(b.PeerID),
+				Path:   b.Path,
+				Type:   "Brick",
+			})
+		}
+		v.ReplicaCount = s.ReplicaCount
+		v.Subvols = append(v.Subvols, subvol)
+	}
+	v.DistCount = len(v.Subvols)
+	f.volumes[r.Name] = v
+	f.reply(w, http.StatusCreated, v)
+}
+
+func (f *fakeGd2) volume(w http.ResponseWriter, req *http.Request) *volumeInfo {
+	v, ok := f.volumes[mux.Vars(req)["name"]]
+	if !ok {
+		f.fail(w, http.StatusNotFound, "volume not found")
+	}
+	return v
+}
+
+func (f *fakeGd2) volumeInfo(w http.ResponseWriter, req *http.Request) {
+	if v := f.volume(w, req); v != nil {
+		f.reply(w, http.StatusOK, v)
+	}
+}
+
+func (f *fakeGd2) volumeDelete(w http.ResponseWriter, req *http.Request) {
+	if v := f.volume(w, req); v != nil {
+		delete(f.volumes, v.Name)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeGd2) volumeHealInfo(w http.ResponseWriter, req *http.Request) {
+	if v := f.volume(w, req); v != nil {
+		f.reply(w, http.StatusOK, f.healInfo)
+	}
+}
+
+func (f *fakeGd2) volumeAction(w http.ResponseWriter, req *http.Request) {
+	v := f.volume(w, req)
+	if v == nil {
+		return
+	}
+	switch mux.Vars(req)["action"] {
+	case "start":
+		v.State = "Started"
+	case "stop":
+		v.State = "Stopped"
+	case "expand":
+		var r volExpandReq
+		f.decode(req, &r)
+		for _, b := range r.Bricks {
+			v.Subvols[0].Bricks = append(v.Subvols[0].Bricks, brickInfo{
+				PeerID: b.PeerID,
+				Host:   f.peerHost(b.PeerID),
+				Path:   b.Path,
+			})
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeGd2) snapshotList(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("volume")
+	list := snapshotList{ParentName: name}
+	for i := 0; i < f.snapshots[name]; i++ {
+		list.Snapshots = append(list.Snapshots, struct {
+			Name string `json:"name"`
+		}{fmt.Sprintf("snap%v", i)})
+	}
+	f.reply(w, http.StatusOK, []snapshotList{list})
+}
+
+func (f *fakeGd2) geoRepList(w http.ResponseWriter, req *http.Request) {
+	f.reply(w, http.StatusOK, f.sessions)
+}
+
+func (f *fakeGd2) agentCommands(w http.ResponseWriter, req *http.Request) {
+	var r agentRequest
+	f.decode(req, &r)
+	resp := agentResponse{Outputs: []string{}}
+	for _, c := range r.Commands {
+		f.commands = append(f.commands, c)
+		if strings.HasPrefix(c, "false") {
+			f.fail(w, http.StatusInternalServerError, "command failed")
+			return
+		}
+		resp.Outputs = append(resp.Outputs, f.outputs[strings.Fields(c)[0]])
+	}
+	f.reply(w, http.StatusOK, &resp)
+}
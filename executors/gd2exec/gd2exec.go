@@ -0,0 +1,298 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// Package gd2exec manages the nodes through the REST API of glusterd2
+// instead of the gluster command line. glusterd2 does not manage the
+// LVM of the nodes, the commands setting up the devices and the bricks
+// are sent to an agent on each node:
+//
+//	POST /v1/commands {"commands": [...], "timeout_minutes": 10}
+//
+// which runs them one after the other and answers their outputs,
+// {"outputs": [...]}, or the error of the first failed command in the
+// format of the glusterd2 errors.
+package gd2exec
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+// Gd2Executor sends the gluster requests to glusterd2 and inherits the
+// commands of the other requests from CmdExecutor, run by the agents.
+type Gd2Executor struct {
+	cmdexec.CmdExecutor
+
+	config *Gd2Config
+	client *http.Client
+	secret string
+}
+
+var (
+	logger = utils.NewLogger("[gd2exec]", utils.LEVEL_DEBUG)
+)
+
+const (
+	defaultPort      = "24007"
+	defaultAgentPort = "24010"
+	defaultUser      = "glustercli"
+)
+
+func setWithEnvVariables(config *Gd2Config) {
+	var env string
+
+	env = os.Getenv("HEKETI_FSTAB")
+	if "" != env {
+		config.Fstab = env
+	}
+
+	env = os.Getenv("HEKETI_SNAPSHOT_LIMIT")
+	if "" != env {
+		i, err := strconv.Atoi(env)
+		if err == nil {
+			config.SnapShotLimit = i
+		}
+	}
+
+	env = os.Getenv("HEKETI_GD2_SECRET_FILE")
+	if "" != env {
+		config.SecretFile = env
+	}
+}
+
+func NewGd2Executor(config *Gd2Config) (*Gd2Executor, error) {
+	// Override configuration
+	setWithEnvVariables(config)
+
+	g := &Gd2Executor{}
+	g.RemoteExecutor = g
+	g.InitThrottle()
+	g.Configure(&config.CmdConfig)
+	g.config = config
+
+	if config.Fstab == "" {
+		g.Fstab = "/etc/fstab"
+	} else {
+		g.Fstab = config.Fstab
+	}
+	if config.Port == "" {
+		config.Port = defaultPort
+	}
+	if config.AgentPort == "" {
+		config.AgentPort = defaultAgentPort
+	}
+	if config.User == "" {
+		config.User = defaultUser
+	}
+
+	if config.SecretFile != "" {
+		secret, err := ioutil.ReadFile(config.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read glusterd2 secret file %v: %v",
+				config.SecretFile, err)
+		}
+		g.secret = strings.TrimSpace(string(secret))
+		if g.secret == "" {
+			return nil, fmt.Errorf("glusterd2 secret file %v is empty",
+				config.SecretFile)
+		}
+	}
+
+	var err error
+	g.client, err = newHttpClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	godbc.Ensure(g != nil)
+	godbc.Ensure(g.config == config)
+	godbc.Ensure(g.Fstab != "")
+
+	return g, nil
+}
+
+// WithContext returns a copy of the executor whose requests are
+// cancelled once ctx is done.
+func (g *Gd2Executor) WithContext(ctx context.Context) executors.Executor {
+	c := *g
+	c.RemoteExecutor = &c
+	c.SetContext(ctx)
+	return &c
+}
+
+type agentRequest struct {
+	Commands       []string `json:"commands"`
+	TimeoutMinutes int      `json:"timeout_minutes"`
+}
+
+type agentResponse struct {
+	Outputs []string `json:"outputs"`
+}
+
+// RemoteCommandExecute sends the commands to the agent of host.
+func (g *Gd2Executor) RemoteCommandExecute(ctx context.Context,
+	host string,
+	commands []string,
+	timeoutMinutes int) ([]string, error) {
+
+	var resp agentResponse
+	err := g.request(ctx, host, g.config.AgentPort, "POST", "/v1/commands",
+		&agentRequest{
+			Commands:       commands,
+			TimeoutMinutes: timeoutMinutes,
+		}, &resp, timeoutMinutes)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Outputs) != len(commands) {
+		return nil, fmt.Errorf("Agent of %v answered %v outputs to %v commands",
+			host, len(resp.Outputs), len(commands))
+	}
+	return resp.Outputs, nil
+}
+
+// SshdControl fails with ErrSshdNotSupported, the nodes are managed
+// through glusterd2 and its agent.
+func (g *Gd2Executor) SshdControl(host string, action string) error {
+	logger.Warning("Unable to %v sshd on %v: %v", action, host,
+		executors.ErrSshdNotSupported)
+	return executors.ErrSshdNotSupported
+}
+
+func (g *Gd2Executor) RebalanceOnExpansion() bool {
+	return g.config.RebalanceOnExpansion
+}
+
+func (g *Gd2Executor) SnapShotLimit() int {
+	return g.config.SnapShotLimit
+}
+
+func (g *Gd2Executor) GlusterdCheck(host string) error {
+	godbc.Require(host != "")
+
+	logger.Info("Check glusterd2 service status in node %v", host)
+	err := g.gd2(host, "GET", "/version", nil, nil)
+	if err != nil {
+		logger.Err(err)
+		return err
+	}
+
+	return nil
+}
+
+type peer struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	PeerAddresses   []string `json:"peer-addresses"`
+	ClientAddresses []string `json:"client-addresses"`
+	Online          bool     `json:"online"`
+}
+
+// hasAddress returns true if the peer is known by the host name or
+// address node.
+func (p *peer) hasAddress(node string) bool {
+	if p.Name == node {
+		return true
+	}
+	for _, address := range append(p.PeerAddresses, p.ClientAddresses...) {
+		if address == node || strings.HasPrefix(address, node+":") {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Gd2Executor) peers(host string) ([]peer, error) {
+	var peers []peer
+	if err := g.gd2(host, "GET", "/v1/peers", nil, &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// peerIds returns the peer ids of the nodes, as known by host.
+func (g *Gd2Executor) peerIds(host string, nodes ...string) (map[string]string, error) {
+	peers, err := g.peers(host)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]string{}
+	for _, node := range nodes {
+		for i := range peers {
+			if peers[i].hasAddress(node) {
+				ids[node] = peers[i].ID
+				break
+			}
+		}
+		if _, ok := ids[node]; !ok {
+			return nil, &Error{
+				StatusCode: http.StatusNotFound,
+				Message:    fmt.Sprintf("Host %v is not a peer of %v", node, host),
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (g *Gd2Executor) PeerProbe(host, newnode string) error {
+	godbc.Require(host != "")
+	godbc.Require(newnode != "")
+
+	logger.Info("Probing: %v -> %v", host, newnode)
+	err := g.gd2(host, "POST", "/v1/peers", map[string][]string{
+		"addresses": {newnode},
+	}, nil)
+	switch {
+	case IsConflict(err):
+		logger.Info("%v is already a peer of %v", newnode, host)
+	case err != nil:
+		return err
+	}
+
+	// Determine if there is a snapshot limit configuration setting
+	if g.SnapShotLimit() > 0 {
+		logger.Info("Setting snapshot limit")
+		err := g.gd2(host, "POST", "/v1/cluster/options", map[string]interface{}{
+			"options": map[string]string{
+				"snap-max-hard-limit": strconv.Itoa(g.SnapShotLimit()),
+			},
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Gd2Executor) PeerDetach(host, detachnode string) error {
+	godbc.Require(host != "")
+	godbc.Require(detachnode != "")
+
+	logger.Info("Detaching node %v", detachnode)
+	ids, err := g.peerIds(host, detachnode)
+	if err == nil {
+		err = g.gd2(host, "DELETE", "/v1/peers/"+ids[detachnode], nil, nil)
+	}
+	if err != nil {
+		logger.Err(err)
+	}
+
+	return nil
+}
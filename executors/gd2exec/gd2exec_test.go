@@ -0,0 +1,409 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package gd2exec
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/heketi/tests"
+)
+
+const testHost = "127.0.0.1"
+
+func testGd2Executor(t *testing.T, f *fakeGd2) *Gd2Executor {
+	g, err := NewGd2Executor(f.config())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return g
+}
+
+func testVolumeRequest() *executors.VolumeRequest {
+	return &executors.VolumeRequest{
+		Name:    "vol1",
+		Type:    executors.DurabilityReplica,
+		Replica: 3,
+		Bricks: []executors.BrickInfo{
+			{Host: "node1", Path: "/b/1"},
+			{Host: "node2", Path: "/b/2"},
+			{Host: "node3", Path: "/b/3"},
+			{Host: "node1", Path: "/b/4"},
+			{Host: "node2", Path: "/b/5"},
+			{Host: "node3", Path: "/b/6"},
+		},
+		GlusterVolumeOptions: []string{"", "performance.rda-cache-limit 10MB"},
+	}
+}
+
+func TestNewGd2Executor(t *testing.T) {
+	g, err := NewGd2Executor(&Gd2Config{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, g.Fstab == "/etc/fstab")
+	tests.Assert(t, g.RemoteExecutor == g)
+	tests.Assert(t, g.config.Port == "24007")
+	tests.Assert(t, g.config.User == "glustercli")
+	tests.Assert(t, g.url("node1", "24007", "/version") == "http://node1:24007/version")
+
+	secretFile := tests.Tempfile()
+	defer os.Remove(secretFile)
+	err = ioutil.WriteFile(secretFile, []byte("secret\n"), 0600)
+	tests.Assert(t, err == nil)
+	g, err = NewGd2Executor(&Gd2Config{SecretFile: secretFile, Https: true})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, g.secret == "secret")
+	tests.Assert(t, g.url("node1", "24007", "/version") == "https://node1:24007/version")
+
+	err = ioutil.WriteFile(secretFile, []byte("\n"), 0600)
+	tests.Assert(t, err == nil)
+	_, err = NewGd2Executor(&Gd2Config{SecretFile: secretFile})
+	tests.Assert(t, err != nil)
+	_, err = NewGd2Executor(&Gd2Config{SecretFile: "/no/such/file"})
+	tests.Assert(t, err != nil)
+	_, err = NewGd2Executor(&Gd2Config{Https: true, CACertFile: secretFile})
+	tests.Assert(t, err != nil)
+}
+
+func TestGd2ExecutorErrors(t *testing.T) {
+	for _, test := range []struct {
+		status  int
+		body    string
+		message string
+		kind    executors.ErrorKind
+	}{
+		{404, `{"errors":[{"code":2,"message":"volume not found"}]}`, "volume not found",
+			executors.ErrorNotFound},
+		{409, `{"errors":[{"code":1,"message":"a"},{"code":1,"message":"b"}]}`, "a, b",
+			executors.ErrorAlreadyExists},
+		{409, `{"errors":[{"code":1,"message":"Another transaction is in progress"}]}`,
+			"Another transaction is in progress", executors.ErrorBusy},
+		{500, "agent crashed\n", "agent crashed", executors.ErrorCommandFailed},
+		{500, "No space left on device", "No space left on device",
+			executors.ErrorResourceExhausted},
+		{503, "", "Service Unavailable", executors.ErrorUnreachable},
+	} {
+		err := responseError(&http.Response{
+			StatusCode: test.status,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(test.body)),
+		})
+		tests.Assert(t, err.Error() == test.message, "got:", err)
+		tests.Assert(t, IsNotFound(err) == (test.status == 404))
+		tests.Assert(t, IsConflict(err) == (test.status == 409))
+		tests.Assert(t, executors.KindOf(err) == test.kind, test.message, executors.KindOf(err))
+	}
+	tests.Assert(t, !IsNotFound(nil))
+}
+
+func TestGd2ExecutorToken(t *testing.T) {
+	f := newFakeGd2(t)
+	defer f.Close()
+	f.secret = "secret"
+	g := testGd2Executor(t, f)
+
+	err := g.GlusterdCheck(testHost)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.(*Error).StatusCode == http.StatusUnauthorized)
+
+	g.secret = "secret"
+	err = g.GlusterdCheck(testHost)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestGd2ExecutorSshdControl(t *testing.T) {
+	f := newFakeGd2(t)
+	defer f.Close()
+	g := testGd2Executor(t, f)
+
+	err := g.SshdControl(testHost, "start")
+	tests.Assert(t, err == executors.ErrSshdNotSupported, err)
+	tests.Assert(t, len(f.requests) == 0, f.requests)
+}
+
+func TestGd2ExecutorPeers(t *testing.T) {
+	f := newFakeGd2(t)
+	defer f.Close()
+	config := f.config()
+	config.SnapShotLimit = 14
+	g, err := NewGd2Executor(config)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = g.GlusterdCheck(testHost)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = g.PeerProbe(testHost, "node1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(f.peers) == 1)
+	tests.Assert(t, f.options["snap-max-hard-limit"] == "14")
+
+	// probing a peer again is fine
+	err = g.PeerProbe(testHost, "node1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(f.peers) == 1)
+
+	f.failRequest("POST", "/v1/peers", http.StatusInternalServerError)
+	err = g.PeerProbe(testHost, "node2")
+	tests.Assert(t, err != nil)
+
+	err = g.PeerDetach(testHost, "node1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(f.peers) == 0)
+	tests.Assert(t, f.received("DELETE", "/v1/peers/peer1"))
+
+	// like the gluster command line, detach errors are only logged
+	err = g.PeerDetach(testHost, "node1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	f.Close()
+	err = g.GlusterdCheck(testHost)
+	tests.Assert(t, err != nil)
+}
+
+func TestGd2ExecutorVolumeCreate(t *testing.T) {
+	f := newFakeGd2(t)
+	defer f.Close()
+	g := testGd2Executor(t, f)
+	f.addPeer("p1", "node1")
+	f.addPeer("p2", "node2")
+	f.addPeer("p3", "node3")
+
+	_, err := g.VolumeCreate(testHost, testVolumeRequest())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f.received("POST", "/v1/volumes/vol1/start"))
+
+	v, err := g.VolumeInfo(testHost, "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v.VolumeName == "vol1")
+	tests.Assert(t, v.Status == 1 && v.StatusStr == "Started")
+	tests.Assert(t, v.ReplicaCount == 3)
+	tests.Assert(t, v.DistCount == 2)
+	tests.Assert(t, v.BrickCount == 6)
+	tests.Assert(t, v.Bricks.BrickList[3].Name == "node1:/b/4",
+		"got:", v.Bricks.BrickList[3].Name)
+	tests.Assert(t, v.Bricks.BrickList[3].HostUUID == "p1")
+	tests.Assert(t, v.OptCount == 1)
+	tests.Assert(t, v.Options.OptionList[0].Name == "performance.rda-cache-limit")
+	tests.Assert(t, v.Options.OptionList[0].Value == "10MB")
+
+	// the bricks must be on peers
+	req := testVolumeRequest()
+	req.Name = "vol2"
+	req.Bricks[5].Host = "node4"
+	_, err = g.VolumeCreate(testHost, req)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, IsNotFound(err))
+	tests.Assert(t, !f.received("POST", "/v1/volumes/vol2/start"))
+
+	// the volume is deleted if it fails to start
+	f.failRequest("POST", "/v1/volumes/vol3/start", http.StatusInternalServerError)
+	req = testVolumeRequest()
+	req.Name = "vol3"
+	_, err = g.VolumeCreate(testHost, req)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "POST /v1/volumes/vol3/start failed", "got:", err)
+	tests.Assert(t, f.received("DELETE", "/v1/volumes/vol3"))
+	_, ok := f.volumes["vol3"]
+	tests.Assert(t, !ok)
+
+	_, err = g.VolumeInfo(testHost, "vol3")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "volume not found"), "got:", err)
+}
+
+func TestGd2ExecutorVolumeExpand(t *testing.T) {
+	f := newFakeGd2(t)
+	defer f.Close()
+	config := f.config()
+	config.RebalanceOnExpansion = true
+	g, err := NewGd2Executor(config)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	f.addPeer("p1", "node1")
+	f.addPeer("p2", "node2")
+	f.addPeer("p3", "node3")
+
+	req := testVolumeRequest()
+	_, err = g.VolumeCreate(testHost, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req.Bricks = req.Bricks[:3]
+	_, err = g.VolumeExpand(testHost, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f.received("POST", "/v1/volumes/vol1/rebalance/start"))
+	v, err := g.VolumeInfo(testHost, "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v.BrickCount == 9, "got:", v.BrickCount)
+
+	// the bricks must make up whole sets
+	req.Bricks = req.Bricks[:2]
+	_, err = g.VolumeExpand(testHost, req)
+	tests.Assert(t, err != nil)
+}
+
+func TestGd2ExecutorVolumeDestroy(t *testing.T) {
+	f := newFakeGd2(t)
+	defer f.Close()
+	g := testGd2Executor(t, f)
+	f.addPeer("p1", "node1")
+	f.addPeer("p2", "node2")
+	f.addPeer("p3", "node3")
+
+	_, err := g.VolumeCreate(testHost, testVolumeRequest())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	f.snapshots["vol1"] = 2
+	err = g.VolumeDestroyCheck(testHost, "vol1")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "Unable to delete volume vol1 because it contains 2 snapshots",
+		"got:", err)
+	f.snapshots["vol1"] = 0
+	err = g.VolumeDestroyCheck(testHost, "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = g.VolumeDestroy(testHost, "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f.received("POST", "/v1/volumes/vol1/stop"))
+	tests.Assert(t, len(f.volumes) == 0)
+
+	err = g.VolumeDestroy(testHost, "vol1")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "Unable to delete volume vol1: volume not found",
+		"got:", err)
+}
+
+func TestGd2ExecutorReplaceBrickAndHeal(t *testing.T) {
+	f := newFakeGd2(t)
+	defer f.Close()
+	g := testGd2Executor(t, f)
+	f.addPeer("p1", "node1")
+	f.addPeer("p2", "node2")
+	f.addPeer("p3", "node3")
+	_, err := g.VolumeCreate(testHost, testVolumeRequest())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = g.VolumeReplaceBrick(testHost, "vol1",
+		&executors.BrickInfo{Host: "node1", Path: "/b/1"},
+		&executors.BrickInfo{Host: "node2", Path: "/b/7"})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f.received("POST", "/v1/volumes/vol1/replacebrick"))
+
+	err = g.VolumeReplaceBrick(testHost, "vol1",
+		&executors.BrickInfo{Host: "node1", Path: "/b/1"},
+		&executors.BrickInfo{Host: "node9", Path: "/b/7"})
+	tests.Assert(t, err != nil)
+
+	entries := int64(3)
+	f.healInfo = []brickHealInfo{
+		{Name: "node1:/b/1", Status: "Connected", HostID: "p1", Entries: &entries},
+		{Name: "node2:/b/2", Status: "Transport endpoint is not connected", HostID: "p2"},
+	}
+	heal, err := g.HealInfo(testHost, "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(heal.Bricks.BrickList) == 2)
+	tests.Assert(t, heal.Bricks.BrickList[0].NumberOfEntries == "3")
+	tests.Assert(t, heal.Bricks.BrickList[0].HostUUID == "p1")
+	tests.Assert(t, heal.Bricks.BrickList[1].NumberOfEntries == "-")
+
+	_, err = g.HealInfo(testHost, "vol9")
+	tests.Assert(t, err != nil)
+}
+
+func TestGd2ExecutorGeoReplication(t *testing.T) {
+	f := newFakeGd2(t)
+	defer f.Close()
+	g := testGd2Executor(t, f)
+
+	geoRep := &executors.GeoReplicationRequest{
+		SlaveHost:   "remote",
+		SlaveVolume: "rvol",
+		ActionParams: map[string]string{
+			"option":   "push-pem",
+			"timeout":  "ten",
+			"sync-job": "2",
+		},
+	}
+	err := g.GeoReplicationCreate(testHost, "vol1", geoRep)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f.received("POST", "/v1/geo-replication/vol1/remote/rvol"))
+
+	err = g.GeoReplicationAction(testHost, "vol1", "start", geoRep)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f.received("POST", "/v1/geo-replication/vol1/remote/rvol/start"))
+	err = g.GeoReplicationAction(testHost, "vol1", "delete", geoRep)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f.received("DELETE", "/v1/geo-replication/vol1/remote/rvol"))
+
+	// only the valid options are set
+	err = g.GeoReplicationConfig(testHost, "vol1", geoRep)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !f.received("POST", "/v1/geo-replication/vol1/remote/rvol/config"))
+	geoRep.ActionParams["ignore-deletes"] = "true"
+	err = g.GeoReplicationConfig(testHost, "vol1", geoRep)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f.received("POST", "/v1/geo-replication/vol1/remote/rvol/config"))
+
+	f.sessions = []geoRepSession{
+		{MasterVolume: "vol1", RemoteHosts: []string{"remote"}, RemoteVolume: "rvol",
+			Workers: []geoRepWorker{
+				{MasterNode: "node1", MasterBrick: "/b/1", RemoteUser: "root", Status: "Active"},
+			}},
+		{MasterVolume: "vol2", RemoteHosts: []string{"remote"}, RemoteVolume: "rvol2"},
+		{MasterVolume: "vol1", RemoteHosts: []string{"other"}, RemoteVolume: "rvol"},
+	}
+	status, err := g.GeoReplicationStatus(testHost)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(status.Volume) == 2)
+	tests.Assert(t, len(status.Volume[0].Sessions.SessionList) == 2)
+	session := status.Volume[0].Sessions.SessionList[0]
+	tests.Assert(t, session.SessionSlave == "remote::rvol", "got:", session.SessionSlave)
+	tests.Assert(t, session.Pairs[0].Slave == "root@remote::rvol")
+	tests.Assert(t, session.Pairs[0].Status == "Active")
+
+	status, err = g.GeoReplicationVolumeStatus(testHost, "vol2")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(status.Volume) == 1)
+	tests.Assert(t, status.Volume[0].VolumeName == "vol2")
+}
+
+func TestGd2ExecutorAgent(t *testing.T) {
+	f := newFakeGd2(t)
+	defer f.Close()
+	g := testGd2Executor(t, f)
+
+	out, err := g.RemoteCommandExecute(context.Background(), testHost,
+		[]string{"echo 1", "echo 2"}, 1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(out) == 2)
+
+	// the LVM commands of the bricks go to the agent
+	f.outputs["lvs"] = "tp_brick1:1\n"
+	err = g.BrickDestroyCheck(testHost, &executors.BrickRequest{
+		VgId: "vg1",
+		Name: "brick1",
+		Path: "/b/1",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	f.lock.Lock()
+	tests.Assert(t, len(f.commands) == 3, "got:", f.commands)
+	tests.Assert(t, strings.HasPrefix(f.commands[2], "lvs"), "got:", f.commands)
+	f.lock.Unlock()
+
+	_, err = g.RemoteCommandExecute(context.Background(), testHost,
+		[]string{"false", "echo 2"}, 1)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "command failed", "got:", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = executors.WithContext(ctx, g).GlusterdCheck(testHost)
+	tests.Assert(t, err == context.Canceled, "got:", err)
+}
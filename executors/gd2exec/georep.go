@@ -0,0 +1,242 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package gd2exec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+type geoRepCreateReq struct {
+	SSHPort int  `json:"ssh-port,omitempty"`
+	PushPem bool `json:"push-pem"`
+	Force   bool `json:"force"`
+}
+
+type geoRepWorker struct {
+	MasterNode               string `json:"master-node"`
+	MasterNodeID             string `json:"master-node-id"`
+	MasterBrick              string `json:"master-brick"`
+	RemoteUser               string `json:"remote-user"`
+	RemoteNode               string `json:"remote-node"`
+	Status                   string `json:"status"`
+	CrawlStatus              string `json:"crawl-status"`
+	Entry                    string `json:"entry"`
+	Data                     string `json:"data"`
+	Meta                     string `json:"meta"`
+	Failures                 string `json:"failures"`
+	LastSynced               string `json:"last-synced"`
+	CheckpointCompleted      string `json:"checkpoint-completed"`
+	CheckpointTime           string `json:"checkpoint-time"`
+	CheckpointCompletionTime string `json:"checkpoint-completion-time"`
+}
+
+type geoRepSession struct {
+	MasterVolume string         `json:"master-volume"`
+	RemoteHosts  []string       `json:"remote-hosts"`
+	RemoteVolume string         `json:"remote-volume"`
+	RemoteUser   string         `json:"remote-user"`
+	Workers      []geoRepWorker `json:"workers"`
+}
+
+// geoRepPath returns the path of the requests on the session of volume
+// with the slave of geoRep.
+func geoRepPath(volume string, geoRep *executors.GeoReplicationRequest,
+	action ...string) string {
+
+	return strings.Join(append([]string{"/v1/geo-replication",
+		volume, geoRep.SlaveHost, geoRep.SlaveVolume}, action...), "/")
+}
+
+// GeoReplicationCreate creates a geo-rep session for the given volume
+func (g *Gd2Executor) GeoReplicationCreate(host, volume string, geoRep *executors.GeoReplicationRequest) error {
+	logger.Debug("In GeoReplicationCreate")
+	logger.Debug("actionParams: %+v", geoRep.ActionParams)
+
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+	godbc.Require(geoRep.SlaveHost != "")
+	godbc.Require(geoRep.SlaveVolume != "")
+	_, optionOK := geoRep.ActionParams["option"]
+	godbc.Require(optionOK && (geoRep.ActionParams["option"] == "push-pem" || geoRep.ActionParams["option"] == "no-verify"))
+
+	return g.gd2(host, "POST", geoRepPath(volume, geoRep), &geoRepCreateReq{
+		SSHPort: geoRep.SlaveSSHPort,
+		PushPem: geoRep.ActionParams["option"] == "push-pem",
+		Force:   geoRep.ActionParams["force"] == "true",
+	}, nil)
+}
+
+// GeoReplicationAction executes the given geo-replication action for the given volume
+func (g *Gd2Executor) GeoReplicationAction(host, volume, action string, geoRep *executors.GeoReplicationRequest) error {
+	logger.Debug("In GeoReplicationAction: %s", action)
+
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+	godbc.Require(geoRep.SlaveHost != "")
+	godbc.Require(geoRep.SlaveVolume != "")
+
+	req := map[string]bool{
+		"force": geoRep.ActionParams["force"] == "true",
+	}
+	if action == "delete" {
+		return g.gd2(host, "DELETE", geoRepPath(volume, geoRep), req, nil)
+	}
+	return g.gd2(host, "POST", geoRepPath(volume, geoRep, action), req, nil)
+}
+
+// geoRepStatus returns the status of the sessions of volume, or of all
+// the sessions if volume is empty.
+func (g *Gd2Executor) geoRepStatus(host, volume string) (*executors.GeoReplicationStatus, error) {
+	var sessions []geoRepSession
+	if err := g.gd2(host, "GET", "/v1/geo-replication", nil, &sessions); err != nil {
+		return nil, err
+	}
+
+	status := &executors.GeoReplicationStatus{}
+	volumes := map[string]int{}
+	for _, session := range sessions {
+		if volume != "" && session.MasterVolume != volume {
+			continue
+		}
+		i, ok := volumes[session.MasterVolume]
+		if !ok {
+			i = len(status.Volume)
+			volumes[session.MasterVolume] = i
+			status.Volume = append(status.Volume, executors.GeoReplicationVolume{
+				VolumeName: session.MasterVolume,
+			})
+		}
+
+		slaveHost := ""
+		if len(session.RemoteHosts) > 0 {
+			slaveHost = session.RemoteHosts[0]
+		}
+		s := executors.GeoReplicationSession{
+			SessionSlave: fmt.Sprintf("%v::%v", slaveHost, session.RemoteVolume),
+		}
+		for _, w := range session.Workers {
+			s.Pairs = append(s.Pairs, executors.GeoReplicationPair{
+				MasterNode:               w.MasterNode,
+				MasterBrick:              w.MasterBrick,
+				SlaveUser:                w.RemoteUser,
+				Slave:                    fmt.Sprintf("%v@%v::%v", w.RemoteUser, slaveHost, session.RemoteVolume),
+				SlaveNode:                w.RemoteNode,
+				Status:                   w.Status,
+				CrawlStatus:              w.CrawlStatus,
+				Entry:                    w.Entry,
+				Data:                     w.Data,
+				Meta:                     w.Meta,
+				Failures:                 w.Failures,
+				CheckpointCompleted:      w.CheckpointCompleted,
+				MasterNodeUUID:           w.MasterNodeID,
+				LastSynced:               w.LastSynced,
+				CheckpointTime:           w.CheckpointTime,
+				CheckpointCompletionTime: w.CheckpointCompletionTime,
+			})
+		}
+		sessionList := &status.Volume[i].Sessions.SessionList
+		*sessionList = append(*sessionList, s)
+	}
+
+	return status, nil
+}
+
+// GeoReplicationStatus returns the geo-replication status
+func (g *Gd2Executor) GeoReplicationStatus(host string) (*executors.GeoReplicationStatus, error) {
+	logger.Debug("In GeoReplicationStatus")
+
+	godbc.Require(host != "")
+
+	status, err := g.geoRepStatus(host, "")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine geo-replication status on host %s: %v", host, err)
+	}
+	return status, nil
+}
+
+// GeoReplicationVolumeStatus returns the geo-replication status of a specific volume
+func (g *Gd2Executor) GeoReplicationVolumeStatus(host, volume string) (*executors.GeoReplicationStatus, error) {
+	logger.Debug("In GeoReplicationVolumeStatus")
+
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	status, err := g.geoRepStatus(host, volume)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine geo-replication status for volume %v: %v", volume, err)
+	}
+	return status, nil
+}
+
+// GeoReplicationConfig configures the geo-replication session for the given volume
+func (g *Gd2Executor) GeoReplicationConfig(host, volume string, geoRep *executors.GeoReplicationRequest) error {
+	logger.Debug("In GeoReplicationConfig")
+
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+	godbc.Require(geoRep.SlaveHost != "")
+	godbc.Require(geoRep.SlaveVolume != "")
+
+	options := geoRepConfigOptions(geoRep)
+	if len(options) == 0 {
+		return nil
+	}
+	err := g.gd2(host, "POST", geoRepPath(volume, geoRep, "config"), options, nil)
+	if err != nil {
+		logger.LogError("Invalid configuration for volume georeplication %s", volume)
+		return err
+	}
+	return nil
+}
+
+// geoRepConfigOptions returns the valid options of geoRep, the same the
+// other executors set.
+func geoRepConfigOptions(geoRep *executors.GeoReplicationRequest) map[string]string {
+	options := map[string]string{}
+
+	for param, value := range geoRep.ActionParams {
+		switch param {
+		// String parameters
+		case "log-level", "gluster-log-level", "changelog-log-level", "ssh-command", "rsync-command":
+			options[param] = value
+		// Boolean parameters
+		case "use-tarssh", "use-meta-volume":
+			if value != "false" && value != "true" {
+				logger.LogError("Invalid value %v for config option %s", value, param)
+				continue
+			}
+			options[param] = value
+		case "ignore-deletes":
+			if value != "false" && value != "true" {
+				logger.LogError("Invalid value %v for config option %s", value, param)
+				continue
+			}
+
+			// set to 1 if explicitly set to true, skip otherwise
+			if value == "true" {
+				options[param] = "1"
+			}
+		// Integer parameters
+		case "timeout", "sync-jobs", "ssh-port":
+			if _, err := strconv.Atoi(value); err != nil {
+				logger.LogError("Invalid value %v for config option %s", value, param)
+				continue
+			}
+			options[param] = value
+		}
+	}
+
+	return options
+}
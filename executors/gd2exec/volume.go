@@ -0,0 +1,394 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package gd2exec
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+type brickReq struct {
+	PeerID string `json:"peerid"`
+	Path   string `json:"path"`
+}
+
+type subvolReq struct {
+	Type               string     `json:"type"`
+	Bricks             []brickReq `json:"bricks"`
+	ReplicaCount       int        `json:"replica,omitempty"`
+	DisperseData       int        `json:"disperse-data,omitempty"`
+	DisperseRedundancy int        `json:"disperse-redundancy,omitempty"`
+}
+
+type volCreateReq struct {
+	Name    string            `json:"name"`
+	Subvols []subvolReq       `json:"subvols"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+type volExpandReq struct {
+	ReplicaCount int        `json:"replica,omitempty"`
+	Bricks       []brickReq `json:"bricks"`
+}
+
+type replaceBrickReq struct {
+	SrcPeerID string `json:"srcpeerid"`
+	SrcPath   string `json:"srcpath"`
+	DstPeerID string `json:"dstpeerid"`
+	DstPath   string `json:"dstpath"`
+	Force     bool   `json:"force"`
+}
+
+type brickInfo struct {
+	ID     string `json:"id"`
+	PeerID string `json:"peer-id"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+}
+
+type subvolInfo struct {
+	Name   string      `json:"name"`
+	Type   string      `json:"type"`
+	Bricks []brickInfo `json:"bricks"`
+}
+
+type volumeInfo struct {
+	ID              string            `json:"id"`
+	Name            string            `json:"name"`
+	Type            string            `json:"type"`
+	State           string            `json:"state"`
+	DistCount       int               `json:"distribute-count"`
+	ReplicaCount    int               `json:"replica-count"`
+	ArbiterCount    int               `json:"arbiter-count"`
+	DisperseCount   int               `json:"disperse-count"`
+	RedundancyCount int               `json:"disperse-redundancy-count"`
+	Options         map[string]string `json:"options"`
+	Subvols         []subvolInfo      `json:"subvols"`
+}
+
+type brickHealInfo struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	HostID  string `json:"host-id"`
+	Entries *int64 `json:"entries"`
+}
+
+type snapshotList struct {
+	ParentName string `json:"parent-volume"`
+	Snapshots  []struct {
+		Name string `json:"name"`
+	} `json:"snaps"`
+}
+
+// volumeStarted is the status of a started volume in the volume info
+// of the gluster command line
+const volumeStarted = 1
+
+// volumePath returns the path of the requests on volume.
+func volumePath(volume string, action ...string) string {
+	return strings.Join(append([]string{"/v1/volumes", volume}, action...), "/")
+}
+
+// brickSets returns the number of bricks of each subvolume of the
+// volume and the type of the subvolumes.
+func brickSets(volume *executors.VolumeRequest) (int, string) {
+	switch volume.Type {
+	case executors.DurabilityReplica:
+		return volume.Replica, "replicate"
+	case executors.DurabilityDispersion:
+		return volume.Data + volume.Redundancy, "disperse"
+	}
+	return len(volume.Bricks), "distribute"
+}
+
+// subvols groups the bricks of the volume into its subvolumes, using
+// the peer ids known by host.
+func (g *Gd2Executor) subvols(host string,
+	volume *executors.VolumeRequest) ([]subvolReq, error) {
+
+	hosts := make([]string, 0, len(volume.Bricks))
+	for _, brick := range volume.Bricks {
+		hosts = append(hosts, brick.Host)
+	}
+	ids, err := g.peerIds(host, hosts...)
+	if err != nil {
+		return nil, err
+	}
+
+	inSet, subvolType := brickSets(volume)
+	if inSet < 1 || len(volume.Bricks)%inSet != 0 {
+		return nil, fmt.Errorf("Unable to split %v bricks in sets of %v",
+			len(volume.Bricks), inSet)
+	}
+	subvols := []subvolReq{}
+	for start := 0; start < len(volume.Bricks); start += inSet {
+		subvol := subvolReq{Type: subvolType}
+		switch volume.Type {
+		case executors.DurabilityReplica:
+			subvol.ReplicaCount = volume.Replica
+		case executors.DurabilityDispersion:
+			subvol.DisperseData = volume.Data
+			subvol.DisperseRedundancy = volume.Redundancy
+		}
+		for _, brick := range volume.Bricks[start : start+inSet] {
+			subvol.Bricks = append(subvol.Bricks, brickReq{
+				PeerID: ids[brick.Host],
+				Path:   brick.Path,
+			})
+		}
+		subvols = append(subvols, subvol)
+	}
+	return subvols, nil
+}
+
+// volumeOptions returns the "key value" gluster options of the volume
+// as a map.
+func volumeOptions(volume *executors.VolumeRequest) (map[string]string, error) {
+	options := map[string]string{}
+	for _, volOption := range volume.GlusterVolumeOptions {
+		if volOption == "" {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimSpace(volOption), " ", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid volume option %v", volOption)
+		}
+		options[kv[0]] = strings.TrimSpace(kv[1])
+	}
+	return options, nil
+}
+
+func (g *Gd2Executor) VolumeCreate(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	godbc.Require(volume != nil)
+	godbc.Require(host != "")
+	godbc.Require(len(volume.Bricks) > 0)
+	godbc.Require(volume.Name != "")
+
+	logger.Info("Creating volume %v", volume.Name)
+	options, err := volumeOptions(volume)
+	if err != nil {
+		return nil, err
+	}
+	subvols, err := g.subvols(host, volume)
+	if err != nil {
+		return nil, err
+	}
+
+	err = g.gd2(host, "POST", "/v1/volumes", &volCreateReq{
+		Name:    volume.Name,
+		Subvols: subvols,
+		Options: options,
+	}, nil)
+	if err == nil {
+		err = g.gd2(host, "POST", volumePath(volume.Name, "start"), nil, nil)
+	}
+	if err != nil {
+		g.VolumeDestroy(host, volume.Name)
+		return nil, err
+	}
+
+	return &executors.Volume{}, nil
+}
+
+func (g *Gd2Executor) VolumeExpand(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	godbc.Require(volume != nil)
+	godbc.Require(host != "")
+	godbc.Require(len(volume.Bricks) > 0)
+	godbc.Require(volume.Name != "")
+
+	subvols, err := g.subvols(host, volume)
+	if err != nil {
+		return nil, err
+	}
+	req := &volExpandReq{}
+	if volume.Type == executors.DurabilityReplica {
+		req.ReplicaCount = volume.Replica
+	}
+	for _, subvol := range subvols {
+		req.Bricks = append(req.Bricks, subvol.Bricks...)
+	}
+
+	err = g.gd2(host, "POST", volumePath(volume.Name, "expand"), req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.RebalanceOnExpansion() {
+		err = g.gd2(host, "POST", volumePath(volume.Name, "rebalance", "start"),
+			nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &executors.Volume{}, nil
+}
+
+func (g *Gd2Executor) VolumeDestroy(host string, volume string) error {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	// First stop the volume, then delete it
+
+	err := g.gd2(host, "POST", volumePath(volume, "stop"), nil, nil)
+	if err != nil {
+		logger.LogError("Unable to stop volume %v: %v", volume, err)
+	}
+
+	err = g.gd2(host, "DELETE", volumePath(volume), nil, nil)
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to delete volume %v: %v", volume, err))
+	}
+
+	return nil
+}
+
+func (g *Gd2Executor) VolumeDestroyCheck(host, volume string) error {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	var snapshots []snapshotList
+	err := g.gd2(host, "GET", "/v1/snapshots?volume="+volume, nil, &snapshots)
+	if err != nil {
+		return fmt.Errorf("Unable to get snapshot information from volume %v: %v", volume, err)
+	}
+
+	count := 0
+	for _, list := range snapshots {
+		if list.ParentName == volume {
+			count += len(list.Snapshots)
+		}
+	}
+	if count > 0 {
+		return fmt.Errorf("Unable to delete volume %v because it contains %v snapshots",
+			volume, count)
+	}
+
+	return nil
+}
+
+func (g *Gd2Executor) VolumeInfo(host string, volume string) (*executors.Volume, error) {
+	godbc.Require(volume != "")
+	godbc.Require(host != "")
+
+	var info volumeInfo
+	err := g.gd2(host, "GET", volumePath(volume), nil, &info)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get volume info of volume name: %v: %v", volume, err)
+	}
+
+	v := &executors.Volume{
+		VolumeName:      info.Name,
+		ID:              info.ID,
+		StatusStr:       info.State,
+		DistCount:       info.DistCount,
+		ReplicaCount:    info.ReplicaCount,
+		ArbiterCount:    info.ArbiterCount,
+		DisperseCount:   info.DisperseCount,
+		RedundancyCount: info.RedundancyCount,
+		TypeStr:         info.Type,
+	}
+	if info.State == "Started" {
+		v.Status = volumeStarted
+	}
+	for _, subvol := range info.Subvols {
+		for _, brick := range subvol.Bricks {
+			b := executors.Brick{
+				UUID:     brick.ID,
+				Name:     fmt.Sprintf("%v:%v", brick.Host, brick.Path),
+				HostUUID: brick.PeerID,
+			}
+			if brick.Type == "Arbiter" {
+				b.IsArbiter = 1
+			}
+			v.Bricks.BrickList = append(v.Bricks.BrickList, b)
+		}
+	}
+	v.BrickCount = len(v.Bricks.BrickList)
+
+	names := make([]string, 0, len(info.Options))
+	for name := range info.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v.Options.OptionList = append(v.Options.OptionList, executors.Option{
+			Name:  name,
+			Value: info.Options[name],
+		})
+	}
+	v.OptCount = len(names)
+
+	logger.Debug("%+v\n", v)
+	return v, nil
+}
+
+func (g *Gd2Executor) VolumeReplaceBrick(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+	godbc.Require(volume != "")
+	godbc.Require(host != "")
+	godbc.Require(oldBrick != nil)
+	godbc.Require(newBrick != nil)
+
+	ids, err := g.peerIds(host, oldBrick.Host, newBrick.Host)
+	if err == nil {
+		err = g.gd2(host, "POST", volumePath(volume, "replacebrick"), &replaceBrickReq{
+			SrcPeerID: ids[oldBrick.Host],
+			SrcPath:   oldBrick.Path,
+			DstPeerID: ids[newBrick.Host],
+			DstPath:   newBrick.Path,
+			Force:     true,
+		}, nil)
+	}
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to replace brick %v:%v with %v:%v for volume %v: %v", oldBrick.Host, oldBrick.Path, newBrick.Host, newBrick.Path, volume, err))
+	}
+
+	return nil
+}
+
+func (g *Gd2Executor) HealInfo(host string, volume string) (*executors.HealInfo, error) {
+	godbc.Require(volume != "")
+	godbc.Require(host != "")
+
+	var bricks []brickHealInfo
+	err := g.gd2(host, "GET", volumePath(volume, "heal-info"), nil, &bricks)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get heal info of volume : %v: %v", volume, err)
+	}
+
+	healInfo := &executors.HealInfo{}
+	for _, brick := range bricks {
+		// the gluster command line shows a dash for the bricks it
+		// could not count the entries of
+		entries := "-"
+		if brick.Entries != nil {
+			entries = strconv.FormatInt(*brick.Entries, 10)
+		}
+		healInfo.Bricks.BrickList = append(healInfo.Bricks.BrickList,
+			executors.BrickHealStatus{
+				HostUUID:        brick.HostID,
+				Name:            brick.Name,
+				Status:          brick.Status,
+				NumberOfEntries: entries,
+			})
+	}
+	logger.Debug("%+v\n", healInfo)
+	return healInfo, nil
+}
@@ -22,4 +22,17 @@ type KubeConfig struct {
 	// Use POD name instead of using label
 	// to access POD
 	UsePodNames bool `json:"use_pod_names"`
+
+	// Label selector of the gluster pods. The pod of a node is the
+	// one matching it which runs on the kubernetes node named after
+	// the manage hostname of the node.
+	PodSelector string `json:"pod_selector"`
+
+	// Container of the gluster pods the commands are run in, the
+	// first container of the pods if empty
+	Container string `json:"container"`
+
+	// Times a command is tried again when its exec session could
+	// not be set up, before the command started
+	ExecRetries int `json:"exec_retries"`
 }
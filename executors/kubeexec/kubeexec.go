@@ -11,19 +11,25 @@ package kubeexec
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/kubernetes/pkg/api"
 	client "k8s.io/kubernetes/pkg/client/clientset_generated/clientset"
 	coreclient "k8s.io/kubernetes/pkg/client/clientset_generated/clientset/typed/core/v1"
 	"k8s.io/kubernetes/pkg/client/unversioned/remotecommand"
 	kubeletcmd "k8s.io/kubernetes/pkg/kubelet/server/remotecommand"
+	utilexec "k8s.io/kubernetes/pkg/util/exec"
 
+	"github.com/chinacoolhacker/heketi/executors"
 	"github.com/chinacoolhacker/heketi/executors/cmdexec"
 	"github.com/chinacoolhacker/heketi/pkg/kubernetes"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
@@ -40,9 +46,13 @@ type KubeExecutor struct {
 	// save kube configuration
 	config     *KubeConfig
 	namespace  string
-	kube       *client.Clientset
+	kube       client.Interface
 	rest       restclient.Interface
 	kubeConfig *restclient.Config
+
+	// pods the hosts were resolved to, shared by the copies of
+	// the executor
+	pods *podCache
 }
 
 var (
@@ -50,6 +60,24 @@ var (
 	inClusterConfig = func() (*restclient.Config, error) {
 		return restclient.InClusterConfig()
 	}
+	newClientset = func(c *restclient.Config) (client.Interface, error) {
+		return client.NewForConfig(c)
+	}
+	newExecutor = func(c *restclient.Config,
+		method string, url *url.URL) (remotecommand.StreamExecutor, error) {
+		return remotecommand.NewExecutor(c, method, url)
+	}
+	// time between the tries of a command whose exec session could
+	// not be set up
+	execRetryDelay = 2 * time.Second
+
+	// Beginning of the messages of the errors of the exec streams
+	// which failed to connect to the pod, before the command started
+	sessionSetupErrors = []string{
+		"error creating request",
+		"error sending request",
+		"unable to upgrade connection",
+	}
 )
 
 func setWithEnvVariables(config *KubeConfig) {
@@ -88,6 +116,18 @@ func setWithEnvVariables(config *KubeConfig) {
 		}
 	}
 
+	// Container the commands are run in
+	env = os.Getenv("HEKETI_KUBE_CONTAINER")
+	if "" != env {
+		config.Container = env
+	}
+
+	// Label selector of the gluster pods
+	env = os.Getenv("HEKETI_KUBE_POD_SELECTOR")
+	if "" != env {
+		config.PodSelector = env
+	}
+
 	// Use POD names
 	env = os.Getenv("HEKETI_KUBE_USE_POD_NAMES")
 	if "" != env {
@@ -107,7 +147,8 @@ func NewKubeExecutor(config *KubeConfig) (*KubeExecutor, error) {
 	// Initialize
 	k := &KubeExecutor{}
 	k.config = config
-	k.Throttlemap = make(map[string]chan bool)
+	k.InitThrottle()
+	k.Configure(&config.CmdConfig)
 	k.RemoteExecutor = k
 
 	if k.config.Fstab == "" {
@@ -126,6 +167,14 @@ func NewKubeExecutor(config *KubeConfig) (*KubeExecutor, error) {
 	}
 	k.namespace = k.config.Namespace
 
+	if k.config.PodSelector != "" {
+		if _, err := labels.Parse(k.config.PodSelector); err != nil {
+			return nil, logger.LogError("Invalid pod selector %v: %v",
+				k.config.PodSelector, err)
+		}
+	}
+	k.pods = newPodCache()
+
 	// Create a Kube client configuration
 	k.kubeConfig, err = inClusterConfig()
 	if err != nil {
@@ -140,7 +189,7 @@ func NewKubeExecutor(config *KubeConfig) (*KubeExecutor, error) {
 	k.rest = restCore.RESTClient()
 
 	// Get a Go-client for Kubernetes
-	k.kube, err = client.NewForConfig(k.kubeConfig)
+	k.kube, err = newClientset(k.kubeConfig)
 	if err != nil {
 		logger.Err(err)
 		return nil, fmt.Errorf("Unable to create a client set")
@@ -152,51 +201,70 @@ func NewKubeExecutor(config *KubeConfig) (*KubeExecutor, error) {
 	return k, nil
 }
 
-func (k *KubeExecutor) RemoteCommandExecute(host string,
+// WithContext returns a copy of the executor whose commands are
+// cancelled once ctx is done.
+func (k *KubeExecutor) WithContext(ctx context.Context) executors.Executor {
+	c := *k
+	c.RemoteExecutor = &c
+	c.SetContext(ctx)
+	return &c
+}
+
+func (k *KubeExecutor) RemoteCommandExecute(ctx context.Context,
+	host string,
 	commands []string,
 	timeoutMinutes int) ([]string, error) {
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// Throttle
-	k.AccessConnection(host)
+	if err := k.AccessConnectionContext(ctx, host); err != nil {
+		return nil, err
+	}
 	defer k.FreeConnection(host)
+	executors.ReportHost(ctx, host)
 
 	// Execute
-	return k.ConnectAndExec(host,
+	output, err := k.ConnectAndExecContext(ctx,
+		host,
 		"pods",
 		commands,
 		timeoutMinutes)
+	switch err.(type) {
+	case *sessionError, *streamError:
+		// the pod of host could not be reached
+		return nil, &executors.Error{
+			Kind:    executors.ErrorUnreachable,
+			Host:    host,
+			Message: err.Error(),
+		}
+	}
+	return output, err
 }
 
 func (k *KubeExecutor) ConnectAndExec(host, resource string,
 	commands []string,
 	timeoutMinutes int) ([]string, error) {
 
-	// Used to return command output
-	buffers := make([]string, len(commands))
+	return k.ConnectAndExecContext(context.Background(),
+		host, resource, commands, timeoutMinutes)
+}
 
-	// Get pod name
-	var (
-		podName string
-		err     error
-	)
-	if k.config.UsePodNames {
-		podName = host
-	} else if k.config.GlusterDaemonSet {
-		podName, err = k.getPodNameFromDaemonSet(host)
-	} else {
-		podName, err = k.getPodNameByLabel(host)
-	}
-	if err != nil {
-		return nil, err
-	}
+// ConnectAndExecContext runs the commands in the pod of host. No new
+// command is started once ctx is done, a running command is not
+// interrupted. A command whose exec session could not be set up, hence
+// which did not start, is tried again up to the configured number of
+// retries. A command whose session broke once set up may have run and
+// is not tried again, see retryexec for the retries of the queries.
+func (k *KubeExecutor) ConnectAndExecContext(ctx context.Context,
+	host, resource string,
+	commands []string,
+	timeoutMinutes int) ([]string, error) {
 
-	// Get container name
-	podSpec, err := k.kube.Core().Pods(k.namespace).Get(podName, v1.GetOptions{})
-	if err != nil {
-		return nil, logger.LogError("Unable to get pod spec for %v: %v",
-			podName, err)
-	}
-	containerName := podSpec.Spec.Containers[0].Name
+	// Used to return command output
+	buffers := make([]string, len(commands))
 
 	for index, command := range commands {
 
@@ -205,48 +273,139 @@ func (k *KubeExecutor) ConnectAndExec(host, resource string,
 
 		// SUDO is *not* supported
 
-		// Create REST command
-		req := k.rest.Post().
-			Resource(resource).
-			Name(podName).
-			Namespace(k.namespace).
-			SubResource("exec").
-			Param("container", containerName)
-		req.VersionedParams(&api.PodExecOptions{
-			Container: containerName,
-			Command:   []string{"/bin/bash", "-c", command},
-			Stdout:    true,
-			Stderr:    true,
-		}, api.ParameterCodec)
-
-		// Create SPDY connection
-		exec, err := remotecommand.NewExecutor(k.kubeConfig, "POST", req.URL())
-		if err != nil {
-			logger.Err(err)
-			return nil, fmt.Errorf("Unable to setup a session with %v", podName)
+		for attempt := 0; ; attempt++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			output, err := k.exec(host, resource, command)
+			if err == nil {
+				buffers[index] = output
+				break
+			}
+			if _, ok := err.(*sessionError); !ok || attempt >= k.config.ExecRetries {
+				return nil, err
+			}
+			logger.Warning("Retrying command [%v] on %v after session failure %v/%v: %v",
+				command, host, attempt+1, k.config.ExecRetries, err)
+			select {
+			case <-time.After(execRetryDelay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
 		}
+	}
+
+	return buffers, nil
+}
 
-		// Create a buffer to trap session output
-		var b bytes.Buffer
-		var berr bytes.Buffer
+// sessionError is an exec session which could not be set up, the
+// command it was to run did not start and may be tried again.
+type sessionError struct {
+	err error
+}
 
-		// Excute command
-		err = exec.Stream(remotecommand.StreamOptions{
-			SupportedProtocols: kubeletcmd.SupportedStreamingProtocols,
-			Stdout:             &b,
-			Stderr:             &berr,
-		})
-		if err != nil {
-			logger.LogError("Failed to run command [%v] on %v: Err[%v]: Stdout [%v]: Stderr [%v]",
-				command, podName, err, b.String(), berr.String())
-			return nil, fmt.Errorf("Unable to execute command on %v: %v", podName, berr.String())
+func (e *sessionError) Error() string {
+	return e.err.Error()
+}
+
+// streamError is an exec session which broke before the command it was
+// to run had any output. The command may have run.
+type streamError struct {
+	err error
+}
+
+func (e *streamError) Error() string {
+	return e.err.Error()
+}
+
+// isSessionSetupError returns true if err, returned by the stream of an
+// exec session, means the session could not connect to the pod.
+func isSessionSetupError(err error) bool {
+	for _, prefix := range sessionSetupErrors {
+		if strings.HasPrefix(err.Error(), prefix) {
+			return true
 		}
-		logger.Debug("Host: %v Pod: %v Command: %v\nResult: %v", host, podName, command, b.String())
-		buffers[index] = b.String()
+	}
+	return false
+}
 
+// exec runs command in the pod of host and returns its output.
+func (k *KubeExecutor) exec(host, resource, command string) (string, error) {
+	target, err := k.podTarget(host)
+	if err != nil {
+		return "", err
+	}
+	podName := target.pod
+
+	// Create REST command
+	req := k.rest.Post().
+		Resource(resource).
+		Name(podName).
+		Namespace(k.namespace).
+		SubResource("exec").
+		Param("container", target.container)
+	req.VersionedParams(&api.PodExecOptions{
+		Container: target.container,
+		Command:   []string{"/bin/bash", "-c", command},
+		Stdout:    true,
+		Stderr:    true,
+	}, api.ParameterCodec)
+
+	// Create SPDY connection
+	exec, err := newExecutor(k.kubeConfig, "POST", req.URL())
+	if err != nil {
+		logger.Err(err)
+		k.pods.invalidate(host)
+		return "", &sessionError{fmt.Errorf("Unable to setup a session with %v", podName)}
 	}
 
-	return buffers, nil
+	// Create a buffer to trap session output
+	var b bytes.Buffer
+	var berr bytes.Buffer
+
+	// Excute command
+	err = exec.Stream(remotecommand.StreamOptions{
+		SupportedProtocols: kubeletcmd.SupportedStreamingProtocols,
+		Stdout:             &b,
+		Stderr:             &berr,
+	})
+	if err != nil {
+		logger.LogError("Failed to run command [%v] on %v: Err[%v]: Stdout [%v]: Stderr [%v]",
+			command, podName, err, b.String(), berr.String())
+		if _, exited := err.(utilexec.ExitError); !exited {
+			// the pod may have been restarted or moved, look it up
+			// again for the next command
+			k.pods.invalidate(host)
+			// report the stream error when there is no error output,
+			// so that a broken stream can be told apart from a failed
+			// command
+			if berr.Len() == 0 {
+				setup := isSessionSetupError(err)
+				err = fmt.Errorf("Unable to execute command on %v: %v", podName, err)
+				switch {
+				case setup:
+					return "", &sessionError{err}
+				case b.Len() == 0:
+					return "", &streamError{err}
+				}
+				return "", err
+			}
+		}
+		status := -1
+		if exitErr, exited := err.(utilexec.ExitError); exited {
+			status = exitErr.ExitStatus()
+		}
+		return "", &executors.Error{
+			Kind:     executors.ErrorCommandFailed,
+			Host:     host,
+			ExitCode: status,
+			Stdout:   b.String(),
+			Stderr:   berr.String(),
+			Message:  fmt.Sprintf("Unable to execute command on %v: %v", podName, berr.String()),
+		}
+	}
+	logger.Debug("Host: %v Pod: %v Command: %v\nResult: %v", host, podName, command, b.String())
+	return b.String(), nil
 }
 
 func (k *KubeExecutor) RebalanceOnExpansion() bool {
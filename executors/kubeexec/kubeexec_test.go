@@ -10,11 +10,23 @@
 package kubeexec
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"testing"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	restclient "k8s.io/client-go/rest"
+	kubeapi "k8s.io/kubernetes/pkg/api/v1"
+	client "k8s.io/kubernetes/pkg/client/clientset_generated/clientset"
+	fakeclientset "k8s.io/kubernetes/pkg/client/clientset_generated/clientset/fake"
+	"k8s.io/kubernetes/pkg/client/unversioned/remotecommand"
+	utilexec "k8s.io/kubernetes/pkg/util/exec"
 
+	"github.com/chinacoolhacker/heketi/executors"
 	"github.com/chinacoolhacker/heketi/executors/cmdexec"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/heketi/tests"
@@ -25,6 +37,68 @@ func init() {
 		return &restclient.Config{}, nil
 	}
 	logger.SetLevel(utils.LEVEL_NOLOG)
+	execRetryDelay = 0
+}
+
+func testPod(name, node string, labels map[string]string,
+	containers ...string) *kubeapi.Pod {
+
+	pod := &kubeapi.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "mynamespace",
+			Labels:    labels,
+		},
+		Spec: kubeapi.PodSpec{
+			NodeName: node,
+		},
+	}
+	for _, container := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers,
+			kubeapi.Container{Name: container})
+	}
+	return pod
+}
+
+// testKubeExecutor returns an executor whose kubernetes client is a
+// fake clientset holding pods.
+func testKubeExecutor(t *testing.T,
+	config *KubeConfig, pods ...*kubeapi.Pod) (*KubeExecutor, *fakeclientset.Clientset) {
+
+	var objects []runtime.Object
+	for _, pod := range pods {
+		objects = append(objects, pod)
+	}
+	fake := fakeclientset.NewSimpleClientset(objects...)
+	defer tests.Patch(&newClientset, func(c *restclient.Config) (client.Interface, error) {
+		return fake, nil
+	}).Restore()
+
+	config.Namespace = "mynamespace"
+	k, err := NewKubeExecutor(config)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return k, fake
+}
+
+// fakeStream runs the commands sent to the pods with run.
+type fakeStream struct {
+	run func(options remotecommand.StreamOptions) error
+}
+
+func (f *fakeStream) Stream(options remotecommand.StreamOptions) error {
+	return f.run(options)
+}
+
+// patchStreams makes the exec sessions run their commands with run,
+// and records the urls of the sessions.
+func patchStreams(urls *[]*url.URL,
+	run func(options remotecommand.StreamOptions) error) tests.Restorer {
+
+	return tests.Patch(&newExecutor, func(c *restclient.Config,
+		method string, u *url.URL) (remotecommand.StreamExecutor, error) {
+		*urls = append(*urls, u)
+		return &fakeStream{run: run}, nil
+	})
 }
 
 func TestNewKubeExecutor(t *testing.T) {
@@ -115,3 +189,218 @@ func TestKubeExecutorEnvVariables(t *testing.T) {
 	tests.Assert(t, k.SnapShotLimit() == 999)
 
 }
+
+func TestKubeExecutorPodSelector(t *testing.T) {
+	gluster := map[string]string{"app": "glusterfs"}
+	k, _ := testKubeExecutor(t,
+		&KubeConfig{PodSelector: "app=glusterfs"},
+		testPod("gluster-1", "node1", gluster, "glusterfs"),
+		testPod("other-1", "node1", map[string]string{"app": "other"}, "other"),
+		testPod("gluster-2", "node2", gluster, "glusterfs"),
+		testPod("gluster-3", "node3", gluster, "glusterfs"),
+		testPod("gluster-3b", "node3", gluster, "glusterfs"))
+
+	target, err := k.podTarget("node1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, target.pod == "gluster-1", target)
+	tests.Assert(t, target.container == "glusterfs", target)
+
+	target, err = k.podTarget("node2")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, target.pod == "gluster-2", target)
+
+	// no pod on the node
+	_, err = k.podTarget("node4")
+	tests.Assert(t, err != nil)
+
+	// more than one pod on the node
+	_, err = k.podTarget("node3")
+	tests.Assert(t, err != nil)
+
+	_, err = NewKubeExecutor(&KubeConfig{
+		Namespace:   "mynamespace",
+		PodSelector: "app in (glusterfs",
+	})
+	tests.Assert(t, err != nil)
+}
+
+func TestKubeExecutorContainer(t *testing.T) {
+	gluster := map[string]string{KubeGlusterFSPodLabelKey: "node1"}
+	pod := testPod("gluster-1", "node1", gluster, "sidecar", "glusterfs")
+
+	// the first container by default
+	k, _ := testKubeExecutor(t, &KubeConfig{}, pod)
+	target, err := k.podTarget("node1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, target.pod == "gluster-1", target)
+	tests.Assert(t, target.container == "sidecar", target)
+
+	k, _ = testKubeExecutor(t, &KubeConfig{Container: "glusterfs"}, pod)
+	target, err = k.podTarget("node1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, target.container == "glusterfs", target)
+
+	k, _ = testKubeExecutor(t, &KubeConfig{Container: "missing"}, pod)
+	_, err = k.podTarget("node1")
+	tests.Assert(t, err != nil)
+
+	// the container is sent with the exec request
+	var urls []*url.URL
+	defer patchStreams(&urls, func(options remotecommand.StreamOptions) error {
+		fmt.Fprint(options.Stdout, "ok")
+		return nil
+	}).Restore()
+	k, _ = testKubeExecutor(t, &KubeConfig{Container: "glusterfs"}, pod)
+	out, err := k.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"gluster --version"}, 1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, out[0] == "ok", out)
+	tests.Assert(t, len(urls) == 1)
+	tests.Assert(t, urls[0].Query().Get("container") == "glusterfs", urls[0])
+}
+
+func TestKubeExecutorPodCache(t *testing.T) {
+	gluster := map[string]string{"app": "glusterfs"}
+	k, fake := testKubeExecutor(t,
+		&KubeConfig{PodSelector: "app=glusterfs"},
+		testPod("gluster-1", "node1", gluster, "glusterfs"))
+
+	var urls []*url.URL
+	var streamErr error
+	defer patchStreams(&urls, func(options remotecommand.StreamOptions) error {
+		return streamErr
+	}).Restore()
+
+	_, err := k.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"true"}, 1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	lookups := len(fake.Actions())
+
+	// the pod is only looked up once, also by the copies of the
+	// executor
+	_, err = k.WithContext(context.Background()).(*KubeExecutor).RemoteCommandExecute(
+		context.Background(), "node1", []string{"true", "true"}, 1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(fake.Actions()) == lookups, fake.Actions())
+	tests.Assert(t, len(urls) == 3)
+
+	// a failed command does not invalidate the pod
+	streamErr = utilexec.CodeExitError{Err: errors.New("exit 1"), Code: 1}
+	_, err = k.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"false"}, 1)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(fake.Actions()) == lookups, fake.Actions())
+
+	// a broken stream does, the pod was replaced by another one
+	streamErr = errors.New("connection reset")
+	_, err = k.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"true"}, 1)
+	tests.Assert(t, err != nil)
+	_, ok := k.pods.get("node1")
+	tests.Assert(t, !ok)
+
+	err = fake.Core().Pods("mynamespace").Delete("gluster-1", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = fake.Core().Pods("mynamespace").Create(
+		testPod("gluster-1b", "node1", gluster, "glusterfs"))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	urls = nil
+	streamErr = nil
+	_, err = k.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"true"}, 1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(urls) == 1)
+	tests.Assert(t, urls[0].Path == "/api/v1/namespaces/mynamespace/pods/gluster-1b/exec",
+		urls[0])
+}
+
+func TestKubeExecutorExecRetries(t *testing.T) {
+	gluster := map[string]string{KubeGlusterFSPodLabelKey: "node1"}
+	k, _ := testKubeExecutor(t, &KubeConfig{ExecRetries: 2},
+		testPod("gluster-1", "node1", gluster, "glusterfs"))
+
+	var urls []*url.URL
+	failures := 0
+	defer patchStreams(&urls, func(options remotecommand.StreamOptions) error {
+		if failures > 0 {
+			failures--
+			return errors.New("unable to upgrade connection: pod not found")
+		}
+		fmt.Fprint(options.Stdout, "done")
+		return nil
+	}).Restore()
+
+	// the sessions which could not be set up are retried
+	failures = 2
+	out, err := k.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"gluster volume list"}, 1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, out[0] == "done", out)
+	tests.Assert(t, len(urls) == 3)
+
+	// up to the configured number of retries
+	urls = nil
+	failures = 3
+	_, err = k.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"gluster volume list"}, 1)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(urls) == 3)
+	tests.Assert(t, executors.KindOf(err) == executors.ErrorUnreachable, err)
+
+	// as are the executors which could not be created
+	created := 0
+	defer tests.Patch(&newExecutor, func(c *restclient.Config,
+		method string, u *url.URL) (remotecommand.StreamExecutor, error) {
+		created++
+		if created < 2 {
+			return nil, errors.New("bad url")
+		}
+		return &fakeStream{run: func(options remotecommand.StreamOptions) error {
+			fmt.Fprint(options.Stdout, "done")
+			return nil
+		}}, nil
+	}).Restore()
+	out, err = k.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"gluster volume list"}, 1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, out[0] == "done", out)
+	tests.Assert(t, created == 2, created)
+
+	// the streams which broke once set up are not, even without
+	// output, the command may have run
+	urls = nil
+	defer patchStreams(&urls, func(options remotecommand.StreamOptions) error {
+		return errors.New("stream closed")
+	}).Restore()
+	_, err = k.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"gluster volume create vol1"}, 1)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(urls) == 1)
+	tests.Assert(t, executors.KindOf(err) == executors.ErrorUnreachable, err)
+
+	// the commands which failed are not
+	urls = nil
+	defer patchStreams(&urls, func(options remotecommand.StreamOptions) error {
+		fmt.Fprint(options.Stderr, "volume list: failed")
+		return utilexec.CodeExitError{Err: errors.New("exit 1"), Code: 1}
+	}).Restore()
+	_, err = k.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"gluster volume list"}, 1)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "Unable to execute command on gluster-1: volume list: failed", err)
+	tests.Assert(t, len(urls) == 1)
+	tests.Assert(t, executors.KindOf(err) == executors.ErrorCommandFailed, err)
+	tests.Assert(t, err.(*executors.Error).ExitCode == 1, err)
+
+	// nor the streams which broke once the command had output
+	urls = nil
+	defer patchStreams(&urls, func(options remotecommand.StreamOptions) error {
+		fmt.Fprint(options.Stdout, "vol1")
+		return errors.New("stream closed")
+	}).Restore()
+	_, err = k.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"gluster volume list"}, 1)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(urls) == 1)
+}
@@ -0,0 +1,152 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package kubeexec
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeapi "k8s.io/kubernetes/pkg/api/v1"
+)
+
+// podTarget is the pod and the container the commands of a host are
+// run in.
+type podTarget struct {
+	pod       string
+	container string
+}
+
+// podCache keeps the pods the hosts were resolved to, so that the pods
+// are not looked up for each command. The pod of a host is forgotten
+// when a command could not be run in it, and looked up again for the
+// next command, in case it was restarted or moved.
+type podCache struct {
+	lock    sync.Mutex
+	targets map[string]podTarget
+}
+
+func newPodCache() *podCache {
+	return &podCache{
+		targets: map[string]podTarget{},
+	}
+}
+
+func (c *podCache) get(host string) (podTarget, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	target, ok := c.targets[host]
+	return target, ok
+}
+
+func (c *podCache) set(host string, target podTarget) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.targets[host] = target
+}
+
+func (c *podCache) invalidate(host string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.targets, host)
+}
+
+// podTarget returns the pod and the container the commands of host are
+// run in.
+func (k *KubeExecutor) podTarget(host string) (podTarget, error) {
+	if target, ok := k.pods.get(host); ok {
+		return target, nil
+	}
+
+	// Get pod name
+	var (
+		podName string
+		err     error
+	)
+	switch {
+	case k.config.UsePodNames:
+		podName = host
+	case k.config.PodSelector != "":
+		podName, err = k.getPodNameBySelector(host)
+	case k.config.GlusterDaemonSet:
+		podName, err = k.getPodNameFromDaemonSet(host)
+	default:
+		podName, err = k.getPodNameByLabel(host)
+	}
+	if err != nil {
+		return podTarget{}, err
+	}
+
+	// Get container name
+	podSpec, err := k.kube.Core().Pods(k.namespace).Get(podName, v1.GetOptions{})
+	if err != nil {
+		return podTarget{}, logger.LogError("Unable to get pod spec for %v: %v",
+			podName, err)
+	}
+	containerName, err := k.containerName(podSpec)
+	if err != nil {
+		return podTarget{}, err
+	}
+
+	target := podTarget{pod: podName, container: containerName}
+	k.pods.set(host, target)
+	logger.Debug("Commands of host %v run in container %v of pod %v",
+		host, containerName, podName)
+	return target, nil
+}
+
+// containerName returns the configured container of pod, or its first
+// container when none is configured.
+func (k *KubeExecutor) containerName(pod *kubeapi.Pod) (string, error) {
+	if k.config.Container == "" {
+		if len(pod.Spec.Containers) == 0 {
+			return "", logger.LogError("Pod %v has no container", pod.Name)
+		}
+		return pod.Spec.Containers[0].Name, nil
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == k.config.Container {
+			return container.Name, nil
+		}
+	}
+	return "", logger.LogError("Pod %v has no container %v",
+		pod.Name, k.config.Container)
+}
+
+// getPodNameBySelector returns the pod matching the configured label
+// selector which runs on the kubernetes node named host, the manage
+// hostname of the heketi node.
+func (k *KubeExecutor) getPodNameBySelector(host string) (string, error) {
+	pods, err := k.kube.Core().Pods(k.namespace).List(v1.ListOptions{
+		LabelSelector: k.config.PodSelector,
+	})
+	if err != nil {
+		logger.Err(err)
+		return "", fmt.Errorf("Failed to get list of pods")
+	}
+
+	var found []string
+	for _, pod := range pods.Items {
+		// skip the pods being deleted, their replacement may
+		// already be running
+		if pod.Spec.NodeName == host && pod.DeletionTimestamp == nil {
+			found = append(found, pod.Name)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", logger.LogError("No pods matching '%v' were found on node %v",
+			k.config.PodSelector, host)
+	case 1:
+		return found[0], nil
+	}
+	return "", logger.LogError("Found %v pods matching '%v' on node %v: %v",
+		len(found), k.config.PodSelector, host, found)
+}
@@ -0,0 +1,23 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package localexec
+
+import (
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+)
+
+type LocalConfig struct {
+	cmdexec.CmdConfig
+
+	// network namespaces the commands of the hosts are run in, to run
+	// several nodes on one machine in testing. The commands of the
+	// other hosts are run in the namespace of heketi.
+	Namespaces map[string]string `json:"namespaces"`
+}
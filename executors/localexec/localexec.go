@@ -0,0 +1,185 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package localexec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+// LocalExecutor runs the commands on the machine heketi runs on, for
+// heketi running on the storage node or beside it in the gluster pod.
+type LocalExecutor struct {
+	cmdexec.CmdExecutor
+
+	config *LocalConfig
+}
+
+var (
+	logger = utils.NewLogger("[localexec]", utils.LEVEL_DEBUG)
+	// command running a command in a network namespace
+	netnsExec = []string{"ip", "netns", "exec"}
+)
+
+func setWithEnvVariables(config *LocalConfig) {
+	var env string
+
+	env = os.Getenv("HEKETI_FSTAB")
+	if "" != env {
+		config.Fstab = env
+	}
+
+	env = os.Getenv("HEKETI_SNAPSHOT_LIMIT")
+	if "" != env {
+		i, err := strconv.Atoi(env)
+		if err == nil {
+			config.SnapShotLimit = i
+		}
+	}
+}
+
+func NewLocalExecutor(config *LocalConfig) (*LocalExecutor, error) {
+	// Override configuration
+	setWithEnvVariables(config)
+
+	l := &LocalExecutor{}
+	l.RemoteExecutor = l
+	l.InitThrottle()
+	l.Configure(&config.CmdConfig)
+	l.config = config
+
+	if config.Fstab == "" {
+		l.Fstab = "/etc/fstab"
+	} else {
+		l.Fstab = config.Fstab
+	}
+
+	for host, ns := range config.Namespaces {
+		if ns == "" {
+			return nil, fmt.Errorf("Missing network namespace of host %v", host)
+		}
+	}
+
+	godbc.Ensure(l != nil)
+	godbc.Ensure(l.config == config)
+	godbc.Ensure(l.Fstab != "")
+
+	return l, nil
+}
+
+// WithContext returns a copy of the executor whose commands are
+// cancelled once ctx is done.
+func (l *LocalExecutor) WithContext(ctx context.Context) executors.Executor {
+	c := *l
+	c.RemoteExecutor = &c
+	c.SetContext(ctx)
+	return &c
+}
+
+func (l *LocalExecutor) RemoteCommandExecute(ctx context.Context,
+	host string,
+	commands []string,
+	timeoutMinutes int) ([]string, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Throttle
+	if err := l.AccessConnectionContext(ctx, host); err != nil {
+		return nil, err
+	}
+	defer l.FreeConnection(host)
+	executors.ReportHost(ctx, host)
+
+	// Execute each command
+	buffers := make([]string, len(commands))
+	for index, command := range commands {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		output, err := l.run(ctx, host, command, timeoutMinutes)
+		if err != nil {
+			return nil, err
+		}
+		buffers[index] = output
+	}
+	return buffers, nil
+}
+
+// run runs command in a shell, in the network namespace of host if it
+// has one. The command is killed once ctx is done or the timeout
+// expired.
+func (l *LocalExecutor) run(ctx context.Context,
+	host, command string, timeoutMinutes int) (string, error) {
+
+	args := []string{"/bin/bash", "-c", command}
+	if l.config.Sudo {
+		args = append([]string{"sudo"}, args...)
+	}
+	if ns, ok := l.config.Namespaces[host]; ok {
+		args = append(append(append([]string{}, netnsExec...), ns), args...)
+	}
+
+	cmdCtx, cancel := context.WithTimeout(ctx,
+		time.Minute*time.Duration(timeoutMinutes))
+	defer cancel()
+
+	var b, berr bytes.Buffer
+	cmd := exec.CommandContext(cmdCtx, args[0], args[1:]...)
+	cmd.Stdout = &b
+	cmd.Stderr = &berr
+	err := cmd.Run()
+	switch {
+	case ctx.Err() != nil:
+		logger.Warning("Cancelled command [%v] on %v", command, host)
+		return "", ctx.Err()
+	case cmdCtx.Err() != nil:
+		logger.LogError("Timeout on command [%v] on %v: Stdout [%v]: Stderr [%v]",
+			command, host, b.String(), berr.String())
+		return "", executors.NewError(executors.ErrorTimeout, host, "Local command timeout")
+	case err != nil:
+		logger.LogError("Failed to run command [%v] on %v: Err[%v]: Stdout [%v]: Stderr [%v]",
+			command, host, err, b.String(), berr.String())
+		return "", executors.NewCommandError(host, exitStatus(err), b.String(), berr.String())
+	}
+	logger.Debug("Host: %v Command: %v\nResult: %v", host, command, b.String())
+	return b.String(), nil
+}
+
+// exitStatus returns the exit status of the command which failed with
+// err, -1 if it did not exit.
+func exitStatus(err error) int {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return -1
+}
+
+func (l *LocalExecutor) RebalanceOnExpansion() bool {
+	return l.config.RebalanceOnExpansion
+}
+
+func (l *LocalExecutor) SnapShotLimit() int {
+	return l.config.SnapShotLimit
+}
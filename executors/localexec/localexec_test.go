@@ -0,0 +1,136 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package localexec
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/executors"
+
+	"github.com/heketi/tests"
+)
+
+func TestNewLocalExecutor(t *testing.T) {
+	l, err := NewLocalExecutor(&LocalConfig{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, l.Fstab == "/etc/fstab")
+	tests.Assert(t, l.RemoteExecutor == l)
+
+	_, err = NewLocalExecutor(&LocalConfig{
+		Namespaces: map[string]string{"node1": ""},
+	})
+	tests.Assert(t, err != nil)
+}
+
+func TestLocalExecutorRemoteCommandExecute(t *testing.T) {
+	l, err := NewLocalExecutor(&LocalConfig{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	out, err := l.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"echo one", "echo 'two words' | wc -w"}, 1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(out) == 2)
+	tests.Assert(t, out[0] == "one\n", "got:", out[0])
+	tests.Assert(t, strings.TrimSpace(out[1]) == "2", "got:", out[1])
+
+	// the error is the output of the failed command, the commands
+	// after it are not run
+	_, err = l.RemoteCommandExecute(context.Background(), "node1",
+		[]string{"echo failed >&2; exit 3", "touch /not/run"}, 1)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "failed\n", "got:", err)
+	e, ok := err.(*executors.Error)
+	tests.Assert(t, ok, "got:", err)
+	tests.Assert(t, e.Kind == executors.ErrorCommandFailed, e.Kind)
+	tests.Assert(t, e.ExitCode == 3, e.ExitCode)
+	tests.Assert(t, e.Host == "node1", e.Host)
+}
+
+func TestLocalExecutorCancel(t *testing.T) {
+	l, err := NewLocalExecutor(&LocalConfig{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	_, err = l.RemoteCommandExecute(ctx, "node1", []string{"sleep 30"}, 1)
+	tests.Assert(t, err == context.Canceled, "got:", err)
+	tests.Assert(t, time.Since(start) < 10*time.Second)
+
+	_, err = l.RemoteCommandExecute(ctx, "node1", []string{"echo 1"}, 1)
+	tests.Assert(t, err == context.Canceled, "got:", err)
+}
+
+func TestLocalExecutorNamespaces(t *testing.T) {
+	// env stands in for ip netns exec
+	defer tests.Patch(&netnsExec, []string{"env"}).Restore()
+
+	l, err := NewLocalExecutor(&LocalConfig{
+		Namespaces: map[string]string{
+			"node1": "NODE=ns1",
+			"node2": "NODE=ns2",
+		},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	for host, want := range map[string]string{
+		"node1": "ns1",
+		"node2": "ns2",
+		"node3": "",
+	} {
+		out, err := l.RemoteCommandExecute(context.Background(), host,
+			[]string{"echo $NODE"}, 1)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, strings.TrimSpace(out[0]) == want,
+			"host", host, "got:", out[0])
+	}
+}
+
+func TestLocalExecutorSshdControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localexec")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+	log := filepath.Join(dir, "log")
+	err = ioutil.WriteFile(filepath.Join(dir, "systemctl"), []byte(`#!/bin/sh
+echo "$@" >> `+log+`
+echo ActiveState=active
+echo UnitFileState=disabled
+`), 0755)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+":"+path)
+	defer os.Setenv("PATH", path)
+
+	l, err := NewLocalExecutor(&LocalConfig{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// sshd is managed with systemctl, and its state checked, like on
+	// the nodes reached over ssh
+	err = l.SshdControl("node1", "start")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = l.SshdControl("node1", "enable")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err != executors.ErrSshdNotSupported, err)
+
+	b, err := ioutil.ReadFile(log)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, strings.Count(string(b), "show ") == 2, string(b))
+	tests.Assert(t, strings.Contains(string(b), "start sshd\n"), string(b))
+	tests.Assert(t, strings.Contains(string(b), "enable sshd\n"), string(b))
+}
@@ -11,6 +11,7 @@ package mockexec
 
 import (
 	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
 )
 
 type MockExecutor struct {
@@ -37,6 +38,7 @@ type MockExecutor struct {
 	MockHealInfo                   func(host string, volume string) (*executors.HealInfo, error)
 	MockBlockVolumeCreate          func(host string, blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error)
 	MockBlockVolumeDestroy         func(host string, blockHostingVolumeName string, blockVolumeName string) error
+	MockBlockVolumeModifyAuth      func(host string, blockHostingVolumeName string, blockVolumeName string, auth bool) (*executors.BlockVolumeInfo, error)
 	MockSshdControl                func(host string, action string) error
 }
 
@@ -145,6 +147,19 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return nil
 	}
 
+	m.MockBlockVolumeModifyAuth = func(host string, blockHostingVolumeName string, blockVolumeName string, auth bool) (*executors.BlockVolumeInfo, error) {
+		var blockVolumeInfo executors.BlockVolumeInfo
+		blockVolumeInfo.GlusterVolumeName = blockHostingVolumeName
+		blockVolumeInfo.Name = blockVolumeName
+		blockVolumeInfo.Iqn = "fakeIQN"
+		if auth {
+			blockVolumeInfo.Username = "heketi-user"
+			blockVolumeInfo.Password = utils.GenUUID()
+		}
+
+		return &blockVolumeInfo, nil
+	}
+
 	m.MockGeoReplicationCreate = func(host, volume string, geoRep *executors.GeoReplicationRequest) error {
 		return nil
 	}
@@ -248,6 +263,10 @@ func (m *MockExecutor) BlockVolumeDestroy(host string, blockHostingVolumeName st
 	return m.MockBlockVolumeDestroy(host, blockHostingVolumeName, blockVolumeName)
 }
 
+func (m *MockExecutor) BlockVolumeModifyAuth(host string, blockHostingVolumeName string, blockVolumeName string, auth bool) (*executors.BlockVolumeInfo, error) {
+	return m.MockBlockVolumeModifyAuth(host, blockHostingVolumeName, blockVolumeName, auth)
+}
+
 func (m *MockExecutor) GeoReplicationCreate(host, volume string, geoRep *executors.GeoReplicationRequest) error {
 	return m.MockGeoReplicationCreate(host, volume, geoRep)
 }
@@ -0,0 +1,175 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package planexec
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+)
+
+// Command is a command the plan would run on a host.
+type Command struct {
+	Host    string `json:"host"`
+	Command string `json:"command"`
+}
+
+// PlanExecutor builds the commands the ssh and kubernetes executors
+// would run to change the nodes, and captures them instead of running
+// them: each command succeeds with an empty output. The commands that
+// only query the nodes are passed to the executor it wraps, the plan
+// of some changes depending on the state of the nodes.
+type PlanExecutor struct {
+	cmdexec.CmdExecutor
+
+	queries              executors.Executor
+	snapShotLimit        int
+	rebalanceOnExpansion bool
+
+	lock     sync.Mutex
+	commands []Command
+}
+
+func NewPlanExecutor(queries executors.Executor,
+	config *cmdexec.CmdConfig) *PlanExecutor {
+
+	p := &PlanExecutor{
+		queries:              queries,
+		snapShotLimit:        config.SnapShotLimit,
+		rebalanceOnExpansion: config.RebalanceOnExpansion,
+	}
+	p.RemoteExecutor = p
+	p.InitThrottle()
+	p.Configure(config)
+	p.Fstab = config.Fstab
+	if p.Fstab == "" {
+		p.Fstab = "/etc/fstab"
+	}
+	return p
+}
+
+// Commands returns the commands captured so far, in the order they
+// would have been run.
+func (p *PlanExecutor) Commands() []Command {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]Command{}, p.commands...)
+}
+
+func (p *PlanExecutor) RemoteCommandExecute(ctx context.Context,
+	host string, commands []string, timeoutMinutes int) ([]string, error) {
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, command := range commands {
+		p.commands = append(p.commands, Command{
+			Host:    host,
+			Command: command,
+		})
+	}
+	return make([]string, len(commands)), nil
+}
+
+func (p *PlanExecutor) RebalanceOnExpansion() bool {
+	return p.rebalanceOnExpansion
+}
+
+func (p *PlanExecutor) SnapShotLimit() int {
+	return p.snapShotLimit
+}
+
+func (p *PlanExecutor) GlusterdCheck(host string) error {
+	return p.queries.GlusterdCheck(host)
+}
+
+func (p *PlanExecutor) GetDeviceInfo(host, device, vgid string) (*executors.DeviceInfo, error) {
+	return p.queries.GetDeviceInfo(host, device, vgid)
+}
+
+func (p *PlanExecutor) BrickDestroyCheck(host string,
+	brick *executors.BrickRequest) error {
+
+	return p.queries.BrickDestroyCheck(host, brick)
+}
+
+func (p *PlanExecutor) VolumeDestroyCheck(host, volume string) error {
+	return p.queries.VolumeDestroyCheck(host, volume)
+}
+
+func (p *PlanExecutor) VolumeInfo(host string, volume string) (*executors.Volume, error) {
+	return p.queries.VolumeInfo(host, volume)
+}
+
+func (p *PlanExecutor) HealInfo(host string, volume string) (*executors.HealInfo, error) {
+	return p.queries.HealInfo(host, volume)
+}
+
+func (p *PlanExecutor) GeoReplicationVolumeStatus(host, volume string) (
+	*executors.GeoReplicationStatus, error) {
+
+	return p.queries.GeoReplicationVolumeStatus(host, volume)
+}
+
+func (p *PlanExecutor) GeoReplicationStatus(host string) (
+	*executors.GeoReplicationStatus, error) {
+
+	return p.queries.GeoReplicationStatus(host)
+}
+
+// The commands below need the output of a change to go on, they can
+// not be planned.
+
+func (p *PlanExecutor) DeviceSetup(host, device, vgid string) (*executors.DeviceInfo, error) {
+	return nil, errors.New("Device setup can not be planned")
+}
+
+func (p *PlanExecutor) BlockVolumeCreate(host string,
+	blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
+
+	return nil, errors.New("Block volume create can not be planned")
+}
+
+func (p *PlanExecutor) BlockVolumeDestroy(host string,
+	blockHostingVolumeName string, blockVolumeName string) error {
+
+	return errors.New("Block volume destroy can not be planned")
+}
+
+func (p *PlanExecutor) BlockVolumeModifyAuth(host string,
+	blockHostingVolumeName string, blockVolumeName string,
+	auth bool) (*executors.BlockVolumeInfo, error) {
+
+	return nil, errors.New("Block volume auth change can not be planned")
+}
+
+func (p *PlanExecutor) SshdControl(host string, action string) error {
+	return nil
+}
+
+func (p *PlanExecutor) GeoReplicationCreate(host, volume string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	return errors.New("Geo-replication can not be planned")
+}
+
+func (p *PlanExecutor) GeoReplicationConfig(host, volume string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	return errors.New("Geo-replication can not be planned")
+}
+
+func (p *PlanExecutor) GeoReplicationAction(host, volume, action string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	return errors.New("Geo-replication can not be planned")
+}
@@ -0,0 +1,67 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package planexec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/cmdexec"
+	"github.com/chinacoolhacker/heketi/executors/mockexec"
+	"github.com/heketi/tests"
+)
+
+func TestPlanExecutorCommands(t *testing.T) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil)
+	p := NewPlanExecutor(m, &cmdexec.CmdConfig{RebalanceOnExpansion: true})
+
+	_, err = p.VolumeExpand("host1", &executors.VolumeRequest{
+		Name:    "vol1",
+		Type:    executors.DurabilityNone,
+		Bricks:  []executors.BrickInfo{{Host: "host2", Path: "/brick1"}},
+		Replica: 1,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = p.VolumeDestroy("host3", "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	commands := p.Commands()
+	tests.Assert(t, len(commands) == 4, "got:", commands)
+	tests.Assert(t, commands[0].Host == "host1")
+	tests.Assert(t, strings.Contains(commands[0].Command, "add-brick vol1 host2:/brick1"),
+		"got:", commands[0])
+	tests.Assert(t, commands[1].Command ==
+		"gluster --mode=script volume rebalance vol1 start", "got:", commands[1])
+	tests.Assert(t, commands[2].Host == "host3")
+	tests.Assert(t, commands[3].Command == "gluster --mode=script volume delete vol1",
+		"got:", commands[3])
+}
+
+func TestPlanExecutorQueries(t *testing.T) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil)
+	m.MockVolumeDestroyCheck = func(host, volume string) error {
+		return errors.New("snapshots")
+	}
+	p := NewPlanExecutor(m, &cmdexec.CmdConfig{})
+
+	// queries go to the nodes and are not part of the plan
+	err = p.VolumeDestroyCheck("host1", "vol1")
+	tests.Assert(t, err != nil && err.Error() == "snapshots", "got:", err)
+	_, err = p.VolumeInfo("host1", "vol1")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(p.Commands()) == 0)
+
+	_, err = p.DeviceSetup("host1", "/dev/sdb", "vg1")
+	tests.Assert(t, err != nil)
+}
@@ -0,0 +1,334 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package recordexec
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+)
+
+var (
+	logger = utils.NewLogger("[recordexec]", utils.LEVEL_DEBUG)
+)
+
+// Call is the record of one call made to an executor. Recordings are
+// made of one JSON encoded call per line.
+type Call struct {
+	Method string `json:"method"`
+	// the arguments of the call, as a JSON array
+	Args   json.RawMessage `json:"args"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	// kind of the error, when it is an executor error of a known kind
+	ErrorKind string        `json:"error_kind,omitempty"`
+	Started   time.Time     `json:"started"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// recorder writes the calls of all the copies of a recording executor.
+type recorder struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+// RecordingExecutor passes all the calls to the executor it wraps and
+// records them, with their arguments and results, to a writer. The
+// passwords of the block volumes are left out of the recorded results.
+type RecordingExecutor struct {
+	executor executors.Executor
+	rec      *recorder
+}
+
+func NewRecordingExecutor(executor executors.Executor,
+	w io.Writer) *RecordingExecutor {
+
+	return &RecordingExecutor{
+		executor: executor,
+		rec:      &recorder{enc: json.NewEncoder(w)},
+	}
+}
+
+// WithContext returns a copy of the executor, recording to the same
+// writer, whose wrapped executor is bound to ctx.
+func (r *RecordingExecutor) WithContext(ctx context.Context) executors.Executor {
+	c := *r
+	c.executor = executors.WithContext(ctx, r.executor)
+	return &c
+}
+
+// record writes a call. A call that could not be recorded is logged
+// but does not fail the call itself.
+func (r *RecordingExecutor) record(method string, started time.Time,
+	args []interface{}, result interface{}, err error) {
+
+	call := Call{
+		Method:   method,
+		Started:  started,
+		Duration: time.Since(started),
+	}
+	var e error
+	if call.Args, e = json.Marshal(args); e != nil {
+		logger.LogError("Unable to record arguments of %v: %v", method, e)
+		return
+	}
+	if err != nil {
+		call.Error = err.Error()
+		if kind := executors.KindOf(err); kind != executors.ErrorUnknown {
+			call.ErrorKind = kind.String()
+		}
+	} else if result != nil {
+		if call.Result, e = json.Marshal(result); e != nil {
+			logger.LogError("Unable to record result of %v: %v", method, e)
+			return
+		}
+	}
+
+	r.rec.lock.Lock()
+	defer r.rec.lock.Unlock()
+	if e := r.rec.enc.Encode(&call); e != nil {
+		logger.LogError("Unable to record call to %v: %v", method, e)
+	}
+}
+
+// withoutPassword returns a copy of the block volume b without its
+// password, so that the recordings collected from the users do not
+// hold the CHAP secrets of their volumes.
+func withoutPassword(b *executors.BlockVolumeInfo) *executors.BlockVolumeInfo {
+	if b == nil {
+		return nil
+	}
+	c := *b
+	c.Password = ""
+	return &c
+}
+
+func (r *RecordingExecutor) SetLogLevel(level string) {
+	r.executor.SetLogLevel(level)
+}
+
+func (r *RecordingExecutor) GlusterdCheck(host string) error {
+	started := time.Now()
+	err := r.executor.GlusterdCheck(host)
+	r.record("GlusterdCheck", started, []interface{}{host}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) PeerProbe(exec_host, newnode string) error {
+	started := time.Now()
+	err := r.executor.PeerProbe(exec_host, newnode)
+	r.record("PeerProbe", started, []interface{}{exec_host, newnode}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) PeerDetach(exec_host, detachnode string) error {
+	started := time.Now()
+	err := r.executor.PeerDetach(exec_host, detachnode)
+	r.record("PeerDetach", started, []interface{}{exec_host, detachnode}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) DeviceSetup(host, device, vgid string) (*executors.DeviceInfo, error) {
+	started := time.Now()
+	d, err := r.executor.DeviceSetup(host, device, vgid)
+	r.record("DeviceSetup", started, []interface{}{host, device, vgid}, d, err)
+	return d, err
+}
+
+func (r *RecordingExecutor) GetDeviceInfo(host, device, vgid string) (*executors.DeviceInfo, error) {
+	started := time.Now()
+	d, err := r.executor.GetDeviceInfo(host, device, vgid)
+	r.record("GetDeviceInfo", started, []interface{}{host, device, vgid}, d, err)
+	return d, err
+}
+
+func (r *RecordingExecutor) DeviceTeardown(host, device, vgid string) error {
+	started := time.Now()
+	err := r.executor.DeviceTeardown(host, device, vgid)
+	r.record("DeviceTeardown", started, []interface{}{host, device, vgid}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) BrickCreate(host string,
+	brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+
+	started := time.Now()
+	b, err := r.executor.BrickCreate(host, brick)
+	r.record("BrickCreate", started, []interface{}{host, brick}, b, err)
+	return b, err
+}
+
+func (r *RecordingExecutor) BrickDestroy(host string,
+	brick *executors.BrickRequest) error {
+
+	started := time.Now()
+	err := r.executor.BrickDestroy(host, brick)
+	r.record("BrickDestroy", started, []interface{}{host, brick}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) BrickDestroyCheck(host string,
+	brick *executors.BrickRequest) error {
+
+	started := time.Now()
+	err := r.executor.BrickDestroyCheck(host, brick)
+	r.record("BrickDestroyCheck", started, []interface{}{host, brick}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) VolumeCreate(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	started := time.Now()
+	v, err := r.executor.VolumeCreate(host, volume)
+	r.record("VolumeCreate", started, []interface{}{host, volume}, v, err)
+	return v, err
+}
+
+func (r *RecordingExecutor) VolumeDestroy(host string, volume string) error {
+	started := time.Now()
+	err := r.executor.VolumeDestroy(host, volume)
+	r.record("VolumeDestroy", started, []interface{}{host, volume}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) VolumeDestroyCheck(host, volume string) error {
+	started := time.Now()
+	err := r.executor.VolumeDestroyCheck(host, volume)
+	r.record("VolumeDestroyCheck", started, []interface{}{host, volume}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) VolumeExpand(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	started := time.Now()
+	v, err := r.executor.VolumeExpand(host, volume)
+	r.record("VolumeExpand", started, []interface{}{host, volume}, v, err)
+	return v, err
+}
+
+func (r *RecordingExecutor) VolumeReplaceBrick(host string, volume string,
+	oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+
+	started := time.Now()
+	err := r.executor.VolumeReplaceBrick(host, volume, oldBrick, newBrick)
+	r.record("VolumeReplaceBrick", started,
+		[]interface{}{host, volume, oldBrick, newBrick}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) VolumeInfo(host string, volume string) (*executors.Volume, error) {
+	started := time.Now()
+	v, err := r.executor.VolumeInfo(host, volume)
+	r.record("VolumeInfo", started, []interface{}{host, volume}, v, err)
+	return v, err
+}
+
+func (r *RecordingExecutor) GeoReplicationCreate(host, volume string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	started := time.Now()
+	err := r.executor.GeoReplicationCreate(host, volume, geoRep)
+	r.record("GeoReplicationCreate", started,
+		[]interface{}{host, volume, geoRep}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) GeoReplicationConfig(host, volume string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	started := time.Now()
+	err := r.executor.GeoReplicationConfig(host, volume, geoRep)
+	r.record("GeoReplicationConfig", started,
+		[]interface{}{host, volume, geoRep}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) GeoReplicationAction(host, volume, action string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	started := time.Now()
+	err := r.executor.GeoReplicationAction(host, volume, action, geoRep)
+	r.record("GeoReplicationAction", started,
+		[]interface{}{host, volume, action, geoRep}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) GeoReplicationVolumeStatus(host, volume string) (
+	*executors.GeoReplicationStatus, error) {
+
+	started := time.Now()
+	s, err := r.executor.GeoReplicationVolumeStatus(host, volume)
+	r.record("GeoReplicationVolumeStatus", started,
+		[]interface{}{host, volume}, s, err)
+	return s, err
+}
+
+func (r *RecordingExecutor) GeoReplicationStatus(host string) (
+	*executors.GeoReplicationStatus, error) {
+
+	started := time.Now()
+	s, err := r.executor.GeoReplicationStatus(host)
+	r.record("GeoReplicationStatus", started, []interface{}{host}, s, err)
+	return s, err
+}
+
+func (r *RecordingExecutor) HealInfo(host string, volume string) (*executors.HealInfo, error) {
+	started := time.Now()
+	h, err := r.executor.HealInfo(host, volume)
+	r.record("HealInfo", started, []interface{}{host, volume}, h, err)
+	return h, err
+}
+
+func (r *RecordingExecutor) BlockVolumeCreate(host string,
+	blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
+
+	started := time.Now()
+	b, err := r.executor.BlockVolumeCreate(host, blockVolume)
+	r.record("BlockVolumeCreate", started,
+		[]interface{}{host, blockVolume}, withoutPassword(b), err)
+	return b, err
+}
+
+func (r *RecordingExecutor) BlockVolumeDestroy(host string,
+	blockHostingVolumeName string, blockVolumeName string) error {
+
+	started := time.Now()
+	err := r.executor.BlockVolumeDestroy(host, blockHostingVolumeName, blockVolumeName)
+	r.record("BlockVolumeDestroy", started,
+		[]interface{}{host, blockHostingVolumeName, blockVolumeName}, nil, err)
+	return err
+}
+
+func (r *RecordingExecutor) BlockVolumeModifyAuth(host string,
+	blockHostingVolumeName string, blockVolumeName string,
+	auth bool) (*executors.BlockVolumeInfo, error) {
+
+	started := time.Now()
+	b, err := r.executor.BlockVolumeModifyAuth(host,
+		blockHostingVolumeName, blockVolumeName, auth)
+	r.record("BlockVolumeModifyAuth", started,
+		[]interface{}{host, blockHostingVolumeName, blockVolumeName, auth},
+		withoutPassword(b), err)
+	return b, err
+}
+
+func (r *RecordingExecutor) SshdControl(host string, action string) error {
+	started := time.Now()
+	err := r.executor.SshdControl(host, action)
+	r.record("SshdControl", started, []interface{}{host, action}, nil, err)
+	return err
+}
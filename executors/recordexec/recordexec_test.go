@@ -0,0 +1,225 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package recordexec
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/mockexec"
+	"github.com/heketi/tests"
+)
+
+func recordCalls(t *testing.T) *bytes.Buffer {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	m.MockDeviceSetup = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+		return &executors.DeviceInfo{Size: 1000, ExtentSize: 4096}, nil
+	}
+	m.MockVolumeDestroy = func(host string, volume string) error {
+		return errors.New("volume delete: " + volume + ": failed")
+	}
+
+	var recording bytes.Buffer
+	r := NewRecordingExecutor(m, &recording)
+
+	err = r.GlusterdCheck("host1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	d, err := r.DeviceSetup("host1", "/dev/sdb", "vg1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, d.Size == 1000, "got:", d)
+	b, err := r.BrickCreate("host2", &executors.BrickRequest{
+		VgId: "vg1",
+		Name: "brick1",
+		Size: 100,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, b.Path == "/mockpath", "got:", b)
+	err = r.VolumeDestroy("host1", "vol1")
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	return &recording
+}
+
+func TestRecordingExecutor(t *testing.T) {
+	recording := recordCalls(t)
+
+	lines := strings.Split(strings.TrimSpace(recording.String()), "\n")
+	tests.Assert(t, len(lines) == 4, "got:", lines)
+	tests.Assert(t, strings.Contains(lines[0], `"method":"GlusterdCheck"`), lines[0])
+	tests.Assert(t, strings.Contains(lines[1], `"args":["host1","/dev/sdb","vg1"]`), lines[1])
+	tests.Assert(t, strings.Contains(lines[3], `"error":"volume delete: vol1: failed"`), lines[3])
+}
+
+func TestReplayExecutor(t *testing.T) {
+	p, err := NewReplayExecutor(recordCalls(t))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(p.Remaining()) == 4)
+
+	// calls are matched by method and arguments, not by order
+	err = p.VolumeDestroy("host1", "vol1")
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, err.Error() == "volume delete: vol1: failed", "got:", err)
+	b, err := p.BrickCreate("host2", &executors.BrickRequest{
+		VgId: "vg1",
+		Name: "brick1",
+		Size: 100,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, b.Path == "/mockpath", "got:", b)
+	d, err := p.DeviceSetup("host1", "/dev/sdb", "vg1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, d.Size == 1000 && d.ExtentSize == 4096, "got:", d)
+
+	remaining := p.Remaining()
+	tests.Assert(t, len(remaining) == 1, "got:", remaining)
+	tests.Assert(t, remaining[0].Method == "GlusterdCheck", "got:", remaining)
+	err = p.GlusterdCheck("host1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(p.Remaining()) == 0)
+
+	// a call is only replayed once
+	err = p.GlusterdCheck("host1")
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// and calls with other arguments were not recorded
+	_, err = p.DeviceSetup("host1", "/dev/sdc", "vg2")
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "No recorded call to DeviceSetup"),
+		"got:", err)
+}
+
+func TestReplayExecutorBadRecording(t *testing.T) {
+	_, err := NewReplayExecutor(strings.NewReader(`{"method":"GlusterdCheck"`))
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestRecordingExecutorPasswords(t *testing.T) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	m.MockBlockVolumeCreate = func(host string,
+		blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
+		return &executors.BlockVolumeInfo{
+			Name:     blockVolume.Name,
+			Username: "user1",
+			Password: "chapsecret1",
+		}, nil
+	}
+	m.MockBlockVolumeModifyAuth = func(host string, blockHostingVolumeName string,
+		blockVolumeName string, auth bool) (*executors.BlockVolumeInfo, error) {
+		return &executors.BlockVolumeInfo{
+			Name:     blockVolumeName,
+			Username: "user1",
+			Password: "chapsecret2",
+		}, nil
+	}
+
+	var recording bytes.Buffer
+	r := NewRecordingExecutor(m, &recording)
+	b, err := r.BlockVolumeCreate("host1", &executors.BlockVolumeRequest{
+		Name: "blk1",
+		Auth: true,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, b.Password == "chapsecret1", "got:", b)
+	b, err = r.BlockVolumeModifyAuth("host1", "vol1", "blk1", true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, b.Password == "chapsecret2", "got:", b)
+
+	// the callers get the passwords, the recording does not
+	tests.Assert(t, !strings.Contains(recording.String(), "chapsecret"),
+		recording.String())
+	tests.Assert(t, strings.Count(recording.String(), `"Username":"user1"`) == 2,
+		recording.String())
+}
+
+func TestReplayExecutorIds(t *testing.T) {
+	recordedId := "0123456789abcdef0123456789abcdef"
+	replayedId := "fedcba9876543210fedcba9876543210"
+	otherId := "00000000000000000000000000000001"
+
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	m.MockBrickCreate = func(host string,
+		brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+		return &executors.BrickInfo{Path: brick.Path}, nil
+	}
+	var recording bytes.Buffer
+	r := NewRecordingExecutor(m, &recording)
+	for _, size := range []uint64{100, 200} {
+		_, err = r.BrickCreate("host1", &executors.BrickRequest{
+			VgId: "vg1",
+			Name: recordedId,
+			Path: "/var/lib/heketi/mounts/vg_vg1/brick_" + recordedId + "/brick",
+			Size: size,
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	err = r.BrickDestroy("host1", &executors.BrickRequest{VgId: "vg1", Name: recordedId})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the ids generated by heketi differ from the recorded ones, the
+	// results have the ids of the replay
+	p, err := NewReplayExecutor(&recording)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	b, err := p.BrickCreate("host1", &executors.BrickRequest{
+		VgId: "vg1",
+		Name: replayedId,
+		Path: "/var/lib/heketi/mounts/vg_vg1/brick_" + replayedId + "/brick",
+		Size: 200,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, b.Path == "/var/lib/heketi/mounts/vg_vg1/brick_"+replayedId+"/brick",
+		"got:", b)
+
+	// an id is the same recorded one in all the calls
+	err = p.BrickDestroy("host1", &executors.BrickRequest{VgId: "vg1", Name: otherId})
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = p.BrickDestroy("host1", &executors.BrickRequest{VgId: "vg1", Name: replayedId})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// and the calls to other hosts do not match
+	_, err = p.BrickCreate("host2", &executors.BrickRequest{
+		VgId: "vg1",
+		Name: replayedId,
+		Path: "/var/lib/heketi/mounts/vg_vg1/brick_" + replayedId + "/brick",
+		Size: 100,
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, len(p.Remaining()) == 1, "got:", p.Remaining())
+}
+
+func TestReplayExecutorErrors(t *testing.T) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	m.MockSshdControl = func(host, action string) error {
+		return executors.ErrSshdInUse
+	}
+	m.MockVolumeDestroy = func(host string, volume string) error {
+		return executors.NewError(executors.ErrorNotFound, host,
+			"Volume %v does not exist", volume)
+	}
+	var recording bytes.Buffer
+	r := NewRecordingExecutor(m, &recording)
+	r.SshdControl("host1", "stop")
+	r.VolumeDestroy("host1", "vol1")
+
+	// the errors the callers look for are replayed
+	p, err := NewReplayExecutor(&recording)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = p.SshdControl("host1", "stop")
+	tests.Assert(t, err == executors.ErrSshdInUse, "got:", err)
+	err = p.VolumeDestroy("host1", "vol1")
+	tests.Assert(t, executors.KindOf(err) == executors.ErrorNotFound, "got:", err)
+	tests.Assert(t, err.Error() == "Volume vol1 does not exist", "got:", err)
+}
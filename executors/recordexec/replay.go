@@ -0,0 +1,384 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package recordexec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/chinacoolhacker/heketi/executors"
+)
+
+var (
+	// ids generated by heketi, such as the ones in the names of the
+	// bricks and volumes
+	idRegexp = regexp.MustCompile(`[0-9a-f]{32,}`)
+
+	// errors of the executors the callers compare the errors with
+	sentinelErrors = []error{
+		executors.ErrSshdInUse,
+		executors.ErrSshdNotSupported,
+	}
+)
+
+// ReplayExecutor serves the results of a recording made by a
+// RecordingExecutor instead of sending commands to nodes. Each call is
+// answered by the first recorded call, not yet replayed, to the same
+// method and host whose other arguments are the same but for the ids
+// generated by heketi. The ids of a replayed call are those of the
+// recorded one in the results and errors it returns, and must match
+// the same recorded ids in all the calls. Calls made concurrently to
+// different hosts can thus be replayed in a different order than they
+// were recorded. Calls that were not recorded fail.
+//
+// Recorded errors are returned as the executor errors of the same kind,
+// or the same errors for the ones, such as ErrSshdInUse, that callers
+// compare errors with. The passwords of the block volumes are not
+// recorded, hence not replayed.
+type ReplayExecutor struct {
+	lock  sync.Mutex
+	calls []*replayCall
+	// ids of the recording by id of the replay, and the reverse
+	recordedIds map[string]string
+	replayedIds map[string]string
+}
+
+type replayCall struct {
+	Call
+	host string
+	// arguments in a canonical JSON form
+	args     string
+	replayed bool
+}
+
+func NewReplayExecutor(r io.Reader) (*ReplayExecutor, error) {
+	p := &ReplayExecutor{
+		recordedIds: map[string]string{},
+		replayedIds: map[string]string{},
+	}
+	dec := json.NewDecoder(r)
+	for {
+		c := &replayCall{}
+		err := dec.Decode(&c.Call)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Unable to read recording: %v", err)
+		}
+		var args []interface{}
+		if err := json.Unmarshal(c.Args, &args); err != nil {
+			return nil, fmt.Errorf("Unable to read arguments of %v: %v",
+				c.Method, err)
+		}
+		c.host, c.args, err = canonicalArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		p.calls = append(p.calls, c)
+	}
+	return p, nil
+}
+
+// canonicalArgs returns the host args starts with, if any, and args
+// as JSON encoded once decoded, so that the arguments of the calls can
+// be compared the way they were recorded.
+func canonicalArgs(args []interface{}) (string, string, error) {
+	b, err := json.Marshal(args)
+	if err != nil {
+		return "", "", err
+	}
+	var decoded []interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return "", "", err
+	}
+	if b, err = json.Marshal(decoded); err != nil {
+		return "", "", err
+	}
+	host := ""
+	if len(decoded) != 0 {
+		host, _ = decoded[0].(string)
+	}
+	return host, string(b), nil
+}
+
+// Remaining returns the recorded calls that have not been replayed.
+func (p *ReplayExecutor) Remaining() []Call {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	remaining := []Call{}
+	for _, c := range p.calls {
+		if !c.replayed {
+			remaining = append(remaining, c.Call)
+		}
+	}
+	return remaining
+}
+
+// matchIds returns the ids of the replay by id of the recording if
+// the arguments of the recorded call are the ones of the replayed call
+// with their ids replaced by ones matching the ids of the previous
+// calls, nil otherwise.
+func (p *ReplayExecutor) matchIds(recorded, replayed string) map[string]string {
+	if idRegexp.ReplaceAllString(recorded, "<id>") !=
+		idRegexp.ReplaceAllString(replayed, "<id>") {
+		return nil
+	}
+	recordedIds := idRegexp.FindAllString(recorded, -1)
+	replayedIds := idRegexp.FindAllString(replayed, -1)
+	ids := map[string]string{}
+	for i, id := range recordedIds {
+		replayedId := replayedIds[i]
+		if mapped, ok := ids[id]; ok && mapped != replayedId {
+			return nil
+		}
+		if mapped, ok := p.replayedIds[id]; ok && mapped != replayedId {
+			return nil
+		}
+		if mapped, ok := p.recordedIds[replayedId]; ok && mapped != id {
+			return nil
+		}
+		ids[id] = replayedId
+	}
+	return ids
+}
+
+// replaceIds returns s with the ids of the recording replaced by those
+// of the replay.
+func (p *ReplayExecutor) replaceIds(s string) string {
+	return idRegexp.ReplaceAllStringFunc(s, func(id string) string {
+		if replayedId, ok := p.replayedIds[id]; ok {
+			return replayedId
+		}
+		return id
+	})
+}
+
+// replayError returns the error of the recorded call c.
+func (p *ReplayExecutor) replayError(c *replayCall) error {
+	message := p.replaceIds(c.Error)
+	for _, err := range sentinelErrors {
+		if err.Error() == message {
+			return err
+		}
+	}
+	if kind := executors.ParseErrorKind(c.ErrorKind); kind != executors.ErrorUnknown {
+		return &executors.Error{
+			Kind:    kind,
+			Host:    c.host,
+			Message: message,
+		}
+	}
+	return errors.New(message)
+}
+
+// replay finds the recorded call and sets result from it. The returned
+// error is the one of the recorded call.
+func (p *ReplayExecutor) replay(method string,
+	args []interface{}, result interface{}) error {
+
+	host, replayed, err := canonicalArgs(args)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, c := range p.calls {
+		if c.replayed || c.Method != method || c.host != host {
+			continue
+		}
+		ids := p.matchIds(c.args, replayed)
+		if ids == nil {
+			continue
+		}
+		c.replayed = true
+		for id, replayedId := range ids {
+			p.replayedIds[id] = replayedId
+			p.recordedIds[replayedId] = id
+		}
+		if c.Error != "" {
+			return p.replayError(c)
+		}
+		if result != nil && len(c.Result) != 0 {
+			err := json.Unmarshal([]byte(p.replaceIds(string(c.Result))), result)
+			if err != nil {
+				return fmt.Errorf("Unable to read result of %v: %v", method, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("No recorded call to %v with arguments %s", method, replayed)
+}
+
+func (p *ReplayExecutor) SetLogLevel(level string) {
+}
+
+func (p *ReplayExecutor) GlusterdCheck(host string) error {
+	return p.replay("GlusterdCheck", []interface{}{host}, nil)
+}
+
+func (p *ReplayExecutor) PeerProbe(exec_host, newnode string) error {
+	return p.replay("PeerProbe", []interface{}{exec_host, newnode}, nil)
+}
+
+func (p *ReplayExecutor) PeerDetach(exec_host, detachnode string) error {
+	return p.replay("PeerDetach", []interface{}{exec_host, detachnode}, nil)
+}
+
+func (p *ReplayExecutor) DeviceSetup(host, device, vgid string) (*executors.DeviceInfo, error) {
+	var d *executors.DeviceInfo
+	err := p.replay("DeviceSetup", []interface{}{host, device, vgid}, &d)
+	return d, err
+}
+
+func (p *ReplayExecutor) GetDeviceInfo(host, device, vgid string) (*executors.DeviceInfo, error) {
+	var d *executors.DeviceInfo
+	err := p.replay("GetDeviceInfo", []interface{}{host, device, vgid}, &d)
+	return d, err
+}
+
+func (p *ReplayExecutor) DeviceTeardown(host, device, vgid string) error {
+	return p.replay("DeviceTeardown", []interface{}{host, device, vgid}, nil)
+}
+
+func (p *ReplayExecutor) BrickCreate(host string,
+	brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+
+	var b *executors.BrickInfo
+	err := p.replay("BrickCreate", []interface{}{host, brick}, &b)
+	return b, err
+}
+
+func (p *ReplayExecutor) BrickDestroy(host string,
+	brick *executors.BrickRequest) error {
+
+	return p.replay("BrickDestroy", []interface{}{host, brick}, nil)
+}
+
+func (p *ReplayExecutor) BrickDestroyCheck(host string,
+	brick *executors.BrickRequest) error {
+
+	return p.replay("BrickDestroyCheck", []interface{}{host, brick}, nil)
+}
+
+func (p *ReplayExecutor) VolumeCreate(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	var v *executors.Volume
+	err := p.replay("VolumeCreate", []interface{}{host, volume}, &v)
+	return v, err
+}
+
+func (p *ReplayExecutor) VolumeDestroy(host string, volume string) error {
+	return p.replay("VolumeDestroy", []interface{}{host, volume}, nil)
+}
+
+func (p *ReplayExecutor) VolumeDestroyCheck(host, volume string) error {
+	return p.replay("VolumeDestroyCheck", []interface{}{host, volume}, nil)
+}
+
+func (p *ReplayExecutor) VolumeExpand(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	var v *executors.Volume
+	err := p.replay("VolumeExpand", []interface{}{host, volume}, &v)
+	return v, err
+}
+
+func (p *ReplayExecutor) VolumeReplaceBrick(host string, volume string,
+	oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+
+	return p.replay("VolumeReplaceBrick",
+		[]interface{}{host, volume, oldBrick, newBrick}, nil)
+}
+
+func (p *ReplayExecutor) VolumeInfo(host string, volume string) (*executors.Volume, error) {
+	var v *executors.Volume
+	err := p.replay("VolumeInfo", []interface{}{host, volume}, &v)
+	return v, err
+}
+
+func (p *ReplayExecutor) GeoReplicationCreate(host, volume string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	return p.replay("GeoReplicationCreate",
+		[]interface{}{host, volume, geoRep}, nil)
+}
+
+func (p *ReplayExecutor) GeoReplicationConfig(host, volume string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	return p.replay("GeoReplicationConfig",
+		[]interface{}{host, volume, geoRep}, nil)
+}
+
+func (p *ReplayExecutor) GeoReplicationAction(host, volume, action string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	return p.replay("GeoReplicationAction",
+		[]interface{}{host, volume, action, geoRep}, nil)
+}
+
+func (p *ReplayExecutor) GeoReplicationVolumeStatus(host, volume string) (
+	*executors.GeoReplicationStatus, error) {
+
+	var s *executors.GeoReplicationStatus
+	err := p.replay("GeoReplicationVolumeStatus",
+		[]interface{}{host, volume}, &s)
+	return s, err
+}
+
+func (p *ReplayExecutor) GeoReplicationStatus(host string) (
+	*executors.GeoReplicationStatus, error) {
+
+	var s *executors.GeoReplicationStatus
+	err := p.replay("GeoReplicationStatus", []interface{}{host}, &s)
+	return s, err
+}
+
+func (p *ReplayExecutor) HealInfo(host string, volume string) (*executors.HealInfo, error) {
+	var h *executors.HealInfo
+	err := p.replay("HealInfo", []interface{}{host, volume}, &h)
+	return h, err
+}
+
+func (p *ReplayExecutor) BlockVolumeCreate(host string,
+	blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
+
+	var b *executors.BlockVolumeInfo
+	err := p.replay("BlockVolumeCreate", []interface{}{host, blockVolume}, &b)
+	return b, err
+}
+
+func (p *ReplayExecutor) BlockVolumeDestroy(host string,
+	blockHostingVolumeName string, blockVolumeName string) error {
+
+	return p.replay("BlockVolumeDestroy",
+		[]interface{}{host, blockHostingVolumeName, blockVolumeName}, nil)
+}
+
+func (p *ReplayExecutor) BlockVolumeModifyAuth(host string,
+	blockHostingVolumeName string, blockVolumeName string,
+	auth bool) (*executors.BlockVolumeInfo, error) {
+
+	var b *executors.BlockVolumeInfo
+	err := p.replay("BlockVolumeModifyAuth",
+		[]interface{}{host, blockHostingVolumeName, blockVolumeName, auth}, &b)
+	return b, err
+}
+
+func (p *ReplayExecutor) SshdControl(host string, action string) error {
+	return p.replay("SshdControl", []interface{}{host, action}, nil)
+}
@@ -0,0 +1,248 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package retryexec
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/chinacoolhacker/heketi/pkg/utils/ssh"
+)
+
+var (
+	logger = utils.NewLogger("[retryexec]", utils.LEVEL_DEBUG)
+
+	// Parts of the messages of errors raised when a node could not be
+	// reached, as opposed to a command that ran and failed, for the
+	// errors whose kind is not known.
+	transientMessages = []string{
+		"connection refused",
+		"connection reset",
+		"connection timed out",
+		"no route to host",
+		"network is unreachable",
+		"i/o timeout",
+		"broken pipe",
+		"ssh: handshake failed: EOF",
+		"stream error",
+		"stream reset",
+		"error dialing backend",
+		"Unable to setup a session with",
+	}
+
+	// Parts of the messages of the errors of ssh handshakes rejected
+	// by heketi or the node, which are not retried even though the
+	// messages above may match them.
+	permanentMessages = []string{
+		"ssh: unable to authenticate",
+		"Host key ",
+	}
+)
+
+type RetryConfig struct {
+	// tries of an idempotent command, retries are disabled below two
+	Attempts int `json:"attempts"`
+	// delay before the first retry, doubled after each retry up to
+	// MaxDelay
+	InitialDelay int `json:"initial_delay_ms"`
+	MaxDelay     int `json:"max_delay_ms"`
+}
+
+// RetryExecutor retries the idempotent commands of the executor it
+// wraps when they fail for a transient reason, such as a node that
+// could not be reached, waiting longer after each attempt. The other
+// commands are passed through as is.
+type RetryExecutor struct {
+	executors.Executor
+
+	attempts     int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	ctx          context.Context
+}
+
+func NewRetryExecutor(executor executors.Executor,
+	config *RetryConfig) *RetryExecutor {
+
+	r := &RetryExecutor{
+		Executor:     executor,
+		attempts:     config.Attempts,
+		initialDelay: time.Duration(config.InitialDelay) * time.Millisecond,
+		maxDelay:     time.Duration(config.MaxDelay) * time.Millisecond,
+		ctx:          context.Background(),
+	}
+	if r.initialDelay == 0 {
+		r.initialDelay = 500 * time.Millisecond
+	}
+	if r.maxDelay == 0 {
+		r.maxDelay = 30 * time.Second
+	}
+	if r.maxDelay < r.initialDelay {
+		r.maxDelay = r.initialDelay
+	}
+	return r
+}
+
+// IsTransient returns true if err means the command could not be sent
+// to the node, rather than that it ran and failed.
+func IsTransient(err error) bool {
+	if err == nil || err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	if _, ok := err.(*ssh.HostKeyError); ok {
+		return false
+	}
+	msg := err.Error()
+	for _, m := range permanentMessages {
+		if strings.Contains(msg, m) {
+			return false
+		}
+	}
+	if executors.KindOf(err) == executors.ErrorUnreachable {
+		return true
+	}
+	if nerr, ok := err.(net.Error); ok && (nerr.Timeout() || nerr.Temporary()) {
+		return true
+	}
+	if _, ok := err.(*net.OpError); ok {
+		return true
+	}
+	for _, m := range transientMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithContext returns a copy of the executor bound to ctx. The wrapped
+// executor is bound to ctx too and no retry is attempted once ctx is
+// done.
+func (r *RetryExecutor) WithContext(ctx context.Context) executors.Executor {
+	c := *r
+	c.Executor = executors.WithContext(ctx, r.Executor)
+	c.ctx = ctx
+	return &c
+}
+
+// retry calls f until it succeeds, fails for a reason that is not
+// transient or the attempts are exhausted.
+func (r *RetryExecutor) retry(label, host string, f func() error) error {
+	delay := r.initialDelay
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= r.attempts || !IsTransient(err) {
+			return err
+		}
+		logger.Warning("%v on %v failed, retrying in %v (%v/%v): %v",
+			label, host, delay, attempt, r.attempts-1, err)
+		select {
+		case <-time.After(delay):
+		case <-r.ctx.Done():
+			return err
+		}
+		delay *= 2
+		if delay > r.maxDelay {
+			delay = r.maxDelay
+		}
+	}
+}
+
+func (r *RetryExecutor) GlusterdCheck(host string) error {
+	return r.retry("GlusterdCheck", host, func() error {
+		return r.Executor.GlusterdCheck(host)
+	})
+}
+
+func (r *RetryExecutor) GetDeviceInfo(host, device, vgid string) (
+	d *executors.DeviceInfo, err error) {
+
+	err = r.retry("GetDeviceInfo", host, func() error {
+		d, err = r.Executor.GetDeviceInfo(host, device, vgid)
+		return err
+	})
+	return
+}
+
+func (r *RetryExecutor) BrickDestroyCheck(host string,
+	brick *executors.BrickRequest) error {
+
+	return r.retry("BrickDestroyCheck", host, func() error {
+		return r.Executor.BrickDestroyCheck(host, brick)
+	})
+}
+
+func (r *RetryExecutor) VolumeDestroyCheck(host, volume string) error {
+	return r.retry("VolumeDestroyCheck", host, func() error {
+		return r.Executor.VolumeDestroyCheck(host, volume)
+	})
+}
+
+func (r *RetryExecutor) VolumeInfo(host string, volume string) (
+	v *executors.Volume, err error) {
+
+	err = r.retry("VolumeInfo", host, func() error {
+		v, err = r.Executor.VolumeInfo(host, volume)
+		return err
+	})
+	return
+}
+
+func (r *RetryExecutor) HealInfo(host string, volume string) (
+	h *executors.HealInfo, err error) {
+
+	err = r.retry("HealInfo", host, func() error {
+		h, err = r.Executor.HealInfo(host, volume)
+		return err
+	})
+	return
+}
+
+func (r *RetryExecutor) GeoReplicationVolumeStatus(host, volume string) (
+	s *executors.GeoReplicationStatus, err error) {
+
+	err = r.retry("GeoReplicationVolumeStatus", host, func() error {
+		s, err = r.Executor.GeoReplicationVolumeStatus(host, volume)
+		return err
+	})
+	return
+}
+
+func (r *RetryExecutor) GeoReplicationStatus(host string) (
+	s *executors.GeoReplicationStatus, err error) {
+
+	err = r.retry("GeoReplicationStatus", host, func() error {
+		s, err = r.Executor.GeoReplicationStatus(host)
+		return err
+	})
+	return
+}
+
+func (r *RetryExecutor) SetLogLevel(level string) {
+	switch level {
+	case "none":
+		logger.SetLevel(utils.LEVEL_NOLOG)
+	case "critical":
+		logger.SetLevel(utils.LEVEL_CRITICAL)
+	case "error":
+		logger.SetLevel(utils.LEVEL_ERROR)
+	case "warning":
+		logger.SetLevel(utils.LEVEL_WARNING)
+	case "info":
+		logger.SetLevel(utils.LEVEL_INFO)
+	case "debug":
+		logger.SetLevel(utils.LEVEL_DEBUG)
+	}
+	r.Executor.SetLogLevel(level)
+}
@@ -0,0 +1,173 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package retryexec
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/mockexec"
+	"github.com/chinacoolhacker/heketi/pkg/utils/ssh"
+	"github.com/heketi/tests"
+)
+
+func newTestRetryExecutor(t *testing.T, attempts int) (
+	*RetryExecutor, *mockexec.MockExecutor) {
+
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r := NewRetryExecutor(m, &RetryConfig{
+		Attempts:     attempts,
+		InitialDelay: 1,
+		MaxDelay:     2,
+	})
+	return r, m
+}
+
+func TestIsTransient(t *testing.T) {
+	tests.Assert(t, !IsTransient(nil))
+	tests.Assert(t, !IsTransient(context.Canceled))
+	tests.Assert(t, !IsTransient(errors.New("volume create: vol1: failed: Volume vol1 already exists")))
+	tests.Assert(t, !IsTransient(errors.New("SSH command timeout")))
+	tests.Assert(t, !IsTransient(executors.NewError(executors.ErrorNotFound, "host",
+		"Volume vol1 does not exist")))
+	tests.Assert(t, IsTransient(executors.NewError(executors.ErrorUnreachable, "host",
+		"pod of host could not be reached")))
+
+	tests.Assert(t, IsTransient(&net.OpError{Op: "dial", Err: errors.New("refused")}))
+	tests.Assert(t, IsTransient(errors.New("dial tcp 10.0.0.1:22: getsockopt: connection refused")))
+	tests.Assert(t, IsTransient(errors.New("ssh: handshake failed: EOF")))
+	tests.Assert(t, IsTransient(errors.New("Unable to get volume info of volume name: vol1: read: connection reset by peer")))
+	tests.Assert(t, IsTransient(errors.New("Unable to execute command on glusterfs-x: stream error: stream ID 3; INTERNAL_ERROR")))
+}
+
+func TestIsTransientHandshake(t *testing.T) {
+	// the handshakes rejected for the host key or the credentials are
+	// not retried
+	tests.Assert(t, !IsTransient(&ssh.HostKeyError{Host: "host", Want: "SHA256:a", Got: "SHA256:b"}))
+	tests.Assert(t, !IsTransient(errors.New("Unable to get volume info of volume name: vol1: "+
+		"ssh: handshake failed: Host key of host does not match: got SHA256:b, expected SHA256:a")))
+	tests.Assert(t, !IsTransient(errors.New("ssh: handshake failed: Host key SHA256:b of host is not known")))
+	tests.Assert(t, !IsTransient(errors.New("ssh: handshake failed: ssh: unable to authenticate, "+
+		"attempted methods [none publickey], no supported methods remain")))
+	tests.Assert(t, !IsTransient(errors.New("ssh: handshake failed: ssh: no common algorithm for key exchange")))
+
+	// the connections lost or timing out during the handshake are
+	tests.Assert(t, IsTransient(errors.New("ssh: handshake failed: EOF")))
+	tests.Assert(t, IsTransient(errors.New("ssh: handshake failed: read tcp 10.0.0.2:40000->10.0.0.1:22: read: connection reset by peer")))
+	tests.Assert(t, IsTransient(errors.New("Unable to connect to host:22: connection timed out after 30s")))
+}
+
+func TestRetryExecutorTransient(t *testing.T) {
+	r, m := newTestRetryExecutor(t, 3)
+
+	calls := 0
+	m.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		calls++
+		if calls < 3 {
+			return nil, errors.New("dial tcp: connection refused")
+		}
+		return &executors.Volume{VolumeName: volume}, nil
+	}
+	v, err := r.VolumeInfo("host", "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v.VolumeName == "vol1")
+	tests.Assert(t, calls == 3, "got:", calls)
+
+	// gives up after the last attempt
+	calls = 0
+	m.MockGlusterdCheck = func(host string) error {
+		calls++
+		return errors.New("ssh: handshake failed: EOF")
+	}
+	err = r.GlusterdCheck("host")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, calls == 3, "got:", calls)
+}
+
+func TestRetryExecutorPermanent(t *testing.T) {
+	r, m := newTestRetryExecutor(t, 3)
+
+	calls := 0
+	m.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		calls++
+		return nil, errors.New("Volume vol1 does not exist")
+	}
+	_, err := r.HealInfo("host", "vol1")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, calls == 1, "got:", calls)
+
+	// nor are the rejected host keys and credentials
+	for _, e := range []error{
+		&ssh.HostKeyError{Host: "host", Want: "SHA256:a", Got: "SHA256:b"},
+		errors.New("ssh: handshake failed: ssh: unable to authenticate, " +
+			"attempted methods [none password], no supported methods remain"),
+	} {
+		e := e
+		calls = 0
+		m.MockGlusterdCheck = func(host string) error {
+			calls++
+			return e
+		}
+		err = r.GlusterdCheck("host")
+		tests.Assert(t, err == e, "got:", err)
+		tests.Assert(t, calls == 1, "got:", calls)
+	}
+}
+
+func TestRetryExecutorNotIdempotent(t *testing.T) {
+	r, m := newTestRetryExecutor(t, 3)
+
+	calls := 0
+	m.MockVolumeCreate = func(host string, volume *executors.VolumeRequest) (*executors.Volume, error) {
+		calls++
+		return nil, errors.New("connection refused")
+	}
+	_, err := r.VolumeCreate("host", &executors.VolumeRequest{})
+	tests.Assert(t, err != nil)
+	tests.Assert(t, calls == 1, "got:", calls)
+}
+
+func TestRetryExecutorDisabled(t *testing.T) {
+	r, m := newTestRetryExecutor(t, 0)
+
+	calls := 0
+	m.MockDeviceSetup = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+		calls++
+		return nil, errors.New("connection refused")
+	}
+	_, err := r.GetDeviceInfo("host", "/dev/sdb", "vg")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, calls == 1, "got:", calls)
+}
+
+func TestRetryExecutorCancelled(t *testing.T) {
+	r, m := newTestRetryExecutor(t, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e := executors.WithContext(ctx, r)
+
+	calls := 0
+	m.MockGlusterdCheck = func(host string) error {
+		calls++
+		return errors.New("connection refused")
+	}
+	err := e.GlusterdCheck("host")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, calls == 1, "got:", calls)
+
+	// the executor it was copied from is not bound to ctx
+	calls = 0
+	err = r.GlusterdCheck("host")
+	tests.Assert(t, calls == 3, "got:", calls)
+}
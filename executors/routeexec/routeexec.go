@@ -0,0 +1,236 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// Package routeexec sends the commands of each host to the executor
+// selected for it, so that the nodes of a server can be managed by
+// different executors, for example a cluster run in Kubernetes and
+// another reached over ssh.
+package routeexec
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+)
+
+var (
+	logger = utils.NewLogger("[routeexec]", utils.LEVEL_DEBUG)
+)
+
+// routes are the names of the executors selected for the hosts. They
+// are shared by the copies of a RouteExecutor bound to a context.
+type routes struct {
+	lock  sync.RWMutex
+	hosts map[string]string
+}
+
+// RouteExecutor dispatches each call to the executor selected for the
+// host it is sent to, or to the default executor if none was selected.
+type RouteExecutor struct {
+	executor  executors.Executor
+	executors map[string]executors.Executor
+	routes    *routes
+}
+
+// NewRouteExecutor returns an executor calling executor for the hosts
+// not routed to one of the named executors.
+func NewRouteExecutor(executor executors.Executor,
+	named map[string]executors.Executor) *RouteExecutor {
+
+	return &RouteExecutor{
+		executor:  executor,
+		executors: named,
+		routes: &routes{
+			hosts: map[string]string{},
+		},
+	}
+}
+
+// Route sends the commands of host to the executor called name, or to
+// the default executor if name is empty.
+func (r *RouteExecutor) Route(host, name string) error {
+	if _, ok := r.executors[name]; name != "" && !ok {
+		return fmt.Errorf("Unknown executor %v for host %v, expected one of %v",
+			name, host, r.Names())
+	}
+
+	r.routes.lock.Lock()
+	defer r.routes.lock.Unlock()
+	if name == "" {
+		delete(r.routes.hosts, host)
+	} else {
+		r.routes.hosts[host] = name
+	}
+	logger.Debug("Host %v uses executor %v", host, name)
+	return nil
+}
+
+// Names returns the names of the executors, sorted.
+func (r *RouteExecutor) Names() []string {
+	var names []string
+	for name := range r.executors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Executor returns the executor called name, the default executor if
+// name is empty.
+func (r *RouteExecutor) Executor(name string) executors.Executor {
+	if name == "" {
+		return r.executor
+	}
+	return r.executors[name]
+}
+
+// Lookup returns the executor the commands of host are sent to.
+func (r *RouteExecutor) Lookup(host string) executors.Executor {
+	r.routes.lock.RLock()
+	name := r.routes.hosts[host]
+	r.routes.lock.RUnlock()
+	return r.Executor(name)
+}
+
+// WithContext returns a copy of the executor whose executors are all
+// bound to ctx. The copy shares the routes of the hosts.
+func (r *RouteExecutor) WithContext(ctx context.Context) executors.Executor {
+	c := *r
+	c.executor = executors.WithContext(ctx, r.executor)
+	c.executors = make(map[string]executors.Executor, len(r.executors))
+	for name, executor := range r.executors {
+		c.executors[name] = executors.WithContext(ctx, executor)
+	}
+	return &c
+}
+
+func (r *RouteExecutor) GlusterdCheck(host string) error {
+	return r.Lookup(host).GlusterdCheck(host)
+}
+
+func (r *RouteExecutor) PeerProbe(exec_host, newnode string) error {
+	return r.Lookup(exec_host).PeerProbe(exec_host, newnode)
+}
+
+func (r *RouteExecutor) PeerDetach(exec_host, detachnode string) error {
+	return r.Lookup(exec_host).PeerDetach(exec_host, detachnode)
+}
+
+func (r *RouteExecutor) DeviceSetup(host, device, vgid string) (*executors.DeviceInfo, error) {
+	return r.Lookup(host).DeviceSetup(host, device, vgid)
+}
+
+func (r *RouteExecutor) GetDeviceInfo(host, device, vgid string) (*executors.DeviceInfo, error) {
+	return r.Lookup(host).GetDeviceInfo(host, device, vgid)
+}
+
+func (r *RouteExecutor) DeviceTeardown(host, device, vgid string) error {
+	return r.Lookup(host).DeviceTeardown(host, device, vgid)
+}
+
+func (r *RouteExecutor) BrickCreate(host string,
+	brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+	return r.Lookup(host).BrickCreate(host, brick)
+}
+
+func (r *RouteExecutor) BrickDestroy(host string, brick *executors.BrickRequest) error {
+	return r.Lookup(host).BrickDestroy(host, brick)
+}
+
+func (r *RouteExecutor) BrickDestroyCheck(host string, brick *executors.BrickRequest) error {
+	return r.Lookup(host).BrickDestroyCheck(host, brick)
+}
+
+func (r *RouteExecutor) VolumeCreate(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+	return r.Lookup(host).VolumeCreate(host, volume)
+}
+
+func (r *RouteExecutor) VolumeDestroy(host string, volume string) error {
+	return r.Lookup(host).VolumeDestroy(host, volume)
+}
+
+func (r *RouteExecutor) VolumeDestroyCheck(host, volume string) error {
+	return r.Lookup(host).VolumeDestroyCheck(host, volume)
+}
+
+func (r *RouteExecutor) VolumeExpand(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+	return r.Lookup(host).VolumeExpand(host, volume)
+}
+
+func (r *RouteExecutor) VolumeReplaceBrick(host string, volume string,
+	oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+	return r.Lookup(host).VolumeReplaceBrick(host, volume, oldBrick, newBrick)
+}
+
+func (r *RouteExecutor) VolumeInfo(host string, volume string) (*executors.Volume, error) {
+	return r.Lookup(host).VolumeInfo(host, volume)
+}
+
+func (r *RouteExecutor) GeoReplicationCreate(host, volume string,
+	geoRep *executors.GeoReplicationRequest) error {
+	return r.Lookup(host).GeoReplicationCreate(host, volume, geoRep)
+}
+
+func (r *RouteExecutor) GeoReplicationConfig(host, volume string,
+	geoRep *executors.GeoReplicationRequest) error {
+	return r.Lookup(host).GeoReplicationConfig(host, volume, geoRep)
+}
+
+func (r *RouteExecutor) GeoReplicationAction(host, volume, action string,
+	geoRep *executors.GeoReplicationRequest) error {
+	return r.Lookup(host).GeoReplicationAction(host, volume, action, geoRep)
+}
+
+func (r *RouteExecutor) GeoReplicationVolumeStatus(host,
+	volume string) (*executors.GeoReplicationStatus, error) {
+	return r.Lookup(host).GeoReplicationVolumeStatus(host, volume)
+}
+
+func (r *RouteExecutor) GeoReplicationStatus(host string) (*executors.GeoReplicationStatus, error) {
+	return r.Lookup(host).GeoReplicationStatus(host)
+}
+
+func (r *RouteExecutor) HealInfo(host string, volume string) (*executors.HealInfo, error) {
+	return r.Lookup(host).HealInfo(host, volume)
+}
+
+// SetLogLevel sets the log level of all the executors.
+func (r *RouteExecutor) SetLogLevel(level string) {
+	r.executor.SetLogLevel(level)
+	for _, executor := range r.executors {
+		executor.SetLogLevel(level)
+	}
+}
+
+func (r *RouteExecutor) BlockVolumeCreate(host string,
+	blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
+	return r.Lookup(host).BlockVolumeCreate(host, blockVolume)
+}
+
+func (r *RouteExecutor) BlockVolumeDestroy(host string,
+	blockHostingVolumeName string, blockVolumeName string) error {
+	return r.Lookup(host).BlockVolumeDestroy(host, blockHostingVolumeName, blockVolumeName)
+}
+
+func (r *RouteExecutor) BlockVolumeModifyAuth(host string,
+	blockHostingVolumeName string, blockVolumeName string,
+	auth bool) (*executors.BlockVolumeInfo, error) {
+	return r.Lookup(host).BlockVolumeModifyAuth(host, blockHostingVolumeName,
+		blockVolumeName, auth)
+}
+
+func (r *RouteExecutor) SshdControl(host string, action string) error {
+	return r.Lookup(host).SshdControl(host, action)
+}
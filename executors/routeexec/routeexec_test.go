@@ -0,0 +1,67 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package routeexec
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/executors/mockexec"
+	"github.com/heketi/tests"
+)
+
+// recordingMock returns a mock executor adding the hosts it checks to
+// hosts.
+func recordingMock(t *testing.T, hosts *[]string) *mockexec.MockExecutor {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil)
+	m.MockGlusterdCheck = func(host string) error {
+		*hosts = append(*hosts, host)
+		return nil
+	}
+	m.MockPeerProbe = func(exec_host, newnode string) error {
+		*hosts = append(*hosts, exec_host)
+		return nil
+	}
+	return m
+}
+
+func TestRouteExecutor(t *testing.T) {
+	var def, kube, ssh []string
+	r := NewRouteExecutor(recordingMock(t, &def), map[string]executors.Executor{
+		"kube": recordingMock(t, &kube),
+		"ssh":  recordingMock(t, &ssh),
+	})
+	tests.Assert(t, len(r.Names()) == 2 && r.Names()[0] == "kube", r.Names())
+
+	err := r.Route("node1", "kube")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = r.Route("node2", "ssh")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = r.Route("node3", "nosuchexecutor")
+	tests.Assert(t, err != nil)
+
+	r.GlusterdCheck("node1")
+	r.GlusterdCheck("node2")
+	r.GlusterdCheck("node3")
+	r.PeerProbe("node1", "node4")
+	tests.Assert(t, len(kube) == 2 && kube[0] == "node1" && kube[1] == "node1", kube)
+	tests.Assert(t, len(ssh) == 1 && ssh[0] == "node2", ssh)
+	tests.Assert(t, len(def) == 1 && def[0] == "node3", def)
+
+	// the copies bound to a context share the routes
+	c := r.WithContext(context.Background())
+	err = r.Route("node1", "")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	c.GlusterdCheck("node1")
+	tests.Assert(t, len(def) == 2 && def[1] == "node1", def)
+	tests.Assert(t, len(kube) == 2, kube)
+}
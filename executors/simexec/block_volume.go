@@ -0,0 +1,144 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package simexec
+
+import (
+	"fmt"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+)
+
+type simBlockVolume struct {
+	info executors.BlockVolumeInfo
+}
+
+// blockVolumesSize returns the space, in KB, the block volumes of v
+// take. Block volumes are fully preallocated.
+func (v *simVolume) blockVolumesSize() uint64 {
+	var size uint64
+	for _, b := range v.blocks {
+		size += uint64(b.info.Size) * 1024 * 1024
+	}
+	return size
+}
+
+func setBlockVolumeAuth(info *executors.BlockVolumeInfo, auth bool) {
+	if auth {
+		info.Username = info.Iqn[len(info.Iqn)-32:]
+		info.Password = utils.GenUUID()
+	} else {
+		info.Username = ""
+		info.Password = ""
+	}
+}
+
+func (s *SimExecutor) BlockVolumeCreate(host string,
+	blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
+
+	h, err := s.begin("BlockVolumeCreate", host)
+	defer s.end()
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := h.pool.volumes[blockVolume.GlusterVolumeName]
+	if !ok {
+		return nil, fmt.Errorf("volume %v doesn't exist",
+			blockVolume.GlusterVolumeName)
+	}
+	if _, ok := v.blocks[blockVolume.Name]; ok {
+		return nil, fmt.Errorf("BLOCK with name: '%v' already EXIST",
+			blockVolume.Name)
+	}
+	if blockVolume.Hacount < 1 || blockVolume.Hacount > len(blockVolume.BlockHosts) {
+		return nil, fmt.Errorf("Insufficient arguments supplied for block "+
+			"create, ha count %v with %v hosts",
+			blockVolume.Hacount, len(blockVolume.BlockHosts))
+	}
+	for _, bh := range blockVolume.BlockHosts {
+		if _, ok := s.peer(h, bh); !ok {
+			return nil, fmt.Errorf("host %v is not part of the trusted "+
+				"storage pool", bh)
+		}
+	}
+	if v.blockVolumesSize()+uint64(blockVolume.Size)*1024*1024 > v.size() {
+		return nil, fmt.Errorf("failed to create block %v on volume %v: "+
+			"No space left on device", blockVolume.Name, v.name)
+	}
+
+	b := &simBlockVolume{
+		info: executors.BlockVolumeInfo{
+			Name:              blockVolume.Name,
+			Size:              blockVolume.Size,
+			GlusterVolumeName: blockVolume.GlusterVolumeName,
+			GlusterNode:       blockVolume.GlusterNode,
+			Hacount:           blockVolume.Hacount,
+			BlockHosts:        append([]string{}, blockVolume.BlockHosts...),
+			Iqn:               "iqn.2016-12.org.gluster-block:" + utils.GenUUID(),
+		},
+	}
+	setBlockVolumeAuth(&b.info, blockVolume.Auth)
+	v.blocks[b.info.Name] = b
+
+	info := b.info
+	return &info, nil
+}
+
+func (s *SimExecutor) BlockVolumeDestroy(host string,
+	blockHostingVolumeName string, blockVolumeName string) error {
+
+	h, err := s.begin("BlockVolumeDestroy", host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	v, ok := h.pool.volumes[blockHostingVolumeName]
+	if !ok {
+		return fmt.Errorf("volume %v doesn't exist", blockHostingVolumeName)
+	}
+	if _, ok := v.blocks[blockVolumeName]; !ok {
+		return fmt.Errorf("block %v/%v doesn't exist",
+			blockHostingVolumeName, blockVolumeName)
+	}
+	delete(v.blocks, blockVolumeName)
+	return nil
+}
+
+func (s *SimExecutor) BlockVolumeModifyAuth(host string,
+	blockHostingVolumeName string, blockVolumeName string,
+	auth bool) (*executors.BlockVolumeInfo, error) {
+
+	h, err := s.begin("BlockVolumeModifyAuth", host)
+	defer s.end()
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := h.pool.volumes[blockHostingVolumeName]
+	if !ok {
+		return nil, fmt.Errorf("volume %v doesn't exist", blockHostingVolumeName)
+	}
+	b, ok := v.blocks[blockVolumeName]
+	if !ok {
+		return nil, fmt.Errorf("block %v/%v doesn't exist",
+			blockHostingVolumeName, blockVolumeName)
+	}
+	setBlockVolumeAuth(&b.info, auth)
+
+	return &executors.BlockVolumeInfo{
+		Name:              b.info.Name,
+		GlusterVolumeName: b.info.GlusterVolumeName,
+		Iqn:               b.info.Iqn,
+		Username:          b.info.Username,
+		Password:          b.info.Password,
+	}, nil
+}
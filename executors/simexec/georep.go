@@ -0,0 +1,211 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package simexec
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/chinacoolhacker/heketi/executors"
+)
+
+type simGeoRepSession struct {
+	slaveHost   string
+	slaveVolume string
+	status      string
+	config      map[string]string
+}
+
+func geoRepSessionName(geoRep *executors.GeoReplicationRequest) string {
+	return fmt.Sprintf("%v::%v", geoRep.SlaveHost, geoRep.SlaveVolume)
+}
+
+// session returns the volume and the geo-replication session of the
+// request.
+func (s *SimExecutor) session(h *simHost, volume string,
+	geoRep *executors.GeoReplicationRequest) (*simVolume, *simGeoRepSession, error) {
+
+	v, ok := h.pool.volumes[volume]
+	if !ok {
+		return nil, nil, fmt.Errorf("Volume %v does not exist", volume)
+	}
+	session := v.sessions[geoRepSessionName(geoRep)]
+	return v, session, nil
+}
+
+func (s *SimExecutor) GeoReplicationCreate(host, volume string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	h, err := s.begin("GeoReplicationCreate", host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	v, session, err := s.session(h, volume, geoRep)
+	if err != nil {
+		return err
+	}
+	if session != nil {
+		return fmt.Errorf("Session between %v and %v is already created.",
+			volume, geoRepSessionName(geoRep))
+	}
+	v.sessions[geoRepSessionName(geoRep)] = &simGeoRepSession{
+		slaveHost:   geoRep.SlaveHost,
+		slaveVolume: geoRep.SlaveVolume,
+		status:      "Created",
+		config:      map[string]string{},
+	}
+	return nil
+}
+
+func (s *SimExecutor) GeoReplicationConfig(host, volume string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	h, err := s.begin("GeoReplicationConfig", host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	_, session, err := s.session(h, volume, geoRep)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return fmt.Errorf("Geo-replication session between %v and %v "+
+			"does not exist.", volume, geoRepSessionName(geoRep))
+	}
+	for k, v := range geoRep.ActionParams {
+		session.config[k] = v
+	}
+	return nil
+}
+
+func (s *SimExecutor) GeoReplicationAction(host, volume, action string,
+	geoRep *executors.GeoReplicationRequest) error {
+
+	h, err := s.begin("GeoReplicationAction", host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	v, session, err := s.session(h, volume, geoRep)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return fmt.Errorf("Geo-replication session between %v and %v "+
+			"does not exist.", volume, geoRepSessionName(geoRep))
+	}
+
+	// the states a session must be in for each action
+	from := map[string][]string{
+		"start":  {"Created", "Stopped"},
+		"stop":   {"Active", "Paused"},
+		"pause":  {"Active"},
+		"resume": {"Paused"},
+		"delete": {"Created", "Stopped"},
+	}
+	to := map[string]string{
+		"start":  "Active",
+		"stop":   "Stopped",
+		"pause":  "Paused",
+		"resume": "Active",
+	}
+	states, ok := from[action]
+	if !ok {
+		return fmt.Errorf("Unknown geo-replication action %v", action)
+	}
+	for _, state := range states {
+		if session.status == state {
+			if action == "delete" {
+				delete(v.sessions, geoRepSessionName(geoRep))
+			} else {
+				session.status = to[action]
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("Geo-replication session between %v and %v can not "+
+		"%v, it is %v", volume, geoRepSessionName(geoRep), action,
+		session.status)
+}
+
+func (v *simVolume) geoRepStatus() executors.GeoReplicationVolume {
+	status := executors.GeoReplicationVolume{VolumeName: v.name}
+
+	names := []string{}
+	for name := range v.sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		session := v.sessions[name]
+		s := executors.GeoReplicationSession{
+			SessionSlave: name,
+		}
+		for _, b := range v.bricks {
+			s.Pairs = append(s.Pairs, executors.GeoReplicationPair{
+				MasterNode:     b.host.name,
+				MasterBrick:    b.path,
+				SlaveUser:      "root",
+				Slave:          "ssh://" + name,
+				SlaveNode:      session.slaveHost,
+				Status:         session.status,
+				MasterNodeUUID: b.host.uuid,
+			})
+		}
+		status.Sessions.SessionList = append(status.Sessions.SessionList, s)
+	}
+	return status
+}
+
+func (s *SimExecutor) GeoReplicationVolumeStatus(host, volume string) (
+	*executors.GeoReplicationStatus, error) {
+
+	h, err := s.begin("GeoReplicationVolumeStatus", host)
+	defer s.end()
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := h.pool.volumes[volume]
+	if !ok {
+		return nil, fmt.Errorf("Volume %v does not exist", volume)
+	}
+	return &executors.GeoReplicationStatus{
+		Volume: []executors.GeoReplicationVolume{v.geoRepStatus()},
+	}, nil
+}
+
+func (s *SimExecutor) GeoReplicationStatus(host string) (
+	*executors.GeoReplicationStatus, error) {
+
+	h, err := s.begin("GeoReplicationStatus", host)
+	defer s.end()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name, v := range h.pool.volumes {
+		if len(v.sessions) != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	status := &executors.GeoReplicationStatus{}
+	for _, name := range names {
+		status.Volume = append(status.Volume, h.pool.volumes[name].geoRepStatus())
+	}
+	return status, nil
+}
@@ -0,0 +1,248 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package simexec
+
+import (
+	"fmt"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+)
+
+type simVg struct {
+	name    string
+	device  string
+	extents uint64
+	free    uint64
+	lvs     map[string]*simLv
+}
+
+type simLv struct {
+	name string
+	// extents allocated in the volume group, none for thin volumes
+	extents uint64
+	// thin pool of a thin volume, and thin volumes of a thin pool
+	pool  string
+	thins int
+}
+
+type simBrick struct {
+	host *simHost
+	vg   *simVg
+	lv   string
+	tp   string
+	path string
+	size uint64
+	// volume the brick is part of, if any
+	volume string
+}
+
+func (b *simBrick) name() string {
+	return b.host.name + ":" + b.path
+}
+
+// extents returns the number of extents needed to store size KB.
+func extents(size uint64) uint64 {
+	return (size + extentSize - 1) / extentSize
+}
+
+func (vg *simVg) info() *executors.DeviceInfo {
+	return &executors.DeviceInfo{
+		Size:       vg.free * extentSize,
+		ExtentSize: extentSize,
+	}
+}
+
+func (s *SimExecutor) DeviceSetup(host, device, vgid string) (*executors.DeviceInfo, error) {
+	h, err := s.begin("DeviceSetup", host)
+	defer s.end()
+	if err != nil {
+		return nil, err
+	}
+
+	name := utils.VgIdToName(vgid)
+	if vg, ok := h.pvs[device]; ok {
+		return nil, fmt.Errorf("Can't initialize physical volume \"%v\" "+
+			"of volume group \"%v\" without -ff", device, vg)
+	}
+	if _, ok := h.vgs[name]; ok {
+		return nil, fmt.Errorf("A volume group called %v already exists.", name)
+	}
+
+	size, ok := s.deviceSizes[h.name+":"+device]
+	if !ok {
+		size = s.deviceSize
+	}
+	if size <= pvMetadataSize {
+		return nil, fmt.Errorf("Device %v is too small for the metadata", device)
+	}
+	vg := &simVg{
+		name:    name,
+		device:  device,
+		extents: (size - pvMetadataSize) / extentSize,
+		lvs:     map[string]*simLv{},
+	}
+	vg.free = vg.extents
+	h.vgs[name] = vg
+	h.pvs[device] = name
+	return vg.info(), nil
+}
+
+func (s *SimExecutor) GetDeviceInfo(host, device, vgid string) (*executors.DeviceInfo, error) {
+	h, err := s.begin("GetDeviceInfo", host)
+	defer s.end()
+	if err != nil {
+		return nil, err
+	}
+
+	vg, ok := h.vgs[utils.VgIdToName(vgid)]
+	if !ok {
+		return nil, fmt.Errorf("Volume group \"%v\" not found",
+			utils.VgIdToName(vgid))
+	}
+	return vg.info(), nil
+}
+
+func (s *SimExecutor) DeviceTeardown(host, device, vgid string) error {
+	h, err := s.begin("DeviceTeardown", host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	name := utils.VgIdToName(vgid)
+	vg, ok := h.vgs[name]
+	if !ok {
+		return fmt.Errorf("Volume group \"%v\" not found", name)
+	}
+	if vg.device != device {
+		return fmt.Errorf("Physical volume \"%v\" is not in volume group \"%v\"",
+			device, name)
+	}
+	if len(vg.lvs) != 0 {
+		return fmt.Errorf("Volume group \"%v\" still contains %v logical volume(s)",
+			name, len(vg.lvs))
+	}
+	delete(h.vgs, name)
+	delete(h.pvs, device)
+	return nil
+}
+
+func (s *SimExecutor) BrickCreate(host string,
+	brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+
+	h, err := s.begin("BrickCreate", host)
+	defer s.end()
+	if err != nil {
+		return nil, err
+	}
+
+	vgname := utils.VgIdToName(brick.VgId)
+	vg, ok := h.vgs[vgname]
+	if !ok {
+		return nil, fmt.Errorf("Volume group \"%v\" not found", vgname)
+	}
+	tp := utils.BrickIdToThinPoolName(brick.Name)
+	lv := utils.BrickIdToName(brick.Name)
+	for _, name := range []string{tp, lv} {
+		if _, ok := vg.lvs[name]; ok {
+			return nil, fmt.Errorf("Logical volume \"%v\" already exists in "+
+				"volume group \"%v\"", name, vgname)
+		}
+	}
+	if _, ok := h.bricks[brick.Path]; ok {
+		return nil, fmt.Errorf("mkdir: cannot create directory '%v': File exists",
+			brick.Path)
+	}
+	if brick.TpSize < brick.Size {
+		return nil, fmt.Errorf("Thin volume %v of %vK does not fit in thin "+
+			"pool %v of %vK", lv, brick.Size, tp, brick.TpSize)
+	}
+	needed := extents(brick.TpSize) + extents(brick.PoolMetadataSize)
+	if needed > vg.free {
+		return nil, fmt.Errorf("Volume group \"%v\" has insufficient free "+
+			"space (%v extents): %v required.", vgname, vg.free, needed)
+	}
+
+	vg.free -= needed
+	vg.lvs[tp] = &simLv{name: tp, extents: needed, thins: 1}
+	vg.lvs[lv] = &simLv{name: lv, pool: tp}
+	h.bricks[brick.Path] = &simBrick{
+		host: h,
+		vg:   vg,
+		lv:   lv,
+		tp:   tp,
+		path: brick.Path,
+		size: brick.Size,
+	}
+	return &executors.BrickInfo{
+		Path: brick.Path,
+	}, nil
+}
+
+// brick returns the brick of the request on h.
+func (s *SimExecutor) brick(h *simHost,
+	brick *executors.BrickRequest) (*simBrick, error) {
+
+	vgname := utils.VgIdToName(brick.VgId)
+	lv := utils.BrickIdToName(brick.Name)
+	for _, b := range h.bricks {
+		if b.vg.name == vgname && b.lv == lv {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("Failed to find logical volume \"%v/%v\"", vgname, lv)
+}
+
+func (s *SimExecutor) BrickDestroy(host string,
+	brick *executors.BrickRequest) error {
+
+	h, err := s.begin("BrickDestroy", host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	b, err := s.brick(h, brick)
+	if err != nil {
+		return err
+	}
+	if b.volume != "" {
+		return fmt.Errorf("umount: %v: target is busy",
+			utils.BrickMountPoint(brick.VgId, brick.Name))
+	}
+	if tp := b.vg.lvs[b.tp]; tp.thins > 1 {
+		return fmt.Errorf("Thin pool \"%v\" is used by %v thin volume(s)",
+			b.tp, tp.thins)
+	}
+	b.vg.free += b.vg.lvs[b.tp].extents
+	delete(b.vg.lvs, b.lv)
+	delete(b.vg.lvs, b.tp)
+	delete(h.bricks, b.path)
+	return nil
+}
+
+func (s *SimExecutor) BrickDestroyCheck(host string,
+	brick *executors.BrickRequest) error {
+
+	h, err := s.begin("BrickDestroyCheck", host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	tp := utils.BrickIdToThinPoolName(brick.Name)
+	b, err := s.brick(h, brick)
+	if err != nil || b.vg.lvs[tp].thins != 1 {
+		return fmt.Errorf("Cannot delete thin pool %v on %v because it "+
+			"is used by snapshot(s) or cloned volume(s)", tp, host)
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package simexec
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+)
+
+const (
+	// default size of the simulated devices, in KB
+	defaultDeviceSize = 500 * 1024 * 1024
+	// extent size of the volume groups and metadata size of the
+	// physical volumes heketi creates, in KB
+	extentSize     = 4096
+	pvMetadataSize = 128 * 1024
+)
+
+var (
+	logger = utils.NewLogger("[simexec]", utils.LEVEL_DEBUG)
+)
+
+type SimFault struct {
+	// host and method the fault applies to, empty matches any
+	Host   string `json:"host"`
+	Method string `json:"method"`
+	Error  string `json:"error"`
+	// calls that fail before the fault is removed, zero or less
+	// means all of them
+	Count int `json:"count"`
+}
+
+type SimConfig struct {
+	// size of the devices in GB
+	DeviceSize uint64 `json:"device_size_gb"`
+	// names a host is also known as, such as its storage hostname
+	Aliases map[string]string `json:"aliases"`
+	// seconds the self-heal of a replaced brick takes
+	HealTime int        `json:"heal_time_sec"`
+	Faults   []SimFault `json:"faults"`
+}
+
+// SimExecutor simulates in memory the nodes of gluster clusters: their
+// trusted storage pools, LVM volume groups, thin pools and logical
+// volumes, gluster volumes with their heal state, block volumes and
+// geo-replication sessions. Commands that gluster or LVM would refuse
+// fail without changing the state. Hosts are created the first time
+// they are referred to, with devices of the configured size.
+type SimExecutor struct {
+	lock sync.Mutex
+
+	deviceSize  uint64
+	healTime    int
+	hosts       map[string]*simHost
+	aliases     map[string]string
+	deviceSizes map[string]uint64
+	faults      []*SimFault
+}
+
+type simHost struct {
+	name string
+	uuid string
+	down bool
+	sshd string
+	pool *simPool
+	// volume groups by name and the volume group of each device
+	vgs map[string]*simVg
+	pvs map[string]string
+	// bricks by path
+	bricks map[string]*simBrick
+}
+
+// simPool is a gluster trusted storage pool
+type simPool struct {
+	peers   map[string]*simHost
+	volumes map[string]*simVolume
+}
+
+func NewSimExecutor(config *SimConfig) (*SimExecutor, error) {
+	s := &SimExecutor{
+		deviceSize:  config.DeviceSize * 1024 * 1024,
+		healTime:    config.HealTime,
+		hosts:       map[string]*simHost{},
+		aliases:     map[string]string{},
+		deviceSizes: map[string]uint64{},
+	}
+	if s.deviceSize == 0 {
+		s.deviceSize = defaultDeviceSize
+	}
+	for alias, host := range config.Aliases {
+		s.aliases[alias] = host
+	}
+	for _, f := range config.Faults {
+		if f.Error == "" {
+			return nil, fmt.Errorf("Fault for method %v on host %v has no error",
+				f.Method, f.Host)
+		}
+		s.InjectFault(f.Host, f.Method, errors.New(f.Error), f.Count)
+	}
+	return s, nil
+}
+
+// AddAlias makes alias refer to host, as the manage and storage
+// hostnames of a node do.
+func (s *SimExecutor) AddAlias(alias, host string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.aliases[alias] = host
+}
+
+// SetDeviceSize sets the size, in KB, of a device of host that has not
+// been setup yet.
+func (s *SimExecutor) SetDeviceSize(host, device string, size uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.deviceSizes[s.hostName(host)+":"+device] = size
+}
+
+// SetHostDown makes host unreachable, or reachable again.
+func (s *SimExecutor) SetHostDown(host string, down bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.host(host).down = down
+}
+
+// InjectFault makes the calls to method on host fail with err, without
+// changing the state. An empty host or method matches any. The fault
+// is removed after count calls, or kept if count is zero or less.
+func (s *SimExecutor) InjectFault(host, method string, err error, count int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = append(s.faults, &SimFault{
+		Host:   host,
+		Method: method,
+		Error:  err.Error(),
+		Count:  count,
+	})
+}
+
+// ClearFaults removes all the injected faults.
+func (s *SimExecutor) ClearFaults() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = nil
+}
+
+func (s *SimExecutor) SetLogLevel(level string) {
+	switch level {
+	case "none":
+		logger.SetLevel(utils.LEVEL_NOLOG)
+	case "critical":
+		logger.SetLevel(utils.LEVEL_CRITICAL)
+	case "error":
+		logger.SetLevel(utils.LEVEL_ERROR)
+	case "warning":
+		logger.SetLevel(utils.LEVEL_WARNING)
+	case "info":
+		logger.SetLevel(utils.LEVEL_INFO)
+	case "debug":
+		logger.SetLevel(utils.LEVEL_DEBUG)
+	}
+}
+
+func (s *SimExecutor) hostName(name string) string {
+	if host, ok := s.aliases[name]; ok {
+		return host
+	}
+	return name
+}
+
+// host returns the host known by name, creating it if needed. Must be
+// called with the lock held.
+func (s *SimExecutor) host(name string) *simHost {
+	name = s.hostName(name)
+	h, ok := s.hosts[name]
+	if !ok {
+		h = &simHost{
+			name:   name,
+			uuid:   utils.GenUUID(),
+			sshd:   "start",
+			vgs:    map[string]*simVg{},
+			pvs:    map[string]string{},
+			bricks: map[string]*simBrick{},
+		}
+		h.pool = &simPool{
+			peers:   map[string]*simHost{name: h},
+			volumes: map[string]*simVolume{},
+		}
+		s.hosts[name] = h
+	}
+	return h
+}
+
+// begin locks the executor and returns the host a command of method is
+// sent to, or the error the command fails with if the host is down or
+// a fault is injected. The lock is held, even on error, until end is
+// called.
+func (s *SimExecutor) begin(method, name string) (*simHost, error) {
+	s.lock.Lock()
+	h := s.host(name)
+	if h.down {
+		return nil, fmt.Errorf("dial tcp %v:22: connect: connection refused", name)
+	}
+	for i, f := range s.faults {
+		if (f.Host != "" && s.hostName(f.Host) != h.name) ||
+			(f.Method != "" && f.Method != method) {
+			continue
+		}
+		if f.Count > 0 {
+			f.Count--
+			if f.Count == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		logger.Debug("Injected fault in %v on %v: %v", method, name, f.Error)
+		return nil, errors.New(f.Error)
+	}
+	return h, nil
+}
+
+func (s *SimExecutor) end() {
+	s.lock.Unlock()
+}
+
+// peer returns the host known by name if it is in the pool of h.
+func (s *SimExecutor) peer(h *simHost, name string) (*simHost, bool) {
+	p, ok := h.pool.peers[s.hostName(name)]
+	return p, ok
+}
+
+func (s *SimExecutor) GlusterdCheck(host string) error {
+	_, err := s.begin("GlusterdCheck", host)
+	defer s.end()
+	return err
+}
+
+func (s *SimExecutor) PeerProbe(exec_host, newnode string) error {
+	h, err := s.begin("PeerProbe", exec_host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	n := s.host(newnode)
+	if n.pool == h.pool {
+		return nil
+	}
+	if n.down {
+		return errors.New("peer probe: failed: Probe returned with " +
+			"Transport endpoint is not connected")
+	}
+	if len(n.pool.peers) > 1 || len(n.pool.volumes) > 0 {
+		return fmt.Errorf("peer probe: failed: %v is either already part of "+
+			"another cluster or having volumes configured", newnode)
+	}
+	n.pool = h.pool
+	h.pool.peers[n.name] = n
+	return nil
+}
+
+func (s *SimExecutor) PeerDetach(exec_host, detachnode string) error {
+	h, err := s.begin("PeerDetach", exec_host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	n, ok := s.peer(h, detachnode)
+	if !ok {
+		return fmt.Errorf("peer detach: failed: %v is not part of cluster",
+			detachnode)
+	}
+	if n == h {
+		return fmt.Errorf("peer detach: failed: %v is localhost", detachnode)
+	}
+	for _, v := range h.pool.volumes {
+		for _, b := range v.bricks {
+			if b.host == n {
+				return fmt.Errorf("peer detach: failed: Brick(s) with the "+
+					"peer %v exist in cluster", detachnode)
+			}
+		}
+	}
+	delete(h.pool.peers, n.name)
+	n.pool = &simPool{
+		peers:   map[string]*simHost{n.name: n},
+		volumes: map[string]*simVolume{},
+	}
+	return nil
+}
+
+func (s *SimExecutor) SshdControl(host string, action string) error {
+	h, err := s.begin("SshdControl", host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "start", "stop":
+		h.sshd = action
+		return nil
+	default:
+		return fmt.Errorf("Unknown operation %v for sshd", action)
+	}
+}
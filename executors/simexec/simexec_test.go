@@ -0,0 +1,410 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package simexec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func newTestSimExecutor(t *testing.T) *SimExecutor {
+	s, err := NewSimExecutor(&SimConfig{DeviceSize: 1})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return s
+}
+
+func brickRequest(vgid, name string, size uint64) *executors.BrickRequest {
+	return &executors.BrickRequest{
+		VgId:             vgid,
+		Name:             name,
+		TpSize:           size,
+		Size:             size,
+		PoolMetadataSize: 8192,
+		Path:             utils.BrickPath(vgid, name),
+	}
+}
+
+// setupReplicaVolume creates a replica 3 volume vol1 with a 100MB brick
+// on each of host1, host2 and host3.
+func setupReplicaVolume(t *testing.T, s *SimExecutor) []executors.BrickInfo {
+	bricks := []executors.BrickInfo{}
+	for _, host := range []string{"host1", "host2", "host3"} {
+		if host != "host1" {
+			err := s.PeerProbe("host1", host)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		}
+		_, err := s.DeviceSetup(host, "/dev/sdb", "vg-"+host)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		b, err := s.BrickCreate(host,
+			brickRequest("vg-"+host, "brick-"+host, 100*1024))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		bricks = append(bricks, executors.BrickInfo{Host: host, Path: b.Path})
+	}
+	_, err := s.VolumeCreate("host1", &executors.VolumeRequest{
+		Name:    "vol1",
+		Type:    executors.DurabilityReplica,
+		Replica: 3,
+		Bricks:  bricks,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return bricks
+}
+
+func TestSimExecutorDevices(t *testing.T) {
+	s := newTestSimExecutor(t)
+
+	d, err := s.DeviceSetup("host1", "/dev/sdb", "vg1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, d.ExtentSize == 4096, "got:", d)
+	tests.Assert(t, d.Size == 224*4096, "got:", d)
+
+	// a device and a volume group are only setup once
+	_, err = s.DeviceSetup("host1", "/dev/sdb", "vg2")
+	tests.Assert(t, err != nil, "expected err != nil")
+	_, err = s.DeviceSetup("host1", "/dev/sdc", "vg1")
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// thin pools are allocated whole extents
+	_, err = s.BrickCreate("host1", brickRequest("vg1", "b1", 100*1024))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	d, err = s.GetDeviceInfo("host1", "/dev/sdb", "vg1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, d.Size == (224-25-2)*4096, "got:", d)
+
+	_, err = s.BrickCreate("host1", brickRequest("vg1", "b2", 900*1024))
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "insufficient free space"), err)
+
+	// a volume group with bricks can not be removed
+	err = s.DeviceTeardown("host1", "/dev/sdb", "vg1")
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = s.BrickDestroy("host1", brickRequest("vg1", "b1", 100*1024))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.DeviceTeardown("host1", "/dev/sdb", "vg1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = s.GetDeviceInfo("host1", "/dev/sdb", "vg1")
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// devices can be given other sizes
+	s.SetDeviceSize("host1", "/dev/sdc", 2*1024*1024)
+	d, err = s.DeviceSetup("host1", "/dev/sdc", "vg3")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, d.Size == 480*4096, "got:", d)
+}
+
+func TestSimExecutorBricks(t *testing.T) {
+	s := newTestSimExecutor(t)
+	bricks := setupReplicaVolume(t, s)
+
+	req := brickRequest("vg-host1", "brick-host1", 100*1024)
+	_, err := s.BrickCreate("host1", req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// bricks in use can not be destroyed
+	err = s.BrickDestroyCheck("host1", req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.BrickDestroy("host1", req)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "target is busy"), err)
+
+	// nor can bricks be destroyed twice
+	err = s.VolumeDestroy("host1", "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.BrickDestroy("host1", req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.BrickDestroy("host1", req)
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = s.BrickDestroyCheck("host1", req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// a destroyed brick can not be part of a volume
+	_, err = s.VolumeCreate("host1", &executors.VolumeRequest{
+		Name:    "vol2",
+		Type:    executors.DurabilityReplica,
+		Replica: 3,
+		Bricks:  bricks,
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "No such file"), err)
+}
+
+func TestSimExecutorVolumes(t *testing.T) {
+	s := newTestSimExecutor(t)
+	bricks := setupReplicaVolume(t, s)
+
+	v, err := s.VolumeInfo("host2", "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v.VolumeName == "vol1", "got:", v)
+	tests.Assert(t, v.TypeStr == "Replicate", "got:", v)
+	tests.Assert(t, v.ReplicaCount == 3, "got:", v)
+	tests.Assert(t, len(v.Bricks.BrickList) == 3, "got:", v)
+	tests.Assert(t, v.Bricks.BrickList[1].Name == "host2:"+bricks[1].Path,
+		"got:", v.Bricks.BrickList)
+
+	// names and bricks are unique
+	_, err = s.VolumeCreate("host1", &executors.VolumeRequest{
+		Name:   "vol1",
+		Type:   executors.DurabilityNone,
+		Bricks: bricks[:1],
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "already exists"), err)
+	_, err = s.VolumeCreate("host1", &executors.VolumeRequest{
+		Name:   "vol2",
+		Type:   executors.DurabilityNone,
+		Bricks: bricks[:1],
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "already part of a volume"), err)
+
+	// the bricks of a set come together
+	_, err = s.BrickCreate("host1", brickRequest("vg-host1", "b2", 1024))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = s.VolumeExpand("host1", &executors.VolumeRequest{
+		Name:    "vol1",
+		Type:    executors.DurabilityReplica,
+		Replica: 3,
+		Bricks: []executors.BrickInfo{
+			{Host: "host1", Path: utils.BrickPath("vg-host1", "b2")},
+		},
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// volumes are known to all the peers of the pool only
+	tests.Assert(t, len(s.Volumes("host3")) == 1, s.Volumes("host3"))
+	_, err = s.VolumeInfo("host4", "vol1")
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// peers with bricks can not be detached
+	err = s.PeerDetach("host1", "host3")
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = s.VolumeDestroy("host1", "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.VolumeDestroy("host1", "vol1")
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = s.PeerDetach("host1", "host3")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.PeerDetach("host1", "host3")
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestSimExecutorReplaceBrick(t *testing.T) {
+	s, err := NewSimExecutor(&SimConfig{DeviceSize: 1, HealTime: 60})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	bricks := setupReplicaVolume(t, s)
+
+	err = s.PeerProbe("host1", "host4")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = s.DeviceSetup("host4", "/dev/sdb", "vg-host4")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	b, err := s.BrickCreate("host4", brickRequest("vg-host4", "b4", 100*1024))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	newBrick := &executors.BrickInfo{Host: "host4", Path: b.Path}
+
+	err = s.VolumeReplaceBrick("host1", "vol1", &bricks[0], newBrick)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.VolumeReplaceBrick("host1", "vol1", &bricks[0], newBrick)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// the other bricks of the set are healing the new one
+	h, err := s.HealInfo("host1", "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(h.Bricks.BrickList) == 3, "got:", h)
+	tests.Assert(t, h.Bricks.BrickList[0].Name == "host4:"+b.Path, "got:", h)
+	tests.Assert(t, h.Bricks.BrickList[0].NumberOfEntries == "0", "got:", h)
+	tests.Assert(t, h.Bricks.BrickList[1].NumberOfEntries == "1", "got:", h)
+
+	err = s.SetHealEntries("vol1", "host2:"+bricks[1].Path, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	s.SetHostDown("host3", true)
+	h, err = s.HealInfo("host1", "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, h.Bricks.BrickList[1].NumberOfEntries == "0", "got:", h)
+	tests.Assert(t, h.Bricks.BrickList[2].Name == "information not available",
+		"got:", h)
+
+	// the replaced brick is free again
+	err = s.BrickDestroy("host1", brickRequest("vg-host1", "brick-host1", 0))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestSimExecutorAliases(t *testing.T) {
+	s, err := NewSimExecutor(&SimConfig{
+		Aliases: map[string]string{"storage1": "manage1"},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	s.AddAlias("storage2", "manage2")
+
+	err = s.PeerProbe("manage1", "storage2")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = s.DeviceSetup("manage2", "/dev/sdb", "vg2")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	b, err := s.BrickCreate("manage2", brickRequest("vg2", "b2", 1024))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = s.VolumeCreate("manage1", &executors.VolumeRequest{
+		Name:   "vol1",
+		Type:   executors.DurabilityNone,
+		Bricks: []executors.BrickInfo{{Host: "storage2", Path: b.Path}},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(s.Volumes("storage1")) == 1)
+}
+
+func TestSimExecutorFaults(t *testing.T) {
+	s, err := NewSimExecutor(&SimConfig{
+		Faults: []SimFault{
+			{Host: "host1", Method: "GlusterdCheck", Error: "glusterd is dead", Count: 1},
+		},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = s.GlusterdCheck("host1")
+	tests.Assert(t, err != nil && err.Error() == "glusterd is dead", "got:", err)
+	err = s.GlusterdCheck("host1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// a failed call does not change the state
+	s.InjectFault("", "DeviceSetup", errors.New("pvcreate failed"), 0)
+	for i := 0; i < 2; i++ {
+		_, err = s.DeviceSetup("host2", "/dev/sdb", "vg1")
+		tests.Assert(t, err != nil && err.Error() == "pvcreate failed", "got:", err)
+	}
+	s.ClearFaults()
+	_, err = s.DeviceSetup("host2", "/dev/sdb", "vg1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	s.SetHostDown("host2", true)
+	_, err = s.GetDeviceInfo("host2", "/dev/sdb", "vg1")
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "connection refused"), err)
+	s.SetHostDown("host2", false)
+	_, err = s.GetDeviceInfo("host2", "/dev/sdb", "vg1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	_, err = NewSimExecutor(&SimConfig{Faults: []SimFault{{Host: "host1"}}})
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestSimExecutorBlockVolumes(t *testing.T) {
+	s := newTestSimExecutor(t)
+	setupReplicaVolume(t, s)
+
+	req := &executors.BlockVolumeRequest{
+		Name:              "block1",
+		Size:              1,
+		GlusterVolumeName: "vol1",
+		Hacount:           2,
+		BlockHosts:        []string{"host1", "host2"},
+		Auth:              true,
+	}
+	// the volume is 100MB only
+	_, err := s.BlockVolumeCreate("host1", req)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "No space left"), err)
+
+	s = newTestSimExecutor(t)
+	for _, host := range []string{"host1", "host2", "host3"} {
+		s.SetDeviceSize(host, "/dev/sdb", 4*1024*1024)
+	}
+	bricks := setupReplicaVolume(t, s)
+	for i, host := range []string{"host1", "host2", "host3"} {
+		b, err := s.BrickCreate(host,
+			brickRequest("vg-"+host, "big-"+host, 2*1024*1024))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		bricks[i].Path = b.Path
+	}
+	_, err = s.VolumeExpand("host1", &executors.VolumeRequest{
+		Name:    "vol1",
+		Type:    executors.DurabilityReplica,
+		Replica: 3,
+		Bricks:  bricks,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	b, err := s.BlockVolumeCreate("host1", req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, b.Name == "block1" && b.Size == 1, "got:", b)
+	tests.Assert(t, strings.HasPrefix(b.Iqn, "iqn.2016-12.org.gluster-block:"), b)
+	tests.Assert(t, b.Username != "" && b.Password != "", "got:", b)
+	_, err = s.BlockVolumeCreate("host1", req)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "already EXIST"), err)
+
+	req.Name = "block2"
+	_, err = s.BlockVolumeCreate("host1", req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.Name = "block3"
+	_, err = s.BlockVolumeCreate("host1", req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// credentials are rotated by enabling auth again
+	m, err := s.BlockVolumeModifyAuth("host1", "vol1", "block1", true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, m.Password != b.Password, "got:", m)
+	m, err = s.BlockVolumeModifyAuth("host1", "vol1", "block1", false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, m.Password == "", "got:", m)
+
+	err = s.BlockVolumeDestroy("host1", "vol1", "block1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.BlockVolumeDestroy("host1", "vol1", "block1")
+	tests.Assert(t, err != nil, "expected err != nil")
+	_, err = s.BlockVolumeModifyAuth("host1", "vol1", "block1", true)
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestSimExecutorGeoReplication(t *testing.T) {
+	s := newTestSimExecutor(t)
+	setupReplicaVolume(t, s)
+
+	geoRep := &executors.GeoReplicationRequest{
+		SlaveHost:   "slave1",
+		SlaveVolume: "slavevol",
+	}
+	err := s.GeoReplicationCreate("host1", "vol1", geoRep)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.GeoReplicationCreate("host1", "vol1", geoRep)
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = s.GeoReplicationCreate("host1", "vol2", geoRep)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	err = s.GeoReplicationAction("host1", "vol1", "pause", geoRep)
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = s.GeoReplicationAction("host1", "vol1", "start", geoRep)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	status, err := s.GeoReplicationStatus("host2")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(status.Volume) == 1, "got:", status)
+	sessions := status.Volume[0].Sessions.SessionList
+	tests.Assert(t, len(sessions) == 1, "got:", sessions)
+	tests.Assert(t, sessions[0].SessionSlave == "slave1::slavevol", "got:", sessions)
+	tests.Assert(t, len(sessions[0].Pairs) == 3, "got:", sessions)
+	tests.Assert(t, sessions[0].Pairs[0].Status == "Active", "got:", sessions)
+
+	// active sessions prevent the volume from being stopped
+	err = s.VolumeDestroy("host1", "vol1")
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = s.GeoReplicationAction("host1", "vol1", "delete", geoRep)
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = s.GeoReplicationAction("host1", "vol1", "stop", geoRep)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.GeoReplicationAction("host1", "vol1", "delete", geoRep)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	status, err = s.GeoReplicationVolumeStatus("host1", "vol1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(status.Volume[0].Sessions.SessionList) == 0, "got:", status)
+}
@@ -0,0 +1,424 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package simexec
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/executors"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+)
+
+// gluster volume types, as reported by volume info
+var volumeTypes = map[string]int{
+	"Distribute":            0,
+	"Replicate":             2,
+	"Disperse":              4,
+	"Distributed-Replicate": 7,
+	"Distributed-Disperse":  9,
+}
+
+type simVolume struct {
+	name       string
+	id         string
+	durability executors.DurabilityType
+	replica    int
+	data       int
+	redundancy int
+	bricks     []*simBrick
+	options    []executors.Option
+	blocks     map[string]*simBlockVolume
+	sessions   map[string]*simGeoRepSession
+	// bricks that are the source of data to heal, and when the heal
+	// completes, zero if it only completes with SetHealEntries
+	heal map[string]simHeal
+}
+
+type simHeal struct {
+	entries int
+	until   time.Time
+}
+
+// inSet returns the number of bricks in a set of the volume.
+func (v *simVolume) inSet() int {
+	switch v.durability {
+	case executors.DurabilityReplica:
+		return v.replica
+	case executors.DurabilityDispersion:
+		return v.data + v.redundancy
+	default:
+		return 1
+	}
+}
+
+// size returns the capacity of the volume in KB.
+func (v *simVolume) size() uint64 {
+	var size uint64
+	for _, b := range v.bricks {
+		size += b.size
+	}
+	switch v.durability {
+	case executors.DurabilityReplica:
+		return size / uint64(v.replica)
+	case executors.DurabilityDispersion:
+		return size / uint64(v.data+v.redundancy) * uint64(v.data)
+	default:
+		return size
+	}
+}
+
+func (v *simVolume) typeStr() string {
+	var t string
+	switch v.durability {
+	case executors.DurabilityReplica:
+		t = "Replicate"
+	case executors.DurabilityDispersion:
+		t = "Disperse"
+	default:
+		return "Distribute"
+	}
+	if len(v.bricks) > v.inSet() {
+		t = "Distributed-" + t
+	}
+	return t
+}
+
+// addBricks checks the bricks of the request can be added to the
+// volume, then adds them. Errors are prefixed with op, the gluster
+// command that failed.
+func (s *SimExecutor) addBricks(h *simHost, v *simVolume, op string,
+	bricks []executors.BrickInfo) error {
+
+	if len(bricks) == 0 || len(bricks)%v.inSet() != 0 {
+		return fmt.Errorf("%v: failed: Incorrect number of bricks supplied "+
+			"%v with count %v", op, len(bricks), v.inSet())
+	}
+	added := []*simBrick{}
+	for _, brick := range bricks {
+		b, err := s.volumeBrick(h, op, brick.Host, brick.Path)
+		if err != nil {
+			return err
+		}
+		for _, a := range added {
+			if a == b {
+				return fmt.Errorf("%v: failed: Found duplicate exports %v",
+					op, b.name())
+			}
+		}
+		added = append(added, b)
+	}
+	for _, b := range added {
+		b.volume = v.name
+	}
+	v.bricks = append(v.bricks, added...)
+	return nil
+}
+
+// volumeBrick returns the brick at path on the peer host of h, if it
+// is not part of a volume yet.
+func (s *SimExecutor) volumeBrick(h *simHost, op, host, path string) (*simBrick, error) {
+	p, ok := s.peer(h, host)
+	if !ok {
+		return nil, fmt.Errorf("%v: failed: Host %v is not in 'Peer in "+
+			"Cluster' state", op, host)
+	}
+	b, ok := p.bricks[path]
+	if !ok {
+		return nil, fmt.Errorf("%v: failed: Failed to find brick directory "+
+			"%v. Reason : No such file or directory", op, path)
+	}
+	if b.volume != "" {
+		return nil, fmt.Errorf("%v: failed: %v:%v is already part of a volume",
+			op, host, path)
+	}
+	return b, nil
+}
+
+func (s *SimExecutor) VolumeCreate(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	h, err := s.begin("VolumeCreate", host)
+	defer s.end()
+	if err != nil {
+		return nil, err
+	}
+
+	op := "volume create: " + volume.Name
+	if _, ok := h.pool.volumes[volume.Name]; ok {
+		return nil, fmt.Errorf("%v: failed: Volume %v already exists",
+			op, volume.Name)
+	}
+	v := &simVolume{
+		name:       volume.Name,
+		id:         utils.GenUUID(),
+		durability: volume.Type,
+		replica:    volume.Replica,
+		data:       volume.Data,
+		redundancy: volume.Redundancy,
+		blocks:     map[string]*simBlockVolume{},
+		sessions:   map[string]*simGeoRepSession{},
+		heal:       map[string]simHeal{},
+	}
+	if v.inSet() < 1 {
+		return nil, fmt.Errorf("%v: failed: Invalid number of bricks in a set",
+			op)
+	}
+	for _, option := range volume.GlusterVolumeOptions {
+		if option == "" {
+			continue
+		}
+		kv := strings.SplitN(option, " ", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("volume set: failed: Invalid option %v", option)
+		}
+		v.options = append(v.options, executors.Option{Name: kv[0], Value: kv[1]})
+	}
+	if err := s.addBricks(h, v, op, volume.Bricks); err != nil {
+		return nil, err
+	}
+	h.pool.volumes[v.name] = v
+	return &executors.Volume{}, nil
+}
+
+func (s *SimExecutor) VolumeExpand(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	h, err := s.begin("VolumeExpand", host)
+	defer s.end()
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := h.pool.volumes[volume.Name]
+	if !ok {
+		return nil, fmt.Errorf("volume add-brick: failed: Volume %v does not exist",
+			volume.Name)
+	}
+	if err := s.addBricks(h, v, "volume add-brick", volume.Bricks); err != nil {
+		return nil, err
+	}
+	return &executors.Volume{}, nil
+}
+
+func (s *SimExecutor) VolumeDestroy(host string, volume string) error {
+	h, err := s.begin("VolumeDestroy", host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	v, ok := h.pool.volumes[volume]
+	if !ok {
+		return fmt.Errorf("Unable to delete volume %v: volume delete: %v: "+
+			"failed: Volume %v does not exist", volume, volume, volume)
+	}
+	for _, session := range v.sessions {
+		if session.status == "Active" {
+			return fmt.Errorf("Unable to delete volume %v: volume stop: %v: "+
+				"failed: geo-replication sessions are active for the volume %v",
+				volume, volume, volume)
+		}
+	}
+	for _, b := range v.bricks {
+		b.volume = ""
+	}
+	delete(h.pool.volumes, volume)
+	return nil
+}
+
+func (s *SimExecutor) VolumeDestroyCheck(host, volume string) error {
+	h, err := s.begin("VolumeDestroyCheck", host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := h.pool.volumes[volume]; !ok {
+		return fmt.Errorf("Unable to get snapshot information from volume %v: "+
+			"snapshot list: failed: Volume (%v) does not exist", volume, volume)
+	}
+	return nil
+}
+
+func (s *SimExecutor) VolumeReplaceBrick(host string, volume string,
+	oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+
+	h, err := s.begin("VolumeReplaceBrick", host)
+	defer s.end()
+	if err != nil {
+		return err
+	}
+
+	op := "volume replace-brick"
+	v, ok := h.pool.volumes[volume]
+	if !ok {
+		return fmt.Errorf("%v: failed: Volume %v does not exist", op, volume)
+	}
+	index := -1
+	if p, ok := s.peer(h, oldBrick.Host); ok {
+		for i, b := range v.bricks {
+			if b.host == p && b.path == oldBrick.Path {
+				index = i
+			}
+		}
+	}
+	if index == -1 {
+		return fmt.Errorf("%v: failed: brick: %v:%v does not exist in volume: %v",
+			op, oldBrick.Host, oldBrick.Path, volume)
+	}
+	b, err := s.volumeBrick(h, op, newBrick.Host, newBrick.Path)
+	if err != nil {
+		return err
+	}
+
+	old := v.bricks[index]
+	old.volume = ""
+	delete(v.heal, old.name())
+	b.volume = v.name
+	v.bricks[index] = b
+
+	// the other bricks of the set are healed to the new one
+	if s.healTime > 0 {
+		start := index - index%v.inSet()
+		for _, peer := range v.bricks[start : start+v.inSet()] {
+			if peer != b {
+				v.heal[peer.name()] = simHeal{
+					entries: 1,
+					until:   time.Now().Add(time.Duration(s.healTime) * time.Second),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SetHealEntries sets the number of entries brick, given as host:path,
+// of volume is the source of for self-heal. Zero entries completes the
+// heal.
+func (s *SimExecutor) SetHealEntries(volume, brick string, entries int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, h := range s.hosts {
+		v, ok := h.pool.volumes[volume]
+		if !ok {
+			continue
+		}
+		for _, b := range v.bricks {
+			if b.name() == brick || b.path == brick {
+				if entries == 0 {
+					delete(v.heal, b.name())
+				} else {
+					v.heal[b.name()] = simHeal{entries: entries}
+				}
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("Brick %v of volume %v not found", brick, volume)
+}
+
+func (s *SimExecutor) VolumeInfo(host string, volume string) (*executors.Volume, error) {
+	h, err := s.begin("VolumeInfo", host)
+	defer s.end()
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := h.pool.volumes[volume]
+	if !ok {
+		return nil, fmt.Errorf("Unable to get volume info of volume name: %v: "+
+			"volume info: failed: Volume %v does not exist", volume, volume)
+	}
+
+	info := &executors.Volume{
+		VolumeName: v.name,
+		ID:         v.id,
+		Status:     1,
+		StatusStr:  "Started",
+		BrickCount: len(v.bricks),
+		DistCount:  v.inSet(),
+		Type:       volumeTypes[v.typeStr()],
+		TypeStr:    v.typeStr(),
+		OptCount:   len(v.options),
+	}
+	switch v.durability {
+	case executors.DurabilityReplica:
+		info.ReplicaCount = v.replica
+	case executors.DurabilityDispersion:
+		info.DisperseCount = v.data + v.redundancy
+		info.RedundancyCount = v.redundancy
+	}
+	for _, b := range v.bricks {
+		info.Bricks.BrickList = append(info.Bricks.BrickList, executors.Brick{
+			UUID:     b.lv,
+			Name:     b.name(),
+			HostUUID: b.host.uuid,
+		})
+	}
+	info.Options.OptionList = append(info.Options.OptionList, v.options...)
+	return info, nil
+}
+
+func (s *SimExecutor) HealInfo(host string, volume string) (*executors.HealInfo, error) {
+	h, err := s.begin("HealInfo", host)
+	defer s.end()
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := h.pool.volumes[volume]
+	if !ok {
+		return nil, fmt.Errorf("Unable to get heal info of volume : %v: "+
+			"Volume %v does not exist", volume, volume)
+	}
+
+	info := &executors.HealInfo{}
+	now := time.Now()
+	for _, b := range v.bricks {
+		status := executors.BrickHealStatus{
+			HostUUID:        b.host.uuid,
+			Name:            b.name(),
+			Status:          "Connected",
+			NumberOfEntries: "0",
+		}
+		if b.host.down {
+			// gluster does not report the name of bricks that are down
+			status.Name = "information not available"
+			status.Status = "Transport endpoint is not connected"
+			status.NumberOfEntries = "-"
+		} else if heal, ok := v.heal[b.name()]; ok {
+			if heal.until.IsZero() || now.Before(heal.until) {
+				status.NumberOfEntries = strconv.Itoa(heal.entries)
+			} else {
+				delete(v.heal, b.name())
+			}
+		}
+		info.Bricks.BrickList = append(info.Bricks.BrickList, status)
+	}
+	return info, nil
+}
+
+// Volumes returns the names of the volumes of the pool of host.
+func (s *SimExecutor) Volumes(host string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	names := []string{}
+	for name := range s.host(host).pool.volumes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,133 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package sshexec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/chinacoolhacker/heketi/pkg/utils/ssh"
+)
+
+const (
+	sshAuthKeyFile  = "keyfile"
+	sshAuthAgent    = "agent"
+	sshAuthPassword = "password"
+)
+
+// defaultCredentials returns the auth settings of the configuration,
+// used for the nodes with none of their own.
+func defaultCredentials(user string, config *SshConfig) SshNodeConfig {
+	auth := config.Auth
+	if auth == "" {
+		auth = sshAuthKeyFile
+	}
+	return SshNodeConfig{
+		User:            user,
+		Auth:            auth,
+		PrivateKeyFile:  config.PrivateKeyFile,
+		CertificateFile: config.CertificateFile,
+		PasswordFile:    config.PasswordFile,
+		PasswordEnv:     config.PasswordEnv,
+	}
+}
+
+// inherit returns the settings of the node completed with defaults.
+func (n SshNodeConfig) inherit(defaults SshNodeConfig) SshNodeConfig {
+	if n.Auth == "" {
+		switch {
+		case n.PrivateKeyFile != "":
+			n.Auth = sshAuthKeyFile
+		case n.PasswordFile != "" || n.PasswordEnv != "":
+			n.Auth = sshAuthPassword
+		default:
+			n.Auth = defaults.Auth
+		}
+	}
+	if n.User == "" {
+		n.User = defaults.User
+	}
+	if n.PrivateKeyFile == "" {
+		n.PrivateKeyFile = defaults.PrivateKeyFile
+		// the certificate is of the default key only
+		if n.CertificateFile == "" {
+			n.CertificateFile = defaults.CertificateFile
+		}
+	}
+	if n.PasswordFile == "" && n.PasswordEnv == "" {
+		n.PasswordFile = defaults.PasswordFile
+		n.PasswordEnv = defaults.PasswordEnv
+	}
+	return n
+}
+
+// credentials returns the credentials the settings are for.
+func (n SshNodeConfig) credentials() (ssh.Credentials, error) {
+	creds := ssh.Credentials{User: n.User}
+	switch n.Auth {
+	case sshAuthKeyFile:
+		if n.PrivateKeyFile == "" {
+			return creds, fmt.Errorf("Missing ssh private key file in configuration")
+		}
+		creds.KeyFile = n.PrivateKeyFile
+		creds.CertificateFile = n.CertificateFile
+	case sshAuthAgent:
+		creds.Agent = true
+	case sshAuthPassword:
+		password, err := readPassword(n.PasswordFile, n.PasswordEnv)
+		if err != nil {
+			return creds, err
+		}
+		creds.Password = password
+	default:
+		return creds, fmt.Errorf("Unknown ssh auth method: %v", n.Auth)
+	}
+	return creds, nil
+}
+
+// readPassword returns the password in file, or else in the environment
+// variable env.
+func readPassword(file, env string) (string, error) {
+	var password string
+	switch {
+	case file != "":
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("Unable to read password file %v: %v", file, err)
+		}
+		password = strings.TrimRight(string(buf), "\r\n")
+	case env != "":
+		password = os.Getenv(env)
+	default:
+		return "", fmt.Errorf("Missing ssh password file or environment variable in configuration")
+	}
+	if password == "" {
+		return "", fmt.Errorf("The ssh password is empty")
+	}
+	return password, nil
+}
+
+// nodeCredentials returns the credentials of the nodes logged in to
+// differently.
+func nodeCredentials(defaults SshNodeConfig,
+	nodes map[string]SshNodeConfig) (map[string]ssh.Credentials, error) {
+
+	creds := map[string]ssh.Credentials{}
+	for host, n := range nodes {
+		c, err := n.inherit(defaults).credentials()
+		if err != nil {
+			return nil, fmt.Errorf("Credentials of node %v: %v", host, err)
+		}
+		creds[host] = c
+	}
+	return creds, nil
+}
@@ -19,4 +19,47 @@ type SshConfig struct {
 	PrivateKeyFile string `json:"keyfile"`
 	User           string `json:"user"`
 	Port           string `json:"port"`
+
+	// how the executor logs in to the nodes: keyfile, agent or
+	// password. Keyfile by default.
+	Auth string `json:"auth"`
+	// OpenSSH user certificate of the private key, signed by a
+	// certificate authority the nodes trust
+	CertificateFile string `json:"certfile"`
+	// file with the password, or environment variable holding it
+	PasswordFile string `json:"password_file"`
+	PasswordEnv  string `json:"password_env"`
+	// credentials of the nodes logged in to differently, by manage
+	// hostname
+	Nodes map[string]SshNodeConfig `json:"nodes"`
+
+	// known_hosts file the host keys of the nodes are verified with
+	KnownHostsFile string `json:"known_hosts_file"`
+	// what is done with the nodes whose host key is neither in the
+	// known_hosts file nor pinned: insecure, tofu or strict. Strict if
+	// a known_hosts file is set, insecure otherwise. The known and
+	// pinned keys are verified with any policy.
+	HostKeyPolicy string `json:"host_key_policy"`
+
+	// seconds the connections to the nodes may take to be established
+	// (default 30)
+	DialTimeout int `json:"dial_timeout_sec"`
+	// seconds unused connections are kept open for the next commands
+	// (default 300), connections are not kept when negative
+	IdleTimeout int `json:"idle_timeout_sec"`
+	// seconds between the keepalive requests sent on the unused
+	// connections (default 30)
+	KeepaliveInterval int `json:"keepalive_interval_sec"`
+}
+
+// SshNodeConfig are the credentials of a node. The settings left empty
+// are taken from the executor configuration, and the auth method is
+// the one the settings are given for if it is not set.
+type SshNodeConfig struct {
+	User            string `json:"user"`
+	Auth            string `json:"auth"`
+	PrivateKeyFile  string `json:"keyfile"`
+	CertificateFile string `json:"certfile"`
+	PasswordFile    string `json:"password_file"`
+	PasswordEnv     string `json:"password_env"`
 }
@@ -10,11 +10,15 @@
 package sshexec
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/chinacoolhacker/heketi/executors"
 	"github.com/chinacoolhacker/heketi/executors/cmdexec"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"github.com/chinacoolhacker/heketi/pkg/utils/ssh"
@@ -22,7 +26,7 @@ import (
 )
 
 type Ssher interface {
-	ConnectAndExec(host string, commands []string, timeoutMinutes int, useSudo bool) ([]string, error)
+	ConnectAndExecContext(ctx context.Context, host string, commands []string, timeoutMinutes int, useSudo bool) ([]string, error)
 }
 
 type SshExecutor struct {
@@ -34,17 +38,29 @@ type SshExecutor struct {
 	exec            Ssher
 	config          *SshConfig
 	port            string
+	hostKeys        *ssh.HostKeyVerifier
 }
 
 var (
 	ErrSshPrivateKey = errors.New("Unable to read private key file")
-	sshNew           = func(logger *utils.Logger, user string, file string) (Ssher, error) {
-		s := ssh.NewSshExecWithKeyFile(logger, user, file)
-		if s == nil {
-			return nil, ErrSshPrivateKey
+	sshNew           = func(logger *utils.Logger, creds ssh.Credentials,
+		nodes map[string]ssh.Credentials, hostKeys *ssh.HostKeyVerifier,
+		pool ssh.PoolConfig) (Ssher, error) {
+
+		s, err := ssh.NewSshExecWithCredentials(logger, creds)
+		if err != nil {
+			return nil, err
+		}
+		for host, c := range nodes {
+			if err := s.SetHostCredentials(host, c); err != nil {
+				return nil, fmt.Errorf("Credentials of node %v: %v", host, err)
+			}
 		}
+		s.SetHostKeyVerifier(hostKeys)
+		s.SetPoolConfig(pool)
 		return s, nil
 	}
+	sshScanHostKey = ssh.ScanHostKey
 )
 
 func setWithEnvVariables(config *SshConfig) {
@@ -55,6 +71,16 @@ func setWithEnvVariables(config *SshConfig) {
 		config.PrivateKeyFile = env
 	}
 
+	env = os.Getenv("HEKETI_SSH_AUTH")
+	if "" != env {
+		config.Auth = env
+	}
+
+	env = os.Getenv("HEKETI_SSH_CERTFILE")
+	if "" != env {
+		config.CertificateFile = env
+	}
+
 	env = os.Getenv("HEKETI_SSH_USER")
 	if "" != env {
 		config.User = env
@@ -65,6 +91,16 @@ func setWithEnvVariables(config *SshConfig) {
 		config.Port = env
 	}
 
+	env = os.Getenv("HEKETI_SSH_KNOWN_HOSTS_FILE")
+	if "" != env {
+		config.KnownHostsFile = env
+	}
+
+	env = os.Getenv("HEKETI_SSH_HOST_KEY_POLICY")
+	if "" != env {
+		config.HostKeyPolicy = env
+	}
+
 	env = os.Getenv("HEKETI_FSTAB")
 	if "" != env {
 		config.Fstab = env
@@ -86,12 +122,11 @@ func NewSshExecutor(config *SshConfig) (*SshExecutor, error) {
 
 	s := &SshExecutor{}
 	s.RemoteExecutor = s
-	s.Throttlemap = make(map[string]chan bool)
+	s.InitThrottle()
+	s.Configure(&config.CmdConfig)
+	s.SshTransport = true
 
 	// Set configuration
-	if config.PrivateKeyFile == "" {
-		return nil, fmt.Errorf("Missing ssh private key file in configuration")
-	}
 	s.private_keyfile = config.PrivateKeyFile
 
 	if config.User == "" {
@@ -115,9 +150,39 @@ func NewSshExecutor(config *SshConfig) (*SshExecutor, error) {
 	// Save the configuration
 	s.config = config
 
-	// Setup key
+	// Setup host key verification
+	policy := ssh.HostKeyPolicy(config.HostKeyPolicy)
+	if policy == "" {
+		if config.KnownHostsFile != "" {
+			policy = ssh.HostKeyStrict
+		} else {
+			policy = ssh.HostKeyInsecure
+		}
+	}
 	var err error
-	s.exec, err = sshNew(s.Logger(), s.user, s.private_keyfile)
+	s.hostKeys, err = ssh.NewHostKeyVerifier(policy, config.KnownHostsFile)
+	if err != nil {
+		s.Logger().Err(err)
+		return nil, err
+	}
+	if policy == ssh.HostKeyInsecure {
+		s.Logger().Warning("The host keys of the nodes with no known or pinned key are not verified")
+	}
+
+	// Setup credentials
+	defaults := defaultCredentials(s.user, config)
+	creds, err := defaults.credentials()
+	if err != nil {
+		s.Logger().Err(err)
+		return nil, err
+	}
+	nodes, err := nodeCredentials(defaults, config.Nodes)
+	if err != nil {
+		s.Logger().Err(err)
+		return nil, err
+	}
+	s.exec, err = sshNew(s.Logger(), creds, nodes, s.hostKeys,
+		poolConfig(config))
 	if err != nil {
 		s.Logger().Err(err)
 		return nil, err
@@ -126,23 +191,105 @@ func NewSshExecutor(config *SshConfig) (*SshExecutor, error) {
 	godbc.Ensure(s != nil)
 	godbc.Ensure(s.config == config)
 	godbc.Ensure(s.user != "")
-	godbc.Ensure(s.private_keyfile != "")
 	godbc.Ensure(s.port != "")
 	godbc.Ensure(s.Fstab != "")
 
 	return s, nil
 }
 
-func (s *SshExecutor) RemoteCommandExecute(host string,
+// poolConfig returns the configuration of the connections to the nodes.
+func poolConfig(config *SshConfig) ssh.PoolConfig {
+	pool := ssh.DefaultPoolConfig
+	if config.DialTimeout > 0 {
+		pool.DialTimeout = time.Second * time.Duration(config.DialTimeout)
+	}
+	if config.IdleTimeout < 0 {
+		pool.IdleTimeout = 0
+	} else if config.IdleTimeout > 0 {
+		pool.IdleTimeout = time.Second * time.Duration(config.IdleTimeout)
+	}
+	if config.KeepaliveInterval > 0 {
+		pool.KeepaliveInterval = time.Second * time.Duration(config.KeepaliveInterval)
+	}
+	return pool
+}
+
+// WithContext returns a copy of the executor whose commands are
+// cancelled once ctx is done.
+func (s *SshExecutor) WithContext(ctx context.Context) executors.Executor {
+	c := *s
+	c.RemoteExecutor = &c
+	c.SetContext(ctx)
+	return &c
+}
+
+func (s *SshExecutor) RemoteCommandExecute(ctx context.Context,
+	host string,
 	commands []string,
 	timeoutMinutes int) ([]string, error) {
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// Throttle
-	s.AccessConnection(host)
+	if err := s.AccessConnectionContext(ctx, host); err != nil {
+		return nil, err
+	}
 	defer s.FreeConnection(host)
+	executors.ReportHost(ctx, host)
 
 	// Execute
-	return s.exec.ConnectAndExec(host+":"+s.port, commands, timeoutMinutes, s.config.Sudo)
+	output, err := s.exec.ConnectAndExecContext(ctx, host+":"+s.port, commands, timeoutMinutes, s.config.Sudo)
+	return output, commandError(host, err)
+}
+
+// commandError returns err, the failure of the commands sent to host,
+// as an *executors.Error if its kind is known.
+func commandError(host string, err error) error {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *ssh.CommandError:
+		return executors.NewCommandError(host, e.ExitStatus, e.Stdout, e.Stderr)
+	case net.Error:
+		return &executors.Error{
+			Kind:    executors.ErrorUnreachable,
+			Host:    host,
+			Message: e.Error(),
+		}
+	}
+	if err == ssh.ErrCommandTimeout {
+		return &executors.Error{
+			Kind:    executors.ErrorTimeout,
+			Host:    host,
+			Message: err.Error(),
+		}
+	}
+	return err
+}
+
+// VerifiesHostKeys returns true if the host keys of all the nodes are
+// verified and pinned. Otherwise only the keys pinned or known for
+// some of the nodes are verified.
+func (s *SshExecutor) VerifiesHostKeys() bool {
+	return s.hostKeys.Policy() != ssh.HostKeyInsecure
+}
+
+// SetHostKeyStore sets the store of the host keys pinned for the nodes.
+func (s *SshExecutor) SetHostKeyStore(store ssh.HostKeyStore) {
+	s.hostKeys.SetStore(store)
+}
+
+// HostKeyFingerprint returns the fingerprint of the host key host
+// presents, to be pinned for it.
+func (s *SshExecutor) HostKeyFingerprint(host string) (string, error) {
+	ctx := s.Context()
+	if err := s.AccessConnectionContext(ctx, host); err != nil {
+		return "", err
+	}
+	defer s.FreeConnection(host)
+	return sshScanHostKey(ctx, host+":"+s.port, s.hostKeys)
 }
 
 func (s *SshExecutor) RebalanceOnExpansion() bool {
@@ -10,11 +10,19 @@
 package sshexec
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/chinacoolhacker/heketi/executors"
 	"github.com/chinacoolhacker/heketi/executors/cmdexec"
 	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/chinacoolhacker/heketi/pkg/utils/ssh"
 	"github.com/heketi/tests"
 )
 
@@ -39,7 +47,8 @@ func NewFakeSsh() *FakeSsh {
 	return f
 }
 
-func (f *FakeSsh) ConnectAndExec(host string,
+func (f *FakeSsh) ConnectAndExecContext(ctx context.Context,
+	host string,
 	commands []string,
 	timeoutMinutes int,
 	useSudo bool) ([]string, error) {
@@ -51,7 +60,10 @@ func TestNewSshExec(t *testing.T) {
 
 	f := NewFakeSsh()
 	defer tests.Patch(&sshNew,
-		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+		func(logger *utils.Logger, creds ssh.Credentials,
+			nodes map[string]ssh.Credentials, hostKeys *ssh.HostKeyVerifier,
+			pool ssh.PoolConfig) (Ssher, error) {
+
 			return f, nil
 		}).Restore()
 
@@ -78,7 +90,10 @@ func TestSshExecRebalanceOnExpansion(t *testing.T) {
 
 	f := NewFakeSsh()
 	defer tests.Patch(&sshNew,
-		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+		func(logger *utils.Logger, creds ssh.Credentials,
+			nodes map[string]ssh.Credentials, hostKeys *ssh.HostKeyVerifier,
+			pool ssh.PoolConfig) (Ssher, error) {
+
 			return f, nil
 		}).Restore()
 
@@ -126,7 +141,10 @@ func TestSshExecRebalanceOnExpansion(t *testing.T) {
 func TestNewSshExecDefaults(t *testing.T) {
 	f := NewFakeSsh()
 	defer tests.Patch(&sshNew,
-		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+		func(logger *utils.Logger, creds ssh.Credentials,
+			nodes map[string]ssh.Credentials, hostKeys *ssh.HostKeyVerifier,
+			pool ssh.PoolConfig) (Ssher, error) {
+
 			return f, nil
 		}).Restore()
 
@@ -142,6 +160,7 @@ func TestNewSshExecDefaults(t *testing.T) {
 	tests.Assert(t, s.port == "22")
 	tests.Assert(t, s.Fstab == "/etc/fstab")
 	tests.Assert(t, s.exec != nil)
+	tests.Assert(t, !s.VerifiesHostKeys())
 
 }
 
@@ -157,7 +176,10 @@ func TestSshExecutorEnvVariables(t *testing.T) {
 
 	f := NewFakeSsh()
 	defer tests.Patch(&sshNew,
-		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+		func(logger *utils.Logger, creds ssh.Credentials,
+			nodes map[string]ssh.Credentials, hostKeys *ssh.HostKeyVerifier,
+			pool ssh.PoolConfig) (Ssher, error) {
+
 			return f, nil
 		}).Restore()
 
@@ -204,3 +226,256 @@ func TestSshExecutorEnvVariables(t *testing.T) {
 	tests.Assert(t, s.exec != nil)
 
 }
+
+func TestSshExecutorWithContext(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, creds ssh.Credentials,
+			nodes map[string]ssh.Credentials, hostKeys *ssh.HostKeyVerifier,
+			pool ssh.PoolConfig) (Ssher, error) {
+
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+
+	calls := 0
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		calls++
+		return []string{""}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e := executors.WithContext(ctx, s)
+	tests.Assert(t, e != executors.Executor(s))
+
+	err = e.GlusterdCheck("host")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, calls == 1, "expected 1 call, got:", calls)
+
+	// no commands are sent once the context is cancelled
+	cancel()
+	err = e.GlusterdCheck("host")
+	tests.Assert(t, err == context.Canceled, "expected context.Canceled, got:", err)
+	tests.Assert(t, calls == 1, "expected 1 call, got:", calls)
+
+	// the original executor is not bound to the context
+	err = s.GlusterdCheck("host")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, calls == 2, "expected 2 calls, got:", calls)
+}
+
+func TestSshExecutorHostKeys(t *testing.T) {
+	f := NewFakeSsh()
+	var verifier *ssh.HostKeyVerifier
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, creds ssh.Credentials,
+			nodes map[string]ssh.Credentials, hostKeys *ssh.HostKeyVerifier,
+			pool ssh.PoolConfig) (Ssher, error) {
+
+			verifier = hostKeys
+			return f, nil
+		}).Restore()
+	defer tests.Patch(&sshScanHostKey,
+		func(ctx context.Context, host string,
+			hostKeys *ssh.HostKeyVerifier) (string, error) {
+
+			tests.Assert(t, host == "myhost:100", "got:", host)
+			tests.Assert(t, hostKeys == verifier)
+			return "SHA256:abc", nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		Port:           "100",
+		HostKeyPolicy:  "tofu",
+	}
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, s.VerifiesHostKeys())
+	tests.Assert(t, verifier.Policy() == ssh.HostKeyTofu)
+
+	fp, err := s.HostKeyFingerprint("myhost")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, fp == "SHA256:abc", "got:", fp)
+
+	// the policy must be known
+	config.HostKeyPolicy = "trusting"
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err != nil)
+
+	// a known_hosts file makes the default policy strict
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	config.HostKeyPolicy = ""
+	config.KnownHostsFile = tmpfile
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err != nil, "expected missing known_hosts file to fail")
+	file, err := os.Create(tmpfile)
+	tests.Assert(t, err == nil)
+	file.Close()
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, verifier.Policy() == ssh.HostKeyStrict)
+}
+
+func TestSshExecPoolConfig(t *testing.T) {
+	var got ssh.PoolConfig
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, creds ssh.Credentials,
+			nodes map[string]ssh.Credentials, hostKeys *ssh.HostKeyVerifier,
+			pool ssh.PoolConfig) (Ssher, error) {
+
+			got = pool
+			return NewFakeSsh(), nil
+		}).Restore()
+
+	_, err := NewSshExecutor(&SshConfig{PrivateKeyFile: "xkeyfile"})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, got == ssh.DefaultPoolConfig, "got:", got)
+
+	_, err = NewSshExecutor(&SshConfig{
+		PrivateKeyFile:    "xkeyfile",
+		DialTimeout:       5,
+		IdleTimeout:       60,
+		KeepaliveInterval: 10,
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, got.DialTimeout == 5*time.Second, "got:", got)
+	tests.Assert(t, got.IdleTimeout == time.Minute, "got:", got)
+	tests.Assert(t, got.KeepaliveInterval == 10*time.Second, "got:", got)
+
+	// connections are not kept
+	_, err = NewSshExecutor(&SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		IdleTimeout:    -1,
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, got.IdleTimeout == 0, "got:", got)
+}
+
+func TestSshExecCredentials(t *testing.T) {
+	var (
+		creds ssh.Credentials
+		nodes map[string]ssh.Credentials
+	)
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, c ssh.Credentials,
+			n map[string]ssh.Credentials, hostKeys *ssh.HostKeyVerifier,
+			pool ssh.PoolConfig) (Ssher, error) {
+
+			creds, nodes = c, n
+			return NewFakeSsh(), nil
+		}).Restore()
+
+	passwordFile := tests.Tempfile()
+	defer os.Remove(passwordFile)
+	err := ioutil.WriteFile(passwordFile, []byte("secret\n"), 0600)
+	tests.Assert(t, err == nil)
+	os.Setenv("TEST_HEKETI_SSH_PASSWORD", "other")
+	defer os.Unsetenv("TEST_HEKETI_SSH_PASSWORD")
+
+	config := &SshConfig{
+		User:         "xuser",
+		Auth:         "password",
+		PasswordFile: passwordFile,
+		Nodes: map[string]SshNodeConfig{
+			"node1": {
+				PrivateKeyFile:  "xkeyfile",
+				CertificateFile: "xcertfile",
+			},
+			"node2": {
+				User: "root",
+				Auth: "agent",
+			},
+			"node3": {
+				PasswordEnv: "TEST_HEKETI_SSH_PASSWORD",
+			},
+		},
+	}
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, creds == ssh.Credentials{User: "xuser", Password: "secret"},
+		"got:", creds)
+	tests.Assert(t, len(nodes) == 3)
+	tests.Assert(t, nodes["node1"] == ssh.Credentials{
+		User:            "xuser",
+		KeyFile:         "xkeyfile",
+		CertificateFile: "xcertfile",
+	}, "got:", nodes["node1"])
+	tests.Assert(t, nodes["node2"] == ssh.Credentials{User: "root", Agent: true},
+		"got:", nodes["node2"])
+	tests.Assert(t, nodes["node3"] == ssh.Credentials{User: "xuser", Password: "other"},
+		"got:", nodes["node3"])
+
+	// the settings of the chosen auth method must be set
+	for _, c := range []*SshConfig{
+		{Auth: "password"},
+		{Auth: "password", PasswordEnv: "TEST_HEKETI_SSH_NOT_SET"},
+		{Auth: "kerberos"},
+		{
+			Auth: "agent",
+			Nodes: map[string]SshNodeConfig{
+				"node1": {Auth: "keyfile"},
+			},
+		},
+	} {
+		s, err := NewSshExecutor(c)
+		tests.Assert(t, s == nil)
+		tests.Assert(t, err != nil)
+	}
+}
+
+func TestSshExecutorErrors(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, creds ssh.Credentials,
+			nodes map[string]ssh.Credentials, hostKeys *ssh.HostKeyVerifier,
+			pool ssh.PoolConfig) (Ssher, error) {
+
+			return f, nil
+		}).Restore()
+
+	s, err := NewSshExecutor(&SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+	})
+	tests.Assert(t, err == nil)
+
+	var sshErr error
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		return nil, sshErr
+	}
+
+	// the failed commands are classified by their error output
+	sshErr = &ssh.CommandError{
+		ExitStatus: 1,
+		Stderr:     "volume stop: vol1: failed: Volume vol1 does not exist",
+	}
+	_, err = s.VolumeInfo("host", "vol1")
+	tests.Assert(t, executors.KindOf(err) == executors.ErrorNotFound, err)
+	tests.Assert(t, err.(*executors.Error).Host == "host", err)
+
+	sshErr = ssh.ErrCommandTimeout
+	err = s.GlusterdCheck("host")
+	tests.Assert(t, executors.KindOf(err) == executors.ErrorTimeout, err)
+
+	sshErr = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	err = s.GlusterdCheck("host")
+	tests.Assert(t, executors.KindOf(err) == executors.ErrorUnreachable, err)
+	tests.Assert(t, strings.Contains(err.Error(), "connection refused"), err)
+}
@@ -16,13 +16,13 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
 	"github.com/chinacoolhacker/heketi/apps"
 	"github.com/chinacoolhacker/heketi/apps/glusterfs"
 	"github.com/chinacoolhacker/heketi/middleware"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/ha"
 	"github.com/spf13/cobra"
 	"github.com/urfave/negroni"
 
@@ -34,6 +34,7 @@ type Config struct {
 	AuthEnabled          bool                     `json:"use_auth"`
 	JwtConfig            middleware.JwtAuthConfig `json:"jwt"`
 	BackupDbToKubeSecret bool                     `json:"backup_db_to_kube_secret"`
+	HaConfig             ha.Config                `json:"ha"`
 }
 
 var (
@@ -42,8 +43,12 @@ var (
 	showVersion                  bool
 	jsonFile                     string
 	dbFile                       string
+	dbBackend                    string
 	debugOutput                  bool
 	deleteAllBricksWithEmptyPath bool
+	dbKey                        string
+	newDbKey                     string
+	decryptDb                    bool
 )
 
 var RootCmd = &cobra.Command{
@@ -87,7 +92,7 @@ var importdbCmd = &cobra.Command{
 			fmt.Fprintln(os.Stderr, "Please provide path for db file")
 			os.Exit(1)
 		}
-		err := glusterfs.DbCreate(jsonFile, dbFile, debugOutput)
+		err := glusterfs.DbCreate(jsonFile, dbFile, dbBackend, dbKeyOrEnv(), debugOutput)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "db creation failed: %v\n", err.Error())
 			os.Exit(1)
@@ -111,7 +116,7 @@ var exportdbCmd = &cobra.Command{
 			fmt.Fprintln(os.Stderr, "Please provide path for db file")
 			os.Exit(1)
 		}
-		err := glusterfs.DbDump(jsonFile, dbFile, debugOutput)
+		err := glusterfs.DbDump(jsonFile, dbFile, dbKeyOrEnv(), debugOutput)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to dump db: %v\n", err.Error())
 			os.Exit(1)
@@ -154,7 +159,7 @@ var deleteBricksWithEmptyPath = &cobra.Command{
 			fmt.Fprintf(os.Stderr, "neither --all flag nor list of clusters/nodes/devices is given\n")
 			os.Exit(1)
 		}
-		db, err := bolt.Open(dbFile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+		db, err := wdb.Open("", dbFile, false)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Unable to open database: %v\n", err)
 			os.Exit(1)
@@ -169,6 +174,45 @@ var deleteBricksWithEmptyPath = &cobra.Command{
 	},
 }
 
+var rekeydbCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "changes the key used to encrypt sensitive fields of a db file",
+	Long: "changes the key used to encrypt sensitive fields of a db file." +
+		" The current key is read from --key or HEKETI_DB_ENCRYPTION_KEY" +
+		" and the new key from --new-key or HEKETI_DB_NEW_ENCRYPTION_KEY." +
+		" A db that is not encrypted yet gets encrypted with the new key.",
+	Example: "heketi db rekey --dbfile=/db/file/path/ --key=old --new-key=new",
+	Run: func(cmd *cobra.Command, args []string) {
+		if dbFile == "" {
+			fmt.Fprintln(os.Stderr, "Please provide path for db file")
+			os.Exit(1)
+		}
+		if newDbKey == "" {
+			newDbKey = os.Getenv("HEKETI_DB_NEW_ENCRYPTION_KEY")
+		}
+		if newDbKey == "" && !decryptDb {
+			fmt.Fprintln(os.Stderr, "Please provide a new key or --decrypt")
+			os.Exit(1)
+		}
+		err := glusterfs.DbRekey(dbFile, dbKeyOrEnv(), newDbKey, decryptDb, debugOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to rekey db: %v\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "DB rekeyed", dbFile)
+		os.Exit(0)
+	},
+}
+
+// dbKeyOrEnv returns the db encryption key given on the command line
+// or, if none was given, the one set in the environment.
+func dbKeyOrEnv() string {
+	if dbKey != "" {
+		return dbKey
+	}
+	return os.Getenv("HEKETI_DB_ENCRYPTION_KEY")
+}
+
 func init() {
 	RootCmd.Flags().StringVar(&configfile, "config", "", "Configuration file")
 	RootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "Show version")
@@ -180,13 +224,16 @@ func init() {
 	dbCmd.AddCommand(importdbCmd)
 	importdbCmd.Flags().StringVar(&jsonFile, "jsonfile", "", "Input file with data in JSON format")
 	importdbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to be created")
+	importdbCmd.Flags().StringVar(&dbBackend, "backend", "bolt", "Storage backend of the db to be created (bolt or localkv)")
 	importdbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	importdbCmd.Flags().StringVar(&dbKey, "key", "", "Key to encrypt sensitive fields of the db with")
 	importdbCmd.SilenceUsage = true
 
 	dbCmd.AddCommand(exportdbCmd)
 	exportdbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to be exported")
 	exportdbCmd.Flags().StringVar(&jsonFile, "jsonfile", "", "File path for JSON file to be created")
 	exportdbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	exportdbCmd.Flags().StringVar(&dbKey, "key", "", "Key to decrypt sensitive fields of the db with")
 	exportdbCmd.SilenceUsage = true
 
 	dbCmd.AddCommand(deleteBricksWithEmptyPath)
@@ -197,6 +244,14 @@ func init() {
 	deleteBricksWithEmptyPath.Flags().StringSlice("nodes", []string{}, "comma separated list of node IDs")
 	deleteBricksWithEmptyPath.Flags().StringSlice("devices", []string{}, "comma separated list of device IDs")
 	deleteBricksWithEmptyPath.SilenceUsage = true
+
+	dbCmd.AddCommand(rekeydbCmd)
+	rekeydbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to operate on")
+	rekeydbCmd.Flags().StringVar(&dbKey, "key", "", "Current key of the db")
+	rekeydbCmd.Flags().StringVar(&newDbKey, "new-key", "", "New key of the db")
+	rekeydbCmd.Flags().BoolVar(&decryptDb, "decrypt", false, "Remove the encryption from the db")
+	rekeydbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	rekeydbCmd.SilenceUsage = true
 }
 
 func setWithEnvVariables(options *Config) {
@@ -224,6 +279,11 @@ func setWithEnvVariables(options *Config) {
 	if "" != env {
 		options.BackupDbToKubeSecret = true
 	}
+
+	env = os.Getenv("HEKETI_HA_ADVERTISE_URL")
+	if "" != env {
+		options.HaConfig.AdvertiseUrl = env
+	}
 }
 
 func main() {
@@ -259,6 +319,65 @@ func main() {
 	// Substitute values using any set environment variables
 	setWithEnvVariables(&options)
 
+	// Shutdown on CTRL-C signal
+	// For a better cleanup, we should shutdown the server and
+	signalch := make(chan os.Signal, 1)
+	signal.Notify(signalch, os.Interrupt, os.Kill, syscall.SIGINT, syscall.SIGTERM)
+
+	// Create a channel to know if the server was unable to start
+	done := make(chan bool)
+	handler := ha.NewSwitch(nil)
+	serve := func() {
+		go func() {
+			// Start the server.
+			fmt.Printf("Listening on port %v\n", options.Port)
+			err := http.ListenAndServe(":"+options.Port, handler)
+			if err != nil {
+				fmt.Printf("ERROR: HTTP Server error: %v\n", err)
+			}
+			done <- true
+		}()
+	}
+
+	// When running more than one instance, only the leader runs the
+	// application. Until this instance is elected it forwards the
+	// requests to the leader.
+	var elector ha.Elector
+	var lost <-chan struct{}
+	if options.HaConfig.Election != "" {
+		elector, err = ha.NewElector(&options.HaConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Unable to setup leader election: %v\n", err)
+			os.Exit(1)
+		}
+		handler.Set(newRouter(
+			ha.NewFollowerHandler(elector, options.HaConfig.Redirect,
+				options.HaConfig.ProxyTimeoutDuration()), nil))
+		serve()
+
+		fmt.Println("Waiting to be elected leader")
+		stop := make(chan struct{})
+		elected := make(chan error, 1)
+		go func() {
+			elected <- elector.Campaign(stop)
+		}()
+		select {
+		case err = <-elected:
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: Leader election failed: %v\n", err)
+				os.Exit(1)
+			}
+		case <-signalch:
+			close(stop)
+			fmt.Printf("Shutting down...\n")
+			return
+		case <-done:
+			os.Exit(1)
+		}
+		fmt.Println("Elected leader")
+		lost = elector.Lost()
+	}
+
 	// Use negroni to add middleware.  Here we add two
 	// middlewares: Recovery and Logger, which come with
 	// Negroni
@@ -277,15 +396,6 @@ func main() {
 	}
 	app = glusterfsApp
 
-	// Add /hello router
-	router := mux.NewRouter()
-	router.Methods("GET").Path("/hello").Name("Hello").HandlerFunc(
-		func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprint(w, "Hello from Heketi")
-		})
-
 	// Create a router and do not allow any routes
 	// unless defined.
 	heketiRouter := mux.NewRouter().StrictSlash(true)
@@ -325,34 +435,44 @@ func main() {
 	n.UseHandler(heketiRouter)
 
 	// Setup complete routing
-	router.NewRoute().Handler(n)
-
-	// Shutdown on CTRL-C signal
-	// For a better cleanup, we should shutdown the server and
-	signalch := make(chan os.Signal, 1)
-	signal.Notify(signalch, os.Interrupt, os.Kill, syscall.SIGINT, syscall.SIGTERM)
-
-	// Create a channel to know if the server was unable to start
-	done := make(chan bool)
-	go func() {
-		// Start the server.
-		fmt.Printf("Listening on port %v\n", options.Port)
-		err = http.ListenAndServe(":"+options.Port, router)
-		if err != nil {
-			fmt.Printf("ERROR: HTTP Server error: %v\n", err)
-		}
-		done <- true
-	}()
+	handler.Set(newRouter(n, glusterfsApp.Metrics))
+	if elector == nil {
+		serve()
+	}
 
 	// Block here for signals and errors from the HTTP server
+	exitCode := 0
 	select {
 	case <-signalch:
 	case <-done:
+	case <-lost:
+		fmt.Fprintln(os.Stderr, "ERROR: Lost leadership")
+		exitCode = 1
 	}
 	fmt.Printf("Shutting down...\n")
 
 	// Shutdown the application
 	// :TODO: Need to shutdown the server
 	app.Close()
+	if elector != nil {
+		elector.Resign()
+	}
+	os.Exit(exitCode)
+}
 
+// newRouter returns a router answering /hello, and /metrics when
+// metrics is set, itself and passing all other requests to handler.
+func newRouter(handler http.Handler, metrics http.HandlerFunc) *mux.Router {
+	router := mux.NewRouter()
+	router.Methods("GET").Path("/hello").Name("Hello").HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, "Hello from Heketi")
+		})
+	if metrics != nil {
+		router.Methods("GET").Path("/metrics").Name("Metrics").HandlerFunc(metrics)
+	}
+	router.NewRoute().Handler(handler)
+	return router
 }
@@ -0,0 +1,146 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// Package agenttest runs node agents over mTLS for the tests.
+package agenttest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/pkg/agent"
+	"github.com/lpabon/godbc"
+)
+
+// AgentTestServer is a node agent listening on 127.0.0.1 with a
+// certificate signed by a test certificate authority.
+type AgentTestServer struct {
+	Ts   *httptest.Server
+	Host string
+	Port string
+
+	// files of a client certificate signed by the same authority
+	ClientFiles agent.TLSFiles
+
+	dir string
+}
+
+// NewAgentTestServer starts an agent running its commands with run.
+//
+// Example:
+//
+//	a := agenttest.NewAgentTestServer(runner)
+//	defer a.Close()
+func NewAgentTestServer(run agent.Runner) *AgentTestServer {
+	return NewAgentTestServerHandler(agent.NewServer(nil, run).Handler())
+}
+
+// NewAgentTestServerHandler starts a fake agent answering the requests
+// with handler.
+func NewAgentTestServerHandler(handler http.Handler) *AgentTestServer {
+	dir, err := ioutil.TempDir("", "heketi-agent")
+	godbc.Check(err == nil, err)
+
+	a := &AgentTestServer{dir: dir}
+	ca, caKey := newCertificate(nil, nil, "heketi-test-ca")
+	writeFiles(dir, "ca", ca, caKey)
+	server, serverKey := newCertificate(ca, caKey, "heketi-agent")
+	writeFiles(dir, "server", server, serverKey)
+	client, clientKey := newCertificate(ca, caKey, "heketi")
+	writeFiles(dir, "client", client, clientKey)
+
+	serverFiles := agent.TLSFiles{
+		CertFile:   filepath.Join(dir, "server.crt"),
+		KeyFile:    filepath.Join(dir, "server.key"),
+		CACertFile: filepath.Join(dir, "ca.crt"),
+	}
+	a.ClientFiles = agent.TLSFiles{
+		CertFile:   filepath.Join(dir, "client.crt"),
+		KeyFile:    filepath.Join(dir, "client.key"),
+		CACertFile: filepath.Join(dir, "ca.crt"),
+	}
+
+	tlsConfig, err := serverFiles.ServerConfig()
+	godbc.Check(err == nil, err)
+	a.Ts = httptest.NewUnstartedServer(handler)
+	a.Ts.TLS = tlsConfig
+	a.Ts.StartTLS()
+
+	a.Host, a.Port, err = net.SplitHostPort(a.Ts.Listener.Addr().String())
+	godbc.Check(err == nil, err)
+	return a
+}
+
+// Close stops the agent and removes its certificates.
+func (a *AgentTestServer) Close() {
+	a.Ts.Close()
+	os.RemoveAll(a.dir)
+}
+
+// newCertificate returns a certificate of name valid for 127.0.0.1,
+// signed by parent, or a self-signed certificate authority if parent
+// is nil.
+func newCertificate(parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey,
+	name string) (*x509.Certificate, *ecdsa.PrivateKey) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	godbc.Check(err == nil, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	godbc.Check(err == nil, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent,
+		&key.PublicKey, parentKey)
+	godbc.Check(err == nil, err)
+	cert, err := x509.ParseCertificate(der)
+	godbc.Check(err == nil, err)
+	return cert, key
+}
+
+func writeFiles(dir, name string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	der, err := x509.MarshalECPrivateKey(key)
+	godbc.Check(err == nil, err)
+	err = ioutil.WriteFile(filepath.Join(dir, name+".crt"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600)
+	godbc.Check(err == nil, err)
+	err = ioutil.WriteFile(filepath.Join(dir, name+".key"),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	godbc.Check(err == nil, err)
+}
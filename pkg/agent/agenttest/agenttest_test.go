@@ -0,0 +1,57 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agenttest
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/pkg/agent"
+	"github.com/heketi/tests"
+)
+
+func TestAgentTestServerMutualTLS(t *testing.T) {
+	var commands [][]string
+	a := NewAgentTestServer(func(ctx context.Context, args []string) (string, error) {
+		commands = append(commands, args)
+		return "ok", nil
+	})
+	defer a.Close()
+
+	tlsConfig, err := a.ClientFiles.ClientConfig()
+	tests.Assert(t, err == nil, err)
+	c := agent.NewClient(a.Port, tlsConfig)
+	output, err := c.Gluster(context.Background(), a.Host, "--version")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, output == "ok", output)
+	tests.Assert(t, len(commands) == 1, commands)
+
+	// a client without a certificate is refused
+	tlsConfig.Certificates = nil
+	c = agent.NewClient(a.Port, tlsConfig)
+	_, err = c.Gluster(context.Background(), a.Host, "--version")
+	tests.Assert(t, err != nil)
+
+	// a client which does not know the authority refuses the agent
+	c = agent.NewClient(a.Port, &tls.Config{})
+	_, err = c.Gluster(context.Background(), a.Host, "--version")
+	tests.Assert(t, err != nil)
+
+	tests.Assert(t, len(commands) == 1, commands)
+}
+
+func TestTLSFilesRequired(t *testing.T) {
+	files := agent.TLSFiles{CertFile: "cert.pem"}
+	_, err := files.ClientConfig()
+	tests.Assert(t, err != nil)
+	_, err = files.ServerConfig()
+	tests.Assert(t, err != nil)
+}
@@ -0,0 +1,182 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client sends requests to the agents of the nodes.
+type Client struct {
+	client *http.Client
+	port   string
+	scheme string
+}
+
+// NewClient returns a client of the agents listening on port. The
+// agents are reached over https with tlsConfig, or over plain http if
+// it is nil.
+func NewClient(port string, tlsConfig *tls.Config) *Client {
+	transport := &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     5 * time.Minute,
+	}
+	c := &Client{
+		client: &http.Client{Transport: transport},
+		port:   port,
+		scheme: "http",
+	}
+	if tlsConfig != nil {
+		c.scheme = "https"
+	}
+	return c
+}
+
+// Call sends the request in to the endpoint path of the agent of host
+// and decodes its answer into out, if not nil. The errors answered by
+// the agent are returned as an Error.
+func (c *Client) Call(ctx context.Context,
+	host, path string, in, out interface{}) error {
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%v://%v%v", c.scheme, net.JoinHostPort(host, c.port), path)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	r, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(r.Body)
+		var e Error
+		if json.Unmarshal(data, &e) != nil || e.Message == "" {
+			e = Error{
+				Code:    ErrorFailed,
+				Message: strings.TrimSpace(string(data)),
+			}
+			if e.Message == "" {
+				e.Message = http.StatusText(r.StatusCode)
+			}
+		}
+		return &e
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(r.Body).Decode(out)
+}
+
+func (c *Client) PvCreate(ctx context.Context, host, device string) error {
+	return c.Call(ctx, host, PathPvCreate, &PvRequest{Device: device}, nil)
+}
+
+func (c *Client) PvRemove(ctx context.Context, host, device string) error {
+	return c.Call(ctx, host, PathPvRemove, &PvRequest{Device: device}, nil)
+}
+
+func (c *Client) VgCreate(ctx context.Context, host, vg string, devices ...string) error {
+	return c.Call(ctx, host, PathVgCreate, &VgRequest{Vg: vg, Devices: devices}, nil)
+}
+
+func (c *Client) VgRemove(ctx context.Context, host, vg string) error {
+	return c.Call(ctx, host, PathVgRemove, &VgRequest{Vg: vg}, nil)
+}
+
+func (c *Client) VgInfo(ctx context.Context, host, vg string) (*VgInfo, error) {
+	var info VgInfo
+	if err := c.Call(ctx, host, PathVgInfo, &VgRequest{Vg: vg}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) ThinLvCreate(ctx context.Context, host string, req *ThinLvRequest) error {
+	return c.Call(ctx, host, PathThinLvCreate, req, nil)
+}
+
+func (c *Client) LvRemove(ctx context.Context, host, vg, lv string) error {
+	return c.Call(ctx, host, PathLvRemove, &LvRequest{Vg: vg, Lv: lv}, nil)
+}
+
+func (c *Client) ThinPoolUsage(ctx context.Context, host, vg, pool string) (*ThinPoolUsage, error) {
+	var usage ThinPoolUsage
+	err := c.Call(ctx, host, PathThinPoolUsage, &LvRequest{Vg: vg, Lv: pool}, &usage)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+func (c *Client) Mkfs(ctx context.Context, host, device string) error {
+	return c.Call(ctx, host, PathMkfs, &MkfsRequest{Device: device}, nil)
+}
+
+func (c *Client) Mount(ctx context.Context, host string, req *MountRequest) error {
+	return c.Call(ctx, host, PathMount, req, nil)
+}
+
+func (c *Client) Unmount(ctx context.Context, host string, req *UnmountRequest) error {
+	return c.Call(ctx, host, PathUnmount, req, nil)
+}
+
+func (c *Client) Mkdir(ctx context.Context, host string, req *DirRequest) error {
+	return c.Call(ctx, host, PathMkdir, req, nil)
+}
+
+func (c *Client) Rmdir(ctx context.Context, host, path string) error {
+	return c.Call(ctx, host, PathRmdir, &DirRequest{Path: path}, nil)
+}
+
+func (c *Client) Gluster(ctx context.Context, host string, args ...string) (string, error) {
+	var resp CommandResponse
+	err := c.Call(ctx, host, PathGluster, &CommandRequest{Args: args}, &resp)
+	return resp.Output, err
+}
+
+func (c *Client) GlusterBlock(ctx context.Context, host string, args ...string) (string, error) {
+	var resp CommandResponse
+	err := c.Call(ctx, host, PathGlusterBlock, &CommandRequest{Args: args}, &resp)
+	return resp.Output, err
+}
+
+func (c *Client) ServiceStatus(ctx context.Context, host, service string) (*ServiceStatus, error) {
+	var status ServiceStatus
+	err := c.Call(ctx, host, PathServiceStatus, &ServiceRequest{Service: service}, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
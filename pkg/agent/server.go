@@ -0,0 +1,584 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+var logger = utils.NewLogger("[agent]", utils.LEVEL_INFO)
+
+const (
+	// options of the brick mounts
+	defaultMountOptions = "rw,inode64,noatime,nouuid"
+
+	defaultFstab     = "/etc/fstab"
+	defaultMountRoot = "/var/lib/heketi/mounts"
+
+	// fields of vgdisplay -c, see the vgdisplay manpage
+	vgdisplayExtentSize  = 12
+	vgdisplayFreeExtents = 15
+)
+
+// Runner runs the command args[0] with the arguments args[1:] and
+// returns its standard output. A command that fails returns an Error.
+type Runner func(ctx context.Context, args []string) (string, error)
+
+// ExecRunner runs the commands with os/exec.
+func ExecRunner(ctx context.Context, args []string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	switch {
+	case ctx.Err() != nil:
+		return "", &Error{
+			Code:    ErrorTimeout,
+			Message: fmt.Sprintf("Command %v did not complete: %v", args[0], ctx.Err()),
+			Command: args,
+		}
+	case err != nil:
+		exitCode := -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				exitCode = status.ExitStatus()
+			}
+		} else {
+			stderr.WriteString(err.Error())
+		}
+		return "", commandError(args, exitCode, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// ServerConfig is the configuration of the agent of a node.
+type ServerConfig struct {
+	// fstab file the mounts of the bricks are added to (default
+	// /etc/fstab)
+	Fstab string
+	// directory the bricks are mounted in, the mount points and the
+	// directories created and removed by the agent must be in it
+	// (default /var/lib/heketi/mounts)
+	MountRoot string
+}
+
+// Server answers the requests of heketi on a node.
+type Server struct {
+	config ServerConfig
+	run    Runner
+
+	// serializes the changes of the fstab file
+	fstabLock sync.Mutex
+}
+
+// NewServer returns a server with config, the default one if nil,
+// running its commands with run, or with os/exec if run is nil.
+func NewServer(config *ServerConfig, run Runner) *Server {
+	s := &Server{run: run}
+	if config != nil {
+		s.config = *config
+	}
+	if s.config.Fstab == "" {
+		s.config.Fstab = defaultFstab
+	}
+	if s.config.MountRoot == "" {
+		s.config.MountRoot = defaultMountRoot
+	}
+	s.config.MountRoot = filepath.Clean(s.config.MountRoot)
+	if s.run == nil {
+		s.run = ExecRunner
+	}
+	return s
+}
+
+// Handler returns the handler of the endpoints of the server.
+func (s *Server) Handler() http.Handler {
+	r := mux.NewRouter()
+	for path, handler := range map[string]func(*http.Request) (interface{}, error){
+		PathPvCreate:      s.pvCreate,
+		PathPvRemove:      s.pvRemove,
+		PathVgCreate:      s.vgCreate,
+		PathVgRemove:      s.vgRemove,
+		PathVgInfo:        s.vgInfo,
+		PathThinLvCreate:  s.thinLvCreate,
+		PathLvRemove:      s.lvRemove,
+		PathThinPoolUsage: s.thinPoolUsage,
+		PathMkfs:          s.mkfs,
+		PathMount:         s.mount,
+		PathUnmount:       s.unmount,
+		PathMkdir:         s.mkdir,
+		PathRmdir:         s.rmdir,
+		PathGluster:       s.gluster,
+		PathGlusterBlock:  s.glusterBlock,
+		PathServiceStatus: s.serviceStatus,
+	} {
+		r.Handle(path, handlerFunc(handler)).Methods("POST")
+	}
+	return r
+}
+
+// handlerFunc answers the result of handler as JSON.
+type handlerFunc func(*http.Request) (interface{}, error)
+
+func (h handlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	result, err := h(r)
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		e, ok := err.(*Error)
+		if !ok {
+			e = &Error{Code: ErrorFailed, Message: err.Error()}
+		}
+		logger.LogError("%v: %v", r.URL.Path, e)
+		w.WriteHeader(e.StatusCode())
+		json.NewEncoder(w).Encode(e)
+		return
+	}
+	if result == nil {
+		result = struct{}{}
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+func decode(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return invalidf("Invalid request: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) exec(r *http.Request, args ...string) (string, error) {
+	logger.Info("Running %v", args)
+	return s.run(r.Context(), args)
+}
+
+func (s *Server) pvCreate(r *http.Request) (interface{}, error) {
+	var req PvRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	_, err := s.exec(r, "pvcreate", "--metadatasize=128M", "--dataalignment=256K",
+		req.Device)
+	return nil, err
+}
+
+func (s *Server) pvRemove(r *http.Request) (interface{}, error) {
+	var req PvRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	_, err := s.exec(r, "pvremove", req.Device)
+	return nil, err
+}
+
+func (s *Server) vgCreate(r *http.Request) (interface{}, error) {
+	var req VgRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(true); err != nil {
+		return nil, err
+	}
+	_, err := s.exec(r, append([]string{"vgcreate", req.Vg}, req.Devices...)...)
+	return nil, err
+}
+
+func (s *Server) vgRemove(r *http.Request) (interface{}, error) {
+	var req VgRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(false); err != nil {
+		return nil, err
+	}
+	_, err := s.exec(r, "vgremove", req.Vg)
+	return nil, err
+}
+
+func (s *Server) vgInfo(r *http.Request) (interface{}, error) {
+	var req VgRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(false); err != nil {
+		return nil, err
+	}
+	output, err := s.exec(r, "vgdisplay", "-c", req.Vg)
+	if err != nil {
+		if e, ok := err.(*Error); ok && strings.Contains(e.Stderr, "not found") {
+			e.Code = ErrorNotFound
+		}
+		return nil, err
+	}
+
+	// Example:
+	// sampleVg:r/w:772:-1:0:0:0:-1:0:4:4:2097135616:4096:511996:0:511996:rJ0bIG-3XNc-NoS0-fkKm-batK-dFyX-xbxHym
+	vginfo := strings.Split(strings.TrimSpace(output), ":")
+	if len(vginfo) < 17 {
+		return nil, &Error{Code: ErrorFailed, Message: "vgdisplay returned an invalid string"}
+	}
+	info := &VgInfo{Vg: req.Vg}
+	info.ExtentSize, err = strconv.ParseUint(vginfo[vgdisplayExtentSize], 10, 64)
+	if err == nil {
+		info.FreeExtents, err = strconv.ParseUint(vginfo[vgdisplayFreeExtents], 10, 64)
+	}
+	if err != nil {
+		return nil, &Error{Code: ErrorFailed, Message: err.Error()}
+	}
+	return info, nil
+}
+
+func (s *Server) thinLvCreate(r *http.Request) (interface{}, error) {
+	var req ThinLvRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	_, err := s.exec(r, "lvcreate",
+		"--poolmetadatasize", fmt.Sprintf("%vK", req.PoolMetadataSize),
+		"-c", "256K",
+		"-L", fmt.Sprintf("%vK", req.PoolSize),
+		"-T", req.Vg+"/"+req.ThinPool,
+		"-V", fmt.Sprintf("%vK", req.Size),
+		"-n", req.Lv)
+	return nil, err
+}
+
+func (s *Server) lvRemove(r *http.Request) (interface{}, error) {
+	var req LvRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	_, err := s.exec(r, "lvremove", "-f", req.Vg+"/"+req.Lv)
+	return nil, err
+}
+
+func (s *Server) thinPoolUsage(r *http.Request) (interface{}, error) {
+	var req LvRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	output, err := s.exec(r, "lvs", "--noheadings", "--options=thin_count",
+		req.Vg+"/"+req.Lv)
+	if err != nil {
+		if e, ok := err.(*Error); ok && strings.Contains(e.Stderr, "not found") {
+			e.Code = ErrorNotFound
+		}
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(output))
+	if err != nil {
+		return nil, &Error{
+			Code:    ErrorFailed,
+			Message: fmt.Sprintf("lvs returned an invalid thin count %q", output),
+		}
+	}
+	return &ThinPoolUsage{ThinCount: count}, nil
+}
+
+func (s *Server) mkfs(r *http.Request) (interface{}, error) {
+	var req MkfsRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := validateDevice(req.Device); err != nil {
+		return nil, err
+	}
+	_, err := s.exec(r, "mkfs.xfs", "-i", "size=512", "-n", "size=8192", req.Device)
+	return nil, err
+}
+
+func (s *Server) mount(r *http.Request) (interface{}, error) {
+	var req MountRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(s.config.MountRoot); err != nil {
+		return nil, err
+	}
+	if req.Options == "" {
+		req.Options = defaultMountOptions
+	}
+
+	if err := s.inMountRoot(req.Path); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(req.Path, 0755); err != nil {
+		return nil, &Error{Code: ErrorFailed, Message: err.Error()}
+	}
+	entry := fmt.Sprintf("%v %v xfs %v 1 2", req.Device, req.Path, req.Options)
+	s.fstabLock.Lock()
+	err := addFstabEntry(s.config.Fstab, req.Path, entry)
+	s.fstabLock.Unlock()
+	if err != nil {
+		return nil, &Error{Code: ErrorFailed, Message: err.Error()}
+	}
+	_, err = s.exec(r, "mount", "-o", req.Options, req.Device, req.Path)
+	return nil, err
+}
+
+func (s *Server) unmount(r *http.Request) (interface{}, error) {
+	var req UnmountRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(s.config.MountRoot); err != nil {
+		return nil, err
+	}
+	_, err := s.exec(r, "umount", req.Path)
+	if e, ok := err.(*Error); ok && strings.Contains(e.Stderr, "not mounted") {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.fstabLock.Lock()
+	err = removeFstabEntry(s.config.Fstab, req.Path)
+	s.fstabLock.Unlock()
+	if err != nil {
+		return nil, &Error{Code: ErrorFailed, Message: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) mkdir(r *http.Request) (interface{}, error) {
+	var req DirRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(s.config.MountRoot); err != nil {
+		return nil, err
+	}
+	if err := s.inMountRoot(req.Path); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(req.Path, 0755); err != nil {
+		return nil, &Error{Code: ErrorFailed, Message: err.Error()}
+	}
+	// Only set the GID if the value is other than root(gid 0).
+	// When no gid is set, root is the only one that can write to the volume
+	if req.Gid != 0 {
+		if err := os.Chown(req.Path, -1, int(req.Gid)); err != nil {
+			return nil, &Error{Code: ErrorFailed, Message: err.Error()}
+		}
+		if err := os.Chmod(req.Path, os.ModeSetgid|0775); err != nil {
+			return nil, &Error{Code: ErrorFailed, Message: err.Error()}
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) rmdir(r *http.Request) (interface{}, error) {
+	var req DirRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.validate(s.config.MountRoot); err != nil {
+		return nil, err
+	}
+	if err := s.inMountRoot(filepath.Dir(req.Path)); err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(req.Path)
+	switch {
+	case os.IsNotExist(err):
+		return nil, &Error{Code: ErrorNotFound, Message: err.Error()}
+	case err != nil:
+		return nil, &Error{Code: ErrorFailed, Message: err.Error()}
+	case !info.IsDir():
+		return nil, invalidf("%v is not a directory", req.Path)
+	}
+	if err := os.Remove(req.Path); err != nil {
+		return nil, &Error{Code: ErrorFailed, Message: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) command(r *http.Request, name string) (interface{}, error) {
+	var req CommandRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := validateArgs(req.Args); err != nil {
+		return nil, err
+	}
+	output, err := s.exec(r, append([]string{name}, req.Args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &CommandResponse{Output: output}, nil
+}
+
+func (s *Server) gluster(r *http.Request) (interface{}, error) {
+	return s.command(r, "gluster")
+}
+
+func (s *Server) glusterBlock(r *http.Request) (interface{}, error) {
+	return s.command(r, "gluster-block")
+}
+
+func (s *Server) serviceStatus(r *http.Request) (interface{}, error) {
+	var req ServiceRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := validateService(req.Service); err != nil {
+		return nil, err
+	}
+	_, err := s.exec(r, "systemctl", "is-active", req.Service)
+	if e, ok := err.(*Error); ok && e.Code == ErrorFailed && e.ExitCode > 0 {
+		// systemctl exits with an error when the service is not active
+		return &ServiceStatus{Service: req.Service}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceStatus{Service: req.Service, Active: true}, nil
+}
+
+// inMountRoot fails unless path is still in the mount root once the
+// symbolic links of its existing part are resolved, so that the links
+// found in the mount root do not lead the requests out of it.
+func (s *Server) inMountRoot(path string) error {
+	root, err := resolveExisting(s.config.MountRoot)
+	if err == nil {
+		path, err = resolveExisting(path)
+	}
+	if err != nil {
+		return &Error{Code: ErrorFailed, Message: err.Error()}
+	}
+	if path != root && !strings.HasPrefix(path, root+"/") {
+		return invalidf("%v is not in %v", path, s.config.MountRoot)
+	}
+	return nil
+}
+
+// resolveExisting returns path with the symbolic links of its longest
+// existing part resolved.
+func resolveExisting(path string) (string, error) {
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		dir := filepath.Dir(path)
+		if !os.IsNotExist(err) || dir == path {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = dir
+	}
+}
+
+// addFstabEntry adds entry to the fstab file unless it already has an
+// entry for path.
+func addFstabEntry(fstab, path, entry string) error {
+	lines, err := readFstab(fstab)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if fstabPath(line) == path {
+			return nil
+		}
+	}
+	return writeFstab(fstab, append(lines, entry))
+}
+
+// removeFstabEntry removes the entries of path from the fstab file.
+func removeFstabEntry(fstab, path string) error {
+	lines, err := readFstab(fstab)
+	if err != nil {
+		return err
+	}
+	kept := lines[:0]
+	for _, line := range lines {
+		if fstabPath(line) != path {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == len(lines) {
+		return nil
+	}
+	return writeFstab(fstab, kept)
+}
+
+// fstabPath returns the mount point of an fstab line.
+func fstabPath(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+		return ""
+	}
+	return fields[1]
+}
+
+func readFstab(fstab string) ([]string, error) {
+	f, err := os.Open(fstab)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// writeFstab replaces the fstab file, keeping a copy of the previous
+// one like sed -i.save did.
+func writeFstab(fstab string, lines []string) error {
+	if data, err := ioutil.ReadFile(fstab); err == nil {
+		if err := ioutil.WriteFile(fstab+".save", data, 0644); err != nil {
+			return err
+		}
+	}
+	tmp := fstab + ".heketi"
+	content := strings.Join(lines, "\n") + "\n"
+	if err := ioutil.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fstab)
+}
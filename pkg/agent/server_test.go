@@ -0,0 +1,320 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agent
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+// fakeRunner records the commands and answers the outputs and errors
+// set for their names.
+type fakeRunner struct {
+	lock     sync.Mutex
+	commands []string
+	outputs  map[string]string
+	errors   map[string]error
+}
+
+func newFakeRunner() *fakeRunner {
+	return &fakeRunner{
+		outputs: map[string]string{},
+		errors:  map[string]error{},
+	}
+}
+
+func (f *fakeRunner) run(ctx context.Context, args []string) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.commands = append(f.commands, strings.Join(args, " "))
+	if err, ok := f.errors[args[0]]; ok {
+		return "", err
+	}
+	return f.outputs[args[0]], nil
+}
+
+// newTestClient returns a client of an agent whose fstab and mount
+// root are in the directory returned.
+func newTestClient(t *testing.T, f *fakeRunner) (*Client, string, string, func()) {
+	dir, err := ioutil.TempDir("", "heketi-agent")
+	tests.Assert(t, err == nil, err)
+	ts := httptest.NewServer(NewServer(&ServerConfig{
+		Fstab:     filepath.Join(dir, "fstab"),
+		MountRoot: filepath.Join(dir, "mounts"),
+	}, f.run).Handler())
+	host, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	tests.Assert(t, err == nil, err)
+	return NewClient(port, nil), host, dir, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAgentLvm(t *testing.T) {
+	f := newFakeRunner()
+	c, host, _, done := newTestClient(t, f)
+	defer done()
+	ctx := context.Background()
+
+	err := c.PvCreate(ctx, host, "/dev/sdb")
+	tests.Assert(t, err == nil, err)
+	err = c.VgCreate(ctx, host, "vg_1", "/dev/sdb")
+	tests.Assert(t, err == nil, err)
+	err = c.ThinLvCreate(ctx, host, &ThinLvRequest{
+		Vg:               "vg_1",
+		ThinPool:         "tp_1",
+		PoolSize:         2048,
+		PoolMetadataSize: 16,
+		Lv:               "brick_1",
+		Size:             1024,
+	})
+	tests.Assert(t, err == nil, err)
+	err = c.LvRemove(ctx, host, "vg_1", "tp_1")
+	tests.Assert(t, err == nil, err)
+
+	tests.Assert(t, len(f.commands) == 4, f.commands)
+	tests.Assert(t, f.commands[0] == "pvcreate --metadatasize=128M --dataalignment=256K /dev/sdb",
+		f.commands[0])
+	tests.Assert(t, f.commands[1] == "vgcreate vg_1 /dev/sdb", f.commands[1])
+	tests.Assert(t, f.commands[2] ==
+		"lvcreate --poolmetadatasize 16K -c 256K -L 2048K -T vg_1/tp_1 -V 1024K -n brick_1",
+		f.commands[2])
+	tests.Assert(t, f.commands[3] == "lvremove -f vg_1/tp_1", f.commands[3])
+}
+
+func TestAgentVgInfo(t *testing.T) {
+	f := newFakeRunner()
+	c, host, _, done := newTestClient(t, f)
+	defer done()
+	ctx := context.Background()
+
+	f.outputs["vgdisplay"] = "  vg_1:r/w:772:-1:0:0:0:-1:0:4:4:2097135616:4096:511996:0:511996:rJ0bIG\n"
+	info, err := c.VgInfo(ctx, host, "vg_1")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.ExtentSize == 4096, info)
+	tests.Assert(t, info.FreeExtents == 511996, info)
+
+	f.outputs["vgdisplay"] = "vg_1:r/w"
+	_, err = c.VgInfo(ctx, host, "vg_1")
+	tests.Assert(t, err != nil)
+
+	f.errors["vgdisplay"] = commandError([]string{"vgdisplay"}, 5,
+		"  Volume group \"vg_2\" not found\n")
+	_, err = c.VgInfo(ctx, host, "vg_2")
+	tests.Assert(t, IsNotFound(err), err)
+	tests.Assert(t, err.Error() == `Volume group "vg_2" not found`, err)
+}
+
+func TestAgentThinPoolUsage(t *testing.T) {
+	f := newFakeRunner()
+	c, host, _, done := newTestClient(t, f)
+	defer done()
+
+	f.outputs["lvs"] = "    2\n"
+	usage, err := c.ThinPoolUsage(context.Background(), host, "vg_1", "tp_1")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, usage.ThinCount == 2, usage)
+	tests.Assert(t, f.commands[0] == "lvs --noheadings --options=thin_count vg_1/tp_1",
+		f.commands)
+}
+
+func TestAgentRejectsInvalidRequests(t *testing.T) {
+	f := newFakeRunner()
+	c, host, _, done := newTestClient(t, f)
+	defer done()
+	ctx := context.Background()
+
+	for _, err := range []error{
+		c.PvCreate(ctx, host, "/etc/passwd"),
+		c.PvCreate(ctx, host, "/dev/../etc/passwd"),
+		c.VgCreate(ctx, host, "vg_1; reboot", "/dev/sdb"),
+		c.VgCreate(ctx, host, "vg_1"),
+		c.LvRemove(ctx, host, "vg_1", "-ff"),
+		c.Mount(ctx, host, &MountRequest{
+			Device:  "/dev/mapper/vg_1-brick_1",
+			Path:    "/var/lib/heketi/mounts/vg_1/brick_1",
+			Options: "rw exec",
+		}),
+		c.Mkdir(ctx, host, &DirRequest{Path: "/"}),
+		c.Rmdir(ctx, host, "relative/path"),
+		c.ThinLvCreate(ctx, host, &ThinLvRequest{
+			Vg: "vg_1", ThinPool: "tp_1", Lv: "brick_1", Size: 1024,
+		}),
+	} {
+		e, ok := err.(*Error)
+		tests.Assert(t, ok, err)
+		tests.Assert(t, e.Code == ErrorInvalid, e)
+	}
+
+	_, err := c.Gluster(ctx, host)
+	tests.Assert(t, err != nil)
+	_, err = c.ServiceStatus(ctx, host, "cron")
+	tests.Assert(t, err != nil)
+
+	tests.Assert(t, len(f.commands) == 0, f.commands)
+}
+
+func TestAgentCommandError(t *testing.T) {
+	f := newFakeRunner()
+	c, host, _, done := newTestClient(t, f)
+	defer done()
+
+	f.errors["gluster"] = commandError([]string{"gluster", "volume", "start", "vol1"}, 1,
+		"volume start: vol1: failed: Volume vol1 already started\n")
+	_, err := c.Gluster(context.Background(), host, "volume", "start", "vol1")
+	e, ok := err.(*Error)
+	tests.Assert(t, ok, err)
+	tests.Assert(t, e.Code == ErrorFailed, e)
+	tests.Assert(t, e.ExitCode == 1, e)
+	tests.Assert(t, e.Message == "volume start: vol1: failed: Volume vol1 already started", e)
+	tests.Assert(t, len(e.Command) == 4 && e.Command[0] == "gluster", e.Command)
+
+	f.outputs["gluster-block"] = "{}"
+	output, err := c.GlusterBlock(context.Background(), host, "list", "vol1", "--json")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, output == "{}", output)
+	tests.Assert(t, f.commands[1] == "gluster-block list vol1 --json", f.commands)
+}
+
+func TestAgentServiceStatus(t *testing.T) {
+	f := newFakeRunner()
+	c, host, _, done := newTestClient(t, f)
+	defer done()
+	ctx := context.Background()
+
+	status, err := c.ServiceStatus(ctx, host, "glusterd")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, status.Active, status)
+
+	f.errors["systemctl"] = commandError([]string{"systemctl"}, 3, "inactive\n")
+	status, err = c.ServiceStatus(ctx, host, "glusterd")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, !status.Active, status)
+	tests.Assert(t, f.commands[1] == "systemctl is-active glusterd", f.commands)
+}
+
+func TestAgentMountAndUnmount(t *testing.T) {
+	f := newFakeRunner()
+	c, host, dir, done := newTestClient(t, f)
+	defer done()
+	ctx := context.Background()
+
+	fstab := filepath.Join(dir, "fstab")
+	err := ioutil.WriteFile(fstab, []byte("/dev/sda1 / xfs defaults 0 0\n"), 0644)
+	tests.Assert(t, err == nil, err)
+
+	mount := filepath.Join(dir, "mounts", "vg_1", "brick_1")
+	req := &MountRequest{
+		Device: "/dev/mapper/vg_1-brick_1",
+		Path:   mount,
+	}
+	err = c.Mount(ctx, host, req)
+	tests.Assert(t, err == nil, err)
+	// mounting again does not add another fstab entry
+	err = c.Mount(ctx, host, req)
+	tests.Assert(t, err == nil, err)
+
+	_, err = os.Stat(mount)
+	tests.Assert(t, err == nil, err)
+	data, err := ioutil.ReadFile(fstab)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, string(data) == "/dev/sda1 / xfs defaults 0 0\n"+
+		"/dev/mapper/vg_1-brick_1 "+mount+" xfs rw,inode64,noatime,nouuid 1 2\n",
+		string(data))
+	tests.Assert(t, f.commands[0] ==
+		"mount -o rw,inode64,noatime,nouuid /dev/mapper/vg_1-brick_1 "+mount,
+		f.commands)
+
+	// a brick which is not mounted is still removed from the fstab
+	f.errors["umount"] = commandError([]string{"umount"}, 32,
+		"umount: "+mount+": not mounted\n")
+	err = c.Unmount(ctx, host, &UnmountRequest{Path: mount})
+	tests.Assert(t, err == nil, err)
+	data, err = ioutil.ReadFile(fstab)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, string(data) == "/dev/sda1 / xfs defaults 0 0\n", string(data))
+	_, err = os.Stat(fstab + ".save")
+	tests.Assert(t, err == nil, err)
+
+	f.errors["umount"] = commandError([]string{"umount"}, 32,
+		"umount: "+mount+": target is busy\n")
+	err = c.Unmount(ctx, host, &UnmountRequest{Path: mount})
+	tests.Assert(t, err != nil)
+
+	// the mount points are in the mount root of the agent
+	for _, path := range []string{"/etc", dir + "/fstab", dir + "/mounts"} {
+		err = c.Mount(ctx, host, &MountRequest{
+			Device: "/dev/mapper/vg_1-brick_1",
+			Path:   path,
+		})
+		tests.Assert(t, err != nil, path)
+		err = c.Unmount(ctx, host, &UnmountRequest{Path: path})
+		tests.Assert(t, err != nil, path)
+	}
+}
+
+func TestAgentMkdirAndRmdir(t *testing.T) {
+	f := newFakeRunner()
+	c, host, dir, done := newTestClient(t, f)
+	defer done()
+	ctx := context.Background()
+
+	brick := filepath.Join(dir, "mounts", "vg_1", "brick_1", "brick")
+	err := c.Mkdir(ctx, host, &DirRequest{Path: brick, Gid: int64(os.Getgid())})
+	tests.Assert(t, err == nil, err)
+	info, err := os.Stat(brick)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.IsDir())
+	if os.Getgid() != 0 {
+		tests.Assert(t, info.Mode()&os.ModeSetgid != 0, info.Mode())
+	}
+
+	err = c.Rmdir(ctx, host, brick)
+	tests.Assert(t, err == nil, err)
+	err = c.Rmdir(ctx, host, brick)
+	tests.Assert(t, IsNotFound(err), err)
+
+	// the directories out of the mount root are left alone, even when
+	// reached through a link in the mount root
+	outside := filepath.Join(dir, "outside")
+	err = os.Mkdir(outside, 0700)
+	tests.Assert(t, err == nil, err)
+	err = os.Symlink(outside, filepath.Join(dir, "mounts", "link"))
+	tests.Assert(t, err == nil, err)
+	for _, path := range []string{
+		"/etc/heketi",
+		outside,
+		filepath.Join(dir, "mounts"),
+		filepath.Join(dir, "mounts", "link", "brick"),
+	} {
+		err = c.Mkdir(ctx, host, &DirRequest{Path: path, Gid: int64(os.Getgid())})
+		tests.Assert(t, err != nil, path)
+	}
+	err = c.Rmdir(ctx, host, outside)
+	tests.Assert(t, err != nil)
+	err = os.Mkdir(filepath.Join(outside, "brick"), 0700)
+	tests.Assert(t, err == nil, err)
+	err = c.Rmdir(ctx, host, filepath.Join(dir, "mounts", "link", "brick"))
+	tests.Assert(t, err != nil)
+	_, err = os.Stat(filepath.Join(outside, "brick"))
+	tests.Assert(t, err == nil, err)
+	info, err = os.Stat(outside)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.Mode()&os.ModeSetgid == 0, info.Mode())
+}
@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSFiles are the files the agent and heketi authenticate each other
+// with. Both present their certificate, signed by the certificate
+// authority of CACertFile.
+type TLSFiles struct {
+	CertFile   string `json:"certfile"`
+	KeyFile    string `json:"keyfile"`
+	CACertFile string `json:"cacert"`
+}
+
+func (f *TLSFiles) load() (tls.Certificate, *x509.CertPool, error) {
+	if f.CertFile == "" || f.KeyFile == "" || f.CACertFile == "" {
+		return tls.Certificate{}, nil, errors.New(
+			"The certificate, key and CA certificate files are required")
+	}
+	cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("Unable to load certificate %v: %v",
+			f.CertFile, err)
+	}
+	pem, err := ioutil.ReadFile(f.CACertFile)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("Unable to read CA certificate file %v: %v",
+			f.CACertFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return tls.Certificate{}, nil, fmt.Errorf("No certificate found in %v",
+			f.CACertFile)
+	}
+	return cert, pool, nil
+}
+
+// ServerConfig returns the TLS configuration of the agent, which only
+// accepts the clients presenting a certificate signed by the CA.
+func (f *TLSFiles) ServerConfig() (*tls.Config, error) {
+	cert, pool, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ClientConfig returns the TLS configuration of heketi, which only
+// talks to the agents presenting a certificate signed by the CA.
+func (f *TLSFiles) ClientConfig() (*tls.Config, error) {
+	cert, pool, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
@@ -0,0 +1,199 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// Package agent is the protocol of the heketi node agent, which sets
+// up the devices and bricks of a node and runs its gluster commands on
+// behalf of heketi. Each endpoint takes a JSON request, runs the
+// commands it stands for without a shell, and answers a JSON result or
+// an Error.
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Paths of the endpoints of the agent, all of them POST requests.
+const (
+	PathPvCreate      = "/v1/lvm/pvcreate"
+	PathPvRemove      = "/v1/lvm/pvremove"
+	PathVgCreate      = "/v1/lvm/vgcreate"
+	PathVgRemove      = "/v1/lvm/vgremove"
+	PathVgInfo        = "/v1/lvm/vginfo"
+	PathThinLvCreate  = "/v1/lvm/thinlvcreate"
+	PathLvRemove      = "/v1/lvm/lvremove"
+	PathThinPoolUsage = "/v1/lvm/thinpoolusage"
+	PathMkfs          = "/v1/fs/mkfs"
+	PathMount         = "/v1/fs/mount"
+	PathUnmount       = "/v1/fs/unmount"
+	PathMkdir         = "/v1/fs/mkdir"
+	PathRmdir         = "/v1/fs/rmdir"
+	PathGluster       = "/v1/gluster"
+	PathGlusterBlock  = "/v1/gluster-block"
+	PathServiceStatus = "/v1/service/status"
+)
+
+// PvRequest names the device of a physical volume.
+type PvRequest struct {
+	Device string `json:"device"`
+}
+
+// VgRequest names a volume group and, to create it, its devices.
+type VgRequest struct {
+	Vg      string   `json:"vg"`
+	Devices []string `json:"devices,omitempty"`
+}
+
+// VgInfo is the size of a volume group, in KiB.
+type VgInfo struct {
+	Vg          string `json:"vg"`
+	ExtentSize  uint64 `json:"extent_size_kb"`
+	FreeExtents uint64 `json:"free_extents"`
+}
+
+// ThinLvRequest creates a thin pool and a thin logical volume in it.
+// The sizes are in KiB.
+type ThinLvRequest struct {
+	Vg               string `json:"vg"`
+	ThinPool         string `json:"thin_pool"`
+	PoolSize         uint64 `json:"pool_size_kb"`
+	PoolMetadataSize uint64 `json:"pool_metadata_size_kb"`
+	Lv               string `json:"lv"`
+	Size             uint64 `json:"size_kb"`
+}
+
+// LvRequest names a logical volume, or a thin pool.
+type LvRequest struct {
+	Vg string `json:"vg"`
+	Lv string `json:"lv"`
+}
+
+// ThinPoolUsage is the number of thin volumes in a thin pool.
+type ThinPoolUsage struct {
+	ThinCount int `json:"thin_count"`
+}
+
+// MkfsRequest formats a device with the xfs options of the bricks.
+type MkfsRequest struct {
+	Device string `json:"device"`
+}
+
+// MountRequest mounts a device, creating the mount point, and adds the
+// mount to the fstab file of the agent. The mount point must be in the
+// mount root of the agent.
+type MountRequest struct {
+	Device  string `json:"device"`
+	Path    string `json:"path"`
+	Options string `json:"options,omitempty"`
+}
+
+// UnmountRequest unmounts a mount point and removes its mount from the
+// fstab file of the agent.
+type UnmountRequest struct {
+	Path string `json:"path"`
+}
+
+// DirRequest creates or removes a directory in the mount root of the
+// agent. A created directory is given to the group Gid, writable by
+// the group, when Gid is set.
+type DirRequest struct {
+	Path string `json:"path"`
+	Gid  int64  `json:"gid,omitempty"`
+}
+
+// CommandRequest holds the arguments of a gluster or gluster-block
+// command.
+type CommandRequest struct {
+	Args []string `json:"args"`
+}
+
+// CommandResponse is the standard output of a command.
+type CommandResponse struct {
+	Output string `json:"output"`
+}
+
+// ServiceRequest names a service of the node.
+type ServiceRequest struct {
+	Service string `json:"service"`
+}
+
+// ServiceStatus tells if a service of the node is running.
+type ServiceStatus struct {
+	Service string `json:"service"`
+	Active  bool   `json:"active"`
+}
+
+// Codes of the errors
+const (
+	// the request is not valid and was not run
+	ErrorInvalid = "invalid"
+	// the object of the request does not exist
+	ErrorNotFound = "not_found"
+	// a command of the request failed
+	ErrorFailed = "failed"
+	// a command of the request did not complete in time
+	ErrorTimeout = "timeout"
+)
+
+// Error is the answer of the agent to a request that failed.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// command that failed, its exit code and standard error
+	Command  []string `json:"command,omitempty"`
+	ExitCode int      `json:"exit_code,omitempty"`
+	Stderr   string   `json:"stderr,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the http status the error is answered with.
+func (e *Error) StatusCode() int {
+	switch e.Code {
+	case ErrorInvalid:
+		return http.StatusBadRequest
+	case ErrorNotFound:
+		return http.StatusNotFound
+	case ErrorTimeout:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func invalidf(format string, args ...interface{}) *Error {
+	return &Error{Code: ErrorInvalid, Message: fmt.Sprintf(format, args...)}
+}
+
+// commandError returns the error of a command that exited with
+// exitCode, whose message is its standard error like the errors of
+// the other executors.
+func commandError(args []string, exitCode int, stderr string) *Error {
+	message := strings.TrimSpace(stderr)
+	if message == "" {
+		message = fmt.Sprintf("Command %v failed with exit code %v",
+			strings.Join(args, " "), exitCode)
+	}
+	return &Error{
+		Code:     ErrorFailed,
+		Message:  message,
+		Command:  args,
+		ExitCode: exitCode,
+		Stderr:   stderr,
+	}
+}
+
+// IsNotFound returns true if err is an error of the agent about an
+// object that does not exist.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == ErrorNotFound
+}
@@ -0,0 +1,159 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agent
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// names of LVM volume groups and logical volumes
+	nameRegexp = regexp.MustCompile(`^[A-Za-z0-9_+][A-Za-z0-9_.+-]*$`)
+	// device files and mount points
+	pathRegexp = regexp.MustCompile(`^/[A-Za-z0-9_./:+-]*$`)
+	// mount options
+	optionsRegexp = regexp.MustCompile(`^[A-Za-z0-9_=,.:-]+$`)
+
+	// services the status of can be asked
+	services = map[string]bool{
+		"glusterd":       true,
+		"gluster-blockd": true,
+		"sshd":           true,
+	}
+)
+
+func validateName(what, name string) error {
+	if !nameRegexp.MatchString(name) {
+		return invalidf("Invalid %v name %q", what, name)
+	}
+	return nil
+}
+
+// validatePath requires an absolute path, other than the root, which
+// does not reach out of its directory.
+func validatePath(what, path string) error {
+	if !pathRegexp.MatchString(path) || filepath.Clean(path) != path || path == "/" {
+		return invalidf("Invalid %v path %q", what, path)
+	}
+	return nil
+}
+
+// validateMountPath requires a path of validatePath inside the mount
+// root, other than the root itself.
+func validateMountPath(root, what, path string) error {
+	if err := validatePath(what, path); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(path, root+"/") {
+		return invalidf("The %v %q is not in %v", what, path, root)
+	}
+	return nil
+}
+
+func validateDevice(device string) error {
+	if err := validatePath("device", device); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(device, "/dev/") {
+		return invalidf("Device %q is not in /dev", device)
+	}
+	return nil
+}
+
+func validateArgs(args []string) error {
+	if len(args) == 0 {
+		return invalidf("Missing command arguments")
+	}
+	for _, arg := range args {
+		if strings.ContainsRune(arg, 0) {
+			return invalidf("Invalid command argument %q", arg)
+		}
+	}
+	return nil
+}
+
+func validateService(service string) error {
+	if !services[service] {
+		return invalidf("Unknown service %q", service)
+	}
+	return nil
+}
+
+func (r *PvRequest) validate() error {
+	return validateDevice(r.Device)
+}
+
+func (r *VgRequest) validate(create bool) error {
+	if err := validateName("volume group", r.Vg); err != nil {
+		return err
+	}
+	if !create {
+		return nil
+	}
+	if len(r.Devices) == 0 {
+		return invalidf("Missing devices of volume group %v", r.Vg)
+	}
+	for _, device := range r.Devices {
+		if err := validateDevice(device); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ThinLvRequest) validate() error {
+	for what, name := range map[string]string{
+		"volume group":   r.Vg,
+		"thin pool":      r.ThinPool,
+		"logical volume": r.Lv,
+	} {
+		if err := validateName(what, name); err != nil {
+			return err
+		}
+	}
+	if r.Size == 0 || r.PoolSize < r.Size || r.PoolMetadataSize == 0 {
+		return invalidf("Invalid sizes of logical volume %v: %v KiB in a %v KiB pool with %v KiB of metadata",
+			r.Lv, r.Size, r.PoolSize, r.PoolMetadataSize)
+	}
+	return nil
+}
+
+func (r *LvRequest) validate() error {
+	if err := validateName("volume group", r.Vg); err != nil {
+		return err
+	}
+	return validateName("logical volume", r.Lv)
+}
+
+func (r *MountRequest) validate(root string) error {
+	if err := validateDevice(r.Device); err != nil {
+		return err
+	}
+	if err := validateMountPath(root, "mount point", r.Path); err != nil {
+		return err
+	}
+	if r.Options != "" && !optionsRegexp.MatchString(r.Options) {
+		return invalidf("Invalid mount options %q", r.Options)
+	}
+	return nil
+}
+
+func (r *UnmountRequest) validate(root string) error {
+	return validateMountPath(root, "mount point", r.Path)
+}
+
+func (r *DirRequest) validate(root string) error {
+	if r.Gid < 0 {
+		return invalidf("Invalid group id %v", r.Gid)
+	}
+	return validateMountPath(root, "directory", r.Path)
+}
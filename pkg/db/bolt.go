@@ -0,0 +1,91 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package db
+
+import (
+	"io"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// BoltStore is a Store kept in a single BoltDB file.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens, and creates if needed, the BoltDB file at path.
+func OpenBoltStore(path string, readOnly bool) (*BoltStore, error) {
+	var db *bolt.DB
+	var err error
+	if readOnly {
+		db, err = bolt.Open(path, 0666, &bolt.Options{ReadOnly: true})
+	} else {
+		db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewBoltStore(db), nil
+}
+
+// NewBoltStore returns a Store using an already opened BoltDB.
+func NewBoltStore(db *bolt.DB) *BoltStore {
+	return &BoltStore{db: db}
+}
+
+// View runs cb in a read-only transaction.
+func (s *BoltStore) View(cb func(Tx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return cb(&boltTx{tx})
+	})
+}
+
+// Update runs cb in a read-write transaction.
+func (s *BoltStore) Update(cb func(Tx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return cb(&boltTx{tx})
+	})
+}
+
+// Close closes the BoltDB file.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t *boltTx) Bucket(name []byte) Bucket {
+	b := t.tx.Bucket(name)
+	if b == nil {
+		return nil
+	}
+	return b
+}
+
+func (t *boltTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (t *boltTx) ForEach(fn func(name []byte, b Bucket) error) error {
+	return t.tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		return fn(name, b)
+	})
+}
+
+func (t *boltTx) WriteTo(w io.Writer) (int64, error) {
+	return t.tx.WriteTo(w)
+}
@@ -0,0 +1,314 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package db
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	kvRoot        = "/heketi/"
+	kvBucketsRoot = kvRoot + "buckets/"
+	kvDataRoot    = kvRoot + "data/"
+)
+
+var (
+	ErrStoreReadOnly = errors.New("db is read-only")
+	ErrTxReadOnly    = errors.New("transaction is read-only")
+	ErrKeyRequired   = errors.New("key required")
+)
+
+// KeyValue is a key/value pair of a KV.
+type KeyValue struct {
+	Key   string
+	Value []byte
+}
+
+// KVOp is a single write of a KV transaction.
+type KVOp struct {
+	Key    string `json:"k"`
+	Value  []byte `json:"v,omitempty"`
+	Delete bool   `json:"d,omitempty"`
+}
+
+// KVReader reads keys of a KV.
+type KVReader interface {
+	// Get returns the value of key or nil if the key does not exist.
+	Get(key string) ([]byte, error)
+	// Range returns all key/value pairs whose key starts with prefix,
+	// in key order.
+	Range(prefix string) ([]KeyValue, error)
+}
+
+// KVSnapshot is a KVReader of a KV as it was when the snapshot was
+// taken. It must be released once it is no longer used.
+type KVSnapshot interface {
+	KVReader
+	Release()
+}
+
+// KV is a flat, ordered key space with atomic multi-key writes. It
+// follows the etcd v3 data model: keys are plain strings, buckets are
+// expressed as key prefixes and a transaction is a list of puts and
+// deletes that is applied as a whole or not at all.
+type KV interface {
+	KVReader
+	// Snapshot returns a reader of the KV as it is now, which does
+	// not see the transactions applied later.
+	Snapshot() (KVSnapshot, error)
+	// Txn atomically applies all ops.
+	Txn(ops []KVOp) error
+	Close() error
+}
+
+// KVStore is a Store on top of a KV. Each bucket is kept under its own
+// key prefix. Writes of a transaction are buffered and sent to the KV
+// in a single Txn on commit, so a failed Update leaves no trace.
+//
+// Read-write transactions are serialized by the store itself, it
+// expects to be the only writer of the KV. Like in BoltDB, every
+// transaction reads from a snapshot of the KV taken when it starts.
+type KVStore struct {
+	kv       KV
+	lock     sync.Mutex
+	readOnly bool
+}
+
+// NewKVStore returns a Store keeping its data in kv.
+func NewKVStore(kv KV, readOnly bool) *KVStore {
+	return &KVStore{kv: kv, readOnly: readOnly}
+}
+
+// View runs cb in a read-only transaction.
+func (s *KVStore) View(cb func(Tx) error) error {
+	snapshot, err := s.kv.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Release()
+
+	tx := &kvTx{kv: snapshot}
+	err = cb(tx)
+	if err != nil {
+		return err
+	}
+	return tx.err
+}
+
+// Update runs cb in a read-write transaction. The writes of cb are
+// committed only if it returns nil.
+func (s *KVStore) Update(cb func(Tx) error) error {
+	if s.readOnly {
+		return ErrStoreReadOnly
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	snapshot, err := s.kv.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Release()
+
+	tx := &kvTx{kv: snapshot, writes: map[string]KVOp{}}
+	err = cb(tx)
+	if err != nil {
+		return err
+	}
+	if tx.err != nil {
+		return tx.err
+	}
+	if len(tx.writes) == 0 {
+		return nil
+	}
+	return s.kv.Txn(tx.ops())
+}
+
+// Close closes the underlying KV.
+func (s *KVStore) Close() error {
+	return s.kv.Close()
+}
+
+type keyValues []KeyValue
+
+func (s keyValues) Len() int           { return len(s) }
+func (s keyValues) Less(i, j int) bool { return s[i].Key < s[j].Key }
+func (s keyValues) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type kvOps []KVOp
+
+func (s kvOps) Len() int           { return len(s) }
+func (s kvOps) Less(i, j int) bool { return s[i].Key < s[j].Key }
+func (s kvOps) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type kvTx struct {
+	kv KVReader
+	// pending writes, nil for read-only transactions
+	writes map[string]KVOp
+	// first error seen while reading from the KV
+	err error
+}
+
+func (t *kvTx) writable() bool {
+	return t.writes != nil
+}
+
+func (t *kvTx) get(key string) []byte {
+	if op, ok := t.writes[key]; ok {
+		if op.Delete {
+			return nil
+		}
+		return op.Value
+	}
+
+	value, err := t.kv.Get(key)
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+	return value
+}
+
+func (t *kvTx) put(key string, value []byte) {
+	v := make([]byte, len(value))
+	copy(v, value)
+	t.writes[key] = KVOp{Key: key, Value: v}
+}
+
+// rangeKeys returns the key/value pairs with the given prefix as
+// seen by the transaction, with the prefix removed from the keys.
+func (t *kvTx) rangeKeys(prefix string) []KeyValue {
+	kvs, err := t.kv.Range(prefix)
+	if err != nil {
+		if t.err == nil {
+			t.err = err
+		}
+		return nil
+	}
+	if len(t.writes) == 0 {
+		for i := range kvs {
+			kvs[i].Key = strings.TrimPrefix(kvs[i].Key, prefix)
+		}
+		return kvs
+	}
+
+	merged := map[string][]byte{}
+	for _, kv := range kvs {
+		merged[kv.Key] = kv.Value
+	}
+	for key, op := range t.writes {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if op.Delete {
+			delete(merged, key)
+		} else {
+			merged[key] = op.Value
+		}
+	}
+
+	result := make([]KeyValue, 0, len(merged))
+	for key, value := range merged {
+		result = append(result, KeyValue{
+			Key:   strings.TrimPrefix(key, prefix),
+			Value: value,
+		})
+	}
+	sort.Sort(keyValues(result))
+	return result
+}
+
+// ops returns the pending writes in key order.
+func (t *kvTx) ops() []KVOp {
+	ops := make([]KVOp, 0, len(t.writes))
+	for _, op := range t.writes {
+		ops = append(ops, op)
+	}
+	sort.Sort(kvOps(ops))
+	return ops
+}
+
+func (t *kvTx) Bucket(name []byte) Bucket {
+	if t.get(kvBucketsRoot+string(name)) == nil {
+		return nil
+	}
+	return &kvBucket{tx: t, prefix: kvDataRoot + string(name) + "/"}
+}
+
+func (t *kvTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if len(name) == 0 {
+		return nil, ErrKeyRequired
+	}
+	if b := t.Bucket(name); b != nil {
+		return b, nil
+	}
+	if !t.writable() {
+		return nil, ErrTxReadOnly
+	}
+
+	t.put(kvBucketsRoot+string(name), []byte{})
+	return &kvBucket{tx: t, prefix: kvDataRoot + string(name) + "/"}, nil
+}
+
+func (t *kvTx) ForEach(fn func(name []byte, b Bucket) error) error {
+	for _, kv := range t.rangeKeys(kvBucketsRoot) {
+		b := &kvBucket{tx: t, prefix: kvDataRoot + kv.Key + "/"}
+		if err := fn([]byte(kv.Key), b); err != nil {
+			return err
+		}
+	}
+	return t.err
+}
+
+func (t *kvTx) WriteTo(w io.Writer) (int64, error) {
+	return writeBoltCopy(t, w)
+}
+
+type kvBucket struct {
+	tx     *kvTx
+	prefix string
+}
+
+func (b *kvBucket) Get(key []byte) []byte {
+	return b.tx.get(b.prefix + string(key))
+}
+
+func (b *kvBucket) Put(key []byte, value []byte) error {
+	if !b.tx.writable() {
+		return ErrTxReadOnly
+	}
+	if len(key) == 0 {
+		return ErrKeyRequired
+	}
+	b.tx.put(b.prefix+string(key), value)
+	return nil
+}
+
+func (b *kvBucket) Delete(key []byte) error {
+	if !b.tx.writable() {
+		return ErrTxReadOnly
+	}
+	k := b.prefix + string(key)
+	b.tx.writes[k] = KVOp{Key: k, Delete: true}
+	return nil
+}
+
+func (b *kvBucket) ForEach(fn func(k, v []byte) error) error {
+	for _, kv := range b.tx.rangeKeys(b.prefix) {
+		if err := fn([]byte(kv.Key), kv.Value); err != nil {
+			return err
+		}
+	}
+	return b.tx.err
+}
@@ -0,0 +1,430 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	localKVMagic = "heketi-kv-v1\n"
+
+	// the log is compacted once the transactions appended to it take
+	// more space than its compacted contents, and at least this much
+	localKVCompactMinSize = 4 * 1024 * 1024
+)
+
+var (
+	ErrKVClosed = errors.New("kv is closed")
+)
+
+// LocalKV is a KV kept in a single local file. It is a local backend,
+// used to run heketi and its tests against the KV store, and not a
+// distributed or etcd compatible store: the file is locked so that
+// only one process can open it for writing, and it can not be shared
+// by several heketi instances, not even through a shared file system.
+//
+// All keys are held in memory. Every transaction is appended to the
+// file and synced before it is applied. The file is compacted when it
+// is opened and whenever the appended transactions grow larger than
+// the compacted contents. A transaction that was only partially
+// written, because heketi was terminated, is dropped on the next open.
+type LocalKV struct {
+	lock     sync.RWMutex
+	path     string
+	fp       *os.File
+	readOnly bool
+
+	// revision of the last applied transaction
+	rev int64
+	// revisions of every key, oldest first, and all keys in order
+	values map[string][]localKVValue
+	keys   []string
+	// keys that still hold old revisions or a deletion
+	dirty map[string]bool
+	// number of snapshots open at each revision
+	snapshots map[int64]int
+
+	// size of the file, and its size right after it was compacted
+	size          int64
+	compactedSize int64
+	compactMin    int64
+}
+
+// localKVValue is the value of a key at a revision, nil if the key
+// was deleted.
+type localKVValue struct {
+	rev   int64
+	value []byte
+}
+
+type localKVTxn struct {
+	Ops []KVOp `json:"ops"`
+}
+
+// OpenLocalKV opens, and creates if needed, the local KV stored in the
+// file at path. The file is locked so that only one process can use it
+// at a time, unless it is opened read-only.
+func OpenLocalKV(path string, readOnly bool) (*LocalKV, error) {
+	kv := &LocalKV{
+		path:       path,
+		readOnly:   readOnly,
+		values:     map[string][]localKVValue{},
+		dirty:      map[string]bool{},
+		snapshots:  map[int64]int{},
+		compactMin: localKVCompactMinSize,
+	}
+
+	flags := os.O_RDWR | os.O_CREATE
+	lock := syscall.LOCK_EX
+	if readOnly {
+		flags = os.O_RDONLY
+		lock = syscall.LOCK_SH
+	}
+	fp, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(fp.Fd()), lock|syscall.LOCK_NB); err != nil {
+		fp.Close()
+		return nil, fmt.Errorf("Unable to lock %v: %v", path, err)
+	}
+
+	if err := kv.load(fp); err != nil {
+		fp.Close()
+		return nil, err
+	}
+	if readOnly {
+		kv.fp = fp
+		return kv, nil
+	}
+
+	// The lock is held on the old file until the compacted file
+	// replaces it and is locked in turn.
+	kv.fp = fp
+	if err := kv.compact(); err != nil {
+		fp.Close()
+		return nil, err
+	}
+	return kv, nil
+}
+
+func (kv *LocalKV) load(fp *os.File) error {
+	r := bufio.NewReader(fp)
+	magic, err := r.ReadString('\n')
+	if err != nil {
+		if magic == "" {
+			// new file
+			return nil
+		}
+		return fmt.Errorf("%v is not a local kv file", kv.path)
+	}
+	if magic != localKVMagic {
+		return fmt.Errorf("%v is not a local kv file", kv.path)
+	}
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			// a missing newline means the last transaction was not
+			// completely written
+			return nil
+		}
+		var txn localKVTxn
+		if err := json.Unmarshal(line, &txn); err != nil {
+			return fmt.Errorf("Unable to read %v: %v", kv.path, err)
+		}
+		kv.apply(txn.Ops)
+	}
+}
+
+// compact writes the current contents to a new file, which atomically
+// replaces the existing file and is used for the transactions that
+// follow.
+func (kv *LocalKV) compact() error {
+	tmp := kv.path + ".tmp"
+	fp, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Flock(int(fp.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		fp.Close()
+		return err
+	}
+
+	txn := localKVTxn{Ops: make([]KVOp, 0, len(kv.keys))}
+	for _, key := range kv.keys {
+		if value := kv.get(key, kv.rev); value != nil {
+			txn.Ops = append(txn.Ops, KVOp{Key: key, Value: value})
+		}
+	}
+	size, err := kv.write(fp, []byte(localKVMagic))
+	if err == nil && len(txn.Ops) > 0 {
+		var n int64
+		n, err = kv.writeTxn(fp, txn)
+		size += n
+	}
+	if err == nil {
+		err = os.Rename(tmp, kv.path)
+	}
+	if err != nil {
+		fp.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	kv.fp.Close()
+	kv.fp = fp
+	kv.size = size
+	kv.compactedSize = size
+	return nil
+}
+
+func (kv *LocalKV) write(fp *os.File, data []byte) (int64, error) {
+	n, err := fp.Write(data)
+	if err != nil {
+		return int64(n), err
+	}
+	return int64(n), fp.Sync()
+}
+
+func (kv *LocalKV) writeTxn(fp *os.File, txn localKVTxn) (int64, error) {
+	data, err := json.Marshal(txn)
+	if err != nil {
+		return 0, err
+	}
+	return kv.write(fp, append(data, '\n'))
+}
+
+// apply adds a new revision with the writes of ops. Only the revisions
+// of the keys that were written are touched.
+func (kv *LocalKV) apply(ops []KVOp) {
+	kv.rev++
+	for _, op := range ops {
+		value := op.Value
+		if op.Delete {
+			value = nil
+		} else if value == nil {
+			value = []byte{}
+		}
+
+		revs, exists := kv.values[op.Key]
+		if !exists {
+			if op.Delete {
+				continue
+			}
+			i := sort.SearchStrings(kv.keys, op.Key)
+			kv.keys = append(kv.keys, "")
+			copy(kv.keys[i+1:], kv.keys[i:])
+			kv.keys[i] = op.Key
+		}
+		kv.values[op.Key] = append(revs, localKVValue{rev: kv.rev, value: value})
+		kv.dirty[op.Key] = true
+	}
+	kv.prune()
+}
+
+// prune drops the revisions of dirty keys that no open snapshot can
+// see anymore, and the keys whose only remaining revision is their
+// deletion.
+func (kv *LocalKV) prune() {
+	oldest := kv.rev
+	for rev := range kv.snapshots {
+		if rev < oldest {
+			oldest = rev
+		}
+	}
+
+	for key := range kv.dirty {
+		revs := kv.values[key]
+		// keep the newest revision seen by the oldest snapshot
+		first := 0
+		for i, v := range revs {
+			if v.rev <= oldest {
+				first = i
+			}
+		}
+		revs = revs[first:]
+
+		switch {
+		case len(revs) == 1 && revs[0].value == nil && revs[0].rev <= oldest:
+			delete(kv.values, key)
+			i := sort.SearchStrings(kv.keys, key)
+			kv.keys = append(kv.keys[:i], kv.keys[i+1:]...)
+			delete(kv.dirty, key)
+		case len(revs) == 1:
+			kv.values[key] = revs
+			delete(kv.dirty, key)
+		default:
+			kv.values[key] = revs
+		}
+	}
+}
+
+// get returns the value of key at revision rev, or nil if the key did
+// not exist then.
+func (kv *LocalKV) get(key string, rev int64) []byte {
+	revs := kv.values[key]
+	for i := len(revs) - 1; i >= 0; i-- {
+		if revs[i].rev <= rev {
+			return revs[i].value
+		}
+	}
+	return nil
+}
+
+func (kv *LocalKV) rangeAt(prefix string, rev int64) []KeyValue {
+	kvs := []KeyValue{}
+	for i := sort.SearchStrings(kv.keys, prefix); i < len(kv.keys); i++ {
+		key := kv.keys[i]
+		if !strings.HasPrefix(key, prefix) {
+			break
+		}
+		if value := kv.get(key, rev); value != nil {
+			kvs = append(kvs, KeyValue{Key: key, Value: value})
+		}
+	}
+	return kvs
+}
+
+// Get returns the value of key or nil if the key does not exist.
+func (kv *LocalKV) Get(key string) ([]byte, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	if kv.fp == nil {
+		return nil, ErrKVClosed
+	}
+	return kv.get(key, kv.rev), nil
+}
+
+// Range returns all key/value pairs whose key starts with prefix,
+// in key order.
+func (kv *LocalKV) Range(prefix string) ([]KeyValue, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	if kv.fp == nil {
+		return nil, ErrKVClosed
+	}
+	return kv.rangeAt(prefix, kv.rev), nil
+}
+
+// Snapshot returns the current contents of the KV. Transactions
+// applied later are not visible in the snapshot. The revisions it
+// reads are kept until it is released.
+func (kv *LocalKV) Snapshot() (KVSnapshot, error) {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	if kv.fp == nil {
+		return nil, ErrKVClosed
+	}
+	kv.snapshots[kv.rev]++
+	return &localKVSnapshot{kv: kv, rev: kv.rev}, nil
+}
+
+// Txn atomically applies all ops.
+func (kv *LocalKV) Txn(ops []KVOp) error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	if kv.fp == nil {
+		return ErrKVClosed
+	}
+	if kv.readOnly {
+		return ErrStoreReadOnly
+	}
+
+	// do not leave a partially written transaction in front of the
+	// ones that follow
+	n, err := kv.writeTxn(kv.fp, localKVTxn{Ops: ops})
+	if err != nil {
+		kv.fp.Truncate(kv.size)
+		kv.fp.Seek(kv.size, io.SeekStart)
+		return err
+	}
+	kv.size += n
+	kv.apply(ops)
+
+	if grown := kv.size - kv.compactedSize; grown > kv.compactedSize &&
+		grown > kv.compactMin {
+		// the transaction is already committed to the log, failing to
+		// compact it only means the log stays large for now
+		kv.compact()
+	}
+	return nil
+}
+
+// Close closes the log file and releases its lock.
+func (kv *LocalKV) Close() error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	if kv.fp == nil {
+		return nil
+	}
+	err := kv.fp.Close()
+	kv.fp = nil
+	return err
+}
+
+// localKVSnapshot reads a LocalKV at a fixed revision.
+type localKVSnapshot struct {
+	kv       *LocalKV
+	rev      int64
+	released bool
+}
+
+// Get returns the value of key or nil if the key does not exist.
+func (s *localKVSnapshot) Get(key string) ([]byte, error) {
+	s.kv.lock.RLock()
+	defer s.kv.lock.RUnlock()
+
+	if s.kv.fp == nil {
+		return nil, ErrKVClosed
+	}
+	return s.kv.get(key, s.rev), nil
+}
+
+// Range returns all key/value pairs whose key starts with prefix,
+// in key order.
+func (s *localKVSnapshot) Range(prefix string) ([]KeyValue, error) {
+	s.kv.lock.RLock()
+	defer s.kv.lock.RUnlock()
+
+	if s.kv.fp == nil {
+		return nil, ErrKVClosed
+	}
+	return s.kv.rangeAt(prefix, s.rev), nil
+}
+
+// Release lets the KV drop the revisions only the snapshot could see.
+func (s *localKVSnapshot) Release() {
+	s.kv.lock.Lock()
+	defer s.kv.lock.Unlock()
+
+	if s.released {
+		return
+	}
+	s.released = true
+	if s.kv.snapshots[s.rev]--; s.kv.snapshots[s.rev] == 0 {
+		delete(s.kv.snapshots, s.rev)
+	}
+}
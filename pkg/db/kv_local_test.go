@@ -0,0 +1,190 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package db
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestLocalKVTxnAndRange(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	kv, err := OpenLocalKV(tmpfile, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer kv.Close()
+
+	err = kv.Txn([]KVOp{
+		{Key: "/a/2", Value: []byte("2")},
+		{Key: "/a/1", Value: []byte("1")},
+		{Key: "/b/1", Value: []byte("b")},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = kv.Txn([]KVOp{
+		{Key: "/a/2", Delete: true},
+		{Key: "/a/3", Value: []byte("3")},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	kvs, err := kv.Range("/a/")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(kvs) == 2, "expected 2 keys, got:", kvs)
+	tests.Assert(t, kvs[0].Key == "/a/1" && kvs[1].Key == "/a/3")
+
+	v, err := kv.Get("/a/2")
+	tests.Assert(t, err == nil && v == nil)
+	v, err = kv.Get("/b/1")
+	tests.Assert(t, err == nil && string(v) == "b")
+}
+
+func TestLocalKVSnapshot(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	kv, err := OpenLocalKV(tmpfile, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer kv.Close()
+
+	err = kv.Txn([]KVOp{{Key: "/a/1", Value: []byte("1")}})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	snapshot, err := kv.Snapshot()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = kv.Txn([]KVOp{
+		{Key: "/a/1", Delete: true},
+		{Key: "/a/2", Value: []byte("2")},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	v, err := snapshot.Get("/a/1")
+	tests.Assert(t, err == nil && string(v) == "1")
+	kvs, err := snapshot.Range("/a/")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(kvs) == 1 && kvs[0].Key == "/a/1", "got:", kvs)
+
+	kvs, err = kv.Range("/a/")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(kvs) == 1 && kvs[0].Key == "/a/2", "got:", kvs)
+
+	// the deleted key is kept only as long as the snapshot needs it
+	tests.Assert(t, len(kv.values["/a/1"]) == 2, "got:", kv.values["/a/1"])
+	snapshot.Release()
+	err = kv.Txn([]KVOp{{Key: "/a/3", Value: []byte("3")}})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, ok := kv.values["/a/1"]
+	tests.Assert(t, !ok, "expected /a/1 to be dropped, got:", kv.values["/a/1"])
+	tests.Assert(t, len(kv.keys) == 2, "got:", kv.keys)
+	tests.Assert(t, len(kv.dirty) == 0, "got:", kv.dirty)
+}
+
+func TestLocalKVCompact(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	kv, err := OpenLocalKV(tmpfile, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	kv.compactMin = 1024
+
+	// rewriting the same keys must not grow the file without bound
+	for i := 0; i < 1000; i++ {
+		err = kv.Txn([]KVOp{
+			{Key: "/a/1", Value: []byte(fmt.Sprintf("value %v", i))},
+			{Key: "/a/2", Value: []byte("2")},
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	fi, err := os.Stat(tmpfile)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, fi.Size() <= 2*1024+kv.compactedSize,
+		"expected compacted file, got size:", fi.Size())
+	kv.Close()
+
+	kv, err = OpenLocalKV(tmpfile, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer kv.Close()
+	v, _ := kv.Get("/a/1")
+	tests.Assert(t, string(v) == "value 999", "got:", string(v))
+	v, _ = kv.Get("/a/2")
+	tests.Assert(t, string(v) == "2", "got:", string(v))
+}
+
+func TestLocalKVLocked(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	kv, err := OpenLocalKV(tmpfile, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	_, err = OpenLocalKV(tmpfile, false)
+	tests.Assert(t, err != nil)
+	_, err = OpenLocalKV(tmpfile, true)
+	tests.Assert(t, err != nil)
+
+	kv.Close()
+	_, err = kv.Get("/a")
+	tests.Assert(t, err == ErrKVClosed, "expected ErrKVClosed, got:", err)
+
+	kv, err = OpenLocalKV(tmpfile, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer kv.Close()
+	err = kv.Txn([]KVOp{{Key: "/a", Value: []byte("a")}})
+	tests.Assert(t, err == ErrStoreReadOnly, "expected ErrStoreReadOnly, got:", err)
+}
+
+func TestLocalKVTornWrite(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	kv, err := OpenLocalKV(tmpfile, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = kv.Txn([]KVOp{{Key: "/a", Value: []byte("a")}})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	kv.Close()
+
+	// simulate heketi being killed half way through a transaction
+	fp, err := os.OpenFile(tmpfile, os.O_APPEND|os.O_WRONLY, 0600)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = fp.WriteString(`{"ops":[{"k":"/b","v":"Yg=="}`)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	fp.Close()
+
+	kv, err = OpenLocalKV(tmpfile, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer kv.Close()
+	v, _ := kv.Get("/a")
+	tests.Assert(t, string(v) == "a")
+	v, _ = kv.Get("/b")
+	tests.Assert(t, v == nil)
+
+	// the partial transaction is gone after compaction
+	err = kv.Txn([]KVOp{{Key: "/c", Value: []byte("c")}})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	kv.Close()
+	kv, err = OpenLocalKV(tmpfile, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	v, _ = kv.Get("/c")
+	tests.Assert(t, string(v) == "c")
+	kv.Close()
+}
+
+func TestLocalKVNotKVFile(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	err := ioutil.WriteFile(tmpfile, []byte("something else\n"), 0600)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = OpenLocalKV(tmpfile, false)
+	tests.Assert(t, err != nil)
+}
@@ -0,0 +1,139 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	// BackendBolt stores the db in a single BoltDB file.
+	BackendBolt = "bolt"
+	// BackendLocalKV stores the db in a key-value store kept in a
+	// single local file, see LocalKV. Like BoltDB it is only suitable
+	// for a single heketi instance.
+	BackendLocalKV = "localkv"
+)
+
+// Tx is a transaction on a Store. Values returned by Get are only
+// valid for the life of the transaction.
+type Tx interface {
+	// Bucket returns the bucket with the given name or nil if it
+	// does not exist.
+	Bucket(name []byte) Bucket
+	// CreateBucketIfNotExists returns the bucket with the given name,
+	// creating it first if needed.
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	// ForEach calls fn for every bucket in the store.
+	ForEach(fn func(name []byte, b Bucket) error) error
+	// WriteTo writes a copy of the store, in BoltDB format, to w.
+	WriteTo(w io.Writer) (int64, error)
+}
+
+// Bucket is a collection of key/value pairs in a Store.
+type Bucket interface {
+	Get(key []byte) []byte
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+	// ForEach calls fn for every key/value pair in the bucket,
+	// in key order.
+	ForEach(fn func(k, v []byte) error) error
+}
+
+// Store is a db connection backed by one of the storage backends.
+type Store interface {
+	DB
+	Close() error
+}
+
+// Open opens the store of the given backend at path. If backend is
+// empty the backend is detected from the existing file, defaulting
+// to BoltDB for new files.
+func Open(backend string, path string, readOnly bool) (Store, error) {
+	if backend == "" {
+		backend = DetectBackend(path)
+	}
+
+	switch backend {
+	case BackendBolt:
+		return OpenBoltStore(path, readOnly)
+	case BackendLocalKV:
+		kv, err := OpenLocalKV(path, readOnly)
+		if err != nil {
+			return nil, err
+		}
+		return NewKVStore(kv, readOnly), nil
+	default:
+		return nil, fmt.Errorf("Unknown db backend: %v", backend)
+	}
+}
+
+// DetectBackend returns the backend of the store at path.
+func DetectBackend(path string) string {
+	fp, err := os.Open(path)
+	if err != nil {
+		return BackendBolt
+	}
+	defer fp.Close()
+
+	header := make([]byte, len(localKVMagic))
+	if _, err := io.ReadFull(fp, header); err == nil &&
+		bytes.Equal(header, []byte(localKVMagic)) {
+		return BackendLocalKV
+	}
+	return BackendBolt
+}
+
+// writeBoltCopy writes a copy of the contents of tx as a BoltDB file to
+// w. It is used by stores that do not use the BoltDB format natively so
+// that backups are always in the same format.
+func writeBoltCopy(tx Tx, w io.Writer) (int64, error) {
+	tmpfile, err := ioutil.TempFile("", "heketi-copy")
+	if err != nil {
+		return 0, err
+	}
+	tmpfile.Close()
+	defer os.Remove(tmpfile.Name())
+
+	dbcopy, err := bolt.Open(tmpfile.Name(), 0600, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		return 0, err
+	}
+	defer dbcopy.Close()
+
+	err = dbcopy.Update(func(copytx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b Bucket) error {
+			copyb, err := copytx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			return b.ForEach(func(k, v []byte) error {
+				return copyb.Put(k, v)
+			})
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	err = dbcopy.View(func(copytx *bolt.Tx) error {
+		n, err = copytx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
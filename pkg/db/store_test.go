@@ -0,0 +1,263 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package db
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func testStoreBackends(t *testing.T, fn func(t *testing.T, backend string)) {
+	for _, backend := range []string{BackendBolt, BackendLocalKV} {
+		t.Run(backend, func(t *testing.T) {
+			fn(t, backend)
+		})
+	}
+}
+
+func TestStorePutGetDelete(t *testing.T) {
+	testStoreBackends(t, func(t *testing.T, backend string) {
+		tmpfile := tests.Tempfile()
+		defer os.Remove(tmpfile)
+
+		s, err := Open(backend, tmpfile, false)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		defer s.Close()
+
+		err = s.Update(func(tx Tx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte("b1"))
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, b.Put([]byte("k2"), []byte("v2")) == nil)
+			tests.Assert(t, b.Put([]byte("k1"), []byte("v1")) == nil)
+			tests.Assert(t, b.Put([]byte("k3"), []byte("v3")) == nil)
+			tests.Assert(t, b.Delete([]byte("k3")) == nil)
+
+			// writes are visible inside the transaction
+			tests.Assert(t, string(b.Get([]byte("k1"))) == "v1")
+			tests.Assert(t, b.Get([]byte("k3")) == nil)
+
+			_, err = tx.CreateBucketIfNotExists([]byte("b2"))
+			return err
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+		err = s.View(func(tx Tx) error {
+			tests.Assert(t, tx.Bucket([]byte("nope")) == nil)
+
+			names := []string{}
+			err := tx.ForEach(func(name []byte, b Bucket) error {
+				names = append(names, string(name))
+				return nil
+			})
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, len(names) == 2 && names[0] == "b1" && names[1] == "b2",
+				"unexpected buckets:", names)
+
+			b := tx.Bucket([]byte("b1"))
+			tests.Assert(t, b != nil)
+			tests.Assert(t, b.Get([]byte("k3")) == nil)
+			keys := []string{}
+			err = b.ForEach(func(k, v []byte) error {
+				keys = append(keys, string(k)+"="+string(v))
+				return nil
+			})
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, len(keys) == 2 && keys[0] == "k1=v1" && keys[1] == "k2=v2",
+				"unexpected keys:", keys)
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	})
+}
+
+func TestStoreRollback(t *testing.T) {
+	testStoreBackends(t, func(t *testing.T, backend string) {
+		tmpfile := tests.Tempfile()
+		defer os.Remove(tmpfile)
+
+		s, err := Open(backend, tmpfile, false)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		defer s.Close()
+
+		failed := errors.New("failed")
+		err = s.Update(func(tx Tx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte("b1"))
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			b.Put([]byte("k1"), []byte("v1"))
+			return failed
+		})
+		tests.Assert(t, err == failed, "expected err == failed, got:", err)
+
+		err = s.View(func(tx Tx) error {
+			tests.Assert(t, tx.Bucket([]byte("b1")) == nil)
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	})
+}
+
+func TestStoreReopen(t *testing.T) {
+	testStoreBackends(t, func(t *testing.T, backend string) {
+		tmpfile := tests.Tempfile()
+		defer os.Remove(tmpfile)
+
+		s, err := Open(backend, tmpfile, false)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		for _, v := range []string{"v1", "v2", "v3"} {
+			err = s.Update(func(tx Tx) error {
+				b, err := tx.CreateBucketIfNotExists([]byte("b1"))
+				if err != nil {
+					return err
+				}
+				return b.Put([]byte("k1"), []byte(v))
+			})
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		}
+		s.Close()
+
+		// the backend is detected from the file
+		tests.Assert(t, DetectBackend(tmpfile) == backend,
+			"expected", backend, "got:", DetectBackend(tmpfile))
+
+		s, err = Open("", tmpfile, true)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		defer s.Close()
+		err = s.View(func(tx Tx) error {
+			b := tx.Bucket([]byte("b1"))
+			tests.Assert(t, b != nil)
+			tests.Assert(t, string(b.Get([]byte("k1"))) == "v3")
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+		// writes to a read-only store fail
+		err = s.Update(func(tx Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte("b2"))
+			return err
+		})
+		tests.Assert(t, err != nil)
+	})
+}
+
+func TestStoreWriteToBolt(t *testing.T) {
+	testStoreBackends(t, func(t *testing.T, backend string) {
+		tmpfile := tests.Tempfile()
+		defer os.Remove(tmpfile)
+
+		s, err := Open(backend, tmpfile, false)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		defer s.Close()
+		err = s.Update(func(tx Tx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte("b1"))
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte("k1"), []byte("v1"))
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+		var backup bytes.Buffer
+		err = s.View(func(tx Tx) error {
+			_, err := tx.WriteTo(&backup)
+			return err
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+		// backups are always BoltDB files
+		backupfile := tests.Tempfile()
+		defer os.Remove(backupfile)
+		err = ioutil.WriteFile(backupfile, backup.Bytes(), 0600)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, DetectBackend(backupfile) == BackendBolt)
+
+		bs, err := OpenBoltStore(backupfile, true)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		defer bs.Close()
+		err = bs.View(func(tx Tx) error {
+			b := tx.Bucket([]byte("b1"))
+			tests.Assert(t, b != nil)
+			tests.Assert(t, string(b.Get([]byte("k1"))) == "v1")
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	})
+}
+
+// BoltDB gives the same isolation, but can not be tested this way as
+// its write transactions may wait for the read transactions to end
+// when the db file grows.
+func TestKVStoreViewSnapshot(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	s, err := Open(BackendLocalKV, tmpfile, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer s.Close()
+
+	err = s.Update(func(tx Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("b1"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("k1"), []byte("v1"))
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = s.View(func(tx Tx) error {
+		b := tx.Bucket([]byte("b1"))
+		tests.Assert(t, string(b.Get([]byte("k1"))) == "v1")
+
+		// a write committed while the view is running
+		done := make(chan error)
+		go func() {
+			done <- s.Update(func(tx Tx) error {
+				b := tx.Bucket([]byte("b1"))
+				if err := b.Put([]byte("k1"), []byte("v2")); err != nil {
+					return err
+				}
+				return b.Put([]byte("k2"), []byte("v2"))
+			})
+		}()
+		tests.Assert(t, <-done == nil)
+
+		// is not seen by the view
+		tests.Assert(t, string(b.Get([]byte("k1"))) == "v1")
+		tests.Assert(t, b.Get([]byte("k2")) == nil)
+		keys := 0
+		b.ForEach(func(k, v []byte) error {
+			keys++
+			return nil
+		})
+		tests.Assert(t, keys == 1, "expected 1 key, got:", keys)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = s.View(func(tx Tx) error {
+		b := tx.Bucket([]byte("b1"))
+		tests.Assert(t, string(b.Get([]byte("k1"))) == "v2")
+		tests.Assert(t, string(b.Get([]byte("k2"))) == "v2")
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestOpenUnknownBackend(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	_, err := Open("foo", tmpfile, false)
+	tests.Assert(t, err != nil)
+}
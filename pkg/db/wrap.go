@@ -11,49 +11,47 @@ package db
 
 import (
 	"errors"
-
-	"github.com/boltdb/bolt"
 )
 
 // RODB provides an abstraction for all types of db connection that
 // support Read-Only transactions.
 type RODB interface {
-	View(func(*bolt.Tx) error) error
+	View(func(Tx) error) error
 }
 
 // DB provides an abstraction for all types of db connection that
 // support both read and write transactions.
 type DB interface {
 	RODB
-	Update(func(*bolt.Tx) error) error
+	Update(func(Tx) error) error
 }
 
-// DBWrap encapsulates a bolt DB object in a minimal interface
+// DBWrap encapsulates a Store object in a minimal interface
 // with additional run-time hooks and checks.
 type DBWrap struct {
-	db       *bolt.DB
+	db       Store
 	readOnly bool
 }
 
 // NewDBWrap creates a new DBWrap that is defaulted to read/write mode.
-func NewDBWrap(db *bolt.DB) *DBWrap {
+func NewDBWrap(db Store) *DBWrap {
 	return &DBWrap{db, false}
 }
 
 // View wraps a read-only transaction.
-func (w *DBWrap) View(cb func(*bolt.Tx) error) error {
-	return w.db.View(func(tx *bolt.Tx) error {
+func (w *DBWrap) View(cb func(Tx) error) error {
+	return w.db.View(func(tx Tx) error {
 		return cb(tx)
 	})
 }
 
 // Update wraps a read-write transaction.
 // If Update is called on a read-only DBWrap it panics.
-func (w *DBWrap) Update(cb func(*bolt.Tx) error) error {
+func (w *DBWrap) Update(cb func(Tx) error) error {
 	if w.readOnly {
 		panic(errors.New("Can not update a read-only DBWrap"))
 	}
-	return w.db.Update(func(tx *bolt.Tx) error {
+	return w.db.Update(func(tx Tx) error {
 		return cb(tx)
 	})
 }
@@ -64,23 +62,23 @@ func (w *DBWrap) ReadOnly() *DBWrap {
 	return &DBWrap{w.db, true}
 }
 
-// TxWrap encapsulates a bolt DB Tx object in a wrapper that implements
+// TxWrap encapsulates a Tx object in a wrapper that implements
 // the RODB and DB interfaces. This is useful when defining a function
 // that can be used inside a transcation or start a transcation.
 type TxWrap struct {
-	tx       *bolt.Tx
+	tx       Tx
 	readOnly bool
 }
 
 // View fakes a read-only transaction. The function signature of a read-only
 // transaction is supported but no new transaction is started.
-func (w *TxWrap) View(cb func(*bolt.Tx) error) error {
+func (w *TxWrap) View(cb func(Tx) error) error {
 	return cb(w.tx)
 }
 
 // Update fakes a read-write transaction. The function signature of a read-write
 // transaction is supported but no new transaction is started.
-func (w *TxWrap) Update(cb func(*bolt.Tx) error) error {
+func (w *TxWrap) Update(cb func(Tx) error) error {
 	if w.readOnly {
 		panic(errors.New("Can not update a read-only TxWrap"))
 	}
@@ -92,14 +90,14 @@ func (w *TxWrap) Update(cb func(*bolt.Tx) error) error {
 // Panics if the type is not valid for read-write encapsulation.
 func WrapReadWrite(db DB) *DBWrap {
 	switch db.(type) {
-	case *bolt.DB:
-		return NewDBWrap(db.(*bolt.DB))
 	case *DBWrap:
 		w := db.(*DBWrap)
 		if w.readOnly {
 			panic(errors.New("read-only DBWrap may not be wrapped as read-write"))
 		}
 		return w
+	case Store:
+		return NewDBWrap(db.(Store))
 	default:
 		panic(errors.New("type can not be wrapped in a db capsule"))
 	}
@@ -110,30 +108,30 @@ func WrapReadWrite(db DB) *DBWrap {
 // Panics if the type is not valid for read-only encapsulation.
 func WrapReadOnly(db DB) *DBWrap {
 	switch db.(type) {
-	case *bolt.DB:
-		return NewDBWrap(db.(*bolt.DB)).ReadOnly()
 	case *DBWrap:
 		w := db.(*DBWrap)
 		if w.readOnly {
 			return w
 		}
 		return w.ReadOnly()
+	case Store:
+		return NewDBWrap(db.(Store)).ReadOnly()
 	default:
 		panic(errors.New("type can not be wrapped in a read only db capsule"))
 	}
 }
 
-// WrapTx takes a bolt db transaction object and return a TxWrap object.
+// WrapTx takes a db transaction object and return a TxWrap object.
 // This new object can now be used where the DB or RODB interfaces are
 // used without starting a new transaction.
-func WrapTx(tx *bolt.Tx) *TxWrap {
+func WrapTx(tx Tx) *TxWrap {
 	return &TxWrap{tx, false}
 }
 
-// WrapTx takes a bolt db transaction object and return a TxWrap object.
+// WrapTx takes a db transaction object and return a TxWrap object.
 // This new object can now be used where the DB or RODB interfaces are
 // used without starting a new transaction.
 // This wrapper will panic is .Update is called at runtime.
-func WrapTxReadOnly(tx *bolt.Tx) *TxWrap {
+func WrapTxReadOnly(tx Tx) *TxWrap {
 	return &TxWrap{tx, true}
 }
@@ -12,9 +12,7 @@ package db
 import (
 	"os"
 	"testing"
-	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/heketi/tests"
 )
 
@@ -23,22 +21,22 @@ func TestMinimalDBWrap(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
-	tests.Assert(t, err == nil, "expected (bolt.Open) err == nil, got:", err)
-	tests.Assert(t, db != nil, "expected (bolt.Open) db != nil, got:", err)
+	db, err := OpenBoltStore(tmpfile, false)
+	tests.Assert(t, err == nil, "expected (OpenBoltStore) err == nil, got:", err)
+	tests.Assert(t, db != nil, "expected (OpenBoltStore) db != nil, got:", err)
 
 	w := NewDBWrap(db)
 	tests.Assert(t, !w.readOnly, "expected w.readOnly to be false, got:", w.readOnly)
 
 	wasCalled := false
-	w.View(func(tx *bolt.Tx) error {
+	w.View(func(tx Tx) error {
 		wasCalled = true
 		return nil
 	})
 	tests.Assert(t, wasCalled, "expected wasCalled to be true, got:", wasCalled)
 
 	wasCalled = false
-	w.Update(func(tx *bolt.Tx) error {
+	w.Update(func(tx Tx) error {
 		wasCalled = true
 		return nil
 	})
@@ -50,9 +48,9 @@ func TestDBWrapping(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
-	tests.Assert(t, err == nil, "expected (bolt.Open) err == nil, got:", err)
-	tests.Assert(t, db != nil, "expected (bolt.Open) db != nil, got:", err)
+	db, err := OpenBoltStore(tmpfile, false)
+	tests.Assert(t, err == nil, "expected (OpenBoltStore) err == nil, got:", err)
+	tests.Assert(t, db != nil, "expected (OpenBoltStore) db != nil, got:", err)
 
 	w := WrapReadWrite(db)
 	tests.Assert(t, !w.readOnly, "expected w.readOnly to be false, got:", w.readOnly)
@@ -68,9 +66,9 @@ func TestDBWrapToReadOnly(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
-	tests.Assert(t, err == nil, "expected (bolt.Open) err == nil, got:", err)
-	tests.Assert(t, db != nil, "expected (bolt.Open) db != nil, got:", err)
+	db, err := OpenBoltStore(tmpfile, false)
+	tests.Assert(t, err == nil, "expected (OpenBoltStore) err == nil, got:", err)
+	tests.Assert(t, db != nil, "expected (OpenBoltStore) db != nil, got:", err)
 
 	w := WrapReadWrite(db)
 	tests.Assert(t, !w.readOnly, "expected w.readOnly to be false, got:", w.readOnly)
@@ -84,9 +82,9 @@ func TestDBWrappingReadOnly(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
-	tests.Assert(t, err == nil, "expected (bolt.Open) err == nil, got:", err)
-	tests.Assert(t, db != nil, "expected (bolt.Open) db != nil, got:", err)
+	db, err := OpenBoltStore(tmpfile, false)
+	tests.Assert(t, err == nil, "expected (OpenBoltStore) err == nil, got:", err)
+	tests.Assert(t, db != nil, "expected (OpenBoltStore) db != nil, got:", err)
 
 	w := WrapReadOnly(db)
 	tests.Assert(t, w.readOnly, "expected w.readOnly to be true, got:", w.readOnly)
@@ -102,9 +100,9 @@ func TestDBWrappingConvertToReadOnly(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
-	tests.Assert(t, err == nil, "expected (bolt.Open) err == nil, got:", err)
-	tests.Assert(t, db != nil, "expected (bolt.Open) db != nil, got:", err)
+	db, err := OpenBoltStore(tmpfile, false)
+	tests.Assert(t, err == nil, "expected (OpenBoltStore) err == nil, got:", err)
+	tests.Assert(t, db != nil, "expected (OpenBoltStore) db != nil, got:", err)
 
 	w := WrapReadWrite(db)
 	tests.Assert(t, !w.readOnly, "expected w.readOnly to be false, got:", !w.readOnly)
@@ -120,9 +118,9 @@ func TestDBWrappingInvalidConverToReadWrite(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
-	tests.Assert(t, err == nil, "expected (bolt.Open) err == nil, got:", err)
-	tests.Assert(t, db != nil, "expected (bolt.Open) db != nil, got:", err)
+	db, err := OpenBoltStore(tmpfile, false)
+	tests.Assert(t, err == nil, "expected (OpenBoltStore) err == nil, got:", err)
+	tests.Assert(t, db != nil, "expected (OpenBoltStore) db != nil, got:", err)
 
 	w := WrapReadOnly(db)
 	tests.Assert(t, w.readOnly, "expected w.readOnly to be true, got:", w.readOnly)
@@ -140,9 +138,9 @@ func TestDBWrapPanicOnUpdateReadOnly(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
-	tests.Assert(t, err == nil, "expected (bolt.Open) err == nil, got:", err)
-	tests.Assert(t, db != nil, "expected (bolt.Open) db != nil, got:", err)
+	db, err := OpenBoltStore(tmpfile, false)
+	tests.Assert(t, err == nil, "expected (OpenBoltStore) err == nil, got:", err)
+	tests.Assert(t, db != nil, "expected (OpenBoltStore) db != nil, got:", err)
 
 	w := WrapReadOnly(db)
 	tests.Assert(t, w.readOnly, "expected w.readOnly to be true, got:", w.readOnly)
@@ -151,7 +149,7 @@ func TestDBWrapPanicOnUpdateReadOnly(t *testing.T) {
 		e := recover()
 		tests.Assert(t, e != nil, "expected e != nil, got", e)
 	}()
-	w.Update(func(tx *bolt.Tx) error {
+	w.Update(func(tx Tx) error {
 		t.Fatalf("should never get called")
 		return nil
 	})
@@ -162,11 +160,11 @@ type junkDB struct {
 	Foo int
 }
 
-func (j junkDB) View(func(tx *bolt.Tx) error) error {
+func (j junkDB) View(func(tx Tx) error) error {
 	return nil
 }
 
-func (j junkDB) Update(func(tx *bolt.Tx) error) error {
+func (j junkDB) Update(func(tx Tx) error) error {
 	return nil
 }
 
@@ -197,16 +195,16 @@ func TestTxWrapNestView(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
-	tests.Assert(t, err == nil, "expected (bolt.Open) err == nil, got:", err)
-	tests.Assert(t, db != nil, "expected (bolt.Open) db != nil, got:", err)
+	db, err := OpenBoltStore(tmpfile, false)
+	tests.Assert(t, err == nil, "expected (OpenBoltStore) err == nil, got:", err)
+	tests.Assert(t, db != nil, "expected (OpenBoltStore) db != nil, got:", err)
 
 	stuff := 0
 	// f mimics a standalone function that wants a DB object but we want
 	// to use it within an existing transaction
 	f := func(db RODB) error {
 		stuff++
-		db.View(func(tx *bolt.Tx) error {
+		db.View(func(tx Tx) error {
 			stuff++
 			return nil
 		})
@@ -214,7 +212,7 @@ func TestTxWrapNestView(t *testing.T) {
 		return nil
 	}
 
-	db.View(func(tx *bolt.Tx) error {
+	db.View(func(tx Tx) error {
 		stuff++
 		f(WrapTxReadOnly(tx))
 		stuff++
@@ -229,16 +227,16 @@ func TestTxWrapNestUpdate(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
-	tests.Assert(t, err == nil, "expected (bolt.Open) err == nil, got:", err)
-	tests.Assert(t, db != nil, "expected (bolt.Open) db != nil, got:", err)
+	db, err := OpenBoltStore(tmpfile, false)
+	tests.Assert(t, err == nil, "expected (OpenBoltStore) err == nil, got:", err)
+	tests.Assert(t, db != nil, "expected (OpenBoltStore) db != nil, got:", err)
 
 	stuff := 0
 	// f mimics a standalone function that wants a DB object but we want
 	// to use it within an existing transaction
 	f := func(db DB) error {
 		stuff++
-		db.Update(func(tx *bolt.Tx) error {
+		db.Update(func(tx Tx) error {
 			stuff++
 			return nil
 		})
@@ -246,7 +244,7 @@ func TestTxWrapNestUpdate(t *testing.T) {
 		return nil
 	}
 
-	db.Update(func(tx *bolt.Tx) error {
+	db.Update(func(tx Tx) error {
 		stuff++
 		f(WrapTx(tx))
 		stuff++
@@ -261,16 +259,16 @@ func TestTxWrapFailUpdateOnRO(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
-	tests.Assert(t, err == nil, "expected (bolt.Open) err == nil, got:", err)
-	tests.Assert(t, db != nil, "expected (bolt.Open) db != nil, got:", err)
+	db, err := OpenBoltStore(tmpfile, false)
+	tests.Assert(t, err == nil, "expected (OpenBoltStore) err == nil, got:", err)
+	tests.Assert(t, db != nil, "expected (OpenBoltStore) db != nil, got:", err)
 
 	stuff := 0
 	// f mimics a standalone function that wants a DB object but we want
 	// to use it within an existing transaction
 	f := func(db DB) error {
 		stuff++
-		db.Update(func(tx *bolt.Tx) error {
+		db.Update(func(tx Tx) error {
 			stuff++
 			return nil
 		})
@@ -287,7 +285,7 @@ func TestTxWrapFailUpdateOnRO(t *testing.T) {
 	// generally you would want to correctly use DB or RODB so that the type
 	// system can catch errors. However we have extra runtime guards against
 	// calling a write method on a R/O TxWrap.
-	db.Update(func(tx *bolt.Tx) error {
+	db.Update(func(tx Tx) error {
 		stuff++
 		f(WrapTxReadOnly(tx))
 		stuff++
@@ -35,6 +35,9 @@ var (
 	volumeNameRe = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
 
 	blockVolNameRe = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+	// SHA256 fingerprint of a ssh key, as printed by OpenSSH
+	hostKeyFingerprintRe = regexp.MustCompile("^SHA256:[a-zA-Z0-9+/]{43}$")
 )
 
 // ValidateUUID is written this way because heketi UUID does not
@@ -209,6 +212,24 @@ type NodeInfoResponse struct {
 	DevicesInfo []DeviceInfoResponse `json:"devices"`
 }
 
+// NodeHostKeyRequest pins the ssh host key of a node. When no
+// fingerprint is given the key the node presents is pinned.
+type NodeHostKeyRequest struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+func (req NodeHostKeyRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Fingerprint, validation.Match(hostKeyFingerprintRe)),
+	)
+}
+
+// NodeHostKeyResponse is the ssh host key pinned for a node. The
+// fingerprint is empty if no key is pinned.
+type NodeHostKeyResponse struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
 // Cluster
 
 type ClusterFlags struct {
@@ -380,6 +401,78 @@ type BlockVolumeListResponse struct {
 	BlockVolumes []string `json:"blockvolumes"`
 }
 
+// BlockVolumeAuthRequest enables or disables CHAP authentication on an
+// existing block volume. Enabling auth on a block volume that already
+// has auth enabled rotates its credentials.
+type BlockVolumeAuthRequest struct {
+	Auth bool `json:"auth"`
+}
+
+func (blockVolAuthReq BlockVolumeAuthRequest) Validate() error {
+	return validation.ValidateStruct(&blockVolAuthReq,
+		validation.Field(&blockVolAuthReq.Auth, validation.In(true, false)),
+	)
+}
+
+// OperationProgress is the body of the response to a status request
+// on an asynchronous operation that is still pending.
+type OperationProgress struct {
+	// Phase of the operation: queued, exec, finalize or rollback
+	Phase string `json:"phase"`
+	// Step within the phase, such as "bricks created", and how many
+	// of its items are done
+	Step  string `json:"step,omitempty"`
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+	// Host commands are currently sent to
+	Host string `json:"host,omitempty"`
+}
+
+// PendingOperationInfo describes an operation that has not completed.
+type PendingOperationInfo struct {
+	Id        string `json:"id"`
+	TypeName  string `json:"type_name"`
+	Timestamp int64  `json:"timestamp"`
+	// Status is queued while the operation waits for the scheduler,
+	// running otherwise
+	Status string `json:"status"`
+	// Position of a queued operation in the queue, starting at 1
+	Position int `json:"position,omitempty"`
+}
+
+type PendingOperationListResponse struct {
+	PendingOperations []PendingOperationInfo `json:"pendingoperations"`
+}
+
+// Changes of the bricks of a dry run
+const (
+	DryRunBrickAdd    = "add"
+	DryRunBrickDelete = "delete"
+)
+
+// DryRunBrick is a brick a request would create or delete.
+type DryRunBrick struct {
+	BrickInfo
+	// Manage hostname of the node of the brick
+	Host string `json:"host"`
+	// Change is add or delete
+	Change string `json:"change"`
+}
+
+// DryRunCommand is a command a request would run on a node.
+type DryRunCommand struct {
+	Host    string `json:"host"`
+	Command string `json:"command"`
+}
+
+// DryRunResponse is the response to a request made with dryrun=true.
+// It describes what the request would do, in the order it would do
+// it, without doing anything.
+type DryRunResponse struct {
+	Bricks   []DryRunBrick   `json:"bricks"`
+	Commands []DryRunCommand `json:"commands"`
+}
+
 // GeoReplicationActionType defines the different actions relevant to geo-rep sessions, except for delete
 type GeoReplicationActionType string
 
@@ -462,6 +555,29 @@ type ClusterSetMasterSlaveRequest struct {
 	MasterSlaveCluster
 }
 
+// Results of the sshd actions run on the nodes
+const (
+	SshdActionDone    = "done"
+	SshdActionSkipped = "skipped"
+	SshdActionFailed  = "failed"
+)
+
+// MasterSlaveSshdResult is the result of an sshd action on a node. The
+// nodes heketi cannot manage the sshd of are skipped.
+type MasterSlaveSshdResult struct {
+	Node   string `json:"node"`
+	Host   string `json:"host"`
+	Action string `json:"action"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ClusterSetMasterSlaveResponse lists the result of the sshd actions
+// run on the nodes of both clusters.
+type ClusterSetMasterSlaveResponse struct {
+	Sshd []MasterSlaveSshdResult `json:"sshd"`
+}
+
 type MasterSlaveClusterStatus struct {
 	MasterSlaveCluster
 }
@@ -677,3 +793,14 @@ func (v *BlockVolumeInfoResponse) String() string {
 
 	return s
 }
+
+func (p *OperationProgress) String() string {
+	s := p.Phase
+	if p.Step != "" {
+		s += fmt.Sprintf(": %v %v/%v", p.Step, p.Done, p.Total)
+	}
+	if p.Host != "" {
+		s += fmt.Sprintf(" on %v", p.Host)
+	}
+	return s
+}
@@ -0,0 +1,139 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+)
+
+const (
+	// ElectionFile elects the instance holding a lock on a file.
+	// Only useful when all instances share a local filesystem.
+	ElectionFile = "file"
+	// ElectionLease elects the instance holding a lease stored in a
+	// db shared by all instances. The db must be on a file system
+	// shared by the hosts of the instances, supporting flock.
+	ElectionLease = "lease"
+
+	DefaultLeaseTtl     = 15
+	DefaultProxyTimeout = 60
+)
+
+var (
+	ErrNoLeader = errors.New("No leader elected")
+	ErrStopped  = errors.New("Election stopped")
+
+	// support unit test dep. injection for the file system check
+	leaseDbShared = checkShared
+)
+
+// Config is the high availability section of the heketi configuration.
+type Config struct {
+	// Election is the method used to elect the leader. No election
+	// takes place, and the instance always serves requests, if empty.
+	Election string `json:"election"`
+
+	// AdvertiseUrl is the url other instances use to reach this one
+	// once it is the leader.
+	AdvertiseUrl string `json:"advertise_url"`
+
+	// Redirect tells followers to answer with a redirect to the
+	// leader instead of proxying the requests.
+	Redirect bool `json:"redirect"`
+
+	// LockFile is the file locked by the leader for file elections.
+	LockFile string `json:"lock_file"`
+
+	// LeaseDb is the db holding the lease for lease elections.
+	LeaseDb string `json:"lease_db"`
+
+	// LeaseTtl is how long, in seconds, a lease stays valid without
+	// being renewed.
+	LeaseTtl int `json:"lease_ttl"`
+
+	// ProxyTimeout is how long, in seconds, followers wait for the
+	// leader to answer a proxied request.
+	ProxyTimeout int `json:"proxy_timeout"`
+}
+
+// ProxyTimeoutDuration returns the timeout of the proxied requests.
+func (c *Config) ProxyTimeoutDuration() time.Duration {
+	if c.ProxyTimeout <= 0 {
+		return DefaultProxyTimeout * time.Second
+	}
+	return time.Duration(c.ProxyTimeout) * time.Second
+}
+
+// Elector elects one leader among a set of heketi instances.
+type Elector interface {
+	// Campaign blocks until this instance is the leader or until
+	// stop is closed.
+	Campaign(stop <-chan struct{}) error
+
+	// Leader returns the advertised url of the current leader.
+	Leader() (string, error)
+
+	// Lost returns a channel that is closed if this instance stops
+	// being the leader after it won the election.
+	Lost() <-chan struct{}
+
+	// Resign gives up the leadership.
+	Resign() error
+}
+
+// NewElector returns the elector configured in conf.
+func NewElector(conf *Config) (Elector, error) {
+	if conf.AdvertiseUrl == "" {
+		return nil, fmt.Errorf("advertise_url is required for leader election")
+	}
+
+	switch conf.Election {
+	case ElectionFile:
+		if conf.LockFile == "" {
+			return nil, fmt.Errorf("lock_file is required for file election")
+		}
+		return NewFileLockElector(conf.LockFile, conf.AdvertiseUrl), nil
+	case ElectionLease:
+		if conf.LeaseDb == "" {
+			return nil, fmt.Errorf("lease_db is required for lease election")
+		}
+		// the lease is only seen by all instances if they share it
+		if err := leaseDbShared(conf.LeaseDb); err != nil {
+			return nil, fmt.Errorf("lease_db must be on storage shared by all instances: %v", err)
+		}
+		ttl := conf.LeaseTtl
+		if ttl <= 0 {
+			ttl = DefaultLeaseTtl
+		}
+		open := func() (wdb.Store, error) {
+			return wdb.Open("", conf.LeaseDb, false)
+		}
+		return NewLeaseElector(open, conf.AdvertiseUrl,
+			time.Duration(ttl)*time.Second), nil
+	default:
+		return nil, fmt.Errorf("Unknown election method: %v", conf.Election)
+	}
+}
+
+// wait returns false if stop was closed before d elapsed.
+func wait(stop <-chan struct{}, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-stop:
+		return false
+	case <-t.C:
+		return true
+	}
+}
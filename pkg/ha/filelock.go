@@ -0,0 +1,124 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FileLockElector elects the instance holding an exclusive lock on a
+// file. The leader writes its url into the file for the followers.
+// The lock is released by the kernel when the leader terminates, so
+// leadership is never lost while the process is alive.
+type FileLockElector struct {
+	path     string
+	url      string
+	interval time.Duration
+
+	lock sync.Mutex
+	fp   *os.File
+	lost chan struct{}
+}
+
+func NewFileLockElector(path, url string) *FileLockElector {
+	return &FileLockElector{
+		path:     path,
+		url:      url,
+		interval: time.Second,
+		lost:     make(chan struct{}),
+	}
+}
+
+func (e *FileLockElector) Campaign(stop <-chan struct{}) error {
+	for {
+		fp, err := os.OpenFile(e.path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		err = syscall.Flock(int(fp.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			if err := e.advertise(fp); err != nil {
+				fp.Close()
+				return err
+			}
+			e.lock.Lock()
+			e.fp = fp
+			e.lock.Unlock()
+			return nil
+		}
+		fp.Close()
+		if err != syscall.EWOULDBLOCK {
+			return err
+		}
+
+		if !wait(stop, e.interval) {
+			return ErrStopped
+		}
+	}
+}
+
+func (e *FileLockElector) advertise(fp *os.File) error {
+	if err := fp.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := fp.WriteAt([]byte(e.url), 0); err != nil {
+		return err
+	}
+	return fp.Sync()
+}
+
+func (e *FileLockElector) Leader() (string, error) {
+	fp, err := os.Open(e.path)
+	if os.IsNotExist(err) {
+		return "", ErrNoLeader
+	} else if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	// if the lock can be taken nobody holds it and the url in the file
+	// belongs to a previous leader
+	err = syscall.Flock(int(fp.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	if err == nil {
+		syscall.Flock(int(fp.Fd()), syscall.LOCK_UN)
+		return "", ErrNoLeader
+	}
+
+	url, err := ioutil.ReadAll(fp)
+	if err != nil {
+		return "", err
+	}
+	if len(url) == 0 {
+		return "", ErrNoLeader
+	}
+	return strings.TrimSpace(string(url)), nil
+}
+
+func (e *FileLockElector) Lost() <-chan struct{} {
+	return e.lost
+}
+
+func (e *FileLockElector) Resign() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.fp == nil {
+		return nil
+	}
+	e.fp.Truncate(0)
+	err := e.fp.Close()
+	e.fp = nil
+	return err
+}
@@ -0,0 +1,78 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/heketi/tests"
+)
+
+func TestFileLockElector(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	e1 := NewFileLockElector(tmpfile, "http://one:8080")
+	e2 := NewFileLockElector(tmpfile, "http://two:8080")
+	e2.interval = 10 * time.Millisecond
+
+	_, err := e1.Leader()
+	tests.Assert(t, err == ErrNoLeader, "expected ErrNoLeader, got:", err)
+
+	err = e1.Campaign(nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	url, err := e2.Leader()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, url == "http://one:8080", "got:", url)
+
+	// the second instance waits until the first one resigns
+	stop := make(chan struct{})
+	elected := make(chan error, 1)
+	go func() {
+		elected <- e2.Campaign(stop)
+	}()
+	select {
+	case err := <-elected:
+		t.Fatalf("unexpected election: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	err = e1.Resign()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	select {
+	case err := <-elected:
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("second instance was not elected")
+	}
+	url, err = e1.Leader()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, url == "http://two:8080", "got:", url)
+	e2.Resign()
+}
+
+func TestFileLockElectorStop(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	e1 := NewFileLockElector(tmpfile, "http://one:8080")
+	e2 := NewFileLockElector(tmpfile, "http://two:8080")
+	e2.interval = 10 * time.Millisecond
+	err := e1.Campaign(nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer e1.Resign()
+
+	stop := make(chan struct{})
+	close(stop)
+	err = e2.Campaign(stop)
+	tests.Assert(t, err == ErrStopped, "expected ErrStopped, got:", err)
+}
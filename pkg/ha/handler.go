@@ -0,0 +1,104 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// seconds clients are asked to wait while no leader is elected
+	retryAfter = "5"
+)
+
+// FollowerHandler serves the requests received by an instance that is
+// not the leader. Followers do not open the db, all the requests,
+// reads included, are proxied to the leader, or the client is
+// redirected to it.
+type FollowerHandler struct {
+	elector  Elector
+	redirect bool
+	timeout  time.Duration
+}
+
+// NewFollowerHandler returns a handler proxying the requests to the
+// leader, giving it timeout to answer, or redirecting the clients to
+// it when redirect is true.
+func NewFollowerHandler(elector Elector,
+	redirect bool,
+	timeout time.Duration) *FollowerHandler {
+
+	return &FollowerHandler{
+		elector:  elector,
+		redirect: redirect,
+		timeout:  timeout,
+	}
+}
+
+func (h *FollowerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	leader, err := h.elector.Leader()
+	if err != nil {
+		w.Header().Set("Retry-After", retryAfter)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	target, err := url.Parse(leader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if h.redirect {
+		u := *r.URL
+		u.Scheme = target.Scheme
+		u.Host = target.Host
+		http.Redirect(w, r, u.String(), http.StatusTemporaryRedirect)
+		return
+	}
+
+	// The request goes to the leader it started with and keeps its
+	// timeout even if another instance is elected meanwhile. It is not
+	// sent again to the new leader, it may not be safe to repeat.
+	if h.timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+}
+
+// Switch is a http.Handler whose handler can be replaced while it
+// is serving, for example when an instance is elected leader.
+type Switch struct {
+	lock    sync.RWMutex
+	handler http.Handler
+}
+
+func NewSwitch(handler http.Handler) *Switch {
+	return &Switch{handler: handler}
+}
+
+func (s *Switch) Set(handler http.Handler) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.handler = handler
+}
+
+func (s *Switch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.RLock()
+	handler := s.handler
+	s.lock.RUnlock()
+	handler.ServeHTTP(w, r)
+}
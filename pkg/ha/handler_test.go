@@ -0,0 +1,150 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heketi/tests"
+)
+
+type testElector struct {
+	lock   sync.Mutex
+	leader string
+}
+
+func (e *testElector) setLeader(leader string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.leader = leader
+}
+
+func (e *testElector) Campaign(stop <-chan struct{}) error { return nil }
+func (e *testElector) Lost() <-chan struct{}               { return nil }
+func (e *testElector) Resign() error                       { return nil }
+
+func (e *testElector) Leader() (string, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.leader == "" {
+		return "", ErrNoLeader
+	}
+	return e.leader, nil
+}
+
+func TestFollowerHandlerProxy(t *testing.T) {
+	leader := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%v %v", r.Method, r.URL.Path)
+		}))
+	defer leader.Close()
+
+	elector := &testElector{}
+	follower := httptest.NewServer(NewFollowerHandler(elector, false, 0))
+	defer follower.Close()
+
+	// no leader yet
+	r, err := http.Post(follower.URL+"/volumes", "application/json", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusServiceUnavailable)
+	tests.Assert(t, r.Header.Get("Retry-After") != "")
+
+	elector.setLeader(leader.URL)
+	r, err = http.Post(follower.URL+"/volumes", "application/json", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusOK)
+	body, err := ioutil.ReadAll(r.Body)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, string(body) == "POST /volumes", "got:", string(body))
+}
+
+func TestFollowerHandlerLeaderChange(t *testing.T) {
+	// the old leader stops answering once it received the request
+	received := make(chan struct{})
+	release := make(chan struct{})
+	oldLeader := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			close(received)
+			<-release
+		}))
+	defer oldLeader.Close()
+	defer close(release)
+	newRequests := make(chan string, 10)
+	newLeader := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			newRequests <- r.URL.Path
+		}))
+	defer newLeader.Close()
+
+	elector := &testElector{leader: oldLeader.URL}
+	timeout := 200 * time.Millisecond
+	follower := httptest.NewServer(NewFollowerHandler(elector, false, timeout))
+	defer follower.Close()
+
+	go func() {
+		<-received
+		elector.setLeader(newLeader.URL)
+	}()
+
+	// the request still times out as it would have with the old leader,
+	// and is not sent again to the new one
+	start := time.Now()
+	r, err := http.Post(follower.URL+"/volumes", "application/json", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusBadGateway, "got:", r.StatusCode)
+	elapsed := time.Since(start)
+	tests.Assert(t, elapsed >= timeout && elapsed < 10*timeout, "got:", elapsed)
+	tests.Assert(t, len(newRequests) == 0)
+
+	// the next requests go to the new leader
+	r, err = http.Post(follower.URL+"/volumes", "application/json", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusOK, "got:", r.StatusCode)
+	tests.Assert(t, <-newRequests == "/volumes")
+}
+
+func TestFollowerHandlerRedirect(t *testing.T) {
+	elector := &testElector{leader: "http://leader:8080"}
+	follower := httptest.NewServer(NewFollowerHandler(elector, true, 0))
+	defer follower.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	r, err := client.Post(follower.URL+"/volumes?x=1", "application/json", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusTemporaryRedirect)
+	tests.Assert(t, r.Header.Get("Location") == "http://leader:8080/volumes?x=1",
+		"got:", r.Header.Get("Location"))
+}
+
+func TestSwitch(t *testing.T) {
+	s := NewSwitch(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/clusters", nil))
+	tests.Assert(t, w.Code == http.StatusServiceUnavailable)
+
+	s.Set(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/clusters", nil))
+	tests.Assert(t, w.Code == http.StatusOK)
+}
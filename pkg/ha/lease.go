@@ -0,0 +1,220 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+)
+
+const (
+	leaseBucket = "HA"
+	leaseKey    = "leader"
+)
+
+type lease struct {
+	Holder  string    `json:"holder"`
+	Url     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// LeaseElector elects the instance holding a lease stored in a db.
+// The leader renews the lease three times per ttl, any instance may
+// take the lease over once it has expired. The db is only opened for
+// the time it takes to read or update the lease so that instances
+// can take turns using the same db file.
+type LeaseElector struct {
+	open func() (wdb.Store, error)
+	id   string
+	url  string
+	ttl  time.Duration
+
+	// support unit test dep. injection for time
+	now func() time.Time
+
+	lock    sync.Mutex
+	expires time.Time
+	stop    chan struct{}
+	done    chan struct{}
+	lost    chan struct{}
+}
+
+func NewLeaseElector(open func() (wdb.Store, error),
+	url string,
+	ttl time.Duration) *LeaseElector {
+
+	return &LeaseElector{
+		open: open,
+		id:   utils.GenUUID(),
+		url:  url,
+		ttl:  ttl,
+		now:  time.Now,
+		lost: make(chan struct{}),
+	}
+}
+
+func (e *LeaseElector) withLease(update bool,
+	cb func(b wdb.Bucket, l *lease) error) error {
+
+	db, err := e.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	read := func(b wdb.Bucket) (*lease, error) {
+		l := &lease{}
+		if b == nil {
+			return l, nil
+		}
+		v := b.Get([]byte(leaseKey))
+		if v == nil {
+			return l, nil
+		}
+		return l, json.Unmarshal(v, l)
+	}
+
+	if !update {
+		return db.View(func(tx wdb.Tx) error {
+			b := tx.Bucket([]byte(leaseBucket))
+			l, err := read(b)
+			if err != nil {
+				return err
+			}
+			return cb(b, l)
+		})
+	}
+	return db.Update(func(tx wdb.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(leaseBucket))
+		if err != nil {
+			return err
+		}
+		l, err := read(b)
+		if err != nil {
+			return err
+		}
+		return cb(b, l)
+	})
+}
+
+// acquire takes or renews the lease. It returns false if another
+// instance holds a valid lease.
+func (e *LeaseElector) acquire() (bool, error) {
+	acquired := false
+	err := e.withLease(true, func(b wdb.Bucket, l *lease) error {
+		now := e.now()
+		if l.Holder != "" && l.Holder != e.id && now.Before(l.Expires) {
+			return nil
+		}
+
+		l.Holder = e.id
+		l.Url = e.url
+		l.Expires = now.Add(e.ttl)
+		v, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(leaseKey), v); err != nil {
+			return err
+		}
+
+		acquired = true
+		e.lock.Lock()
+		e.expires = l.Expires
+		e.lock.Unlock()
+		return nil
+	})
+	return acquired, err
+}
+
+func (e *LeaseElector) Campaign(stop <-chan struct{}) error {
+	for {
+		acquired, err := e.acquire()
+		if err != nil {
+			return err
+		}
+		if acquired {
+			e.lock.Lock()
+			e.stop = make(chan struct{})
+			e.done = make(chan struct{})
+			go e.renew(e.stop, e.done)
+			e.lock.Unlock()
+			return nil
+		}
+
+		if !wait(stop, e.ttl/3) {
+			return ErrStopped
+		}
+	}
+}
+
+// renew keeps the lease alive until Resign is called. Leadership is
+// lost when the lease could not be renewed before it expired.
+func (e *LeaseElector) renew(stop, done chan struct{}) {
+	defer close(done)
+	for wait(stop, e.ttl/3) {
+		acquired, err := e.acquire()
+		if acquired {
+			continue
+		}
+
+		e.lock.Lock()
+		expired := !e.now().Before(e.expires)
+		e.lock.Unlock()
+		if err == nil || expired {
+			close(e.lost)
+			return
+		}
+	}
+}
+
+func (e *LeaseElector) Leader() (string, error) {
+	var url string
+	err := e.withLease(false, func(b wdb.Bucket, l *lease) error {
+		if l.Holder != "" && e.now().Before(l.Expires) {
+			url = l.Url
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if url == "" {
+		return "", ErrNoLeader
+	}
+	return url, nil
+}
+
+func (e *LeaseElector) Lost() <-chan struct{} {
+	return e.lost
+}
+
+func (e *LeaseElector) Resign() error {
+	e.lock.Lock()
+	stop, done := e.stop, e.done
+	e.stop = nil
+	e.lock.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	<-done
+
+	return e.withLease(true, func(b wdb.Bucket, l *lease) error {
+		if l.Holder != e.id {
+			return nil
+		}
+		return b.Delete([]byte(leaseKey))
+	})
+}
@@ -0,0 +1,153 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
+	"github.com/heketi/tests"
+)
+
+type testClock struct {
+	lock sync.Mutex
+	t    time.Time
+}
+
+func (c *testClock) now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.t
+}
+
+func (c *testClock) add(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func newTestLeaseElector(path, url string, clock *testClock) *LeaseElector {
+	open := func() (wdb.Store, error) {
+		return wdb.Open("", path, false)
+	}
+	e := NewLeaseElector(open, url, 30*time.Millisecond)
+	e.now = clock.now
+	return e
+}
+
+func TestLeaseElector(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	clock := &testClock{t: time.Now()}
+
+	e1 := newTestLeaseElector(tmpfile, "http://one:8080", clock)
+	e2 := newTestLeaseElector(tmpfile, "http://two:8080", clock)
+
+	_, err := e2.Leader()
+	tests.Assert(t, err == ErrNoLeader, "expected ErrNoLeader, got:", err)
+
+	err = e1.Campaign(nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	url, err := e2.Leader()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, url == "http://one:8080", "got:", url)
+
+	// a valid lease can not be taken over
+	acquired, err := e2.acquire()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !acquired)
+
+	// resigning releases the lease at once
+	err = e1.Resign()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = e2.Leader()
+	tests.Assert(t, err == ErrNoLeader, "expected ErrNoLeader, got:", err)
+	err = e2.Campaign(nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	url, err = e1.Leader()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, url == "http://two:8080", "got:", url)
+	e2.Resign()
+}
+
+func TestLeaseElectorExpired(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	clock := &testClock{t: time.Now()}
+
+	e1 := newTestLeaseElector(tmpfile, "http://one:8080", clock)
+	e2 := newTestLeaseElector(tmpfile, "http://two:8080", clock)
+
+	// the first leader stops renewing, as if it was hung
+	acquired, err := e1.acquire()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, acquired)
+
+	clock.add(time.Second)
+	_, err = e2.Leader()
+	tests.Assert(t, err == ErrNoLeader, "expected ErrNoLeader, got:", err)
+	acquired, err = e2.acquire()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, acquired)
+}
+
+func TestLeaseElectorLost(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	clock := &testClock{t: time.Now()}
+
+	e1 := newTestLeaseElector(tmpfile, "http://one:8080", clock)
+	err := e1.Campaign(nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// another instance took the lease while the leader was hung
+	e2 := newTestLeaseElector(tmpfile, "http://two:8080", clock)
+	clock.add(time.Second)
+	acquired, err := e2.acquire()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, acquired)
+
+	select {
+	case <-e1.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("leadership was not lost")
+	}
+}
+
+func TestNewElectorLeaseShared(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	conf := &Config{
+		Election:     ElectionLease,
+		AdvertiseUrl: "http://heketi-0:8080",
+		LeaseDb:      tmpfile,
+	}
+
+	// the lease db must be on storage shared by the instances
+	defer func(check func(string) error) {
+		leaseDbShared = check
+	}(leaseDbShared)
+	leaseDbShared = func(path string) error {
+		return fmt.Errorf("%v is not on a shared file system", path)
+	}
+	_, err := NewElector(conf)
+	tests.Assert(t, err != nil)
+
+	leaseDbShared = func(path string) error { return nil }
+	e, err := NewElector(conf)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, ok := e.(*LeaseElector)
+	tests.Assert(t, ok, "got:", e)
+}
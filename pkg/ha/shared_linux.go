@@ -0,0 +1,45 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+)
+
+// magic numbers of the file systems several hosts can mount at once,
+// from statfs(2)
+var sharedFilesystems = map[int64]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x00c36400: "ceph",
+	0x01161970: "gfs2",
+	0x7461636f: "ocfs2",
+	0x0bd00bd0: "lustre",
+	0x47504653: "gpfs",
+}
+
+// checkShared returns an error unless the file at path is on a file
+// system that can be shared by several hosts.
+func checkShared(path string) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(filepath.Dir(path), &st); err != nil {
+		return fmt.Errorf("Unable to check the file system of %v: %v", path, err)
+	}
+	if _, ok := sharedFilesystems[int64(st.Type)]; !ok {
+		return fmt.Errorf("%v is not on a shared file system (type %#x)",
+			path, st.Type)
+	}
+	return nil
+}
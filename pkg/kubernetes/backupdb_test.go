@@ -16,9 +16,8 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
-	"time"
 
-	"github.com/boltdb/bolt"
+	wdb "github.com/chinacoolhacker/heketi/pkg/db"
 
 	"github.com/heketi/tests"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -32,7 +31,7 @@ func TestBackupToKubeSecretFailedClusterConfig(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	db, err := wdb.OpenBoltStore(tmpfile, false)
 	tests.Assert(t, err == nil)
 	defer db.Close()
 
@@ -68,7 +67,7 @@ func TestBackupToKubeSecretFailedNewConfig(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	db, err := wdb.OpenBoltStore(tmpfile, false)
 	tests.Assert(t, err == nil)
 	defer db.Close()
 
@@ -104,7 +103,7 @@ func TestBackupToKubeSecretFailedNamespace(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	db, err := wdb.OpenBoltStore(tmpfile, false)
 	tests.Assert(t, err == nil)
 	defer db.Close()
 
@@ -139,7 +138,7 @@ func TestBackupToKubeSecretGoodBackup(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	db, err := wdb.OpenBoltStore(tmpfile, false)
 	tests.Assert(t, err == nil)
 	defer db.Close()
 
@@ -174,7 +173,7 @@ func TestBackupToKubeSecretVerifyBackup(t *testing.T) {
 	defer os.Remove(tmpfile)
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	db, err := wdb.OpenBoltStore(tmpfile, false)
 	tests.Assert(t, err == nil)
 
 	incluster_count := 0
@@ -198,7 +197,7 @@ func TestBackupToKubeSecretVerifyBackup(t *testing.T) {
 	}).Restore()
 
 	// Add some content to the db
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx wdb.Tx) error {
 		bucket, err := tx.CreateBucketIfNotExists([]byte("bucket"))
 		tests.Assert(t, err == nil)
 
@@ -235,11 +234,11 @@ func TestBackupToKubeSecretVerifyBackup(t *testing.T) {
 
 	// Load new app with backup
 	db.Close()
-	db, err = bolt.Open(newdb, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	db, err = wdb.OpenBoltStore(newdb, false)
 	tests.Assert(t, err == nil)
 	defer db.Close()
 
-	err = db.View(func(tx *bolt.Tx) error {
+	err = db.View(func(tx wdb.Tx) error {
 		bucket := tx.Bucket([]byte("bucket"))
 		tests.Assert(t, bucket != nil)
 
@@ -262,7 +261,7 @@ func TestBackupToKubeSecretVerifyBackupWithName(t *testing.T) {
 	defer os.Unsetenv("HEKETI_KUBE_DB_SECRET_NAME")
 
 	// Create a db
-	db, err := bolt.Open(tmpfile, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	db, err := wdb.OpenBoltStore(tmpfile, false)
 	tests.Assert(t, err == nil)
 
 	incluster_count := 0
@@ -286,7 +285,7 @@ func TestBackupToKubeSecretVerifyBackupWithName(t *testing.T) {
 	}).Restore()
 
 	// Add some content to the db
-	err = db.Update(func(tx *bolt.Tx) error {
+	err = db.Update(func(tx wdb.Tx) error {
 		bucket, err := tx.CreateBucketIfNotExists([]byte("bucket"))
 		tests.Assert(t, err == nil)
 
@@ -323,11 +322,11 @@ func TestBackupToKubeSecretVerifyBackupWithName(t *testing.T) {
 
 	// Load new app with backup
 	db.Close()
-	db, err = bolt.Open(newdb, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	db, err = wdb.OpenBoltStore(newdb, false)
 	tests.Assert(t, err == nil)
 	defer db.Close()
 
-	err = db.View(func(tx *bolt.Tx) error {
+	err = db.View(func(tx wdb.Tx) error {
 		bucket := tx.Bucket([]byte("bucket"))
 		tests.Assert(t, bucket != nil)
 
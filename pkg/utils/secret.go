@@ -0,0 +1,161 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// SealedPrefix marks a string value produced by SecretBox.Seal
+	SealedPrefix = "$heketi-sealed$v1$"
+
+	// SecretKeySize is the size in bytes of keys used by
+	// NewSecretBoxFromKey
+	SecretKeySize = 32
+
+	// SecretSaltSize is the size in bytes of the salts returned by
+	// NewSecretSalt
+	SecretSaltSize = 16
+
+	// scrypt cost parameters used to derive keys from passphrases
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var (
+	ErrSecretKeyMissing = errors.New("secret key must not be empty")
+	ErrSecretKeySize    = errors.New("secret key has the wrong size")
+	ErrSecretSaltSize   = errors.New("secret salt is too short")
+	ErrNotSealed        = errors.New("value is not sealed")
+	ErrSealedCorrupt    = errors.New("sealed value is corrupt or key is incorrect")
+)
+
+// SecretBox seals and opens short secrets, such as passwords, with
+// AES-256-GCM. The cipher key can be derived from a user supplied
+// passphrase so that any string can be used in the configuration.
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// NewSecretBox returns a SecretBox using a key derived from the
+// given passphrase and salt with scrypt. The salt must be stored
+// along with the sealed values to open them again, see NewSecretSalt.
+func NewSecretBox(passphrase string, salt []byte) (*SecretBox, error) {
+	if passphrase == "" {
+		return nil, ErrSecretKeyMissing
+	}
+	if len(salt) < SecretSaltSize {
+		return nil, ErrSecretSaltSize
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt,
+		scryptN, scryptR, scryptP, SecretKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return NewSecretBoxFromKey(key)
+}
+
+// NewSecretBoxFromKey returns a SecretBox using the given key, which
+// must be SecretKeySize bytes long, as is.
+func NewSecretBoxFromKey(key []byte) (*SecretBox, error) {
+	if len(key) != SecretKeySize {
+		return nil, ErrSecretKeySize
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretBox{aead: aead}, nil
+}
+
+// NewSecretKey returns a new random key for NewSecretBoxFromKey.
+func NewSecretKey() ([]byte, error) {
+	key := make([]byte, SecretKeySize)
+	if _, err := io.ReadFull(Randomness, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// NewSecretSalt returns a new random salt for NewSecretBox.
+func NewSecretSalt() ([]byte, error) {
+	salt := make([]byte, SecretSaltSize)
+	if _, err := io.ReadFull(Randomness, salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// IsSealed returns true if the value was produced by SecretBox.Seal.
+func IsSealed(s string) bool {
+	return strings.HasPrefix(s, SealedPrefix)
+}
+
+// Seal encrypts the plaintext and returns a printable string
+// prefixed with SealedPrefix. Empty strings and values that are
+// already sealed are returned unchanged.
+func (s *SecretBox) Seal(plaintext string) (string, error) {
+	if plaintext == "" || IsSealed(plaintext) {
+		return plaintext, nil
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(Randomness, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := s.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return SealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value returned by Seal. Empty strings are returned
+// unchanged.
+func (s *SecretBox) Open(sealed string) (string, error) {
+	if sealed == "" {
+		return sealed, nil
+	}
+	if !IsSealed(sealed) {
+		return "", ErrNotSealed
+	}
+
+	data, err := base64.StdEncoding.DecodeString(
+		strings.TrimPrefix(sealed, SealedPrefix))
+	if err != nil {
+		return "", ErrSealedCorrupt
+	}
+
+	ns := s.aead.NonceSize()
+	if len(data) < ns {
+		return "", ErrSealedCorrupt
+	}
+
+	plaintext, err := s.aead.Open(nil, data[:ns], data[ns:], nil)
+	if err != nil {
+		return "", ErrSealedCorrupt
+	}
+
+	return string(plaintext), nil
+}
@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+var testSalt = []byte("0123456789abcdef")
+
+func TestNewSecretBoxEmptyKey(t *testing.T) {
+	s, err := NewSecretBox("", testSalt)
+	tests.Assert(t, err == ErrSecretKeyMissing, "expected ErrSecretKeyMissing, got:", err)
+	tests.Assert(t, s == nil)
+}
+
+func TestNewSecretBoxSalt(t *testing.T) {
+	s, err := NewSecretBox("my secret", []byte("short"))
+	tests.Assert(t, err == ErrSecretSaltSize, "expected ErrSecretSaltSize, got:", err)
+	tests.Assert(t, s == nil)
+
+	salt, err := NewSecretSalt()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(salt) == SecretSaltSize)
+
+	s1, err := NewSecretBox("my secret", salt)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	s2, err := NewSecretBox("my secret", salt)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	s3, err := NewSecretBox("my secret", testSalt)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	sealed, err := s1.Seal("password")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the same passphrase and salt give the same key
+	plain, err := s2.Open(sealed)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, plain == "password", "expected password, got:", plain)
+
+	// a different salt gives a different key
+	_, err = s3.Open(sealed)
+	tests.Assert(t, err == ErrSealedCorrupt, "expected ErrSealedCorrupt, got:", err)
+}
+
+func TestSecretBoxSealOpen(t *testing.T) {
+	s, err := NewSecretBox("my secret", testSalt)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	sealed, err := s.Seal("password")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, sealed != "password")
+	tests.Assert(t, IsSealed(sealed), "expected sealed value, got:", sealed)
+
+	// sealing twice must not encrypt the value again
+	again, err := s.Seal(sealed)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, again == sealed)
+
+	plain, err := s.Open(sealed)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, plain == "password", "expected password, got:", plain)
+}
+
+func TestSecretBoxSealEmpty(t *testing.T) {
+	s, err := NewSecretBox("my secret", testSalt)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	sealed, err := s.Seal("")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, sealed == "")
+
+	plain, err := s.Open("")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, plain == "")
+}
+
+func TestSecretBoxOpenWrongKey(t *testing.T) {
+	s1, err := NewSecretBox("key one", testSalt)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	s2, err := NewSecretBox("key two", testSalt)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	sealed, err := s1.Seal("password")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	_, err = s2.Open(sealed)
+	tests.Assert(t, err == ErrSealedCorrupt, "expected ErrSealedCorrupt, got:", err)
+}
+
+func TestSecretBoxOpenNotSealed(t *testing.T) {
+	s, err := NewSecretBox("my secret", testSalt)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	_, err = s.Open("password")
+	tests.Assert(t, err == ErrNotSealed, "expected ErrNotSealed, got:", err)
+
+	_, err = s.Open(SealedPrefix + "!!!")
+	tests.Assert(t, err == ErrSealedCorrupt, "expected ErrSealedCorrupt, got:", err)
+}
+
+func TestSecretBoxFromKey(t *testing.T) {
+	_, err := NewSecretBoxFromKey([]byte("short"))
+	tests.Assert(t, err == ErrSecretKeySize, "expected ErrSecretKeySize, got:", err)
+
+	key, err := NewSecretKey()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(key) == SecretKeySize)
+
+	s1, err := NewSecretBoxFromKey(key)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	s2, err := NewSecretBoxFromKey(key)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	sealed, err := s1.Seal("password")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	plain, err := s2.Open(sealed)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, plain == "password", "expected password, got:", plain)
+}
@@ -0,0 +1,135 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Credentials are the user and the means a client logs in with. Only
+// one of the private key file, the agent or the password is used, in
+// that order.
+type Credentials struct {
+	User string
+	// Private key, and optionally the OpenSSH certificate of the key
+	// signed by a certificate authority the hosts trust
+	KeyFile         string
+	CertificateFile string
+	// Use the keys of the agent listening at SSH_AUTH_SOCK
+	Agent    bool
+	Password string
+}
+
+// authMethods returns the auth methods of the credentials.
+func (c *Credentials) authMethods() ([]ssh.AuthMethod, error) {
+	switch {
+	case c.KeyFile != "":
+		signer, err := getKeyFile(c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read private key file %v: %v",
+				c.KeyFile, err)
+		}
+		if c.CertificateFile != "" {
+			signer, err = certSigner(signer, c.CertificateFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+
+	case c.Agent:
+		signers, err := agentSigners()
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeysCallback(signers)}, nil
+
+	case c.Password != "":
+		return []ssh.AuthMethod{ssh.Password(c.Password)}, nil
+	}
+	return nil, errors.New("Missing ssh private key file, agent or password")
+}
+
+// certSigner returns a signer presenting the certificate in file for
+// the key of signer.
+func certSigner(signer ssh.Signer, file string) (ssh.Signer, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read certificate file %v: %v", file, err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(buf)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse certificate file %v: %v", file, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a certificate", file)
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("%v is not a user certificate", file)
+	}
+	signer, err = ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("Certificate %v does not match the private key: %v",
+			file, err)
+	}
+	return signer, nil
+}
+
+// agentSigners returns the callback listing the keys of the ssh agent.
+func agentSigners() (func() ([]ssh.Signer, error), error) {
+	authSocket := os.Getenv("SSH_AUTH_SOCK")
+	if authSocket == "" {
+		return nil, errors.New("SSH_AUTH_SOCK required, check that your ssh agent is running")
+	}
+
+	agentUnixSock, err := net.Dial("unix", authSocket)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to the ssh agent: %v", err)
+	}
+	return agent.NewClient(agentUnixSock).Signers, nil
+}
+
+// NewSshExecWithCredentials returns a client logging in to the hosts
+// with creds.
+func NewSshExecWithCredentials(logger *utils.Logger,
+	creds Credentials) (*SshExec, error) {
+
+	auth, err := creds.authMethods()
+	if err != nil {
+		return nil, err
+	}
+	return newSshExec(logger, &ssh.ClientConfig{
+		User:            creds.User,
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}), nil
+}
+
+// SetHostCredentials makes the client log in to host with creds rather
+// than with its own credentials.
+func (s *SshExec) SetHostCredentials(host string, creds Credentials) error {
+	auth, err := creds.authMethods()
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.hostAuth[host] = hostAuth{user: creds.User, auth: auth}
+	return nil
+}
@@ -0,0 +1,168 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ssh
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/heketi/tests"
+	"golang.org/x/crypto/ssh"
+)
+
+var testLogger = utils.NewLogger("[test]", utils.LEVEL_NOLOG)
+
+// testKeyFile writes a new private key to a file.
+func testKeyFile(t *testing.T) (string, ssh.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests.Assert(t, err == nil)
+	der, err := x509.MarshalECPrivateKey(key)
+	tests.Assert(t, err == nil)
+	f, err := ioutil.TempFile("", "id_ecdsa")
+	tests.Assert(t, err == nil)
+	defer f.Close()
+	err = pem.Encode(f, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	tests.Assert(t, err == nil)
+	signer, err := ssh.NewSignerFromKey(key)
+	tests.Assert(t, err == nil)
+	return f.Name(), signer
+}
+
+// testCertFile writes a certificate of key signed by ca to a file.
+func testCertFile(t *testing.T, key ssh.PublicKey,
+	ca ssh.Signer, certType uint32) string {
+
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        certType,
+		ValidPrincipals: []string{"heketi"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	err := cert.SignCert(rand.Reader, ca)
+	tests.Assert(t, err == nil)
+	f, err := ioutil.TempFile("", "id_ecdsa-cert.pub")
+	tests.Assert(t, err == nil)
+	defer f.Close()
+	_, err = f.Write(ssh.MarshalAuthorizedKey(cert))
+	tests.Assert(t, err == nil)
+	return f.Name()
+}
+
+func TestSshExecWithCertificate(t *testing.T) {
+	ca := testHostKey(t)
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), ca.PublicKey().Marshal())
+		},
+	}
+	server := newTestServerWithConfig(t, &ssh.ServerConfig{
+		PublicKeyCallback: checker.Authenticate,
+	})
+	defer server.Close()
+	host := server.listener.Addr().String()
+
+	keyFile, key := testKeyFile(t)
+	defer os.Remove(keyFile)
+	certFile := testCertFile(t, key.PublicKey(), ca, ssh.UserCert)
+	defer os.Remove(certFile)
+
+	s, err := NewSshExecWithCredentials(testLogger, Credentials{
+		User:            "heketi",
+		KeyFile:         keyFile,
+		CertificateFile: certFile,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer s.Close()
+	_, err = s.ConnectAndExec(host, []string{"echo 1"}, 1, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the key alone is not trusted
+	s, err = NewSshExecWithCredentials(testLogger, Credentials{
+		User:    "heketi",
+		KeyFile: keyFile,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer s.Close()
+	_, err = s.ConnectAndExec(host, []string{"echo 1"}, 1, false)
+	tests.Assert(t, err != nil)
+
+	// the certificate must be a user certificate of the key
+	hostCertFile := testCertFile(t, key.PublicKey(), ca, ssh.HostCert)
+	defer os.Remove(hostCertFile)
+	_, err = NewSshExecWithCredentials(testLogger, Credentials{
+		KeyFile:         keyFile,
+		CertificateFile: hostCertFile,
+	})
+	tests.Assert(t, err != nil)
+	otherCertFile := testCertFile(t, testHostKey(t).PublicKey(), ca, ssh.UserCert)
+	defer os.Remove(otherCertFile)
+	_, err = NewSshExecWithCredentials(testLogger, Credentials{
+		KeyFile:         keyFile,
+		CertificateFile: otherCertFile,
+	})
+	tests.Assert(t, err != nil)
+}
+
+func TestSshExecHostCredentials(t *testing.T) {
+	server := newTestServerWithConfig(t, &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "admin" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	})
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.listener.Addr().String())
+	tests.Assert(t, err == nil)
+
+	s, err := NewSshExecWithCredentials(testLogger, Credentials{
+		User:     "heketi",
+		Password: "secret",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer s.Close()
+	err = s.SetHostCredentials("localhost", Credentials{
+		User:     "admin",
+		Password: "secret",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	_, err = s.ConnectAndExec("127.0.0.1:"+port, []string{"echo 1"}, 1, false)
+	tests.Assert(t, err != nil)
+	_, err = s.ConnectAndExec("localhost:"+port, []string{"echo 1"}, 1, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = s.SetHostCredentials("localhost", Credentials{KeyFile: "/no/such/key"})
+	tests.Assert(t, err != nil)
+}
+
+func TestSshExecWithoutCredentials(t *testing.T) {
+	_, err := NewSshExecWithCredentials(testLogger, Credentials{User: "heketi"})
+	tests.Assert(t, err != nil)
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	os.Unsetenv("SSH_AUTH_SOCK")
+	defer os.Setenv("SSH_AUTH_SOCK", sock)
+	_, err = NewSshExecWithCredentials(testLogger, Credentials{Agent: true})
+	tests.Assert(t, err != nil)
+	s := NewSshExecWithAuth(testLogger, "heketi")
+	tests.Assert(t, s == nil)
+}
@@ -0,0 +1,272 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyPolicy tells what is done with hosts whose key is neither in
+// the known_hosts file nor pinned.
+type HostKeyPolicy string
+
+const (
+	// Any host key is accepted and none is pinned
+	HostKeyInsecure HostKeyPolicy = "insecure"
+	// The key of the host is pinned the first time it is seen
+	HostKeyTofu HostKeyPolicy = "tofu"
+	// The host is rejected
+	HostKeyStrict HostKeyPolicy = "strict"
+)
+
+// HostKeyStore keeps the fingerprints of the host keys pinned for
+// the hosts.
+type HostKeyStore interface {
+	// PinnedHostKey returns the fingerprint pinned for host, or an
+	// empty string if none is.
+	PinnedHostKey(host string) (string, error)
+	// PinHostKey pins fingerprint for host.
+	PinHostKey(host, fingerprint string) error
+}
+
+// HostKeyError is returned when the key of a host does not match its
+// known or pinned key, or when a host has no such key and the policy
+// is strict.
+type HostKeyError struct {
+	Host string
+	// Fingerprint of the known or pinned key, empty if there is none
+	Want string
+	// Fingerprint of the key the host presented
+	Got string
+}
+
+func (e *HostKeyError) Error() string {
+	if e.Want == "" {
+		return fmt.Sprintf("Host key %v of %v is not known", e.Got, e.Host)
+	}
+	return fmt.Sprintf("Host key of %v does not match: got %v, expected %v",
+		e.Host, e.Got, e.Want)
+}
+
+// Fingerprint returns the SHA256 fingerprint of key, in the format
+// used by OpenSSH.
+func Fingerprint(key ssh.PublicKey) string {
+	return ssh.FingerprintSHA256(key)
+}
+
+// HostKeyVerifier verifies the keys of the hosts against a known_hosts
+// file and the keys pinned in a store. A host presenting a key other
+// than its known or pinned key is always rejected, even with the
+// insecure policy.
+type HostKeyVerifier struct {
+	policy     HostKeyPolicy
+	knownHosts ssh.HostKeyCallback
+
+	lock  sync.RWMutex
+	store HostKeyStore
+	// keys trusted on first use before the store was set
+	trusted map[string]string
+}
+
+// NewHostKeyVerifier returns a verifier applying policy to the hosts
+// with no known key. The known_hosts file is optional.
+func NewHostKeyVerifier(policy HostKeyPolicy,
+	knownHostsFile string) (*HostKeyVerifier, error) {
+
+	switch policy {
+	case HostKeyInsecure, HostKeyTofu, HostKeyStrict:
+	default:
+		return nil, fmt.Errorf("Unknown host key policy: %v", policy)
+	}
+
+	v := &HostKeyVerifier{
+		policy:  policy,
+		trusted: map[string]string{},
+	}
+	if knownHostsFile != "" {
+		var err error
+		v.knownHosts, err = knownhosts.New(knownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read known hosts file %v: %v",
+				knownHostsFile, err)
+		}
+	}
+	return v, nil
+}
+
+// Policy returns the policy of the verifier.
+func (v *HostKeyVerifier) Policy() HostKeyPolicy {
+	return v.policy
+}
+
+// SetStore sets the store of the pinned keys. Until it is set only the
+// known_hosts file is used.
+func (v *HostKeyVerifier) SetStore(store HostKeyStore) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.store = store
+}
+
+// Verify is the ssh.HostKeyCallback of the verifier. The known and
+// pinned keys of a host are verified whatever the policy, the policy
+// only applies to hosts with neither.
+func (v *HostKeyVerifier) Verify(hostname string,
+	remote net.Addr, key ssh.PublicKey) error {
+
+	host := hostOnly(hostname)
+	got := Fingerprint(key)
+	known, err := v.verifyKnown(hostname, remote, key)
+	if err != nil {
+		return err
+	}
+
+	v.lock.RLock()
+	store := v.store
+	pinned := v.trusted[host]
+	v.lock.RUnlock()
+	if store != nil {
+		stored, err := store.PinnedHostKey(host)
+		if err != nil {
+			return err
+		}
+		if stored != "" {
+			pinned = stored
+		}
+	}
+	switch {
+	case pinned == got:
+		return nil
+	case pinned != "":
+		return &HostKeyError{Host: host, Want: pinned, Got: got}
+	case known:
+		return nil
+	case v.policy == HostKeyInsecure:
+		return nil
+	case v.policy == HostKeyStrict:
+		return &HostKeyError{Host: host, Got: got}
+	}
+
+	// Trust on first use. The key is pinned before the connection is
+	// used, a key that could not be pinned is not trusted. Until the
+	// store is set the keys are only pinned in memory.
+	if store == nil {
+		v.lock.Lock()
+		v.trusted[host] = got
+		v.lock.Unlock()
+		return nil
+	}
+	if err := store.PinHostKey(host, got); err != nil {
+		return fmt.Errorf("Unable to pin host key %v of %v: %v", got, host, err)
+	}
+	return nil
+}
+
+// verifyKnown returns true if key is the key of host in the known_hosts
+// file, false if the file has no key for host, and an error if it has
+// another key.
+func (v *HostKeyVerifier) verifyKnown(hostname string,
+	remote net.Addr, key ssh.PublicKey) (bool, error) {
+
+	if v.knownHosts == nil {
+		return false, nil
+	}
+	err := v.knownHosts(hostname, remote, key)
+	if err == nil {
+		return true, nil
+	}
+	if kerr, ok := err.(*knownhosts.KeyError); ok {
+		if len(kerr.Want) == 0 {
+			return false, nil
+		}
+		return false, &HostKeyError{
+			Host: hostOnly(hostname),
+			Want: Fingerprint(kerr.Want[0].Key),
+			Got:  Fingerprint(key),
+		}
+	}
+	return false, err
+}
+
+var errHostKeyScanned = errors.New("host key scanned")
+
+// ScanHostKey returns the fingerprint of the key presented by host.
+// The key must match the key of host in the known_hosts file of the
+// verifier, if there is one, but not the pinned key: the key scanned
+// is meant to be pinned. With the strict policy the host must be in
+// the known_hosts file.
+func ScanHostKey(ctx context.Context, host string,
+	v *HostKeyVerifier) (string, error) {
+
+	var (
+		fingerprint string
+		scanErr     error
+	)
+	config := &ssh.ClientConfig{
+		HostKeyCallback: func(hostname string,
+			remote net.Addr, key ssh.PublicKey) error {
+
+			known, err := v.verifyKnown(hostname, remote, key)
+			if err == nil && !known && v.policy == HostKeyStrict {
+				err = &HostKeyError{Host: hostOnly(hostname), Got: Fingerprint(key)}
+			}
+			if err != nil {
+				scanErr = err
+				return err
+			}
+			fingerprint = Fingerprint(key)
+			// there is no need to log in
+			return errHostKeyScanned
+		},
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	_, _, _, err = ssh.NewClientConn(conn, host, config)
+	switch {
+	case fingerprint != "":
+		return fingerprint, nil
+	case scanErr != nil:
+		return "", scanErr
+	case ctx.Err() != nil:
+		return "", ctx.Err()
+	}
+	return "", err
+}
+
+// hostOnly returns the host of a host:port address.
+func hostOnly(hostname string) string {
+	host, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return hostname
+	}
+	return host
+}
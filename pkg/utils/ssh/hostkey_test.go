@@ -0,0 +1,262 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ssh
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/heketi/tests"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type fakeHostKeyStore struct {
+	lock sync.Mutex
+	keys map[string]string
+	// number of keys pinned
+	pins int
+	// error returned when a key is pinned
+	err error
+}
+
+func newFakeHostKeyStore() *fakeHostKeyStore {
+	return &fakeHostKeyStore{
+		keys: map[string]string{},
+	}
+}
+
+func (f *fakeHostKeyStore) PinnedHostKey(host string) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.keys[host], nil
+}
+
+func (f *fakeHostKeyStore) PinHostKey(host, fingerprint string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.keys[host] = fingerprint
+	f.pins++
+	return nil
+}
+
+func testHostKey(t *testing.T) ssh.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests.Assert(t, err == nil)
+	signer, err := ssh.NewSignerFromKey(key)
+	tests.Assert(t, err == nil)
+	return signer
+}
+
+func testKnownHosts(t *testing.T, host string, key ssh.PublicKey) string {
+	f, err := ioutil.TempFile("", "known_hosts")
+	tests.Assert(t, err == nil)
+	defer f.Close()
+	_, err = f.WriteString(knownhosts.Line([]string{host}, key) + "\n")
+	tests.Assert(t, err == nil)
+	return f.Name()
+}
+
+var testAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+
+func TestHostKeyVerifierInsecure(t *testing.T) {
+	key1 := testHostKey(t).PublicKey()
+	key2 := testHostKey(t).PublicKey()
+	knownHosts := testKnownHosts(t, "host3", key1)
+	defer os.Remove(knownHosts)
+
+	v, err := NewHostKeyVerifier(HostKeyInsecure, knownHosts)
+	tests.Assert(t, err == nil)
+	store := newFakeHostKeyStore()
+	v.SetStore(store)
+
+	// hosts with no known or pinned key are accepted, and not pinned
+	err = v.Verify("host1:22", testAddr, key1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, store.pins == 0, "got:", store.keys)
+
+	// but the pinned keys are verified
+	store.keys["host2"] = Fingerprint(key1)
+	err = v.Verify("host2:22", testAddr, key1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = v.Verify("host2:22", testAddr, key2)
+	herr, ok := err.(*HostKeyError)
+	tests.Assert(t, ok, "got:", err)
+	tests.Assert(t, herr.Want == Fingerprint(key1), "got:", herr)
+
+	// and so are the known keys
+	err = v.Verify("host3:22", testAddr, key2)
+	_, ok = err.(*HostKeyError)
+	tests.Assert(t, ok, "got:", err)
+
+	_, err = NewHostKeyVerifier("trusting", "")
+	tests.Assert(t, err != nil)
+}
+
+func TestHostKeyVerifierTofu(t *testing.T) {
+	key1 := testHostKey(t).PublicKey()
+	key2 := testHostKey(t).PublicKey()
+
+	v, err := NewHostKeyVerifier(HostKeyTofu, "")
+	tests.Assert(t, err == nil)
+	store := newFakeHostKeyStore()
+	v.SetStore(store)
+
+	// the first key is pinned before the connection is used
+	err = v.Verify("host1:22", testAddr, key1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, store.pins == 1, "got:", store.keys)
+	fp, _ := store.PinnedHostKey("host1")
+	tests.Assert(t, fp == Fingerprint(key1), "got:", fp)
+
+	err = v.Verify("host1:22", testAddr, key1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// another key is rejected
+	err = v.Verify("host1:22", testAddr, key2)
+	herr, ok := err.(*HostKeyError)
+	tests.Assert(t, ok, "got:", err)
+	tests.Assert(t, herr.Host == "host1" &&
+		herr.Want == Fingerprint(key1) &&
+		herr.Got == Fingerprint(key2), "got:", herr)
+
+	// until it is pinned
+	store.keys["host1"] = Fingerprint(key2)
+	err = v.Verify("host1:22", testAddr, key2)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = v.Verify("host1:22", testAddr, key1)
+	tests.Assert(t, err != nil)
+
+	// a key that can not be pinned is not trusted
+	store.err = errors.New("db is read-only")
+	err = v.Verify("host2:22", testAddr, key1)
+	tests.Assert(t, err != nil)
+	store.err = nil
+	err = v.Verify("host2:22", testAddr, key2)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	fp, _ = store.PinnedHostKey("host2")
+	tests.Assert(t, fp == Fingerprint(key2), "got:", fp)
+}
+
+func TestHostKeyVerifierTofuNoStore(t *testing.T) {
+	key1 := testHostKey(t).PublicKey()
+	key2 := testHostKey(t).PublicKey()
+
+	// until the store is set the keys are pinned in memory
+	v, err := NewHostKeyVerifier(HostKeyTofu, "")
+	tests.Assert(t, err == nil)
+	err = v.Verify("host1:22", testAddr, key1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = v.Verify("host1:22", testAddr, key2)
+	_, ok := err.(*HostKeyError)
+	tests.Assert(t, ok, "got:", err)
+}
+
+func TestHostKeyVerifierStrict(t *testing.T) {
+	key1 := testHostKey(t).PublicKey()
+	key2 := testHostKey(t).PublicKey()
+	knownHosts := testKnownHosts(t, "host1", key1)
+	defer os.Remove(knownHosts)
+
+	v, err := NewHostKeyVerifier(HostKeyStrict, knownHosts)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	store := newFakeHostKeyStore()
+	v.SetStore(store)
+
+	err = v.Verify("host1:22", testAddr, key1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// a key other than the known one is rejected
+	err = v.Verify("host1:22", testAddr, key2)
+	herr, ok := err.(*HostKeyError)
+	tests.Assert(t, ok, "got:", err)
+	tests.Assert(t, herr.Want == Fingerprint(key1), "got:", herr)
+
+	// unknown hosts are rejected, unless their key is pinned
+	err = v.Verify("host2:22", testAddr, key2)
+	herr, ok = err.(*HostKeyError)
+	tests.Assert(t, ok, "got:", err)
+	tests.Assert(t, herr.Want == "", "got:", herr)
+	store.keys["host2"] = Fingerprint(key2)
+	err = v.Verify("host2:22", testAddr, key2)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the pinned key must match the known key
+	store.keys["host1"] = Fingerprint(key2)
+	err = v.Verify("host1:22", testAddr, key1)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, store.pins == 0, "got:", store.keys)
+}
+
+func TestScanHostKey(t *testing.T) {
+	hostKey := testHostKey(t)
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.Assert(t, err == nil)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				ssh.NewServerConn(conn, config)
+				conn.Close()
+			}()
+		}
+	}()
+
+	v, err := NewHostKeyVerifier(HostKeyTofu, "")
+	tests.Assert(t, err == nil)
+	fp, err := ScanHostKey(context.Background(), l.Addr().String(), v)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, fp == Fingerprint(hostKey.PublicKey()), "got:", fp)
+
+	// with the strict policy the host must be known
+	v, err = NewHostKeyVerifier(HostKeyStrict, "")
+	tests.Assert(t, err == nil)
+	_, err = ScanHostKey(context.Background(), l.Addr().String(), v)
+	_, ok := err.(*HostKeyError)
+	tests.Assert(t, ok, "got:", err)
+}
+
+func TestConnectAndExecHostKeyError(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	_, port, err := net.SplitHostPort(s.listener.Addr().String())
+	tests.Assert(t, err == nil)
+
+	v, err := NewHostKeyVerifier(HostKeyTofu, "")
+	tests.Assert(t, err == nil)
+	store := newFakeHostKeyStore()
+	store.keys["localhost"] = Fingerprint(testHostKey(t).PublicKey())
+	v.SetStore(store)
+	e := testSshExec(PoolConfig{})
+	e.SetHostKeyVerifier(v)
+
+	// the rejected host key is told by its error, not only its message
+	_, err = e.ConnectAndExec("localhost:"+port, []string{"echo 1"}, 1, false)
+	_, ok := err.(*HostKeyError)
+	tests.Assert(t, ok, "got:", err)
+}
@@ -0,0 +1,242 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// PoolConfig configures the connections kept open to the hosts to run
+// the next commands on.
+type PoolConfig struct {
+	// Time a connection may take to be established, no limit if 0
+	DialTimeout time.Duration
+	// Time an unused connection is kept open. Connections are closed
+	// once the commands ran if 0.
+	IdleTimeout time.Duration
+	// Interval at which the unused connections are checked with a
+	// keepalive request, the idle timeout if 0
+	KeepaliveInterval time.Duration
+}
+
+var DefaultPoolConfig = PoolConfig{
+	DialTimeout:       30 * time.Second,
+	IdleTimeout:       5 * time.Minute,
+	KeepaliveInterval: 30 * time.Second,
+}
+
+type idleClient struct {
+	*ssh.Client
+	since time.Time
+}
+
+// connPool keeps the unused connections to each host. The connections
+// are checked and the ones idle for too long are closed in the
+// background while there are some.
+type connPool struct {
+	dial func(ctx context.Context, host string) (*ssh.Client, error)
+
+	lock     sync.Mutex
+	config   PoolConfig
+	idle     map[string][]*idleClient
+	sweeping bool
+	closed   bool
+}
+
+func newConnPool(config PoolConfig,
+	dial func(ctx context.Context, host string) (*ssh.Client, error)) *connPool {
+
+	return &connPool{
+		dial:   dial,
+		config: config,
+		idle:   map[string][]*idleClient{},
+	}
+}
+
+func (p *connPool) setConfig(config PoolConfig) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.config = config
+}
+
+// get returns a connection to host, reused if there is one unused.
+func (p *connPool) get(ctx context.Context,
+	host string) (client *ssh.Client, reused bool, err error) {
+
+	p.lock.Lock()
+	for len(p.idle[host]) > 0 {
+		conns := p.idle[host]
+		c := conns[len(conns)-1]
+		p.idle[host] = conns[:len(conns)-1]
+		if time.Since(c.since) < p.config.IdleTimeout {
+			p.lock.Unlock()
+			return c.Client, true, nil
+		}
+		c.Close()
+	}
+	delete(p.idle, host)
+	p.lock.Unlock()
+
+	client, err = p.connect(ctx, host)
+	return client, false, err
+}
+
+// connect opens a new connection to host, giving up after the dial
+// timeout.
+func (p *connPool) connect(ctx context.Context, host string) (*ssh.Client, error) {
+	p.lock.Lock()
+	timeout := p.config.DialTimeout
+	p.lock.Unlock()
+	if timeout <= 0 {
+		return p.dial(ctx, host)
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	client, err := p.dial(dialCtx, host)
+	if err != nil && ctx.Err() == nil && dialCtx.Err() != nil {
+		return nil, fmt.Errorf("Unable to connect to %v: connection timed out after %v",
+			host, timeout)
+	}
+	return client, err
+}
+
+// put makes an unused connection to host available to the next
+// commands.
+func (p *connPool) put(host string, client *ssh.Client) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed || p.config.IdleTimeout <= 0 {
+		client.Close()
+		return
+	}
+	p.idle[host] = append(p.idle[host], &idleClient{client, time.Now()})
+	if !p.sweeping {
+		p.sweeping = true
+		go p.sweep()
+	}
+}
+
+// sweep closes the connections idle for too long or not answering
+// keepalive requests, until there are none left.
+func (p *connPool) sweep() {
+	for {
+		p.lock.Lock()
+		interval := p.config.KeepaliveInterval
+		if interval <= 0 || interval > p.config.IdleTimeout {
+			interval = p.config.IdleTimeout
+		}
+		p.lock.Unlock()
+		time.Sleep(interval)
+
+		p.lock.Lock()
+		if p.closed || len(p.idle) == 0 {
+			p.sweeping = false
+			p.lock.Unlock()
+			return
+		}
+		var check []*idleClient
+		for host, conns := range p.idle {
+			var kept []*idleClient
+			for _, c := range conns {
+				if time.Since(c.since) >= p.config.IdleTimeout {
+					c.Close()
+					continue
+				}
+				kept = append(kept, c)
+			}
+			if len(kept) == 0 {
+				delete(p.idle, host)
+			} else {
+				p.idle[host] = kept
+			}
+			check = append(check, kept...)
+		}
+		p.lock.Unlock()
+
+		// The connections stay usable while they are checked, a
+		// connection in use when it is found dead fails on its own.
+		var (
+			wg       sync.WaitGroup
+			deadLock sync.Mutex
+			dead     = map[*idleClient]bool{}
+		)
+		for _, c := range check {
+			wg.Add(1)
+			go func(c *idleClient) {
+				defer wg.Done()
+				if !keepalive(c.Client, interval) {
+					deadLock.Lock()
+					dead[c] = true
+					deadLock.Unlock()
+				}
+			}(c)
+		}
+		wg.Wait()
+		if len(dead) == 0 {
+			continue
+		}
+
+		p.lock.Lock()
+		for host, conns := range p.idle {
+			var kept []*idleClient
+			for _, c := range conns {
+				if dead[c] {
+					c.Close()
+					continue
+				}
+				kept = append(kept, c)
+			}
+			if len(kept) == 0 {
+				delete(p.idle, host)
+			} else {
+				p.idle[host] = kept
+			}
+		}
+		p.lock.Unlock()
+	}
+}
+
+// keepalive returns true if the server answers a keepalive request on
+// client within timeout.
+func keepalive(client *ssh.Client, timeout time.Duration) bool {
+	errch := make(chan error, 1)
+	go func() {
+		// servers reply to unknown requests with a failure, which
+		// is enough to know they are alive
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		errch <- err
+	}()
+	select {
+	case err := <-errch:
+		return err == nil
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// close closes the unused connections and the connections put back
+// from now on.
+func (p *connPool) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.closed = true
+	for _, conns := range p.idle {
+		for _, c := range conns {
+			c.Close()
+		}
+	}
+	p.idle = map[string][]*idleClient{}
+}
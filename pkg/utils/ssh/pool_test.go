@@ -0,0 +1,233 @@
+//
+// Copyright (c) 2018 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ssh
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chinacoolhacker/heketi/pkg/utils"
+	"github.com/heketi/tests"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an ssh server echoing the commands it is asked to run.
+type testServer struct {
+	t        *testing.T
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	lock  sync.Mutex
+	conns []net.Conn
+	dials int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	return newTestServerWithConfig(t, &ssh.ServerConfig{NoClientAuth: true})
+}
+
+func newTestServerWithConfig(t *testing.T, config *ssh.ServerConfig) *testServer {
+	s := &testServer{
+		t:      t,
+		config: config,
+	}
+	s.config.AddHostKey(testHostKey(t))
+	var err error
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	tests.Assert(t, err == nil)
+	go s.serve()
+	return s
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		s.conns = append(s.conns, conn)
+		s.dials++
+		s.lock.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var exec struct{ Command string }
+				ssh.Unmarshal(req.Payload, &exec)
+				req.Reply(true, nil)
+				channel.Write([]byte(exec.Command))
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				return
+			}
+		}()
+	}
+}
+
+// connections returns the number of connections made to the server.
+func (s *testServer) connections() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.dials
+}
+
+// drop closes the connections to the server.
+func (s *testServer) drop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testServer) Close() {
+	s.listener.Close()
+	s.drop()
+}
+
+func testSshExec(config PoolConfig) *SshExec {
+	s := newSshExec(utils.NewLogger("[test]", utils.LEVEL_NOLOG),
+		&ssh.ClientConfig{
+			User:            "heketi",
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		})
+	s.SetPoolConfig(config)
+	return s
+}
+
+func (s *SshExec) idleConnections() int {
+	s.pool.lock.Lock()
+	defer s.pool.lock.Unlock()
+	n := 0
+	for _, conns := range s.pool.idle {
+		n += len(conns)
+	}
+	return n
+}
+
+func TestConnectAndExecReusesConnections(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	s := testSshExec(DefaultPoolConfig)
+	defer s.Close()
+	host := server.listener.Addr().String()
+
+	for i := 0; i < 3; i++ {
+		out, err := s.ConnectAndExec(host, []string{"echo 1", "echo 2"}, 1, false)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(out) == 2)
+		tests.Assert(t, strings.Contains(out[1], "echo 2"), "got:", out)
+	}
+	tests.Assert(t, server.connections() == 1, "got:", server.connections())
+	tests.Assert(t, s.idleConnections() == 1)
+
+	// connections are not kept without an idle timeout
+	s = testSshExec(PoolConfig{})
+	for i := 0; i < 2; i++ {
+		_, err := s.ConnectAndExec(host, []string{"echo 1"}, 1, false)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	tests.Assert(t, server.connections() == 3, "got:", server.connections())
+	tests.Assert(t, s.idleConnections() == 0)
+}
+
+func TestConnectAndExecIdleTimeout(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	s := testSshExec(PoolConfig{
+		IdleTimeout:       50 * time.Millisecond,
+		KeepaliveInterval: 10 * time.Millisecond,
+	})
+	defer s.Close()
+	host := server.listener.Addr().String()
+
+	_, err := s.ConnectAndExec(host, []string{"echo 1"}, 1, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, s.idleConnections() == 1)
+
+	// the connection is kept alive until it was idle for too long
+	time.Sleep(30 * time.Millisecond)
+	tests.Assert(t, s.idleConnections() == 1)
+	for i := 0; i < 50 && s.idleConnections() != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, s.idleConnections() == 0)
+
+	_, err = s.ConnectAndExec(host, []string{"echo 1"}, 1, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, server.connections() == 2, "got:", server.connections())
+}
+
+func TestConnectAndExecReconnects(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	s := testSshExec(DefaultPoolConfig)
+	defer s.Close()
+	host := server.listener.Addr().String()
+
+	_, err := s.ConnectAndExec(host, []string{"echo 1"}, 1, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the unused connection is lost
+	server.drop()
+	time.Sleep(10 * time.Millisecond)
+
+	out, err := s.ConnectAndExec(host, []string{"echo 2"}, 1, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, strings.Contains(out[0], "echo 2"), "got:", out)
+	tests.Assert(t, server.connections() == 2, "got:", server.connections())
+}
+
+func TestConnectAndExecDialTimeout(t *testing.T) {
+	// the server never answers the handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.Assert(t, err == nil)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	s := testSshExec(PoolConfig{DialTimeout: 50 * time.Millisecond})
+	start := time.Now()
+	_, err = s.ConnectAndExec(l.Addr().String(), []string{"echo 1"}, 1, false)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "connection timed out"),
+		"got:", err)
+	tests.Assert(t, time.Since(start) < 5*time.Second)
+}
@@ -11,22 +11,40 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"errors"
-	"fmt"
 	"io/ioutil"
-	"log"
 	"net"
-	"os"
+	"sync"
 	"time"
 
 	"github.com/chinacoolhacker/heketi/pkg/utils"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/agent"
 )
 
 type SshExec struct {
 	clientConfig *ssh.ClientConfig
 	logger       *utils.Logger
+	pool         *connPool
+
+	lock sync.RWMutex
+	// credentials of the hosts logged in to differently
+	hostAuth map[string]hostAuth
+}
+
+type hostAuth struct {
+	user string
+	auth []ssh.AuthMethod
+}
+
+func newSshExec(logger *utils.Logger, config *ssh.ClientConfig) *SshExec {
+	sshexec := &SshExec{
+		clientConfig: config,
+		logger:       logger,
+		hostAuth:     map[string]hostAuth{},
+	}
+	sshexec.pool = newConnPool(DefaultPoolConfig, sshexec.dial)
+	return sshexec
 }
 
 func getKeyFile(file string) (key ssh.Signer, err error) {
@@ -35,156 +53,283 @@ func getKeyFile(file string) (key ssh.Signer, err error) {
 		return
 	}
 	key, err = ssh.ParsePrivateKey(buf)
-	if err != nil {
-		fmt.Print(err)
-		return
-	}
 	return
 }
 
 func NewSshExecWithAuth(logger *utils.Logger, user string) *SshExec {
-
-	sshexec := &SshExec{}
-	sshexec.logger = logger
-
-	authSocket := os.Getenv("SSH_AUTH_SOCK")
-	if authSocket == "" {
-		log.Fatal("SSH_AUTH_SOCK required, check that your ssh agent is running")
-		return nil
-	}
-
-	agentUnixSock, err := net.Dial("unix", authSocket)
+	sshexec, err := NewSshExecWithCredentials(logger, Credentials{
+		User:  user,
+		Agent: true,
+	})
 	if err != nil {
-		log.Fatal(err)
+		logger.Err(err)
 		return nil
 	}
+	return sshexec
+}
 
-	agent := agent.NewClient(agentUnixSock)
-	signers, err := agent.Signers()
+func NewSshExecWithKeyFile(logger *utils.Logger, user string, file string) *SshExec {
+	sshexec, err := NewSshExecWithCredentials(logger, Credentials{
+		User:    user,
+		KeyFile: file,
+	})
 	if err != nil {
-		log.Fatal(err)
+		logger.Err(err)
 		return nil
 	}
-
-	sshexec.clientConfig = &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{ssh.PublicKeys(signers...)},
-	}
-
 	return sshexec
 }
 
-func NewSshExecWithKeyFile(logger *utils.Logger, user string, file string) *SshExec {
+// This function requires the password string to be crypt encrypted
+func NewSshExecWithPassword(logger *utils.Logger, user string, password string) *SshExec {
 
-	var key ssh.Signer
-	var err error
+	// Define the Client Config as :
+	return newSshExec(logger, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+}
 
-	sshexec := &SshExec{}
-	sshexec.logger = logger
+// SetHostKeyVerifier makes the connections verify the keys of the hosts
+// with v. Without a verifier any host key is accepted.
+func (s *SshExec) SetHostKeyVerifier(v *HostKeyVerifier) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clientConfig.HostKeyCallback = v.Verify
+}
 
-	// Now in the main function DO:
-	if key, err = getKeyFile(file); err != nil {
-		fmt.Println("Unable to get keyfile")
-		return nil
-	}
-	// Define the Client Config as :
-	sshexec.clientConfig = &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(key),
-		},
+// hostClientConfig returns the configuration of the connections to
+// host, with the credentials of host.
+func (s *SshExec) hostClientConfig(host string) *ssh.ClientConfig {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	config := *s.clientConfig
+	if a, ok := s.hostAuth[hostOnly(host)]; ok {
+		if a.user != "" {
+			config.User = a.user
+		}
+		config.Auth = a.auth
 	}
+	return &config
+}
 
-	return sshexec
+// SetPoolConfig configures the connections kept open to the hosts.
+// Without it DefaultPoolConfig is used.
+func (s *SshExec) SetPoolConfig(config PoolConfig) {
+	s.pool.setConfig(config)
 }
 
-// This function requires the password string to be crypt encrypted
-func NewSshExecWithPassword(logger *utils.Logger, user string, password string) *SshExec {
+// Close closes the connections kept open to the hosts.
+func (s *SshExec) Close() {
+	s.pool.close()
+}
 
-	sshexec := &SshExec{}
-	sshexec.logger = logger
+func (s *SshExec) ConnectAndExec(host string, commands []string, timeoutMinutes int, useSudo bool) ([]string, error) {
+	return s.ConnectAndExecContext(context.Background(), host, commands, timeoutMinutes, useSudo)
+}
 
-	// Define the Client Config as :
-	sshexec.clientConfig = &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{ssh.Password(password)},
+// dial connects to host. The connection is abandoned if ctx is done
+// before the ssh handshake completed.
+func (s *SshExec) dial(ctx context.Context, host string) (*ssh.Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
 	}
 
-	return sshexec
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	// keep the error of the host key check, which the handshake only
+	// returns as text
+	config := s.hostClientConfig(host)
+	var hostKeyErr *HostKeyError
+	verify := config.HostKeyCallback
+	config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := verify(hostname, remote, key)
+		if e, ok := err.(*HostKeyError); ok {
+			hostKeyErr = e
+		}
+		return err
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, host, config)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if hostKeyErr != nil {
+			return nil, hostKeyErr
+		}
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
 }
 
+// ConnectAndExecContext runs the commands on host one after the other.
+// Once ctx is done the running command is killed and the remaining
+// commands are not started. The connection to host is reused by the
+// next commands unless a command was killed.
+//
 // This function was based from https://github.com/coreos/etcd-manager/blob/master/main.go
-func (s *SshExec) ConnectAndExec(host string, commands []string, timeoutMinutes int, useSudo bool) ([]string, error) {
+func (s *SshExec) ConnectAndExecContext(ctx context.Context, host string, commands []string, timeoutMinutes int, useSudo bool) ([]string, error) {
 
 	buffers := make([]string, len(commands))
 
-	// :TODO: Will need a timeout here in case the server does not respond
-	client, err := ssh.Dial("tcp", host, s.clientConfig)
+	client, reused, err := s.pool.get(ctx, host)
 	if err != nil {
 		s.logger.Warning("Failed to create SSH connection to %v: %v", host, err)
 		return nil, err
 	}
-	defer client.Close()
+	keep := true
+	defer func() {
+		if client == nil {
+			return
+		} else if keep {
+			s.pool.put(host, client)
+		} else {
+			client.Close()
+		}
+	}()
 
 	// Execute each command
 	for index, command := range commands {
 
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		session, err := client.NewSession()
+		if err != nil && reused {
+			// The connection was lost while unused, the command can
+			// be run on a new one as it was not sent.
+			s.logger.Debug("Reconnecting to %v: %v", host, err)
+			client.Close()
+			client, err = s.pool.connect(ctx, host)
+			if err != nil {
+				s.logger.Warning("Failed to create SSH connection to %v: %v", host, err)
+				return nil, err
+			}
+			session, err = client.NewSession()
+		}
+		reused = false
 		if err != nil {
+			keep = false
 			s.logger.LogError("Unable to create SSH session: %v", err)
 			return nil, err
 		}
-		defer session.Close()
-
-		// Create a buffer to trap session output
-		var b bytes.Buffer
-		var berr bytes.Buffer
-		session.Stdout = &b
-		session.Stderr = &berr
-
-		if useSudo {
-			command = "sudo " + command
-		}
-		// Execute command in a shell
-		command = "/bin/bash -c '" + command + "'"
 
-		// Execute command
-		err = session.Start(command)
-		if err != nil {
+		output, err := s.run(ctx, session, host, command, timeoutMinutes, useSudo)
+		session.Close()
+		if err == errCommandKilled {
+			// the command may still hold the connection
+			keep = false
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, ErrCommandTimeout
+		} else if err != nil {
 			return nil, err
 		}
+		buffers[index] = output
+	}
 
-		// Spawn function to wait for results
-		errch := make(chan error)
-		go func() {
-			errch <- session.Wait()
-		}()
+	return buffers, nil
+}
 
-		// Set the timeout
-		timeout := time.After(time.Minute * time.Duration(timeoutMinutes))
+var (
+	errCommandKilled = errors.New("command killed")
 
-		// Wait for either the command completion or timeout
-		select {
-		case err := <-errch:
-			if err != nil {
-				s.logger.LogError("Failed to run command [%v] on %v: Err[%v]: Stdout [%v]: Stderr [%v]",
-					command, host, err, b.String(), berr.String())
-				return nil, fmt.Errorf("%s", berr.String())
-			}
-			s.logger.Debug("Host: %v Command: %v\nResult: %v", host, command, b.String())
-			buffers[index] = b.String()
+	// ErrCommandTimeout is returned when a command did not complete
+	// in time.
+	ErrCommandTimeout = errors.New("SSH command timeout")
+)
+
+// CommandError is a command which ran on the host and failed. Its
+// message is the standard error of the command.
+type CommandError struct {
+	// exit status of the command, -1 if it exited without one
+	ExitStatus int
+	Stdout     string
+	Stderr     string
+}
+
+func (e *CommandError) Error() string {
+	return e.Stderr
+}
 
-		case <-timeout:
-			s.logger.LogError("Timeout on command [%v] on %v: Err[%v]: Stdout [%v]: Stderr [%v]",
+// run runs command in session. The command is killed, and
+// errCommandKilled returned, once ctx is done or the timeout expired.
+func (s *SshExec) run(ctx context.Context, session *ssh.Session,
+	host, command string, timeoutMinutes int, useSudo bool) (string, error) {
+
+	// Create a buffer to trap session output
+	var b bytes.Buffer
+	var berr bytes.Buffer
+	session.Stdout = &b
+	session.Stderr = &berr
+
+	if useSudo {
+		command = "sudo " + command
+	}
+	// Execute command in a shell
+	command = "/bin/bash -c '" + command + "'"
+
+	// Execute command
+	err := session.Start(command)
+	if err != nil {
+		return "", err
+	}
+
+	// Spawn function to wait for results
+	errch := make(chan error, 1)
+	go func() {
+		errch <- session.Wait()
+	}()
+
+	// Set the timeout
+	timeout := time.After(time.Minute * time.Duration(timeoutMinutes))
+
+	// Wait for either the command completion or timeout
+	select {
+	case err := <-errch:
+		if err != nil {
+			s.logger.LogError("Failed to run command [%v] on %v: Err[%v]: Stdout [%v]: Stderr [%v]",
 				command, host, err, b.String(), berr.String())
-			err := session.Signal(ssh.SIGKILL)
-			if err != nil {
-				s.logger.LogError("Unable to send kill signal to command [%v] on host [%v]: %v",
-					command, host, err)
+			status := -1
+			if exitErr, ok := err.(*ssh.ExitError); ok {
+				status = exitErr.ExitStatus()
+			}
+			return "", &CommandError{
+				ExitStatus: status,
+				Stdout:     b.String(),
+				Stderr:     berr.String(),
 			}
-			return nil, errors.New("SSH command timeout")
 		}
+		s.logger.Debug("Host: %v Command: %v\nResult: %v", host, command, b.String())
+		return b.String(), nil
+
+	case <-timeout:
+		s.logger.LogError("Timeout on command [%v] on %v: Err[%v]: Stdout [%v]: Stderr [%v]",
+			command, host, err, b.String(), berr.String())
+
+	case <-ctx.Done():
+		s.logger.Warning("Cancelled command [%v] on %v", command, host)
 	}
 
-	return buffers, nil
+	err = session.Signal(ssh.SIGKILL)
+	if err != nil {
+		s.logger.LogError("Unable to send kill signal to command [%v] on host [%v]: %v",
+			command, host, err)
+	}
+	return "", errCommandKilled
 }
@@ -0,0 +1,7 @@
+#!/bin/bash
+
+# run the tests that use a db once more, against the local kv
+# storage backend instead of BoltDB
+GOPACKAGES="$(go list ./apps/... ./pkg/db/... | grep -v vendor)"
+# shellcheck disable=SC2086
+HEKETI_TEST_DB_BACKEND=localkv exec go test ${GOPACKAGES}